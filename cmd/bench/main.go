@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/version"
+)
+
+const usage = `Usage: bench [flags] <url>
+
+Generates HTTP(S) load against Sentinel and reports latency percentiles,
+status codes and errors.
+
+With -paths, requests cycle through the paths in a file, one per line as
+"/path" or "METHOD /path"; paths are resolved against <url>. Blank lines and
+lines starting with # are ignored.
+
+Flags:
+`
+
+// request is one entry of the request mix
+type request struct {
+	method string
+	url    string
+}
+
+// result is the outcome of one request
+type result struct {
+	latency time.Duration
+	status  int
+	bytes   int64
+	err     string
+}
+
+// report summarizes a run
+type report struct {
+	URL         string         `json:"url"`
+	Connections int            `json:"connections"`
+	TargetRPS   int            `json:"target_rps,omitempty"`
+	Duration    float64        `json:"duration_seconds"`
+	Requests    int            `json:"requests"`
+	Throughput  float64        `json:"requests_per_second"`
+	BytesRead   int64          `json:"bytes_read"`
+	Latency     latencyReport  `json:"latency_ms"`
+	StatusCodes map[string]int `json:"status_codes"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	ErrorRate   float64        `json:"error_rate"`
+	Interrupted bool           `json:"interrupted,omitempty"`
+}
+
+// latencyReport lists latency statistics in milliseconds
+type latencyReport struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// percentileStat is one row of the latency table
+type percentileStat struct {
+	name  string
+	value float64
+}
+
+func main() {
+	var connections = flag.Int("c", 10, "Number of concurrent connections")
+	var rps = flag.Int("rps", 0, "Total requests per second across all connections (0 for as fast as possible)")
+	var duration = flag.Duration("d", 10*time.Second, "Test duration")
+	var pathsFile = flag.String("paths", "", "File with request paths, one per line")
+	var method = flag.String("method", http.MethodGet, "Request method for paths without one")
+	var bodyFile = flag.String("body", "", "File with the request body")
+	var headers headerFlags
+	flag.Var(&headers, "header", "Request header as \"Name: value\" (repeatable)")
+	var timeout = flag.Duration("timeout", 30*time.Second, "Request timeout")
+	var insecure = flag.Bool("insecure", false, "Skip TLS certificate verification")
+	var keepAlive = flag.Bool("keepalive", true, "Reuse connections between requests")
+	var output = flag.String("output", "table", "Output format (table, json)")
+	var showVersion = flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("bench %s\n", version.Get())
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *connections < 1 {
+		fail("-c must be at least 1")
+	}
+	if *output != "table" && *output != "json" {
+		fail("invalid output format: %s, must be one of: table, json", *output)
+	}
+
+	base, err := url.Parse(flag.Arg(0))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		fail("invalid URL: %s", flag.Arg(0))
+	}
+
+	requests, err := loadRequests(base, *pathsFile, *method)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	var body []byte
+	if *bodyFile != "" {
+		if body, err = os.ReadFile(*bodyFile); err != nil {
+			fail("failed to read body: %v", err)
+		}
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			MaxIdleConns:        *connections,
+			MaxIdleConnsPerHost: *connections,
+			MaxConnsPerHost:     *connections,
+			DisableKeepAlives:   !*keepAlive,
+			DisableCompression:  true,
+			ForceAttemptHTTP2:   true,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: *insecure},
+		},
+		// Measure the proxy's responses, not their redirect targets
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	if *output == "table" {
+		rate := "unlimited"
+		if *rps > 0 {
+			rate = fmt.Sprintf("%d/s", *rps)
+		}
+		fmt.Fprintf(os.Stderr, "Running %s against %s with %d connections, rate %s\n", *duration, base, *connections, rate)
+	}
+
+	start := time.Now()
+	results := run(ctx, client, requests, body, headers, *connections, *rps)
+	elapsed := time.Since(start)
+
+	rep := summarize(results, elapsed)
+	rep.URL = base.String()
+	rep.Connections = *connections
+	rep.TargetRPS = *rps
+	rep.Interrupted = elapsed < *duration-100*time.Millisecond
+
+	if *output == "json" {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printReport(rep)
+}
+
+// run sends requests from each connection until ctx is done. With a rate,
+// requests are scheduled at fixed intervals shared by all connections.
+func run(ctx context.Context, client *http.Client, requests []request, body []byte, headers headerFlags, connections, rps int) []result {
+	var interval time.Duration
+	if rps > 0 {
+		interval = time.Second / time.Duration(rps)
+	}
+
+	start := time.Now()
+	var seq atomic.Int64
+	perWorker := make([][]result, connections)
+
+	var wg sync.WaitGroup
+	for i := 0; i < connections; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				n := seq.Add(1) - 1
+				if interval > 0 {
+					due := start.Add(time.Duration(n) * interval)
+					if wait := time.Until(due); wait > 0 {
+						select {
+						case <-time.After(wait):
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+
+				res, ok := send(ctx, client, requests[n%int64(len(requests))], body, headers)
+				if !ok {
+					// Cancelled because the test ended
+					return
+				}
+				perWorker[worker] = append(perWorker[worker], res)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var results []result
+	for _, r := range perWorker {
+		results = append(results, r...)
+	}
+	return results
+}
+
+// send performs one request. It reports false if the request was cancelled
+// by the end of the test.
+func send(ctx context.Context, client *http.Client, req request, body []byte, headers headerFlags) (result, bool) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, reader)
+	if err != nil {
+		return result{err: err.Error()}, true
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		if strings.EqualFold(strings.TrimSpace(name), "Host") {
+			httpReq.Host = strings.TrimSpace(value)
+			continue
+		}
+		httpReq.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	started := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result{}, false
+		}
+		return result{latency: time.Since(started), err: classifyError(err)}, true
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res := result{latency: time.Since(started), status: resp.StatusCode, bytes: n}
+	if err != nil {
+		if ctx.Err() != nil {
+			return result{}, false
+		}
+		res.err = classifyError(err)
+	}
+	return res, true
+}
+
+// classifyError groups request errors into broad causes
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection closed"
+	}
+
+	var tlsErr *tls.CertificateVerificationError
+	if errors.As(err, &tlsErr) {
+		return "tls: certificate verification failed"
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// summarize computes the report of a run
+func summarize(results []result, elapsed time.Duration) *report {
+	rep := &report{
+		Duration:    elapsed.Seconds(),
+		Requests:    len(results),
+		StatusCodes: make(map[string]int),
+		Errors:      make(map[string]int),
+	}
+	if elapsed > 0 {
+		rep.Throughput = float64(len(results)) / elapsed.Seconds()
+	}
+
+	latencies := make([]time.Duration, 0, len(results))
+	failed := 0
+	var total time.Duration
+	for _, res := range results {
+		rep.BytesRead += res.bytes
+		latencies = append(latencies, res.latency)
+		total += res.latency
+		switch {
+		case res.err != "":
+			rep.Errors[res.err]++
+			failed++
+		default:
+			rep.StatusCodes[fmt.Sprintf("%d", res.status)]++
+			if res.status >= http.StatusInternalServerError {
+				failed++
+			}
+		}
+	}
+	if len(results) == 0 {
+		return rep
+	}
+	rep.ErrorRate = float64(failed) / float64(len(results))
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	percentile := func(p float64) float64 {
+		index := int(p/100*float64(len(latencies))+0.5) - 1
+		index = max(0, min(index, len(latencies)-1))
+		return ms(latencies[index])
+	}
+	rep.Latency = latencyReport{
+		Min:  ms(latencies[0]),
+		Mean: ms(total / time.Duration(len(latencies))),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P95:  percentile(95),
+		P99:  percentile(99),
+		Max:  ms(latencies[len(latencies)-1]),
+	}
+	return rep
+}
+
+// printReport prints a report as tables
+func printReport(rep *report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Requests:\t%d\n", rep.Requests)
+	fmt.Fprintf(w, "Duration:\t%.2fs\n", rep.Duration)
+	fmt.Fprintf(w, "Throughput:\t%.1f req/s\n", rep.Throughput)
+	fmt.Fprintf(w, "Bytes read:\t%d\n", rep.BytesRead)
+	fmt.Fprintf(w, "Error rate:\t%.2f%%\n", rep.ErrorRate*100)
+	if rep.Interrupted {
+		fmt.Fprintf(w, "Interrupted:\tyes\n")
+	}
+	w.Flush()
+
+	if rep.Requests == 0 {
+		return
+	}
+
+	fmt.Println("\nLatency:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, stat := range []percentileStat{
+		{"min", rep.Latency.Min},
+		{"mean", rep.Latency.Mean},
+		{"p50", rep.Latency.P50},
+		{"p90", rep.Latency.P90},
+		{"p95", rep.Latency.P95},
+		{"p99", rep.Latency.P99},
+		{"max", rep.Latency.Max},
+	} {
+		fmt.Fprintf(w, "  %s\t%.2fms\n", stat.name, stat.value)
+	}
+	w.Flush()
+
+	if len(rep.StatusCodes) > 0 {
+		fmt.Println("\nStatus codes:")
+		printCounts(rep.StatusCodes)
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Println("\nErrors:")
+		printCounts(rep.Errors)
+	}
+}
+
+// printCounts prints counts by key, most frequent first
+func printCounts(counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", key, counts[key])
+	}
+	w.Flush()
+}
+
+// loadRequests builds the request mix from a paths file, or the base URL
+// alone when no file is given
+func loadRequests(base *url.URL, pathsFile, method string) ([]request, error) {
+	if pathsFile == "" {
+		return []request{{method: method, url: base.String()}}, nil
+	}
+
+	file, err := os.Open(pathsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open paths file: %w", err)
+	}
+	defer file.Close()
+
+	var requests []request
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		reqMethod, path := method, text
+		if fields := strings.Fields(text); len(fields) == 2 {
+			reqMethod, path = strings.ToUpper(fields[0]), fields[1]
+		} else if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"/path\" or \"METHOD /path\"", pathsFile, line)
+		}
+
+		ref, err := url.Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid path: %w", pathsFile, line, err)
+		}
+		requests = append(requests, request{method: reqMethod, url: base.ResolveReference(ref).String()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read paths file: %w", err)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no paths in %s", pathsFile)
+	}
+	return requests, nil
+}
+
+// headerFlags collects repeated -header flags
+type headerFlags []string
+
+// String returns the headers for display
+func (h headerFlags) String() string {
+	return strings.Join(h, ", ")
+}
+
+// Set adds a "Name: value" header
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be \"Name: value\"")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
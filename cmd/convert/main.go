@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/convert"
+	"github.com/bpradana/sentinel/internal/version"
+)
+
+const usage = `Usage: convert [flags] <file>
+
+Translates nginx server/location/upstream blocks or a Caddyfile into
+Sentinel routes.yaml and upstreams.yaml (and tls.yaml when certificates are
+configured). Directives without a Sentinel equivalent are reported as
+warnings; review them and the generated files before use.
+
+Flags:
+`
+
+func main() {
+	var from = flag.String("from", "auto", "Source format (auto, nginx, caddy)")
+	var outputDir = flag.String("output", "", "Directory to write the generated files to (default: print them)")
+	var force = flag.Bool("force", false, "Overwrite existing files in the output directory")
+	var showVersion = flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("convert %s\n", version.Get())
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file := flag.Arg(0)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fail("failed to read %s: %v", file, err)
+	}
+
+	format := *from
+	if format == "auto" {
+		format = detectFormat(file, data)
+	}
+
+	var result *convert.Result
+	switch format {
+	case "nginx":
+		result, err = convert.FromNginx(data, filepath.Base(file))
+	case "caddy":
+		result, err = convert.FromCaddyfile(data, filepath.Base(file))
+	default:
+		fail("invalid source format: %s, must be one of: auto, nginx, caddy", format)
+	}
+	if err != nil {
+		fail("failed to convert %s: %v", file, err)
+	}
+
+	files := []struct {
+		name   string
+		render func() ([]byte, error)
+	}{
+		{"upstreams.yaml", result.UpstreamsYAML},
+		{"routes.yaml", result.RoutesYAML},
+		{"tls.yaml", result.TLSYAML},
+	}
+
+	var rendered []string
+	for _, f := range files {
+		content, err := f.render()
+		if err != nil {
+			fail("%v", err)
+		}
+		if content == nil {
+			continue
+		}
+
+		if *outputDir == "" {
+			if len(rendered) > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# ==> %s <==\n%s", f.name, content)
+			rendered = append(rendered, f.name)
+			continue
+		}
+
+		if err := os.MkdirAll(*outputDir, 0755); err != nil {
+			fail("failed to create output directory: %v", err)
+		}
+		path := filepath.Join(*outputDir, f.name)
+		if _, err := os.Stat(path); err == nil && !*force {
+			fail("%s already exists, use -force to overwrite", path)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			fail("failed to write %s: %v", path, err)
+		}
+		rendered = append(rendered, path)
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if *outputDir != "" {
+		fmt.Fprintf(os.Stderr, "Converted %d routes and %d upstreams to %s\n", len(result.Routes), len(result.Upstreams), strings.Join(rendered, ", "))
+	}
+}
+
+// detectFormat guesses the source format from the file name and content
+func detectFormat(file string, data []byte) string {
+	base := strings.ToLower(filepath.Base(file))
+	switch {
+	case strings.HasPrefix(base, "caddyfile") || strings.HasSuffix(base, ".caddyfile") || strings.HasSuffix(base, ".caddy"):
+		return "caddy"
+	case strings.Contains(base, "nginx") || strings.HasSuffix(base, ".conf"):
+		return "nginx"
+	case bytes.Contains(data, []byte("reverse_proxy")):
+		return "caddy"
+	default:
+		return "nginx"
+	}
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
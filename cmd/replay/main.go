@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/version"
+)
+
+const usage = `Usage: replay [flags] <target-url> <file>
+
+Replays requests recorded in a Sentinel access log or a HAR file against a
+target, at their original pace or scaled, and compares the responses with
+the recorded status codes.
+
+Access logs are the JSON logs of the logging middleware: "Request started"
+entries (log_requests) are replayed, with the headers recorded by
+log_headers; "Request completed" entries (log_responses) provide the original
+status codes. Access logs do not record request bodies.
+
+Flags:
+`
+
+// Access log messages of the logging middleware
+const (
+	startedMessage   = "Request started"
+	completedMessage = "Request completed"
+	failedMessage    = "Request completed with error"
+)
+
+// recorded is a request read from a log
+type recorded struct {
+	at      time.Time
+	method  string
+	uri     string // path and query
+	host    string
+	headers http.Header
+	body    []byte
+	status  int // original status, 0 if unknown
+}
+
+// outcome is the result of replaying a request
+type outcome struct {
+	req     *recorded
+	latency time.Duration
+	lag     time.Duration
+	status  int
+	err     string
+}
+
+// report summarizes a replay
+type report struct {
+	Target      string         `json:"target"`
+	Requests    int            `json:"requests"`
+	Duration    float64        `json:"duration_seconds"`
+	Speed       float64        `json:"speed"`
+	StatusCodes map[string]int `json:"status_codes"`
+	Errors      map[string]int `json:"errors,omitempty"`
+	Compared    int            `json:"compared"`
+	Mismatches  map[string]int `json:"mismatches,omitempty"`
+	LatencyP50  float64        `json:"latency_p50_ms"`
+	LatencyP90  float64        `json:"latency_p90_ms"`
+	LatencyP99  float64        `json:"latency_p99_ms"`
+	MaxLag      float64        `json:"max_lag_ms"`
+	Interrupted bool           `json:"interrupted,omitempty"`
+}
+
+func main() {
+	var format = flag.String("format", "auto", "Input format (auto, log, har)")
+	var speed = flag.Float64("speed", 1, "Replay speed relative to the recording, e.g. 2 for twice as fast (0 for as fast as possible)")
+	var concurrency = flag.Int("c", 50, "Maximum concurrent requests")
+	var limit = flag.Int("limit", 0, "Replay at most this many requests (0 for all)")
+	var preserveHost = flag.Bool("preserve-host", true, "Send the recorded Host header instead of the target's")
+	var headers headerFlags
+	flag.Var(&headers, "header", "Add or override a request header as \"Name: value\" (repeatable)")
+	var timeout = flag.Duration("timeout", 30*time.Second, "Request timeout")
+	var insecure = flag.Bool("insecure", false, "Skip TLS certificate verification")
+	var verbose = flag.Bool("v", false, "Print every request whose status differs from the recording")
+	var dryRun = flag.Bool("dry-run", false, "Print the requests that would be replayed and exit")
+	var output = flag.String("output", "table", "Output format (table, json)")
+	var showVersion = flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("replay %s\n", version.Get())
+		return
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *speed < 0 {
+		fail("-speed cannot be negative")
+	}
+	if *concurrency < 1 {
+		fail("-c must be at least 1")
+	}
+	if *output != "table" && *output != "json" {
+		fail("invalid output format: %s, must be one of: table, json", *output)
+	}
+
+	target, err := url.Parse(flag.Arg(0))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fail("invalid target URL: %s", flag.Arg(0))
+	}
+
+	requests, err := load(flag.Arg(1), *format)
+	if err != nil {
+		fail("%v", err)
+	}
+	if *limit > 0 && len(requests) > *limit {
+		requests = requests[:*limit]
+	}
+	if len(requests) == 0 {
+		fail("no requests found in %s", flag.Arg(1))
+	}
+
+	if *dryRun {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OFFSET\tMETHOD\tHOST\tURI\tSTATUS")
+		for _, req := range requests {
+			status := "-"
+			if req.status > 0 {
+				status = fmt.Sprint(req.status)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", req.at.Sub(requests[0].at).Round(time.Millisecond), req.method, req.host, req.uri, status)
+		}
+		w.Flush()
+		return
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			MaxIdleConnsPerHost: *concurrency,
+			ForceAttemptHTTP2:   true,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: *insecure},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *output == "table" {
+		span := requests[len(requests)-1].at.Sub(requests[0].at)
+		fmt.Fprintf(os.Stderr, "Replaying %d requests recorded over %s against %s at %gx speed\n", len(requests), span.Round(time.Second), target, *speed)
+	}
+
+	start := time.Now()
+	outcomes := replay(ctx, client, target, requests, headers, *preserveHost, *speed, *concurrency)
+	rep := summarize(outcomes, time.Since(start))
+	rep.Target = target.String()
+	rep.Speed = *speed
+	rep.Interrupted = ctx.Err() != nil
+
+	if *verbose {
+		for _, o := range outcomes {
+			if o.req.status > 0 && o.err == "" && o.status != o.req.status {
+				fmt.Fprintf(os.Stderr, "%d -> %d  %s %s%s\n", o.req.status, o.status, o.req.method, o.req.host, o.req.uri)
+			}
+		}
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		// Keep "->" in mismatch keys readable
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(rep)
+		return
+	}
+	printReport(rep)
+}
+
+// replay sends the requests at their recorded offsets divided by speed
+func replay(ctx context.Context, client *http.Client, target *url.URL, requests []*recorded, headers headerFlags, preserveHost bool, speed float64, concurrency int) []outcome {
+	outcomes := make([]outcome, 0, len(requests))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	first := requests[0].at
+	start := time.Now()
+	for _, req := range requests {
+		due := start
+		if speed > 0 {
+			due = start.Add(time.Duration(float64(req.at.Sub(first)) / speed))
+		}
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(req *recorded, lag time.Duration) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			o := send(ctx, client, target, req, headers, preserveHost)
+			o.lag = lag
+			mu.Lock()
+			outcomes = append(outcomes, o)
+			mu.Unlock()
+		}(req, max(0, time.Since(due)))
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// send replays one request
+func send(ctx context.Context, client *http.Client, target *url.URL, req *recorded, headers headerFlags, preserveHost bool) outcome {
+	o := outcome{req: req}
+
+	ref, err := url.Parse(req.uri)
+	if err != nil {
+		o.err = "invalid recorded URI"
+		return o
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target.ResolveReference(ref).String(), body)
+	if err != nil {
+		o.err = err.Error()
+		return o
+	}
+	for name, values := range req.headers {
+		for _, value := range values {
+			httpReq.Header.Add(name, value)
+		}
+	}
+	if preserveHost && req.host != "" {
+		httpReq.Host = req.host
+	}
+	for name, value := range headers {
+		if strings.EqualFold(name, "Host") {
+			httpReq.Host = value
+			continue
+		}
+		httpReq.Header.Set(name, value)
+	}
+
+	started := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		o.latency = time.Since(started)
+		o.err = classifyError(err)
+		return o
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	o.latency = time.Since(started)
+	o.status = resp.StatusCode
+	return o
+}
+
+// load reads recorded requests from an access log or HAR file, in order
+func load(file, format string) ([]*recorded, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	if format == "auto" {
+		format = "log"
+		if strings.HasSuffix(file, ".har") || bytes.HasPrefix(bytes.TrimSpace(data), []byte(`{"log"`)) ||
+			bytes.Contains(data[:min(len(data), 512)], []byte(`"entries"`)) {
+			format = "har"
+		}
+	}
+
+	var requests []*recorded
+	switch format {
+	case "log":
+		requests, err = loadAccessLog(data)
+	case "har":
+		requests, err = loadHAR(data)
+	default:
+		return nil, fmt.Errorf("invalid format: %s, must be one of: auto, log, har", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].at.Before(requests[j].at) })
+	return requests, nil
+}
+
+// loadAccessLog reads the requests of a JSON access log. Completed entries
+// are matched to the oldest started entry with the same method, path and
+// client to recover original status codes.
+func loadAccessLog(data []byte) ([]*recorded, error) {
+	type key struct{ method, path, remote string }
+	var requests, completed []*recorded
+	pending := make(map[key][]*recorded)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+
+		message, _ := entry["message"].(string)
+		method, _ := entry["method"].(string)
+		path, _ := entry["path"].(string)
+		remote, _ := entry["remote_addr"].(string)
+		if method == "" || path == "" {
+			continue
+		}
+		k := key{method, path, remote}
+
+		switch message {
+		case startedMessage:
+			req := &recorded{at: entryTime(entry), method: method, uri: path, headers: make(http.Header)}
+			if query, _ := entry["query"].(string); query != "" {
+				req.uri += "?" + query
+			}
+			req.host, _ = entry["host"].(string)
+			for field, value := range entry {
+				name, ok := strings.CutPrefix(field, "header_")
+				if text, isString := value.(string); ok && isString && replayable(name) {
+					req.headers.Add(name, text)
+				}
+			}
+			requests = append(requests, req)
+			pending[k] = append(pending[k], req)
+		case completedMessage, failedMessage:
+			status := 0
+			if value, ok := entry["status"].(float64); ok {
+				status = int(value)
+			}
+			if queue := pending[k]; len(queue) > 0 {
+				queue[0].status = status
+				pending[k] = queue[1:]
+				continue
+			}
+			// Without request logging, replay completed requests
+			completed = append(completed, &recorded{at: entryTime(entry), method: method, uri: path, status: status})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(requests) == 0 {
+		return completed, nil
+	}
+	return requests, nil
+}
+
+// entryTime returns the timestamp of a log entry
+func entryTime(entry map[string]any) time.Time {
+	switch value := entry["timestamp"].(type) {
+	case string:
+		for _, layout := range []string{"2006-01-02T15:04:05.000Z0700", time.RFC3339Nano} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t
+			}
+		}
+	case float64:
+		return time.Unix(0, int64(value*float64(time.Second)))
+	}
+	if ts, ok := entry["ts"].(float64); ok {
+		return time.Unix(0, int64(ts*float64(time.Second)))
+	}
+	return time.Time{}
+}
+
+// loadHAR reads the requests of a HAR file
+func loadHAR(data []byte) ([]*recorded, error) {
+	var har struct {
+		Log struct {
+			Entries []struct {
+				StartedDateTime time.Time `json:"startedDateTime"`
+				Request         struct {
+					Method  string `json:"method"`
+					URL     string `json:"url"`
+					Headers []struct {
+						Name  string `json:"name"`
+						Value string `json:"value"`
+					} `json:"headers"`
+					PostData *struct {
+						Text string `json:"text"`
+					} `json:"postData"`
+				} `json:"request"`
+				Response struct {
+					Status int `json:"status"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, err
+	}
+
+	requests := make([]*recorded, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			continue
+		}
+		req := &recorded{
+			at:      entry.StartedDateTime,
+			method:  entry.Request.Method,
+			uri:     u.RequestURI(),
+			host:    u.Host,
+			headers: make(http.Header),
+			status:  entry.Response.Status,
+		}
+		for _, header := range entry.Request.Headers {
+			// HTTP/2 pseudo-headers start with a colon
+			if !strings.HasPrefix(header.Name, ":") && replayable(header.Name) {
+				req.headers.Add(header.Name, header.Value)
+			}
+		}
+		if entry.Request.PostData != nil {
+			req.body = []byte(entry.Request.PostData.Text)
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// replayable reports whether a recorded header is sent when replaying
+func replayable(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Host", "Connection", "Content-Length", "Transfer-Encoding", "Keep-Alive", "Upgrade", "Te", "Trailer", "Proxy-Connection":
+		return false
+	}
+	return true
+}
+
+// classifyError groups request errors into broad causes
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection closed"
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// summarize computes the report of a replay
+func summarize(outcomes []outcome, elapsed time.Duration) *report {
+	rep := &report{
+		Requests:    len(outcomes),
+		Duration:    elapsed.Seconds(),
+		StatusCodes: make(map[string]int),
+		Errors:      make(map[string]int),
+		Mismatches:  make(map[string]int),
+	}
+
+	latencies := make([]time.Duration, 0, len(outcomes))
+	for _, o := range outcomes {
+		latencies = append(latencies, o.latency)
+		rep.MaxLag = max(rep.MaxLag, ms(o.lag))
+		if o.err != "" {
+			rep.Errors[o.err]++
+			continue
+		}
+		rep.StatusCodes[fmt.Sprint(o.status)]++
+		if o.req.status > 0 {
+			rep.Compared++
+			if o.status != o.req.status {
+				rep.Mismatches[fmt.Sprintf("%d -> %d", o.req.status, o.status)]++
+			}
+		}
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		percentile := func(p float64) float64 {
+			index := int(p/100*float64(len(latencies))+0.5) - 1
+			return ms(latencies[max(0, min(index, len(latencies)-1))])
+		}
+		rep.LatencyP50 = percentile(50)
+		rep.LatencyP90 = percentile(90)
+		rep.LatencyP99 = percentile(99)
+	}
+	return rep
+}
+
+// printReport prints a report as tables
+func printReport(rep *report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Requests:\t%d\n", rep.Requests)
+	fmt.Fprintf(w, "Duration:\t%.2fs\n", rep.Duration)
+	fmt.Fprintf(w, "Latency:\tp50 %.2fms, p90 %.2fms, p99 %.2fms\n", rep.LatencyP50, rep.LatencyP90, rep.LatencyP99)
+	// Lag shows when the target or -c could not keep up with the recording
+	fmt.Fprintf(w, "Max lag:\t%.2fms\n", rep.MaxLag)
+	if rep.Compared > 0 {
+		matched := rep.Compared
+		for _, count := range rep.Mismatches {
+			matched -= count
+		}
+		fmt.Fprintf(w, "Matching status:\t%d of %d (%.1f%%)\n", matched, rep.Compared, float64(matched)/float64(rep.Compared)*100)
+	}
+	if rep.Interrupted {
+		fmt.Fprintf(w, "Interrupted:\tyes\n")
+	}
+	w.Flush()
+
+	if len(rep.StatusCodes) > 0 {
+		fmt.Println("\nStatus codes:")
+		printCounts(rep.StatusCodes)
+	}
+	if len(rep.Mismatches) > 0 {
+		fmt.Println("\nStatus changes (recorded -> replayed):")
+		printCounts(rep.Mismatches)
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Println("\nErrors:")
+		printCounts(rep.Errors)
+	}
+}
+
+// printCounts prints counts by key, most frequent first
+func printCounts(counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", key, counts[key])
+	}
+	w.Flush()
+}
+
+// ms converts a duration to milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// headerFlags collects repeated -header flags
+type headerFlags map[string]string
+
+// String returns the headers for display
+func (h headerFlags) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+// Set adds a "Name: value" header
+func (h *headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("header must be \"Name: value\"")
+	}
+	if *h == nil {
+		*h = make(headerFlags)
+	}
+	(*h)[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,13 @@
+// Command sentinel runs the proxy and the tools that manage its
+// configuration and certificates
+package main
+
+import (
+	"os"
+
+	"github.com/bpradana/sentinel/internal/cli"
+)
+
+func main() {
+	cli.Main(os.Args[1:])
+}
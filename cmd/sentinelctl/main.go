@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/admin"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/proxy"
+	"github.com/bpradana/sentinel/internal/tls"
+	"github.com/bpradana/sentinel/internal/version"
+)
+
+const usage = `Usage: sentinelctl [flags] <command>
+
+Commands:
+  routes list               List routing rules in evaluation order
+  routes match [flags] <path>
+                            Show how a request would be routed
+                            (-host, -method, -header "Name: value")
+  upstream list             List upstream services and their targets
+  upstream drain [flags] <target>
+                            Stop sending new requests to a target (URL or host name)
+  upstream disable [flags] <target>
+                            Take a target out of rotation
+  upstream undrain [flags] <target>
+                            Put a drained or disabled target back into rotation
+                            (-upstream name, -reason text)
+  upstream drained          List targets taken out of rotation
+  upstream switch [-to blue|green] <upstream>
+                            Flip the active blue/green target set
+  reload                    Reload the configuration from its source
+  validate                  Validate the configuration in its source without applying it
+  tls list                  List the loaded TLS certificates
+  tls reload                Reload the TLS certificates from disk
+  health                    Show the health of all targets
+  version                   Show the client and proxy versions
+
+Flags:
+`
+
+// client calls the Sentinel admin API
+type client struct {
+	addr   string
+	token  string
+	output string
+	http   *http.Client
+}
+
+func main() {
+	var addr = flag.String("addr", "http://127.0.0.1:8083", "Admin API address")
+	var token = flag.String("token", "", "Admin API token (defaults to $SENTINELCTL_TOKEN)")
+	var output = flag.String("output", "table", "Output format (table, json)")
+	var timeout = flag.Duration("timeout", 10*time.Second, "Request timeout")
+	var showVersion = flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("sentinelctl %s\n", version.Get())
+		return
+	}
+
+	if *output != "table" && *output != "json" {
+		fail("invalid output format %q (expected table or json)", *output)
+	}
+
+	if *token == "" {
+		*token = os.Getenv("SENTINELCTL_TOKEN")
+	}
+
+	c := &client{
+		addr:   strings.TrimRight(*addr, "/"),
+		token:  *token,
+		output: *output,
+		http:   &http.Client{Timeout: *timeout},
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch command := strings.Join(args[:min(len(args), 2)], " "); {
+	case command == "routes list":
+		err = c.listRoutes()
+	case command == "routes match":
+		err = c.matchRoute(args[2:])
+	case command == "upstream list":
+		err = c.listUpstreams()
+	case command == "upstream drain", command == "upstream disable", command == "upstream undrain":
+		err = c.setTargetState(args[1], args[2:])
+	case command == "upstream drained":
+		err = c.listDrained()
+	case command == "upstream switch":
+		err = c.switchUpstream(args[2:])
+	case command == "tls list":
+		err = c.listCertificates(http.MethodGet, "/tls/certificates")
+	case command == "tls reload":
+		err = c.listCertificates(http.MethodPost, "/tls/reload")
+	case args[0] == "reload" && len(args) == 1:
+		err = c.reload()
+	case args[0] == "validate" && len(args) == 1:
+		err = c.validate()
+	case args[0] == "health" && len(args) == 1:
+		err = c.health()
+	case args[0] == "version" && len(args) == 1:
+		err = c.version()
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail("%v", err)
+	}
+}
+
+// listRoutes prints the routing rules
+func (c *client) listRoutes() error {
+	var routes []admin.RouteInfo
+	body, err := c.do(http.MethodGet, "/routes", nil, &routes)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := newTable("#", "HOST", "PATH", "METHODS", "MATCH", "PRIORITY", "UPSTREAM", "MIDDLEWARE", "TIMEOUT")
+	for _, route := range routes {
+		row(w, route.Index, route.Host, route.Path, strings.Join(route.Methods, ","), strings.Join(route.Conditions, ", "),
+			route.Priority, route.Upstream, strings.Join(route.Middleware, ","), route.Timeout)
+	}
+	return w.Flush()
+}
+
+// matchRoute prints how a hypothetical request would be routed
+func (c *client) matchRoute(args []string) error {
+	fs := flag.NewFlagSet("routes match", flag.ExitOnError)
+	var host = fs.String("host", "", "Request host")
+	var method = fs.String("method", http.MethodGet, "Request method")
+	var headers headerFlags
+	fs.Var(&headers, "header", "Request header as \"Name: value\" (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: sentinelctl routes match [-host host] [-method method] [-header \"Name: value\"] <path>")
+	}
+
+	req := admin.MatchRequest{Host: *host, Path: fs.Arg(0), Method: *method, Headers: headers}
+	var match proxy.RouteMatch
+	body, err := c.do(http.MethodPost, "/routes/match", req, &match)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !match.Matched {
+		row(w, "Route:", "none")
+	} else {
+		row(w, "Route:", fmt.Sprintf("#%d %s%s %s", match.Route, match.Host, match.Path, strings.Join(match.Methods, ",")))
+		row(w, "Upstream:", match.Upstream)
+		row(w, "Path:", match.OriginalPath+" -> "+match.RewrittenPath)
+		row(w, "Rewrites:", strings.Join(match.Rewrites, ", "))
+	}
+	var chain []string
+	for _, mw := range match.Middleware {
+		name := mw.Name + " (" + mw.Scope
+		if mw.Overridden {
+			name += ", overridden"
+		}
+		chain = append(chain, name+")")
+	}
+	row(w, "Middleware:", strings.Join(chain, " -> "))
+	if match.Matched {
+		row(w, "Targets:", strings.Join(match.Targets, ", "))
+		row(w, "Timeout:", match.Timeout)
+	}
+	if match.Error != "" {
+		row(w, "Error:", match.Error)
+	}
+	return w.Flush()
+}
+
+// listUpstreams prints the upstream services and their targets
+func (c *client) listUpstreams() error {
+	var upstreams []admin.UpstreamInfo
+	body, err := c.do(http.MethodGet, "/upstreams", nil, &upstreams)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := newTable("UPSTREAM", "LOAD BALANCER", "TARGET", "WEIGHT", "SET", "STATUS", "STATE", "IN ROTATION")
+	for _, upstream := range upstreams {
+		for _, target := range upstream.Targets {
+			set := target.Set
+			if set != "" && set == upstream.BlueGreen.Active {
+				set += " (active)"
+			}
+			row(w, upstream.Name, upstream.LoadBalancer, target.URL, target.Weight, set, target.Status, target.State, target.InRotation)
+		}
+	}
+	return w.Flush()
+}
+
+// setTargetState drains, disables or undrains the targets matching the
+// target argument
+func (c *client) setTargetState(action string, args []string) error {
+	fs := flag.NewFlagSet("upstream "+action, flag.ExitOnError)
+	var upstream = fs.String("upstream", "", "Only change targets of this upstream service")
+	var reason = fs.String("reason", "", "Why the target state changes")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: sentinelctl upstream %s [-upstream name] [-reason text] <target>", action)
+	}
+
+	req := admin.TargetStateRequest{Target: fs.Arg(0), Upstream: *upstream, Reason: *reason}
+	var targets []admin.TargetInfo
+	body, err := c.do(http.MethodPost, "/targets/"+action, req, &targets)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := newTable("UPSTREAM", "TARGET", "STATUS", "STATE")
+	for _, t := range targets {
+		row(w, t.Upstream, t.URL, t.Status, t.State)
+	}
+	return w.Flush()
+}
+
+// switchUpstream flips the active blue/green target set of an upstream
+func (c *client) switchUpstream(args []string) error {
+	fs := flag.NewFlagSet("upstream switch", flag.ExitOnError)
+	var to = fs.String("to", "", "Target set to make active (blue, green); flips when empty")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: sentinelctl upstream switch [-to blue|green] <upstream>")
+	}
+
+	var status proxy.SwitchStatus
+	body, err := c.do(http.MethodPost, "/upstreams/"+url.PathEscape(fs.Arg(0))+"/switch", admin.SwitchRequest{To: *to}, &status)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	fmt.Printf("Upstream %s switched from %s to %s\n", status.Upstream, status.Previous, status.Active)
+	if status.Watching {
+		fmt.Println("The switch is rolled back automatically if the error rate spikes")
+	}
+	return nil
+}
+
+// listDrained prints the targets taken out of rotation
+func (c *client) listDrained() error {
+	var overrides []proxy.TargetOverride
+	body, err := c.do(http.MethodGet, "/targets", nil, &overrides)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := newTable("UPSTREAM", "TARGET", "STATE", "SINCE", "IN FLIGHT", "REASON")
+	for _, o := range overrides {
+		var state, inFlight any = o.State, ""
+		if o.State == proxy.TargetDraining {
+			inFlight = o.InFlight
+			if o.Drained {
+				state = "drained"
+			}
+		}
+		row(w, o.Upstream, o.URL, state, o.Since.Format(time.RFC3339), inFlight, o.Reason)
+	}
+	return w.Flush()
+}
+
+// reload reloads the proxy configuration
+func (c *client) reload() error {
+	var snapshot config.Snapshot
+	body, err := c.do(http.MethodPost, "/config/reload", nil, &snapshot)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	fmt.Printf("Configuration reloaded (version %d, hash %s)\n", snapshot.Version, snapshot.Hash)
+	return nil
+}
+
+// validate validates the pending proxy configuration
+func (c *client) validate() error {
+	var report admin.ValidationReport
+	body, err := c.do(http.MethodPost, "/config/validate", nil, &report)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	for _, warning := range report.Warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	if !report.Changed {
+		fmt.Printf("Configuration is valid and unchanged (hash %s)\n", report.Hash)
+		return nil
+	}
+	fmt.Printf("Configuration is valid and differs from the active one (hash %s)\n", report.Hash)
+	for _, change := range report.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+	return nil
+}
+
+// listCertificates prints the TLS certificates returned by the admin API,
+// listing or reloading them
+func (c *client) listCertificates(method, path string) error {
+	var certificates []tls.CertificateInfo
+	body, err := c.do(method, path, nil, &certificates)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	w := newTable("HOSTS", "SUBJECT", "ISSUER", "NOT AFTER", "EXPIRES IN")
+	for _, cert := range certificates {
+		expiresIn := time.Until(cert.NotAfter).Truncate(time.Hour)
+		row(w, strings.Join(cert.Hosts, ","), cert.Subject, cert.Issuer, cert.NotAfter.Format(time.RFC3339), expiresIn)
+	}
+	return w.Flush()
+}
+
+// health prints target health and fails when any target is unhealthy
+func (c *client) health() error {
+	var report admin.HealthReport
+	body, err := c.do(http.MethodGet, "/health", nil, &report)
+	if err != nil {
+		return err
+	}
+
+	if c.output == "json" {
+		if err := c.printJSON(body, nil); err != nil {
+			return err
+		}
+	} else {
+		w := newTable("UPSTREAM", "TARGET", "STATUS", "STATE", "LAST CHECK", "RESPONSE TIME", "ERROR")
+		for _, t := range report.Targets {
+			row(w, t.Upstream, t.URL, t.Status, t.State, t.LastCheck, t.ResponseTime, t.Error)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("\nStatus: %s\n", report.Status)
+	}
+
+	if report.Status != "healthy" {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// version prints the client and proxy build information
+func (c *client) version() error {
+	var server version.Info
+	body, err := c.do(http.MethodGet, "/version", nil, &server)
+	if err != nil || c.output == "json" {
+		return c.printJSON(body, err)
+	}
+
+	fmt.Printf("Client: %s\n", version.Get())
+	fmt.Printf("Proxy:  %s\n", server)
+	return nil
+}
+
+// do sends a request to the admin API, decodes the JSON response into out
+// and returns the raw response body
+func (c *client) do(method, path string, in, out any) ([]byte, error) {
+	var reqBody io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.addr+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("admin API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin API response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return nil, fmt.Errorf("invalid admin API response: %w", err)
+	}
+	return body, nil
+}
+
+// printJSON prints a response body indented, passing through err
+func (c *client) printJSON(body []byte, err error) error {
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return err
+	}
+	out.WriteTo(os.Stdout)
+	return nil
+}
+
+// newTable starts a table with the given column headers
+func newTable(headers ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	return w
+}
+
+// row writes a table row, showing empty cells as "-"
+func row(w io.Writer, cells ...any) {
+	values := make([]string, len(cells))
+	for i, cell := range cells {
+		values[i] = fmt.Sprint(cell)
+		if values[i] == "" {
+			values[i] = "-"
+		}
+	}
+	fmt.Fprintln(w, strings.Join(values, "\t"))
+}
+
+// headerFlags collects repeated -header flags
+type headerFlags map[string]string
+
+// String returns the headers for display
+func (h headerFlags) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+// Set adds a "Name: value" header
+func (h *headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("header must be \"Name: value\"")
+	}
+	if *h == nil {
+		*h = make(headerFlags)
+	}
+	(*h)[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
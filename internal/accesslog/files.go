@@ -0,0 +1,133 @@
+package accesslog
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// closeDelay is how long a file no longer configured stays open, so requests
+// still being served by a replaced configuration can log to it
+const closeDelay = 30 * time.Second
+
+// Files keeps access log files open across configuration reloads. A file
+// whose path and rotation settings are unchanged keeps its handle and its
+// rotation schedule.
+type Files struct {
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	files map[fileKey]*file
+}
+
+// fileKey identifies a file by its path and rotation settings
+type fileKey struct {
+	path     string
+	rotation config.LogRotationConfig
+}
+
+// file is an open access log file, rotated by size and optionally by time
+type file struct {
+	writer *lumberjack.Logger
+	stop   chan struct{}
+}
+
+// NewFiles creates an empty set of access log files
+func NewFiles(logger *zap.Logger) *Files {
+	return &Files{
+		logger: logger,
+		files:  make(map[fileKey]*file),
+	}
+}
+
+// open returns the writer of the file at path, opening it unless it is
+// already open with the same rotation settings. Files are created on the
+// first write.
+func (f *Files) open(path string, rotation config.LogRotationConfig) io.Writer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := fileKey{path: path, rotation: rotation}
+	if existing, ok := f.files[key]; ok {
+		return existing.writer
+	}
+
+	opened := &file{
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    rotation.MaxSize,
+			MaxBackups: rotation.MaxBackups,
+			Compress:   rotation.Compress,
+		},
+		stop: make(chan struct{}),
+	}
+	if rotation.Interval > 0 {
+		go f.rotateEvery(key, opened)
+	}
+	f.files[key] = opened
+	return opened.writer
+}
+
+// Retain closes the files the active logger, nil if access logs are off,
+// does not write to. They are closed once requests still logging to them
+// had time to finish.
+func (f *Files) Retain(active *Logger) {
+	keep := make(map[fileKey]bool)
+	if active != nil {
+		for _, path := range active.paths {
+			keep[fileKey{path: path, rotation: active.rotation}] = true
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, open := range f.files {
+		if !keep[key] {
+			delete(f.files, key)
+			f.closeLater(open)
+		}
+	}
+}
+
+// Close closes every file
+func (f *Files) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, open := range f.files {
+		delete(f.files, key)
+		open.close()
+	}
+}
+
+// closeLater stops rotating a file and closes it after closeDelay. Callers
+// hold mu.
+func (f *Files) closeLater(open *file) {
+	close(open.stop)
+	time.AfterFunc(closeDelay, func() { open.writer.Close() })
+}
+
+// close stops rotating a file and closes it
+func (open *file) close() {
+	close(open.stop)
+	open.writer.Close()
+}
+
+// rotateEvery rotates a file at its rotation interval until it is closed
+func (f *Files) rotateEvery(key fileKey, open *file) {
+	ticker := time.NewTicker(key.rotation.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := open.writer.Rotate(); err != nil {
+				f.logger.Error("Failed to rotate access log", zap.String("path", key.path), zap.Error(err))
+			}
+		case <-open.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// Entry describes a handled request
+type Entry struct {
+	Time        time.Time // when the request arrived
+	Listener    string    // http, https or unix_socket
+	RemoteAddr  string
+	ClientIP    string
+	Method      string
+	Host        string
+	URI         string // request URI as sent by the client
+	Proto       string
+	Status      int
+	Size        int64 // response body bytes
+	RequestSize int64 // request body bytes, -1 if unknown
+	Duration    time.Duration
+	Referer     string
+	UserAgent   string
+	Route       string // host and path of the matching rule
+	Upstream    string
+	Header      http.Header // request headers
+}
+
+// Formatter renders entries as log lines
+type Formatter interface {
+	// Format appends the line of an entry, without a newline
+	Format(buf *bytes.Buffer, e *Entry)
+}
+
+// NewFormatter creates the formatter of an access log format
+func NewFormatter(format, template string) (Formatter, error) {
+	switch format {
+	case config.AccessLogCombined:
+		return combinedFormatter{}, nil
+	case config.AccessLogJSON:
+		return jsonFormatter{}, nil
+	case config.AccessLogTemplate:
+		return parseTemplate(template)
+	default:
+		return nil, fmt.Errorf("unknown access log format: %s", format)
+	}
+}
+
+// combinedFormatter writes the combined log format of Apache and NGINX
+type combinedFormatter struct{}
+
+// Format writes an entry in the combined log format
+func (combinedFormatter) Format(buf *bytes.Buffer, e *Entry) {
+	buf.WriteString(dash(e.ClientIP))
+	buf.WriteString(" - - [")
+	buf.WriteString(e.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	buf.WriteString(`] "`)
+	buf.WriteString(e.Method + " " + e.URI + " " + e.Proto)
+	buf.WriteString(`" `)
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+	if e.Size > 0 {
+		buf.WriteString(strconv.FormatInt(e.Size, 10))
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteString(` "`)
+	buf.WriteString(escape(dash(e.Referer)))
+	buf.WriteString(`" "`)
+	buf.WriteString(escape(dash(e.UserAgent)))
+	buf.WriteByte('"')
+}
+
+// jsonFormatter writes an entry as a JSON object
+type jsonFormatter struct{}
+
+// jsonEntry is the JSON representation of an entry
+type jsonEntry struct {
+	Time        string  `json:"time"`
+	Listener    string  `json:"listener"`
+	RemoteAddr  string  `json:"remote_addr"`
+	ClientIP    string  `json:"client_ip"`
+	Method      string  `json:"method"`
+	Host        string  `json:"host"`
+	URI         string  `json:"uri"`
+	Proto       string  `json:"proto"`
+	Status      int     `json:"status"`
+	Size        int64   `json:"size"`
+	RequestSize int64   `json:"request_size"`
+	DurationMs  float64 `json:"duration_ms"`
+	Referer     string  `json:"referer,omitempty"`
+	UserAgent   string  `json:"user_agent,omitempty"`
+	Route       string  `json:"route,omitempty"`
+	Upstream    string  `json:"upstream,omitempty"`
+}
+
+// Format writes an entry as a JSON object
+func (jsonFormatter) Format(buf *bytes.Buffer, e *Entry) {
+	data, _ := json.Marshal(jsonEntry{
+		Time:        e.Time.Format(time.RFC3339Nano),
+		Listener:    e.Listener,
+		RemoteAddr:  e.RemoteAddr,
+		ClientIP:    e.ClientIP,
+		Method:      e.Method,
+		Host:        e.Host,
+		URI:         e.URI,
+		Proto:       e.Proto,
+		Status:      e.Status,
+		Size:        e.Size,
+		RequestSize: e.RequestSize,
+		DurationMs:  durationMs(e.Duration),
+		Referer:     e.Referer,
+		UserAgent:   e.UserAgent,
+		Route:       e.Route,
+		Upstream:    e.Upstream,
+	})
+	buf.Write(data)
+}
+
+// templateFields render the {field} placeholders of templates
+var templateFields = map[string]func(e *Entry) string{
+	"time":         func(e *Entry) string { return e.Time.Format(time.RFC3339) },
+	"listener":     func(e *Entry) string { return e.Listener },
+	"remote_addr":  func(e *Entry) string { return e.RemoteAddr },
+	"client_ip":    func(e *Entry) string { return e.ClientIP },
+	"method":       func(e *Entry) string { return e.Method },
+	"host":         func(e *Entry) string { return e.Host },
+	"uri":          func(e *Entry) string { return e.URI },
+	"proto":        func(e *Entry) string { return e.Proto },
+	"status":       func(e *Entry) string { return strconv.Itoa(e.Status) },
+	"size":         func(e *Entry) string { return strconv.FormatInt(e.Size, 10) },
+	"request_size": func(e *Entry) string { return strconv.FormatInt(e.RequestSize, 10) },
+	"duration_ms":  func(e *Entry) string { return strconv.FormatFloat(durationMs(e.Duration), 'f', -1, 64) },
+	"referer":      func(e *Entry) string { return e.Referer },
+	"user_agent":   func(e *Entry) string { return e.UserAgent },
+	"route":        func(e *Entry) string { return e.Route },
+	"upstream":     func(e *Entry) string { return e.Upstream },
+}
+
+// templateFormatter writes entries following a template
+type templateFormatter struct {
+	parts []func(buf *bytes.Buffer, e *Entry)
+}
+
+// parseTemplate parses a template of literal text and {field} placeholders.
+// {header.Name} is a request header.
+func parseTemplate(template string) (*templateFormatter, error) {
+	t := &templateFormatter{}
+	for rest := template; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			t.literal(rest)
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in access log template: %q", rest[start:])
+		}
+		t.literal(rest[:start])
+
+		name := rest[start+1 : start+end]
+		if header, ok := strings.CutPrefix(name, "header."); ok && header != "" {
+			t.parts = append(t.parts, func(buf *bytes.Buffer, e *Entry) {
+				buf.WriteString(escape(dash(e.Header.Get(header))))
+			})
+		} else if field, ok := templateFields[name]; ok {
+			t.parts = append(t.parts, func(buf *bytes.Buffer, e *Entry) {
+				buf.WriteString(escape(dash(field(e))))
+			})
+		} else {
+			return nil, fmt.Errorf("unknown access log template field: {%s}", name)
+		}
+		rest = rest[start+end+1:]
+	}
+	return t, nil
+}
+
+// literal adds literal text
+func (t *templateFormatter) literal(text string) {
+	if text != "" {
+		t.parts = append(t.parts, func(buf *bytes.Buffer, _ *Entry) { buf.WriteString(text) })
+	}
+}
+
+// Format writes an entry following the template
+func (t *templateFormatter) Format(buf *bytes.Buffer, e *Entry) {
+	for _, part := range t.parts {
+		part(buf, e)
+	}
+}
+
+// dash shows empty values as "-"
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// escape quotes and control characters, so client-supplied values cannot
+// break or forge lines
+func escape(value string) string {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < 0x20 || c == 0x7f || c == '"' || c == '\\' {
+			quoted := strconv.Quote(value)
+			return quoted[1 : len(quoted)-1]
+		}
+	}
+	return value
+}
+
+// durationMs converts a duration to milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,63 @@
+package accesslog
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// Logger writes one line per request to the access log file of the
+// listener the request arrived on
+type Logger struct {
+	formatter Formatter
+	writers   map[string]io.Writer // by listener
+	fallback  io.Writer            // nil when listeners without a file are not logged
+	paths     []string
+	rotation  config.LogRotationConfig
+	buffers   sync.Pool
+}
+
+// New creates the access logger of cfg, writing to files from files
+func New(cfg config.AccessLogConfig, files *Files) (*Logger, error) {
+	formatter, err := NewFormatter(cfg.Format, cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		formatter: formatter,
+		writers:   make(map[string]io.Writer),
+		rotation:  cfg.Rotation,
+		buffers:   sync.Pool{New: func() any { return new(bytes.Buffer) }},
+	}
+	if cfg.Path != "" {
+		l.fallback = files.open(cfg.Path, cfg.Rotation)
+		l.paths = append(l.paths, cfg.Path)
+	}
+	for listener, path := range cfg.Listeners {
+		l.writers[listener] = files.open(path, cfg.Rotation)
+		l.paths = append(l.paths, path)
+	}
+	return l, nil
+}
+
+// Log writes the line of an entry. Errors writing the file are not
+// reported, so a full disk does not fail requests.
+func (l *Logger) Log(e *Entry) {
+	writer, ok := l.writers[e.Listener]
+	if !ok {
+		writer = l.fallback
+	}
+	if writer == nil {
+		return
+	}
+
+	buf := l.buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	l.formatter.Format(buf, e)
+	buf.WriteByte('\n')
+	writer.Write(buf.Bytes())
+	l.buffers.Put(buf)
+}
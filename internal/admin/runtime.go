@@ -0,0 +1,525 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/health"
+	"github.com/bpradana/sentinel/internal/proxy"
+	"github.com/bpradana/sentinel/internal/quota"
+	"github.com/bpradana/sentinel/internal/slo"
+	"github.com/bpradana/sentinel/internal/tls"
+	"go.uber.org/zap"
+)
+
+// RouteInfo describes a routing rule
+type RouteInfo struct {
+	Index      int      `json:"index"`
+	Host       string   `json:"host,omitempty"`
+	Path       string   `json:"path"`
+	Methods    []string `json:"methods,omitempty"`
+	Priority   int      `json:"priority,omitempty"`
+	Conditions []string `json:"conditions,omitempty"` // header and query conditions
+	Upstream   string   `json:"upstream"`
+	Middleware []string `json:"middleware,omitempty"`
+	Timeout    string   `json:"timeout,omitempty"`
+}
+
+// UpstreamInfo describes an upstream service and its targets
+type UpstreamInfo struct {
+	Name         string              `json:"name"`
+	LoadBalancer string              `json:"load_balancer"`
+	BlueGreen    *proxy.SwitchStatus `json:"blue_green,omitempty"`
+	Targets      []TargetInfo        `json:"targets"`
+}
+
+// TargetInfo describes the state of an upstream target
+type TargetInfo struct {
+	Upstream     string `json:"upstream"`
+	URL          string `json:"url"`
+	Weight       int    `json:"weight"`
+	Status       string `json:"status"`
+	State        string `json:"state"`
+	Set          string `json:"set,omitempty"` // blue/green target set
+	InRotation   bool   `json:"in_rotation"`
+	LastCheck    string `json:"last_check,omitempty"`
+	ResponseTime string `json:"response_time,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// HealthReport summarizes the health of all upstream targets. The status is
+// degraded when any target in rotation is unhealthy.
+type HealthReport struct {
+	Status  string       `json:"status"` // "healthy" or "degraded"
+	Targets []TargetInfo `json:"targets"`
+}
+
+// QuotaInfo reports the usage of the API keys configured in a quota
+// middleware
+type QuotaInfo struct {
+	Middleware string         `json:"middleware"`
+	Keys       []*quota.Usage `json:"keys"`
+}
+
+// MatchRequest describes a hypothetical request to route
+type MatchRequest struct {
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// SwitchRequest selects the blue/green target set to make active; an empty
+// set flips to the inactive one
+type SwitchRequest struct {
+	To string `json:"to,omitempty"`
+}
+
+// TargetStateRequest selects targets by URL or host name, optionally within
+// one upstream service, and records why their state changes
+type TargetStateRequest struct {
+	Target   string `json:"target"`
+	Upstream string `json:"upstream,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ValidationReport describes a configuration that was validated but not
+// applied
+type ValidationReport struct {
+	Hash     string   `json:"hash"`
+	Changed  bool     `json:"changed"`           // whether it differs from the active configuration
+	Changes  []string `json:"changes,omitempty"` // summary of the differences
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// reload reloads the configuration from its source
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("Reloading configuration via admin API")
+
+	if err := s.opts.Reload(); err != nil {
+		s.logger.Error("Configuration reload failed", zap.Error(err))
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.opts.History.Current())
+}
+
+// validate validates the configuration in its source without applying it,
+// and reports how it differs from the active one
+func (s *Server) validate(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.opts.Validate()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	active := s.opts.History.Current()
+	report := ValidationReport{
+		Hash:    config.Hash(cfg),
+		Changes: config.Diff(active.Config, cfg),
+	}
+	report.Changed = !config.Unchanged(cfg, active.Config)
+	for _, warning := range config.Lint(cfg) {
+		report.Warnings = append(report.Warnings, warning.String())
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// listRoutes returns the active routing rules in evaluation order
+func (s *Server) listRoutes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Routes(s.currentConfig()))
+}
+
+// Routes describes the routing rules of a configuration in evaluation order
+func Routes(cfg *config.Config) []RouteInfo {
+	routes := make([]RouteInfo, 0, len(cfg.Routes.Rules))
+	for i, rule := range cfg.Routes.Rules {
+		info := RouteInfo{
+			Index:    i,
+			Host:     rule.Host,
+			Path:     rule.Path,
+			Methods:  rule.Methods,
+			Priority: rule.Priority,
+			Upstream: rule.Upstream,
+		}
+		for _, condition := range rule.HeadersMatch {
+			info.Conditions = append(info.Conditions, "header "+condition.String())
+		}
+		for _, condition := range rule.QueryMatch {
+			info.Conditions = append(info.Conditions, "query "+condition.String())
+		}
+		for _, ref := range rule.Middleware {
+			info.Middleware = append(info.Middleware, ref.Name)
+		}
+		if rule.Timeout > 0 {
+			info.Timeout = rule.Timeout.String()
+		}
+		routes = append(routes, info)
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].Priority > routes[j].Priority })
+	return routes
+}
+
+// matchRoute reports which route a hypothetical request would match, the
+// rewrites and middleware that would apply and the upstream it would go to
+func (s *Server) matchRoute(w http.ResponseWriter, r *http.Request) {
+	var req MatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+
+	target, err := url.ParseRequestURI(req.Path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid path: %v", err))
+		return
+	}
+
+	probe, err := http.NewRequestWithContext(r.Context(), strings.ToUpper(req.Method), target.RequestURI(), nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	probe.Host = req.Host
+	for name, value := range req.Headers {
+		probe.Header.Set(name, value)
+	}
+
+	writeJSON(w, http.StatusOK, s.opts.ExplainRoute(probe))
+}
+
+// listUpstreams returns the upstream services with the state of their targets
+func (s *Server) listUpstreams(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+
+	upstreams := make([]UpstreamInfo, 0, len(cfg.Upstreams.Services))
+	for _, name := range sortedServices(cfg) {
+		service := cfg.Upstreams.Services[name]
+		upstreams = append(upstreams, UpstreamInfo{
+			Name:         name,
+			LoadBalancer: service.LoadBalancer,
+			BlueGreen:    s.opts.BlueGreenStatus(name),
+			Targets:      s.serviceTargets(name, &service),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, upstreams)
+}
+
+// health reports the health of every upstream target
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+
+	report := HealthReport{Status: "healthy", Targets: []TargetInfo{}}
+	for _, name := range sortedServices(cfg) {
+		service := cfg.Upstreams.Services[name]
+		for _, info := range s.serviceTargets(name, &service) {
+			// Targets out of rotation do not degrade service
+			if info.Status == health.StatusUnhealthy.String() && info.InRotation {
+				report.Status = "degraded"
+			}
+			report.Targets = append(report.Targets, info)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// listTargetOverrides returns the targets taken out of rotation
+func (s *Server) listTargetOverrides(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.opts.TargetOverrides())
+}
+
+// drainTarget stops sending new requests to the matching targets
+func (s *Server) drainTarget(w http.ResponseWriter, r *http.Request) {
+	s.setTargetState(w, r, proxy.TargetDraining)
+}
+
+// disableTarget takes the matching targets out of rotation
+func (s *Server) disableTarget(w http.ResponseWriter, r *http.Request) {
+	s.setTargetState(w, r, proxy.TargetDisabled)
+}
+
+// undrainTarget puts the matching targets back into rotation
+func (s *Server) undrainTarget(w http.ResponseWriter, r *http.Request) {
+	s.setTargetState(w, r, proxy.TargetActive)
+}
+
+// setTargetState changes the state of the targets matching the request
+func (s *Server) setTargetState(w http.ResponseWriter, r *http.Request, state proxy.TargetState) {
+	var req TargetStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Target == "" {
+		writeError(w, http.StatusBadRequest, "request body must be {\"target\": \"<url or host>\"}")
+		return
+	}
+
+	cfg := s.currentConfig()
+	if req.Upstream != "" {
+		if _, exists := cfg.Upstreams.Services[req.Upstream]; !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("upstream %s not found", req.Upstream))
+			return
+		}
+	}
+
+	var matched []TargetInfo
+	for _, name := range sortedServices(cfg) {
+		if req.Upstream != "" && name != req.Upstream {
+			continue
+		}
+		service := cfg.Upstreams.Services[name]
+		for _, target := range service.AllTargets() {
+			if targetMatches(target.URL, req.Target) {
+				s.opts.SetTargetState(name, target.URL, state, req.Reason)
+			}
+		}
+		for _, info := range s.serviceTargets(name, &service) {
+			if targetMatches(info.URL, req.Target) {
+				matched = append(matched, info)
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("target %s not found", req.Target))
+		return
+	}
+
+	s.logger.Info("Changed target state via admin API",
+		zap.String("target", req.Target),
+		zap.String("upstream", req.Upstream),
+		zap.String("state", string(state)),
+		zap.Int("targets", len(matched)))
+
+	writeJSON(w, http.StatusOK, matched)
+}
+
+// switchUpstream flips the active blue/green target set of an upstream
+func (s *Server) switchUpstream(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, exists := s.currentConfig().Upstreams.Services[name]; !exists {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("upstream %s not found", name))
+		return
+	}
+
+	var req SwitchRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+
+	status, err := s.opts.SwitchUpstream(name, req.To)
+	if err != nil {
+		s.logger.Error("Blue/green switch failed", zap.String("upstream", name), zap.Error(err))
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	s.logger.Info("Switched blue/green target set via admin API",
+		zap.String("upstream", name),
+		zap.String("active", status.Active))
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// serviceTargets returns the current state of every target of a service,
+// including both blue/green target sets
+func (s *Server) serviceTargets(name string, service *config.UpstreamService) []TargetInfo {
+	targets := make([]TargetInfo, 0, len(service.AllTargets()))
+	bg := service.BlueGreen
+	if bg == nil {
+		for _, target := range service.AllTargets() {
+			targets = append(targets, s.targetInfo(name, target, ""))
+		}
+		return targets
+	}
+
+	active := bg.Active
+	if status := s.opts.BlueGreenStatus(name); status != nil {
+		active = status.Active
+	}
+	for _, set := range []string{config.ColorBlue, config.ColorGreen} {
+		for _, target := range bg.ColorTargets(set) {
+			info := s.targetInfo(name, target, set)
+			info.InRotation = info.InRotation && set == active
+			targets = append(targets, info)
+		}
+	}
+	return targets
+}
+
+// targetInfo returns the current state of a target
+func (s *Server) targetInfo(upstream string, target config.Target, set string) TargetInfo {
+	state := s.opts.GetTargetState(upstream, target.URL)
+	info := TargetInfo{
+		Upstream:   upstream,
+		URL:        target.URL,
+		Weight:     target.Weight,
+		Status:     health.StatusUnknown.String(),
+		State:      string(state),
+		Set:        set,
+		InRotation: state == proxy.TargetActive,
+	}
+
+	if th := s.opts.Health.GetHealth(target.URL); th != nil {
+		info.Status = th.Status.String()
+		if !th.LastCheck.IsZero() {
+			info.LastCheck = th.LastCheck.Format(time.RFC3339)
+		}
+		if th.ResponseTime > 0 {
+			info.ResponseTime = th.ResponseTime.String()
+		}
+		if th.Error != nil {
+			info.Error = th.Error.Error()
+		}
+	}
+
+	return info
+}
+
+// currentConfig returns the active configuration
+func (s *Server) currentConfig() *config.Config {
+	return s.opts.History.Current().Config
+}
+
+// targetMatches reports whether a target URL is selected by its full URL or
+// its host name, with or without port
+func targetMatches(targetURL, selector string) bool {
+	if targetURL == selector {
+		return true
+	}
+
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return false
+	}
+	return u.Host == selector || u.Hostname() == selector
+}
+
+// sortedServices returns the upstream service names in a stable order
+func sortedServices(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Upstreams.Services))
+	for name := range cfg.Upstreams.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listQuotas returns the usage of the API keys of every quota middleware
+func (s *Server) listQuotas(w http.ResponseWriter, r *http.Request) {
+	reports := []QuotaInfo{}
+	for _, mw := range s.currentConfig().Middleware.Chain {
+		if mw.Type != "quota" {
+			continue
+		}
+		report, err := quotaUsage(r, mw)
+		if err != nil {
+			s.logger.Error("Failed to read quota usage", zap.String("middleware", mw.Name), zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		reports = append(reports, *report)
+	}
+
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// listSLOs returns the compliance, error budget and burn rates of every
+// route objective
+func (s *Server) listSLOs(w http.ResponseWriter, r *http.Request) {
+	reports := s.opts.SLOs()
+	if reports == nil {
+		reports = []slo.Report{}
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// listCertificates returns the loaded manual TLS certificates
+func (s *Server) listCertificates(w http.ResponseWriter, r *http.Request) {
+	certificates := s.opts.Certificates()
+	if certificates == nil {
+		certificates = []tls.CertificateInfo{}
+	}
+	writeJSON(w, http.StatusOK, certificates)
+}
+
+// reloadCertificates reloads the manual TLS certificates from disk, e.g.
+// after they were renewed, and returns the certificates now in use
+func (s *Server) reloadCertificates(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("Reloading TLS certificates via admin API")
+
+	if err := s.opts.ReloadCertificates(); err != nil {
+		s.logger.Error("TLS certificate reload failed", zap.Error(err))
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s.listCertificates(w, r)
+}
+
+// getQuota returns the usage of the API keys of a quota middleware
+func (s *Server) getQuota(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, mw := range s.currentConfig().Middleware.Chain {
+		if mw.Type != "quota" || mw.Name != name {
+			continue
+		}
+		report, err := quotaUsage(r, mw)
+		if err != nil {
+			s.logger.Error("Failed to read quota usage", zap.String("middleware", mw.Name), zap.Error(err))
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("quota middleware %s not found", name))
+}
+
+// quotaUsage reads the usage of the configured API keys of a quota
+// middleware from its store
+func quotaUsage(r *http.Request, mw config.MiddlewareChain) (*QuotaInfo, error) {
+	typed, err := config.DecodeMiddlewareConfig(mw.Type, mw.Config)
+	if err != nil {
+		return nil, err
+	}
+	tracker, err := quota.NewTracker(*typed.(*config.QuotaMiddlewareConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer tracker.Close()
+
+	plans := tracker.Plans()
+	report := &QuotaInfo{Middleware: mw.Name, Keys: make([]*quota.Usage, 0, len(plans))}
+	now := time.Now()
+	for _, plan := range plans {
+		usage, err := tracker.Usage(r.Context(), plan.Key, plan, now)
+		if err != nil {
+			return nil, err
+		}
+		report.Keys = append(report.Keys, usage)
+	}
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].Plan != report.Keys[j].Plan {
+			return report.Keys[i].Plan < report.Keys[j].Plan
+		}
+		return report.Keys[i].Key < report.Keys[j].Key
+	})
+	return report, nil
+}
@@ -0,0 +1,312 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/handover"
+	"github.com/bpradana/sentinel/internal/health"
+	"github.com/bpradana/sentinel/internal/proxy"
+	"github.com/bpradana/sentinel/internal/slo"
+	"github.com/bpradana/sentinel/internal/tls"
+	"github.com/bpradana/sentinel/internal/version"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Options holds the components the admin API operates on
+type Options struct {
+	// History holds the recently applied configurations
+	History *config.History
+	// ApplyConfig validates and applies a configuration at runtime
+	ApplyConfig func(cfg *config.Config, reason string) error
+	// Reload loads the configuration from its source and applies it
+	Reload func() error
+	// Validate loads and validates the configuration from its source without
+	// applying it
+	Validate func() (*config.Config, error)
+	// Health reports the health of upstream targets
+	Health health.Checker
+	// SetTargetState takes a target out of rotation or puts it back
+	SetTargetState func(upstream, targetURL string, state proxy.TargetState, reason string)
+	// GetTargetState returns the state assigned to a target
+	GetTargetState func(upstream, targetURL string) proxy.TargetState
+	// TargetOverrides returns the targets taken out of rotation
+	TargetOverrides func() []proxy.TargetOverride
+	// SwitchUpstream makes a blue/green target set of an upstream active
+	SwitchUpstream func(upstream, color string) (*proxy.SwitchStatus, error)
+	// BlueGreenStatus returns the blue/green state of an upstream
+	BlueGreenStatus func(upstream string) *proxy.SwitchStatus
+	// ExplainRoute reports how a request would be routed
+	ExplainRoute func(r *http.Request) *proxy.RouteMatch
+	// SLOs reports the compliance of the service level objectives of routes
+	SLOs func() []slo.Report
+	// ReloadCertificates reloads the manual TLS certificates from disk
+	ReloadCertificates func() error
+	// Certificates describes the loaded manual TLS certificates
+	Certificates func() []tls.CertificateInfo
+}
+
+// Server serves the runtime admin API
+type Server struct {
+	cfg     atomic.Pointer[config.AdminConfig]
+	opts    Options
+	logger  *zap.Logger
+	handler http.Handler
+	server  *http.Server
+	mu      sync.Mutex
+}
+
+// NewServer creates a new admin API server
+func NewServer(cfg *config.AdminConfig, opts Options, logger *zap.Logger) *Server {
+	s := &Server{
+		opts:   opts,
+		logger: logger,
+	}
+	s.cfg.Store(cfg)
+	s.handler = s.authenticate(s.routes())
+	return s
+}
+
+// Start binds the admin API port, or takes over the socket of the process
+// this one upgrades, and serves the API in the background
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := s.cfg.Load()
+	if !cfg.Enabled {
+		s.logger.Info("Admin API disabled")
+		return nil
+	}
+
+	server, err := s.listen(cfg)
+	if err != nil {
+		return err
+	}
+	s.server = server
+	return nil
+}
+
+// Update applies new admin API settings. A new token applies to the next
+// request; a new address is bound before the old one is released, so an
+// address that cannot be bound leaves the API where it was. The replaced
+// server finishes its requests, such as the one applying the change.
+func (s *Server) Update(cfg *config.AdminConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.cfg.Load()
+	moved := cfg.BindAddress != previous.BindAddress || cfg.Port != previous.Port
+	if cfg.Enabled && (s.server == nil || moved) {
+		server, err := s.listen(cfg)
+		if err != nil {
+			return err
+		}
+		s.retire(s.server)
+		s.server = server
+	} else if !cfg.Enabled && s.server != nil {
+		s.logger.Info("Stopping admin API server")
+		s.retire(s.server)
+		s.server = nil
+	}
+	s.cfg.Store(cfg)
+	return nil
+}
+
+// retire shuts a replaced server down in the background once its requests
+// complete
+func (s *Server) retire(server *http.Server) {
+	if server == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+		}
+	}()
+}
+
+// routes returns the admin API endpoints
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /version", s.version)
+	mux.HandleFunc("GET /config/versions", s.listVersions)
+	mux.HandleFunc("GET /config/versions/{version}", s.getVersion)
+	mux.HandleFunc("POST /config/versions/{version}/rollback", s.rollback)
+	mux.HandleFunc("POST /config/reload", s.reload)
+	mux.HandleFunc("POST /config/validate", s.validate)
+	mux.HandleFunc("GET /routes", s.listRoutes)
+	mux.HandleFunc("POST /routes/match", s.matchRoute)
+	mux.HandleFunc("GET /upstreams", s.listUpstreams)
+	mux.HandleFunc("POST /upstreams/{name}/switch", s.switchUpstream)
+	mux.HandleFunc("GET /targets", s.listTargetOverrides)
+	mux.HandleFunc("POST /targets/drain", s.drainTarget)
+	mux.HandleFunc("POST /targets/disable", s.disableTarget)
+	mux.HandleFunc("POST /targets/undrain", s.undrainTarget)
+	mux.HandleFunc("GET /quotas", s.listQuotas)
+	mux.HandleFunc("GET /quotas/{name}", s.getQuota)
+	mux.HandleFunc("GET /slos", s.listSLOs)
+	mux.HandleFunc("GET /tls/certificates", s.listCertificates)
+	mux.HandleFunc("POST /tls/reload", s.reloadCertificates)
+	mux.HandleFunc("GET /health", s.health)
+	return mux
+}
+
+// listen binds the address of cfg and serves the API on it in the
+// background
+func (s *Server) listen(cfg *config.AdminConfig) (*http.Server, error) {
+	server := &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.BindAddress, cfg.Port),
+		Handler:      s.handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  30 * time.Second,
+	}
+
+	ln, err := handover.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind admin API address %s: %w", server.Addr, err)
+	}
+
+	s.logger.Info("Starting admin API server",
+		zap.String("address", cfg.BindAddress),
+		zap.Int("port", cfg.Port))
+
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Admin API server error", zap.Error(err))
+		}
+	}()
+	return server, nil
+}
+
+// Stop stops the admin API server
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+
+	s.logger.Info("Stopping admin API server")
+	return s.server.Close()
+}
+
+// authenticate requires a bearer token when one is configured
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected := s.cfg.Load().Token; expected != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+				s.logger.Warn("Unauthorized admin API request",
+					zap.String("remote_addr", r.RemoteAddr),
+					zap.String("path", r.URL.Path))
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// version returns the build information of the running proxy
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+// listVersions returns the retained configuration snapshots
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request) {
+	snapshots := s.opts.History.List()
+	current := s.opts.History.Current()
+
+	response := map[string]any{
+		"versions": snapshots,
+	}
+	if current != nil {
+		response["current"] = current.Version
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getVersion returns a single configuration snapshot as YAML
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := s.lookupSnapshot(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := yaml.Marshal(snapshot.Config)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("X-Config-Version", strconv.Itoa(snapshot.Version))
+	w.Header().Set("X-Config-Hash", snapshot.Hash)
+	w.Write(data)
+}
+
+// rollback re-applies a previous configuration snapshot
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request) {
+	snapshot, ok := s.lookupSnapshot(w, r)
+	if !ok {
+		return
+	}
+
+	s.logger.Info("Rolling back configuration via admin API",
+		zap.Int("version", snapshot.Version),
+		zap.String("hash", snapshot.Hash))
+
+	reason := fmt.Sprintf("rollback to version %d", snapshot.Version)
+	if err := s.opts.ApplyConfig(snapshot.Config, reason); err != nil {
+		s.logger.Error("Configuration rollback failed", zap.Error(err))
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.opts.History.Current())
+}
+
+// lookupSnapshot resolves the {version} path parameter
+func (s *Server) lookupSnapshot(w http.ResponseWriter, r *http.Request) (*config.Snapshot, bool) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid version")
+		return nil, false
+	}
+
+	snapshot, exists := s.opts.History.Get(version)
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("version %d not found", version))
+		return nil, false
+	}
+
+	return snapshot, true
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
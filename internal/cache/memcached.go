@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// maxMemcachedTTL is the longest relative expiration Memcached accepts;
+// larger values are read as Unix timestamps
+const maxMemcachedTTL = 30 * 24 * time.Hour
+
+// MemcachedStore stores entries in Memcached, shared by every replica using
+// it. Entries larger than the server's item size limit (1MB by default) are
+// not stored.
+type MemcachedStore struct {
+	client *memcache.Client
+	prefix string
+}
+
+// NewMemcachedStore creates a Memcached store. Connections are opened on
+// first use.
+func NewMemcachedStore(cfg config.MemcachedConfig, prefix string, timeout time.Duration) *MemcachedStore {
+	client := memcache.New(cfg.Servers...)
+	client.Timeout = timeout
+	client.MaxIdleConns = 64
+	return &MemcachedStore{client: client, prefix: prefix}
+}
+
+// Get returns the entry stored under key
+func (s *MemcachedStore) Get(_ context.Context, key string) (*Entry, bool, error) {
+	item, err := s.client.Get(s.key(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	entry, err := decodeEntry(item.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// Set stores an entry that Memcached expires after ttl, rounded up to whole
+// seconds
+func (s *MemcachedStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	ttl = min(ttl, maxMemcachedTTL)
+	expiration := int32((ttl + time.Second - 1) / time.Second)
+	return s.client.Set(&memcache.Item{Key: s.key(key), Value: data, Expiration: expiration})
+}
+
+// Delete removes an entry
+func (s *MemcachedStore) Delete(_ context.Context, key string) error {
+	err := s.client.Delete(s.key(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+// Shared reports true
+func (s *MemcachedStore) Shared() bool {
+	return true
+}
+
+// key hashes a cache key, since Memcached keys are limited to 250 bytes
+// without spaces or control characters
+func (s *MemcachedStore) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return s.prefix + hex.EncodeToString(sum[:])
+}
+
+// Close closes the connections of the store
+func (s *MemcachedStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory LRU store bounded by entry count and size
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxSize    int64
+	size       int64
+	order      *list.List // most recently used first
+	items      map[string]*list.Element
+}
+
+type memoryItem struct {
+	key     string
+	entry   *Entry
+	size    int64
+	expires time.Time
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore(maxEntries int, maxSize int64) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		maxSize:    maxSize,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns an entry and marks it as recently used
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := element.Value.(*memoryItem)
+	if time.Now().After(item.expires) {
+		s.remove(element)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return item.entry, true, nil
+}
+
+// Set stores an entry, evicting the least recently used ones to make room
+func (s *MemoryStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	size := int64(len(key)) + entry.Size()
+	if size > s.maxSize {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+	s.items[key] = s.order.PushFront(&memoryItem{key: key, entry: entry, size: size, expires: time.Now().Add(ttl)})
+	s.size += size
+
+	for s.order.Len() > s.maxEntries || s.size > s.maxSize {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Delete removes an entry
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		s.remove(element)
+	}
+	return nil
+}
+
+// Shared reports false, each instance has its own memory store
+func (s *MemoryStore) Shared() bool {
+	return false
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	item := s.order.Remove(element).(*memoryItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+}
+
+// Close does nothing, as entries are garbage collected with the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore stores entries in Redis, shared by every replica using it
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis store. Connections are opened on first use.
+func NewRedisStore(cfg config.RedisConfig, prefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: shared.NewRedisClient(cfg, timeout), prefix: prefix}
+}
+
+// Get returns the entry stored under key
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, bool, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	entry, err := decodeEntry(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// Set stores an entry that Redis expires after ttl
+func (s *RedisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := encodeEntry(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
+
+// Delete removes an entry
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// Shared reports true
+func (s *RedisStore) Shared() bool {
+	return true
+}
+
+// Close closes the connections of the store
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
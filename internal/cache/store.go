@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+)
+
+// Entry is a cached response, or the list of Vary headers of a resource whose
+// variants are stored under separate keys
+type Entry struct {
+	Status     int
+	Header     http.Header
+	Body       []byte
+	Stored     time.Time
+	InitialAge time.Duration // age of the response when it was stored
+	Expires    time.Time
+	Vary       []string
+
+	// How long after expiring the response may still be served (RFC 5861)
+	StaleWhileRevalidate time.Duration // while it is refreshed in the background
+	StaleIfError         time.Duration // when the upstream fails
+}
+
+// Age returns the current age of the response
+func (e *Entry) Age(now time.Time) time.Duration {
+	return e.InitialAge + now.Sub(e.Stored)
+}
+
+// Size approximates the memory used by the entry
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Body))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, name := range e.Vary {
+		size += int64(len(name))
+	}
+	return size
+}
+
+// Store stores cache entries by key
+type Store interface {
+	// Get returns the entry stored under key; found is false if there is none
+	Get(ctx context.Context, key string) (entry *Entry, found bool, err error)
+	// Set stores an entry for at most ttl
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	// Delete removes an entry
+	Delete(ctx context.Context, key string) error
+	// Shared reports whether the store is shared between replicas
+	Shared() bool
+	// Close releases the connections of the store
+	Close() error
+}
+
+// NewStore creates the store selected by the cache configuration and the
+// function releasing it. Shared stores with the same connection settings
+// reuse one client, so configuration reloads keep their connections.
+func NewStore(cfg config.CacheMiddlewareConfig) (Store, func() error, error) {
+	switch cfg.Store {
+	case "", "memory":
+		store := NewMemoryStore(cfg.MaxEntries, cfg.MaxSize)
+		return store, store.Close, nil
+	case "redis":
+		return sharedStores.Get(fmt.Sprintf("redis %v %s %v", cfg.Redis, cfg.KeyPrefix, cfg.StoreTimeout), func() (Store, error) {
+			return NewRedisStore(cfg.Redis, cfg.KeyPrefix, cfg.StoreTimeout), nil
+		})
+	case "memcached":
+		return sharedStores.Get(fmt.Sprintf("memcached %v %s %v", cfg.Memcached.Servers, cfg.KeyPrefix, cfg.StoreTimeout), func() (Store, error) {
+			return NewMemcachedStore(cfg.Memcached, cfg.KeyPrefix, cfg.StoreTimeout), nil
+		})
+	default:
+		return nil, nil, fmt.Errorf("unknown cache store: %s", cfg.Store)
+	}
+}
+
+// sharedStores are the shared stores created, by settings
+var sharedStores shared.Stores[Store]
+
+// encodeEntry serializes an entry for shared stores
+func encodeEntry(entry *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry deserializes an entry read from a shared store
+func decodeEntry(data []byte) (*Entry, error) {
+	entry := &Entry{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cache entry: %w", err)
+	}
+	return entry, nil
+}
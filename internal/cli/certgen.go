@@ -0,0 +1,890 @@
+package cli
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/version"
+)
+
+// certgenUsage is the usage of certgen, formatted with the command name
+const certgenUsage = `Usage: %[1]s [flags]
+       %[1]s inspect <cert.pem>...
+       %[1]s renew [-dir dir] [-within days] [-dry-run]
+
+Generates development certificates, self-signed or signed by a local CA.
+
+Commands:
+  inspect   Print the subject, SANs, expiry and key type of certificates
+  renew     Regenerate certificates in a directory that expire soon, reusing
+            their subject, SANs, key type and validity period
+
+Flags:
+`
+
+// Certgen generates development certificates, self-signed or signed by a
+// local CA, or inspects or renews certificates
+func Certgen(name string, args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "inspect":
+			runInspect(name, args[1:])
+			return
+		case "renew":
+			runRenew(name, args[1:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var (
+		hosts       = fs.String("hosts", "localhost,127.0.0.1", "Comma-separated list of hosts")
+		outputDir   = fs.String("output", "./certs", "Output directory for certificates")
+		days        = fs.Int("days", 365, "Certificate validity in days")
+		keyType     = fs.String("key-type", "rsa", "Key type (rsa, ecdsa, ed25519)")
+		keySize     = fs.Int("key-size", 2048, "RSA key size in bits")
+		pkcs8       = fs.Bool("pkcs8", false, "Write private keys in PKCS#8 format (always used for ed25519)")
+		uris        = fs.String("uris", "", "Comma-separated list of URI SANs, e.g. spiffe://example.org/api")
+		emails      = fs.String("emails", "", "Comma-separated list of email SANs")
+		clientAuth  = fs.Bool("client-auth", false, "Allow the certificate to be used for TLS client authentication")
+		commonName  = fs.String("cn", "Sentinel Development Certificate", "Common name for the certificate")
+		org         = fs.String("org", "Sentinel Development", "Organization name")
+		country     = fs.String("country", "US", "Country code")
+		state       = fs.String("state", "Development", "State or province")
+		city        = fs.String("city", "Development", "City")
+		useCA       = fs.Bool("ca", false, "Sign the certificate with a local CA, created if it does not exist")
+		caCertFile  = fs.String("ca-cert", "", "CA certificate file (default: <output>/ca.pem)")
+		caKeyFile   = fs.String("ca-key", "", "CA private key file (default: <output>/ca-key.pem)")
+		showVersion = fs.Bool("version", false, "Print version information and exit")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, certgenUsage, name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// Naming a CA file implies CA mode
+	if *caCertFile != "" || *caKeyFile != "" {
+		*useCA = true
+	}
+	if *caCertFile == "" {
+		*caCertFile = filepath.Join(*outputDir, "ca.pem")
+	}
+	if *caKeyFile == "" {
+		*caKeyFile = filepath.Join(*outputDir, "ca-key.pem")
+	}
+
+	if *showVersion {
+		fmt.Printf("%s %s\n", program(name), version.Get())
+		return
+	}
+
+	if *keyType != "rsa" && *keyType != "ecdsa" && *keyType != "ed25519" {
+		fmt.Printf("❌ Invalid key type: %s, must be one of: rsa, ecdsa, ed25519\n", *keyType)
+		os.Exit(1)
+	}
+
+	var uriList []*url.URL
+	for _, raw := range splitList(*uris) {
+		uri, err := url.Parse(raw)
+		if err != nil || uri.Scheme == "" {
+			fmt.Printf("❌ Invalid URI SAN: %s\n", raw)
+			os.Exit(1)
+		}
+		uriList = append(uriList, uri)
+	}
+	emailList := splitList(*emails)
+
+	if *useCA {
+		fmt.Println("🔐 Sentinel Development CA Certificate Generator")
+		fmt.Println("================================================")
+	} else {
+		fmt.Println("🔐 Sentinel Self-Signed Certificate Generator")
+		fmt.Println("=============================================")
+	}
+
+	// Parse hosts
+	hostList := splitList(*hosts)
+
+	fmt.Printf("📋 Generating certificate for hosts: %s\n", strings.Join(hostList, ", "))
+	fmt.Printf("📁 Output directory: %s\n", *outputDir)
+	fmt.Printf("⏰ Validity: %d days\n", *days)
+
+	// Create output directory
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		fmt.Printf("❌ Failed to create output directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load or create the CA that signs the certificate
+	var caCert *x509.Certificate
+	var caKey crypto.Signer
+	if *useCA {
+		var created bool
+		var err error
+		subject := pkix.Name{
+			Country:            []string{*country},
+			Organization:       []string{*org},
+			OrganizationalUnit: []string{"Development"},
+			Locality:           []string{*city},
+			Province:           []string{*state},
+			CommonName:         *org + " CA",
+		}
+		caCert, caKey, created, err = loadOrCreateCA(*caCertFile, *caKeyFile, subject, *keyType, *keySize, *pkcs8)
+		if err != nil {
+			fmt.Printf("❌ Failed to prepare CA: %v\n", err)
+			os.Exit(1)
+		}
+		if created {
+			fmt.Printf("\n🏛️  Created CA: %s\n", *caCertFile)
+		} else {
+			fmt.Printf("\n🏛️  Using CA: %s (%s)\n", *caCertFile, caCert.Subject.CommonName)
+		}
+	}
+
+	// Generate private key
+	fmt.Printf("\n🔑 Generating %s private key...\n", strings.ToUpper(*keyType))
+	privateKey, err := generateKey(*keyType, *keySize)
+	if err != nil {
+		fmt.Printf("❌ Failed to generate private key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Create certificate template
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		fmt.Printf("❌ Failed to generate serial number: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Country:            []string{*country},
+			Organization:       []string{*org},
+			OrganizationalUnit: []string{"Development"},
+			Locality:           []string{*city},
+			Province:           []string{*state},
+			CommonName:         *commonName,
+		},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(0, 0, *days),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{},
+		IPAddresses:           []net.IP{},
+		URIs:                  uriList,
+		EmailAddresses:        emailList,
+	}
+
+	// Only RSA keys are used for key encipherment
+	if *keyType == "rsa" {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if *clientAuth {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+
+	// Add hosts to certificate
+	for _, host := range hostList {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	// Self-signed unless a CA signs the certificate
+	parent, signer := &template, privateKey
+	if caCert != nil {
+		parent, signer = caCert, caKey
+		// A certificate cannot outlive its issuer
+		if template.NotAfter.After(caCert.NotAfter) {
+			template.NotAfter = caCert.NotAfter
+		}
+	}
+
+	// Create certificate
+	fmt.Println("📜 Creating certificate...")
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, parent, privateKey.Public(), signer)
+	if err != nil {
+		fmt.Printf("❌ Failed to create certificate: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Write certificate file
+	certFile := filepath.Join(*outputDir, "cert.pem")
+	certOut, err := os.Create(certFile)
+	if err != nil {
+		fmt.Printf("❌ Failed to create certificate file: %v\n", err)
+		os.Exit(1)
+	}
+	defer certOut.Close()
+
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes}); err != nil {
+		fmt.Printf("❌ Failed to write certificate: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Write private key file
+	keyFile := filepath.Join(*outputDir, "key.pem")
+	keyOut, err := os.Create(keyFile)
+	if err != nil {
+		fmt.Printf("❌ Failed to create key file: %v\n", err)
+		os.Exit(1)
+	}
+	defer keyOut.Close()
+
+	keyBlock, err := encodeKey(privateKey, *pkcs8)
+	if err != nil {
+		fmt.Printf("❌ Failed to encode private key: %v\n", err)
+		os.Exit(1)
+	}
+	if err := pem.Encode(keyOut, keyBlock); err != nil {
+		fmt.Printf("❌ Failed to write private key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Validate the certificate
+	fmt.Println("🔍 Validating generated certificate...")
+	if err := validateCertificate(certFile, keyFile, hostList, caCert); err != nil {
+		fmt.Printf("❌ Certificate validation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\n✅ Certificate generated successfully!")
+	fmt.Printf("📄 Certificate: %s\n", certFile)
+	fmt.Printf("🔑 Private Key: %s\n", keyFile)
+	fmt.Printf("⏰ Valid until: %s\n", template.NotAfter.Format("2006-01-02 15:04:05"))
+
+	if caCert != nil {
+		fmt.Printf("🏛️  Signed by: %s\n", *caCertFile)
+	}
+
+	fmt.Println("\n📝 Next steps:")
+	fmt.Println("1. Update your TLS configuration to use these certificates")
+	fmt.Println("2. Add the certificate files to your .gitignore")
+	if caCert != nil {
+		fmt.Printf("3. Trust %s once in your OS, browser or HTTP clients; every certificate it signs is then trusted\n", *caCertFile)
+		fmt.Printf("4. Keep %s private and reuse it with -ca-cert/-ca-key for other services\n", *caKeyFile)
+	} else {
+		fmt.Println("3. For production, use proper CA-signed certificates")
+	}
+
+	// Generate example TLS config
+	generateExampleConfig(*outputDir, hostList)
+}
+
+// loadOrCreateCA loads a CA certificate and key, or creates and writes a new
+// root CA if neither file exists
+func loadOrCreateCA(certFile, keyFile string, subject pkix.Name, keyType string, keySize int, pkcs8 bool) (*x509.Certificate, crypto.Signer, bool, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	switch {
+	case certErr == nil && keyErr == nil:
+		cert, key, err := loadCA(certFile, keyFile)
+		return cert, key, false, err
+	case !os.IsNotExist(certErr) || !os.IsNotExist(keyErr):
+		return nil, nil, false, fmt.Errorf("found only one of %s and %s, both are required", certFile, keyFile)
+	}
+
+	key, err := generateKey(keyType, keySize)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, false, fmt.Errorf("failed to create CA directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), 0644); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	keyBlock, err := encodeKey(key, pkcs8)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to encode CA key: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to write CA key: %w", err)
+	}
+
+	return cert, key, true, nil
+}
+
+// loadCA loads an existing CA certificate and its key
+func loadCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA key %s cannot sign certificates", keyFile)
+	}
+	return cert, key, nil
+}
+
+// generateKey generates a private key of the given type
+func generateKey(keyType string, rsaBits int) (crypto.Signer, error) {
+	switch keyType {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+// encodeKey encodes a private key as PEM, in PKCS#8 or in the traditional
+// format of its type (PKCS#1 for RSA, SEC 1 for ECDSA)
+func encodeKey(key crypto.Signer, pkcs8 bool) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if !pkcs8 {
+			return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+		}
+	case *ecdsa.PrivateKey:
+		if !pkcs8 {
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, err
+			}
+			return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+		}
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validateCertificate(certFile, keyFile string, hosts []string, ca *x509.Certificate) error {
+	// Load certificate
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	// Parse certificate
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	// Check expiration
+	if time.Now().After(x509Cert.NotAfter) {
+		return fmt.Errorf("certificate is expired")
+	}
+
+	if time.Now().Before(x509Cert.NotBefore) {
+		return fmt.Errorf("certificate is not yet valid")
+	}
+
+	// Check the chain to the CA
+	if ca != nil {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		if _, err := x509Cert.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+			return fmt.Errorf("certificate does not verify against CA: %w", err)
+		}
+	}
+
+	// Check hosts
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			found := false
+			for _, certIP := range x509Cert.IPAddresses {
+				if certIP.Equal(ip) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("IP address %s not found in certificate", host)
+			}
+		} else {
+			found := false
+			for _, dnsName := range x509Cert.DNSNames {
+				if dnsName == host {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("DNS name %s not found in certificate", host)
+			}
+		}
+	}
+
+	return nil
+}
+
+func generateExampleConfig(outputDir string, hosts []string) {
+	exampleFile := filepath.Join(outputDir, "tls-example.yaml")
+	content := fmt.Sprintf(`# Example TLS configuration for Sentinel
+enabled: true
+
+autocert:
+  enabled: false
+  email: "admin@example.com"
+  hosts:
+    - "%s"
+  cache_dir: "./certs"
+  staging: true
+
+certificates:
+  - hosts:
+%s
+    cert_file: "%s/cert.pem"
+    key_file: "%s/key.pem"
+`, strings.Join(hosts, `"`+"\n    - "+`"`),
+		func() string {
+			var result []string
+			for _, host := range hosts {
+				result = append(result, fmt.Sprintf("      - \"%s\"", host))
+			}
+			return strings.Join(result, "\n")
+		}(),
+		outputDir, outputDir)
+
+	if err := os.WriteFile(exampleFile, []byte(content), 0644); err != nil {
+		fmt.Printf("⚠️  Failed to create example config: %v\n", err)
+		return
+	}
+
+	fmt.Printf("📄 Example TLS config: %s\n", exampleFile)
+}
+
+// runInspect prints the details of the certificates in PEM files
+func runInspect(name string, args []string) {
+	fs := flag.NewFlagSet(name+" inspect", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Printf("usage: %s inspect <cert.pem>...\n", name)
+		os.Exit(2)
+	}
+
+	failed := false
+	for i, file := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		certs, err := readCertificates(file)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			failed = true
+			continue
+		}
+		for j, cert := range certs {
+			if j > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("📄 %s", file)
+			if len(certs) > 1 {
+				fmt.Printf(" (certificate %d of %d)", j+1, len(certs))
+			}
+			fmt.Println()
+			printCertificate(cert)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printCertificate prints the details of a certificate
+func printCertificate(cert *x509.Certificate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  Subject:\t%s\n", cert.Subject)
+	issuer := cert.Issuer.String()
+	if isSelfSigned(cert) {
+		issuer += " (self-signed)"
+	}
+	fmt.Fprintf(w, "  Issuer:\t%s\n", issuer)
+	fmt.Fprintf(w, "  Serial:\t%x\n", cert.SerialNumber)
+	if cert.IsCA {
+		fmt.Fprintf(w, "  CA:\tyes\n")
+	}
+
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	if len(sans) > 0 {
+		fmt.Fprintf(w, "  SANs:\t%s\n", strings.Join(sans, ", "))
+	}
+
+	fmt.Fprintf(w, "  Key:\t%s\n", describeKey(cert.PublicKey))
+	fmt.Fprintf(w, "  Signature:\t%s\n", cert.SignatureAlgorithm)
+	if usages := describeExtKeyUsage(cert.ExtKeyUsage); usages != "" {
+		fmt.Fprintf(w, "  Usage:\t%s\n", usages)
+	}
+	fmt.Fprintf(w, "  Valid from:\t%s\n", cert.NotBefore.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "  Valid until:\t%s (%s)\n", cert.NotAfter.Format("2006-01-02 15:04:05"), describeExpiry(cert.NotAfter))
+	w.Flush()
+}
+
+// runRenew regenerates certificates in a directory that expire soon
+func runRenew(name string, args []string) {
+	fs := flag.NewFlagSet(name+" renew", flag.ExitOnError)
+	var dir = fs.String("dir", "./certs", "Directory to search for certificates")
+	var within = fs.Int("within", 30, "Renew certificates expiring within this many days")
+	var dryRun = fs.Bool("dry-run", false, "Only list the certificates that would be renewed")
+	var caCertFile = fs.String("ca-cert", "", "CA certificate for CA-signed certificates (default: ca.pem next to the certificate)")
+	var caKeyFile = fs.String("ca-key", "", "CA private key for CA-signed certificates (default: ca-key.pem next to the certificate)")
+	fs.Parse(args)
+
+	deadline := time.Now().AddDate(0, 0, *within)
+	renewed, failed := 0, 0
+	err := filepath.WalkDir(*dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isCertificateFile(path) {
+			return nil
+		}
+
+		certs, err := readCertificates(path)
+		if err != nil {
+			// Not a certificate, e.g. a private key
+			return nil
+		}
+		cert := certs[0]
+		if cert.NotAfter.After(deadline) {
+			fmt.Printf("✅ %s: valid until %s\n", path, cert.NotAfter.Format("2006-01-02"))
+			return nil
+		}
+		if cert.IsCA {
+			fmt.Printf("⚠️  %s: CA certificate %s, regenerate it and re-sign its certificates manually\n", path, describeExpiry(cert.NotAfter))
+			return nil
+		}
+
+		keyFile := keyFileFor(path)
+		if keyFile == "" {
+			fmt.Printf("❌ %s: %s, but no private key was found next to it\n", path, describeExpiry(cert.NotAfter))
+			failed++
+			return nil
+		}
+		if *dryRun {
+			fmt.Printf("🔄 %s: %s, would renew\n", path, describeExpiry(cert.NotAfter))
+			return nil
+		}
+
+		caCert, caKey := *caCertFile, *caKeyFile
+		if caCert == "" {
+			caCert = filepath.Join(filepath.Dir(path), "ca.pem")
+		}
+		if caKey == "" {
+			caKey = filepath.Join(filepath.Dir(path), "ca-key.pem")
+		}
+		notAfter, err := renewCertificate(path, keyFile, caCert, caKey)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", path, err)
+			failed++
+			return nil
+		}
+		fmt.Printf("🔄 %s: renewed, valid until %s\n", path, notAfter.Format("2006-01-02"))
+		renewed++
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("❌ Failed to search %s: %v\n", *dir, err)
+		os.Exit(1)
+	}
+
+	if !*dryRun {
+		fmt.Printf("\n%d certificate(s) renewed\n", renewed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// renewCertificate replaces a certificate and its key with new ones that
+// have the same subject, SANs, key type, key format, usages and validity
+// period, signed by the same issuer
+func renewCertificate(certFile, keyFile, caCertFile, caKeyFile string) (time.Time, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	old, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read private key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("failed to decode private key %s", keyFile)
+	}
+	pkcs8 := block.Type == "PRIVATE KEY"
+
+	var keyType string
+	var keySize int
+	switch pub := old.PublicKey.(type) {
+	case *rsa.PublicKey:
+		keyType, keySize = "rsa", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		keyType = "ecdsa"
+	case ed25519.PublicKey:
+		keyType = "ed25519"
+	default:
+		return time.Time{}, fmt.Errorf("unsupported key type %T", old.PublicKey)
+	}
+
+	privateKey, err := generateKey(keyType, keySize)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               old.Subject,
+		NotBefore:             now,
+		NotAfter:              now.Add(old.NotAfter.Sub(old.NotBefore)),
+		KeyUsage:              old.KeyUsage,
+		ExtKeyUsage:           old.ExtKeyUsage,
+		BasicConstraintsValid: old.BasicConstraintsValid,
+		DNSNames:              old.DNSNames,
+		IPAddresses:           old.IPAddresses,
+		URIs:                  old.URIs,
+		EmailAddresses:        old.EmailAddresses,
+	}
+
+	// Sign with the issuer of the old certificate
+	var parent *x509.Certificate
+	var signer crypto.Signer
+	if isSelfSigned(old) {
+		parent, signer = &template, privateKey
+	} else {
+		caCert, caKey, err := loadCA(caCertFile, caKeyFile)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("certificate is CA-signed: %w", err)
+		}
+		if err := old.CheckSignatureFrom(caCert); err != nil {
+			return time.Time{}, fmt.Errorf("certificate was not issued by %s, use -ca-cert and -ca-key", caCertFile)
+		}
+		parent, signer = caCert, caKey
+		if template.NotAfter.After(caCert.NotAfter) {
+			template.NotAfter = caCert.NotAfter
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, parent, privateKey.Public(), signer)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyBlock, err := encodeKey(privateKey, pkcs8)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	// Write the key first, so a failure leaves the old pair usable
+	if err := os.WriteFile(keyFile+".new", pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(certFile+".new", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), 0644); err != nil {
+		os.Remove(keyFile + ".new")
+		return time.Time{}, fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.Rename(keyFile+".new", keyFile); err != nil {
+		return time.Time{}, fmt.Errorf("failed to replace private key: %w", err)
+	}
+	if err := os.Rename(certFile+".new", certFile); err != nil {
+		return time.Time{}, fmt.Errorf("failed to replace certificate: %w", err)
+	}
+
+	return template.NotAfter, nil
+}
+
+// readCertificates reads all certificates in a PEM file
+func readCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %w", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return certs, nil
+}
+
+// isCertificateFile reports whether a file name looks like a certificate
+func isCertificateFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".pem", ".crt", ".cert":
+		return !strings.Contains(filepath.Base(path), "key")
+	}
+	return false
+}
+
+// keyFileFor finds the private key next to a certificate: key.pem for
+// cert.pem, name-key.pem for name.pem and name.key for name.crt
+func keyFileFor(certFile string) string {
+	dir, base := filepath.Split(certFile)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+
+	candidates := []string{name + "-key.pem", name + ".key"}
+	if name == "cert" {
+		candidates = append([]string{"key.pem"}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, candidate)); err == nil {
+			return filepath.Join(dir, candidate)
+		}
+	}
+	return ""
+}
+
+// isSelfSigned reports whether a certificate is signed by its own key
+func isSelfSigned(cert *x509.Certificate) bool {
+	// CheckSignatureFrom would reject self-signed leaf certificates, which
+	// are not CAs
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// describeKey describes the type and size of a public key
+func describeKey(pub any) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// describeExtKeyUsage lists the extended key usages of a certificate
+func describeExtKeyUsage(usages []x509.ExtKeyUsage) string {
+	var names []string
+	for _, usage := range usages {
+		switch usage {
+		case x509.ExtKeyUsageServerAuth:
+			names = append(names, "server auth")
+		case x509.ExtKeyUsageClientAuth:
+			names = append(names, "client auth")
+		case x509.ExtKeyUsageCodeSigning:
+			names = append(names, "code signing")
+		case x509.ExtKeyUsageEmailProtection:
+			names = append(names, "email protection")
+		default:
+			names = append(names, fmt.Sprintf("usage %d", usage))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// describeExpiry describes how long until a certificate expires
+func describeExpiry(notAfter time.Time) string {
+	remaining := time.Until(notAfter)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %d days ago", int(-remaining.Hours()/24))
+	}
+	return fmt.Sprintf("expires in %d days", int(remaining.Hours()/24))
+}
@@ -0,0 +1,102 @@
+// Package cli implements the commands of the sentinel binary. The validator
+// and certgen binaries run the same commands under their own names.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/version"
+	"github.com/bpradana/sentinel/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// defaultConfigDir is where the proxy looks for its configuration and where
+// init writes it
+const defaultConfigDir = "./configs/default"
+
+const usage = `Usage: sentinel [command] [flags]
+
+Commands:
+  run                       Run the proxy (the default when no command is given)
+  validate [flags] [old new]
+                            Validate a configuration, or compare two with -diff
+  init [flags] [dir]        Generate a starter configuration
+  certgen [flags]           Generate development certificates
+  certgen inspect <cert.pem>...
+                            Print the details of certificates
+  certgen renew [flags]     Renew certificates that expire soon
+  routes list [flags]       List the routing rules of a configuration
+  version                   Print version information
+
+Run "sentinel <command> -h" for the flags of a command.
+`
+
+// Main runs the sentinel command named by the first argument. Arguments
+// starting with a flag run the proxy, as before there were commands.
+func Main(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		Run("sentinel", args)
+		return
+	}
+
+	switch args[0] {
+	case "run":
+		Run("sentinel run", args[1:])
+	case "validate":
+		Validate("sentinel validate", defaultConfigDir, args[1:])
+	case "init":
+		Init(args[1:])
+	case "certgen":
+		Certgen("sentinel certgen", args[1:])
+	case "routes":
+		Routes(args[1:])
+	case "version":
+		fmt.Printf("sentinel %s\n", version.Get())
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+// configFlags are the flags of commands that load a configuration
+type configFlags struct {
+	path      string
+	strict    bool
+	overrides config.OverrideFlags
+}
+
+// register adds the flags to a flag set
+func (f *configFlags) register(fs *flag.FlagSet, defaultPath, pathUsage string) {
+	fs.StringVar(&f.path, "config", defaultPath, pathUsage)
+	fs.BoolVar(&f.strict, "strict", false, "Reject unknown configuration keys")
+	fs.Var(&f.overrides, "set", "Override a configuration key, e.g. global.server.http_port=9090 (repeatable)")
+}
+
+// loadOptions returns how the configuration is loaded, logging warnings
+// to log
+func (f *configFlags) loadOptions(log *zap.Logger) config.LoadOptions {
+	return config.LoadOptions{Strict: f.strict, Overrides: f.overrides, EnvOverrides: true, Logger: log}
+}
+
+// newLogger creates the logger of a command, exiting if it cannot
+func newLogger(level string) *zap.Logger {
+	log, err := logger.NewLogger(level)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	return log
+}
+
+// program returns the binary a command runs in, e.g. sentinel for
+// "sentinel validate"
+func program(name string) string {
+	program, _, _ := strings.Cut(name, " ")
+	return program
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/tls"
+	"go.uber.org/zap"
+)
+
+// devLocalHosts are always covered by development certificates
+var devLocalHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// setupDevCA loads or creates the development CA and, with the user's
+// consent, adds it to the trust stores. Consent is given by -dev-trust or
+// asked for when running in a terminal; without it the CA is left untrusted
+// and browsers show certificate warnings.
+func setupDevCA(dir string, trust bool, log *zap.Logger) (*tls.DevCA, error) {
+	dir, err := devCADir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := tls.LoadOrCreateDevCA(dir, log)
+	if err != nil {
+		return nil, err
+	}
+	if ca.Trusted() {
+		log.Info("Development CA is trusted", zap.String("ca", ca.CertFile()))
+		return ca, nil
+	}
+
+	if !trust && isTerminal(os.Stdin) {
+		fmt.Printf("\nSentinel created a local certificate authority for development in %s.\n", dir)
+		fmt.Println("Installing it into the system and browser trust stores makes local HTTPS work without warnings.")
+		fmt.Println("Anyone with its key can issue certificates your machine trusts, so keep the directory private.")
+		answer := prompt(bufio.NewReader(os.Stdin), "Install the development CA (y/n)", "n")
+		trust = strings.HasPrefix(strings.ToLower(answer), "y")
+	}
+	if !trust {
+		log.Warn("Development CA is not trusted, browsers will show certificate warnings; run with -dev-trust to install it",
+			zap.String("ca", ca.CertFile()))
+		return ca, nil
+	}
+
+	if err := ca.Install(); err != nil {
+		log.Error("Failed to install development CA, browsers will show certificate warnings", zap.Error(err))
+		return ca, nil
+	}
+	log.Info("Installed development CA into the trust stores; restart browsers for it to take effect",
+		zap.String("ca", ca.CertFile()),
+		zap.String("name", ca.Name()))
+	return ca, nil
+}
+
+// devCADir returns the directory of the development CA, the default one
+// unless given
+func devCADir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	return tls.DefaultDevCADir()
+}
+
+// applyDevTLS replaces the TLS configuration with a certificate issued by
+// the development CA for every configured host. Client authentication and
+// protocol settings are kept, so they can be tried locally.
+func applyDevTLS(ca *tls.DevCA, cfg *config.Config) error {
+	hosts := devHosts(cfg)
+	certFile, keyFile, err := ca.Issue(hosts)
+	if err != nil {
+		return fmt.Errorf("failed to issue development certificate: %w", err)
+	}
+	cfg.TLS = config.TLSConfig{
+		Enabled: true,
+		Certificates: []config.CertificateConfig{{
+			Hosts:    hosts,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		}},
+		ClientAuth:       cfg.TLS.ClientAuth,
+		MinVersion:       cfg.TLS.MinVersion,
+		MaxVersion:       cfg.TLS.MaxVersion,
+		CipherSuites:     cfg.TLS.CipherSuites,
+		CurvePreferences: cfg.TLS.CurvePreferences,
+	}
+	return nil
+}
+
+// devHosts returns the hosts of routes and TLS settings followed by the local
+// host names, without duplicates
+func devHosts(cfg *config.Config) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	// Regex hosts cannot be certificate names
+	for _, rule := range cfg.Routes.Rules {
+		if !strings.HasPrefix(rule.Host, "~") {
+			add(rule.Host)
+		}
+	}
+	for _, certificate := range cfg.TLS.Certificates {
+		for _, host := range certificate.Hosts {
+			add(host)
+		}
+	}
+	for _, host := range cfg.TLS.AutoCert.Hosts {
+		add(host)
+	}
+	for _, host := range devLocalHosts {
+		add(host)
+	}
+	return hosts
+}
+
+// runDevUninstall removes the development CA from the trust stores
+func runDevUninstall(dir string, log *zap.Logger) {
+	dir, err := devCADir(dir)
+	if err != nil {
+		log.Fatal("Failed to locate development CA", zap.Error(err))
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		log.Info("No development CA to uninstall", zap.String("dir", dir))
+		return
+	}
+	ca, err := tls.LoadOrCreateDevCA(dir, log)
+	if err != nil {
+		log.Fatal("Failed to load development CA", zap.Error(err))
+	}
+	if err := ca.Uninstall(); err != nil {
+		log.Fatal("Failed to uninstall development CA", zap.Error(err))
+	}
+	log.Info("Removed development CA from the trust stores; delete its directory to remove it entirely",
+		zap.String("dir", dir))
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/scaffold"
+)
+
+// Init generates a starter configuration directory, prompting for the
+// values not given as flags when run in a terminal
+func Init(args []string) {
+	defaults := scaffold.DefaultOptions()
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	host := fs.String("host", defaults.Host, "Host name routed to the upstream")
+	upstream := fs.String("upstream", defaults.Upstream, "Upstream service name")
+	targets := fs.String("targets", strings.Join(defaults.Targets, ","), "Comma-separated upstream target URLs")
+	httpPort := fs.Int("http-port", defaults.HTTPPort, "HTTP port")
+	httpsPort := fs.Int("https-port", defaults.HTTPSPort, "HTTPS port")
+	tlsMode := fs.String("tls", defaults.TLS, "TLS mode (off, self-signed, autocert)")
+	email := fs.String("email", "", "Let's Encrypt account email, required for -tls autocert")
+	adminAPI := fs.Bool("admin", defaults.Admin, "Enable the admin API with a generated token")
+	force := fs.Bool("force", false, "Overwrite existing configuration files")
+	yes := fs.Bool("y", false, "Do not prompt, use flags and defaults")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sentinel init [flags] [dir]\n\nGenerates a commented starter configuration in dir (default: %s).\n\nFlags:\n", defaultConfigDir)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	dir := defaultConfigDir
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		dir = fs.Arg(0)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if !*yes && isTerminal(os.Stdin) {
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		in := bufio.NewReader(os.Stdin)
+		ask := func(name, question string, value *string) {
+			if !set[name] {
+				*value = prompt(in, question, *value)
+			}
+		}
+		askInt := func(name, question string, value *int) {
+			if set[name] {
+				return
+			}
+			for {
+				answer := prompt(in, question, strconv.Itoa(*value))
+				if n, err := strconv.Atoi(answer); err == nil {
+					*value = n
+					return
+				}
+				fmt.Println("Please enter a number")
+			}
+		}
+
+		ask("host", "Host name", host)
+		ask("upstream", "Upstream service name", upstream)
+		ask("targets", "Upstream target URLs (comma-separated)", targets)
+		askInt("http-port", "HTTP port", httpPort)
+		ask("tls", "TLS (off, self-signed, autocert)", tlsMode)
+		if *tlsMode != scaffold.TLSOff {
+			askInt("https-port", "HTTPS port", httpsPort)
+		}
+		if *tlsMode == scaffold.TLSAutoCert {
+			ask("email", "Let's Encrypt email", email)
+		}
+		if !set["admin"] {
+			answer := prompt(in, "Enable the admin API (y/n)", map[bool]string{true: "y", false: "n"}[*adminAPI])
+			*adminAPI = strings.HasPrefix(strings.ToLower(answer), "y")
+		}
+	}
+
+	opts := defaults
+	opts.Host = *host
+	opts.Upstream = *upstream
+	opts.Targets = nil
+	for _, target := range strings.Split(*targets, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			opts.Targets = append(opts.Targets, target)
+		}
+	}
+	opts.HTTPPort = *httpPort
+	opts.HTTPSPort = *httpsPort
+	opts.TLS = *tlsMode
+	opts.Email = *email
+	opts.Admin = *adminAPI
+
+	files, err := scaffold.Render(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := scaffold.Write(dir, files, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if !*force {
+			fmt.Fprintln(os.Stderr, "Use -force to overwrite the existing configuration")
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("Configuration written to %s\n", dir)
+	for _, file := range files {
+		fmt.Printf("  %s\n", file.Name)
+	}
+	fmt.Printf("\nStart the proxy with: sentinel -config %s\n", dir)
+	if opts.Admin {
+		fmt.Printf("The admin API token is in %s\n", dir+"/global.yaml")
+	}
+}
+
+// prompt asks a question and returns the answer, or def if it is empty
+func prompt(in *bufio.Reader, question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
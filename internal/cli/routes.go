@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bpradana/sentinel/internal/admin"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// Routes lists the routing rules of a configuration in evaluation order,
+// without a running proxy
+func Routes(args []string) {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "usage: sentinel routes list [-config path] [-strict] [-set key=value]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("sentinel routes list", flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs, defaultConfigDir, "Configuration directory, file or source URL")
+	fs.Parse(args[1:])
+
+	source, err := config.NewSource(flags.path, flags.loadOptions(zap.NewNop()), zap.NewNop())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := source.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tHOST\tPATH\tMETHODS\tMATCH\tPRIORITY\tUPSTREAM\tMIDDLEWARE\tTIMEOUT")
+	for _, route := range admin.Routes(cfg) {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", route.Index, route.Host, route.Path,
+			strings.Join(route.Methods, ","), strings.Join(route.Conditions, ", "), route.Priority,
+			route.Upstream, strings.Join(route.Middleware, ","), route.Timeout)
+	}
+	w.Flush()
+}
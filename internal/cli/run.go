@@ -0,0 +1,396 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/admin"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/events"
+	"github.com/bpradana/sentinel/internal/handover"
+	"github.com/bpradana/sentinel/internal/health"
+	"github.com/bpradana/sentinel/internal/metrics"
+	"github.com/bpradana/sentinel/internal/notify"
+	"github.com/bpradana/sentinel/internal/proxy"
+	"github.com/bpradana/sentinel/internal/quota"
+	"github.com/bpradana/sentinel/internal/slo"
+	"github.com/bpradana/sentinel/internal/tls"
+	"github.com/bpradana/sentinel/internal/version"
+	"github.com/bpradana/sentinel/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// upgradeTimeout bounds how long a new process may take to serve after
+// SIGUSR2 before the upgrade is abandoned
+const upgradeTimeout = time.Minute
+
+// Run runs the proxy until it is stopped by a signal
+func Run(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs, defaultConfigDir, "Configuration directory, file or source URL (consul://host:port/prefix, etcd://host:port/prefix)")
+	var logLevel = fs.String("log-level", "info", "Log level (debug, info, warn, error)")
+	var check = fs.Bool("check", false, "Load and validate the configuration, initialize TLS and load balancers, then exit")
+	var showVersion = fs.Bool("version", false, "Print version information and exit")
+	var dev = fs.Bool("dev", false, "Serve HTTPS for the configured hosts with certificates from a local development CA")
+	var devTrust = fs.Bool("dev-trust", false, "Install the development CA into the system and browser trust stores without asking")
+	var devUninstall = fs.Bool("dev-uninstall", false, "Remove the development CA from the trust stores and exit")
+	var devCADir = fs.String("dev-ca-dir", "", "Directory of the development CA (default: sentinel/dev-ca in the user configuration directory)")
+	if name == "sentinel" {
+		fs.Usage = func() {
+			fmt.Fprint(os.Stderr, usage)
+			fmt.Fprint(os.Stderr, "\nFlags of run:\n")
+			fs.PrintDefaults()
+		}
+	}
+	fs.Parse(args)
+
+	if *showVersion {
+		fmt.Printf("sentinel %s\n", version.Get())
+		return
+	}
+
+	// The -log-level flag takes precedence over the configured level
+	levelFlagSet := false
+	fs.Visit(func(f *flag.Flag) {
+		levelFlagSet = levelFlagSet || f.Name == "log-level"
+	})
+	logConfig := func(cfg *config.Config) config.LogConfig {
+		logCfg := cfg.Global.Log
+		if levelFlagSet {
+			logCfg.Level = *logLevel
+		}
+		return logCfg
+	}
+
+	// Initialize logger, rebuilt from the log configuration once loaded
+	logs, err := logger.NewReloadable(config.LogConfig{Level: *logLevel, Format: "json"})
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logs.Sync()
+	log := logs.Logger()
+
+	if *devUninstall {
+		runDevUninstall(*devCADir, log)
+		return
+	}
+
+	build := version.Get()
+	log.Info("Starting Sentinel",
+		zap.String("version", build.Version),
+		zap.String("commit", build.Commit),
+		zap.String("build_date", build.BuildDate),
+		zap.String("go_version", build.GoVersion))
+
+	// Resolve configuration source
+	source, err := config.NewSource(flags.path, flags.loadOptions(log), log)
+	if err != nil {
+		log.Fatal("Invalid configuration source", zap.Error(err))
+	}
+
+	// Load configuration
+	cfg, err := source.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
+	// Development mode replaces the TLS settings of every loaded configuration
+	var devCA *tls.DevCA
+	if *dev {
+		if devCA, err = setupDevCA(*devCADir, *devTrust, log); err != nil {
+			log.Fatal("Failed to set up development CA", zap.Error(err))
+		}
+		if err := applyDevTLS(devCA, cfg); err != nil {
+			log.Fatal("Failed to set up development TLS", zap.Error(err))
+		}
+	}
+
+	// Validate configuration
+	if err := config.ValidateConfig(cfg, log); err != nil {
+		log.Fatal("Configuration validation failed", zap.Error(err))
+	}
+
+	if err := logs.Reload(logConfig(cfg)); err != nil {
+		log.Fatal("Failed to configure logger", zap.Error(err))
+	}
+
+	log.Info("Configuration loaded successfully", zap.String("source", source.String()))
+	logLintWarnings(cfg, log)
+
+	// Initialize TLS manager
+	tlsManager, err := tls.NewManager(&cfg.TLS, log)
+	if err != nil {
+		log.Fatal("Failed to initialize TLS manager", zap.Error(err))
+	}
+
+	// Initialize health checker
+	healthChecker := health.NewChecker(cfg.Health, log)
+
+	if *check {
+		if err := proxy.NewServer(cfg, tlsManager, healthChecker, log).Check(); err != nil {
+			log.Fatal("Configuration check failed", zap.Error(err))
+		}
+		log.Info("Configuration check passed")
+		return
+	}
+
+	// Track applied configurations for rollback
+	history := config.NewHistory(cfg.Global.Admin.HistorySize)
+	history.Record(cfg, "startup")
+
+	// Report reload outcomes and SLO burn alerts to the webhooks of the
+	// configuration in effect
+	notifier := notify.NewNotifier(source.String(), log)
+	sloMonitor := slo.NewMonitor(func(alert slo.Alert) {
+		notifier.SLOAlert(history.Current().Config.Global.Notifications.SLOWebhooks, alert)
+	}, log)
+
+	// Initialize proxy server
+	proxyServer := proxy.NewServer(cfg, tlsManager, healthChecker, log)
+
+	// Initialize metrics
+	metricsServer := metrics.NewServer(&cfg.Metrics, log)
+	metricsServer.Register(sloMonitor)
+	metricsServer.RegisterCertificates(proxyServer.Certificates)
+	if err := metricsServer.Start(); err != nil {
+		log.Error("Failed to start metrics server", zap.Error(err))
+	}
+
+	// Start health monitoring
+	healthChecker.Start()
+
+	// Start proxy server
+	proxyStarted := true
+	if err := proxyServer.Start(); err != nil {
+		log.Error("Failed to start proxy server", zap.Error(err))
+		proxyStarted = false
+	}
+
+	// Evaluate the objectives of routes
+	sloMonitor.Update(cfg)
+	sloMonitor.Start()
+
+	reloadFailed := func(reason string, newCfg *config.Config, err error) {
+		metrics.ObserveConfigReload("failure")
+		active := history.Current()
+		configHash := ""
+		if newCfg != nil {
+			configHash = config.Hash(newCfg)
+		}
+		notifier.Failed(active.Config.Global.Notifications.ReloadWebhooks, reason, configHash, active.Hash, err)
+	}
+
+	// Reloads from the watcher, signals and the admin API may come at once,
+	// and are applied one at a time
+	var reloadMu sync.Mutex
+
+	// The admin API applies configurations itself
+	var adminServer *admin.Server
+	apply := func(newCfg *config.Config, reason string) error {
+		if err := config.ValidateConfig(newCfg, log); err != nil {
+			err = fmt.Errorf("configuration validation failed: %w", err)
+			reloadFailed(reason, newCfg, err)
+			return err
+		}
+		logLintWarnings(newCfg, log)
+		changes := config.Diff(history.Current().Config, newCfg)
+		if err := proxyServer.UpdateConfig(newCfg); err != nil {
+			reloadFailed(reason, newCfg, err)
+			return err
+		}
+		if err := logs.Reload(logConfig(newCfg)); err != nil {
+			log.Error("Failed to reconfigure logger", zap.Error(err))
+		}
+		if err := metricsServer.Update(&newCfg.Metrics); err != nil {
+			log.Error("Failed to reconfigure metrics server", zap.Error(err))
+		}
+		if err := adminServer.Update(&newCfg.Global.Admin); err != nil {
+			log.Error("Failed to reconfigure admin API server", zap.Error(err))
+		}
+		healthChecker.UpdateConfig(newCfg.Health)
+		sloMonitor.Update(newCfg)
+		snapshot := history.Record(newCfg, reason)
+		metrics.ObserveConfigReload("success")
+		log.Info("Configuration applied",
+			zap.Int("version", snapshot.Version),
+			zap.String("hash", snapshot.Hash),
+			zap.String("reason", reason))
+		notifier.Succeeded(newCfg.Global.Notifications.ReloadWebhooks, reason, snapshot, len(changes))
+		return nil
+	}
+	applyConfig := func(newCfg *config.Config, reason string) error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		return apply(newCfg, reason)
+	}
+
+	// loadPending loads the configuration from its source as a reload would
+	loadPending := func() (*config.Config, error) {
+		newCfg, err := source.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if devCA != nil {
+			if err := applyDevTLS(devCA, newCfg); err != nil {
+				return newCfg, err
+			}
+		}
+		return newCfg, nil
+	}
+
+	// validatePending loads and validates the configuration from its source
+	// without applying it
+	validatePending := func() (*config.Config, error) {
+		newCfg, err := loadPending()
+		if err != nil {
+			return nil, err
+		}
+		if err := config.ValidateConfig(newCfg, log); err != nil {
+			return nil, fmt.Errorf("configuration validation failed: %w", err)
+		}
+		return newCfg, nil
+	}
+
+	reloadConfig := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		newCfg, err := loadPending()
+		if err != nil {
+			reloadFailed("reload", newCfg, err)
+			return err
+		}
+		// Saves that leave the configuration as it is, such as an editor
+		// touching a file, need not rebuild anything
+		if config.Unchanged(newCfg, history.Current().Config) {
+			metrics.ObserveConfigReload("unchanged")
+			log.Info("Configuration unchanged, skipping reload")
+			return nil
+		}
+		if err := apply(newCfg, "reload"); err != nil {
+			return err
+		}
+		log.Info("Configuration reloaded successfully")
+		return nil
+	}
+
+	// Initialize admin API
+	adminServer = admin.NewServer(&cfg.Global.Admin, admin.Options{
+		History:            history,
+		ApplyConfig:        applyConfig,
+		Reload:             reloadConfig,
+		Validate:           validatePending,
+		Health:             healthChecker,
+		SetTargetState:     proxyServer.SetTargetState,
+		GetTargetState:     proxyServer.GetTargetState,
+		TargetOverrides:    proxyServer.TargetOverrides,
+		SwitchUpstream:     proxyServer.SwitchUpstream,
+		BlueGreenStatus:    proxyServer.BlueGreenStatus,
+		ExplainRoute:       proxyServer.Explain,
+		SLOs:               sloMonitor.Reports,
+		ReloadCertificates: proxyServer.ReloadCertificates,
+		Certificates:       proxyServer.Certificates,
+	}, log)
+	if err := adminServer.Start(); err != nil {
+		log.Error("Failed to start admin API server", zap.Error(err))
+	}
+
+	// Let the process this one upgrades shut down once every listener serves
+	if proxyStarted {
+		if err := handover.Ready(); err != nil {
+			log.Error("Failed to report readiness to the upgraded process", zap.Error(err))
+		}
+	}
+
+	// Setup configuration hot-reload
+	reload := func() {
+		log.Info("Configuration changed, reloading...", zap.String("source", source.String()))
+		if err := reloadConfig(); err != nil {
+			log.Error("Failed to reload configuration", zap.Error(err))
+		}
+	}
+
+	if err := source.Watch(reload); err != nil {
+		log.Error("Failed to watch configuration source", zap.Error(err))
+	} else {
+		defer source.Stop()
+	}
+
+	// Setup graceful shutdown, reloads on SIGHUP, validation of the pending
+	// configuration on SIGUSR1, and upgrades in place on SIGUSR2
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	for sig := range quit {
+		if sig == syscall.SIGHUP {
+			log.Info("Received SIGHUP, reloading configuration...", zap.String("source", source.String()))
+			if err := reloadConfig(); err != nil {
+				log.Error("Failed to reload configuration", zap.Error(err))
+			}
+			continue
+		}
+		if sig == syscall.SIGUSR1 {
+			pending, err := validatePending()
+			if err != nil {
+				log.Error("Pending configuration is invalid", zap.Error(err))
+				continue
+			}
+			logLintWarnings(pending, log)
+			log.Info("Pending configuration is valid",
+				zap.String("hash", config.Hash(pending)),
+				zap.Int("changes", len(config.Diff(history.Current().Config, pending))))
+			continue
+		}
+		if sig != syscall.SIGUSR2 {
+			break
+		}
+		log.Info("Upgrading, starting new process")
+		process, err := handover.Upgrade(upgradeTimeout)
+		if err != nil {
+			log.Error("Upgrade failed, continuing to serve", zap.Error(err))
+			continue
+		}
+		log.Info("New process ready, handing over", zap.Int("pid", process.Pid))
+		break
+	}
+	log.Info("Shutting down server...")
+
+	// Create shutdown context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Shutdown components
+	healthChecker.Stop()
+	sloMonitor.Stop()
+	metricsServer.Stop()
+	adminServer.Stop()
+
+	if err := proxyServer.Shutdown(ctx); err != nil {
+		log.Error("Server forced to shutdown", zap.Error(err))
+	}
+	if err := quota.Flush(); err != nil {
+		log.Error("Failed to save quota usage", zap.Error(err))
+	}
+	if err := events.Close(ctx); err != nil {
+		log.Error("Failed to publish buffered request events", zap.Error(err))
+	}
+
+	log.Info("Server shutdown complete")
+}
+
+// logLintWarnings logs suspicious configuration settings
+func logLintWarnings(cfg *config.Config, log *zap.Logger) {
+	for _, warning := range config.Lint(cfg) {
+		log.Warn("Configuration lint warning",
+			zap.String("file", warning.File),
+			zap.String("rule", warning.Rule),
+			zap.String("message", warning.Message))
+	}
+}
@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/probe"
+	"github.com/bpradana/sentinel/internal/version"
+	"go.uber.org/zap"
+)
+
+// Validate validates a configuration without running the proxy, or compares
+// two configurations with -diff
+func Validate(name, defaultConfig string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs, defaultConfig, "Configuration directory or file")
+	var logLevel = fs.String("log-level", "info", "Log level (debug, info, warn, error)")
+	var verbose = fs.Bool("verbose", false, "Enable verbose output")
+	var schema = fs.Bool("schema", false, "Print the JSON Schema of the full configuration and exit")
+	var schemaOut = fs.String("schema-out", "", "Write one JSON Schema file per configuration file to this directory and exit")
+	var failOnWarnings = fs.Bool("fail-on-warnings", false, "Exit with an error if lint warnings are found")
+	var probeTargets = fs.Bool("probe", false, "Check that targets resolve, accept connections and pass health checks, and that certificates load")
+	var probeTimeout = fs.Duration("probe-timeout", probe.DefaultTimeout, "Timeout for each probe")
+	var diff = fs.Bool("diff", false, "Compare two configurations given as arguments, old then new, and print the changes")
+	var showVersion = fs.Bool("version", false, "Print version information and exit")
+	fs.Parse(args)
+
+	if *showVersion {
+		fmt.Printf("%s %s\n", program(name), version.Get())
+		return
+	}
+
+	if *schema || *schemaOut != "" {
+		if err := exportSchema(*schemaOut); err != nil {
+			fmt.Printf("❌ Failed to export schema: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	log := newLogger(*logLevel)
+	defer log.Sync()
+
+	fmt.Println("🔍 Sentinel Configuration Validator")
+	fmt.Println("====================================")
+
+	opts := flags.loadOptions(log)
+	if *diff {
+		if fs.NArg() != 2 {
+			fmt.Printf("❌ -diff takes two configurations: %s -diff <old> <new>\n", name)
+			os.Exit(2)
+		}
+		if !runDiff(fs.Arg(0), fs.Arg(1), opts, log) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Check if config directory or file exists
+	if _, err := os.Stat(flags.path); os.IsNotExist(err) {
+		fmt.Printf("❌ Configuration path does not exist: %s\n", flags.path)
+		os.Exit(1)
+	}
+
+	fmt.Printf("📁 Validating configuration in: %s\n\n", flags.path)
+
+	// Load configuration
+	cfg, err := config.LoadConfigWithOptions(flags.path, opts)
+	if err != nil {
+		fmt.Printf("❌ Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("✅ Configuration files loaded successfully")
+
+	// Validate configuration
+	if !validate(cfg, log) {
+		os.Exit(1)
+	}
+
+	// Lint configuration
+	warnings := config.Lint(cfg)
+	if len(warnings) > 0 {
+		fmt.Printf("\n⚠️  %d warning(s):\n", len(warnings))
+		for _, warning := range warnings {
+			fmt.Printf("  • %s\n", warning)
+		}
+		if *failOnWarnings {
+			os.Exit(1)
+		}
+	}
+
+	// Probe the environment
+	if *probeTargets {
+		if !runProbes(cfg, *probeTimeout, log) {
+			os.Exit(1)
+		}
+	}
+
+	// Print configuration summary if verbose
+	if *verbose {
+		printConfigurationSummary(cfg)
+	}
+
+	fmt.Println("\n🎉 All validations passed! Your configuration is ready to use.")
+}
+
+// validate validates a configuration, printing its errors, and reports
+// whether it is valid
+func validate(cfg *config.Config, log *zap.Logger) bool {
+	if err := config.ValidateConfig(cfg, log); err != nil {
+		var validationErrs config.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			fmt.Printf("❌ Configuration validation failed: %v\n", err)
+			return false
+		}
+		fmt.Printf("❌ Configuration validation failed with %d error(s):\n", len(validationErrs))
+		for _, validationErr := range validationErrs {
+			fmt.Printf("  • %v\n", validationErr)
+		}
+		return false
+	}
+
+	fmt.Println("✅ Configuration validation passed")
+	return true
+}
+
+// runDiff loads two configurations, validates the new one and prints what
+// changes from the old one, as a reload would apply it. It reports whether
+// both loaded and the new one is valid.
+func runDiff(oldPath, newPath string, opts config.LoadOptions, log *zap.Logger) bool {
+	fmt.Printf("📁 Comparing %s with %s\n\n", oldPath, newPath)
+
+	oldCfg, err := config.LoadConfigWithOptions(oldPath, opts)
+	if err != nil {
+		fmt.Printf("❌ Failed to load old configuration: %v\n", err)
+		return false
+	}
+	newCfg, err := config.LoadConfigWithOptions(newPath, opts)
+	if err != nil {
+		fmt.Printf("❌ Failed to load new configuration: %v\n", err)
+		return false
+	}
+
+	fmt.Println("✅ Configuration files loaded successfully")
+	valid := validate(newCfg, log)
+
+	changes := config.Diff(oldCfg, newCfg)
+	if len(changes) == 0 {
+		if config.Unchanged(oldCfg, newCfg) {
+			fmt.Println("\n🟰 No changes")
+		} else {
+			fmt.Println("\n📝 Settings changed that are not summarized")
+		}
+		return valid
+	}
+	fmt.Printf("\n📝 %d change(s):\n", len(changes))
+	for _, change := range changes {
+		fmt.Printf("  • %s\n", change)
+	}
+	return valid
+}
+
+func printConfigurationSummary(cfg *config.Config) {
+	fmt.Println("\n📊 Configuration Summary:")
+	fmt.Println("------------------------")
+
+	// Global settings
+	fmt.Printf("🌐 Global Settings:\n")
+	fmt.Printf("  HTTP Port: %d\n", cfg.Global.Server.HTTPPort)
+	fmt.Printf("  HTTPS Port: %d\n", cfg.Global.Server.HTTPSPort)
+	fmt.Printf("  Read Timeout: %v\n", cfg.Global.Server.ReadTimeout)
+	fmt.Printf("  Write Timeout: %v\n", cfg.Global.Server.WriteTimeout)
+	fmt.Printf("  Idle Timeout: %v\n", cfg.Global.Server.IdleTimeout)
+	fmt.Printf("  HTTP/2 Enabled: %t\n", cfg.Global.Server.HTTP2Enabled)
+	fmt.Printf("  Log Level: %s\n", cfg.Global.Log.Level)
+	fmt.Printf("  Log Format: %s\n", cfg.Global.Log.Format)
+
+	// Upstreams
+	fmt.Printf("\n🔄 Upstream Services (%d):\n", len(cfg.Upstreams.Services))
+	for name, service := range cfg.Upstreams.Services {
+		fmt.Printf("  %s:\n", name)
+		fmt.Printf("    Load Balancer: %s\n", service.LoadBalancer)
+		fmt.Printf("    Targets: %d\n", len(service.Targets))
+		fmt.Printf("    Health Check: %t\n", service.HealthCheck.Enabled)
+	}
+
+	// Routes
+	fmt.Printf("\n🛣️  Routes (%d):\n", len(cfg.Routes.Rules))
+	for i, rule := range cfg.Routes.Rules {
+		fmt.Printf("  %d. %s%s -> %s\n", i+1, rule.Host, rule.Path, rule.Upstream)
+	}
+
+	// Middleware
+	fmt.Printf("\n🔧 Middleware Chains (%d):\n", len(cfg.Middleware.Chain))
+	for _, chain := range cfg.Middleware.Chain {
+		if chain.Enabled {
+			fmt.Printf("  %s (%s) - Order: %d\n", chain.Name, chain.Type, chain.Order)
+		}
+	}
+
+	// TLS
+	fmt.Printf("\n🔒 TLS Configuration:\n")
+	fmt.Printf("  Enabled: %t\n", cfg.TLS.Enabled)
+	if cfg.TLS.Enabled {
+		fmt.Printf("  Auto-cert: %t\n", cfg.TLS.AutoCert.Enabled)
+		fmt.Printf("  Manual Certificates: %d\n", len(cfg.TLS.Certificates))
+		if mode := cfg.TLS.ClientAuth.Mode; mode != "" && mode != "none" {
+			fmt.Printf("  Client Auth: %s\n", mode)
+		}
+	}
+
+	// Health
+	fmt.Printf("\n💚 Health Check:\n")
+	fmt.Printf("  Enabled: %t\n", cfg.Health.Enabled)
+	if cfg.Health.Enabled {
+		fmt.Printf("  Port: %d\n", cfg.Health.Port)
+		fmt.Printf("  Interval: %v\n", cfg.Health.Interval)
+		fmt.Printf("  Timeout: %v\n", cfg.Health.Timeout)
+	}
+
+	// Metrics
+	fmt.Printf("\n📈 Metrics:\n")
+	fmt.Printf("  Enabled: %t\n", cfg.Metrics.Enabled)
+	if cfg.Metrics.Enabled {
+		fmt.Printf("  Port: %d\n", cfg.Metrics.Port)
+		fmt.Printf("  Path: %s\n", cfg.Metrics.Path)
+	}
+}
+
+// runProbes checks connectivity to everything the configuration references
+// and reports whether all checks passed
+func runProbes(cfg *config.Config, timeout time.Duration, log *zap.Logger) bool {
+	fmt.Println("\n🔌 Probing environment:")
+
+	results := probe.NewProber(timeout, log).Run(context.Background(), cfg)
+	failed := 0
+	for _, result := range results {
+		if result.OK() {
+			fmt.Printf("  ✅ %-11s %s", result.Check, result.Subject)
+			if result.Detail != "" {
+				fmt.Printf(" (%s)", result.Detail)
+			}
+			fmt.Println()
+			continue
+		}
+		failed++
+		fmt.Printf("  ❌ %-11s %s: %v\n", result.Check, result.Subject, result.Err)
+	}
+
+	if failed > 0 {
+		fmt.Printf("❌ %d of %d probe(s) failed\n", failed, len(results))
+		return false
+	}
+
+	fmt.Printf("✅ All %d probe(s) passed\n", len(results))
+	return true
+}
+
+// exportSchema prints the full configuration schema, or writes one schema per
+// configuration file when an output directory is given
+func exportSchema(outputDir string) error {
+	if outputDir == "" {
+		data, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	for name, schema := range config.SectionSchemas() {
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		filename := filepath.Join(outputDir, name+".schema.json")
+		if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("📄 Wrote %s\n", filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// DefaultHeaders are the forwarding headers consulted when none are configured
+var DefaultHeaders = []string{"X-Forwarded-For"}
+
+// Resolver determines client IPs. Forwarding headers are only read from
+// requests whose peer is a trusted proxy, and in X-Forwarded-For and
+// Forwarded the rightmost address that is not a trusted proxy wins, since
+// entries further left may be forged by the client.
+type Resolver struct {
+	trusted   []*net.IPNet
+	trustUnix bool
+	headers   []string
+}
+
+// NewResolver creates a resolver from the client IP settings
+func NewResolver(cfg config.ClientIPConfig) (*Resolver, error) {
+	resolver := &Resolver{headers: cfg.Headers, trustUnix: cfg.TrustUnixSocket}
+	if len(resolver.headers) == 0 {
+		resolver.headers = DefaultHeaders
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		network, err := config.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", proxy, err)
+		}
+		resolver.trusted = append(resolver.trusted, network)
+	}
+	return resolver, nil
+}
+
+// Resolve returns the IP of the client that sent a request
+func (res *Resolver) Resolve(r *http.Request) string {
+	peer := peerIP(r)
+	if !res.isTrusted(net.ParseIP(peer)) && !(res.trustUnix && overUnixSocket(r)) {
+		return peer
+	}
+
+	for _, header := range res.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		switch http.CanonicalHeaderKey(header) {
+		case "X-Forwarded-For":
+			if ip, ok := res.rightmostUntrusted(splitList(values, parseForwardedFor)); ok {
+				return ip
+			}
+		case "Forwarded":
+			if ip, ok := res.rightmostUntrusted(splitList(values, parseForwarded)); ok {
+				return ip
+			}
+		default:
+			// Single address headers such as CF-Connecting-IP
+			if ip := parseIP(values[0]); ip != "" {
+				return ip
+			}
+		}
+	}
+	return peer
+}
+
+// rightmostUntrusted returns the last address of a hop list that is not a
+// trusted proxy. If every hop is trusted, the first one is the client.
+func (res *Resolver) rightmostUntrusted(hops []string) (string, bool) {
+	if len(hops) == 0 {
+		return "", false
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// A hop that is not an address, such as an obfuscated
+			// identifier, cannot be attributed
+			return "", false
+		}
+		if !res.isTrusted(ip) {
+			return hops[i], true
+		}
+	}
+	return hops[0], true
+}
+
+// isTrusted reports whether an address belongs to a trusted proxy
+func (res *Resolver) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range res.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextKey is the request context key of the resolved client IP
+type contextKey struct{}
+
+// unixSocketKey marks the context of connections accepted on a unix socket
+type unixSocketKey struct{}
+
+// MarkUnixSocket marks the context of a connection accepted on a unix
+// socket, whose peer is a local process rather than an IP address
+func MarkUnixSocket(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unixSocketKey{}, true)
+}
+
+// overUnixSocket reports whether a request arrived on a unix socket
+func overUnixSocket(r *http.Request) bool {
+	unix, _ := r.Context().Value(unixSocketKey{}).(bool)
+	return unix
+}
+
+// Attach resolves the client IP of a request and stores it in its context
+func (res *Resolver) Attach(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, res.Resolve(r)))
+}
+
+// FromRequest returns the client IP attached to a request, or the address of
+// its peer if none was attached
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// peerIP returns the address of the directly connected peer
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// splitList parses the comma separated entries of a list header's values
+func splitList(values []string, parse func(string) string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			hops = append(hops, parse(entry))
+		}
+	}
+	return hops
+}
+
+// parseForwardedFor normalizes an X-Forwarded-For entry
+func parseForwardedFor(entry string) string {
+	if ip := parseIP(entry); ip != "" {
+		return ip
+	}
+	return strings.TrimSpace(entry)
+}
+
+// parseForwarded returns the for= address of a Forwarded element (RFC 7239)
+func parseForwarded(element string) string {
+	for _, pair := range strings.Split(element, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && strings.EqualFold(name, "for") {
+			return parseForwardedFor(strings.Trim(value, `"`))
+		}
+	}
+	return ""
+}
+
+// parseIP parses an address that may carry a port or IPv6 brackets, returning
+// it in canonical form, or "" if it is not an IP address
+func parseIP(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -1,11 +1,20 @@
 package config
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bpradana/sentinel/internal/router"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,75 +27,560 @@ type Config struct {
 	TLS        TLSConfig        `yaml:"tls"`
 	Health     HealthConfig     `yaml:"health"`
 	Metrics    MetricsConfig    `yaml:"metrics"`
+
+	secrets secretReferences // references of the resolved secrets
 }
 
 // GlobalConfig holds global server settings
 type GlobalConfig struct {
-	Server ServerConfig `yaml:"server"`
-	Log    LogConfig    `yaml:"log"`
+	Server        ServerConfig        `yaml:"server"`
+	Log           LogConfig           `yaml:"log"`
+	AccessLog     AccessLogConfig     `yaml:"access_log,omitempty"`
+	Admin         AdminConfig         `yaml:"admin"`
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+	APICatalog    APICatalogConfig    `yaml:"api_catalog,omitempty"`
+	SLO           SLOSettings         `yaml:"slo,omitempty"`
+	Plugins       []string            `yaml:"plugins,omitempty"` // Go plugins (.so) loaded before validation
+}
+
+// SLOSettings defines how the objectives of routes are evaluated. An alert
+// fires when the error budget of an objective burns at least burn_rate times
+// faster than sustainable over both its long and its short window.
+type SLOSettings struct {
+	EvaluationInterval time.Duration     `yaml:"evaluation_interval,omitempty"`
+	MinRequests        int               `yaml:"min_requests,omitempty"` // requests in the long window before an alert can fire
+	BurnAlerts         []BurnAlertConfig `yaml:"burn_alerts,omitempty"`
+}
+
+// BurnAlertConfig defines an error budget burn rate alert
+type BurnAlertConfig struct {
+	Name        string        `yaml:"name"`
+	LongWindow  time.Duration `yaml:"long_window"`
+	ShortWindow time.Duration `yaml:"short_window"`
+	BurnRate    float64       `yaml:"burn_rate"`
+}
+
+// APICatalogConfig defines the API catalog: the OpenAPI documents of
+// upstreams, rewritten to the paths routed to them and merged into one
+// document served with a Swagger UI
+type APICatalogConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Path    string        `yaml:"path,omitempty"` // the UI, with the document at <path>/openapi.json
+	Host    string        `yaml:"host,omitempty"` // serve the catalog only for this host
+	Title   string        `yaml:"title,omitempty"`
+	Refresh time.Duration `yaml:"refresh,omitempty"` // how long fetched documents are reused
+	Timeout time.Duration `yaml:"timeout,omitempty"` // timeout of fetching a document
+}
+
+// NotificationsConfig defines who is told about runtime events
+type NotificationsConfig struct {
+	ReloadWebhooks []WebhookConfig `yaml:"reload_webhooks,omitempty"` // called after every configuration reload
+	SLOWebhooks    []WebhookConfig `yaml:"slo_webhooks,omitempty"`    // called when burn rate alerts fire or resolve
+}
+
+// WebhookConfig defines an HTTP endpoint notified with a JSON POST
+type WebhookConfig struct {
+	URL      string            `yaml:"url"`
+	Events   []string          `yaml:"events,omitempty"` // success/failure or firing/resolved, default both
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Secret   string            `yaml:"secret,omitempty"` // signs payloads with HMAC-SHA256
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`
+	Attempts int               `yaml:"attempts,omitempty"` // deliveries tried before giving up
 }
 
 // ServerConfig defines server-specific settings
 type ServerConfig struct {
-	HTTPPort      int           `yaml:"http_port"`
-	HTTPSPort     int           `yaml:"https_port"`
-	ReadTimeout   time.Duration `yaml:"read_timeout"`
-	WriteTimeout  time.Duration `yaml:"write_timeout"`
-	IdleTimeout   time.Duration `yaml:"idle_timeout"`
-	MaxHeaderSize int           `yaml:"max_header_size"`
-	HTTP2Enabled  bool          `yaml:"http2_enabled"`
+	HTTPPort      int            `yaml:"http_port"`
+	HTTPSPort     int            `yaml:"https_port"`
+	ReadTimeout   time.Duration  `yaml:"read_timeout"`
+	WriteTimeout  time.Duration  `yaml:"write_timeout"`
+	IdleTimeout   time.Duration  `yaml:"idle_timeout"`
+	MaxHeaderSize int            `yaml:"max_header_size"`
+	HTTP2Enabled  bool           `yaml:"http2_enabled"`
+	Deadlines     DeadlineConfig `yaml:"deadlines,omitempty"`
+	ClientIP      ClientIPConfig `yaml:"client_ip,omitempty"`
+
+	ConnectionLimits    ConnectionLimitConfig `yaml:"connection_limits,omitempty"`
+	Overload            OverloadConfig        `yaml:"overload,omitempty"`
+	UnixSocket          UnixSocketConfig      `yaml:"unix_socket,omitempty"`
+	RedirectHTTPToHTTPS RedirectConfig        `yaml:"redirect_http_to_https,omitempty"`
+}
+
+// RedirectConfig redirects requests on the HTTP port to HTTPS. ACME
+// challenges are always served over HTTP.
+type RedirectConfig struct {
+	Enabled    bool   `yaml:"enabled"`               // for all routes, unless a route sets its own redirect_http_to_https
+	StatusCode int    `yaml:"status_code,omitempty"` // 301, 302, 307 or 308
+	Host       string `yaml:"host,omitempty"`        // host, and port, to redirect to instead of the request's host
+	Port       int    `yaml:"port,omitempty"`        // port added to the request's host, default https_port; 443 is omitted
+}
+
+// UnixSocketConfig defines a unix socket the proxy serves plain HTTP on, in
+// addition to its ports, for a local process terminating the network edge
+type UnixSocketConfig struct {
+	Path string `yaml:"path,omitempty"` // empty disables the socket
+	Mode string `yaml:"mode,omitempty"` // octal file permissions, e.g. "0660"
+}
+
+// ConnectionLimitConfig caps the connections of each client IP at the
+// listeners, before any request is parsed. Connections from trusted proxies
+// are never limited.
+type ConnectionLimitConfig struct {
+	MaxPerIP  int      `yaml:"max_per_ip,omitempty"`  // concurrent connections, 0 is unlimited
+	RatePerIP float64  `yaml:"rate_per_ip,omitempty"` // new connections per second, 0 is unlimited
+	Burst     int      `yaml:"burst,omitempty"`       // connections that may be opened at once above the rate
+	Exempt    []string `yaml:"exempt,omitempty"`      // IPs or CIDRs never limited
+}
+
+// OverloadConfig sheds a growing fraction of requests while the p99 latency
+// of requests or the CPU usage of the proxy is above its target, so the
+// requests that are served stay fast
+type OverloadConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	LatencyTarget time.Duration `yaml:"latency_target,omitempty"` // p99 latency above which requests are shed, 0 ignores latency
+	CPUTarget     float64       `yaml:"cpu_target,omitempty"`     // CPU utilization, 0 to 1, above which requests are shed, 0 ignores CPU
+	Window        time.Duration `yaml:"window,omitempty"`         // period latency is measured over
+	MaxShedRatio  float64       `yaml:"max_shed_ratio,omitempty"` // largest fraction of requests shed
+	PriorityPaths []string      `yaml:"priority_paths,omitempty"` // path prefixes never shed, such as health checks
+	RetryAfter    time.Duration `yaml:"retry_after,omitempty"`    // sent to shed clients
+}
+
+// ClientIPConfig defines how the address of the client behind proxies and
+// load balancers is determined
+type ClientIPConfig struct {
+	TrustedProxies  []string `yaml:"trusted_proxies,omitempty"`   // IPs or CIDRs whose forwarding headers are believed
+	Headers         []string `yaml:"headers,omitempty"`           // forwarding headers in order of precedence
+	TrustUnixSocket bool     `yaml:"trust_unix_socket,omitempty"` // believe forwarding headers of requests over the unix socket
+}
+
+// DeadlineConfig defines how request deadlines are passed on to upstreams
+type DeadlineConfig struct {
+	Propagate      bool          `yaml:"propagate"`                 // send the remaining time as X-Request-Timeout and grpc-timeout
+	TrustedCallers []string      `yaml:"trusted_callers,omitempty"` // IPs or CIDRs whose deadline headers are honored
+	MaxTimeout     time.Duration `yaml:"max_timeout,omitempty"`     // caps deadlines of trusted callers, 0 is uncapped
 }
 
 // LogConfig defines logging settings
 type LogConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
+	Level             string   `yaml:"level"`
+	Format            string   `yaml:"format"`                       // "json" or "text"
+	OutputPaths       []string `yaml:"output_paths,omitempty"`       // files, "stdout" or "stderr"
+	ErrorOutputPaths  []string `yaml:"error_output_paths,omitempty"` // where the logger reports its own errors
+	DisableCaller     bool     `yaml:"disable_caller,omitempty"`     // omit the calling file and line
+	DisableStacktrace bool     `yaml:"disable_stacktrace,omitempty"` // omit stack traces from error logs
+}
+
+// Access log formats
+const (
+	AccessLogCombined = "combined" // Apache/NGINX combined log format
+	AccessLogJSON     = "json"
+	AccessLogTemplate = "template" // the access log's template
+)
+
+// AccessLogConfig defines access log files, which receive one line per
+// request, separate from the proxy's own log
+type AccessLogConfig struct {
+	Enabled   bool              `yaml:"enabled"`
+	Path      string            `yaml:"path,omitempty"`      // file of listeners without their own
+	Listeners map[string]string `yaml:"listeners,omitempty"` // file per listener: http, https, unix_socket
+	Format    string            `yaml:"format,omitempty"`    // combined, json or template
+	Template  string            `yaml:"template,omitempty"`  // line with {field} placeholders
+	Rotation  LogRotationConfig `yaml:"rotation,omitempty"`
+}
+
+// LogRotationConfig defines when log files are rotated and how many rotated
+// files are kept
+type LogRotationConfig struct {
+	MaxSize    int           `yaml:"max_size,omitempty"`    // megabytes before a file is rotated
+	Interval   time.Duration `yaml:"interval,omitempty"`    // rotate at least this often; 0 rotates by size only
+	MaxBackups int           `yaml:"max_backups,omitempty"` // rotated files kept; 0 keeps all
+	Compress   bool          `yaml:"compress,omitempty"`    // gzip rotated files
+}
+
+// AdminConfig defines the runtime admin API settings
+type AdminConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	BindAddress string `yaml:"bind_address"`
+	Port        int    `yaml:"port"`
+	Token       string `yaml:"token"`
+	HistorySize int    `yaml:"history_size"`
 }
 
 // UpstreamsConfig defines upstream service configurations
 type UpstreamsConfig struct {
-	Services map[string]UpstreamService `yaml:"services"`
+	Defaults  UpstreamDefaults           `yaml:"defaults,omitempty"`
+	Discovery DiscoveryConfig            `yaml:"discovery,omitempty"`
+	Services  map[string]UpstreamService `yaml:"services"`
+}
+
+// DiscoveryConfig defines how dynamic targets are resolved
+type DiscoveryConfig struct {
+	Kubernetes KubernetesDiscoveryConfig         `yaml:"kubernetes,omitempty"`
+	DNS        DNSDiscoveryConfig                `yaml:"dns,omitempty"`
+	Providers  map[string]map[string]interface{} `yaml:"providers,omitempty"` // options of registered providers, by URL scheme
+}
+
+// KubernetesDiscoveryConfig defines the API server used to resolve k8s://
+// targets. Without an API server the in-cluster service account is used.
+type KubernetesDiscoveryConfig struct {
+	APIServer string `yaml:"api_server,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty"`
+	CAFile    string `yaml:"ca_file,omitempty"`
+}
+
+// UpstreamDefaults defines settings inherited by every upstream service that
+// does not set them itself
+type UpstreamDefaults struct {
+	LoadBalancer string            `yaml:"load_balancer,omitempty"`
+	HealthCheck  HealthCheckConfig `yaml:"health_check,omitempty"`
 }
 
 // UpstreamService defines a single upstream service
 type UpstreamService struct {
-	LoadBalancer string            `yaml:"load_balancer"`
-	HealthCheck  HealthCheckConfig `yaml:"health_check"`
-	Targets      []Target          `yaml:"targets"`
+	LoadBalancer string             `yaml:"load_balancer"`
+	HealthCheck  HealthCheckConfig  `yaml:"health_check"`
+	Targets      []Target           `yaml:"targets,omitempty"`
+	TargetsFile  string             `yaml:"targets_file,omitempty"` // file listing further targets, watched on its own
+	BlueGreen    *BlueGreenConfig   `yaml:"blue_green,omitempty"`
+	Prewarm      *PrewarmConfig     `yaml:"prewarm,omitempty"`
+	Sticky       *StickyConfig      `yaml:"sticky,omitempty"`
+	OpenAPI      string             `yaml:"openapi,omitempty"` // path of the OpenAPI document served by the targets
+	RetryBudget  *RetryBudgetConfig `yaml:"retry_budget,omitempty"`
+	Transport    *TransportConfig   `yaml:"transport,omitempty"`
+	TLS          *UpstreamTLSConfig `yaml:"tls,omitempty"`
+
+	OutlierDetection *OutlierDetectionConfig `yaml:"outlier_detection,omitempty"`
+	SlowStart        *SlowStartConfig        `yaml:"slow_start,omitempty"`
+	DrainTimeout     time.Duration           `yaml:"drain_timeout,omitempty"` // how long requests to a draining target may run, 30s if unset
+}
+
+// SlowStartConfig ramps up the share of requests of targets added to an
+// upstream in rotation, or recovering from failed health checks, so cold
+// caches and runtimes are not sent full load at once
+type SlowStartConfig struct {
+	Window     time.Duration `yaml:"window,omitempty"`      // time over which a target reaches its full share
+	MinPercent int           `yaml:"min_percent,omitempty"` // share of its full load a target starts with
+}
+
+// OutlierDetectionConfig ejects targets that keep failing the requests
+// proxied to them, judged from the traffic itself rather than active health
+// checks. Ejected targets are readmitted gradually once their ejection ends.
+type OutlierDetectionConfig struct {
+	Consecutive5xx             int           `yaml:"consecutive_5xx,omitempty"`              // 5xx responses in a row that eject a target
+	ConsecutiveConnectFailures int           `yaml:"consecutive_connect_failures,omitempty"` // failed connections in a row that eject a target
+	BaseEjectionTime           time.Duration `yaml:"base_ejection_time,omitempty"`           // multiplied by the times a target was ejected without recovering
+	MaxEjectionTime            time.Duration `yaml:"max_ejection_time,omitempty"`
+	MaxEjectionPercent         int           `yaml:"max_ejection_percent,omitempty"` // share of the targets that may be ejected at once
+	RecoveryWindow             time.Duration `yaml:"recovery_window,omitempty"`      // time over which a readmitted target returns to its full share
+}
+
+// UpstreamTLSConfig defines how the proxy connects to https:// and TLS gRPC
+// targets. Without it, targets are verified against the system roots.
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`              // CA bundle verifying the targets instead of the system roots
+	CertFile           string `yaml:"cert_file,omitempty"`            // client certificate presented to the targets
+	KeyFile            string `yaml:"key_file,omitempty"`             // key of the client certificate
+	ServerName         string `yaml:"server_name,omitempty"`          // SNI and verified name instead of the target host
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // accept any certificate, for development only
+}
+
+// TransportConfig sizes the connection pool to the targets of an upstream
+// and bounds the steps of connecting to them and awaiting their responses.
+// Zero limits on connections mean no limit.
+type TransportConfig struct {
+	MaxIdleConns          int           `yaml:"max_idle_conns,omitempty"`          // idle connections kept across all targets
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host,omitempty"` // idle connections kept per target
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host,omitempty"`      // connections per target, requests over it wait
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout,omitempty"`
+	DialTimeout           time.Duration `yaml:"dial_timeout,omitempty"`
+	KeepAlive             time.Duration `yaml:"keep_alive,omitempty"`          // TCP keep-alive probe interval, and HTTP/2 ping interval of idle gRPC connections
+	DisableKeepAlives     bool          `yaml:"disable_keep_alives,omitempty"` // use every connection for a single request
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty"` // wait for the response headers once the request is sent, 0 for the route timeout only
+	ExpectContinueTimeout time.Duration `yaml:"expect_continue_timeout,omitempty"` // wait for 100 Continue before sending the body anyway
+}
+
+// DefaultTransport is the connection pool of upstreams without transport
+// settings, and fills in the unset ones of the others
+var DefaultTransport = TransportConfig{
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   32,
+	IdleConnTimeout:       90 * time.Second,
+	DialTimeout:           30 * time.Second,
+	KeepAlive:             30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// TransportSettings returns the connection pool settings of an upstream
+func (s UpstreamService) TransportSettings() TransportConfig {
+	if s.Transport == nil {
+		return DefaultTransport
+	}
+	return *s.Transport
+}
+
+// RetryBudgetConfig caps the retries sent to an upstream to a share of its
+// requests over a sliding window, so retries cannot pile onto a degraded
+// backend. Retries over the budget are skipped, whatever the retry policy.
+type RetryBudgetConfig struct {
+	Percent    float64       `yaml:"percent"`               // retries allowed per 100 requests
+	Window     time.Duration `yaml:"window,omitempty"`      // sliding window the shares are measured over
+	MinRetries int           `yaml:"min_retries,omitempty"` // retries allowed in the window regardless of traffic
 }
 
+// StickyConfig pins the clients of an upstream to a target through a
+// session cookie. The session table is kept in memory, or in Redis to be
+// shared by replicas.
+type StickyConfig struct {
+	Cookie       string        `yaml:"cookie"`
+	TTL          time.Duration `yaml:"ttl"`   // how long an idle session stays pinned
+	Store        string        `yaml:"store"` // memory or redis
+	KeyPrefix    string        `yaml:"key_prefix,omitempty"`
+	StoreTimeout time.Duration `yaml:"store_timeout,omitempty"`
+	Redis        RedisConfig   `yaml:"redis,omitempty"`
+}
+
+// PrewarmConfig defines connections opened to the targets of an upstream at
+// startup and after reloads, before they take traffic
+type PrewarmConfig struct {
+	Connections int           `yaml:"connections"`        // idle connections opened to each target
+	Requests    int           `yaml:"requests,omitempty"` // warm-up requests sent to each target, at least connections
+	Method      string        `yaml:"method,omitempty"`
+	Path        string        `yaml:"path,omitempty"`
+	Timeout     time.Duration `yaml:"timeout,omitempty"` // bound on prewarming the upstream
+}
+
+// Blue/green target set names
+const (
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+)
+
+// BlueGreenConfig defines two target sets of which only the active one
+// receives traffic. The active set can be switched at runtime.
+type BlueGreenConfig struct {
+	Active   string         `yaml:"active"` // "blue" or "green"
+	Blue     []Target       `yaml:"blue"`
+	Green    []Target       `yaml:"green"`
+	Rollback RollbackConfig `yaml:"rollback,omitempty"`
+}
+
+// RollbackConfig defines when a blue/green switch is rolled back
+// automatically
+type RollbackConfig struct {
+	ErrorRate   float64       `yaml:"error_rate,omitempty"`   // fraction of 5xx responses, 0 disables rollback
+	Window      time.Duration `yaml:"window,omitempty"`       // how long after a switch errors are watched
+	MinRequests int           `yaml:"min_requests,omitempty"` // requests needed before the error rate counts
+}
+
+// ColorTargets returns the targets of a blue/green target set
+func (bg *BlueGreenConfig) ColorTargets(color string) []Target {
+	if color == ColorGreen {
+		return bg.Green
+	}
+	return bg.Blue
+}
+
+// ActiveTargets returns the targets that receive traffic when active is the
+// active blue/green target set; services without blue/green use their targets
+func (s *UpstreamService) ActiveTargets(active string) []Target {
+	if s.BlueGreen == nil {
+		return s.targets()
+	}
+	return s.BlueGreen.ColorTargets(active)
+}
+
+// AllTargets returns every target of the service, including inactive
+// blue/green targets
+func (s *UpstreamService) AllTargets() []Target {
+	if s.BlueGreen == nil {
+		return s.targets()
+	}
+	all := make([]Target, 0, len(s.Targets)+len(s.BlueGreen.Blue)+len(s.BlueGreen.Green))
+	all = append(all, s.Targets...)
+	all = append(all, s.BlueGreen.Blue...)
+	return append(all, s.BlueGreen.Green...)
+}
+
+// targets returns the targets of a service without blue/green, with the
+// targets file as a file:// target
+func (s *UpstreamService) targets() []Target {
+	if s.TargetsFile == "" {
+		return s.Targets
+	}
+	targets := make([]Target, 0, len(s.Targets)+1)
+	targets = append(targets, s.Targets...)
+	return append(targets, Target{URL: FileTargetURL(s.TargetsFile)})
+}
+
+// Target protocols
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
 // Target defines an upstream target
 type Target struct {
-	URL    string `yaml:"url"`
-	Weight int    `yaml:"weight,omitempty"`
+	URL      string `yaml:"url"`
+	Weight   int    `yaml:"weight,omitempty"`
+	Protocol string `yaml:"protocol,omitempty"` // http (default) or grpc, which is proxied over HTTP/2 end to end
+}
+
+// DNSDiscoveryConfig defines how dns:// and srv:// targets are resolved.
+// Records are resolved again when their TTL expires, within the bounds of
+// MinInterval and Interval.
+type DNSDiscoveryConfig struct {
+	Interval    time.Duration `yaml:"interval,omitempty"`     // longest time between lookups
+	MinInterval time.Duration `yaml:"min_interval,omitempty"` // shortest time between lookups, for records with short TTLs
+	Resolver    string        `yaml:"resolver,omitempty"`     // DNS server host:port, the servers in /etc/resolv.conf if empty
 }
 
 // HealthCheckConfig defines health check settings
 type HealthCheckConfig struct {
-	Enabled          bool          `yaml:"enabled"`
-	Path             string        `yaml:"path"`
-	Interval         time.Duration `yaml:"interval"`
-	Timeout          time.Duration `yaml:"timeout"`
-	FailureThreshold int           `yaml:"failure_threshold"`
-	SuccessThreshold int           `yaml:"success_threshold"`
+	Enabled          bool              `yaml:"enabled"`
+	Type             string            `yaml:"type,omitempty"` // http (default), https or tcp
+	Path             string            `yaml:"path"`
+	Interval         time.Duration     `yaml:"interval"`
+	Timeout          time.Duration     `yaml:"timeout"`
+	FailureThreshold int               `yaml:"failure_threshold"`
+	SuccessThreshold int               `yaml:"success_threshold"`
+	ExpectedStatuses []int             `yaml:"expected_statuses,omitempty"` // any 2xx status if empty
+	ExpectedBody     string            `yaml:"expected_body,omitempty"`     // substring the response body must contain
+	Headers          map[string]string `yaml:"headers,omitempty"`           // sent with every check, Host included
 }
 
+// Health check types. https checks reach http:// targets over TLS.
+const (
+	HealthCheckHTTP  = "http"
+	HealthCheckHTTPS = "https"
+	HealthCheckTCP   = "tcp"
+)
+
 // RoutesConfig defines routing rules
 type RoutesConfig struct {
-	Rules []RouteRule `yaml:"rules"`
+	Defaults RouteDefaults `yaml:"defaults,omitempty"`
+	Rules    []RouteRule   `yaml:"rules"`
+}
+
+// RouteDefaults defines settings inherited by every route rule that does not
+// set them itself
+type RouteDefaults struct {
+	Middleware  []RouteMiddleware `yaml:"middleware,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Timeout     time.Duration     `yaml:"timeout,omitempty"`
+	RetryPolicy RetryPolicy       `yaml:"retry_policy,omitempty"`
+
+	MaxResponseSize int64 `yaml:"max_response_size,omitempty"`
 }
 
 // RouteRule defines a single routing rule
 type RouteRule struct {
-	Host        string            `yaml:"host"`
-	Path        string            `yaml:"path"`
+	Host        string            `yaml:"host"` // exact host, *.example.com for its subdomains, or a ~regex
+	Path        string            `yaml:"path"` // exact, /prefix/*, with :params, or a ~regex
 	Methods     []string          `yaml:"methods,omitempty"`
+	Priority    int               `yaml:"priority,omitempty"` // higher priorities match first, then rules in order
 	Upstream    string            `yaml:"upstream"`
 	Rewrite     RewriteConfig     `yaml:"rewrite,omitempty"`
-	Middleware  []string          `yaml:"middleware,omitempty"`
+	Middleware  []RouteMiddleware `yaml:"middleware,omitempty"`
 	Headers     map[string]string `yaml:"headers,omitempty"`
 	Timeout     time.Duration     `yaml:"timeout,omitempty"`
 	RetryPolicy RetryPolicy       `yaml:"retry_policy,omitempty"`
+
+	// Conditions on request headers and query parameters, all of which
+	// must hold for the route to match
+	HeadersMatch []MatchCondition `yaml:"headers_match,omitempty"`
+	QueryMatch   []MatchCondition `yaml:"query_match,omitempty"`
+
+	// Upstream responses larger than this many bytes are aborted; 0 is
+	// unlimited
+	MaxResponseSize int64 `yaml:"max_response_size,omitempty"`
+
+	Mirror           *MirrorConfig           `yaml:"mirror,omitempty"`
+	RequestBuffering *RequestBufferingConfig `yaml:"request_buffering,omitempty"`
+	SLO              *SLOConfig              `yaml:"slo,omitempty"`
+	Observability    *ObservabilityConfig    `yaml:"observability,omitempty"`
+
+	// Add a Server-Timing header breaking down where the proxy spent the
+	// time of each response
+	ServerTiming bool `yaml:"server_timing,omitempty"`
+
+	// Reject requests without a verified client certificate with 403
+	RequireClientCert bool `yaml:"require_client_cert,omitempty"`
+
+	// Redirect this route's requests on the HTTP port to HTTPS, or exempt it
+	// from the global redirect with false
+	RedirectHTTPToHTTPS *bool `yaml:"redirect_http_to_https,omitempty"`
+}
+
+// MirrorConfig copies a sample of a route's requests to a shadow upstream,
+// to try a new backend against production traffic. Copies are sent in the
+// background and their responses discarded.
+type MirrorConfig struct {
+	Upstream    string        `yaml:"upstream"`
+	Percent     float64       `yaml:"percent,omitempty"`       // share of requests mirrored
+	Timeout     time.Duration `yaml:"timeout,omitempty"`       // bound on each mirrored request
+	MaxBodySize int64         `yaml:"max_body_size,omitempty"` // requests with larger bodies are not mirrored
+}
+
+// RequestBufferingConfig reads request bodies in full before they are
+// proxied, so retries and mirrored copies can send them again. Bodies are
+// held in memory up to a limit and spill over to a temporary file beyond it.
+type RequestBufferingConfig struct {
+	MemoryLimit int64  `yaml:"memory_limit,omitempty"` // bytes of a body held in memory
+	MaxSize     int64  `yaml:"max_size,omitempty"`     // larger bodies are streamed unbuffered, and neither retried nor mirrored
+	TempDir     string `yaml:"temp_dir,omitempty"`     // directory of the spill files, the system one if empty
+}
+
+// MatchCondition matches a request header or query parameter by one of: an
+// exact value, a regular expression, or whether it is sent at all
+type MatchCondition struct {
+	Name    string `yaml:"name"`
+	Exact   string `yaml:"exact,omitempty"`
+	Regex   string `yaml:"regex,omitempty"`
+	Present *bool  `yaml:"present,omitempty"`
+}
+
+// String describes a condition, such as X-Version=2 or debug present
+func (c MatchCondition) String() string {
+	switch {
+	case c.Present != nil && *c.Present:
+		return c.Name + " present"
+	case c.Present != nil:
+		return c.Name + " absent"
+	case c.Regex != "":
+		return c.Name + "~" + c.Regex
+	default:
+		return c.Name + "=" + c.Exact
+	}
+}
+
+// RouterConditions converts conditions for the router
+func RouterConditions(conditions []MatchCondition) []router.Condition {
+	converted := make([]router.Condition, len(conditions))
+	for i, c := range conditions {
+		converted[i] = router.Condition{Name: c.Name, Exact: c.Exact, Regex: c.Regex, Present: c.Present}
+	}
+	return converted
+}
+
+// ObservabilityConfig overrides how much the global logging and events
+// middleware record about the requests of a route, to quiet noisy routes
+// such as health checks or capture more of the ones being investigated
+type ObservabilityConfig struct {
+	AccessLog string `yaml:"access_log,omitempty"` // off, errors, default or verbose
+	Events    string `yaml:"events,omitempty"`     // off, default or verbose
+}
+
+// SLOConfig defines the service level objectives of a route, tracked over a
+// rolling window. Responses with a 5xx status count against availability;
+// responses slower than latency count against the latency objective.
+type SLOConfig struct {
+	Name          string        `yaml:"name,omitempty"`           // defaults to the route's host and path
+	Availability  float64       `yaml:"availability,omitempty"`   // target share of successful responses, e.g. 0.999
+	Latency       time.Duration `yaml:"latency,omitempty"`        // threshold of the latency objective
+	LatencyTarget float64       `yaml:"latency_target,omitempty"` // target share of responses faster than latency
+	Window        time.Duration `yaml:"window,omitempty"`
 }
 
 // RewriteConfig defines URL rewriting rules
@@ -101,8 +595,22 @@ type RewriteConfig struct {
 type RetryPolicy struct {
 	Attempts int           `yaml:"attempts"`
 	Backoff  time.Duration `yaml:"backoff"`
+
+	// Conditions that trigger a retry: connect-failure, 5xx, gateway-error
+	// (502, 503 and 504), timeout, or status codes such as "429". Defaults
+	// to 5xx.
+	RetryOn       []string      `yaml:"retry_on,omitempty"`
+	PerTryTimeout time.Duration `yaml:"per_try_timeout,omitempty"` // bound on each attempt, within the route timeout
 }
 
+// Retry conditions
+const (
+	RetryOnConnectFailure = "connect-failure"
+	RetryOn5xx            = "5xx"
+	RetryOnGatewayError   = "gateway-error"
+	RetryOnTimeout        = "timeout"
+)
+
 // MiddlewareConfig defines middleware configurations
 type MiddlewareConfig struct {
 	Chain []MiddlewareChain `yaml:"chain"`
@@ -122,6 +630,56 @@ type TLSConfig struct {
 	Enabled      bool                `yaml:"enabled"`
 	AutoCert     AutoCertConfig      `yaml:"autocert"`
 	Certificates []CertificateConfig `yaml:"certificates,omitempty"`
+	ClientAuth   ClientAuthConfig    `yaml:"client_auth,omitempty"`
+
+	// Protocol versions ("1.0" to "1.3") of the HTTPS listener, and the
+	// cipher suites and key exchange curves it offers. Go's defaults apply
+	// to settings left empty, except that min_version defaults to 1.2.
+	MinVersion       string   `yaml:"min_version,omitempty"`
+	MaxVersion       string   `yaml:"max_version,omitempty"`
+	CipherSuites     []string `yaml:"cipher_suites,omitempty"`     // for TLS 1.2 and earlier, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CurvePreferences []string `yaml:"curve_preferences,omitempty"` // X25519, P256, P384 or P521
+
+	// Reload manual certificates when their files change, e.g. after a
+	// renewal or a rotated Kubernetes secret
+	Watch bool       `yaml:"watch,omitempty"`
+	OCSP  OCSPConfig `yaml:"ocsp,omitempty"`
+}
+
+// OCSPConfig staples OCSP responses of the manual certificates to TLS
+// handshakes, fetched from the issuers' responders in the background
+type OCSPConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Refresh time.Duration `yaml:"refresh,omitempty"` // longest time between fetches, sooner when a response expires
+	Timeout time.Duration `yaml:"timeout,omitempty"` // bound on each fetch
+}
+
+// ClientAuthConfig asks clients of the HTTPS listener for certificates
+type ClientAuthConfig struct {
+	Mode   string `yaml:"mode,omitempty"`    // none, request, require, verify_if_given or require_and_verify
+	CAFile string `yaml:"ca_file,omitempty"` // CA bundle verifying client certificates
+
+	// Pass the subject and SANs of verified client certificates to the
+	// upstreams in X-Client-Cert-Subject and X-Client-Cert-SAN
+	ForwardHeaders bool `yaml:"forward_headers,omitempty"`
+}
+
+// VerifiesClientCerts reports whether the HTTPS listener verifies the client
+// certificates of any host
+func (c *TLSConfig) VerifiesClientCerts() bool {
+	if !c.Enabled {
+		return false
+	}
+	verifies := func(mode string) bool { return mode == "verify_if_given" || mode == "require_and_verify" }
+	if verifies(c.ClientAuth.Mode) {
+		return true
+	}
+	for _, cert := range c.Certificates {
+		if verifies(cert.ClientAuth) {
+			return true
+		}
+	}
+	return false
 }
 
 // AutoCertConfig defines Let's Encrypt configuration
@@ -131,6 +689,18 @@ type AutoCertConfig struct {
 	Hosts    []string `yaml:"hosts"`
 	CacheDir string   `yaml:"cache_dir"`
 	Staging  bool     `yaml:"staging"`
+
+	// External account binding, required by some ACME CAs
+	EABKeyID   string `yaml:"eab_key_id,omitempty"`
+	EABHMACKey string `yaml:"eab_hmac_key,omitempty"`
+
+	// Certificates are cached in cache_dir, or in Redis to be shared by
+	// replicas, which then take a lock so only one of them issues or renews
+	// a certificate while the others wait for it to appear in the cache
+	Cache     string        `yaml:"cache,omitempty"` // dir or redis
+	KeyPrefix string        `yaml:"key_prefix,omitempty"`
+	LockTTL   time.Duration `yaml:"lock_ttl,omitempty"` // how long an issuance may hold the lock
+	Redis     RedisConfig   `yaml:"redis,omitempty"`
 }
 
 // CertificateConfig defines manual certificate configuration
@@ -144,6 +714,7 @@ type CertificateConfig struct {
 	RSABits      int      `yaml:"rsa_bits"`
 	CommonName   string   `yaml:"common_name"`
 	Organization string   `yaml:"organization"`
+	ClientAuth   string   `yaml:"client_auth,omitempty"` // client_auth mode of these hosts, overriding the global one
 }
 
 // HealthConfig defines health check settings
@@ -161,59 +732,168 @@ type MetricsConfig struct {
 	Path    string `yaml:"path"`
 }
 
-// LoadConfig loads configuration from the specified directory
+// section describes a top-level configuration section and where it is stored
+type section struct {
+	name   string // file name (without extension) or key name
+	label  string // human-readable name used in errors
+	target any
+}
+
+// sections returns the configuration sections backed by the given config
+func sections(config *Config) []section {
+	return []section{
+		{name: "global", label: "global", target: &config.Global},
+		{name: "upstreams", label: "upstreams", target: &config.Upstreams},
+		{name: "routes", label: "routes", target: &config.Routes},
+		{name: "middleware", label: "middleware", target: &config.Middleware},
+		{name: "tls", label: "TLS", target: &config.TLS},
+		{name: "health", label: "health", target: &config.Health},
+		{name: "metrics", label: "metrics", target: &config.Metrics},
+	}
+}
+
+// LoadOptions controls how configuration is decoded
+type LoadOptions struct {
+	// Strict rejects unknown keys instead of silently ignoring them
+	Strict bool
+	// Overrides are key=value assignments applied after loading, where the
+	// key is a dotted path such as global.server.http_port
+	Overrides []string
+	// EnvOverrides applies SENTINEL_* environment variables as overrides
+	EnvOverrides bool
+	// Logger receives warnings about settings that are ignored, nil
+	// discards them
+	Logger *zap.Logger
+}
+
+// logger returns the logger of the warnings
+func (o LoadOptions) logger() *zap.Logger {
+	if o.Logger == nil {
+		return zap.NewNop()
+	}
+	return o.Logger
+}
+
+// LoadConfig loads configuration from the specified directory or file
 func LoadConfig(configDir string) (*Config, error) {
-	config := &Config{}
+	return LoadConfigWithOptions(configDir, LoadOptions{})
+}
 
-	// Load global configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "global.yaml"), &config.Global); err != nil {
-		return nil, fmt.Errorf("failed to load global config: %w", err)
+// LoadConfigWithOptions loads configuration from the specified directory,
+// or from a single file holding every section
+func LoadConfigWithOptions(configDir string, opts LoadOptions) (*Config, error) {
+	config := &Config{secrets: make(secretReferences)}
+
+	if err := loadFiles(configDir, config, opts); err != nil {
+		return nil, err
 	}
 
-	// Load upstreams configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "upstreams.yaml"), &config.Upstreams); err != nil {
-		return nil, fmt.Errorf("failed to load upstreams config: %w", err)
+	if err := prepare(config, opts); err != nil {
+		return nil, err
 	}
 
-	// Load routes configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "routes.yaml"), &config.Routes); err != nil {
-		return nil, fmt.Errorf("failed to load routes config: %w", err)
+	return config, nil
+}
+
+// LoadConfigFromData loads configuration from raw YAML documents keyed by
+// section name (global, upstreams, routes, middleware, tls, health, metrics)
+func LoadConfigFromData(data map[string][]byte, opts LoadOptions) (*Config, error) {
+	config := &Config{secrets: make(secretReferences)}
+
+	for _, sec := range sections(config) {
+		raw, exists := data[sec.name]
+		if !exists {
+			return nil, fmt.Errorf("failed to load %s config: section %q not found", sec.label, sec.name)
+		}
+		if err := decodeYAML(raw, sec.target, opts, sec.name, config.secrets); err != nil {
+			return nil, fmt.Errorf("failed to load %s config: %w", sec.label, err)
+		}
 	}
 
-	// Load middleware configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "middleware.yaml"), &config.Middleware); err != nil {
-		return nil, fmt.Errorf("failed to load middleware config: %w", err)
+	if err := prepare(config, opts); err != nil {
+		return nil, err
 	}
 
-	// Load TLS configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "tls.yaml"), &config.TLS); err != nil {
-		return nil, fmt.Errorf("failed to load TLS config: %w", err)
+	return config, nil
+}
+
+// prepare post-processes a freshly decoded configuration
+func prepare(config *Config, opts LoadOptions) error {
+	if opts.Strict {
+		if err := checkMiddlewareKeys(&config.Middleware, &config.Routes); err != nil {
+			return fmt.Errorf("failed to load middleware config: %w", err)
+		}
 	}
 
-	// Load health configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "health.yaml"), &config.Health); err != nil {
-		return nil, fmt.Errorf("failed to load health config: %w", err)
+	// Apply environment and command-line overrides
+	if err := applyOverrides(config, opts); err != nil {
+		return err
 	}
 
-	// Load metrics configuration
-	if err := loadYAMLFile(filepath.Join(configDir, "metrics.yaml"), &config.Metrics); err != nil {
-		return nil, fmt.Errorf("failed to load metrics config: %w", err)
+	// Resolve secret references
+	if err := resolveSecrets(config); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
 	}
 
 	// Set defaults
 	setDefaults(config)
 
-	return config, nil
+	return nil
 }
 
-// loadYAMLFile loads a YAML file into the provided structure
-func loadYAMLFile(filename string, v any) error {
-	data, err := os.ReadFile(filename)
+// decodeYAML decodes a YAML document holding the section at path, rejecting
+// unknown keys in strict mode. Values taken from templates and the
+// environment are recorded in secrets.
+func decodeYAML(data []byte, v any, opts LoadOptions, path string, secrets secretReferences) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	// An empty document leaves the target at its zero value
+	if doc.Kind == 0 {
+		return nil
+	}
+
+	// Merge inherited defaults into routes and upstream services first, so
+	// values are expanded at the paths they end up at
+	changed := false
+	switch v.(type) {
+	case *RoutesConfig:
+		changed = inheritDefaults(&doc, "rules")
+	case *UpstreamsConfig:
+		changed = inheritDefaults(&doc, "services")
+	}
+
+	// Evaluate template expressions in values
+	rendered, err := renderTemplates(&doc, path, secrets)
 	if err != nil {
 		return err
 	}
+	changed = rendered || changed
+
+	// Expand environment variable references, after templates so variable
+	// values are never evaluated as templates
+	interpolated, err := interpolateEnv(&doc, path, secrets)
+	if err != nil {
+		return err
+	}
+	changed = interpolated || changed
+
+	// Re-encode only when the tree was modified, so errors in untouched
+	// documents report their original line numbers
+	if changed {
+		if data, err = yaml.Marshal(&doc); err != nil {
+			return err
+		}
+	}
 
-	return yaml.Unmarshal(data, v)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(opts.Strict)
+	if err := decoder.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
 }
 
 // setDefaults sets default values for configuration
@@ -236,12 +916,112 @@ func setDefaults(config *Config) {
 	if config.Global.Server.MaxHeaderSize == 0 {
 		config.Global.Server.MaxHeaderSize = 1024 * 1024 // 1MB
 	}
+	if socket := &config.Global.Server.UnixSocket; socket.Path != "" && socket.Mode == "" {
+		socket.Mode = "0660"
+	}
+	if limits := &config.Global.Server.ConnectionLimits; limits.RatePerIP > 0 && limits.Burst == 0 {
+		limits.Burst = max(1, int(math.Ceil(limits.RatePerIP)))
+	}
+	if overload := &config.Global.Server.Overload; overload.Enabled {
+		if overload.Window == 0 {
+			overload.Window = 10 * time.Second
+		}
+		if overload.MaxShedRatio == 0 {
+			overload.MaxShedRatio = 0.9
+		}
+		if overload.PriorityPaths == nil {
+			overload.PriorityPaths = []string{"/health", "/healthz", "/ready", "/metrics"}
+		}
+		if overload.RetryAfter == 0 {
+			overload.RetryAfter = time.Second
+		}
+	}
 	if config.Global.Log.Level == "" {
 		config.Global.Log.Level = "info"
 	}
 	if config.Global.Log.Format == "" {
 		config.Global.Log.Format = "json"
 	}
+	if len(config.Global.Log.OutputPaths) == 0 {
+		config.Global.Log.OutputPaths = []string{"stderr"}
+	}
+	if len(config.Global.Log.ErrorOutputPaths) == 0 {
+		config.Global.Log.ErrorOutputPaths = []string{"stderr"}
+	}
+	if accessLog := &config.Global.AccessLog; accessLog.Enabled {
+		if accessLog.Format == "" {
+			accessLog.Format = AccessLogCombined
+		}
+		if accessLog.Rotation.MaxSize == 0 {
+			accessLog.Rotation.MaxSize = 100
+		}
+	}
+	if catalog := &config.Global.APICatalog; catalog.Enabled {
+		if catalog.Path == "" {
+			catalog.Path = "/_catalog"
+		}
+		if catalog.Title == "" {
+			catalog.Title = "Sentinel API Catalog"
+		}
+		if catalog.Refresh == 0 {
+			catalog.Refresh = 5 * time.Minute
+		}
+		if catalog.Timeout == 0 {
+			catalog.Timeout = 10 * time.Second
+		}
+	}
+	setWebhookDefaults(config.Global.Notifications.ReloadWebhooks, "success", "failure")
+	setWebhookDefaults(config.Global.Notifications.SLOWebhooks, "firing", "resolved")
+	if config.Global.SLO.EvaluationInterval == 0 {
+		config.Global.SLO.EvaluationInterval = time.Minute
+	}
+	if len(config.Global.SLO.BurnAlerts) == 0 {
+		// The fast and slow burn alerts recommended by the Google SRE workbook
+		config.Global.SLO.BurnAlerts = []BurnAlertConfig{
+			{Name: "fast_burn", LongWindow: time.Hour, ShortWindow: 5 * time.Minute, BurnRate: 14.4},
+			{Name: "slow_burn", LongWindow: 6 * time.Hour, ShortWindow: 30 * time.Minute, BurnRate: 6},
+		}
+	}
+	for i := range config.Routes.Rules {
+		rule := &config.Routes.Rules[i]
+		if mirror := rule.Mirror; mirror != nil {
+			if mirror.Percent == 0 {
+				mirror.Percent = 100
+			}
+			if mirror.Timeout == 0 {
+				mirror.Timeout = 10 * time.Second
+			}
+			if mirror.MaxBodySize == 0 {
+				mirror.MaxBodySize = 1024 * 1024 // 1MB
+			}
+		}
+		if buffering := rule.RequestBuffering; buffering != nil {
+			if buffering.MemoryLimit == 0 {
+				buffering.MemoryLimit = 1024 * 1024 // 1MB
+			}
+			if buffering.MaxSize == 0 {
+				buffering.MaxSize = max(buffering.MemoryLimit, 10*1024*1024) // 10MB
+			}
+		}
+		if rule.SLO == nil {
+			continue
+		}
+		if rule.SLO.Name == "" {
+			rule.SLO.Name = rule.Host + rule.Path
+		}
+		if rule.SLO.Window == 0 {
+			rule.SLO.Window = 30 * 24 * time.Hour
+		}
+	}
+	if config.Global.Admin.BindAddress == "" {
+		config.Global.Admin.BindAddress = "127.0.0.1"
+	}
+	if config.Global.Admin.Port == 0 {
+		config.Global.Admin.Port = 8083
+	}
+	if config.Global.Admin.HistorySize == 0 {
+		config.Global.Admin.HistorySize = 10
+	}
 	if config.Health.Interval == 0 {
 		config.Health.Interval = 30 * time.Second
 	}
@@ -257,7 +1037,256 @@ func setDefaults(config *Config) {
 	if config.Metrics.Path == "" {
 		config.Metrics.Path = "/metrics"
 	}
+	if config.Upstreams.Discovery.DNS.Interval == 0 {
+		config.Upstreams.Discovery.DNS.Interval = 30 * time.Second
+	}
+	if config.Upstreams.Discovery.DNS.MinInterval == 0 {
+		config.Upstreams.Discovery.DNS.MinInterval = min(5*time.Second, config.Upstreams.Discovery.DNS.Interval)
+	}
 	if config.TLS.AutoCert.CacheDir == "" {
 		config.TLS.AutoCert.CacheDir = "./certs"
 	}
+	if config.TLS.AutoCert.Cache == "" {
+		config.TLS.AutoCert.Cache = "dir"
+	}
+	if config.TLS.AutoCert.KeyPrefix == "" {
+		config.TLS.AutoCert.KeyPrefix = "sentinel:acme:"
+	}
+	if config.TLS.AutoCert.LockTTL == 0 {
+		config.TLS.AutoCert.LockTTL = 5 * time.Minute
+	}
+	if config.Global.Server.RedirectHTTPToHTTPS.StatusCode == 0 {
+		config.Global.Server.RedirectHTTPToHTTPS.StatusCode = http.StatusPermanentRedirect
+	}
+	if config.TLS.OCSP.Refresh == 0 {
+		config.TLS.OCSP.Refresh = 12 * time.Hour
+	}
+	if config.TLS.OCSP.Timeout == 0 {
+		config.TLS.OCSP.Timeout = 10 * time.Second
+	}
+	if config.TLS.AutoCert.Cache == "redis" && config.TLS.AutoCert.Redis.Address == "" {
+		config.TLS.AutoCert.Redis.Address = "127.0.0.1:6379"
+	}
+	for name, service := range config.Upstreams.Services {
+		if service.LoadBalancer == "" {
+			service.LoadBalancer = "round_robin"
+			config.Upstreams.Services[name] = service
+		}
+		if prewarm := service.Prewarm; prewarm != nil {
+			if prewarm.Method == "" {
+				prewarm.Method = "HEAD"
+			}
+			if prewarm.Path == "" {
+				prewarm.Path = "/"
+			}
+			if prewarm.Timeout == 0 {
+				prewarm.Timeout = 5 * time.Second
+			}
+		}
+		if transport := service.Transport; transport != nil {
+			if transport.MaxIdleConns == 0 {
+				transport.MaxIdleConns = DefaultTransport.MaxIdleConns
+			}
+			if transport.MaxIdleConnsPerHost == 0 {
+				transport.MaxIdleConnsPerHost = DefaultTransport.MaxIdleConnsPerHost
+			}
+			if transport.IdleConnTimeout == 0 {
+				transport.IdleConnTimeout = DefaultTransport.IdleConnTimeout
+			}
+			if transport.DialTimeout == 0 {
+				transport.DialTimeout = DefaultTransport.DialTimeout
+			}
+			if transport.KeepAlive == 0 {
+				transport.KeepAlive = DefaultTransport.KeepAlive
+			}
+			if transport.TLSHandshakeTimeout == 0 {
+				transport.TLSHandshakeTimeout = DefaultTransport.TLSHandshakeTimeout
+			}
+			if transport.ExpectContinueTimeout == 0 {
+				transport.ExpectContinueTimeout = DefaultTransport.ExpectContinueTimeout
+			}
+		}
+		if outliers := service.OutlierDetection; outliers != nil {
+			if outliers.Consecutive5xx == 0 {
+				outliers.Consecutive5xx = 5
+			}
+			if outliers.ConsecutiveConnectFailures == 0 {
+				outliers.ConsecutiveConnectFailures = 3
+			}
+			if outliers.BaseEjectionTime == 0 {
+				outliers.BaseEjectionTime = 30 * time.Second
+			}
+			if outliers.MaxEjectionTime == 0 {
+				outliers.MaxEjectionTime = 5 * time.Minute
+			}
+			if outliers.MaxEjectionPercent == 0 {
+				outliers.MaxEjectionPercent = 50
+			}
+			if outliers.RecoveryWindow == 0 {
+				outliers.RecoveryWindow = 30 * time.Second
+			}
+		}
+		if slowStart := service.SlowStart; slowStart != nil {
+			if slowStart.Window == 0 {
+				slowStart.Window = 30 * time.Second
+			}
+			if slowStart.MinPercent == 0 {
+				slowStart.MinPercent = 10
+			}
+		}
+		if budget := service.RetryBudget; budget != nil {
+			if budget.Percent == 0 {
+				budget.Percent = 20
+			}
+			if budget.Window == 0 {
+				budget.Window = 10 * time.Second
+			}
+			if budget.MinRetries == 0 {
+				budget.MinRetries = 10
+			}
+		}
+		if sticky := service.Sticky; sticky != nil {
+			if sticky.Cookie == "" {
+				sticky.Cookie = "sentinel_sticky"
+			}
+			if sticky.TTL == 0 {
+				sticky.TTL = time.Hour
+			}
+			if sticky.Store == "" {
+				sticky.Store = "memory"
+			}
+			if sticky.KeyPrefix == "" {
+				sticky.KeyPrefix = "sentinel:sticky:"
+			}
+			if sticky.StoreTimeout == 0 {
+				sticky.StoreTimeout = 200 * time.Millisecond
+			}
+			if sticky.Store == "redis" && sticky.Redis.Address == "" {
+				sticky.Redis.Address = "127.0.0.1:6379"
+			}
+		}
+		if bg := service.BlueGreen; bg != nil {
+			if bg.Active == "" {
+				bg.Active = ColorBlue
+			}
+			if bg.Rollback.Window == 0 {
+				bg.Rollback.Window = 5 * time.Minute
+			}
+			if bg.Rollback.MinRequests == 0 {
+				bg.Rollback.MinRequests = 20
+			}
+		}
+	}
+}
+
+// setWebhookDefaults fills in the unset options of webhooks, subscribing
+// them to events by default
+func setWebhookDefaults(webhooks []WebhookConfig, events ...string) {
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if len(webhook.Events) == 0 {
+			webhook.Events = append([]string(nil), events...)
+		}
+		if webhook.Timeout == 0 {
+			webhook.Timeout = 5 * time.Second
+		}
+		if webhook.Attempts == 0 {
+			webhook.Attempts = 3
+		}
+	}
+}
+
+// ParseFileMode parses octal file permissions such as "0660"
+func ParseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("not octal file permissions: %q", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// tlsVersions are the TLS protocol versions by name
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCurves are the key exchange curves by name
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// ParseTLSVersion parses a TLS protocol version such as "1.2"; an empty
+// value is 0, Go's default
+func ParseTLSVersion(value string) (uint16, error) {
+	if value == "" {
+		return 0, nil
+	}
+	version, exists := tlsVersions[value]
+	if !exists {
+		return 0, fmt.Errorf("unknown TLS version %q, must be one of: %s", value, strings.Join(validTLSVersions, ", "))
+	}
+	return version, nil
+}
+
+// ParseCipherSuites parses cipher suite names such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Suites Go considers insecure are
+// rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	byName := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		id, exists := byName[name]
+		switch {
+		case insecure[name]:
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		case !exists:
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseCurves parses key exchange curve names such as X25519 or P256
+func ParseCurves(names []string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	for _, name := range names {
+		curve, exists := tlsCurves[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown curve %s, must be one of: %s", name, strings.Join(validCurves, ", "))
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// ParseCIDR parses a CIDR, or a single IP address as a network containing
+// only that address
+func ParseCIDR(value string) (*net.IPNet, error) {
+	if ip := net.ParseIP(value); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("not an IP address or CIDR")
+	}
+	return network, nil
 }
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff returns a human-readable list of changes between two configurations
+func Diff(oldCfg, newCfg *Config) []string {
+	var changes []string
+
+	if !reflect.DeepEqual(oldCfg.Global, newCfg.Global) {
+		changes = append(changes, diffGlobal(&oldCfg.Global, &newCfg.Global)...)
+	}
+
+	changes = append(changes, diffUpstreams(&oldCfg.Upstreams, &newCfg.Upstreams)...)
+	changes = append(changes, diffRoutes(&oldCfg.Routes, &newCfg.Routes)...)
+	changes = append(changes, diffMiddleware(&oldCfg.Middleware, &newCfg.Middleware)...)
+
+	if !reflect.DeepEqual(oldCfg.TLS, newCfg.TLS) {
+		changes = append(changes, "tls: configuration changed")
+	}
+	if !reflect.DeepEqual(oldCfg.Health, newCfg.Health) {
+		changes = append(changes, "health: configuration changed")
+	}
+	if !reflect.DeepEqual(oldCfg.Metrics, newCfg.Metrics) {
+		changes = append(changes, "metrics: configuration changed")
+	}
+
+	return changes
+}
+
+// diffGlobal describes changes to global settings
+func diffGlobal(oldCfg, newCfg *GlobalConfig) []string {
+	var changes []string
+
+	oldServer := reflect.ValueOf(oldCfg.Server)
+	newServer := reflect.ValueOf(newCfg.Server)
+	serverType := oldServer.Type()
+	for i := 0; i < serverType.NumField(); i++ {
+		oldField := oldServer.Field(i).Interface()
+		newField := newServer.Field(i).Interface()
+		if !reflect.DeepEqual(oldField, newField) {
+			changes = append(changes, fmt.Sprintf("global: server.%s changed from %v to %v",
+				yamlName(serverType.Field(i)), oldField, newField))
+		}
+	}
+
+	if !reflect.DeepEqual(oldCfg.Log, newCfg.Log) {
+		changes = append(changes, fmt.Sprintf("global: log changed from %+v to %+v", oldCfg.Log, newCfg.Log))
+	}
+
+	if !reflect.DeepEqual(oldCfg.APICatalog, newCfg.APICatalog) {
+		changes = append(changes, fmt.Sprintf("global: api_catalog changed from %+v to %+v", oldCfg.APICatalog, newCfg.APICatalog))
+	}
+
+	if !reflect.DeepEqual(oldCfg.SLO, newCfg.SLO) {
+		changes = append(changes, fmt.Sprintf("global: slo changed from %+v to %+v", oldCfg.SLO, newCfg.SLO))
+	}
+
+	// Webhooks may carry secrets, so only their number is reported
+	if !reflect.DeepEqual(oldCfg.Notifications.ReloadWebhooks, newCfg.Notifications.ReloadWebhooks) {
+		changes = append(changes, fmt.Sprintf("global: notifications.reload_webhooks changed, %d webhook(s)",
+			len(newCfg.Notifications.ReloadWebhooks)))
+	}
+	if !reflect.DeepEqual(oldCfg.Notifications.SLOWebhooks, newCfg.Notifications.SLOWebhooks) {
+		changes = append(changes, fmt.Sprintf("global: notifications.slo_webhooks changed, %d webhook(s)",
+			len(newCfg.Notifications.SLOWebhooks)))
+	}
+
+	return changes
+}
+
+// diffUpstreams describes added, removed and modified upstream services
+func diffUpstreams(oldCfg, newCfg *UpstreamsConfig) []string {
+	var changes []string
+
+	for _, name := range sortedKeys(oldCfg.Services) {
+		if _, exists := newCfg.Services[name]; !exists {
+			changes = append(changes, fmt.Sprintf("upstream '%s' removed", name))
+		}
+	}
+
+	for _, name := range sortedKeys(newCfg.Services) {
+		newService := newCfg.Services[name]
+		oldService, exists := oldCfg.Services[name]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("upstream '%s' added with %d target(s)", name, len(newService.AllTargets())))
+			continue
+		}
+
+		if oldService.LoadBalancer != newService.LoadBalancer {
+			changes = append(changes, fmt.Sprintf("upstream '%s': load_balancer changed from %s to %s",
+				name, oldService.LoadBalancer, newService.LoadBalancer))
+		}
+
+		oldTargets := make(map[string]Target, len(oldService.AllTargets()))
+		for _, target := range oldService.AllTargets() {
+			oldTargets[target.URL] = target
+		}
+		newTargets := make(map[string]Target, len(newService.AllTargets()))
+		for _, target := range newService.AllTargets() {
+			newTargets[target.URL] = target
+			oldTarget, exists := oldTargets[target.URL]
+			if !exists {
+				changes = append(changes, fmt.Sprintf("upstream '%s': target %s added", name, target.URL))
+			} else if !reflect.DeepEqual(oldTarget, target) {
+				changes = append(changes, fmt.Sprintf("upstream '%s': target %s changed", name, target.URL))
+			}
+		}
+		for _, target := range oldService.AllTargets() {
+			if _, exists := newTargets[target.URL]; !exists {
+				changes = append(changes, fmt.Sprintf("upstream '%s': target %s removed", name, target.URL))
+			}
+		}
+
+		if !reflect.DeepEqual(oldService.HealthCheck, newService.HealthCheck) {
+			changes = append(changes, fmt.Sprintf("upstream '%s': health_check changed", name))
+		}
+
+		switch oldBG, newBG := oldService.BlueGreen, newService.BlueGreen; {
+		case oldBG == nil && newBG != nil:
+			changes = append(changes, fmt.Sprintf("upstream '%s': blue_green enabled with %s active", name, newBG.Active))
+		case oldBG != nil && newBG == nil:
+			changes = append(changes, fmt.Sprintf("upstream '%s': blue_green disabled", name))
+		case oldBG != nil && oldBG.Active != newBG.Active:
+			changes = append(changes, fmt.Sprintf("upstream '%s': blue_green active changed from %s to %s", name, oldBG.Active, newBG.Active))
+		}
+	}
+
+	return changes
+}
+
+// diffRoutes describes added, removed and modified route rules
+func diffRoutes(oldCfg, newCfg *RoutesConfig) []string {
+	var changes []string
+
+	oldRules := make(map[string]RouteRule, len(oldCfg.Rules))
+	for _, rule := range oldCfg.Rules {
+		oldRules[routeKey(&rule)] = rule
+	}
+	newRules := make(map[string]RouteRule, len(newCfg.Rules))
+	for _, rule := range newCfg.Rules {
+		key := routeKey(&rule)
+		newRules[key] = rule
+		oldRule, exists := oldRules[key]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("route %s added -> %s", key, rule.Upstream))
+		} else if !reflect.DeepEqual(oldRule, rule) {
+			changes = append(changes, diffRoute(key, &oldRule, &rule)...)
+		}
+	}
+	for _, rule := range oldCfg.Rules {
+		key := routeKey(&rule)
+		if _, exists := newRules[key]; !exists {
+			changes = append(changes, fmt.Sprintf("route %s removed", key))
+		}
+	}
+
+	if len(changes) == 0 && !reflect.DeepEqual(oldCfg.Rules, newCfg.Rules) {
+		changes = append(changes, "routes: rule order changed")
+	}
+
+	return changes
+}
+
+// diffRoute describes changes to a route rule that stays in place
+func diffRoute(key string, oldRule, newRule *RouteRule) []string {
+	var changes []string
+	if oldRule.Upstream != newRule.Upstream {
+		changes = append(changes, fmt.Sprintf("route %s: upstream changed from %s to %s", key, oldRule.Upstream, newRule.Upstream))
+	}
+	// Overrides may carry secrets, so only the names are reported
+	if oldNames, newNames := middlewareNames(oldRule.Middleware), middlewareNames(newRule.Middleware); !reflect.DeepEqual(oldNames, newNames) {
+		changes = append(changes, fmt.Sprintf("route %s: middleware changed from %v to %v", key, oldNames, newNames))
+	} else if !reflect.DeepEqual(oldRule.Middleware, newRule.Middleware) {
+		changes = append(changes, fmt.Sprintf("route %s: middleware options changed", key))
+	}
+
+	// Other settings are summarized
+	oldRest, newRest := *oldRule, *newRule
+	oldRest.Upstream, oldRest.Middleware = "", nil
+	newRest.Upstream, newRest.Middleware = "", nil
+	if !reflect.DeepEqual(oldRest, newRest) {
+		changes = append(changes, fmt.Sprintf("route %s changed", key))
+	}
+	return changes
+}
+
+// middlewareNames returns the names of the middleware a route references
+func middlewareNames(refs []RouteMiddleware) []string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Name
+	}
+	return names
+}
+
+// diffMiddleware describes added, removed and modified middleware definitions
+func diffMiddleware(oldCfg, newCfg *MiddlewareConfig) []string {
+	var changes []string
+
+	oldChain := make(map[string]MiddlewareChain, len(oldCfg.Chain))
+	for _, mw := range oldCfg.Chain {
+		oldChain[mw.Name] = mw
+	}
+	newChain := make(map[string]MiddlewareChain, len(newCfg.Chain))
+	for _, mw := range newCfg.Chain {
+		newChain[mw.Name] = mw
+		oldMw, exists := oldChain[mw.Name]
+		switch {
+		case !exists:
+			changes = append(changes, fmt.Sprintf("middleware '%s' (%s) added", mw.Name, mw.Type))
+		case oldMw.Enabled != mw.Enabled:
+			changes = append(changes, fmt.Sprintf("middleware '%s': enabled changed from %t to %t", mw.Name, oldMw.Enabled, mw.Enabled))
+		case !reflect.DeepEqual(oldMw, mw):
+			changes = append(changes, fmt.Sprintf("middleware '%s' changed", mw.Name))
+		}
+	}
+	for _, mw := range oldCfg.Chain {
+		if _, exists := newChain[mw.Name]; !exists {
+			changes = append(changes, fmt.Sprintf("middleware '%s' removed", mw.Name))
+		}
+	}
+
+	return changes
+}
+
+// routeKey returns a stable identifier for a route rule
+func routeKey(rule *RouteRule) string {
+	key := rule.Host + rule.Path
+	if len(rule.Methods) > 0 {
+		key += fmt.Sprintf(" %v", rule.Methods)
+	}
+	if len(rule.HeadersMatch) > 0 {
+		key += fmt.Sprintf(" headers%v", rule.HeadersMatch)
+	}
+	if len(rule.QueryMatch) > 0 {
+		key += fmt.Sprintf(" query%v", rule.QueryMatch)
+	}
+	return key
+}
+
+// yamlName returns the YAML key of a struct field
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dynamicTargets validates the URLs of targets resolved by service discovery,
+// by URL scheme
+var (
+	dynamicTargetsMu sync.RWMutex
+	dynamicTargets   = map[string]func(targetURL string) error{
+		KubernetesScheme: func(targetURL string) error {
+			_, err := ParseKubernetesTarget(targetURL)
+			return err
+		},
+		SRVScheme: func(targetURL string) error {
+			_, err := ParseSRVTarget(targetURL)
+			return err
+		},
+		DNSScheme: func(targetURL string) error {
+			_, err := ParseDNSTarget(targetURL)
+			return err
+		},
+		FileScheme: func(targetURL string) error {
+			_, err := ParseFileTarget(targetURL)
+			return err
+		},
+	}
+)
+
+// RegisterDynamicTarget makes targets with the given URL scheme valid.
+// validate checks a target URL of the scheme and may be nil.
+func RegisterDynamicTarget(scheme string, validate func(targetURL string) error) {
+	if validate == nil {
+		validate = func(string) error { return nil }
+	}
+
+	dynamicTargetsMu.Lock()
+	defer dynamicTargetsMu.Unlock()
+	dynamicTargets[scheme] = validate
+}
+
+// IsDynamicTarget reports whether a target URL is resolved by service
+// discovery rather than proxied to directly
+func IsDynamicTarget(targetURL string) bool {
+	_, ok := dynamicTargetValidator(targetURL)
+	return ok
+}
+
+// validateDynamicTarget checks the URL of a target resolved by service
+// discovery
+func validateDynamicTarget(targetURL string) error {
+	validate, ok := dynamicTargetValidator(targetURL)
+	if !ok {
+		return fmt.Errorf("no service discovery provider for %s", targetURL)
+	}
+	return validate(targetURL)
+}
+
+// dynamicTargetValidator returns the validator of a target URL's scheme
+func dynamicTargetValidator(targetURL string) (func(string) error, bool) {
+	scheme, _, found := strings.Cut(targetURL, "://")
+	if !found {
+		return nil, false
+	}
+
+	dynamicTargetsMu.RLock()
+	defer dynamicTargetsMu.RUnlock()
+	validate, ok := dynamicTargets[scheme]
+	return validate, ok
+}
+
+// KubernetesScheme is the URL scheme of targets resolved from the endpoints
+// of a Kubernetes service
+const KubernetesScheme = "k8s"
+
+// KubernetesTarget is a target of the form k8s://namespace/service:port that
+// expands to the ready endpoints of a Kubernetes service
+type KubernetesTarget struct {
+	Namespace string
+	Service   string
+	Port      string // service port number or name
+	Scheme    string // scheme used to reach the endpoints, http by default
+}
+
+// ParseKubernetesTarget parses a k8s://namespace/service:port target URL. The
+// endpoints are reached over http unless the URL has a scheme=https query.
+func ParseKubernetesTarget(targetURL string) (*KubernetesTarget, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != KubernetesScheme {
+		return nil, fmt.Errorf("not a %s:// target", KubernetesScheme)
+	}
+
+	service, port, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), ":")
+	target := &KubernetesTarget{
+		Namespace: u.Host,
+		Service:   service,
+		Port:      port,
+		Scheme:    u.Query().Get("scheme"),
+	}
+	if target.Namespace == "" || target.Service == "" || strings.Contains(target.Service, "/") {
+		return nil, fmt.Errorf("kubernetes target must have the form %s://namespace/service:port", KubernetesScheme)
+	}
+	if target.Port == "" {
+		return nil, fmt.Errorf("kubernetes target must name a service port")
+	}
+	if target.Scheme == "" {
+		target.Scheme = "http"
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("kubernetes target scheme must be http or https")
+	}
+	return target, nil
+}
+
+// SRVScheme is the URL scheme of targets resolved from DNS SRV records
+const SRVScheme = "srv"
+
+// SRVTarget is a target of the form srv://_service._proto.name that expands
+// to the hosts and ports listed in its SRV records
+type SRVTarget struct {
+	Name   string // SRV record name, e.g. _http._tcp.example.com
+	Scheme string // scheme used to reach the hosts
+}
+
+// ParseSRVTarget parses a srv://_service._proto.name target URL. The hosts
+// are reached over https for an _https service or a scheme=https query, and
+// over http otherwise.
+func ParseSRVTarget(targetURL string) (*SRVTarget, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != SRVScheme {
+		return nil, fmt.Errorf("not a %s:// target", SRVScheme)
+	}
+
+	labels := strings.SplitN(u.Host, ".", 3)
+	if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") || u.Port() != "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("SRV target must have the form %s://_service._proto.name", SRVScheme)
+	}
+
+	target := &SRVTarget{Name: u.Host, Scheme: u.Query().Get("scheme")}
+	if target.Scheme == "" {
+		target.Scheme = "http"
+		if labels[0] == "_https" {
+			target.Scheme = "https"
+		}
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("SRV target scheme must be http or https")
+	}
+	return target, nil
+}
+
+// DNSScheme is the URL scheme of targets resolved from DNS A and AAAA records
+const DNSScheme = "dns"
+
+// DNSTarget is a target of the form dns://host:port that expands to the
+// addresses in the A and AAAA records of host
+type DNSTarget struct {
+	Host   string
+	Port   string
+	Scheme string // scheme used to reach the addresses, http by default
+}
+
+// ParseDNSTarget parses a dns://host:port target URL. The port defaults to
+// that of the scheme, and the addresses are reached over http unless the URL
+// has a scheme=https query.
+func ParseDNSTarget(targetURL string) (*DNSTarget, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != DNSScheme {
+		return nil, fmt.Errorf("not a %s:// target", DNSScheme)
+	}
+	if u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("DNS target must have the form %s://host:port", DNSScheme)
+	}
+
+	target := &DNSTarget{Host: u.Hostname(), Port: u.Port(), Scheme: u.Query().Get("scheme")}
+	if target.Scheme == "" {
+		target.Scheme = "http"
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("DNS target scheme must be http or https")
+	}
+	if target.Port == "" {
+		target.Port = "80"
+		if target.Scheme == "https" {
+			target.Port = "443"
+		}
+	}
+	if port, err := strconv.Atoi(target.Port); err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("DNS target port must be between 1 and 65535")
+	}
+	return target, nil
+}
+
+// FileScheme is the URL scheme of targets listed in a targets file
+const FileScheme = "file"
+
+// FileTargetURL returns the target URL of a targets file
+func FileTargetURL(path string) string {
+	return FileScheme + "://" + path
+}
+
+// ParseFileTarget returns the path of a file://path target. The path is
+// taken literally, so file://targets.txt is relative to the working
+// directory and file:///etc/sentinel/targets.txt is absolute.
+func ParseFileTarget(targetURL string) (string, error) {
+	path, ok := strings.CutPrefix(targetURL, FileScheme+"://")
+	if !ok {
+		return "", fmt.Errorf("not a %s:// target", FileScheme)
+	}
+	if path == "" {
+		return "", fmt.Errorf("targets file path cannot be empty")
+	}
+	return path, nil
+}
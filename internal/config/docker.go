@@ -0,0 +1,354 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/docker"
+	"go.uber.org/zap"
+)
+
+// Docker container labels
+const (
+	dockerHostLabel    = "sentinel.host"
+	dockerPathLabel    = "sentinel.path"
+	dockerPortLabel    = "sentinel.port"
+	dockerUpstreamName = "docker/"
+
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// dockerEvents are the container events that can change the routes
+var dockerEvents = []string{"start", "die", "destroy", "pause", "unpause", "health_status"}
+
+// DockerSource loads configuration from the labels of running Docker
+// containers on top of a base configuration directory. Containers with a
+// sentinel.host label get route rules, and the containers of a Compose
+// service share an upstream.
+type DockerSource struct {
+	client    *docker.Client
+	base      *FileSource
+	network   string
+	published bool
+	logger    *zap.Logger
+
+	mu     sync.Mutex
+	digest [sha256.Size]byte // of the last loaded configuration
+	timer  *time.Timer
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// NewDockerSource creates a Docker configuration source from a URL of the
+// form docker://[host:port|/path/to/docker.sock]?base=./configs/default.
+// Without an address the daemon's default socket is used.
+func NewDockerSource(u *url.URL, opts LoadOptions, logger *zap.Logger) (*DockerSource, error) {
+	query := u.Query()
+	address := u.Host
+	if address == "" {
+		address = u.Path
+	}
+
+	base := query.Get("base")
+	if base == "" {
+		return nil, fmt.Errorf("docker source requires a base configuration directory, e.g. docker://?base=./configs/default")
+	}
+	published := false
+	if value := query.Get("published"); value != "" {
+		var err error
+		if published, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("docker source published must be true or false: %w", err)
+		}
+	}
+
+	return &DockerSource{
+		client:    docker.NewClient(address),
+		base:      NewFileSource(base, opts, logger),
+		network:   query.Get("network"),
+		published: published,
+		logger:    logger,
+	}, nil
+}
+
+// Load loads the base configuration and adds the routes of the containers
+func (s *DockerSource) Load() (*Config, error) {
+	config, err := s.load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := configDigest(config)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.digest = digest
+	s.mu.Unlock()
+	return config, nil
+}
+
+// Watch watches the base directory and the containers. Container events only
+// trigger a reload when they change the resulting configuration.
+func (s *DockerSource) Watch(onChange func()) error {
+	if err := s.base.Watch(onChange); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		s.watchEvents(ctx, onChange)
+	}()
+
+	s.logger.Info("Watching Docker containers for configuration changes", zap.String("endpoint", s.client.Endpoint()))
+	return nil
+}
+
+// Stop stops watching
+func (s *DockerSource) Stop() {
+	s.base.Stop()
+	if s.cancel != nil {
+		s.cancel()
+		s.done.Wait()
+	}
+
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+}
+
+// String describes the source
+func (s *DockerSource) String() string {
+	return fmt.Sprintf("docker %s (base %s)", s.client.Endpoint(), s.base)
+}
+
+// watchEvents follows container events, checking for changes after every
+// event and whenever the stream is reconnected, as events may have been
+// missed
+func (s *DockerSource) watchEvents(ctx context.Context, onChange func()) {
+	changed := func() { s.schedule(ctx, onChange) }
+	for {
+		err := s.client.Events(ctx, dockerHostLabel, dockerEvents, func(docker.Event) { changed() })
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.logger.Error("Docker event stream failed", zap.Error(err))
+		}
+		if !sleepContext(ctx, kvRetryInterval) {
+			return
+		}
+		changed()
+	}
+}
+
+// schedule checks for configuration changes once container events settle
+func (s *DockerSource) schedule(ctx context.Context, onChange func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(DefaultDebounce, func() {
+		config, err := s.load(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Error("Failed to load Docker configuration", zap.Error(err))
+			}
+			return
+		}
+		digest, err := configDigest(config)
+		if err != nil {
+			s.logger.Error("Failed to compare Docker configuration", zap.Error(err))
+			return
+		}
+
+		s.mu.Lock()
+		unchanged := digest == s.digest
+		s.mu.Unlock()
+		if !unchanged {
+			s.logger.Info("Docker containers changed")
+			onChange()
+		}
+	})
+}
+
+// load builds the configuration from the base directory and the running
+// containers
+func (s *DockerSource) load(ctx context.Context) (*Config, error) {
+	config, err := s.base.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := s.client.ListContainers(ctx, dockerHostLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	s.apply(config, containers)
+	return config, nil
+}
+
+// dockerService is the containers sharing an upstream
+type dockerService struct {
+	upstream UpstreamService
+	routes   []RouteRule
+}
+
+// apply adds an upstream for every Compose service, or standalone container,
+// and route rules for the hosts and paths in their labels
+func (s *DockerSource) apply(config *Config, containers []docker.Container) {
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name() < containers[j].Name() })
+
+	services := make(map[string]*dockerService)
+	for i := range containers {
+		container := &containers[i]
+		// Containers only take traffic once their health check passes
+		if strings.Contains(container.Status, "(unhealthy)") || strings.Contains(container.Status, "(health: starting)") {
+			continue
+		}
+
+		targetURL, err := s.targetURL(container)
+		if err != nil {
+			s.logger.Warn("Skipping Docker container", zap.String("container", container.Name()), zap.Error(err))
+			continue
+		}
+
+		name := dockerUpstreamName + container.Name()
+		if project, service := container.Labels[composeProjectLabel], container.Labels[composeServiceLabel]; project != "" && service != "" {
+			name = dockerUpstreamName + project + "_" + service
+		}
+		service, ok := services[name]
+		if !ok {
+			service = &dockerService{upstream: UpstreamService{
+				LoadBalancer: config.Upstreams.Defaults.LoadBalancer,
+				HealthCheck:  config.Upstreams.Defaults.HealthCheck,
+			}}
+			if service.upstream.LoadBalancer == "" {
+				service.upstream.LoadBalancer = "round_robin"
+			}
+			services[name] = service
+		}
+		service.upstream.Targets = append(service.upstream.Targets, Target{URL: targetURL})
+
+		path := container.Labels[dockerPathLabel]
+		if path == "" {
+			path = "/*"
+		}
+		for _, host := range strings.Split(container.Labels[dockerHostLabel], ",") {
+			route := RouteRule{Host: strings.TrimSpace(host), Path: path, Upstream: name}
+			if route.Host != "" && !containsRoute(service.routes, route) {
+				service.routes = append(service.routes, route)
+			}
+		}
+	}
+
+	var rules []RouteRule
+	for _, service := range services {
+		rules = append(rules, service.routes...)
+	}
+	// Longer paths are more specific, and routes are matched in order
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) > len(b.Path)
+		}
+		return a.Upstream < b.Upstream
+	})
+	config.Routes.Rules = append(config.Routes.Rules, rules...)
+
+	if config.Upstreams.Services == nil {
+		config.Upstreams.Services = make(map[string]UpstreamService)
+	}
+	for name, service := range services {
+		config.Upstreams.Services[name] = service.upstream
+	}
+}
+
+// targetURL returns the address Sentinel reaches a container at: its IP
+// address on the chosen network, or the host port it is published on
+func (s *DockerSource) targetURL(container *docker.Container) (string, error) {
+	port := 0
+	if label := container.Labels[dockerPortLabel]; label != "" {
+		var err error
+		if port, err = strconv.Atoi(label); err != nil || port < 1 || port > 65535 {
+			return "", fmt.Errorf("invalid %s label %q", dockerPortLabel, label)
+		}
+	} else {
+		// Without a label, the container must expose a single TCP port
+		for _, p := range container.Ports {
+			if p.Type == "tcp" && p.PrivatePort != port {
+				if port != 0 {
+					return "", fmt.Errorf("container exposes several ports, set the %s label", dockerPortLabel)
+				}
+				port = p.PrivatePort
+			}
+		}
+		if port == 0 {
+			return "", fmt.Errorf("container exposes no port, set the %s label", dockerPortLabel)
+		}
+	}
+
+	if s.published {
+		for _, p := range container.Ports {
+			if p.Type == "tcp" && p.PrivatePort == port && p.PublicPort != 0 {
+				host := p.IP
+				if host == "" || host == "0.0.0.0" || host == "::" {
+					host = "127.0.0.1"
+				}
+				return "http://" + net.JoinHostPort(host, strconv.Itoa(p.PublicPort)), nil
+			}
+		}
+		return "", fmt.Errorf("port %d is not published", port)
+	}
+
+	networks := container.NetworkSettings.Networks
+	var names []string
+	for name := range networks {
+		if s.network == "" || name == s.network {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := networks[name].IPAddress; ip != "" {
+			return "http://" + net.JoinHostPort(ip, strconv.Itoa(port)), nil
+		}
+		if ip := networks[name].GlobalIPv6Address; ip != "" {
+			return "http://" + net.JoinHostPort(ip, strconv.Itoa(port)), nil
+		}
+	}
+	if s.network != "" {
+		return "", fmt.Errorf("container has no address on network %s", s.network)
+	}
+	return "", fmt.Errorf("container has no network address")
+}
+
+// containsRoute reports whether rules hold a rule for the same host, path
+// and upstream
+func containsRoute(rules []RouteRule, rule RouteRule) bool {
+	for _, r := range rules {
+		if r.Host == rule.Host && r.Path == rule.Path && r.Upstream == rule.Upstream {
+			return true
+		}
+	}
+	return false
+}
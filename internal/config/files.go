@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MainFile is the file in a configuration directory that can hold every
+// section, keyed by section name
+const MainFile = "sentinel.yaml"
+
+// FragmentDir is the subdirectory of a configuration directory whose files
+// are merged into the sections, like MainFile, in name order
+const FragmentDir = "conf.d"
+
+// fragment is a part of a configuration section read from one file
+type fragment struct {
+	file string
+	data []byte     // contents of a section file
+	node *yaml.Node // a section of a file holding several, or nil
+}
+
+// loadFiles loads the configuration in a directory, or in a single file
+// holding every section. A directory's sections come from their own files,
+// MainFile and the files in FragmentDir, any of which may be missing.
+func loadFiles(path string, config *Config, opts LoadOptions) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	fragments := make(map[string][]fragment)
+	addFile := func(file string) error {
+		sections, err := readSections(file, opts)
+		if err != nil {
+			return err
+		}
+		for name, node := range sections {
+			fragments[name] = append(fragments[name], fragment{file: file, node: node})
+		}
+		return nil
+	}
+
+	found := false
+	if !info.IsDir() {
+		if err := addFile(path); err != nil {
+			return err
+		}
+		found = true
+	} else {
+		for _, sec := range sections(config) {
+			file := filepath.Join(path, sec.name+".yaml")
+			data, err := os.ReadFile(file)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to load %s config: %w", sec.label, err)
+			}
+			fragments[sec.name] = append(fragments[sec.name], fragment{file: file, data: data})
+			found = true
+		}
+
+		files, err := filepath.Glob(filepath.Join(path, FragmentDir, "*.yaml"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		if _, err := os.Stat(filepath.Join(path, MainFile)); err == nil {
+			files = append([]string{filepath.Join(path, MainFile)}, files...)
+		}
+		for _, file := range files {
+			if err := addFile(file); err != nil {
+				return err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no configuration files found in %s", path)
+	}
+
+	for _, sec := range sections(config) {
+		if err := decodeFragments(fragments[sec.name], sec.target, opts, sec.name, config.secrets); err != nil {
+			return fmt.Errorf("failed to load %s config: %w", sec.label, err)
+		}
+	}
+	return nil
+}
+
+// readSections reads a file holding several sections, keyed by section name
+func readSections(file string, opts LoadOptions) (map[string]*yaml.Node, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", file, err)
+	}
+	result := make(map[string]*yaml.Node)
+	if doc.Kind == 0 || isNull(doc.Content[0]) {
+		return result, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to load %s: line %d: expected a mapping of sections", file, root.Line)
+	}
+
+	known := make(map[string]bool)
+	for _, sec := range sections(&Config{}) {
+		known[sec.name] = true
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name := root.Content[i].Value
+		if !known[name] {
+			if opts.Strict {
+				return nil, fmt.Errorf("failed to load %s: line %d: unknown section %q", file, root.Content[i].Line, name)
+			}
+			continue
+		}
+		if !isNull(root.Content[i+1]) {
+			result[name] = root.Content[i+1]
+		}
+	}
+	return result, nil
+}
+
+// decodeFragments decodes the fragments of the section at path into v,
+// merging them when there are several. A section without fragments is left
+// empty.
+func decodeFragments(fragments []fragment, v any, opts LoadOptions, path string, secrets secretReferences) error {
+	if len(fragments) == 0 {
+		return nil
+	}
+
+	// A section file is decoded as is, so errors report its line numbers
+	if len(fragments) == 1 && fragments[0].data != nil {
+		return decodeYAML(fragments[0].data, v, opts, path, secrets)
+	}
+
+	var merged *yaml.Node
+	for _, frag := range fragments {
+		node := frag.node
+		if node == nil {
+			var doc yaml.Node
+			if err := yaml.Unmarshal(frag.data, &doc); err != nil {
+				return fmt.Errorf("%s: %w", frag.file, err)
+			}
+			if doc.Kind == 0 || isNull(doc.Content[0]) {
+				continue
+			}
+			node = doc.Content[0]
+		}
+
+		if merged == nil {
+			merged = node
+			continue
+		}
+		if err := mergeFragment(merged, node, ""); err != nil {
+			return fmt.Errorf("%s: %w", frag.file, err)
+		}
+	}
+	if merged == nil {
+		return nil
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return decodeYAML(data, v, opts, path, secrets)
+}
+
+// mergeFragment merges src into dst: mappings are merged key by key and lists
+// are appended, while any other value may only be set once
+func mergeFragment(dst, src *yaml.Node, path string) error {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			existing := mappingValue(dst, key.Value)
+			if existing == nil {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+			if err := mergeFragment(existing, value, joinPath(path, key.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		dst.Content = append(dst.Content, src.Content...)
+		return nil
+	case isNull(src):
+		return nil
+	case isNull(dst):
+		*dst = *src
+		return nil
+	default:
+		return fmt.Errorf("line %d: %s is already set in another file", src.Line, path)
+	}
+}
+
+// isNull reports whether a node holds no value, such as an empty key
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// joinPath appends a key to a dotted path
+func joinPath(path, key string) string {
+	return strings.TrimPrefix(path+"."+key, ".")
+}
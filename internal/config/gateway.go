@@ -0,0 +1,874 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/kubernetes"
+	"go.uber.org/zap"
+)
+
+// Gateway API defaults
+const (
+	gatewayAPIVersion      = "gateway.networking.k8s.io/v1"
+	gatewayAPIGroup        = "gateway.networking.k8s.io"
+	defaultGatewayClass    = "sentinel"
+	defaultGatewayCertDir  = "./certs/gateway"
+	gatewayResyncInterval  = 5 * time.Minute
+	gatewayUpstreamPrefix  = "gateway/"
+	gatewayCertFilePrefix  = "gateway_"
+	gatewayDefaultPathType = "PathPrefix"
+)
+
+// GatewaySource loads configuration from Kubernetes Gateway API resources on
+// top of a base configuration directory. Gateways of the configured class
+// become listeners, the HTTPRoutes attached to them route rules, and their
+// backendRefs weighted upstream targets.
+type GatewaySource struct {
+	client    *kubernetes.Client
+	base      string
+	class     string
+	namespace string
+	certDir   string
+	opts      LoadOptions
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	digest  [sha256.Size]byte // of the last loaded configuration
+	timer   *time.Timer
+	watcher *Watcher
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+// NewGatewaySource creates a Gateway API configuration source from a URL of
+// the form gateway://[host:port]?base=./configs/default&class=sentinel.
+// Without a host the in-cluster service account is used.
+func NewGatewaySource(u *url.URL, opts LoadOptions, logger *zap.Logger) (*GatewaySource, error) {
+	query := u.Query()
+	server := ""
+	if u.Host != "" {
+		scheme := query.Get("scheme")
+		if scheme == "" {
+			scheme = "https"
+		}
+		server = fmt.Sprintf("%s://%s", scheme, u.Host)
+	}
+	client, err := kubernetes.NewClient(kubernetes.Options{Server: server, Token: query.Get("token"), CAFile: query.Get("ca")})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &GatewaySource{
+		client:    client,
+		base:      query.Get("base"),
+		class:     query.Get("class"),
+		namespace: query.Get("namespace"),
+		certDir:   query.Get("cert_dir"),
+		opts:      opts,
+		logger:    logger,
+	}
+	if s.base == "" {
+		return nil, fmt.Errorf("gateway source requires a base configuration directory, e.g. gateway://?base=./configs/default")
+	}
+	if s.class == "" {
+		s.class = defaultGatewayClass
+	}
+	if s.certDir == "" {
+		s.certDir = defaultGatewayCertDir
+	}
+	return s, nil
+}
+
+// Load loads the base configuration and adds the Gateway API resources
+func (s *GatewaySource) Load() (*Config, error) {
+	config, err := s.load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := configDigest(config)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.digest = digest
+	s.mu.Unlock()
+	return config, nil
+}
+
+// Watch watches the base directory and the Gateway API resources. Resource
+// events only trigger a reload when they change the resulting configuration,
+// and a periodic resync picks up rotated certificate secrets.
+func (s *GatewaySource) Watch(onChange func()) error {
+	watcher, err := NewWatcher(s.base, DefaultDebounce, s.logger, onChange)
+	if err != nil {
+		return err
+	}
+	if err := watcher.Start(); err != nil {
+		return err
+	}
+	s.watcher = watcher
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	changed := func() { s.schedule(ctx, onChange) }
+	for _, resource := range []string{"gateways", "httproutes"} {
+		path := kubernetes.CollectionPath(gatewayAPIVersion, resource, s.namespace)
+		s.done.Add(1)
+		go func() {
+			defer s.done.Done()
+			s.watchResource(ctx, path, changed)
+		}()
+	}
+
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		ticker := time.NewTicker(gatewayResyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				changed()
+			}
+		}
+	}()
+
+	s.logger.Info("Watching Gateway API resources for configuration changes",
+		zap.String("endpoint", s.client.Endpoint()),
+		zap.String("class", s.class),
+		zap.String("namespace", s.namespace))
+	return nil
+}
+
+// Stop stops watching
+func (s *GatewaySource) Stop() {
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+	if s.cancel != nil {
+		s.cancel()
+		s.done.Wait()
+	}
+
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.mu.Unlock()
+}
+
+// String describes the source
+func (s *GatewaySource) String() string {
+	return fmt.Sprintf("gateway %s class %s (base %s)", s.client.Endpoint(), s.class, s.base)
+}
+
+// watchResource lists and watches a collection, relisting whenever the watch
+// cannot be resumed
+func (s *GatewaySource) watchResource(ctx context.Context, path string, changed func()) {
+	resourceVersion := ""
+	for {
+		if resourceVersion == "" {
+			var items []json.RawMessage
+			rv, err := s.client.List(ctx, path, nil, &items)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Error("Failed to list Gateway API resources", zap.String("path", path), zap.Error(err))
+				if !sleepContext(ctx, kvRetryInterval) {
+					return
+				}
+				continue
+			}
+			resourceVersion = rv
+		}
+
+		rv, err := s.client.Watch(ctx, path, nil, resourceVersion, func(kubernetes.Event) { changed() })
+		if ctx.Err() != nil {
+			return
+		}
+		resourceVersion = rv
+		switch {
+		case err == kubernetes.ErrResourceExpired:
+			// Changes may have been missed
+			resourceVersion = ""
+			changed()
+		case err != nil:
+			s.logger.Error("Gateway API watch failed", zap.String("path", path), zap.Error(err))
+			if !sleepContext(ctx, kvRetryInterval) {
+				return
+			}
+		}
+	}
+}
+
+// schedule checks for configuration changes once resource events settle
+func (s *GatewaySource) schedule(ctx context.Context, onChange func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(DefaultDebounce, func() {
+		config, err := s.load(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Error("Failed to load Gateway API configuration", zap.Error(err))
+			}
+			return
+		}
+		digest, err := configDigest(config)
+		if err != nil {
+			s.logger.Error("Failed to compare Gateway API configuration", zap.Error(err))
+			return
+		}
+
+		s.mu.Lock()
+		unchanged := digest == s.digest
+		s.mu.Unlock()
+		if !unchanged {
+			s.logger.Info("Gateway API resources changed")
+			onChange()
+		}
+	})
+}
+
+// load builds the configuration from the base directory and the current
+// Gateway API resources
+func (s *GatewaySource) load(ctx context.Context) (*Config, error) {
+	config, err := LoadConfigWithOptions(s.base, s.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var gateways []gatewayResource
+	if _, err := s.client.List(ctx, kubernetes.CollectionPath(gatewayAPIVersion, "gateways", s.namespace), nil, &gateways); err != nil {
+		return nil, fmt.Errorf("failed to list gateways: %w", err)
+	}
+	var routes []httpRouteResource
+	if _, err := s.client.List(ctx, kubernetes.CollectionPath(gatewayAPIVersion, "httproutes", s.namespace), nil, &routes); err != nil {
+		return nil, fmt.Errorf("failed to list HTTP routes: %w", err)
+	}
+
+	if err := s.apply(ctx, config, gateways, routes); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// gatewayResource is a Gateway
+type gatewayResource struct {
+	Metadata kubernetes.Metadata `json:"metadata"`
+	Spec     struct {
+		GatewayClassName string            `json:"gatewayClassName"`
+		Listeners        []gatewayListener `json:"listeners"`
+	} `json:"spec"`
+}
+
+// gatewayListener is a listener of a Gateway
+type gatewayListener struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	TLS      *struct {
+		Mode            string       `json:"mode"`
+		CertificateRefs []gatewayRef `json:"certificateRefs"`
+	} `json:"tls"`
+	AllowedRoutes *struct {
+		Namespaces *struct {
+			From string `json:"from"`
+		} `json:"namespaces"`
+	} `json:"allowedRoutes"`
+}
+
+// gatewayRef references another resource: a parent Gateway, a backend or a
+// certificate secret
+type gatewayRef struct {
+	Group       *string         `json:"group"`
+	Kind        string          `json:"kind"`
+	Name        string          `json:"name"`
+	Namespace   string          `json:"namespace"`
+	SectionName string          `json:"sectionName"`
+	Port        int             `json:"port"`
+	Weight      *int            `json:"weight"`
+	Filters     json.RawMessage `json:"filters"`
+}
+
+// is reports whether the reference points to a resource of the given group
+// and kind, where an unset group and kind take the given defaults
+func (r *gatewayRef) is(group, kind, defaultGroup, defaultKind string) bool {
+	refGroup, refKind := defaultGroup, r.Kind
+	if r.Group != nil {
+		refGroup = *r.Group
+	}
+	if refKind == "" {
+		refKind = defaultKind
+	}
+	return refGroup == group && refKind == kind
+}
+
+// httpRouteResource is an HTTPRoute
+type httpRouteResource struct {
+	Metadata kubernetes.Metadata `json:"metadata"`
+	Spec     struct {
+		ParentRefs []gatewayRef    `json:"parentRefs"`
+		Hostnames  []string        `json:"hostnames"`
+		Rules      []httpRouteRule `json:"rules"`
+	} `json:"spec"`
+}
+
+// httpRouteRule is a rule of an HTTPRoute
+type httpRouteRule struct {
+	Matches     []httpRouteMatch  `json:"matches"`
+	Filters     []httpRouteFilter `json:"filters"`
+	BackendRefs []gatewayRef      `json:"backendRefs"`
+	Timeouts    *struct {
+		Request string `json:"request"`
+	} `json:"timeouts"`
+}
+
+// httpRouteMatch selects the requests a rule applies to
+type httpRouteMatch struct {
+	Path *struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"path"`
+	Headers     []json.RawMessage `json:"headers"`
+	QueryParams []json.RawMessage `json:"queryParams"`
+	Method      string            `json:"method"`
+}
+
+// httpRouteFilter modifies requests or responses of a rule
+type httpRouteFilter struct {
+	Type                   string `json:"type"`
+	ResponseHeaderModifier *struct {
+		Set    []httpHeader `json:"set"`
+		Add    []httpHeader `json:"add"`
+		Remove []string     `json:"remove"`
+	} `json:"responseHeaderModifier"`
+	URLRewrite *struct {
+		Hostname string `json:"hostname"`
+		Path     *struct {
+			Type               string `json:"type"`
+			ReplaceFullPath    string `json:"replaceFullPath"`
+			ReplacePrefixMatch string `json:"replacePrefixMatch"`
+		} `json:"path"`
+	} `json:"urlRewrite"`
+}
+
+// httpHeader is a header name and value
+type httpHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// attachedListener is a Gateway listener an HTTPRoute is attached to
+type attachedListener struct {
+	gateway  *gatewayResource
+	listener *gatewayListener
+}
+
+// apply maps the Gateways of the source's class to listeners and TLS
+// certificates and their HTTPRoutes to route rules and upstreams
+func (s *GatewaySource) apply(ctx context.Context, config *Config, gateways []gatewayResource, routes []httpRouteResource) error {
+	owned := make(map[string]*gatewayResource)
+	for i := range gateways {
+		gateway := &gateways[i]
+		if gateway.Spec.GatewayClassName == s.class {
+			owned[gateway.Metadata.Namespace+"/"+gateway.Metadata.Name] = gateway
+		}
+	}
+	if len(owned) == 0 {
+		s.logger.Warn("No Gateways found for gateway class", zap.String("class", s.class))
+		return nil
+	}
+
+	// Listeners
+	var httpPort, httpsPort int
+	for _, key := range sortedKeys(owned) {
+		gateway := owned[key]
+		for i := range gateway.Spec.Listeners {
+			listener := &gateway.Spec.Listeners[i]
+			var port *int
+			switch listener.Protocol {
+			case "HTTP":
+				port = &httpPort
+			case "HTTPS":
+				port = &httpsPort
+			default:
+				s.warn(gateway, listener, "unsupported listener protocol "+listener.Protocol)
+				continue
+			}
+			if *port != 0 && *port != listener.Port {
+				s.warn(gateway, listener, fmt.Sprintf("only one %s port is supported, using %d", listener.Protocol, *port))
+				continue
+			}
+			*port = listener.Port
+		}
+	}
+	if httpPort != 0 {
+		config.Global.Server.HTTPPort = httpPort
+	}
+	if httpsPort != 0 {
+		config.Global.Server.HTTPSPort = httpsPort
+		config.TLS.Enabled = true
+	}
+
+	// Routes
+	var rules []RouteRule
+	upstreams := make(map[string]UpstreamService)
+	listenerHosts := make(map[*gatewayListener][]string)
+	for i := range routes {
+		route := &routes[i]
+		attached := s.attach(route, owned)
+		if len(attached) == 0 {
+			continue
+		}
+
+		var hosts []string
+		for _, a := range attached {
+			matched := s.routeHosts(route, a)
+			hosts = appendUnique(hosts, matched...)
+			listenerHosts[a.listener] = appendUnique(listenerHosts[a.listener], matched...)
+		}
+		if len(hosts) == 0 {
+			s.logger.Warn("Skipping HTTPRoute without usable hostnames",
+				zap.String("route", route.Metadata.Namespace+"/"+route.Metadata.Name))
+			continue
+		}
+
+		for j := range route.Spec.Rules {
+			translated, upstreamName, upstream, err := s.translateRule(config, route, j)
+			if err != nil {
+				s.logger.Warn("Skipping HTTPRoute rule",
+					zap.String("route", route.Metadata.Namespace+"/"+route.Metadata.Name),
+					zap.Int("rule", j),
+					zap.Error(err))
+				continue
+			}
+			upstreams[upstreamName] = upstream
+			for _, host := range hosts {
+				for _, rule := range translated {
+					rule.Host = host
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+
+	// Gateway API gives precedence to exact paths, then longer prefixes, then
+	// rules matching methods; routes are matched in order
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		aPrefix, bPrefix := strings.HasSuffix(a.Path, "/*"), strings.HasSuffix(b.Path, "/*")
+		if aPrefix != bPrefix {
+			return !aPrefix
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) > len(b.Path)
+		}
+		return len(a.Methods) > len(b.Methods)
+	})
+	config.Routes.Rules = append(config.Routes.Rules, rules...)
+
+	if config.Upstreams.Services == nil {
+		config.Upstreams.Services = make(map[string]UpstreamService)
+	}
+	for name, upstream := range upstreams {
+		config.Upstreams.Services[name] = upstream
+	}
+
+	// Certificates of HTTPS listeners
+	return s.applyCertificates(ctx, config, owned, listenerHosts)
+}
+
+// attach returns the listeners of owned Gateways an HTTPRoute attaches to
+func (s *GatewaySource) attach(route *httpRouteResource, owned map[string]*gatewayResource) []attachedListener {
+	var attached []attachedListener
+	for _, ref := range route.Spec.ParentRefs {
+		if !ref.is(gatewayAPIGroup, "Gateway", gatewayAPIGroup, "Gateway") {
+			continue
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = route.Metadata.Namespace
+		}
+		gateway, ok := owned[namespace+"/"+ref.Name]
+		if !ok {
+			continue
+		}
+
+		for i := range gateway.Spec.Listeners {
+			listener := &gateway.Spec.Listeners[i]
+			if ref.SectionName != "" && ref.SectionName != listener.Name {
+				continue
+			}
+			if ref.Port != 0 && ref.Port != listener.Port {
+				continue
+			}
+			if listener.Protocol != "HTTP" && listener.Protocol != "HTTPS" {
+				continue
+			}
+
+			from := "Same"
+			if listener.AllowedRoutes != nil && listener.AllowedRoutes.Namespaces != nil && listener.AllowedRoutes.Namespaces.From != "" {
+				from = listener.AllowedRoutes.Namespaces.From
+			}
+			switch {
+			case from == "All":
+			case from == "Same" && route.Metadata.Namespace == gateway.Metadata.Namespace:
+			case from == "Selector":
+				s.warn(gateway, listener, "namespace selectors for allowed routes are not supported")
+				continue
+			default:
+				continue
+			}
+			attached = append(attached, attachedListener{gateway: gateway, listener: listener})
+		}
+	}
+	return attached
+}
+
+// routeHosts returns the hosts of an HTTPRoute that a listener accepts.
+// Wildcard hosts cannot be routed and are skipped.
+func (s *GatewaySource) routeHosts(route *httpRouteResource, a attachedListener) []string {
+	listenerHost := a.listener.Hostname
+	if len(route.Spec.Hostnames) == 0 {
+		if listenerHost == "" || strings.HasPrefix(listenerHost, "*.") {
+			return nil
+		}
+		return []string{listenerHost}
+	}
+
+	var hosts []string
+	for _, host := range route.Spec.Hostnames {
+		switch {
+		case strings.HasPrefix(host, "*."):
+			// A wildcard route host still covers an exact listener host
+			if listenerHost != "" && !strings.HasPrefix(listenerHost, "*.") && wildcardMatches(host, listenerHost) {
+				hosts = append(hosts, listenerHost)
+			} else {
+				s.logger.Warn("Skipping wildcard HTTPRoute hostname",
+					zap.String("route", route.Metadata.Namespace+"/"+route.Metadata.Name),
+					zap.String("hostname", host))
+			}
+		case listenerHost == "" || host == listenerHost || (strings.HasPrefix(listenerHost, "*.") && wildcardMatches(listenerHost, host)):
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// translateRule maps an HTTPRoute rule to route rules without hosts and the
+// upstream they use
+func (s *GatewaySource) translateRule(config *Config, route *httpRouteResource, index int) ([]RouteRule, string, UpstreamService, error) {
+	rule := &route.Spec.Rules[index]
+	namespace := route.Metadata.Namespace
+
+	var template RouteRule
+	if rule.Timeouts != nil && rule.Timeouts.Request != "" {
+		timeout, err := time.ParseDuration(rule.Timeouts.Request)
+		if err != nil {
+			return nil, "", UpstreamService{}, fmt.Errorf("invalid request timeout %q: %w", rule.Timeouts.Request, err)
+		}
+		template.Timeout = timeout
+	}
+
+	var rewrite *httpRouteFilter
+	for i := range rule.Filters {
+		filter := &rule.Filters[i]
+		switch {
+		case filter.Type == "ResponseHeaderModifier" && filter.ResponseHeaderModifier != nil:
+			modifier := filter.ResponseHeaderModifier
+			if len(modifier.Remove) > 0 {
+				return nil, "", UpstreamService{}, fmt.Errorf("removing response headers is not supported")
+			}
+			if template.Headers == nil {
+				template.Headers = make(map[string]string)
+			}
+			for _, header := range append(modifier.Add, modifier.Set...) {
+				template.Headers[header.Name] = header.Value
+			}
+		case filter.Type == "URLRewrite" && filter.URLRewrite != nil:
+			if filter.URLRewrite.Hostname != "" {
+				return nil, "", UpstreamService{}, fmt.Errorf("rewriting the hostname is not supported")
+			}
+			rewrite = filter
+		default:
+			return nil, "", UpstreamService{}, fmt.Errorf("filter %s is not supported", filter.Type)
+		}
+	}
+
+	upstreamName, upstream, err := s.translateBackends(config, route, index)
+	if err != nil {
+		return nil, "", UpstreamService{}, err
+	}
+	template.Upstream = upstreamName
+
+	matches := rule.Matches
+	if len(matches) == 0 {
+		matches = []httpRouteMatch{{}}
+	}
+	var rules []RouteRule
+	for _, match := range matches {
+		if len(match.Headers) > 0 || len(match.QueryParams) > 0 {
+			s.logger.Warn("Skipping HTTPRoute match on headers or query parameters",
+				zap.String("route", namespace+"/"+route.Metadata.Name),
+				zap.Int("rule", index))
+			continue
+		}
+
+		pathType, value := gatewayDefaultPathType, "/"
+		if match.Path != nil {
+			if match.Path.Type != "" {
+				pathType = match.Path.Type
+			}
+			if match.Path.Value != "" {
+				value = match.Path.Value
+			}
+		}
+
+		translated := template
+		prefix := strings.TrimSuffix(value, "/")
+		switch pathType {
+		case "Exact":
+			translated.Path = value
+		case "PathPrefix":
+			translated.Path = prefix + "/*"
+		default:
+			s.logger.Warn("Skipping HTTPRoute match with unsupported path type",
+				zap.String("route", namespace+"/"+route.Metadata.Name),
+				zap.Int("rule", index),
+				zap.String("type", pathType))
+			continue
+		}
+		if match.Method != "" {
+			translated.Methods = []string{match.Method}
+		}
+
+		if rewrite != nil && rewrite.URLRewrite.Path != nil {
+			switch path := rewrite.URLRewrite.Path; path.Type {
+			case "ReplaceFullPath":
+				translated.Rewrite = RewriteConfig{Regex: "^.*$", Replacement: path.ReplaceFullPath}
+			case "ReplacePrefixMatch":
+				if pathType != "PathPrefix" {
+					return nil, "", UpstreamService{}, fmt.Errorf("ReplacePrefixMatch requires a PathPrefix match")
+				}
+				translated.Rewrite = RewriteConfig{StripPrefix: prefix, AddPrefix: strings.TrimSuffix(path.ReplacePrefixMatch, "/")}
+			default:
+				return nil, "", UpstreamService{}, fmt.Errorf("path rewrite %s is not supported", path.Type)
+			}
+		}
+
+		rules = append(rules, translated)
+	}
+	if len(rules) == 0 {
+		return nil, "", UpstreamService{}, fmt.Errorf("no supported matches")
+	}
+	return rules, upstreamName, upstream, nil
+}
+
+// translateBackends maps the backendRefs of an HTTPRoute rule to an upstream
+// service whose target weights split traffic between the backends. Rules
+// with the same backends share an upstream.
+func (s *GatewaySource) translateBackends(config *Config, route *httpRouteResource, index int) (string, UpstreamService, error) {
+	namespace := route.Metadata.Namespace
+	weights := make(map[string]int)
+	for _, ref := range route.Spec.Rules[index].BackendRefs {
+		if !ref.is("", "Service", "", "Service") {
+			return "", UpstreamService{}, fmt.Errorf("backend %s of kind %s is not supported", ref.Name, ref.Kind)
+		}
+		if ref.Namespace != "" && ref.Namespace != namespace {
+			return "", UpstreamService{}, fmt.Errorf("backend %s/%s is in another namespace", ref.Namespace, ref.Name)
+		}
+		if ref.Port == 0 {
+			return "", UpstreamService{}, fmt.Errorf("backend %s has no port", ref.Name)
+		}
+		if len(ref.Filters) > 0 && string(ref.Filters) != "null" && string(ref.Filters) != "[]" {
+			return "", UpstreamService{}, fmt.Errorf("backend filters are not supported")
+		}
+
+		weight := 1
+		if ref.Weight != nil {
+			weight = *ref.Weight
+		}
+		if weight > 0 {
+			weights[fmt.Sprintf("http://%s.%s.svc:%d", ref.Name, namespace, ref.Port)] += weight
+		}
+	}
+	if len(weights) == 0 {
+		return "", UpstreamService{}, fmt.Errorf("no backends with a non-zero weight")
+	}
+
+	upstream := UpstreamService{
+		LoadBalancer: config.Upstreams.Defaults.LoadBalancer,
+		HealthCheck:  config.Upstreams.Defaults.HealthCheck,
+	}
+	if upstream.LoadBalancer == "" {
+		upstream.LoadBalancer = "round_robin"
+	}
+	var names []string
+	for _, targetURL := range sortedKeys(weights) {
+		upstream.Targets = append(upstream.Targets, Target{URL: targetURL, Weight: weights[targetURL]})
+		names = append(names, strings.TrimPrefix(targetURL, "http://")+"="+strconv.Itoa(weights[targetURL]))
+	}
+
+	if len(upstream.Targets) > 1 {
+		// Only round robin honors the weights that split traffic
+		upstream.LoadBalancer = "round_robin"
+	}
+
+	name := gatewayUpstreamPrefix + strings.Join(names, ",")
+	if len(upstream.Targets) == 1 {
+		name = gatewayUpstreamPrefix + strings.TrimPrefix(upstream.Targets[0].URL, "http://")
+		upstream.Targets[0].Weight = 0
+	}
+	return name, upstream, nil
+}
+
+// applyCertificates writes the certificate secrets of HTTPS listeners to the
+// certificate directory and adds them to the TLS configuration. File names
+// carry a content hash, so rotated secrets are reloaded.
+func (s *GatewaySource) applyCertificates(ctx context.Context, config *Config, owned map[string]*gatewayResource, listenerHosts map[*gatewayListener][]string) error {
+	written := make(map[string]bool)
+	for _, key := range sortedKeys(owned) {
+		gateway := owned[key]
+		for i := range gateway.Spec.Listeners {
+			listener := &gateway.Spec.Listeners[i]
+			if listener.Protocol != "HTTPS" {
+				continue
+			}
+			if listener.TLS == nil || (listener.TLS.Mode != "" && listener.TLS.Mode != "Terminate") || len(listener.TLS.CertificateRefs) == 0 {
+				s.warn(gateway, listener, "HTTPS listeners need TLS mode Terminate with a certificate reference")
+				continue
+			}
+
+			hosts := listenerHosts[listener]
+			if listener.Hostname != "" && !strings.HasPrefix(listener.Hostname, "*.") {
+				hosts = []string{listener.Hostname}
+			}
+			if len(hosts) == 0 {
+				s.warn(gateway, listener, "no hosts for the listener's certificate")
+				continue
+			}
+
+			for _, ref := range listener.TLS.CertificateRefs {
+				certFile, keyFile, err := s.writeCertificate(ctx, gateway, ref)
+				if err != nil {
+					s.warn(gateway, listener, err.Error())
+					continue
+				}
+				written[filepath.Base(certFile)], written[filepath.Base(keyFile)] = true, true
+				config.TLS.Certificates = append(config.TLS.Certificates, CertificateConfig{
+					Hosts:    hosts,
+					CertFile: certFile,
+					KeyFile:  keyFile,
+				})
+			}
+		}
+	}
+
+	// Remove certificates of rotated or deleted secrets
+	entries, err := os.ReadDir(s.certDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read certificate directory: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), gatewayCertFilePrefix) && !written[entry.Name()] {
+			os.Remove(filepath.Join(s.certDir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// writeCertificate fetches a kubernetes.io/tls secret and writes its
+// certificate and key
+func (s *GatewaySource) writeCertificate(ctx context.Context, gateway *gatewayResource, ref gatewayRef) (string, string, error) {
+	if !ref.is("", "Secret", "", "Secret") {
+		return "", "", fmt.Errorf("certificate reference %s of kind %s is not supported", ref.Name, ref.Kind)
+	}
+	namespace := gateway.Metadata.Namespace
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		return "", "", fmt.Errorf("certificate secret %s/%s is in another namespace", ref.Namespace, ref.Name)
+	}
+
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := s.client.Get(ctx, kubernetes.ObjectPath("v1", "secrets", namespace, ref.Name), &secret); err != nil {
+		return "", "", fmt.Errorf("failed to read certificate secret %s/%s: %w", namespace, ref.Name, err)
+	}
+	cert, key := secret.Data["tls.crt"], secret.Data["tls.key"]
+	if len(cert) == 0 || len(key) == 0 {
+		return "", "", fmt.Errorf("certificate secret %s/%s has no tls.crt or tls.key", namespace, ref.Name)
+	}
+
+	if err := os.MkdirAll(s.certDir, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	sum := sha256.Sum256(append(append([]byte{}, cert...), key...))
+	name := fmt.Sprintf("%s%s_%s_%x", gatewayCertFilePrefix, namespace, ref.Name, sum[:4])
+	certFile := filepath.Join(s.certDir, name+".crt")
+	keyFile := filepath.Join(s.certDir, name+".key")
+	if err := os.WriteFile(certFile, cert, 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	return certFile, keyFile, nil
+}
+
+// warn logs a problem with a Gateway listener
+func (s *GatewaySource) warn(gateway *gatewayResource, listener *gatewayListener, message string) {
+	s.logger.Warn("Ignoring Gateway listener",
+		zap.String("gateway", gateway.Metadata.Namespace+"/"+gateway.Metadata.Name),
+		zap.String("listener", listener.Name),
+		zap.String("reason", message))
+}
+
+// wildcardMatches reports whether a host matches a *.domain wildcard, which
+// covers at least one label
+func wildcardMatches(wildcard, host string) bool {
+	suffix := strings.TrimPrefix(wildcard, "*")
+	return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+}
+
+// appendUnique appends the values not yet in list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// configDigest hashes a configuration to detect changes
+func configDigest(config *Config) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return sha256.Sum256(data), nil
+}
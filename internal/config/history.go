@@ -0,0 +1,112 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot is a configuration that was applied at runtime
+type Snapshot struct {
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+	AppliedAt time.Time `json:"applied_at"`
+	Reason    string    `json:"reason"`
+	Config    *Config   `json:"-"`
+}
+
+// History keeps the most recently applied configurations
+type History struct {
+	limit     int
+	next      int
+	snapshots []*Snapshot
+	mu        sync.RWMutex
+}
+
+// NewHistory creates a history that retains up to limit snapshots
+func NewHistory(limit int) *History {
+	if limit < 1 {
+		limit = 1
+	}
+	return &History{
+		limit: limit,
+		next:  1,
+	}
+}
+
+// Record stores an applied configuration and returns its snapshot
+func (h *History) Record(cfg *Config, reason string) *Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := &Snapshot{
+		Version:   h.next,
+		Hash:      Hash(cfg),
+		AppliedAt: time.Now(),
+		Reason:    reason,
+		Config:    cfg,
+	}
+	h.next++
+
+	h.snapshots = append(h.snapshots, snapshot)
+	if len(h.snapshots) > h.limit {
+		h.snapshots = h.snapshots[len(h.snapshots)-h.limit:]
+	}
+
+	return snapshot
+}
+
+// List returns the retained snapshots, oldest first
+func (h *History) List() []*Snapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]*Snapshot, len(h.snapshots))
+	copy(result, h.snapshots)
+	return result
+}
+
+// Get returns the snapshot with the given version
+func (h *History) Get(version int) (*Snapshot, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, snapshot := range h.snapshots {
+		if snapshot.Version == version {
+			return snapshot, true
+		}
+	}
+	return nil, false
+}
+
+// Current returns the most recently applied snapshot
+func (h *History) Current() *Snapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.snapshots) == 0 {
+		return nil
+	}
+	return h.snapshots[len(h.snapshots)-1]
+}
+
+// Hash returns a content hash of a configuration. Secrets count by their
+// references, so hashes agree across processes and replicas and never reveal
+// secrets; use Unchanged to also tell apart rotated secrets.
+func Hash(cfg *Config) string {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Unchanged reports whether two configurations are the same, including the
+// secrets their references resolved to
+func Unchanged(a, b *Config) bool {
+	return Hash(a) == Hash(b) && a.secrets.equal(b.secrets)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// htpasswdPrefixes are the prefixes of the supported password hashes: bcrypt
+// and Apache MD5
+var htpasswdPrefixes = []string{"$2a$", "$2b$", "$2y$", "$apr1$"}
+
+// ParseHtpasswd parses htpasswd entries, one user:hash per line, into the
+// hashes by user. Blank lines and lines starting with # are ignored.
+func ParseHtpasswd(data string) (map[string]string, error) {
+	users := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", i+1)
+		}
+		supported := false
+		for _, prefix := range htpasswdPrefixes {
+			if strings.HasPrefix(hash, prefix) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("line %d: unsupported hash for user %s, use bcrypt (htpasswd -B) or MD5 (htpasswd -m)", i+1, user)
+		}
+		if _, exists := users[user]; exists {
+			return nil, fmt.Errorf("line %d: duplicate user %s", i+1, user)
+		}
+		users[user] = hash
+	}
+	return users, nil
+}
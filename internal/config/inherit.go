@@ -0,0 +1,86 @@
+package config
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// defaultsKey is the document key holding inherited settings
+const defaultsKey = "defaults"
+
+// inheritDefaults copies settings from the document's defaults block into each
+// entry of the collection stored under collectionKey. Merging happens on the
+// YAML tree so that only keys absent from an entry are inherited; explicitly
+// set values, including false and empty lists, always win. It reports whether
+// there were defaults to inherit.
+func inheritDefaults(doc *yaml.Node, collectionKey string) bool {
+	root := doc
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return false
+		}
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return false
+	}
+
+	defaults := mappingValue(root, defaultsKey)
+	collection := mappingValue(root, collectionKey)
+	if defaults == nil || collection == nil || defaults.Kind != yaml.MappingNode {
+		return false
+	}
+
+	switch collection.Kind {
+	case yaml.SequenceNode:
+		for _, entry := range collection.Content {
+			mergeNode(entry, defaults)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(collection.Content); i += 2 {
+			mergeNode(collection.Content[i], defaults)
+		}
+	}
+	return true
+}
+
+// mergeNode adds keys from src that are missing in dst, recursing into nested
+// mappings present in both
+func mergeNode(dst, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		existing := mappingValue(dst, key.Value)
+		if existing == nil {
+			dst.Content = append(dst.Content, copyNode(key), copyNode(value))
+			continue
+		}
+		if existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeNode(existing, value)
+		}
+	}
+}
+
+// mappingValue returns the value stored under key in a mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// copyNode deep-copies a YAML node so merged entries don't share state
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	if len(node.Content) > 0 {
+		copied.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			copied.Content[i] = copyNode(child)
+		}
+	}
+	return &copied
+}
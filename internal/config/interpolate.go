@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolateEnv expands environment variable references in the scalar
+// values of a YAML tree at path and reports whether any value was expanded,
+// e.g.
+//
+//	jwt_secret: ${JWT_SECRET}
+//	email: ${ACME_EMAIL:-admin@example.com}
+//
+// A value that consists of a single reference takes the type of its result,
+// so references can produce numbers, booleans and durations. Expanded values
+// are recorded in secrets like secret references, as variables often carry
+// secrets.
+func interpolateEnv(node *yaml.Node, path string, secrets secretReferences) (bool, error) {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") {
+			return false, nil
+		}
+
+		expanded, err := expandEnv(node.Value)
+		if err != nil {
+			return false, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		if expanded != node.Value {
+			secrets.record(path, node.Value, expanded)
+		}
+
+		trimmed := strings.TrimSpace(node.Value)
+		if strings.HasPrefix(trimmed, "${") && strings.Index(trimmed, "}") == len(trimmed)-1 {
+			// Let the result's type be inferred instead of forcing a string
+			node.Tag = ""
+			node.Style = 0
+		}
+		node.Value = expanded
+		return true, nil
+	}
+
+	changed := false
+	for i, child := range node.Content {
+		// Keys are never interpolated
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		childChanged, err := interpolateEnv(child, childPath(node, i, path), secrets)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || childChanged
+	}
+	return changed, nil
+}
+
+// childPath returns the dotted path of the i-th child of a node at path
+func childPath(node *yaml.Node, i int, path string) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return joinPath(path, node.Content[i-1].Value)
+	case yaml.SequenceNode:
+		return joinPath(path, strconv.Itoa(i))
+	}
+	return path
+}
+
+// expandEnv replaces ${NAME} with the value of an environment variable, which
+// must be set, and ${NAME:-default} with its value or default when it is
+// unset or empty. $${ stands for a literal ${; a $ not followed by { and
+// references that are not variable names are kept as is.
+func expandEnv(value string) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			out.WriteString(value)
+			return out.String(), nil
+		}
+		if start > 0 && value[start-1] == '$' {
+			out.WriteString(value[:start-1])
+			out.WriteString("${")
+			value = value[start+2:]
+			continue
+		}
+		out.WriteString(value[:start])
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", value[start:])
+		}
+		reference := value[start+2 : start+end]
+		value = value[start+end+1:]
+
+		// Other references, such as the ${1} of regex replacements, are kept
+		name, def, hasDefault := strings.Cut(reference, ":-")
+		if !isEnvName(name) {
+			out.WriteString("${" + reference + "}")
+			continue
+		}
+		env, set := os.LookupEnv(name)
+		switch {
+		case hasDefault && env == "":
+			env = def
+		case !set:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		out.WriteString(env)
+	}
+}
+
+// isEnvName reports whether name is a valid environment variable name
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,424 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// kvRetryInterval is how long KV sources wait before retrying a failed watch
+const kvRetryInterval = 5 * time.Second
+
+// ConsulSource loads configuration from Consul KV. Each configuration section
+// is stored as a YAML document under <prefix>/<section>, e.g.
+// sentinel/routes.
+type ConsulSource struct {
+	endpoint string
+	prefix   string
+	token    string
+	opts     LoadOptions
+	client   *http.Client
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewConsulSource creates a Consul KV configuration source from a URL of the
+// form consul://host:port/prefix[?token=...&scheme=https]
+func NewConsulSource(u *url.URL, opts LoadOptions, logger *zap.Logger) *ConsulSource {
+	scheme := u.Query().Get("scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	token := u.Query().Get("token")
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	return &ConsulSource{
+		endpoint: fmt.Sprintf("%s://%s", scheme, u.Host),
+		prefix:   strings.Trim(u.Path, "/"),
+		token:    token,
+		opts:     opts,
+		client:   &http.Client{},
+		logger:   logger,
+	}
+}
+
+// consulKVPair is a single entry returned by the Consul KV API
+type consulKVPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+// Load loads the configuration from Consul
+func (s *ConsulSource) Load() (*Config, error) {
+	pairs, _, err := s.fetch(context.Background(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		data[pair.Key] = pair.Value
+	}
+
+	return LoadConfigFromData(sectionData(s.prefix, data), s.opts)
+}
+
+// Watch uses Consul blocking queries to detect changes below the prefix
+func (s *ConsulSource) Watch(onChange func()) error {
+	_, index, err := s.fetch(context.Background(), 0)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		for {
+			_, newIndex, err := s.fetch(ctx, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Error("Consul watch failed", zap.Error(err))
+				if !sleepContext(ctx, kvRetryInterval) {
+					return
+				}
+				continue
+			}
+
+			// The index going backwards means the store was reset
+			if newIndex < index {
+				index = 0
+				continue
+			}
+			if newIndex > index {
+				index = newIndex
+				s.logger.Info("Configuration changed in Consul", zap.Uint64("index", index))
+				onChange()
+			}
+		}
+	}()
+
+	s.logger.Info("Watching Consul for configuration changes",
+		zap.String("endpoint", s.endpoint),
+		zap.String("prefix", s.prefix))
+	return nil
+}
+
+// Stop stops watching Consul
+func (s *ConsulSource) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// String describes the source
+func (s *ConsulSource) String() string {
+	return fmt.Sprintf("consul %s/%s", s.endpoint, s.prefix)
+}
+
+// fetch reads all keys below the prefix. A non-zero index turns the request
+// into a blocking query that returns once the index changes.
+func (s *ConsulSource) fetch(ctx context.Context, index uint64) ([]consulKVPair, uint64, error) {
+	query := url.Values{}
+	query.Set("recurse", "true")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", "5m")
+	}
+
+	reqURL := fmt.Sprintf("%s/v1/kv/%s/?%s", s.endpoint, s.prefix, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query consul: %w", err)
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, newIndex, fmt.Errorf("no configuration found under consul prefix %q", s.prefix)
+	default:
+		return nil, newIndex, fmt.Errorf("consul returned status %d", resp.StatusCode)
+	}
+
+	var pairs []consulKVPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, newIndex, fmt.Errorf("failed to decode consul response: %w", err)
+	}
+
+	return pairs, newIndex, nil
+}
+
+// EtcdSource loads configuration from etcd using the v3 JSON gateway. Each
+// configuration section is stored as a YAML document under <prefix>/<section>.
+type EtcdSource struct {
+	endpoint string
+	prefix   string
+	opts     LoadOptions
+	client   *http.Client
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewEtcdSource creates an etcd configuration source from a URL of the form
+// etcd://host:port/prefix[?scheme=https]
+func NewEtcdSource(u *url.URL, opts LoadOptions, logger *zap.Logger) *EtcdSource {
+	scheme := u.Query().Get("scheme")
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return &EtcdSource{
+		endpoint: fmt.Sprintf("%s://%s", scheme, u.Host),
+		prefix:   strings.Trim(u.Path, "/"),
+		opts:     opts,
+		client:   &http.Client{},
+		logger:   logger,
+	}
+}
+
+// etcdRangeRequest is the body of a v3 range or watch create request
+type etcdRangeRequest struct {
+	Key           []byte `json:"key"`
+	RangeEnd      []byte `json:"range_end"`
+	StartRevision int64  `json:"start_revision,omitempty,string"`
+}
+
+// etcdHeader is the response header returned by etcd
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// etcdKeyValue is a single entry returned by etcd
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// etcdRangeResponse is the response of a v3 range request
+type etcdRangeResponse struct {
+	Header etcdHeader     `json:"header"`
+	KVs    []etcdKeyValue `json:"kvs"`
+}
+
+// etcdWatchResponse is a single message of a v3 watch stream
+type etcdWatchResponse struct {
+	Result struct {
+		Header  etcdHeader        `json:"header"`
+		Created bool              `json:"created"`
+		Events  []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Load loads the configuration from etcd
+func (s *EtcdSource) Load() (*Config, error) {
+	resp, err := s.rangePrefix(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]byte, len(resp.KVs))
+	for _, kv := range resp.KVs {
+		data[string(kv.Key)] = kv.Value
+	}
+
+	return LoadConfigFromData(sectionData(s.prefix, data), s.opts)
+}
+
+// Watch opens an etcd watch stream on the prefix and reconnects on failure
+func (s *EtcdSource) Watch(onChange func()) error {
+	resp, err := s.rangePrefix(context.Background())
+	if err != nil {
+		return err
+	}
+	revision := resp.Header.Revision
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		for {
+			err := s.watch(ctx, revision+1, func(rev int64) {
+				revision = rev
+				s.logger.Info("Configuration changed in etcd", zap.Int64("revision", rev))
+				onChange()
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("etcd watch failed", zap.Error(err))
+			if !sleepContext(ctx, kvRetryInterval) {
+				return
+			}
+		}
+	}()
+
+	s.logger.Info("Watching etcd for configuration changes",
+		zap.String("endpoint", s.endpoint),
+		zap.String("prefix", s.prefix))
+	return nil
+}
+
+// Stop stops watching etcd
+func (s *EtcdSource) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// String describes the source
+func (s *EtcdSource) String() string {
+	return fmt.Sprintf("etcd %s/%s", s.endpoint, s.prefix)
+}
+
+// keyRange returns the key range covering everything below the prefix
+func (s *EtcdSource) keyRange() etcdRangeRequest {
+	key := []byte(s.prefix + "/")
+	rangeEnd := make([]byte, len(key))
+	copy(rangeEnd, key)
+	rangeEnd[len(rangeEnd)-1]++
+	return etcdRangeRequest{Key: key, RangeEnd: rangeEnd}
+}
+
+// rangePrefix reads all keys below the prefix
+func (s *EtcdSource) rangePrefix(ctx context.Context) (*etcdRangeResponse, error) {
+	body, err := json.Marshal(s.keyRange())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query etcd: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("etcd returned status %d", resp.StatusCode)
+	}
+
+	var rangeResp etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rangeResp); err != nil {
+		return nil, fmt.Errorf("failed to decode etcd response: %w", err)
+	}
+
+	if len(rangeResp.KVs) == 0 {
+		return nil, fmt.Errorf("no configuration found under etcd prefix %q", s.prefix)
+	}
+
+	return &rangeResp, nil
+}
+
+// watch streams watch events starting at the given revision until the stream
+// breaks or the context is cancelled
+func (s *EtcdSource) watch(ctx context.Context, startRevision int64, onEvents func(revision int64)) error {
+	createReq := s.keyRange()
+	createReq.StartRevision = startRevision
+	body, err := json.Marshal(map[string]any{"create_request": createReq})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/v3/watch", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to open etcd watch: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd returned status %d", resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err := decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("etcd watch stream closed: %w", err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd watch error: %s", msg.Error.Message)
+		}
+		if len(msg.Result.Events) > 0 {
+			onEvents(msg.Result.Header.Revision)
+		}
+	}
+}
+
+// sectionData maps KV entries below a prefix to configuration section names.
+// Keys may optionally carry a .yaml or .yml suffix.
+func sectionData(prefix string, entries map[string][]byte) map[string][]byte {
+	data := make(map[string][]byte, len(entries))
+	for key, value := range entries {
+		name := strings.TrimPrefix(key, prefix+"/")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".yaml"), ".yml")
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		data[name] = value
+	}
+	return data
+}
+
+// sleepContext sleeps for the given duration and reports whether the context
+// is still active afterwards
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/router"
+)
+
+// Lint rule identifiers
+const (
+	LintUnusedUpstream       = "unused-upstream"
+	LintUnknownMiddleware    = "unknown-middleware"
+	LintUnknownOption        = "unknown-middleware-option"
+	LintDisabledMiddleware   = "disabled-middleware"
+	LintDuplicateMiddleware  = "duplicate-middleware"
+	LintDuplicateTarget      = "duplicate-target"
+	LintStripPrefixMismatch  = "strip-prefix-mismatch"
+	LintShadowedRoute        = "shadowed-route"
+	LintRetryNonIdempotent   = "retry-non-idempotent"
+	LintRouteTimeout         = "route-timeout"
+	LintHealthCheckTimeout   = "health-check-timeout"
+	LintInsecureUpstream     = "insecure-upstream"
+	LintUnverifiedClientCert = "unverified-client-cert"
+	LintRedirectWithoutTLS   = "redirect-without-tls"
+)
+
+// LintWarning is a likely mistake in a configuration that is nevertheless valid
+type LintWarning struct {
+	File    string
+	Rule    string
+	Message string
+}
+
+// String formats the warning for display
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s [%s]", w.File, w.Message, w.Rule)
+}
+
+// Lint checks a valid configuration for suspicious settings
+func Lint(config *Config) []LintWarning {
+	var warnings []LintWarning
+	warn := func(file, rule, format string, args ...any) {
+		warnings = append(warnings, LintWarning{File: file, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if config.Global.Server.RedirectHTTPToHTTPS.Enabled && !config.TLS.Enabled {
+		warn("global.yaml", LintRedirectWithoutTLS, "HTTP requests are redirected to HTTPS, but TLS is disabled")
+	}
+
+	lintMiddleware(config, warn)
+	lintUpstreams(config, warn)
+	lintRoutes(config, warn)
+
+	return warnings
+}
+
+// lintMiddleware checks middleware definitions for options their type does
+// not have, which strict loading rejects
+func lintMiddleware(config *Config, warn func(file, rule, format string, args ...any)) {
+	for _, mw := range config.Middleware.Chain {
+		if unknown := unknownMiddlewareKeys(mw.Type, mw.Config); len(unknown) > 0 {
+			warn("middleware.yaml", LintUnknownOption, "middleware '%s' has unknown option(s) %s, which are ignored", mw.Name, strings.Join(unknown, ", "))
+		}
+	}
+}
+
+// lintUpstreams checks upstream services
+func lintUpstreams(config *Config, warn func(file, rule, format string, args ...any)) {
+	used := make(map[string]bool)
+	for _, rule := range config.Routes.Rules {
+		used[rule.Upstream] = true
+		if rule.Mirror != nil {
+			used[rule.Mirror.Upstream] = true
+		}
+	}
+
+	owners := make(map[string]string)
+	for _, name := range sortedKeys(config.Upstreams.Services) {
+		service := config.Upstreams.Services[name]
+
+		if !used[name] {
+			warn("upstreams.yaml", LintUnusedUpstream, "upstream service '%s' is not referenced by any route", name)
+		}
+
+		for _, target := range service.AllTargets() {
+			url := strings.TrimRight(target.URL, "/")
+			if owner, exists := owners[url]; exists {
+				if owner == name {
+					warn("upstreams.yaml", LintDuplicateTarget, "upstream service '%s' lists target %s more than once", name, target.URL)
+				} else {
+					warn("upstreams.yaml", LintDuplicateTarget, "target %s is shared by upstream services '%s' and '%s'", target.URL, owner, name)
+				}
+				continue
+			}
+			owners[url] = name
+		}
+
+		if service.TLS != nil && service.TLS.InsecureSkipVerify {
+			warn("upstreams.yaml", LintInsecureUpstream, "upstream service '%s' does not verify the certificates of its targets", name)
+		}
+
+		hc := service.HealthCheck
+		if hc.Enabled && hc.Interval > 0 && hc.Timeout >= hc.Interval {
+			warn("upstreams.yaml", LintHealthCheckTimeout, "upstream service '%s' health check timeout %v is not shorter than its interval %v", name, hc.Timeout, hc.Interval)
+		}
+	}
+}
+
+// lintRoutes checks route rules
+func lintRoutes(config *Config, warn func(file, rule, format string, args ...any)) {
+	middleware := make(map[string]MiddlewareChain)
+	for _, mw := range config.Middleware.Chain {
+		middleware[mw.Name] = mw
+	}
+
+	for i, rule := range config.Routes.Rules {
+		for _, ref := range rule.Middleware {
+			name := ref.Name
+			mw, exists := middleware[name]
+			switch {
+			case !exists:
+				warn("routes.yaml", LintUnknownMiddleware, "route rule %d references unknown middleware '%s'", i, name)
+				continue
+			case !mw.Enabled:
+				warn("routes.yaml", LintDisabledMiddleware, "route rule %d references disabled middleware '%s'", i, name)
+			default:
+				// Enabled middleware already runs for every request
+				warn("routes.yaml", LintDuplicateMiddleware, "route rule %d references middleware '%s' which already runs globally, so it is applied twice", i, name)
+			}
+			if unknown := unknownMiddlewareKeys(mw.Type, ref.Config); len(unknown) > 0 {
+				warn("routes.yaml", LintUnknownOption, "route rule %d overrides unknown option(s) %s of middleware '%s', which are ignored", i, strings.Join(unknown, ", "), name)
+			}
+		}
+
+		if strip := rule.Rewrite.StripPrefix; strip != "" && !pathCanHavePrefix(rule.Path, strip) {
+			warn("routes.yaml", LintStripPrefixMismatch, "route rule %d strip_prefix %s never matches path %s", i, strip, rule.Path)
+		}
+
+		if rule.RetryPolicy.Attempts > 0 {
+			for _, method := range rule.Methods {
+				if method == "POST" || method == "PATCH" {
+					warn("routes.yaml", LintRetryNonIdempotent, "route rule %d retries %s requests, which are not idempotent", i, method)
+				}
+			}
+		}
+
+		if rule.RedirectHTTPToHTTPS != nil && *rule.RedirectHTTPToHTTPS && !config.TLS.Enabled {
+			warn("routes.yaml", LintRedirectWithoutTLS, "route rule %d redirects to HTTPS, but TLS is disabled", i)
+		}
+
+		if rule.RequireClientCert && !config.TLS.VerifiesClientCerts() {
+			warn("routes.yaml", LintUnverifiedClientCert, "route rule %d requires a client certificate, but no host of the HTTPS listener verifies them", i)
+		}
+
+		if writeTimeout := config.Global.Server.WriteTimeout; writeTimeout > 0 && rule.Timeout > writeTimeout {
+			warn("routes.yaml", LintRouteTimeout, "route rule %d timeout %v exceeds the server write_timeout %v", i, rule.Timeout, writeTimeout)
+		}
+
+		for j := range config.Routes.Rules {
+			earlier := &config.Routes.Rules[j]
+			if j == i || !routePrecedes(earlier, j, &rule, i) {
+				continue
+			}
+			if routeShadows(earlier, &rule) {
+				warn("routes.yaml", LintShadowedRoute, "route rule %d is unreachable because route rule %d matches all of its requests first", i, j)
+				break
+			}
+		}
+	}
+}
+
+// pathCanHavePrefix reports whether any request path matched by a route path
+// starts with prefix. Paths ending in /* match by prefix, others exactly;
+// paths with parameters or a regex are given the benefit of the doubt.
+func pathCanHavePrefix(routePath, prefix string) bool {
+	if !router.Static(routePath) {
+		return true
+	}
+	if base, ok := strings.CutSuffix(routePath, "/*"); ok {
+		return strings.HasPrefix(base, prefix) || strings.HasPrefix(prefix, base)
+	}
+	return strings.HasPrefix(routePath, prefix)
+}
+
+// routePrecedes reports whether rule a, at index i, is evaluated before rule
+// b, at index j: higher priorities first, then in order
+func routePrecedes(a *RouteRule, i int, b *RouteRule, j int) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return i < j
+}
+
+// routeShadows reports whether every request matched by later is matched by
+// earlier, which is evaluated first
+func routeShadows(earlier, later *RouteRule) bool {
+	if !hostCovers(earlier.Host, later.Host) {
+		return false
+	}
+
+	// Earlier paths with parameters or a regex, and later regexes, are only
+	// compared verbatim. A later path's parameters never widen it past a
+	// static prefix.
+	if !router.Static(earlier.Path) || strings.HasPrefix(later.Path, "~") {
+		if earlier.Path != later.Path {
+			return false
+		}
+	} else if base, ok := strings.CutSuffix(earlier.Path, "/*"); ok {
+		laterBase := strings.TrimSuffix(later.Path, "/*")
+		if !strings.HasPrefix(laterBase, base) {
+			return false
+		}
+	} else if earlier.Path != later.Path {
+		return false
+	}
+
+	// Conditions narrow the earlier rule unless the later one has them too
+	if !conditionsCovered(earlier.HeadersMatch, later.HeadersMatch) || !conditionsCovered(earlier.QueryMatch, later.QueryMatch) {
+		return false
+	}
+
+	if len(earlier.Methods) == 0 {
+		return true
+	}
+	if len(later.Methods) == 0 {
+		return false
+	}
+	for _, method := range later.Methods {
+		if !contains(earlier.Methods, method) {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionsCovered reports whether every earlier condition is also one of
+// the later conditions
+func conditionsCovered(earlier, later []MatchCondition) bool {
+	for _, condition := range earlier {
+		found := false
+		for _, other := range later {
+			if condition.String() == other.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hostCovers reports whether every host matched by route host b is matched
+// by route host a. Regex hosts are only compared verbatim.
+func hostCovers(a, b string) bool {
+	if a == "" || a == b {
+		return true
+	}
+	if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+		return false
+	}
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(a, "*")
+	if !ok {
+		return false
+	}
+	b = strings.TrimPrefix(b, "*")
+	return len(b) > len(suffix) && strings.HasSuffix(b, suffix)
+}
@@ -0,0 +1,579 @@
+package config
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-viper/mapstructure/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// LoggingMiddlewareConfig holds logging middleware options
+type LoggingMiddlewareConfig struct {
+	LogHeaders   bool `mapstructure:"log_headers"`
+	LogBody      bool `mapstructure:"log_body"`
+	LogRequests  bool `mapstructure:"log_requests"`
+	LogResponses bool `mapstructure:"log_responses"`
+}
+
+// RateLimitMiddlewareConfig holds rate limiting middleware options
+type RateLimitMiddlewareConfig struct {
+	RequestsPerSecond int           `mapstructure:"requests_per_second"`
+	Burst             int           `mapstructure:"burst"`
+	KeyFunc           string        `mapstructure:"key_func"`         // "ip", "user", "global"
+	TTL               time.Duration `mapstructure:"ttl"`              // limiters idle this long are removed
+	MaxKeys           int           `mapstructure:"max_keys"`         // limiters kept, the least recently used are removed
+	CleanupInterval   time.Duration `mapstructure:"cleanup_interval"` // how often idle limiters are removed
+}
+
+// FairnessMiddlewareConfig holds fair queueing middleware options. Once
+// max_concurrent requests are in flight, further requests wait in a queue
+// that serves clients in proportion to their weight.
+type FairnessMiddlewareConfig struct {
+	MaxConcurrent  int             `mapstructure:"max_concurrent"`   // requests served at once
+	MaxQueue       int             `mapstructure:"max_queue"`        // requests waiting, across clients
+	MaxClientQueue int             `mapstructure:"max_client_queue"` // requests waiting per client, 0 is unlimited
+	QueueTimeout   time.Duration   `mapstructure:"queue_timeout"`    // how long a request may wait
+	KeyFunc        string          `mapstructure:"key_func"`         // "ip", "user", "header"
+	KeyHeader      string          `mapstructure:"key_header"`       // header identifying clients for key_func header
+	DefaultWeight  int             `mapstructure:"default_weight"`
+	Clients        []FairnessShare `mapstructure:"clients"` // weights of individual clients
+}
+
+// FairnessShare is the weight of a client in the fair queue
+type FairnessShare struct {
+	Key    string `mapstructure:"key"`
+	Weight int    `mapstructure:"weight"`
+}
+
+// AuthMiddlewareConfig holds authentication middleware options. Tokens are
+// verified with a shared secret, a public key or the keys published at a
+// JWKS URL.
+type AuthMiddlewareConfig struct {
+	JWTSecret     string   `mapstructure:"jwt_secret"`
+	JWTIssuer     string   `mapstructure:"jwt_issuer"`
+	SkipPaths     []string `mapstructure:"skip_paths"`
+	TokenLocation string   `mapstructure:"token_location"` // "header", "cookie", "query"
+	TokenName     string   `mapstructure:"token_name"`
+	AuthType      string   `mapstructure:"auth_type"`
+	SecretKey     string   `mapstructure:"secret_key"`
+	TokenHeader   string   `mapstructure:"token_header"`
+	PublicPaths   []string `mapstructure:"public_paths"`
+
+	JWTIssuers          []string      `mapstructure:"jwt_issuers"`           // accepted issuers, in addition to jwt_issuer
+	JWTAudiences        []string      `mapstructure:"jwt_audiences"`         // tokens must name one of them in aud
+	PublicKey           string        `mapstructure:"public_key"`            // PEM RSA, ECDSA or Ed25519 public key
+	JWKSURL             string        `mapstructure:"jwks_url"`              // keys are fetched and cached by kid
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks_refresh_interval"` // how long fetched keys are used
+	Algorithms          []string      `mapstructure:"algorithms"`            // accepted signing algorithms, by default those of the configured keys
+}
+
+// CompressionMiddlewareConfig holds compression middleware options
+type CompressionMiddlewareConfig struct {
+	Level        int      `mapstructure:"level"`
+	MinLength    int      `mapstructure:"min_length"`
+	MinSize      int      `mapstructure:"min_size"`
+	Types        []string `mapstructure:"types"`
+	ContentTypes []string `mapstructure:"content_types"`
+	SkipPaths    []string `mapstructure:"skip_paths"`
+	Encodings    []string `mapstructure:"encodings"` // content codings offered, in order of preference
+	BrotliLevel  int      `mapstructure:"brotli_level"`
+	Decompress   bool     `mapstructure:"decompress"` // decode gzip and br responses for clients not accepting them
+}
+
+// CacheMiddlewareConfig holds response cache middleware options
+type CacheMiddlewareConfig struct {
+	TTL           time.Duration `mapstructure:"ttl"`             // freshness of responses without max-age or Expires, 0 caches only those
+	MaxEntries    int           `mapstructure:"max_entries"`     // cached responses kept
+	MaxSize       int64         `mapstructure:"max_size"`        // total bytes of cached responses
+	MaxObjectSize int64         `mapstructure:"max_object_size"` // largest cached response body in bytes
+	SkipPaths     []string      `mapstructure:"skip_paths"`
+
+	// Concurrent misses of a resource wait for a single upstream request
+	Coalesce            bool `mapstructure:"coalesce"`
+	CoalesceUncacheable bool `mapstructure:"coalesce_uncacheable"` // also share responses that cannot be cached
+
+	// Defaults for responses without stale-while-revalidate or stale-if-error
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate"`
+	StaleIfError         time.Duration `mapstructure:"stale_if_error"`
+
+	// Shared stores let replicas share one cache that survives restarts
+	Store        string          `mapstructure:"store"`         // memory, redis or memcached
+	KeyPrefix    string          `mapstructure:"key_prefix"`    // prefix of keys in shared stores
+	StoreTimeout time.Duration   `mapstructure:"store_timeout"` // timeout of shared store operations
+	Redis        RedisConfig     `mapstructure:"redis"`
+	Memcached    MemcachedConfig `mapstructure:"memcached"`
+}
+
+// QuotaMiddlewareConfig holds API key quota middleware options
+type QuotaMiddlewareConfig struct {
+	Header     string      `mapstructure:"header"`      // header carrying the API key
+	QueryParam string      `mapstructure:"query_param"` // query parameter carrying the API key, if any
+	Keys       []QuotaPlan `mapstructure:"keys"`        // API keys and their quotas
+	Default    *QuotaPlan  `mapstructure:"default"`     // quota of unlisted keys, which are rejected without one
+	UsagePath  string      `mapstructure:"usage_path"`  // path where clients read their own usage
+	SkipPaths  []string    `mapstructure:"skip_paths"`
+
+	// Usage is kept in a file to survive restarts, or in Redis to be shared
+	// by replicas
+	Store         string        `mapstructure:"store"`          // memory, file or redis
+	File          string        `mapstructure:"file"`           // usage file of the file store
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // how often the file store saves usage
+	KeyPrefix     string        `mapstructure:"key_prefix"`     // prefix of Redis keys
+	StoreTimeout  time.Duration `mapstructure:"store_timeout"`  // timeout of Redis operations
+	Redis         RedisConfig   `mapstructure:"redis"`
+}
+
+// QuotaPlan limits the requests of an API key per calendar day and month in
+// UTC; 0 is unlimited
+type QuotaPlan struct {
+	Key     string `mapstructure:"key"` // unset for the default plan
+	Name    string `mapstructure:"name"`
+	Daily   int64  `mapstructure:"daily"`
+	Monthly int64  `mapstructure:"monthly"`
+}
+
+// EventsMiddlewareConfig holds request event middleware options. The
+// metadata of every request, and optionally a sample of bodies, is published
+// asynchronously to a message queue; events are dropped rather than delaying
+// requests when the sink falls behind.
+type EventsMiddlewareConfig struct {
+	Sink           string        `mapstructure:"sink"`  // nats or kafka
+	Topic          string        `mapstructure:"topic"` // NATS subject or Kafka topic
+	NATS           NATSConfig    `mapstructure:"nats"`
+	Kafka          KafkaConfig   `mapstructure:"kafka"`
+	BufferSize     int           `mapstructure:"buffer_size"`     // events waiting to be published
+	BatchSize      int           `mapstructure:"batch_size"`      // events published at once
+	FlushInterval  time.Duration `mapstructure:"flush_interval"`  // longest wait for a batch to fill
+	PublishTimeout time.Duration `mapstructure:"publish_timeout"` // timeout of publishing a batch
+	IncludeHeaders bool          `mapstructure:"include_headers"`
+	RedactHeaders  []string      `mapstructure:"redact_headers"`   // headers whose values are replaced
+	BodySampleRate float64       `mapstructure:"body_sample_rate"` // fraction of requests published with bodies
+	MaxBodySize    int64         `mapstructure:"max_body_size"`    // bytes of each body included
+	SkipPaths      []string      `mapstructure:"skip_paths"`
+}
+
+// WasmMiddlewareConfig holds WebAssembly filter middleware options. The
+// module's exports filter requests and responses as JSON documents, and the
+// module is compiled again when its file changes.
+type WasmMiddlewareConfig struct {
+	Module         string         `mapstructure:"module"`          // path of the .wasm file
+	Options        map[string]any `mapstructure:"options"`         // passed to the module's sentinel_configure
+	RequestBody    bool           `mapstructure:"request_body"`    // pass request bodies to sentinel_on_request
+	ResponseBody   bool           `mapstructure:"response_body"`   // pass response bodies to sentinel_on_response
+	MaxBodySize    int64          `mapstructure:"max_body_size"`   // larger bodies are passed through unfiltered
+	Timeout        time.Duration  `mapstructure:"timeout"`         // longest a single call may run
+	FailOpen       bool           `mapstructure:"fail_open"`       // pass requests through when the filter fails
+	ReloadInterval time.Duration  `mapstructure:"reload_interval"` // how often the module file is checked for changes
+}
+
+// ExternalAuthMiddlewareConfig holds external authorization middleware
+// options. Every request is checked with an authorization service, over HTTP
+// or with the gRPC Check call of Envoy's ext_authz API, before it is proxied.
+type ExternalAuthMiddlewareConfig struct {
+	Protocol        string        `mapstructure:"protocol"`         // http or grpc
+	URL             string        `mapstructure:"url"`              // authorization service, http:// (h2c for grpc) or https://
+	ForwardHeaders  []string      `mapstructure:"forward_headers"`  // request headers sent to the service
+	UpstreamHeaders []string      `mapstructure:"upstream_headers"` // headers of allowing HTTP responses added to the request
+	ClientHeaders   []string      `mapstructure:"client_headers"`   // headers of denying HTTP responses returned to the client
+	Timeout         time.Duration `mapstructure:"timeout"`
+	FailureMode     string        `mapstructure:"failure_mode"`    // closed rejects requests when the service fails, open lets them through
+	StatusOnError   int           `mapstructure:"status_on_error"` // status of requests rejected by failure_mode closed
+	SkipPaths       []string      `mapstructure:"skip_paths"`
+}
+
+// BasicAuthMiddlewareConfig holds HTTP basic authentication middleware
+// options. Users come from htpasswd entries with bcrypt or Apache MD5
+// ($apr1$) hashes, inline or in a file.
+type BasicAuthMiddlewareConfig struct {
+	Realm        string   `mapstructure:"realm"`
+	Users        []string `mapstructure:"users"`         // user:hash entries
+	HtpasswdFile string   `mapstructure:"htpasswd_file"` // read when the configuration is loaded
+	AllowIPs     []string `mapstructure:"allow_ips"`     // IPs or CIDRs of clients let through without credentials
+	UserHeader   string   `mapstructure:"user_header"`   // header passing the authenticated user upstream
+	SkipPaths    []string `mapstructure:"skip_paths"`
+}
+
+// HMACMiddlewareConfig holds request signature middleware options. Clients
+// sign the components of a request with a shared key, and signatures outside
+// the skew window or seen before are rejected.
+type HMACMiddlewareConfig struct {
+	Keys            []HMACKey     `mapstructure:"keys"`
+	Algorithm       string        `mapstructure:"algorithm"`  // sha256 or sha512
+	Encoding        string        `mapstructure:"encoding"`   // of signatures, hex or base64
+	Components      []string      `mapstructure:"components"` // signed, in order: method, path, query, host, timestamp, nonce, body or header:<name>
+	SignatureHeader string        `mapstructure:"signature_header"`
+	TimestampHeader string        `mapstructure:"timestamp_header"` // Unix seconds
+	KeyIDHeader     string        `mapstructure:"key_id_header"`    // names the key; without it every key is tried
+	NonceHeader     string        `mapstructure:"nonce_header"`
+	MaxSkew         time.Duration `mapstructure:"max_skew"`      // largest difference of timestamps from the current time
+	MaxBodySize     int64         `mapstructure:"max_body_size"` // larger signed bodies are rejected
+	SkipPaths       []string      `mapstructure:"skip_paths"`
+}
+
+// HMACKey is a shared signing key
+type HMACKey struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// NATSConfig holds NATS connection settings
+type NATSConfig struct {
+	URL      string `mapstructure:"url"` // comma-separated server URLs
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	Token    string `mapstructure:"token"`
+}
+
+// KafkaConfig holds the settings of a Kafka REST proxy, through which events
+// are produced to Kafka
+type KafkaConfig struct {
+	RESTProxy string `mapstructure:"rest_proxy"` // base URL of the REST proxy
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// RedisConfig holds Redis connection settings
+type RedisConfig struct {
+	Address  string `mapstructure:"address" yaml:"address"`
+	Username string `mapstructure:"username" yaml:"username,omitempty"`
+	Password string `mapstructure:"password" yaml:"password,omitempty"`
+	DB       int    `mapstructure:"db" yaml:"db,omitempty"`
+	TLS      bool   `mapstructure:"tls" yaml:"tls,omitempty"`
+}
+
+// MemcachedConfig holds Memcached connection settings
+type MemcachedConfig struct {
+	Servers []string `mapstructure:"servers"` // host:port addresses
+}
+
+// RouteMiddleware references a middleware definition from a route. In YAML it
+// is either the middleware name or a mapping with the name and config options
+// that override the definition's options for this route only.
+type RouteMiddleware struct {
+	Name   string         `yaml:"name"`
+	Config map[string]any `yaml:"config,omitempty"`
+}
+
+// UnmarshalYAML accepts both the name and the mapping form
+func (m *RouteMiddleware) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*m = RouteMiddleware{}
+		return node.Decode(&m.Name)
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: route middleware must be a name or a mapping", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i].Value; key != "name" && key != "config" {
+			return fmt.Errorf("line %d: field %s not found in route middleware", node.Content[i].Line, key)
+		}
+	}
+
+	type plain RouteMiddleware
+	return node.Decode((*plain)(m))
+}
+
+// MarshalYAML writes references without overrides in the name form
+func (m RouteMiddleware) MarshalYAML() (any, error) {
+	if len(m.Config) == 0 {
+		return m.Name, nil
+	}
+	type plain RouteMiddleware
+	return plain(m), nil
+}
+
+// MergeMiddlewareConfig layers route overrides on top of a middleware
+// definition's options. Overridden options replace the defined ones.
+func MergeMiddlewareConfig(base, overrides map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// middlewareConfigTypes creates the default typed configuration of each
+// middleware type
+var middlewareConfigTypes = map[string]func() any{
+	"logging": func() any {
+		return &LoggingMiddlewareConfig{
+			LogRequests:  true,
+			LogResponses: true,
+		}
+	},
+	"rate_limit": func() any {
+		return &RateLimitMiddlewareConfig{
+			RequestsPerSecond: 10,
+			Burst:             20,
+			KeyFunc:           "ip",
+			TTL:               10 * time.Minute,
+			MaxKeys:           100000,
+			CleanupInterval:   time.Minute,
+		}
+	},
+	"fairness": func() any {
+		return &FairnessMiddlewareConfig{
+			MaxConcurrent:  100,
+			MaxQueue:       1000,
+			MaxClientQueue: 100,
+			QueueTimeout:   10 * time.Second,
+			KeyFunc:        "ip",
+			KeyHeader:      "X-API-Key",
+			DefaultWeight:  1,
+		}
+	},
+	"events": func() any {
+		return &EventsMiddlewareConfig{
+			Topic:          "sentinel.requests",
+			NATS:           NATSConfig{URL: "nats://127.0.0.1:4222"},
+			BufferSize:     10000,
+			BatchSize:      100,
+			FlushInterval:  time.Second,
+			PublishTimeout: 5 * time.Second,
+			RedactHeaders:  []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"},
+			MaxBodySize:    64 * 1024,
+		}
+	},
+	"wasm": func() any {
+		return &WasmMiddlewareConfig{
+			MaxBodySize:    1 << 20, // 1MB
+			Timeout:        time.Second,
+			ReloadInterval: 2 * time.Second,
+		}
+	},
+	"external_auth": func() any {
+		return &ExternalAuthMiddlewareConfig{
+			Protocol:       "http",
+			ForwardHeaders: []string{"Authorization", "Cookie"},
+			ClientHeaders:  []string{"WWW-Authenticate", "Location", "Set-Cookie"},
+			Timeout:        time.Second,
+			FailureMode:    "closed",
+			StatusOnError:  http.StatusForbidden,
+		}
+	},
+	"basic_auth": func() any {
+		return &BasicAuthMiddlewareConfig{
+			Realm: "Restricted",
+		}
+	},
+	"hmac": func() any {
+		return &HMACMiddlewareConfig{
+			Algorithm:       "sha256",
+			Encoding:        "hex",
+			Components:      []string{"method", "path", "query", "timestamp", "body"},
+			SignatureHeader: "X-Signature",
+			TimestampHeader: "X-Timestamp",
+			KeyIDHeader:     "X-Key-ID",
+			MaxSkew:         5 * time.Minute,
+			MaxBodySize:     10 << 20, // 10MB
+		}
+	},
+	"auth": func() any {
+		return &AuthMiddlewareConfig{
+			TokenLocation:       "header",
+			TokenName:           "Authorization",
+			AuthType:            "jwt",
+			JWKSRefreshInterval: time.Hour,
+		}
+	},
+	"compression": func() any {
+		return &CompressionMiddlewareConfig{
+			Level:       gzip.DefaultCompression,
+			BrotliLevel: brotli.DefaultCompression,
+			Encodings:   []string{"gzip"},
+			MinLength:   1024,
+			Types: []string{
+				"text/html",
+				"text/plain",
+				"text/css",
+				"text/javascript",
+				"application/javascript",
+				"application/json",
+				"application/xml",
+				"text/xml",
+			},
+		}
+	},
+	"cache": func() any {
+		return &CacheMiddlewareConfig{
+			MaxEntries:    10000,
+			MaxSize:       64 << 20, // 64MB
+			MaxObjectSize: 1 << 20,  // 1MB
+			Coalesce:      true,
+			Store:         "memory",
+			KeyPrefix:     "sentinel:cache:",
+			StoreTimeout:  200 * time.Millisecond,
+			Redis:         RedisConfig{Address: "127.0.0.1:6379"},
+		}
+	},
+	"quota": func() any {
+		return &QuotaMiddlewareConfig{
+			Header:        "X-API-Key",
+			Store:         "file",
+			File:          "./data/quota.json",
+			FlushInterval: 5 * time.Second,
+			KeyPrefix:     "sentinel:quota:",
+			StoreTimeout:  200 * time.Millisecond,
+			Redis:         RedisConfig{Address: "127.0.0.1:6379"},
+		}
+	},
+}
+
+// DecodeMiddlewareConfig decodes raw middleware options into the typed
+// configuration of the middleware type, starting from its defaults. Values of
+// the wrong type are rejected; unknown options are ignored here, reported as
+// lint warnings and rejected by strict loading.
+func DecodeMiddlewareConfig(middlewareType string, raw map[string]any) (any, error) {
+	newConfig, exists := middlewareConfigTypes[middlewareType]
+	if !exists {
+		return nil, fmt.Errorf("unknown middleware type: %s", middlewareType)
+	}
+
+	typed := newConfig()
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			integralFloatHook,
+		),
+		Result: typed,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return nil, flattenDecodeError(err)
+	}
+
+	normalizeMiddlewareConfig(typed)
+	return typed, nil
+}
+
+// flattenDecodeError reports the individual decoding problems on one line
+// instead of the decoder's multi-line summary
+func flattenDecodeError(err error) error {
+	inner := errors.Unwrap(err)
+	if inner == nil {
+		return err
+	}
+	joined, ok := inner.(interface{ Unwrap() []error })
+	if !ok {
+		return inner
+	}
+
+	var messages []string
+	for _, e := range joined.Unwrap() {
+		messages = append(messages, e.Error())
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// integralFloatHook accepts floats for integer options only when they have no
+// fractional part, so 100.0 decodes as 100 but 0.5 is rejected
+func integralFloatHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.Float32 && from.Kind() != reflect.Float64 {
+		return data, nil
+	}
+	switch to.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value := reflect.ValueOf(data).Float()
+		if value != math.Trunc(value) {
+			return nil, fmt.Errorf("expected an integer, got %v", value)
+		}
+		return int64(value), nil
+	}
+	return data, nil
+}
+
+// normalizeMiddlewareConfig resolves alternative option names
+func normalizeMiddlewareConfig(typed any) {
+	switch cfg := typed.(type) {
+	case *AuthMiddlewareConfig:
+		// secret_key, public_paths and token_header are accepted as aliases
+		if cfg.JWTSecret == "" {
+			cfg.JWTSecret = cfg.SecretKey
+		}
+		if len(cfg.SkipPaths) == 0 {
+			cfg.SkipPaths = cfg.PublicPaths
+		}
+		if cfg.TokenHeader != "" && cfg.TokenName == "Authorization" {
+			cfg.TokenName = cfg.TokenHeader
+		}
+	case *CompressionMiddlewareConfig:
+		// min_size and content_types are accepted as aliases
+		if cfg.MinSize > 0 {
+			cfg.MinLength = cfg.MinSize
+		}
+		if len(cfg.ContentTypes) > 0 {
+			cfg.Types = cfg.ContentTypes
+		}
+	}
+}
+
+// middlewareConfigKeys returns the options a middleware type understands
+func middlewareConfigKeys(middlewareType string) []string {
+	newConfig, exists := middlewareConfigTypes[middlewareType]
+	if !exists {
+		return nil
+	}
+
+	t := reflect.TypeOf(newConfig()).Elem()
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// unknownMiddlewareKeys returns the options in a middleware config that are not
+// recognized for its type
+func unknownMiddlewareKeys(middlewareType string, config map[string]any) []string {
+	known := middlewareConfigKeys(middlewareType)
+	if known == nil {
+		return nil
+	}
+
+	var unknown []string
+	for key := range config {
+		if !contains(known, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkMiddlewareKeys rejects unknown middleware options, including options
+// overridden by routes
+func checkMiddlewareKeys(config *MiddlewareConfig, routes *RoutesConfig) error {
+	types := make(map[string]string, len(config.Chain))
+	for _, mw := range config.Chain {
+		types[mw.Name] = mw.Type
+		if unknown := unknownMiddlewareKeys(mw.Type, mw.Config); len(unknown) > 0 {
+			return fmt.Errorf("unknown field(s) in middleware '%s': %s", mw.Name, strings.Join(unknown, ", "))
+		}
+	}
+
+	for i, rule := range routes.Rules {
+		for _, ref := range rule.Middleware {
+			if unknown := unknownMiddlewareKeys(types[ref.Name], ref.Config); len(unknown) > 0 {
+				return fmt.Errorf("unknown field(s) in route rule %d middleware '%s': %s", i, ref.Name, strings.Join(unknown, ", "))
+			}
+		}
+	}
+	return nil
+}
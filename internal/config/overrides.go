@@ -0,0 +1,219 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvOverridePrefix is the prefix of environment variables that override
+// configuration keys, e.g. SENTINEL_GLOBAL_SERVER_HTTP_PORT=9090
+const EnvOverridePrefix = "SENTINEL_"
+
+// errUnknownKey reports an override path that matches no configuration key
+var errUnknownKey = errors.New("unknown key")
+
+// OverrideFlags collects repeated --set key=value command-line flags
+type OverrideFlags []string
+
+// String returns the flag value
+func (o *OverrideFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+// Set adds an override
+func (o *OverrideFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("override must have the form key=value")
+	}
+	*o = append(*o, value)
+	return nil
+}
+
+// applyOverrides applies environment overrides followed by explicit
+// overrides, so command-line flags take precedence. Environment variables
+// that match no key are skipped, as the prefix may be used for other things.
+func applyOverrides(config *Config, opts LoadOptions) error {
+	if opts.EnvOverrides {
+		for _, entry := range os.Environ() {
+			name, value, _ := strings.Cut(entry, "=")
+			if !strings.HasPrefix(name, EnvOverridePrefix) {
+				continue
+			}
+			tokens := strings.Split(strings.ToLower(strings.TrimPrefix(name, EnvOverridePrefix)), "_")
+			err := setPath(reflect.ValueOf(config).Elem(), tokens, value, true)
+			if errors.Is(err, errUnknownKey) {
+				opts.logger().Warn("Ignoring environment variable that matches no configuration key", zap.String("name", name))
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("invalid environment override %s: %w", name, err)
+			}
+		}
+	}
+
+	for _, override := range opts.Overrides {
+		path, value, found := strings.Cut(override, "=")
+		if !found || path == "" {
+			return fmt.Errorf("invalid override %q, expected key=value", override)
+		}
+		if err := setPath(reflect.ValueOf(config).Elem(), strings.Split(path, "."), value, false); err != nil {
+			return fmt.Errorf("invalid override %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// setPath assigns raw to the value addressed by tokens. Dotted paths use one
+// token per key; environment paths are split on underscores, so key names are
+// matched against as many tokens as they contain.
+func setPath(v reflect.Value, tokens []string, raw string, env bool) error {
+	if len(tokens) == 0 {
+		return assignValue(v, raw)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return setPath(v.Elem(), tokens, raw, env)
+		}
+		// Nil pointers are only filled in once the path is found below them
+		elem := reflect.New(v.Type().Elem())
+		if err := setPath(elem.Elem(), tokens, raw, env); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case reflect.Interface:
+		if v.IsNil() || v.Elem().Kind() != reflect.Map {
+			return fmt.Errorf("%w %s: cannot descend into it", errUnknownKey, strings.Join(tokens, "."))
+		}
+		return setPath(v.Elem(), tokens, raw, env)
+
+	case reflect.Struct:
+		// A key matched with a malformed value is reported over the
+		// failure to match
+		var invalid error
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := nameTokens(yamlName(field), env)
+			if !hasTokenPrefix(tokens, name) {
+				continue
+			}
+			err := setPath(v.Field(i), tokens[len(name):], raw, env)
+			if err == nil {
+				return nil
+			}
+			if invalid == nil && !errors.Is(err, errUnknownKey) {
+				invalid = err
+			}
+		}
+		if invalid != nil {
+			return invalid
+		}
+		return fmt.Errorf("%w %s", errUnknownKey, strings.Join(tokens, "."))
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%w %s: unsupported map key type", errUnknownKey, strings.Join(tokens, "."))
+		}
+
+		// Prefer existing entries
+		var invalid error
+		iter := v.MapRange()
+		for iter.Next() {
+			name := nameTokens(iter.Key().String(), env)
+			if !hasTokenPrefix(tokens, name) {
+				continue
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			err := setPath(elem, tokens[len(name):], raw, env)
+			if err == nil {
+				v.SetMapIndex(iter.Key(), elem)
+				return nil
+			}
+			if invalid == nil && !errors.Is(err, errUnknownKey) {
+				invalid = err
+			}
+		}
+		if invalid != nil {
+			return invalid
+		}
+
+		// Otherwise create a new entry. Environment paths can't tell where a
+		// new key ends, so they only reach existing ones.
+		if env {
+			return fmt.Errorf("%w %s", errUnknownKey, strings.Join(tokens, "."))
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := setPath(elem, tokens[1:], raw, env); err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(tokens[0]).Convert(v.Type().Key()), elem)
+		return nil
+
+	case reflect.Slice:
+		index, err := strconv.Atoi(tokens[0])
+		if err != nil {
+			return fmt.Errorf("%w %s: expected list index", errUnknownKey, strings.Join(tokens, "."))
+		}
+		if index < 0 || index >= v.Len() {
+			return fmt.Errorf("%w %s: list index %d out of range", errUnknownKey, strings.Join(tokens, "."), index)
+		}
+		return setPath(v.Index(index), tokens[1:], raw, env)
+	}
+
+	return fmt.Errorf("%w %s", errUnknownKey, strings.Join(tokens, "."))
+}
+
+// assignValue parses raw as YAML into the type of v
+func assignValue(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(raw)
+		return nil
+	}
+
+	parsed := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+		return fmt.Errorf("cannot parse %q as %s: %w", raw, v.Type(), err)
+	}
+	v.Set(parsed.Elem())
+	return nil
+}
+
+// nameTokens splits a key into the tokens it occupies in a path
+func nameTokens(name string, env bool) []string {
+	if !env {
+		return []string{name}
+	}
+	normalized := strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(name))
+	return strings.Split(normalized, "_")
+}
+
+// hasTokenPrefix reports whether tokens starts with prefix
+func hasTokenPrefix(tokens, prefix []string) bool {
+	if len(prefix) > len(tokens) {
+		return false
+	}
+	for i := range prefix {
+		if tokens[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
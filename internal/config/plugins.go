@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"sync"
+)
+
+// pluginMiddlewareTypes validates the options of middleware types that are
+// registered outside the config package, by type
+var (
+	pluginMiddlewareMu    sync.RWMutex
+	pluginMiddlewareTypes = map[string]func(options map[string]any) error{}
+)
+
+// RegisterMiddlewareType makes a middleware type valid. validate checks the
+// options of a middleware of the type and may be nil.
+func RegisterMiddlewareType(name string, validate func(options map[string]any) error) {
+	if validate == nil {
+		validate = func(map[string]any) error { return nil }
+	}
+
+	pluginMiddlewareMu.Lock()
+	defer pluginMiddlewareMu.Unlock()
+	if _, exists := pluginMiddlewareTypes[name]; exists || contains(validMiddlewareTypes, name) {
+		panic(fmt.Sprintf("middleware type %s registered twice", name))
+	}
+	pluginMiddlewareTypes[name] = validate
+}
+
+// pluginMiddlewareValidator returns the validator of a registered middleware
+// type
+func pluginMiddlewareValidator(name string) (func(map[string]any) error, bool) {
+	pluginMiddlewareMu.RLock()
+	defer pluginMiddlewareMu.RUnlock()
+	validate, ok := pluginMiddlewareTypes[name]
+	return validate, ok
+}
+
+// middlewareTypes lists the built-in and registered middleware types
+func middlewareTypes() []string {
+	pluginMiddlewareMu.RLock()
+	defer pluginMiddlewareMu.RUnlock()
+
+	types := append([]string{}, validMiddlewareTypes...)
+	var registered []string
+	for name := range pluginMiddlewareTypes {
+		registered = append(registered, name)
+	}
+	sort.Strings(registered)
+	return append(types, registered...)
+}
+
+// loadPlugins opens Go plugins, whose init functions register the types
+// they provide. Opening a plugin again is a no-op, and plugins cannot be
+// unloaded.
+func loadPlugins(paths []string) []error {
+	var errs []error
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load plugin %s: %w", path, err))
+		}
+	}
+	return errs
+}
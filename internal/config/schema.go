@@ -0,0 +1,135 @@
+package config
+
+import (
+	"reflect"
+	"time"
+)
+
+// schemaDraft is the JSON Schema dialect used by generated schemas
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches Go duration strings such as "30s" or "1h30m"
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaEnums lists allowed values for enumerated fields, keyed by
+// "<struct type>.<field name>"
+var schemaEnums = map[string][]string{
+	"LogConfig.Level":              validLogLevels,
+	"LogConfig.Format":             validLogFormats,
+	"AccessLogConfig.Format":       validAccessFormats,
+	"UpstreamService.LoadBalancer": validLBStrategies,
+	"RouteRule.Methods":            validMethods,
+	"ClientAuthConfig.Mode":        validClientAuthModes,
+	"CertificateConfig.ClientAuth": validClientAuthModes,
+	"TLSConfig.MinVersion":         validTLSVersions,
+	"TLSConfig.MaxVersion":         validTLSVersions,
+	"TLSConfig.CurvePreferences":   validCurves,
+	"HealthCheckConfig.Type":       validHealthTypes,
+}
+
+// Schema returns a JSON Schema describing the complete configuration, with
+// one property per configuration file
+func Schema() map[string]any {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	schema["$schema"] = schemaDraft
+	schema["title"] = "Sentinel configuration"
+	return schema
+}
+
+// SectionSchemas returns a JSON Schema for each configuration file, keyed by
+// file name without extension
+func SectionSchemas() map[string]map[string]any {
+	schemas := make(map[string]map[string]any)
+	for _, sec := range sections(&Config{}) {
+		schema := schemaFor(reflect.TypeOf(sec.target).Elem())
+		schema["$schema"] = schemaDraft
+		schema["title"] = "Sentinel " + sec.label + " configuration"
+		schemas[sec.name] = schema
+	}
+	return schemas
+}
+
+// schemaFor builds the JSON Schema of a Go type
+func schemaFor(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{
+			"type":    "string",
+			"pattern": durationPattern,
+		}
+	}
+
+	if t == reflect.TypeOf(RouteMiddleware{}) {
+		return map[string]any{
+			"oneOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":   map[string]any{"type": "string"},
+						"config": map[string]any{"type": "object"},
+					},
+					"required":             []string{"name"},
+					"additionalProperties": false,
+				},
+			},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": schemaFor(t.Elem()),
+		}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]any{"type": "object"}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": schemaFor(t.Elem()),
+		}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := yamlName(field)
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+
+			property := schemaFor(field.Type)
+			enum, exists := schemaEnums[t.Name()+"."+field.Name]
+			if t.Name()+"."+field.Name == "MiddlewareChain.Type" {
+				// Includes the types registered by plugins compiled in
+				enum, exists = middlewareTypes(), true
+			}
+			if exists {
+				if property["type"] == "array" {
+					property["items"] = map[string]any{"type": "string", "enum": enum}
+				} else {
+					property["enum"] = enum
+				}
+			}
+			properties[name] = property
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]any{}
+	}
+}
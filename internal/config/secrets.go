@@ -0,0 +1,295 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret reference prefixes recognized in configuration values
+const (
+	secretFilePrefix  = "file://"
+	secretEnvPrefix   = "env://"
+	secretVaultPrefix = "vault://"
+)
+
+// vaultClient is used to resolve vault:// references
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// resolveSecrets replaces secret references in every string value of the
+// configuration, including free-form middleware options. Supported forms:
+//
+//	file:///run/secrets/jwt      contents of the file, trailing newline trimmed
+//	env://JWT_SECRET             value of the environment variable
+//	vault://secret/data/app#key  field of a Vault KV secret (VAULT_ADDR, VAULT_TOKEN)
+//
+// The references are remembered by the paths of the values they resolved, so
+// the configuration is serialized and hashed with the references in their
+// place.
+func resolveSecrets(config *Config) error {
+	if config.secrets == nil {
+		config.secrets = make(secretReferences)
+	}
+	return config.secrets.resolveValue(reflect.ValueOf(config).Elem(), "")
+}
+
+// secretReference is a reference and the secret it resolved to
+type secretReference struct {
+	reference string
+	value     string
+}
+
+// secretReferences are secret references by the dotted paths of the values
+// they resolved, e.g. middleware.chain.0.config.jwt_secret
+type secretReferences map[string]secretReference
+
+// record remembers the reference a value was resolved from. A value that was
+// resolved more than once keeps the reference written in the configuration.
+func (s secretReferences) record(path, reference, value string) {
+	if existing, exists := s[path]; exists {
+		reference = existing.reference
+	}
+	s[path] = secretReference{reference: reference, value: value}
+}
+
+// equal reports whether two sets of references resolved to the same secrets
+func (s secretReferences) equal(other secretReferences) bool {
+	return len(s) == len(other) && (len(s) == 0 || reflect.DeepEqual(s, other))
+}
+
+// resolve resolves a single value and remembers it if it was a reference
+func (s secretReferences) resolve(path, value string) (string, error) {
+	resolved, err := ResolveSecret(value)
+	if err != nil {
+		return "", err
+	}
+	if resolved != value {
+		s.record(path, value, resolved)
+	}
+	return resolved, nil
+}
+
+// resolveValue walks a value and resolves secret references in place
+func (s secretReferences) resolveValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return s.resolveValue(v.Elem(), path)
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		resolved, err := s.resolve(path, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(resolved)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || yamlName(field) == "-" {
+				continue
+			}
+			if err := s.resolveValue(v.Field(i), fieldPath(path, field)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elemPath := joinPath(path, strconv.Itoa(i))
+			if err := s.resolveElement(v.Index(i), elemPath, func(resolved reflect.Value) { v.Index(i).Set(resolved) }); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			elemPath := joinPath(path, fmt.Sprint(key.Interface()))
+			if err := s.resolveElement(iter.Value(), elemPath, func(resolved reflect.Value) { v.SetMapIndex(key, resolved) }); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveElement resolves a slice element or map value. Map values and values
+// held in interfaces are not addressable, so they are resolved on a copy and
+// stored back through set.
+func (s secretReferences) resolveElement(elem reflect.Value, path string, set func(reflect.Value)) error {
+	if elem.CanSet() && elem.Kind() != reflect.Interface {
+		return s.resolveValue(elem, path)
+	}
+
+	actual := elem
+	if actual.Kind() == reflect.Interface {
+		if actual.IsNil() {
+			return nil
+		}
+		actual = actual.Elem()
+	}
+
+	switch actual.Kind() {
+	case reflect.String:
+		resolved, err := s.resolve(path, actual.String())
+		if err != nil {
+			return err
+		}
+		if resolved != actual.String() {
+			set(reflect.ValueOf(resolved).Convert(elem.Type()))
+		}
+		return nil
+	case reflect.Map, reflect.Slice, reflect.Pointer:
+		return s.resolveValue(actual, path)
+	case reflect.Struct:
+		copied := reflect.New(actual.Type()).Elem()
+		copied.Set(actual)
+		if err := s.resolveValue(copied, path); err != nil {
+			return err
+		}
+		set(copied)
+		return nil
+	}
+	return nil
+}
+
+// redact replaces the values of an encoded configuration that were resolved
+// from references with the references. Values replaced since, such as by
+// overrides, are kept.
+func (s secretReferences) redact(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if secret, exists := s[path]; exists && node.Value == secret.value {
+			node.Value, node.Tag, node.Style = secret.reference, "!!str", 0
+		}
+	case yaml.MappingNode:
+		// Keys are never resolved
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			s.redact(node.Content[i+1], joinPath(path, node.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			s.redact(child, joinPath(path, strconv.Itoa(i)))
+		}
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			s.redact(child, path)
+		}
+	}
+}
+
+// fieldPath returns the path of a struct field under path. Inlined fields
+// share the path of their struct.
+func fieldPath(path string, field reflect.StructField) string {
+	if strings.Contains(field.Tag.Get("yaml"), ",inline") {
+		return path
+	}
+	if field.Tag.Get("yaml") == "" {
+		return joinPath(path, strings.ToLower(field.Name))
+	}
+	return joinPath(path, yamlName(field))
+}
+
+// plainConfig is a Config encoded as is
+type plainConfig Config
+
+// MarshalYAML encodes the configuration with secret references in place of
+// the secrets they resolved to, so neither snapshots served by the admin API
+// nor hashes carry secrets
+func (c Config) MarshalYAML() (interface{}, error) {
+	var node yaml.Node
+	if err := node.Encode((*plainConfig)(&c)); err != nil {
+		return nil, err
+	}
+	c.secrets.redact(&node, "")
+	return &node, nil
+}
+
+// ResolveSecret resolves a single secret reference. Values without a
+// recognized prefix are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretFilePrefix):
+		path := strings.TrimPrefix(value, secretFilePrefix)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case strings.HasPrefix(value, secretEnvPrefix):
+		name := strings.TrimPrefix(value, secretEnvPrefix)
+		secret, exists := os.LookupEnv(name)
+		if !exists {
+			return "", fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, secretVaultPrefix):
+		return resolveVaultSecret(strings.TrimPrefix(value, secretVaultPrefix))
+	}
+
+	return value, nil
+}
+
+// resolveVaultSecret reads a field from a Vault KV secret. The reference has
+// the form <path>#<field>; both KV v1 and v2 responses are understood.
+func resolveVaultSecret(ref string) (string, error) {
+	path, field, found := strings.Cut(ref, "#")
+	if !found || path == "" || field == "" {
+		return "", fmt.Errorf("invalid vault reference %q, expected vault://<path>#<field>", ref)
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR must be set to resolve vault references")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", resp.StatusCode, path)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	data := body.Data
+	// KV v2 nests the secret under data.data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	value, exists := data[field]
+	if !exists {
+		return "", fmt.Errorf("field %s not found in vault secret %s", field, path)
+	}
+
+	return fmt.Sprint(value), nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Source provides configuration and notifies about changes to it
+type Source interface {
+	// Load loads the current configuration
+	Load() (*Config, error)
+	// Watch starts invoking onChange whenever the configuration changes
+	Watch(onChange func()) error
+	// Stop stops watching for changes
+	Stop()
+	// String describes the source for logging
+	String() string
+}
+
+// NewSource creates a configuration source from a specification. Plain paths
+// and file:// URLs load from a directory or a single file; consul:// and
+// etcd:// URLs load from the respective key-value store, e.g.
+// consul://127.0.0.1:8500/sentinel; gateway:// URLs add Kubernetes Gateway
+// API resources to a base directory, and docker:// URLs the labels of Docker
+// containers.
+func NewSource(spec string, opts LoadOptions, logger *zap.Logger) (Source, error) {
+	if !strings.Contains(spec, "://") {
+		return NewFileSource(spec, opts, logger), nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config source: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileSource(u.Host+u.Path, opts, logger), nil
+	case "consul":
+		return NewConsulSource(u, opts, logger), nil
+	case "etcd":
+		return NewEtcdSource(u, opts, logger), nil
+	case "gateway":
+		return NewGatewaySource(u, opts, logger)
+	case "docker":
+		return NewDockerSource(u, opts, logger)
+	default:
+		return nil, fmt.Errorf("unsupported config source scheme: %s", u.Scheme)
+	}
+}
+
+// FileSource loads configuration from a directory of YAML files, or from a
+// single file
+type FileSource struct {
+	dir     string
+	opts    LoadOptions
+	logger  *zap.Logger
+	watcher *Watcher
+}
+
+// NewFileSource creates a new directory-backed configuration source
+func NewFileSource(dir string, opts LoadOptions, logger *zap.Logger) *FileSource {
+	return &FileSource{
+		dir:    dir,
+		opts:   opts,
+		logger: logger,
+	}
+}
+
+// Load loads the configuration from the directory
+func (s *FileSource) Load() (*Config, error) {
+	return LoadConfigWithOptions(s.dir, s.opts)
+}
+
+// Watch watches the directory for changes, or the directory of a single
+// configuration file
+func (s *FileSource) Watch(onChange func()) error {
+	dir := s.dir
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	watcher, err := NewWatcher(dir, DefaultDebounce, s.logger, onChange)
+	if err != nil {
+		return err
+	}
+	if err := watcher.Start(); err != nil {
+		return err
+	}
+	s.watcher = watcher
+	return nil
+}
+
+// Stop stops watching the directory
+func (s *FileSource) Stop() {
+	if s.watcher != nil {
+		s.watcher.Stop()
+	}
+}
+
+// String describes the source
+func (s *FileSource) String() string {
+	return s.dir
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateFuncs are the functions available in configuration templates
+var templateFuncs = template.FuncMap{
+	// env returns the value of an environment variable, or "" if unset
+	"env": os.Getenv,
+	// file returns the contents of a file, trailing newline trimmed
+	"file": func(path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	},
+	// default returns value unless it is empty, in which case it returns def
+	"default": func(def, value any) any {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return def
+		}
+		return value
+	},
+	// required fails loading when value is empty
+	"required": func(message string, value any) (any, error) {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return nil, fmt.Errorf("%s", message)
+		}
+		return value, nil
+	},
+	// hostname returns the host name of the machine
+	"hostname": os.Hostname,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"trim":     strings.TrimSpace,
+}
+
+// renderTemplates evaluates template expressions in the scalar values of a
+// YAML tree and reports whether any value was rendered, e.g.
+//
+//	http_port: '{{ env "PORT" | default 8080 }}'
+//	jwt_secret: '{{ file "/run/secrets/jwt" }}'
+//
+// A value that consists of a single expression takes the type of its result,
+// so templates can produce numbers, booleans and durations. Rendered values
+// are recorded in secrets like secret references, as templates read the
+// environment and files.
+func renderTemplates(node *yaml.Node, path string, secrets secretReferences) (bool, error) {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "{{") {
+			return false, nil
+		}
+
+		tmpl, err := template.New("value").Option("missingkey=error").Funcs(templateFuncs).Parse(node.Value)
+		if err != nil {
+			return false, fmt.Errorf("line %d: invalid template: %w", node.Line, err)
+		}
+
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, nil); err != nil {
+			return false, fmt.Errorf("line %d: failed to render template: %w", node.Line, err)
+		}
+		if rendered.String() != node.Value {
+			secrets.record(path, node.Value, rendered.String())
+		}
+
+		trimmed := strings.TrimSpace(node.Value)
+		if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") && strings.Count(trimmed, "{{") == 1 {
+			// Let the result's type be inferred instead of forcing a string
+			node.Tag = ""
+			node.Style = 0
+		}
+		node.Value = rendered.String()
+		return true, nil
+	}
+
+	changed := false
+	for i, child := range node.Content {
+		// Keys are never templated
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		childChanged, err := renderTemplates(child, childPath(node, i, path), secrets)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || childChanged
+	}
+	return changed, nil
+}
@@ -1,409 +1,1554 @@
 package config
 
 import (
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/bpradana/sentinel/internal/router"
 	"go.uber.org/zap"
 )
 
-// ValidateConfig validates the entire configuration
-func ValidateConfig(config *Config, log *zap.Logger) error {
-	if err := validateGlobalConfig(&config.Global, log); err != nil {
-		log.Error("Global config validation failed", zap.Error(err))
-		return fmt.Errorf("global config validation failed: %w", err)
-	}
+// Allowed values for enumerated configuration fields
+var (
+	validLogLevels       = []string{"debug", "info", "warn", "error"}
+	validLogFormats      = []string{"json", "text"}
+	validLBStrategies    = []string{"round_robin", "least_connections", "ip_hash"}
+	validMethods         = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+	validMiddlewareTypes = []string{"logging", "rate_limit", "auth", "cors", "compression", "cache", "quota", "fairness", "events", "wasm", "external_auth", "basic_auth", "hmac"}
+	validKeyFuncs        = []string{"ip", "user", "global"}
+	validClientAuthModes = []string{"none", "request", "require", "verify_if_given", "require_and_verify"}
+	validTLSVersions     = []string{"1.0", "1.1", "1.2", "1.3"}
+	validCurves          = []string{"X25519", "P256", "P384", "P521"}
+	validRetryConditions = []string{RetryOnConnectFailure, RetryOn5xx, RetryOnGatewayError, RetryOnTimeout}
+	validHealthTypes     = []string{HealthCheckHTTP, HealthCheckHTTPS, HealthCheckTCP}
+	validCacheStores     = []string{"memory", "redis", "memcached"}
+	validQuotaStores     = []string{"memory", "file", "redis"}
+	validFairnessKeys    = []string{"ip", "user", "header"}
+	validEventSinks      = []string{"nats", "kafka"}
+	validWebhookEvents   = []string{"success", "failure"}
+	validSLOEvents       = []string{"firing", "resolved"}
+	validAccessLogLevels = []string{"off", "errors", "default", "verbose"}
+	validEventsLevels    = []string{"off", "default", "verbose"}
+	validEncodings       = []string{"br", "gzip"}
+	validAccessFormats   = []string{AccessLogCombined, AccessLogJSON, AccessLogTemplate}
+	validListeners       = []string{"http", "https", "unix_socket"}
+	validAuthzProtocols  = []string{"http", "grpc"}
+	validFailureModes    = []string{"open", "closed"}
+	validHMACAlgorithms  = []string{"sha256", "sha512"}
+	validJWTAlgorithms   = []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+	validHMACEncodings   = []string{"hex", "base64"}
+	validHMACComponents  = []string{"method", "path", "query", "host", "timestamp", "nonce", "body"}
+)
+
+// ValidationError is a single problem found in a configuration file
+type ValidationError struct {
+	File string
+	Err  error
+}
+
+// Error returns the problem prefixed with the file it was found in
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
 
-	if err := validateUpstreamsConfig(&config.Upstreams, log); err != nil {
-		log.Error("Upstreams config validation failed", zap.Error(err))
-		return fmt.Errorf("upstreams config validation failed: %w", err)
+// Unwrap returns the underlying error
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is the set of problems found in a configuration
+type ValidationErrors []*ValidationError
+
+// Error lists every problem on its own line
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
 	}
+	return fmt.Sprintf("%d validation error(s):\n  %s", len(e), strings.Join(lines, "\n  "))
+}
 
-	if err := validateRoutesConfig(&config.Routes, &config.Upstreams, log); err != nil {
-		log.Error("Routes config validation failed", zap.Error(err))
-		return fmt.Errorf("routes config validation failed: %w", err)
+// Unwrap returns the individual problems
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
 	}
+	return errs
+}
 
-	if err := validateMiddlewareConfig(&config.Middleware, log); err != nil {
-		log.Error("Middleware config validation failed", zap.Error(err))
-		return fmt.Errorf("middleware config validation failed: %w", err)
+// ValidateConfig validates the entire configuration and reports every problem
+// found. The returned error is a ValidationErrors.
+func ValidateConfig(config *Config, log *zap.Logger) error {
+	var result ValidationErrors
+	collect := func(file string, errs []error) {
+		for _, err := range errs {
+			result = append(result, &ValidationError{File: file, Err: err})
+		}
 	}
 
-	if err := validateTLSConfig(&config.TLS, log); err != nil {
-		log.Error("TLS config validation failed", zap.Error(err))
-		return fmt.Errorf("TLS config validation failed: %w", err)
+	collect("global.yaml", validateGlobalConfig(&config.Global, log))
+	collect("upstreams.yaml", validateUpstreamsConfig(&config.Upstreams, log))
+	collect("routes.yaml", validateRoutesConfig(&config.Routes, &config.Upstreams, &config.Middleware, log))
+	collect("middleware.yaml", validateMiddlewareConfig(&config.Middleware, log))
+	collect("tls.yaml", validateTLSConfig(&config.TLS, log))
+
+	if len(result) > 0 {
+		log.Error("Configuration validation failed", zap.Int("errors", len(result)))
+		return result
 	}
 
 	return nil
 }
 
+// prefixErrors prefixes each error with the location it was found at
+func prefixErrors(prefix string, errs []error) []error {
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s: %w", prefix, err)
+	}
+	return errs
+}
+
 // validateGlobalConfig validates global configuration
-func validateGlobalConfig(config *GlobalConfig, log *zap.Logger) error {
+func validateGlobalConfig(config *GlobalConfig, log *zap.Logger) []error {
+	var errs []error
+
+	// Plugins register middleware types, which are validated later
+	for _, err := range loadPlugins(config.Plugins) {
+		log.Error("Failed to load plugin", zap.Error(err))
+		errs = append(errs, err)
+	}
+
 	if config.Server.HTTPPort < 1 || config.Server.HTTPPort > 65535 {
 		log.Error("Invalid HTTP port", zap.Int("port", config.Server.HTTPPort))
-		return fmt.Errorf("invalid HTTP port: %d", config.Server.HTTPPort)
+		errs = append(errs, fmt.Errorf("invalid HTTP port: %d", config.Server.HTTPPort))
 	}
 
 	if config.Server.HTTPSPort < 1 || config.Server.HTTPSPort > 65535 {
 		log.Error("Invalid HTTPS port", zap.Int("port", config.Server.HTTPSPort))
-		return fmt.Errorf("invalid HTTPS port: %d", config.Server.HTTPSPort)
+		errs = append(errs, fmt.Errorf("invalid HTTPS port: %d", config.Server.HTTPSPort))
 	}
 
 	if config.Server.HTTPPort == config.Server.HTTPSPort {
 		log.Error("HTTP and HTTPS ports cannot be the same", zap.Int("http_port", config.Server.HTTPPort), zap.Int("https_port", config.Server.HTTPSPort))
-		return fmt.Errorf("HTTP and HTTPS ports cannot be the same")
+		errs = append(errs, fmt.Errorf("HTTP and HTTPS ports cannot be the same"))
 	}
 
 	if config.Server.ReadTimeout < 0 {
 		log.Error("Read timeout cannot be negative", zap.Duration("timeout", config.Server.ReadTimeout))
-		return fmt.Errorf("read timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("read timeout cannot be negative"))
 	}
 
 	if config.Server.WriteTimeout < 0 {
 		log.Error("Write timeout cannot be negative", zap.Duration("timeout", config.Server.WriteTimeout))
-		return fmt.Errorf("write timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("write timeout cannot be negative"))
 	}
 
 	if config.Server.IdleTimeout < 0 {
 		log.Error("Idle timeout cannot be negative", zap.Duration("timeout", config.Server.IdleTimeout))
-		return fmt.Errorf("idle timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("idle timeout cannot be negative"))
 	}
 
 	if config.Server.MaxHeaderSize < 1024 {
 		log.Error("Max header size must be at least 1024 bytes", zap.Int("size", config.Server.MaxHeaderSize))
-		return fmt.Errorf("max header size must be at least 1024 bytes")
+		errs = append(errs, fmt.Errorf("max header size must be at least 1024 bytes"))
 	}
 
 	// HTTP2Enabled is a boolean, no validation needed
 
-	validLogLevels := []string{"debug", "info", "warn", "error"}
+	for _, proxy := range config.Server.ClientIP.TrustedProxies {
+		if _, err := ParseCIDR(proxy); err != nil {
+			log.Error("Invalid trusted proxy", zap.String("proxy", proxy), zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid client_ip trusted proxy %s: %w", proxy, err))
+		}
+	}
+
+	for _, header := range config.Server.ClientIP.Headers {
+		if strings.TrimSpace(header) == "" {
+			log.Error("Client IP header cannot be empty")
+			errs = append(errs, fmt.Errorf("client_ip headers cannot be empty"))
+			break
+		}
+	}
+
+	for _, caller := range config.Server.Deadlines.TrustedCallers {
+		if _, err := ParseCIDR(caller); err != nil {
+			log.Error("Invalid trusted caller", zap.String("caller", caller), zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid deadlines trusted caller %s: %w", caller, err))
+		}
+	}
+
+	if config.Server.Deadlines.MaxTimeout < 0 {
+		log.Error("Deadline max timeout cannot be negative", zap.Duration("max_timeout", config.Server.Deadlines.MaxTimeout))
+		errs = append(errs, fmt.Errorf("deadlines max_timeout cannot be negative"))
+	}
+
+	if overload := config.Server.Overload; overload.Enabled {
+		if overload.LatencyTarget <= 0 && overload.CPUTarget <= 0 {
+			log.Error("Overload protection requires latency_target or cpu_target")
+			errs = append(errs, fmt.Errorf("overload requires a positive latency_target or cpu_target"))
+		}
+		if overload.LatencyTarget < 0 || overload.CPUTarget < 0 || overload.CPUTarget > 1 {
+			log.Error("Invalid overload targets",
+				zap.Duration("latency_target", overload.LatencyTarget),
+				zap.Float64("cpu_target", overload.CPUTarget))
+			errs = append(errs, fmt.Errorf("overload latency_target cannot be negative and cpu_target must be between 0 and 1"))
+		}
+		if overload.Window < time.Second {
+			log.Error("Overload window must be at least 1s", zap.Duration("window", overload.Window))
+			errs = append(errs, fmt.Errorf("overload window must be at least 1s"))
+		}
+		if overload.MaxShedRatio <= 0 || overload.MaxShedRatio > 1 {
+			log.Error("Overload max_shed_ratio must be between 0 and 1", zap.Float64("max_shed_ratio", overload.MaxShedRatio))
+			errs = append(errs, fmt.Errorf("overload max_shed_ratio must be greater than 0 and at most 1"))
+		}
+		if overload.RetryAfter < 0 {
+			log.Error("Overload retry_after cannot be negative")
+			errs = append(errs, fmt.Errorf("overload retry_after cannot be negative"))
+		}
+	}
+
+	if limits := config.Server.ConnectionLimits; limits.MaxPerIP < 0 || limits.RatePerIP < 0 || limits.Burst < 0 {
+		log.Error("Connection limits cannot be negative",
+			zap.Int("max_per_ip", limits.MaxPerIP),
+			zap.Float64("rate_per_ip", limits.RatePerIP),
+			zap.Int("burst", limits.Burst))
+		errs = append(errs, fmt.Errorf("connection_limits max_per_ip, rate_per_ip and burst cannot be negative"))
+	}
+
+	if socket := config.Server.UnixSocket; socket.Path != "" {
+		if _, err := ParseFileMode(socket.Mode); err != nil {
+			log.Error("Invalid unix socket mode", zap.String("mode", socket.Mode))
+			errs = append(errs, fmt.Errorf("invalid unix_socket mode: %w", err))
+		}
+	} else if config.Server.ClientIP.TrustUnixSocket {
+		log.Error("client_ip trust_unix_socket requires a unix socket")
+		errs = append(errs, fmt.Errorf("client_ip trust_unix_socket requires unix_socket path"))
+	}
+
+	for _, entry := range config.Server.ConnectionLimits.Exempt {
+		if _, err := ParseCIDR(entry); err != nil {
+			log.Error("Invalid connection limit exemption", zap.String("exempt", entry), zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid connection_limits exemption %s: %w", entry, err))
+		}
+	}
+
+	redirect := config.Server.RedirectHTTPToHTTPS
+	switch redirect.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		log.Error("Invalid HTTPS redirect status code", zap.Int("status_code", redirect.StatusCode))
+		errs = append(errs, fmt.Errorf("invalid redirect_http_to_https status_code %d, must be one of: 301, 302, 307, 308", redirect.StatusCode))
+	}
+	if redirect.Port < 0 || redirect.Port > 65535 {
+		log.Error("Invalid HTTPS redirect port", zap.Int("port", redirect.Port))
+		errs = append(errs, fmt.Errorf("invalid redirect_http_to_https port: %d", redirect.Port))
+	}
+
 	if !contains(validLogLevels, config.Log.Level) {
 		log.Error("Invalid log level", zap.String("level", config.Log.Level))
-		return fmt.Errorf("invalid log level: %s, must be one of: %s",
-			config.Log.Level, strings.Join(validLogLevels, ", "))
+		errs = append(errs, fmt.Errorf("invalid log level: %s, must be one of: %s",
+			config.Log.Level, strings.Join(validLogLevels, ", ")))
 	}
 
-	validLogFormats := []string{"json", "text"}
 	if !contains(validLogFormats, config.Log.Format) {
 		log.Error("Invalid log format", zap.String("format", config.Log.Format))
-		return fmt.Errorf("invalid log format: %s, must be one of: %s",
-			config.Log.Format, strings.Join(validLogFormats, ", "))
+		errs = append(errs, fmt.Errorf("invalid log format: %s, must be one of: %s",
+			config.Log.Format, strings.Join(validLogFormats, ", ")))
 	}
 
-	return nil
+	for _, path := range append(config.Log.OutputPaths, config.Log.ErrorOutputPaths...) {
+		if strings.TrimSpace(path) == "" {
+			log.Error("Log output path cannot be empty")
+			errs = append(errs, fmt.Errorf("log output paths cannot be empty"))
+			break
+		}
+	}
+
+	if config.AccessLog.Enabled {
+		errs = append(errs, prefixErrors("access_log", validateAccessLog(&config.AccessLog, log))...)
+	}
+
+	if catalog := config.APICatalog; catalog.Enabled {
+		if !strings.HasPrefix(catalog.Path, "/") || strings.HasSuffix(catalog.Path, "/") {
+			log.Error("Invalid API catalog path", zap.String("path", catalog.Path))
+			errs = append(errs, fmt.Errorf("api_catalog path must start with / and not end with /: %q", catalog.Path))
+		}
+		if catalog.Refresh < 0 || catalog.Timeout <= 0 {
+			log.Error("API catalog refresh cannot be negative and timeout must be positive")
+			errs = append(errs, fmt.Errorf("api_catalog refresh cannot be negative and timeout must be positive"))
+		}
+	}
+
+	for i, webhook := range config.Notifications.ReloadWebhooks {
+		errs = append(errs, prefixErrors(fmt.Sprintf("reload_webhooks[%d]", i), validateWebhook(&webhook, validWebhookEvents, log))...)
+	}
+	for i, webhook := range config.Notifications.SLOWebhooks {
+		errs = append(errs, prefixErrors(fmt.Sprintf("slo_webhooks[%d]", i), validateWebhook(&webhook, validSLOEvents, log))...)
+	}
+
+	errs = append(errs, prefixErrors("slo", validateSLOSettings(&config.SLO, log))...)
+
+	if config.Admin.Enabled {
+		if config.Admin.Port < 1 || config.Admin.Port > 65535 {
+			log.Error("Invalid admin port", zap.Int("port", config.Admin.Port))
+			errs = append(errs, fmt.Errorf("invalid admin port: %d", config.Admin.Port))
+		}
+
+		if config.Admin.Port == config.Server.HTTPPort || config.Admin.Port == config.Server.HTTPSPort {
+			log.Error("Admin port conflicts with proxy ports", zap.Int("port", config.Admin.Port))
+			errs = append(errs, fmt.Errorf("admin port %d conflicts with proxy ports", config.Admin.Port))
+		}
+
+		if config.Admin.HistorySize < 1 {
+			log.Error("Admin history size must be positive", zap.Int("history_size", config.Admin.HistorySize))
+			errs = append(errs, fmt.Errorf("admin history size must be positive"))
+		}
+
+		// The admin API can replace the configuration, so only local
+		// clients may use it without a token
+		if config.Admin.Token == "" && !isLoopbackHost(config.Admin.BindAddress) {
+			log.Error("Admin API reachable from other hosts requires a token", zap.String("bind_address", config.Admin.BindAddress))
+			errs = append(errs, fmt.Errorf("admin token is required when bind_address %q is not a loopback address", config.Admin.BindAddress))
+		}
+	}
+
+	return errs
+}
+
+// isLoopbackHost reports whether a listener on host only accepts local
+// connections
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateAccessLog validates the access log settings
+func validateAccessLog(accessLog *AccessLogConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if accessLog.Path == "" && len(accessLog.Listeners) == 0 {
+		log.Error("Access log requires a path")
+		errs = append(errs, fmt.Errorf("path or listeners is required"))
+	}
+	for listener, path := range accessLog.Listeners {
+		if !contains(validListeners, listener) {
+			log.Error("Invalid access log listener", zap.String("listener", listener))
+			errs = append(errs, fmt.Errorf("invalid listener: %s, must be one of: %s",
+				listener, strings.Join(validListeners, ", ")))
+		}
+		if strings.TrimSpace(path) == "" {
+			log.Error("Access log path cannot be empty", zap.String("listener", listener))
+			errs = append(errs, fmt.Errorf("path of listener %s cannot be empty", listener))
+		}
+	}
+
+	if !contains(validAccessFormats, accessLog.Format) {
+		log.Error("Invalid access log format", zap.String("format", accessLog.Format))
+		errs = append(errs, fmt.Errorf("invalid format: %s, must be one of: %s",
+			accessLog.Format, strings.Join(validAccessFormats, ", ")))
+	}
+	if accessLog.Format == AccessLogTemplate && accessLog.Template == "" {
+		log.Error("Access log template format requires a template")
+		errs = append(errs, fmt.Errorf("template is required for the template format"))
+	}
+
+	rotation := accessLog.Rotation
+	if rotation.MaxSize < 0 || rotation.Interval < 0 || rotation.MaxBackups < 0 {
+		log.Error("Access log rotation settings cannot be negative")
+		errs = append(errs, fmt.Errorf("rotation max_size, interval and max_backups cannot be negative"))
+	}
+
+	return errs
+}
+
+// validateWebhook validates a notification webhook
+func validateWebhook(webhook *WebhookConfig, validEvents []string, log *zap.Logger) []error {
+	var errs []error
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Error("Invalid webhook URL", zap.String("url", webhook.URL))
+		errs = append(errs, fmt.Errorf("url must be an http(s) URL: %q", webhook.URL))
+	}
+	for _, event := range webhook.Events {
+		if !contains(validEvents, event) {
+			log.Error("Invalid webhook event", zap.String("event", event))
+			errs = append(errs, fmt.Errorf("invalid event: %s, must be one of: %s", event, strings.Join(validEvents, ", ")))
+		}
+	}
+	if webhook.Timeout <= 0 {
+		log.Error("Webhook timeout must be positive", zap.Duration("timeout", webhook.Timeout))
+		errs = append(errs, fmt.Errorf("timeout must be positive"))
+	}
+	if webhook.Attempts < 1 {
+		log.Error("Webhook attempts must be at least 1", zap.Int("attempts", webhook.Attempts))
+		errs = append(errs, fmt.Errorf("attempts must be at least 1"))
+	}
+
+	return errs
+}
+
+// validateSLOSettings validates the evaluation of route objectives
+func validateSLOSettings(settings *SLOSettings, log *zap.Logger) []error {
+	var errs []error
+
+	if settings.EvaluationInterval <= 0 {
+		log.Error("SLO evaluation interval must be positive")
+		errs = append(errs, fmt.Errorf("evaluation_interval must be positive"))
+	}
+	if settings.MinRequests < 0 {
+		log.Error("SLO min requests cannot be negative")
+		errs = append(errs, fmt.Errorf("min_requests cannot be negative"))
+	}
+
+	names := make(map[string]bool)
+	for i, alert := range settings.BurnAlerts {
+		if alert.Name == "" || names[alert.Name] {
+			log.Error("Burn alert names must be unique and not empty", zap.String("name", alert.Name))
+			errs = append(errs, fmt.Errorf("burn_alerts[%d]: name must be unique and not empty", i))
+		}
+		names[alert.Name] = true
+		if alert.ShortWindow < time.Minute || alert.LongWindow <= alert.ShortWindow {
+			log.Error("Invalid burn alert windows", zap.String("name", alert.Name))
+			errs = append(errs, fmt.Errorf("burn_alerts[%d]: short_window must be at least 1m and shorter than long_window", i))
+		}
+		if alert.BurnRate <= 0 {
+			log.Error("Burn alert rate must be positive", zap.String("name", alert.Name))
+			errs = append(errs, fmt.Errorf("burn_alerts[%d]: burn_rate must be positive", i))
+		}
+	}
+
+	return errs
+}
+
+// validateSLO validates the objectives of a route
+func validateSLO(slo *SLOConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if slo.Availability == 0 && slo.Latency == 0 {
+		log.Error("SLO needs an availability or latency objective", zap.String("slo", slo.Name))
+		errs = append(errs, fmt.Errorf("availability or latency must be set"))
+	}
+	if slo.Availability < 0 || slo.Availability >= 1 {
+		log.Error("Invalid SLO availability", zap.Float64("availability", slo.Availability))
+		errs = append(errs, fmt.Errorf("availability must be between 0 and 1: %v", slo.Availability))
+	}
+	if slo.Latency < 0 {
+		log.Error("SLO latency cannot be negative")
+		errs = append(errs, fmt.Errorf("latency cannot be negative"))
+	}
+	if (slo.Latency > 0) != (slo.LatencyTarget > 0) || slo.LatencyTarget < 0 || slo.LatencyTarget >= 1 {
+		log.Error("Invalid SLO latency target", zap.Float64("latency_target", slo.LatencyTarget))
+		errs = append(errs, fmt.Errorf("latency and a latency_target between 0 and 1 must be set together"))
+	}
+	if slo.Window < time.Hour || slo.Window > 90*24*time.Hour {
+		log.Error("Invalid SLO window", zap.Duration("window", slo.Window))
+		errs = append(errs, fmt.Errorf("window must be between 1h and 90 days: %s", slo.Window))
+	}
+
+	return errs
 }
 
 // validateUpstreamsConfig validates upstream configurations
-func validateUpstreamsConfig(config *UpstreamsConfig, log *zap.Logger) error {
+func validateUpstreamsConfig(config *UpstreamsConfig, log *zap.Logger) []error {
+	var errs []error
+
 	if len(config.Services) == 0 {
 		log.Error("At least one upstream service must be defined")
-		return fmt.Errorf("at least one upstream service must be defined")
+		errs = append(errs, fmt.Errorf("at least one upstream service must be defined"))
 	}
 
-	for name, service := range config.Services {
-		if err := validateUpstreamService(name, &service, log); err != nil {
-			log.Error("Upstream service validation failed", zap.String("service", name), zap.Error(err))
-			return fmt.Errorf("upstream service '%s' validation failed: %w", name, err)
+	for _, name := range sortedKeys(config.Services) {
+		service := config.Services[name]
+		errs = append(errs, prefixErrors(fmt.Sprintf("upstream service '%s'", name), validateUpstreamService(name, &service, log))...)
+	}
+
+	if config.Discovery.DNS.Interval < 0 {
+		log.Error("DNS discovery interval cannot be negative")
+		errs = append(errs, fmt.Errorf("discovery dns interval cannot be negative"))
+	}
+	if dns := config.Discovery.DNS; dns.MinInterval < 0 || (dns.Interval > 0 && dns.MinInterval > dns.Interval) {
+		log.Error("DNS discovery min interval must be between 0 and the interval", zap.Duration("min_interval", dns.MinInterval))
+		errs = append(errs, fmt.Errorf("discovery dns min_interval must be between 0 and interval"))
+	}
+	if resolver := config.Discovery.DNS.Resolver; resolver != "" {
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			log.Error("Invalid DNS resolver address", zap.String("resolver", resolver), zap.Error(err))
+			errs = append(errs, fmt.Errorf("discovery dns resolver must be host:port: %w", err))
 		}
 	}
 
-	return nil
+	return errs
 }
 
 // validateUpstreamService validates a single upstream service
-func validateUpstreamService(name string, service *UpstreamService, log *zap.Logger) error {
+func validateUpstreamService(name string, service *UpstreamService, log *zap.Logger) []error {
+	var errs []error
+
 	if name == "" {
 		log.Error("Upstream service name cannot be empty")
-		return fmt.Errorf("upstream service name cannot be empty")
+		errs = append(errs, fmt.Errorf("upstream service name cannot be empty"))
 	}
 
-	validLBStrategies := []string{"round_robin", "least_connections", "ip_hash"}
 	if !contains(validLBStrategies, service.LoadBalancer) {
 		log.Error("Invalid load balancer strategy", zap.String("strategy", service.LoadBalancer))
-		return fmt.Errorf("invalid load balancer strategy: %s, must be one of: %s",
-			service.LoadBalancer, strings.Join(validLBStrategies, ", "))
+		errs = append(errs, fmt.Errorf("invalid load balancer strategy: %s, must be one of: %s",
+			service.LoadBalancer, strings.Join(validLBStrategies, ", ")))
 	}
 
-	if len(service.Targets) == 0 {
+	if service.BlueGreen != nil {
+		if len(service.Targets) > 0 || service.TargetsFile != "" {
+			log.Error("Targets cannot be combined with blue/green target sets")
+			errs = append(errs, fmt.Errorf("targets cannot be combined with blue_green, list them under blue and green instead"))
+		}
+		errs = append(errs, prefixErrors("blue_green", validateBlueGreen(service.BlueGreen, log))...)
+	} else if len(service.Targets) == 0 && service.TargetsFile == "" {
 		log.Error("At least one target must be defined")
-		return fmt.Errorf("at least one target must be defined")
+		errs = append(errs, fmt.Errorf("at least one target or a targets_file must be defined"))
 	}
 
 	for i, target := range service.Targets {
-		if err := validateTarget(&target, log); err != nil {
-			log.Error("Target validation failed", zap.Int("target", i), zap.Error(err))
-			return fmt.Errorf("target %d validation failed: %w", i, err)
-		}
+		errs = append(errs, prefixErrors(fmt.Sprintf("target %d", i), validateTarget(&target, log))...)
 	}
 
 	if service.HealthCheck.Enabled {
-		if err := validateHealthCheck(&service.HealthCheck, log); err != nil {
-			log.Error("Health check validation failed", zap.Error(err))
-			return fmt.Errorf("health check validation failed: %w", err)
+		errs = append(errs, prefixErrors("health check", validateHealthCheck(&service.HealthCheck, log))...)
+	}
+
+	if service.Sticky != nil {
+		errs = append(errs, prefixErrors("sticky", validateSticky(service.Sticky, log))...)
+	}
+
+	if service.Prewarm != nil {
+		errs = append(errs, prefixErrors("prewarm", validatePrewarm(service.Prewarm, log))...)
+	}
+
+	if service.RetryBudget != nil {
+		errs = append(errs, prefixErrors("retry budget", validateRetryBudget(service.RetryBudget, log))...)
+	}
+
+	if service.OutlierDetection != nil {
+		errs = append(errs, prefixErrors("outlier detection", validateOutlierDetection(service.OutlierDetection, log))...)
+	}
+
+	if service.SlowStart != nil {
+		errs = append(errs, prefixErrors("slow start", validateSlowStart(service.SlowStart, log))...)
+	}
+
+	if service.DrainTimeout < 0 {
+		log.Error("Drain timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("drain_timeout cannot be negative"))
+	}
+
+	if service.Transport != nil {
+		errs = append(errs, prefixErrors("transport", validateTransport(service.Transport, log))...)
+		if service.Transport.DisableKeepAlives && service.Prewarm != nil {
+			log.Error("Prewarmed connections are closed with disable_keep_alives")
+			errs = append(errs, fmt.Errorf("prewarm cannot be combined with transport disable_keep_alives"))
 		}
 	}
 
-	return nil
+	if service.TLS != nil {
+		errs = append(errs, prefixErrors("tls", validateUpstreamTLS(service.TLS, log))...)
+	}
+
+	if service.OpenAPI != "" && !strings.HasPrefix(service.OpenAPI, "/") {
+		log.Error("OpenAPI document path must start with /", zap.String("openapi", service.OpenAPI))
+		errs = append(errs, fmt.Errorf("openapi must be a path starting with /: %q", service.OpenAPI))
+	}
+
+	return errs
 }
 
-// validateTarget validates an upstream target
-func validateTarget(target *Target, log *zap.Logger) error {
-	if target.URL == "" {
-		log.Error("Target URL cannot be empty")
-		return fmt.Errorf("target URL cannot be empty")
+// validateMirror validates traffic mirroring settings
+func validateMirror(mirror *MirrorConfig, upstream string, upstreams *UpstreamsConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if _, exists := upstreams.Services[mirror.Upstream]; !exists {
+		log.Error("Mirror upstream service not found", zap.String("upstream", mirror.Upstream))
+		errs = append(errs, fmt.Errorf("upstream service '%s' not found", mirror.Upstream))
+	} else if mirror.Upstream == upstream {
+		log.Error("Mirror upstream is the route's own upstream", zap.String("upstream", mirror.Upstream))
+		errs = append(errs, fmt.Errorf("upstream must differ from the route's upstream"))
+	}
+	if mirror.Percent <= 0 || mirror.Percent > 100 {
+		log.Error("Invalid mirror percent", zap.Float64("percent", mirror.Percent))
+		errs = append(errs, fmt.Errorf("percent must be greater than 0 and at most 100"))
+	}
+	if mirror.Timeout < 0 {
+		log.Error("Mirror timeout cannot be negative", zap.Duration("timeout", mirror.Timeout))
+		errs = append(errs, fmt.Errorf("timeout cannot be negative"))
+	}
+	if mirror.MaxBodySize < 0 {
+		log.Error("Mirror max_body_size cannot be negative", zap.Int64("max_body_size", mirror.MaxBodySize))
+		errs = append(errs, fmt.Errorf("max_body_size cannot be negative"))
 	}
 
-	parsedURL, err := url.Parse(target.URL)
-	if err != nil {
-		log.Error("Invalid target URL", zap.String("url", target.URL), zap.Error(err))
-		return fmt.Errorf("invalid target URL: %w", err)
+	return errs
+}
+
+// validateRequestBuffering validates request body buffering settings
+func validateRequestBuffering(buffering *RequestBufferingConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if buffering.MemoryLimit < 0 || buffering.MaxSize < buffering.MemoryLimit {
+		log.Error("Invalid request buffering sizes",
+			zap.Int64("memory_limit", buffering.MemoryLimit),
+			zap.Int64("max_size", buffering.MaxSize))
+		errs = append(errs, fmt.Errorf("max_size must be at least memory_limit, which cannot be negative"))
+	}
+
+	return errs
+}
+
+// validateSticky validates sticky session settings
+func validateSticky(sticky *StickyConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if !validCookieName(sticky.Cookie) {
+		log.Error("Invalid sticky session cookie name", zap.String("cookie", sticky.Cookie))
+		errs = append(errs, fmt.Errorf("invalid cookie name: %q", sticky.Cookie))
+	}
+	if sticky.TTL <= 0 {
+		log.Error("Sticky session ttl must be positive", zap.Duration("ttl", sticky.TTL))
+		errs = append(errs, fmt.Errorf("ttl must be positive"))
+	}
+	switch sticky.Store {
+	case "memory":
+	case "redis":
+		if sticky.Redis.Address == "" {
+			log.Error("Redis sticky session store requires an address")
+			errs = append(errs, fmt.Errorf("redis store requires redis.address"))
+		}
+		if sticky.StoreTimeout <= 0 {
+			log.Error("Sticky session store_timeout must be positive", zap.Duration("store_timeout", sticky.StoreTimeout))
+			errs = append(errs, fmt.Errorf("store_timeout must be positive"))
+		}
+	default:
+		log.Error("Invalid sticky session store", zap.String("store", sticky.Store))
+		errs = append(errs, fmt.Errorf("invalid store: %s, must be one of: memory, redis", sticky.Store))
+	}
+
+	return errs
+}
+
+// validCookieName reports whether name is a valid cookie name token
+func validCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`()<>@,;:\"/[]?={}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRetryBudget validates retry budget settings
+func validateRetryBudget(budget *RetryBudgetConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if budget.Percent <= 0 || budget.Percent > 100 {
+		log.Error("Invalid retry budget percent", zap.Float64("percent", budget.Percent))
+		errs = append(errs, fmt.Errorf("percent must be greater than 0 and at most 100"))
+	}
+	if budget.Window < time.Second {
+		log.Error("Retry budget window must be at least 1s", zap.Duration("window", budget.Window))
+		errs = append(errs, fmt.Errorf("window must be at least 1s"))
 	}
+	if budget.MinRetries < 0 {
+		log.Error("Retry budget min_retries cannot be negative", zap.Int("min_retries", budget.MinRetries))
+		errs = append(errs, fmt.Errorf("min_retries cannot be negative"))
+	}
+
+	return errs
+}
 
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		log.Error("Target URL scheme must be http or https")
-		return fmt.Errorf("target URL scheme must be http or https")
+// validateOutlierDetection validates passive health checking settings
+func validateOutlierDetection(outliers *OutlierDetectionConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if outliers.Consecutive5xx < 0 || outliers.ConsecutiveConnectFailures < 0 {
+		log.Error("Outlier detection thresholds cannot be negative",
+			zap.Int("consecutive_5xx", outliers.Consecutive5xx),
+			zap.Int("consecutive_connect_failures", outliers.ConsecutiveConnectFailures))
+		errs = append(errs, fmt.Errorf("consecutive_5xx and consecutive_connect_failures cannot be negative"))
+	}
+	if outliers.BaseEjectionTime < 0 || outliers.MaxEjectionTime < outliers.BaseEjectionTime {
+		log.Error("Invalid outlier ejection times",
+			zap.Duration("base_ejection_time", outliers.BaseEjectionTime),
+			zap.Duration("max_ejection_time", outliers.MaxEjectionTime))
+		errs = append(errs, fmt.Errorf("max_ejection_time must be at least base_ejection_time, which cannot be negative"))
+	}
+	if outliers.MaxEjectionPercent < 0 || outliers.MaxEjectionPercent > 100 {
+		log.Error("Invalid outlier max_ejection_percent", zap.Int("max_ejection_percent", outliers.MaxEjectionPercent))
+		errs = append(errs, fmt.Errorf("max_ejection_percent must be between 0 and 100"))
 	}
+	if outliers.RecoveryWindow < 0 {
+		log.Error("Outlier recovery_window cannot be negative", zap.Duration("recovery_window", outliers.RecoveryWindow))
+		errs = append(errs, fmt.Errorf("recovery_window cannot be negative"))
+	}
+
+	return errs
+}
 
-	if parsedURL.Host == "" {
-		log.Error("Target URL must have a host")
-		return fmt.Errorf("target URL must have a host")
+// validateSlowStart validates the ramp up of added and recovered targets
+func validateSlowStart(slowStart *SlowStartConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if slowStart.Window < 0 {
+		log.Error("Slow start window cannot be negative", zap.Duration("window", slowStart.Window))
+		errs = append(errs, fmt.Errorf("window cannot be negative"))
+	}
+	if slowStart.MinPercent < 0 || slowStart.MinPercent > 100 {
+		log.Error("Invalid slow start min_percent", zap.Int("min_percent", slowStart.MinPercent))
+		errs = append(errs, fmt.Errorf("min_percent must be between 0 and 100"))
+	}
+
+	return errs
+}
+
+// validateTransport validates connection pool settings
+func validateTransport(transport *TransportConfig, log *zap.Logger) []error {
+	var errs []error
+
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"max_idle_conns", transport.MaxIdleConns},
+		{"max_idle_conns_per_host", transport.MaxIdleConnsPerHost},
+		{"max_conns_per_host", transport.MaxConnsPerHost},
+	} {
+		if limit.value < 0 {
+			log.Error("Transport connection limit cannot be negative", zap.String("setting", limit.name), zap.Int("value", limit.value))
+			errs = append(errs, fmt.Errorf("%s cannot be negative", limit.name))
+		}
+	}
+	if transport.MaxConnsPerHost > 0 && transport.MaxIdleConnsPerHost > transport.MaxConnsPerHost {
+		log.Error("Transport max_idle_conns_per_host exceeds max_conns_per_host",
+			zap.Int("max_idle_conns_per_host", transport.MaxIdleConnsPerHost),
+			zap.Int("max_conns_per_host", transport.MaxConnsPerHost))
+		errs = append(errs, fmt.Errorf("max_idle_conns_per_host cannot exceed max_conns_per_host"))
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"idle_conn_timeout", transport.IdleConnTimeout},
+		{"dial_timeout", transport.DialTimeout},
+		{"keep_alive", transport.KeepAlive},
+		{"tls_handshake_timeout", transport.TLSHandshakeTimeout},
+		{"response_header_timeout", transport.ResponseHeaderTimeout},
+		{"expect_continue_timeout", transport.ExpectContinueTimeout},
+	} {
+		if timeout.value < 0 {
+			log.Error("Transport timeout cannot be negative", zap.String("setting", timeout.name), zap.Duration("value", timeout.value))
+			errs = append(errs, fmt.Errorf("%s cannot be negative", timeout.name))
+		}
+	}
+
+	return errs
+}
+
+// validateUpstreamTLS validates the TLS settings of connections to targets
+func validateUpstreamTLS(tls *UpstreamTLSConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		log.Error("Upstream TLS client certificate needs both cert_file and key_file",
+			zap.String("cert_file", tls.CertFile),
+			zap.String("key_file", tls.KeyFile))
+		errs = append(errs, fmt.Errorf("cert_file and key_file must be set together"))
+	}
+	if tls.InsecureSkipVerify && tls.CAFile != "" {
+		log.Error("Upstream TLS ca_file has no effect with insecure_skip_verify", zap.String("ca_file", tls.CAFile))
+		errs = append(errs, fmt.Errorf("ca_file cannot be combined with insecure_skip_verify"))
+	}
+
+	return errs
+}
+
+// validatePrewarm validates connection prewarming settings
+func validatePrewarm(prewarm *PrewarmConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if prewarm.Connections < 1 {
+		log.Error("Prewarm connections must be positive", zap.Int("connections", prewarm.Connections))
+		errs = append(errs, fmt.Errorf("connections must be positive"))
+	}
+	if prewarm.Requests < 0 {
+		log.Error("Prewarm requests cannot be negative", zap.Int("requests", prewarm.Requests))
+		errs = append(errs, fmt.Errorf("requests cannot be negative"))
+	}
+	if !contains(validMethods, prewarm.Method) {
+		log.Error("Invalid prewarm method", zap.String("method", prewarm.Method))
+		errs = append(errs, fmt.Errorf("invalid method: %s, must be one of: %s",
+			prewarm.Method, strings.Join(validMethods, ", ")))
+	}
+	if !strings.HasPrefix(prewarm.Path, "/") {
+		log.Error("Prewarm path must start with /", zap.String("path", prewarm.Path))
+		errs = append(errs, fmt.Errorf("path must start with /"))
+	}
+	if prewarm.Timeout < 0 {
+		log.Error("Prewarm timeout cannot be negative", zap.Duration("timeout", prewarm.Timeout))
+		errs = append(errs, fmt.Errorf("timeout cannot be negative"))
+	}
+
+	return errs
+}
+
+// validateBlueGreen validates blue/green target sets
+func validateBlueGreen(bg *BlueGreenConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if bg.Active != ColorBlue && bg.Active != ColorGreen {
+		log.Error("Invalid active blue/green target set", zap.String("active", bg.Active))
+		errs = append(errs, fmt.Errorf("invalid active target set: %s, must be one of: %s, %s", bg.Active, ColorBlue, ColorGreen))
+	}
+
+	for _, color := range []string{ColorBlue, ColorGreen} {
+		targets := bg.ColorTargets(color)
+		if len(targets) == 0 {
+			log.Error("Blue/green target set is empty", zap.String("set", color))
+			errs = append(errs, fmt.Errorf("at least one %s target must be defined", color))
+		}
+		for i, target := range targets {
+			errs = append(errs, prefixErrors(fmt.Sprintf("%s target %d", color, i), validateTarget(&target, log))...)
+		}
+	}
+
+	if bg.Rollback.ErrorRate < 0 || bg.Rollback.ErrorRate > 1 {
+		log.Error("Invalid rollback error rate", zap.Float64("error_rate", bg.Rollback.ErrorRate))
+		errs = append(errs, fmt.Errorf("rollback error_rate must be between 0 and 1"))
+	}
+	if bg.Rollback.Window < 0 {
+		log.Error("Invalid rollback window", zap.Duration("window", bg.Rollback.Window))
+		errs = append(errs, fmt.Errorf("rollback window cannot be negative"))
+	}
+	if bg.Rollback.MinRequests < 0 {
+		log.Error("Invalid rollback minimum requests", zap.Int("min_requests", bg.Rollback.MinRequests))
+		errs = append(errs, fmt.Errorf("rollback min_requests cannot be negative"))
+	}
+
+	return errs
+}
+
+// validateTarget validates an upstream target
+func validateTarget(target *Target, log *zap.Logger) []error {
+	var errs []error
+
+	if target.URL == "" {
+		log.Error("Target URL cannot be empty")
+		errs = append(errs, fmt.Errorf("target URL cannot be empty"))
+	} else if IsDynamicTarget(target.URL) {
+		if err := validateDynamicTarget(target.URL); err != nil {
+			log.Error("Invalid dynamic target", zap.String("url", target.URL), zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid dynamic target: %w", err))
+		}
+	} else if parsedURL, err := url.Parse(target.URL); err != nil {
+		log.Error("Invalid target URL", zap.String("url", target.URL), zap.Error(err))
+		errs = append(errs, fmt.Errorf("invalid target URL: %w", err))
+	} else {
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			log.Error("Target URL scheme must be http or https")
+			errs = append(errs, fmt.Errorf("target URL scheme must be http or https"))
+		}
+
+		if parsedURL.Host == "" {
+			log.Error("Target URL must have a host")
+			errs = append(errs, fmt.Errorf("target URL must have a host"))
+		}
 	}
 
 	if target.Weight < 0 {
 		log.Error("Target weight cannot be negative")
-		return fmt.Errorf("target weight cannot be negative")
+		errs = append(errs, fmt.Errorf("target weight cannot be negative"))
 	}
 
-	return nil
+	switch target.Protocol {
+	case "", ProtocolHTTP, ProtocolGRPC:
+	default:
+		log.Error("Invalid target protocol", zap.String("protocol", target.Protocol))
+		errs = append(errs, fmt.Errorf("invalid target protocol: %s, must be one of: %s, %s", target.Protocol, ProtocolHTTP, ProtocolGRPC))
+	}
+
+	return errs
 }
 
 // validateHealthCheck validates health check configuration
-func validateHealthCheck(hc *HealthCheckConfig, log *zap.Logger) error {
-	if hc.Path == "" {
-		log.Error("Health check path cannot be empty")
-		return fmt.Errorf("health check path cannot be empty")
+func validateHealthCheck(hc *HealthCheckConfig, log *zap.Logger) []error {
+	var errs []error
+
+	if hc.Type != "" && !contains(validHealthTypes, hc.Type) {
+		log.Error("Invalid health check type", zap.String("type", hc.Type))
+		errs = append(errs, fmt.Errorf("invalid health check type: %s, must be one of: %s",
+			hc.Type, strings.Join(validHealthTypes, ", ")))
 	}
 
-	if !strings.HasPrefix(hc.Path, "/") {
+	if hc.Type == HealthCheckTCP {
+		if hc.Path != "" || len(hc.ExpectedStatuses) > 0 || hc.ExpectedBody != "" || len(hc.Headers) > 0 {
+			log.Error("TCP health checks send no request")
+			errs = append(errs, fmt.Errorf("tcp health checks take no path, expected_statuses, expected_body or headers"))
+		}
+	} else if hc.Path == "" {
+		log.Error("Health check path cannot be empty")
+		errs = append(errs, fmt.Errorf("health check path cannot be empty"))
+	} else if !strings.HasPrefix(hc.Path, "/") {
 		log.Error("Health check path must start with '/'")
-		return fmt.Errorf("health check path must start with '/'")
+		errs = append(errs, fmt.Errorf("health check path must start with '/'"))
+	}
+
+	for _, status := range hc.ExpectedStatuses {
+		if status < 100 || status > 599 {
+			log.Error("Invalid expected health check status", zap.Int("status", status))
+			errs = append(errs, fmt.Errorf("invalid expected status %d, must be between 100 and 599", status))
+		}
 	}
 
 	if hc.Interval <= 0 {
 		log.Error("Health check interval must be positive")
-		return fmt.Errorf("health check interval must be positive")
+		errs = append(errs, fmt.Errorf("health check interval must be positive"))
 	}
 
 	if hc.Timeout <= 0 {
 		log.Error("Health check timeout must be positive")
-		return fmt.Errorf("health check timeout must be positive")
+		errs = append(errs, fmt.Errorf("health check timeout must be positive"))
 	}
 
 	if hc.FailureThreshold <= 0 {
 		log.Error("Health check failure threshold must be positive")
-		return fmt.Errorf("health check failure threshold must be positive")
+		errs = append(errs, fmt.Errorf("health check failure threshold must be positive"))
 	}
 
 	if hc.SuccessThreshold <= 0 {
 		log.Error("Health check success threshold must be positive")
-		return fmt.Errorf("health check success threshold must be positive")
+		errs = append(errs, fmt.Errorf("health check success threshold must be positive"))
 	}
 
-	return nil
+	return errs
 }
 
 // validateRoutesConfig validates route configurations
-func validateRoutesConfig(config *RoutesConfig, upstreams *UpstreamsConfig, log *zap.Logger) error {
+func validateRoutesConfig(config *RoutesConfig, upstreams *UpstreamsConfig, middleware *MiddlewareConfig, log *zap.Logger) []error {
+	var errs []error
+
 	if len(config.Rules) == 0 {
 		log.Error("At least one route rule must be defined")
-		return fmt.Errorf("at least one route rule must be defined")
+		errs = append(errs, fmt.Errorf("at least one route rule must be defined"))
 	}
 
+	sloNames := make(map[string]bool)
 	for i, rule := range config.Rules {
-		if err := validateRouteRule(&rule, upstreams, log); err != nil {
-			log.Error("Route rule validation failed", zap.Int("rule", i), zap.Error(err))
-			return fmt.Errorf("route rule %d validation failed: %w", i, err)
+		errs = append(errs, prefixErrors(fmt.Sprintf("route rule %d", i), validateRouteRule(&rule, upstreams, middleware, log))...)
+		if rule.SLO == nil {
+			continue
 		}
+		if sloNames[rule.SLO.Name] {
+			log.Error("Duplicate SLO name", zap.String("slo", rule.SLO.Name))
+			errs = append(errs, fmt.Errorf("route rule %d: slo name %q is used by another route", i, rule.SLO.Name))
+		}
+		sloNames[rule.SLO.Name] = true
 	}
 
-	return nil
+	return errs
 }
 
 // validateRouteRule validates a single route rule
-func validateRouteRule(rule *RouteRule, upstreams *UpstreamsConfig, log *zap.Logger) error {
+func validateRouteRule(rule *RouteRule, upstreams *UpstreamsConfig, middleware *MiddlewareConfig, log *zap.Logger) []error {
+	var errs []error
+
 	if rule.Host == "" {
 		log.Error("Route host cannot be empty")
-		return fmt.Errorf("route host cannot be empty")
+		errs = append(errs, fmt.Errorf("route host cannot be empty"))
+	} else if err := router.ValidateHost(rule.Host); err != nil {
+		log.Error("Invalid route host", zap.String("host", rule.Host), zap.Error(err))
+		errs = append(errs, err)
 	}
 
 	if rule.Path == "" {
 		log.Error("Route path cannot be empty")
-		return fmt.Errorf("route path cannot be empty")
+		errs = append(errs, fmt.Errorf("route path cannot be empty"))
+	} else if _, err := router.ParsePath(rule.Path); err != nil {
+		log.Error("Invalid route path", zap.String("path", rule.Path), zap.Error(err))
+		errs = append(errs, err)
 	}
 
-	if !strings.HasPrefix(rule.Path, "/") {
-		log.Error("Route path must start with '/'")
-		return fmt.Errorf("route path must start with '/'")
+	for _, condition := range RouterConditions(rule.HeadersMatch) {
+		if err := router.ValidateCondition(condition); err != nil {
+			log.Error("Invalid route header condition", zap.Error(err))
+			errs = append(errs, fmt.Errorf("headers_match: %w", err))
+		}
+	}
+	for _, condition := range RouterConditions(rule.QueryMatch) {
+		if err := router.ValidateCondition(condition); err != nil {
+			log.Error("Invalid route query condition", zap.Error(err))
+			errs = append(errs, fmt.Errorf("query_match: %w", err))
+		}
 	}
 
 	if rule.Upstream == "" {
 		log.Error("Route upstream cannot be empty")
-		return fmt.Errorf("route upstream cannot be empty")
-	}
-
-	if _, exists := upstreams.Services[rule.Upstream]; !exists {
+		errs = append(errs, fmt.Errorf("route upstream cannot be empty"))
+	} else if _, exists := upstreams.Services[rule.Upstream]; !exists {
 		log.Error("Upstream service not found", zap.String("upstream", rule.Upstream))
-		return fmt.Errorf("upstream service '%s' not found", rule.Upstream)
+		errs = append(errs, fmt.Errorf("upstream service '%s' not found", rule.Upstream))
 	}
 
-	validMethods := []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
 	for _, method := range rule.Methods {
 		if !contains(validMethods, method) {
 			log.Error("Invalid HTTP method", zap.String("method", method))
-			return fmt.Errorf("invalid HTTP method: %s", method)
+			errs = append(errs, fmt.Errorf("invalid HTTP method: %s", method))
 		}
 	}
 
 	if rule.Rewrite.Regex != "" {
 		if _, err := regexp.Compile(rule.Rewrite.Regex); err != nil {
 			log.Error("Invalid rewrite regex", zap.String("regex", rule.Rewrite.Regex), zap.Error(err))
-			return fmt.Errorf("invalid rewrite regex: %w", err)
+			errs = append(errs, fmt.Errorf("invalid rewrite regex: %w", err))
 		}
 	}
 
 	// Validate rewrite configuration
 	if rule.Rewrite.StripPrefix != "" && !strings.HasPrefix(rule.Rewrite.StripPrefix, "/") {
 		log.Error("Rewrite strip_prefix must start with '/'")
-		return fmt.Errorf("rewrite strip_prefix must start with '/'")
+		errs = append(errs, fmt.Errorf("rewrite strip_prefix must start with '/'"))
 	}
 
 	if rule.Rewrite.AddPrefix != "" && !strings.HasPrefix(rule.Rewrite.AddPrefix, "/") {
 		log.Error("Rewrite add_prefix must start with '/'")
-		return fmt.Errorf("rewrite add_prefix must start with '/'")
+		errs = append(errs, fmt.Errorf("rewrite add_prefix must start with '/'"))
 	}
 
 	if rule.Rewrite.Regex != "" && rule.Rewrite.Replacement == "" {
 		log.Error("Rewrite replacement is required when regex is specified")
-		return fmt.Errorf("rewrite replacement is required when regex is specified")
+		errs = append(errs, fmt.Errorf("rewrite replacement is required when regex is specified"))
 	}
 
 	if rule.Timeout < 0 {
 		log.Error("Route timeout cannot be negative")
-		return fmt.Errorf("route timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("route timeout cannot be negative"))
+	}
+
+	if rule.MaxResponseSize < 0 {
+		log.Error("Route max response size cannot be negative")
+		errs = append(errs, fmt.Errorf("route max_response_size cannot be negative"))
 	}
 
 	if rule.RetryPolicy.Attempts < 0 {
 		log.Error("Retry attempts cannot be negative")
-		return fmt.Errorf("retry attempts cannot be negative")
+		errs = append(errs, fmt.Errorf("retry attempts cannot be negative"))
 	}
 
 	if rule.RetryPolicy.Backoff < 0 {
 		log.Error("Retry backoff cannot be negative")
-		return fmt.Errorf("retry backoff cannot be negative")
+		errs = append(errs, fmt.Errorf("retry backoff cannot be negative"))
 	}
 
-	return nil
+	if rule.RetryPolicy.PerTryTimeout < 0 {
+		log.Error("Retry per-try timeout cannot be negative")
+		errs = append(errs, fmt.Errorf("retry per_try_timeout cannot be negative"))
+	}
+
+	for _, condition := range rule.RetryPolicy.RetryOn {
+		if contains(validRetryConditions, condition) {
+			continue
+		}
+		if status, err := strconv.Atoi(condition); err != nil || status < 100 || status > 599 {
+			log.Error("Invalid retry condition", zap.String("retry_on", condition))
+			errs = append(errs, fmt.Errorf("invalid retry_on condition: %s, must be a status code or one of: %s",
+				condition, strings.Join(validRetryConditions, ", ")))
+		}
+	}
+
+	if rule.Mirror != nil {
+		errs = append(errs, prefixErrors("mirror", validateMirror(rule.Mirror, rule.Upstream, upstreams, log))...)
+	}
+
+	if rule.RequestBuffering != nil {
+		errs = append(errs, prefixErrors("request buffering", validateRequestBuffering(rule.RequestBuffering, log))...)
+	}
+
+	if rule.SLO != nil {
+		errs = append(errs, prefixErrors("slo", validateSLO(rule.SLO, log))...)
+	}
+
+	if o := rule.Observability; o != nil {
+		if o.AccessLog != "" && !contains(validAccessLogLevels, o.AccessLog) {
+			log.Error("Invalid observability access log level", zap.String("access_log", o.AccessLog))
+			errs = append(errs, fmt.Errorf("invalid observability access_log: %s, must be one of: %s",
+				o.AccessLog, strings.Join(validAccessLogLevels, ", ")))
+		}
+		if o.Events != "" && !contains(validEventsLevels, o.Events) {
+			log.Error("Invalid observability events level", zap.String("events", o.Events))
+			errs = append(errs, fmt.Errorf("invalid observability events: %s, must be one of: %s",
+				o.Events, strings.Join(validEventsLevels, ", ")))
+		}
+	}
+
+	// Validate inline middleware overrides against their definitions
+	for _, ref := range rule.Middleware {
+		if ref.Name == "" {
+			log.Error("Route middleware name cannot be empty")
+			errs = append(errs, fmt.Errorf("route middleware name cannot be empty"))
+			continue
+		}
+		if len(ref.Config) == 0 {
+			continue
+		}
+
+		var definition *MiddlewareChain
+		for i := range middleware.Chain {
+			if middleware.Chain[i].Name == ref.Name {
+				definition = &middleware.Chain[i]
+				break
+			}
+		}
+		if definition == nil {
+			log.Error("Overridden middleware not found", zap.String("middleware", ref.Name))
+			errs = append(errs, fmt.Errorf("middleware '%s' overridden by route is not defined", ref.Name))
+			continue
+		}
+
+		merged := MergeMiddlewareConfig(definition.Config, ref.Config)
+		errs = append(errs, prefixErrors(fmt.Sprintf("middleware '%s' override", ref.Name), validateMiddlewareSpecificConfig(definition.Type, merged, log))...)
+	}
+
+	return errs
 }
 
 // validateMiddlewareConfig validates middleware configuration
-func validateMiddlewareConfig(config *MiddlewareConfig, log *zap.Logger) error {
+func validateMiddlewareConfig(config *MiddlewareConfig, log *zap.Logger) []error {
+	var errs []error
+
 	orders := make(map[int]bool)
 	names := make(map[string]bool)
 
 	for i, middleware := range config.Chain {
 		if middleware.Name == "" {
 			log.Error("Middleware name cannot be empty", zap.Int("middleware", i))
-			return fmt.Errorf("middleware %d name cannot be empty", i)
+			errs = append(errs, fmt.Errorf("middleware %d name cannot be empty", i))
 		}
 
 		if names[middleware.Name] {
 			log.Error("Duplicate middleware name", zap.String("name", middleware.Name))
-			return fmt.Errorf("duplicate middleware name: %s", middleware.Name)
+			errs = append(errs, fmt.Errorf("duplicate middleware name: %s", middleware.Name))
 		}
 		names[middleware.Name] = true
 
 		if orders[middleware.Order] {
 			log.Error("Duplicate middleware order", zap.Int("order", middleware.Order))
-			return fmt.Errorf("duplicate middleware order: %d", middleware.Order)
+			errs = append(errs, fmt.Errorf("duplicate middleware order: %d", middleware.Order))
 		}
 		orders[middleware.Order] = true
 
-		validTypes := []string{"logging", "rate_limit", "auth", "cors", "compression"}
-		if !contains(validTypes, middleware.Type) {
+		if types := middlewareTypes(); !contains(types, middleware.Type) {
 			log.Error("Invalid middleware type", zap.String("type", middleware.Type))
-			return fmt.Errorf("invalid middleware type: %s, must be one of: %s",
-				middleware.Type, strings.Join(validTypes, ", "))
+			errs = append(errs, fmt.Errorf("invalid middleware type: %s, must be one of: %s",
+				middleware.Type, strings.Join(types, ", ")))
 		}
 
 		// Validate middleware-specific configuration
-		if err := validateMiddlewareSpecificConfig(middleware.Type, middleware.Config, log); err != nil {
-			log.Error("Middleware config validation failed", zap.String("middleware", middleware.Name), zap.Error(err))
-			return fmt.Errorf("middleware '%s' config validation failed: %w", middleware.Name, err)
-		}
+		errs = append(errs, prefixErrors(fmt.Sprintf("middleware '%s'", middleware.Name), validateMiddlewareSpecificConfig(middleware.Type, middleware.Config, log))...)
 	}
 
-	return nil
+	return errs
 }
 
-// validateMiddlewareSpecificConfig validates middleware-specific configuration
-func validateMiddlewareSpecificConfig(middlewareType string, config map[string]any, log *zap.Logger) error {
-	switch middlewareType {
-	case "auth":
-		// Validate auth middleware config
-		if secret, ok := config["jwt_secret"].(string); !ok || secret == "" {
-			if secretKey, ok := config["secret_key"].(string); !ok || secretKey == "" {
-				log.Error("Auth middleware requires jwt_secret or secret_key")
-				return fmt.Errorf("auth middleware requires jwt_secret or secret_key")
+// validateMiddlewareSpecificConfig decodes and validates middleware-specific
+// configuration
+func validateMiddlewareSpecificConfig(middlewareType string, config map[string]any, log *zap.Logger) []error {
+	var errs []error
+
+	if validate, ok := pluginMiddlewareValidator(middlewareType); ok {
+		if err := validate(config); err != nil {
+			log.Error("Invalid middleware config", zap.String("type", middlewareType), zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid %s config: %w", middlewareType, err))
+		}
+		return errs
+	}
+
+	typed, err := DecodeMiddlewareConfig(middlewareType, config)
+	if err != nil {
+		log.Error("Invalid middleware config", zap.String("type", middlewareType), zap.Error(err))
+		return append(errs, fmt.Errorf("invalid %s config: %w", middlewareType, err))
+	}
+
+	switch cfg := typed.(type) {
+	case *AuthMiddlewareConfig:
+		if cfg.JWTSecret == "" && cfg.PublicKey == "" && cfg.JWKSURL == "" {
+			log.Error("Auth middleware requires jwt_secret, secret_key, public_key or jwks_url")
+			errs = append(errs, fmt.Errorf("auth middleware requires jwt_secret, secret_key, public_key or jwks_url"))
+		}
+		if cfg.PublicKey != "" {
+			if _, err := ParsePublicKey(cfg.PublicKey); err != nil {
+				log.Error("Invalid auth public_key", zap.Error(err))
+				errs = append(errs, fmt.Errorf("invalid auth public_key: %w", err))
+			}
+		}
+		if cfg.JWKSURL != "" {
+			if u, err := url.Parse(cfg.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				log.Error("Auth jwks_url must be an http:// or https:// URL", zap.String("jwks_url", cfg.JWKSURL))
+				errs = append(errs, fmt.Errorf("auth jwks_url must be an http:// or https:// URL, got %q", cfg.JWKSURL))
+			}
+			if cfg.JWKSRefreshInterval <= 0 {
+				log.Error("Auth jwks_refresh_interval must be positive")
+				errs = append(errs, fmt.Errorf("auth jwks_refresh_interval must be positive"))
+			}
+		}
+		for _, algorithm := range cfg.Algorithms {
+			if !contains(validJWTAlgorithms, algorithm) {
+				log.Error("Invalid auth algorithm", zap.String("algorithm", algorithm))
+				errs = append(errs, fmt.Errorf("invalid auth algorithm: %s, must be one of: %s",
+					algorithm, strings.Join(validJWTAlgorithms, ", ")))
 			}
 		}
-	case "rate_limit":
-		// Validate rate limit middleware config
-		if rps, ok := config["requests_per_second"].(int); !ok || rps <= 0 {
+	case *RateLimitMiddlewareConfig:
+		if cfg.RequestsPerSecond <= 0 {
 			log.Error("Rate limit middleware requires positive requests_per_second")
-			return fmt.Errorf("rate_limit middleware requires positive requests_per_second")
+			errs = append(errs, fmt.Errorf("rate_limit middleware requires positive requests_per_second"))
 		}
-		if burst, ok := config["burst"].(int); !ok || burst <= 0 {
+		if cfg.Burst <= 0 {
 			log.Error("Rate limit middleware requires positive burst")
-			return fmt.Errorf("rate_limit middleware requires positive burst")
-		}
-		if keyFunc, ok := config["key_func"].(string); ok {
-			validKeyFuncs := []string{"ip", "user", "global"}
-			if !contains(validKeyFuncs, keyFunc) {
-				log.Error("Invalid key_func", zap.String("key_func", keyFunc))
-				return fmt.Errorf("invalid key_func: %s, must be one of: %s",
-					keyFunc, strings.Join(validKeyFuncs, ", "))
+			errs = append(errs, fmt.Errorf("rate_limit middleware requires positive burst"))
+		}
+		if !contains(validKeyFuncs, cfg.KeyFunc) {
+			log.Error("Invalid key_func", zap.String("key_func", cfg.KeyFunc))
+			errs = append(errs, fmt.Errorf("invalid key_func: %s, must be one of: %s",
+				cfg.KeyFunc, strings.Join(validKeyFuncs, ", ")))
+		}
+		if cfg.TTL <= 0 || cfg.CleanupInterval <= 0 {
+			log.Error("Rate limit ttl and cleanup_interval must be positive")
+			errs = append(errs, fmt.Errorf("rate_limit ttl and cleanup_interval must be positive"))
+		}
+		if cfg.MaxKeys <= 0 {
+			log.Error("Rate limit max_keys must be positive", zap.Int("max_keys", cfg.MaxKeys))
+			errs = append(errs, fmt.Errorf("rate_limit max_keys must be positive"))
+		}
+	case *FairnessMiddlewareConfig:
+		if cfg.MaxConcurrent <= 0 {
+			log.Error("Fairness middleware requires positive max_concurrent")
+			errs = append(errs, fmt.Errorf("fairness middleware requires positive max_concurrent"))
+		}
+		if cfg.MaxQueue < 0 || cfg.MaxClientQueue < 0 {
+			log.Error("Fairness queue limits cannot be negative")
+			errs = append(errs, fmt.Errorf("fairness max_queue and max_client_queue cannot be negative"))
+		}
+		if cfg.QueueTimeout <= 0 {
+			log.Error("Fairness queue_timeout must be positive", zap.Duration("queue_timeout", cfg.QueueTimeout))
+			errs = append(errs, fmt.Errorf("fairness queue_timeout must be positive"))
+		}
+		if !contains(validFairnessKeys, cfg.KeyFunc) {
+			log.Error("Invalid key_func", zap.String("key_func", cfg.KeyFunc))
+			errs = append(errs, fmt.Errorf("invalid key_func: %s, must be one of: %s",
+				cfg.KeyFunc, strings.Join(validFairnessKeys, ", ")))
+		} else if cfg.KeyFunc == "header" && cfg.KeyHeader == "" {
+			log.Error("Fairness key_func header requires key_header")
+			errs = append(errs, fmt.Errorf("fairness key_func header requires key_header"))
+		}
+		if cfg.DefaultWeight <= 0 {
+			log.Error("Fairness default_weight must be positive")
+			errs = append(errs, fmt.Errorf("fairness default_weight must be positive"))
+		}
+		for i, client := range cfg.Clients {
+			if client.Key == "" || client.Weight <= 0 {
+				log.Error("Fairness client requires a key and a positive weight", zap.Int("index", i))
+				errs = append(errs, fmt.Errorf("fairness clients[%d]: key and positive weight are required", i))
+			}
+		}
+	case *EventsMiddlewareConfig:
+		switch cfg.Sink {
+		case "nats":
+			if cfg.NATS.URL == "" {
+				log.Error("Events nats sink requires a URL")
+				errs = append(errs, fmt.Errorf("events nats sink requires nats.url"))
+			}
+		case "kafka":
+			if u, err := url.Parse(cfg.Kafka.RESTProxy); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				log.Error("Events kafka sink requires an http(s) REST proxy URL", zap.String("rest_proxy", cfg.Kafka.RESTProxy))
+				errs = append(errs, fmt.Errorf("events kafka sink requires an http(s) kafka.rest_proxy URL"))
+			}
+		default:
+			log.Error("Invalid events sink", zap.String("sink", cfg.Sink))
+			errs = append(errs, fmt.Errorf("invalid events sink: %q, must be one of: %s",
+				cfg.Sink, strings.Join(validEventSinks, ", ")))
+		}
+		if cfg.Topic == "" {
+			log.Error("Events middleware requires a topic")
+			errs = append(errs, fmt.Errorf("events topic cannot be empty"))
+		}
+		if cfg.BufferSize <= 0 || cfg.BatchSize <= 0 {
+			log.Error("Events buffer_size and batch_size must be positive")
+			errs = append(errs, fmt.Errorf("events buffer_size and batch_size must be positive"))
+		}
+		if cfg.FlushInterval <= 0 || cfg.PublishTimeout <= 0 {
+			log.Error("Events flush_interval and publish_timeout must be positive")
+			errs = append(errs, fmt.Errorf("events flush_interval and publish_timeout must be positive"))
+		}
+		if cfg.BodySampleRate < 0 || cfg.BodySampleRate > 1 {
+			log.Error("Events body_sample_rate must be between 0 and 1", zap.Float64("body_sample_rate", cfg.BodySampleRate))
+			errs = append(errs, fmt.Errorf("events body_sample_rate must be between 0 and 1"))
+		}
+		if cfg.BodySampleRate > 0 && cfg.MaxBodySize <= 0 {
+			log.Error("Events max_body_size must be positive to sample bodies")
+			errs = append(errs, fmt.Errorf("events max_body_size must be positive when body_sample_rate is set"))
+		}
+	case *WasmMiddlewareConfig:
+		if cfg.Module == "" {
+			log.Error("Wasm middleware requires a module")
+			errs = append(errs, fmt.Errorf("wasm middleware requires a module"))
+		}
+		if cfg.Timeout <= 0 || cfg.ReloadInterval <= 0 {
+			log.Error("Wasm timeout and reload_interval must be positive")
+			errs = append(errs, fmt.Errorf("wasm timeout and reload_interval must be positive"))
+		}
+		if (cfg.RequestBody || cfg.ResponseBody) && cfg.MaxBodySize <= 0 {
+			log.Error("Wasm max_body_size must be positive to filter bodies")
+			errs = append(errs, fmt.Errorf("wasm max_body_size must be positive when request_body or response_body is set"))
+		}
+	case *ExternalAuthMiddlewareConfig:
+		if !contains(validAuthzProtocols, cfg.Protocol) {
+			log.Error("Invalid external auth protocol", zap.String("protocol", cfg.Protocol))
+			errs = append(errs, fmt.Errorf("invalid external_auth protocol: %s, must be one of: %s",
+				cfg.Protocol, strings.Join(validAuthzProtocols, ", ")))
+		}
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Error("External auth requires an http:// or https:// url", zap.String("url", cfg.URL))
+			errs = append(errs, fmt.Errorf("external_auth url must be an http:// or https:// URL, got %q", cfg.URL))
+		}
+		if cfg.Timeout <= 0 {
+			log.Error("External auth timeout must be positive")
+			errs = append(errs, fmt.Errorf("external_auth timeout must be positive"))
+		}
+		if !contains(validFailureModes, cfg.FailureMode) {
+			log.Error("Invalid external auth failure mode", zap.String("failure_mode", cfg.FailureMode))
+			errs = append(errs, fmt.Errorf("invalid external_auth failure_mode: %s, must be one of: %s",
+				cfg.FailureMode, strings.Join(validFailureModes, ", ")))
+		}
+		if cfg.StatusOnError < 400 || cfg.StatusOnError > 599 {
+			log.Error("External auth status_on_error must be an error status", zap.Int("status", cfg.StatusOnError))
+			errs = append(errs, fmt.Errorf("external_auth status_on_error must be between 400 and 599"))
+		}
+	case *BasicAuthMiddlewareConfig:
+		if len(cfg.Users) == 0 && cfg.HtpasswdFile == "" {
+			log.Error("Basic auth requires users or an htpasswd file")
+			errs = append(errs, fmt.Errorf("basic_auth requires users or htpasswd_file"))
+		}
+		if _, err := ParseHtpasswd(strings.Join(cfg.Users, "\n")); err != nil {
+			log.Error("Invalid basic auth users", zap.Error(err))
+			errs = append(errs, fmt.Errorf("invalid basic_auth users: %w", err))
+		}
+		if strings.ContainsAny(cfg.Realm, "\"\\") {
+			log.Error("Basic auth realm cannot contain quotes or backslashes", zap.String("realm", cfg.Realm))
+			errs = append(errs, fmt.Errorf("basic_auth realm cannot contain quotes or backslashes"))
+		}
+		for _, entry := range cfg.AllowIPs {
+			if _, err := ParseCIDR(entry); err != nil {
+				log.Error("Invalid basic auth allowed IP", zap.String("ip", entry), zap.Error(err))
+				errs = append(errs, fmt.Errorf("invalid basic_auth allow_ips entry %s: %w", entry, err))
 			}
 		}
-	case "compression":
-		// Validate compression middleware config
-		if level, ok := config["level"].(float64); ok {
-			if level < 0 || level > 9 {
-				log.Error("Compression level must be between 0 and 9")
-				return fmt.Errorf("compression level must be between 0 and 9")
+	case *HMACMiddlewareConfig:
+		if len(cfg.Keys) == 0 {
+			log.Error("HMAC middleware requires at least one key")
+			errs = append(errs, fmt.Errorf("hmac middleware requires at least one key"))
+		}
+		keyIDs := make(map[string]bool)
+		for i, key := range cfg.Keys {
+			if key.Secret == "" {
+				log.Error("HMAC key requires a secret", zap.Int("key", i))
+				errs = append(errs, fmt.Errorf("hmac key %d requires a secret", i))
 			}
+			if cfg.KeyIDHeader != "" && key.ID == "" {
+				log.Error("HMAC key requires an id", zap.Int("key", i))
+				errs = append(errs, fmt.Errorf("hmac key %d requires an id when key_id_header is set", i))
+			}
+			if key.ID != "" && keyIDs[key.ID] {
+				log.Error("Duplicate HMAC key id", zap.String("id", key.ID))
+				errs = append(errs, fmt.Errorf("duplicate hmac key id: %s", key.ID))
+			}
+			keyIDs[key.ID] = true
+		}
+		if !contains(validHMACAlgorithms, cfg.Algorithm) {
+			log.Error("Invalid HMAC algorithm", zap.String("algorithm", cfg.Algorithm))
+			errs = append(errs, fmt.Errorf("invalid hmac algorithm: %s, must be one of: %s",
+				cfg.Algorithm, strings.Join(validHMACAlgorithms, ", ")))
+		}
+		if !contains(validHMACEncodings, cfg.Encoding) {
+			log.Error("Invalid HMAC encoding", zap.String("encoding", cfg.Encoding))
+			errs = append(errs, fmt.Errorf("invalid hmac encoding: %s, must be one of: %s",
+				cfg.Encoding, strings.Join(validHMACEncodings, ", ")))
+		}
+		for _, component := range cfg.Components {
+			if name, found := strings.CutPrefix(component, "header:"); found {
+				if name == "" {
+					log.Error("HMAC header component requires a header name")
+					errs = append(errs, fmt.Errorf("hmac component header: requires a header name"))
+				}
+				continue
+			}
+			if !contains(validHMACComponents, component) {
+				log.Error("Invalid HMAC component", zap.String("component", component))
+				errs = append(errs, fmt.Errorf("invalid hmac component: %s, must be one of: %s or header:<name>",
+					component, strings.Join(validHMACComponents, ", ")))
+			}
+		}
+		// Without a signed timestamp, captured requests could be replayed
+		// with a fresh one
+		if !contains(cfg.Components, "timestamp") {
+			log.Error("HMAC components must include the timestamp")
+			errs = append(errs, fmt.Errorf("hmac components must include timestamp"))
+		}
+		if contains(cfg.Components, "nonce") && cfg.NonceHeader == "" {
+			log.Error("HMAC nonce component requires a nonce header")
+			errs = append(errs, fmt.Errorf("hmac component nonce requires nonce_header"))
+		}
+		if cfg.SignatureHeader == "" || cfg.TimestampHeader == "" {
+			log.Error("HMAC signature_header and timestamp_header are required")
+			errs = append(errs, fmt.Errorf("hmac signature_header and timestamp_header cannot be empty"))
+		}
+		if cfg.MaxSkew <= 0 {
+			log.Error("HMAC max_skew must be positive")
+			errs = append(errs, fmt.Errorf("hmac max_skew must be positive"))
+		}
+		if contains(cfg.Components, "body") && cfg.MaxBodySize <= 0 {
+			log.Error("HMAC max_body_size must be positive to sign bodies")
+			errs = append(errs, fmt.Errorf("hmac max_body_size must be positive when the body is signed"))
+		}
+	case *CompressionMiddlewareConfig:
+		if cfg.Level != gzip.DefaultCompression && (cfg.Level < gzip.NoCompression || cfg.Level > gzip.BestCompression) {
+			log.Error("Compression level must be between 0 and 9")
+			errs = append(errs, fmt.Errorf("compression level must be between 0 and 9"))
+		}
+		if cfg.MinLength < 0 || cfg.MinSize < 0 {
+			log.Error("Compression min_length cannot be negative")
+			errs = append(errs, fmt.Errorf("compression min_length cannot be negative"))
 		}
-		if minSize, ok := config["min_size"].(float64); ok {
-			if minSize < 0 {
-				log.Error("Compression min_size cannot be negative")
-				return fmt.Errorf("compression min_size cannot be negative")
+		if cfg.BrotliLevel < brotli.BestSpeed || cfg.BrotliLevel > brotli.BestCompression {
+			log.Error("Compression brotli_level must be between 0 and 11")
+			errs = append(errs, fmt.Errorf("compression brotli_level must be between 0 and 11"))
+		}
+		if len(cfg.Encodings) == 0 {
+			log.Error("Compression requires at least one encoding")
+			errs = append(errs, fmt.Errorf("compression encodings cannot be empty"))
+		}
+		for _, encoding := range cfg.Encodings {
+			if !contains(validEncodings, encoding) {
+				log.Error("Invalid compression encoding", zap.String("encoding", encoding))
+				errs = append(errs, fmt.Errorf("invalid compression encoding: %s, must be one of: %s",
+					encoding, strings.Join(validEncodings, ", ")))
 			}
 		}
-		if minLength, ok := config["min_length"].(float64); ok {
-			if minLength < 0 {
-				log.Error("Compression min_length cannot be negative")
-				return fmt.Errorf("compression min_length cannot be negative")
+	case *CacheMiddlewareConfig:
+		if cfg.TTL < 0 {
+			log.Error("Cache ttl cannot be negative", zap.Duration("ttl", cfg.TTL))
+			errs = append(errs, fmt.Errorf("cache ttl cannot be negative"))
+		}
+		if cfg.StaleWhileRevalidate < 0 || cfg.StaleIfError < 0 {
+			log.Error("Cache stale_while_revalidate and stale_if_error cannot be negative")
+			errs = append(errs, fmt.Errorf("cache stale_while_revalidate and stale_if_error cannot be negative"))
+		}
+		if cfg.MaxEntries <= 0 {
+			log.Error("Cache max_entries must be positive", zap.Int("max_entries", cfg.MaxEntries))
+			errs = append(errs, fmt.Errorf("cache max_entries must be positive"))
+		}
+		if cfg.MaxSize <= 0 || cfg.MaxObjectSize <= 0 {
+			log.Error("Cache max_size and max_object_size must be positive")
+			errs = append(errs, fmt.Errorf("cache max_size and max_object_size must be positive"))
+		} else if cfg.MaxObjectSize > cfg.MaxSize {
+			log.Error("Cache max_object_size exceeds max_size", zap.Int64("max_object_size", cfg.MaxObjectSize), zap.Int64("max_size", cfg.MaxSize))
+			errs = append(errs, fmt.Errorf("cache max_object_size %d exceeds max_size %d", cfg.MaxObjectSize, cfg.MaxSize))
+		}
+		switch {
+		case !contains(validCacheStores, cfg.Store):
+			log.Error("Invalid cache store", zap.String("store", cfg.Store))
+			errs = append(errs, fmt.Errorf("invalid cache store: %s, must be one of: %s",
+				cfg.Store, strings.Join(validCacheStores, ", ")))
+		case cfg.Store == "redis" && cfg.Redis.Address == "":
+			log.Error("Redis cache store requires an address")
+			errs = append(errs, fmt.Errorf("redis cache store requires redis.address"))
+		case cfg.Store == "memcached" && len(cfg.Memcached.Servers) == 0:
+			log.Error("Memcached cache store requires servers")
+			errs = append(errs, fmt.Errorf("memcached cache store requires memcached.servers"))
+		}
+		if cfg.Store != "memory" && cfg.StoreTimeout <= 0 {
+			log.Error("Cache store_timeout must be positive", zap.Duration("store_timeout", cfg.StoreTimeout))
+			errs = append(errs, fmt.Errorf("cache store_timeout must be positive"))
+		}
+	case *QuotaMiddlewareConfig:
+		if cfg.Header == "" && cfg.QueryParam == "" {
+			log.Error("Quota middleware requires a header or query_param")
+			errs = append(errs, fmt.Errorf("quota middleware requires a header or query_param"))
+		}
+		if len(cfg.Keys) == 0 && cfg.Default == nil {
+			log.Error("Quota middleware requires keys or a default plan")
+			errs = append(errs, fmt.Errorf("quota middleware requires keys or a default plan"))
+		}
+		seenKeys := make(map[string]bool)
+		for i, plan := range cfg.Keys {
+			if plan.Key == "" {
+				log.Error("Quota key is required", zap.Int("index", i))
+				errs = append(errs, fmt.Errorf("quota keys[%d]: key is required", i))
+			} else if seenKeys[plan.Key] {
+				log.Error("Duplicate quota key", zap.Int("index", i))
+				errs = append(errs, fmt.Errorf("quota keys[%d]: duplicate key", i))
 			}
+			seenKeys[plan.Key] = true
+			if plan.Daily < 0 || plan.Monthly < 0 {
+				log.Error("Quota limits cannot be negative", zap.Int("index", i))
+				errs = append(errs, fmt.Errorf("quota keys[%d]: limits cannot be negative", i))
+			}
+		}
+		if cfg.Default != nil && (cfg.Default.Daily < 0 || cfg.Default.Monthly < 0) {
+			log.Error("Default quota limits cannot be negative")
+			errs = append(errs, fmt.Errorf("default quota cannot be negative"))
+		}
+		if cfg.UsagePath != "" && !strings.HasPrefix(cfg.UsagePath, "/") {
+			log.Error("Quota usage_path must start with /", zap.String("usage_path", cfg.UsagePath))
+			errs = append(errs, fmt.Errorf("quota usage_path must start with /"))
+		}
+		switch {
+		case !contains(validQuotaStores, cfg.Store):
+			log.Error("Invalid quota store", zap.String("store", cfg.Store))
+			errs = append(errs, fmt.Errorf("invalid quota store: %s, must be one of: %s",
+				cfg.Store, strings.Join(validQuotaStores, ", ")))
+		case cfg.Store == "file" && cfg.File == "":
+			log.Error("File quota store requires a file")
+			errs = append(errs, fmt.Errorf("file quota store requires file"))
+		case cfg.Store == "file" && cfg.FlushInterval <= 0:
+			log.Error("Quota flush_interval must be positive", zap.Duration("flush_interval", cfg.FlushInterval))
+			errs = append(errs, fmt.Errorf("quota flush_interval must be positive"))
+		case cfg.Store == "redis" && cfg.Redis.Address == "":
+			log.Error("Redis quota store requires an address")
+			errs = append(errs, fmt.Errorf("redis quota store requires redis.address"))
+		case cfg.Store == "redis" && cfg.StoreTimeout <= 0:
+			log.Error("Quota store_timeout must be positive", zap.Duration("store_timeout", cfg.StoreTimeout))
+			errs = append(errs, fmt.Errorf("quota store_timeout must be positive"))
 		}
 	}
 
-	return nil
+	return errs
 }
 
 // validateTLSConfig validates TLS configuration
-func validateTLSConfig(config *TLSConfig, log *zap.Logger) error {
+func validateTLSConfig(config *TLSConfig, log *zap.Logger) []error {
+	var errs []error
+
 	if !config.Enabled {
 		log.Info("TLS is disabled")
 		return nil
@@ -412,79 +1557,178 @@ func validateTLSConfig(config *TLSConfig, log *zap.Logger) error {
 	if config.AutoCert.Enabled {
 		if config.AutoCert.Email == "" {
 			log.Error("Let's Encrypt email cannot be empty")
-			return fmt.Errorf("Let's Encrypt email cannot be empty")
+			errs = append(errs, fmt.Errorf("Let's Encrypt email cannot be empty"))
 		}
 
 		if len(config.AutoCert.Hosts) == 0 {
 			log.Error("At least one host must be specified for Let's Encrypt")
-			return fmt.Errorf("at least one host must be specified for Let's Encrypt")
+			errs = append(errs, fmt.Errorf("at least one host must be specified for Let's Encrypt"))
 		}
 
 		for _, host := range config.AutoCert.Hosts {
 			if host == "" {
 				log.Error("Let's Encrypt host cannot be empty")
-				return fmt.Errorf("Let's Encrypt host cannot be empty")
+				errs = append(errs, fmt.Errorf("Let's Encrypt host cannot be empty"))
+			}
+		}
+
+		switch config.AutoCert.Cache {
+		case "dir":
+			if config.AutoCert.CacheDir == "" {
+				log.Error("Let's Encrypt cache directory cannot be empty")
+				errs = append(errs, fmt.Errorf("Let's Encrypt cache directory cannot be empty"))
 			}
+		case "redis":
+			if config.AutoCert.Redis.Address == "" {
+				log.Error("Redis Let's Encrypt cache requires an address")
+				errs = append(errs, fmt.Errorf("Let's Encrypt redis cache requires redis.address"))
+			}
+			if config.AutoCert.LockTTL <= 0 {
+				log.Error("Let's Encrypt lock_ttl must be positive", zap.Duration("lock_ttl", config.AutoCert.LockTTL))
+				errs = append(errs, fmt.Errorf("Let's Encrypt lock_ttl must be positive"))
+			}
+		default:
+			log.Error("Invalid Let's Encrypt cache", zap.String("cache", config.AutoCert.Cache))
+			errs = append(errs, fmt.Errorf("invalid Let's Encrypt cache: %s, must be one of: dir, redis", config.AutoCert.Cache))
+		}
+
+		if (config.AutoCert.EABKeyID == "") != (config.AutoCert.EABHMACKey == "") {
+			log.Error("ACME external account binding requires both eab_key_id and eab_hmac_key")
+			errs = append(errs, fmt.Errorf("ACME external account binding requires both eab_key_id and eab_hmac_key"))
 		}
 
-		if config.AutoCert.CacheDir == "" {
-			log.Error("Let's Encrypt cache directory cannot be empty")
-			return fmt.Errorf("Let's Encrypt cache directory cannot be empty")
+		if config.AutoCert.EABHMACKey != "" {
+			if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(config.AutoCert.EABHMACKey, "=")); err != nil {
+				log.Error("Invalid ACME EAB HMAC key", zap.Error(err))
+				errs = append(errs, fmt.Errorf("ACME eab_hmac_key must be base64url encoded: %w", err))
+			}
 		}
 	}
 
 	for i, cert := range config.Certificates {
 		if len(cert.Hosts) == 0 {
 			log.Error("Certificate must have at least one host", zap.Int("certificate", i))
-			return fmt.Errorf("certificate %d must have at least one host", i)
+			errs = append(errs, fmt.Errorf("certificate %d must have at least one host", i))
 		}
 
 		if cert.AutoGenerate && !cert.SelfSigned {
 			log.Error("Certificate cannot be auto-generated if self-signed is false", zap.Int("certificate", i))
-			return fmt.Errorf("certificate %d cannot be auto-generated if self-signed is false", i)
+			errs = append(errs, fmt.Errorf("certificate %d cannot be auto-generated if self-signed is false", i))
 		}
 
 		if cert.CertFile == "" {
 			log.Error("Certificate cert file cannot be empty", zap.Int("certificate", i))
-			return fmt.Errorf("certificate %d cert file cannot be empty", i)
+			errs = append(errs, fmt.Errorf("certificate %d cert file cannot be empty", i))
 		}
 
 		if cert.KeyFile == "" {
 			log.Error("Certificate key file cannot be empty", zap.Int("certificate", i))
-			return fmt.Errorf("certificate %d key file cannot be empty", i)
+			errs = append(errs, fmt.Errorf("certificate %d key file cannot be empty", i))
 		}
 
 		if cert.AutoGenerate || cert.SelfSigned {
 			if cert.CommonName == "" {
 				log.Error("Certificate common name cannot be empty if auto-generate or self-signed is true", zap.Int("certificate", i))
-				return fmt.Errorf("certificate %d common name cannot be empty if auto-generate or self-signed is true", i)
+				errs = append(errs, fmt.Errorf("certificate %d common name cannot be empty if auto-generate or self-signed is true", i))
 			}
 
 			if cert.Organization == "" {
 				log.Error("Certificate organization cannot be empty if auto-generate or self-signed is true", zap.Int("certificate", i))
-				return fmt.Errorf("certificate %d organization cannot be empty if auto-generate or self-signed is true", i)
+				errs = append(errs, fmt.Errorf("certificate %d organization cannot be empty if auto-generate or self-signed is true", i))
 			}
 
 			if cert.ValidFor == "" {
 				log.Error("Certificate valid for cannot be empty if auto-generate or self-signed is true", zap.Int("certificate", i))
-				return fmt.Errorf("certificate %d valid for cannot be empty if auto-generate or self-signed is true", i)
+				errs = append(errs, fmt.Errorf("certificate %d valid for cannot be empty if auto-generate or self-signed is true", i))
 			}
 
 			if cert.RSABits == 0 {
 				log.Error("Certificate RSA bits cannot be 0 if auto-generate or self-signed is true", zap.Int("certificate", i))
-				return fmt.Errorf("certificate %d RSA bits cannot be 0 if auto-generate or self-signed is true", i)
+				errs = append(errs, fmt.Errorf("certificate %d RSA bits cannot be 0 if auto-generate or self-signed is true", i))
 			}
 
 			if cert.ValidFor != "" {
 				if _, err := time.ParseDuration(cert.ValidFor); err != nil {
 					log.Error("Invalid valid_for duration", zap.String("duration", cert.ValidFor), zap.Error(err))
-					return fmt.Errorf("invalid valid_for duration: %w", err)
+					errs = append(errs, fmt.Errorf("invalid valid_for duration: %w", err))
 				}
 			}
 		}
+
+		if cert.ClientAuth != "" && !contains(validClientAuthModes, cert.ClientAuth) {
+			log.Error("Invalid certificate client_auth mode", zap.Int("certificate", i), zap.String("client_auth", cert.ClientAuth))
+			errs = append(errs, fmt.Errorf("certificate %d client_auth must be one of: %s", i, strings.Join(validClientAuthModes, ", ")))
+		}
 	}
 
-	return nil
+	errs = append(errs, validateTLSProtocol(config, log)...)
+	errs = append(errs, prefixErrors("client_auth", validateClientAuth(config, log))...)
+
+	if config.OCSP.Enabled && (config.OCSP.Refresh < 0 || config.OCSP.Timeout < 0) {
+		log.Error("OCSP refresh and timeout cannot be negative",
+			zap.Duration("refresh", config.OCSP.Refresh),
+			zap.Duration("timeout", config.OCSP.Timeout))
+		errs = append(errs, fmt.Errorf("ocsp refresh and timeout cannot be negative"))
+	}
+
+	return errs
+}
+
+// validateTLSProtocol validates the protocol versions, cipher suites and
+// curves of the HTTPS listener
+func validateTLSProtocol(config *TLSConfig, log *zap.Logger) []error {
+	var errs []error
+
+	minVersion, err := ParseTLSVersion(config.MinVersion)
+	if err != nil {
+		log.Error("Invalid TLS min_version", zap.String("min_version", config.MinVersion))
+		errs = append(errs, fmt.Errorf("min_version: %w", err))
+	}
+	maxVersion, err := ParseTLSVersion(config.MaxVersion)
+	if err != nil {
+		log.Error("Invalid TLS max_version", zap.String("max_version", config.MaxVersion))
+		errs = append(errs, fmt.Errorf("max_version: %w", err))
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		log.Error("TLS min_version is above max_version",
+			zap.String("min_version", config.MinVersion),
+			zap.String("max_version", config.MaxVersion))
+		errs = append(errs, fmt.Errorf("min_version %s is above max_version %s", config.MinVersion, config.MaxVersion))
+	}
+
+	if _, err := ParseCipherSuites(config.CipherSuites); err != nil {
+		log.Error("Invalid TLS cipher_suites", zap.Error(err))
+		errs = append(errs, fmt.Errorf("cipher_suites: %w", err))
+	}
+	if len(config.CipherSuites) > 0 && minVersion == tls.VersionTLS13 {
+		// TLS 1.3 suites are not configurable
+		log.Error("TLS cipher_suites have no effect with min_version 1.3")
+		errs = append(errs, fmt.Errorf("cipher_suites only apply to TLS 1.2 and earlier, but min_version is 1.3"))
+	}
+
+	if _, err := ParseCurves(config.CurvePreferences); err != nil {
+		log.Error("Invalid TLS curve_preferences", zap.Error(err))
+		errs = append(errs, fmt.Errorf("curve_preferences: %w", err))
+	}
+
+	return errs
+}
+
+// validateClientAuth validates how the HTTPS listener authenticates clients
+func validateClientAuth(config *TLSConfig, log *zap.Logger) []error {
+	var errs []error
+
+	clientAuth := config.ClientAuth
+	if clientAuth.Mode != "" && !contains(validClientAuthModes, clientAuth.Mode) {
+		log.Error("Invalid client_auth mode", zap.String("mode", clientAuth.Mode))
+		errs = append(errs, fmt.Errorf("mode must be one of: %s", strings.Join(validClientAuthModes, ", ")))
+	}
+	if config.VerifiesClientCerts() && clientAuth.CAFile == "" {
+		log.Error("Verifying client certificates requires a CA file")
+		errs = append(errs, fmt.Errorf("ca_file is required to verify client certificates"))
+	}
+
+	return errs
 }
 
 // contains checks if a slice contains a specific string
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// DefaultDebounce is the quiet period the watcher waits for before reloading
+const DefaultDebounce = 500 * time.Millisecond
+
+// Watcher watches a configuration directory and invokes a callback once file
+// activity settles. It handles in-place writes as well as the create/rename
+// and symlink swaps used by editors and Kubernetes ConfigMap volumes.
+type Watcher struct {
+	dir      string
+	debounce time.Duration
+	onChange func()
+	logger   *zap.Logger
+
+	watcher *fsnotify.Watcher
+	timer   *time.Timer
+	mu      sync.Mutex
+
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// NewWatcher creates a new configuration directory watcher
+func NewWatcher(dir string, debounce time.Duration, logger *zap.Logger, onChange func()) (*Watcher, error) {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	return &Watcher{
+		dir:      dir,
+		debounce: debounce,
+		onChange: onChange,
+		logger:   logger,
+		watcher:  fsWatcher,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins watching the configuration directory
+func (w *Watcher) Start() error {
+	if err := w.watcher.Add(w.dir); err != nil {
+		w.watcher.Close()
+		return fmt.Errorf("failed to watch config directory: %w", err)
+	}
+
+	// Fragments are merged into the configuration, so their directory is
+	// watched too; it is picked up when created later
+	w.watchFragments()
+
+	w.logger.Info("Watching configuration directory",
+		zap.String("dir", w.dir),
+		zap.Duration("debounce", w.debounce))
+
+	go w.run()
+	return nil
+}
+
+// Stop stops watching and cancels any pending reload
+func (w *Watcher) Stop() {
+	close(w.stopCh)
+	<-w.done
+
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+}
+
+// run is the main event loop
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer w.watcher.Close()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("File watcher error", zap.Error(err))
+		}
+	}
+}
+
+// handleEvent filters a file system event and schedules a reload
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	// The directory itself was removed or replaced; watch it again once it
+	// reappears
+	if filepath.Clean(event.Name) == filepath.Clean(w.dir) && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.logger.Warn("Configuration directory removed, re-adding watch", zap.String("dir", w.dir))
+		go w.rewatch()
+		return
+	}
+
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+		return
+	}
+
+	if filepath.Clean(event.Name) == filepath.Join(w.dir, FragmentDir) {
+		if event.Op&fsnotify.Create != 0 {
+			w.watchFragments()
+		}
+		w.schedule()
+		return
+	}
+
+	if !isConfigFile(event.Name) {
+		return
+	}
+
+	w.logger.Debug("Configuration file event",
+		zap.String("file", event.Name),
+		zap.String("op", event.Op.String()))
+
+	w.schedule()
+}
+
+// schedule (re)starts the debounce timer
+func (w *Watcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, w.onChange)
+}
+
+// rewatch re-adds the directory watch, retrying until it succeeds or the
+// watcher is stopped
+func (w *Watcher) rewatch() {
+	ticker := time.NewTicker(w.debounce)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			if err := w.watcher.Add(w.dir); err != nil {
+				continue
+			}
+			w.logger.Info("Re-added watch on configuration directory", zap.String("dir", w.dir))
+			w.schedule()
+			return
+		}
+	}
+}
+
+// watchFragments watches the fragment directory, if there is one
+func (w *Watcher) watchFragments() {
+	dir := filepath.Join(w.dir, FragmentDir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		w.logger.Warn("Failed to watch configuration fragments", zap.String("dir", dir), zap.Error(err))
+	}
+}
+
+// isConfigFile reports whether a path is relevant for configuration reloads.
+// Kubernetes ConfigMap volumes swap a "..data" symlink, so those entries count
+// as well; editor swap and backup files are ignored.
+func isConfigFile(path string) bool {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, "..") {
+		return true
+	}
+	if strings.HasSuffix(base, "~") || strings.HasPrefix(base, ".") {
+		return false
+	}
+	ext := filepath.Ext(base)
+	return ext == ".yaml" || ext == ".yml"
+}
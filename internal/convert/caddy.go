@@ -0,0 +1,458 @@
+package convert
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// caddyContext holds the settings a directive inherits from enclosing
+// handle, handle_path and route blocks
+type caddyContext struct {
+	path    string // Sentinel route path
+	strip   string
+	headers map[string]string
+}
+
+// Caddy load balancing policies with a Sentinel equivalent
+var caddyPolicies = map[string]string{
+	"round_robin":    "round_robin",
+	"least_conn":     "least_connections",
+	"ip_hash":        "ip_hash",
+	"client_ip_hash": "ip_hash",
+}
+
+// FromCaddyfile translates the site blocks of a Caddyfile
+func FromCaddyfile(data []byte, source string) (*Result, error) {
+	lines, err := parseCaddyfile(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult(source)
+	sites := 0
+	for i := 0; i < len(lines); i++ {
+		d := lines[i]
+		switch {
+		case d.name == "" && d.block != nil:
+			// Global options
+			continue
+		case strings.HasPrefix(d.name, "(") && strings.HasSuffix(d.name, ")"):
+			result.warn(d.line, "snippet %s skipped, imports are not followed", d.name)
+			continue
+		case d.name == "import":
+			result.warn(d.line, "import %s not followed", strings.Join(d.args, " "))
+			continue
+		case d.block == nil && i == 0:
+			// A single site without braces: the rest of the file is its body
+			translateCaddySite(append([]string{d.name}, d.args...), lines[1:], d.line, result)
+			sites++
+			i = len(lines)
+			continue
+		case d.block == nil:
+			result.warn(d.line, "%s outside of a site block skipped", d.name)
+			continue
+		}
+		translateCaddySite(append([]string{d.name}, d.args...), d.block, d.line, result)
+		sites++
+	}
+	if sites == 0 {
+		return nil, fmt.Errorf("no site blocks found")
+	}
+
+	result.sortRoutes()
+	return result, nil
+}
+
+// translateCaddySite turns the directives of a site block into routes
+func translateCaddySite(addresses []string, body []*directive, line int, result *Result) {
+	var hosts []string
+	for _, address := range addresses {
+		for _, address := range strings.Split(address, ",") {
+			if address = strings.TrimSpace(address); address == "" {
+				continue
+			}
+			host := caddyHost(address)
+			switch {
+			case strings.Contains(host, "*"):
+				result.warn(line, "wildcard site address %s skipped, list each host explicitly", address)
+			case strings.Contains(host, "{"):
+				result.warn(line, "site address %s with placeholders skipped", address)
+			default:
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	// A site without a host name serves any host
+	for _, host := range hosts {
+		if host == "" {
+			hosts = nil
+			break
+		}
+	}
+	hosts = result.hostsOrAny(hosts, line, "site "+strings.Join(addresses, " "))
+
+	ctx := caddyContext{path: "/*", headers: map[string]string{}}
+	translateCaddyDirectives(body, hosts, ctx, result)
+}
+
+// caddyHost returns the host name of a site address, or "" for any host
+func caddyHost(address string) string {
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil {
+			address = u.Host
+		}
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// translateCaddyDirectives translates the directives of a site or block
+func translateCaddyDirectives(directives []*directive, hosts []string, parent caddyContext, result *Result) {
+	ctx := caddyContext{path: parent.path, strip: parent.strip, headers: map[string]string{}}
+	for name, value := range parent.headers {
+		ctx.headers[name] = value
+	}
+
+	// Headers apply to the whole block regardless of their position
+	for _, d := range directives {
+		if d.name == "header" {
+			applyCaddyHeader(d, &ctx, result)
+		}
+	}
+
+	for _, d := range directives {
+		switch d.name {
+		case "header":
+		case "reverse_proxy":
+			translateCaddyProxy(d, hosts, ctx, result)
+		case "handle", "route":
+			nested := ctx
+			if len(d.args) > 0 {
+				path, ok := caddyPath(d.args[0], d.line, result)
+				if !ok {
+					continue
+				}
+				nested.path = path
+			}
+			translateCaddyDirectives(d.block, hosts, nested, result)
+		case "handle_path":
+			if len(d.args) == 0 {
+				continue
+			}
+			path, ok := caddyPath(d.args[0], d.line, result)
+			if !ok {
+				continue
+			}
+			nested := ctx
+			nested.path = path
+			nested.strip = strings.TrimSuffix(path, "/*")
+			translateCaddyDirectives(d.block, hosts, nested, result)
+		case "uri":
+			if len(d.args) == 2 && d.args[0] == "strip_prefix" {
+				ctx.strip = strings.TrimSuffix(d.args[1], "/")
+			} else {
+				result.warn(d.line, "uri %s not translated", strings.Join(d.args, " "))
+			}
+		case "tls":
+			switch {
+			case len(d.args) == 2:
+				result.Certificates = append(result.Certificates, Certificate{Hosts: hosts, CertFile: d.args[0], KeyFile: d.args[1]})
+			case len(d.args) == 1 && d.args[0] == "internal":
+				result.warn(d.line, "tls internal: generate certificates with certgen -ca")
+			case len(d.args) == 1:
+				result.warn(d.line, "tls %s: enable autocert in tls.yaml with this email", d.args[0])
+			default:
+				result.warn(d.line, "tls options not translated")
+			}
+		case "import":
+			result.warn(d.line, "import %s not followed", strings.Join(d.args, " "))
+		case "encode":
+			result.warn(d.line, "encode: add the compression middleware to routes")
+		case "basicauth", "basic_auth", "forward_auth", "jwt":
+			result.warn(d.line, "%s not translated, configure the auth middleware", d.name)
+		case "rate_limit":
+			result.warn(d.line, "rate_limit not translated, configure the rate_limit middleware")
+		case "file_server", "root", "php_fastcgi", "templates", "try_files":
+			result.warn(d.line, "%s not translated, serve files from an upstream", d.name)
+		case "redir", "respond", "error", "abort", "rewrite":
+			result.warn(d.line, "%s %s not translated", d.name, strings.Join(d.args, " "))
+		case "log", "skip_log", "log_skip", "request_body":
+		default:
+			if strings.HasPrefix(d.name, "@") {
+				result.warn(d.line, "named matcher %s not translated, use path matchers", d.name)
+			} else {
+				result.warn(d.line, "%s not translated", d.name)
+			}
+		}
+	}
+}
+
+// applyCaddyHeader records a response header set by a header directive
+func applyCaddyHeader(d *directive, ctx *caddyContext, result *Result) {
+	args := d.args
+	if len(args) > 0 && (strings.HasPrefix(args[0], "/") || strings.HasPrefix(args[0], "@") || args[0] == "*") {
+		result.warn(d.line, "header matcher %s ignored, the header applies to the whole block", args[0])
+		args = args[1:]
+	}
+	if len(args) == 0 && d.block != nil {
+		for _, child := range d.block {
+			applyCaddyHeader(&directive{name: "header", args: append([]string{child.name}, child.args...), line: child.line}, ctx, result)
+		}
+		return
+	}
+	if len(args) < 2 {
+		result.warn(d.line, "header %s not translated, only setting headers is supported", strings.Join(args, " "))
+		return
+	}
+
+	name := strings.TrimPrefix(args[0], "+")
+	if strings.HasPrefix(name, "-") || strings.HasPrefix(name, ">") || len(args) > 2 {
+		result.warn(d.line, "header %s not translated, only setting headers is supported", strings.Join(args, " "))
+		return
+	}
+	ctx.headers[name] = args[1]
+}
+
+// translateCaddyProxy turns a reverse_proxy directive into routes
+func translateCaddyProxy(d *directive, hosts []string, ctx caddyContext, result *Result) {
+	path := ctx.path
+	addresses := d.args
+	if len(addresses) > 0 && (strings.HasPrefix(addresses[0], "/") || addresses[0] == "*" || strings.HasPrefix(addresses[0], "@")) {
+		matched, ok := caddyPath(addresses[0], d.line, result)
+		if !ok {
+			return
+		}
+		path = matched
+		addresses = addresses[1:]
+	}
+
+	loadBalancer := "round_robin"
+	scheme := "http"
+	var healthCheck *HealthCheck
+	for _, child := range d.block {
+		switch child.name {
+		case "to":
+			addresses = append(addresses, child.args...)
+		case "lb_policy":
+			if policy, ok := caddyPolicies[firstArg(child)]; ok {
+				loadBalancer = policy
+			} else {
+				result.warn(child.line, "lb_policy %s is not supported, using round_robin", firstArg(child))
+			}
+		case "health_uri", "health_path", "health_interval", "health_timeout", "health_fails", "health_passes":
+			if healthCheck == nil {
+				healthCheck = newHealthCheck()
+			}
+			switch child.name {
+			case "health_uri", "health_path":
+				healthCheck.Path = firstArg(child)
+			case "health_interval":
+				healthCheck.Interval = firstArg(child)
+			case "health_timeout":
+				healthCheck.Timeout = firstArg(child)
+			case "health_fails":
+				fmt.Sscanf(firstArg(child), "%d", &healthCheck.FailureThreshold)
+			case "health_passes":
+				fmt.Sscanf(firstArg(child), "%d", &healthCheck.SuccessThreshold)
+			}
+		case "transport":
+			for _, option := range child.block {
+				switch option.name {
+				case "tls":
+					scheme = "https"
+				case "tls_insecure_skip_verify", "tls_server_name", "tls_trusted_ca_certs":
+					scheme = "https"
+					result.warn(option.line, "transport %s not translated", option.name)
+				}
+			}
+		case "header_up", "header_down":
+			result.warn(child.line, "%s not translated", child.name)
+		default:
+			result.warn(child.line, "reverse_proxy %s not translated", child.name)
+		}
+	}
+
+	var targets []Target
+	for _, address := range addresses {
+		if strings.HasPrefix(address, "h2c://") || strings.HasPrefix(address, "unix/") || strings.Contains(address, "{") {
+			result.warn(d.line, "upstream %s is not supported", address)
+			continue
+		}
+		target, err := targetURL(address, scheme)
+		if err != nil {
+			result.warn(d.line, "%v", err)
+			continue
+		}
+		targets = append(targets, Target{URL: target})
+	}
+	if len(targets) == 0 {
+		result.warn(d.line, "reverse_proxy without usable upstreams skipped")
+		return
+	}
+
+	hint := hosts[0] + strings.TrimSuffix(path, "/*")
+	if hosts[0] == anyHost {
+		if u, err := url.Parse(targets[0].URL); err == nil {
+			hint = u.Hostname()
+		}
+	}
+	upstream := result.addUpstream(hint, loadBalancer, targets, healthCheck)
+
+	var rewrite *Rewrite
+	if ctx.strip != "" {
+		rewrite = &Rewrite{StripPrefix: ctx.strip}
+	}
+	for _, host := range hosts {
+		route := Route{Host: host, Path: path, Upstream: upstream, Rewrite: rewrite}
+		if len(ctx.headers) > 0 {
+			route.Headers = ctx.headers
+		}
+		result.Routes = append(result.Routes, route)
+	}
+}
+
+// caddyPath converts a Caddy path matcher to a Sentinel route path
+func caddyPath(matcher string, line int, result *Result) (string, bool) {
+	switch {
+	case strings.HasPrefix(matcher, "@"):
+		result.warn(line, "named matcher %s not translated, use path matchers", matcher)
+		return "", false
+	case matcher == "*":
+		return "/*", true
+	case strings.HasSuffix(matcher, "*"):
+		prefix := strings.TrimSuffix(strings.TrimSuffix(matcher, "*"), "/")
+		if strings.Contains(prefix, "*") {
+			result.warn(line, "path matcher %s not translated, only trailing wildcards are supported", matcher)
+			return "", false
+		}
+		return prefix + "/*", true
+	case strings.Contains(matcher, "*"):
+		result.warn(line, "path matcher %s not translated, only trailing wildcards are supported", matcher)
+		return "", false
+	default:
+		return matcher, true
+	}
+}
+
+// parseCaddyfile parses Caddyfile syntax into lines. The first token of a
+// line is its name, and a line ending in { owns the lines up to the
+// matching }.
+func parseCaddyfile(input string) ([]*directive, error) {
+	tokens, err := caddyTokens(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &caddyParser{tokens: tokens}
+	lines, err := p.block(false)
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// caddyToken is a token and the line it appeared on
+type caddyToken struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+type caddyParser struct {
+	tokens []caddyToken
+	pos    int
+}
+
+func (p *caddyParser) block(nested bool) ([]*directive, error) {
+	var lines []*directive
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		if !token.quoted && token.text == "}" {
+			if !nested {
+				return nil, fmt.Errorf("line %d: unexpected }", token.line)
+			}
+			p.pos++
+			return lines, nil
+		}
+
+		// Collect the tokens of one line
+		d := &directive{line: token.line}
+		var words []string
+		for p.pos < len(p.tokens) && p.tokens[p.pos].line == token.line {
+			t := p.tokens[p.pos]
+			if !t.quoted && t.text == "}" {
+				break
+			}
+			p.pos++
+			if !t.quoted && t.text == "{" && (p.pos >= len(p.tokens) || p.tokens[p.pos].line != token.line) {
+				block, err := p.block(true)
+				if err != nil {
+					return nil, err
+				}
+				d.block = block
+				if d.block == nil {
+					d.block = []*directive{}
+				}
+				break
+			}
+			words = append(words, t.text)
+		}
+		if len(words) > 0 {
+			d.name, d.args = words[0], words[1:]
+		}
+		lines = append(lines, d)
+	}
+	if nested {
+		return nil, fmt.Errorf("unexpected end of file, missing }")
+	}
+	return lines, nil
+}
+
+// caddyTokens splits a Caddyfile into tokens, removing comments and quotes
+func caddyTokens(input string) ([]caddyToken, error) {
+	var tokens []caddyToken
+	line := 1
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '`':
+			start := line
+			var b strings.Builder
+			i++
+			for i < len(input) && input[i] != c {
+				if c == '"' && input[i] == '\\' && i+1 < len(input) {
+					i++
+				}
+				if input[i] == '\n' {
+					line++
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			if i >= len(input) {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", start)
+			}
+			i++
+			tokens = append(tokens, caddyToken{text: b.String(), line: start, quoted: true})
+		default:
+			start := i
+			for i < len(input) && input[i] != ' ' && input[i] != '\t' && input[i] != '\r' && input[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, caddyToken{text: input[start:i], line: line})
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,271 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Result is a Sentinel configuration translated from another proxy
+type Result struct {
+	Source       string
+	Upstreams    map[string]*Upstream
+	Routes       []Route
+	Certificates []Certificate
+	// Warnings list directives that could not be translated exactly
+	Warnings []string
+}
+
+// Upstream is a translated upstream service
+type Upstream struct {
+	LoadBalancer string       `yaml:"load_balancer"`
+	HealthCheck  *HealthCheck `yaml:"health_check,omitempty"`
+	Targets      []Target     `yaml:"targets"`
+}
+
+// HealthCheck is a translated active health check
+type HealthCheck struct {
+	Enabled          bool   `yaml:"enabled"`
+	Path             string `yaml:"path"`
+	Interval         string `yaml:"interval"`
+	Timeout          string `yaml:"timeout"`
+	FailureThreshold int    `yaml:"failure_threshold"`
+	SuccessThreshold int    `yaml:"success_threshold"`
+}
+
+// newHealthCheck returns a health check with the defaults of the example
+// configuration
+func newHealthCheck() *HealthCheck {
+	return &HealthCheck{
+		Enabled:          true,
+		Path:             "/",
+		Interval:         "30s",
+		Timeout:          "5s",
+		FailureThreshold: 3,
+		SuccessThreshold: 2,
+	}
+}
+
+// Target is a translated upstream target
+type Target struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight,omitempty"`
+}
+
+// Route is a translated route rule. Durations are kept as strings so the
+// generated YAML stays readable.
+type Route struct {
+	Host     string            `yaml:"host,omitempty"`
+	Path     string            `yaml:"path"`
+	Methods  []string          `yaml:"methods,omitempty"`
+	Upstream string            `yaml:"upstream"`
+	Rewrite  *Rewrite          `yaml:"rewrite,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Timeout  string            `yaml:"timeout,omitempty"`
+}
+
+// Rewrite is a translated path rewrite
+type Rewrite struct {
+	StripPrefix string `yaml:"strip_prefix,omitempty"`
+	AddPrefix   string `yaml:"add_prefix,omitempty"`
+	Regex       string `yaml:"regex,omitempty"`
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// Certificate is a translated TLS certificate
+type Certificate struct {
+	Hosts    []string `yaml:"hosts"`
+	CertFile string   `yaml:"cert_file"`
+	KeyFile  string   `yaml:"key_file"`
+}
+
+// anyHost is the route host used for servers that answer any host name,
+// since routes require a host
+const anyHost = "localhost"
+
+func newResult(source string) *Result {
+	return &Result{Source: source, Upstreams: make(map[string]*Upstream)}
+}
+
+// hostsOrAny returns hosts, or anyHost with a warning when there are none
+func (r *Result) hostsOrAny(hosts []string, line int, what string) []string {
+	if len(hosts) > 0 {
+		return hosts
+	}
+	r.warn(line, "%s has no host name, its routes use host %q; replace it with the served host names", what, anyHost)
+	return []string{anyHost}
+}
+
+// warn records a directive that could not be translated
+func (r *Result) warn(line int, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if line > 0 {
+		message = fmt.Sprintf("line %d: %s", line, message)
+	}
+	r.Warnings = append(r.Warnings, message)
+}
+
+// addUpstream registers targets under a name derived from hint, reusing an
+// upstream with the same targets and load balancer
+func (r *Result) addUpstream(hint, loadBalancer string, targets []Target, healthCheck *HealthCheck) string {
+	for name, upstream := range r.Upstreams {
+		if upstream.LoadBalancer == loadBalancer && sameTargets(upstream.Targets, targets) &&
+			sameHealthCheck(upstream.HealthCheck, healthCheck) {
+			return name
+		}
+	}
+
+	base := upstreamName(hint)
+	name := base
+	for i := 2; r.Upstreams[name] != nil; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	r.Upstreams[name] = &Upstream{LoadBalancer: loadBalancer, HealthCheck: healthCheck, Targets: targets}
+	return name
+}
+
+func sameTargets(a, b []Target) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameHealthCheck(a, b *HealthCheck) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// upstreamName turns a host or label into an upstream service name
+func upstreamName(hint string) string {
+	name := strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(hint), "-"), "-")
+	if name == "" {
+		return "backend"
+	}
+	return name
+}
+
+// targetURL normalizes an upstream address to a target URL
+func targetURL(address, defaultScheme string) (string, error) {
+	if !strings.Contains(address, "://") {
+		address = defaultScheme + "://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid upstream address: %s", address)
+	}
+	if strings.HasPrefix(u.Host, "unix:") {
+		return "", fmt.Errorf("unix socket upstreams are not supported: %s", address)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Host, port)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// sortRoutes orders routes so the most specific path of each host matches
+// first, like the longest-prefix selection of nginx and Caddy. Sentinel
+// evaluates routes in order.
+func (r *Result) sortRoutes() {
+	specificity := func(route Route) (bool, int) {
+		exact := !strings.HasSuffix(route.Path, "/*")
+		return exact, len(strings.TrimSuffix(route.Path, "/*"))
+	}
+	sort.SliceStable(r.Routes, func(i, j int) bool {
+		a, b := r.Routes[i], r.Routes[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		exactA, lenA := specificity(a)
+		exactB, lenB := specificity(b)
+		if exactA != exactB {
+			return exactA
+		}
+		return lenA > lenB
+	})
+}
+
+// UpstreamsYAML renders the upstreams as an upstreams.yaml file
+func (r *Result) UpstreamsYAML() ([]byte, error) {
+	names := make([]string, 0, len(r.Upstreams))
+	for name := range r.Upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range names {
+		value := &yaml.Node{}
+		if err := value.Encode(r.Upstreams[name]); err != nil {
+			return nil, err
+		}
+		services.Content = append(services.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "services"}, services,
+	}}
+	return r.render("upstreams", doc)
+}
+
+// RoutesYAML renders the routes as a routes.yaml file
+func (r *Result) RoutesYAML() ([]byte, error) {
+	return r.render("routes", map[string]any{"rules": r.Routes})
+}
+
+// TLSYAML renders the certificates as a tls.yaml file, or nil if the source
+// configured none
+func (r *Result) TLSYAML() ([]byte, error) {
+	if len(r.Certificates) == 0 {
+		return nil, nil
+	}
+	return r.render("TLS", struct {
+		Enabled      bool          `yaml:"enabled"`
+		Certificates []Certificate `yaml:"certificates"`
+	}{true, r.Certificates})
+}
+
+func (r *Result) render(what string, doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Sentinel %s converted from %s\n", what, r.Source)
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", what, err)
+	}
+	encoder.Close()
+	return buf.Bytes(), nil
+}
+
+// parseNginxDuration converts an nginx time value (e.g. 60, 30s, 1m, 500ms)
+func parseNginxDuration(value string) (time.Duration, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if d, err := time.ParseDuration(strings.TrimSuffix(value, "d") + "h"); err == nil {
+			return d * 24, nil
+		}
+	}
+	// Plain numbers are seconds
+	return time.ParseDuration(value + "s")
+}
@@ -0,0 +1,563 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// directive is a parsed nginx directive or Caddyfile line
+type directive struct {
+	name  string
+	args  []string
+	line  int
+	block []*directive
+}
+
+// nginxContext holds the settings a location inherits from its parents
+type nginxContext struct {
+	headers map[string]string
+	timeout time.Duration
+	methods []string
+}
+
+// nginxServer is a server block being translated
+type nginxServer struct {
+	hosts []string
+	ctx   nginxContext
+}
+
+// nginxUpstream is an upstream block, instantiated when a proxy_pass
+// references it because the scheme is only known there
+type nginxUpstream struct {
+	loadBalancer string
+	servers      []Target // host:port addresses
+	used         bool
+}
+
+// Directives handled by Sentinel itself or irrelevant to routing
+var nginxIgnored = map[string]bool{
+	"user": true, "worker_processes": true, "worker_connections": true, "pid": true,
+	"error_log": true, "access_log": true, "log_format": true, "events": true,
+	"sendfile": true, "tcp_nopush": true, "tcp_nodelay": true, "keepalive_timeout": true,
+	"types_hash_max_size": true, "default_type": true, "server_tokens": true, "charset": true,
+	"proxy_http_version": true, "proxy_buffering": true, "proxy_buffers": true,
+	"proxy_buffer_size": true, "proxy_busy_buffers_size": true, "proxy_redirect": true,
+	"client_max_body_size": true, "client_body_buffer_size": true, "listen": true,
+	"ssl_protocols": true, "ssl_ciphers": true, "ssl_prefer_server_ciphers": true,
+	"ssl_session_cache": true, "ssl_session_timeout": true, "resolver": true,
+	"worker_rlimit_nofile": true, "multi_accept": true, "keepalive": true,
+}
+
+// Forwarding headers Sentinel sets on proxied requests
+var nginxForwardedHeaders = map[string]bool{
+	"x-real-ip": true, "x-forwarded-for": true, "x-forwarded-proto": true, "x-forwarded-host": true,
+	"upgrade": true, "connection": true,
+}
+
+// FromNginx translates the server, location and upstream blocks of an
+// nginx configuration
+func FromNginx(data []byte, source string) (*Result, error) {
+	directives, err := parseNginx(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult(source)
+	upstreams := make(map[string]*nginxUpstream)
+	var servers []*directive
+
+	var collect func(directives []*directive)
+	collect = func(directives []*directive) {
+		for _, d := range directives {
+			switch d.name {
+			case "http":
+				collect(d.block)
+			case "server":
+				servers = append(servers, d)
+			case "upstream":
+				if len(d.args) != 1 {
+					result.warn(d.line, "upstream without a name skipped")
+					continue
+				}
+				upstreams[d.args[0]] = parseNginxUpstream(d, result)
+			case "include":
+				result.warn(d.line, "include %s not followed, convert included files separately", strings.Join(d.args, " "))
+			case "stream", "mail":
+				result.warn(d.line, "%s blocks are not supported", d.name)
+			case "gzip":
+				if len(d.args) > 0 && d.args[0] == "on" {
+					result.warn(d.line, "gzip: add the compression middleware to routes")
+				}
+			case "map", "geo", "split_clients", "limit_req_zone", "limit_conn_zone", "proxy_cache_path":
+				result.warn(d.line, "%s is not translated", d.name)
+			default:
+				if !nginxIgnored[d.name] && !strings.HasPrefix(d.name, "gzip_") && !strings.HasPrefix(d.name, "ssl_") {
+					result.warn(d.line, "%s is not translated", d.name)
+				}
+			}
+		}
+	}
+	collect(directives)
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no server blocks found")
+	}
+	for _, d := range servers {
+		translateNginxServer(d, upstreams, result)
+	}
+	for name, upstream := range upstreams {
+		if !upstream.used {
+			result.warn(0, "upstream %s is not referenced by any proxy_pass and was skipped", name)
+		}
+	}
+
+	result.sortRoutes()
+	return result, nil
+}
+
+// parseNginxUpstream reads the servers and balancing method of an upstream
+func parseNginxUpstream(d *directive, result *Result) *nginxUpstream {
+	upstream := &nginxUpstream{loadBalancer: "round_robin"}
+	for _, child := range d.block {
+		switch child.name {
+		case "server":
+			if len(child.args) == 0 {
+				continue
+			}
+			target := Target{URL: child.args[0]}
+			skip := false
+			for _, param := range child.args[1:] {
+				switch {
+				case strings.HasPrefix(param, "weight="):
+					fmt.Sscanf(strings.TrimPrefix(param, "weight="), "%d", &target.Weight)
+				case param == "backup":
+					result.warn(child.line, "backup server %s skipped, backup servers are not supported", child.args[0])
+					skip = true
+				case param == "down":
+					skip = true
+				}
+			}
+			if !skip {
+				upstream.servers = append(upstream.servers, target)
+			}
+		case "least_conn":
+			upstream.loadBalancer = "least_connections"
+		case "ip_hash":
+			upstream.loadBalancer = "ip_hash"
+		case "hash", "random", "least_time":
+			result.warn(child.line, "%s balancing is not supported, using round_robin", child.name)
+		case "keepalive", "keepalive_timeout", "keepalive_requests", "zone":
+		default:
+			result.warn(child.line, "upstream %s: %s is not translated", d.args[0], child.name)
+		}
+	}
+	return upstream
+}
+
+// translateNginxServer turns the locations of a server block into routes
+func translateNginxServer(d *directive, upstreams map[string]*nginxUpstream, result *Result) {
+	server := &nginxServer{ctx: nginxContext{headers: map[string]string{}}}
+	var certFile, keyFile string
+	var locations []*directive
+
+	for _, child := range d.block {
+		switch child.name {
+		case "server_name":
+			for _, name := range child.args {
+				switch {
+				case name == "_" || name == "" || name == `""`:
+				case strings.HasPrefix(name, "~"):
+					result.warn(child.line, "regular expression server name %s skipped", name)
+				case strings.Contains(name, "*") || strings.HasPrefix(name, "."):
+					result.warn(child.line, "wildcard server name %s skipped, list each host explicitly", name)
+				default:
+					server.hosts = append(server.hosts, name)
+				}
+			}
+		case "ssl_certificate":
+			certFile = firstArg(child)
+		case "ssl_certificate_key":
+			keyFile = firstArg(child)
+		case "location":
+			locations = append(locations, child)
+		default:
+			applyNginxDirective(child, &server.ctx, result, true)
+		}
+	}
+
+	if certFile != "" && keyFile != "" {
+		result.Certificates = append(result.Certificates, Certificate{Hosts: server.hosts, CertFile: certFile, KeyFile: keyFile})
+	}
+	hosts := result.hostsOrAny(server.hosts, d.line, "server block")
+
+	for _, location := range locations {
+		translateNginxLocation(location, hosts, server.ctx, upstreams, result)
+	}
+}
+
+// translateNginxLocation turns a location and its nested locations into routes
+func translateNginxLocation(d *directive, hosts []string, parent nginxContext, upstreams map[string]*nginxUpstream, result *Result) {
+	if len(d.args) == 0 {
+		return
+	}
+
+	// Inherit the parent settings. Like nginx, add_header directives replace
+	// the inherited ones rather than adding to them.
+	ctx := nginxContext{headers: map[string]string{}, timeout: parent.timeout, methods: parent.methods}
+	if !hasDirective(d.block, "add_header") {
+		for name, value := range parent.headers {
+			ctx.headers[name] = value
+		}
+	}
+
+	var path, prefix string
+	switch {
+	case len(d.args) == 2 && d.args[0] == "=":
+		path = d.args[1]
+	case len(d.args) == 2 && d.args[0] == "^~":
+		prefix = d.args[1]
+	case len(d.args) == 2 && (d.args[0] == "~" || d.args[0] == "~*"):
+		result.warn(d.line, "regular expression location %s skipped, use a prefix path with a regex rewrite", d.args[1])
+		return
+	case strings.HasPrefix(d.args[0], "@"):
+		result.warn(d.line, "named location %s skipped", d.args[0])
+		return
+	default:
+		prefix = d.args[0]
+	}
+	if prefix != "" {
+		path = strings.TrimSuffix(prefix, "/") + "/*"
+	}
+
+	var proxyPass *directive
+	var rewrite *Rewrite
+	var nested []*directive
+	for _, child := range d.block {
+		switch child.name {
+		case "location":
+			nested = append(nested, child)
+		case "proxy_pass":
+			proxyPass = child
+		case "rewrite":
+			if len(child.args) < 2 {
+				continue
+			}
+			flag := ""
+			if len(child.args) > 2 {
+				flag = child.args[2]
+			}
+			switch {
+			case flag == "redirect" || flag == "permanent" || strings.Contains(child.args[1], "://"):
+				result.warn(child.line, "redirecting rewrite %s skipped", child.args[0])
+			case rewrite != nil:
+				result.warn(child.line, "only one regex rewrite per route is supported, %s skipped", child.args[0])
+			default:
+				replacement, _, hasQuery := strings.Cut(child.args[1], "?")
+				if hasQuery {
+					result.warn(child.line, "query arguments of rewrite %s dropped, rewrites apply to the path", child.args[0])
+				}
+				rewrite = &Rewrite{Regex: child.args[0], Replacement: nginxReplacement(replacement)}
+			}
+		case "limit_except":
+			ctx.methods = append([]string{}, child.args...)
+			// GET implies HEAD in nginx
+			if containsFold(child.args, "GET") && !containsFold(child.args, "HEAD") {
+				ctx.methods = append(ctx.methods, "HEAD")
+			}
+		default:
+			applyNginxDirective(child, &ctx, result, false)
+		}
+	}
+
+	// Nested locations inherit every directive of this one
+	for _, child := range nested {
+		translateNginxLocation(child, hosts, ctx, upstreams, result)
+	}
+
+	if proxyPass == nil {
+		return
+	}
+	upstream, uriPath, err := nginxProxyTarget(proxyPass, upstreams, result)
+	if err != nil {
+		result.warn(proxyPass.line, "location %s skipped: %v", strings.Join(d.args, " "), err)
+		return
+	}
+
+	// A proxy_pass URI replaces the matched location prefix
+	if uriPath != "" && rewrite == nil {
+		strip := strings.TrimSuffix(prefix, "/")
+		add := strings.TrimSuffix(uriPath, "/")
+		if prefix == "" {
+			// Exact locations are replaced entirely
+			rewrite = &Rewrite{Regex: "^" + regexp.QuoteMeta(path) + "$", Replacement: uriPath}
+		} else if strip != "" || add != "" {
+			rewrite = &Rewrite{StripPrefix: strip, AddPrefix: add}
+		}
+	}
+
+	for _, host := range hosts {
+		route := Route{
+			Host:     host,
+			Path:     path,
+			Methods:  ctx.methods,
+			Upstream: upstream,
+			Rewrite:  rewrite,
+		}
+		if len(ctx.headers) > 0 {
+			route.Headers = ctx.headers
+		}
+		if ctx.timeout > 0 {
+			route.Timeout = ctx.timeout.String()
+		}
+		result.Routes = append(result.Routes, route)
+	}
+}
+
+// applyNginxDirective applies a server or location level directive
+func applyNginxDirective(d *directive, ctx *nginxContext, result *Result, server bool) {
+	switch d.name {
+	case "add_header":
+		if len(d.args) >= 2 {
+			ctx.headers[d.args[0]] = d.args[1]
+		}
+	case "proxy_read_timeout", "proxy_send_timeout", "proxy_connect_timeout":
+		timeout, err := parseNginxDuration(firstArg(d))
+		if err != nil {
+			result.warn(d.line, "invalid %s %s", d.name, firstArg(d))
+			return
+		}
+		ctx.timeout = max(ctx.timeout, timeout)
+	case "proxy_set_header":
+		if len(d.args) > 0 && !nginxForwardedHeaders[strings.ToLower(d.args[0])] {
+			if strings.EqualFold(d.args[0], "Host") {
+				result.warn(d.line, "proxy_set_header Host not translated, Sentinel sends the target host")
+			} else {
+				result.warn(d.line, "proxy_set_header %s not translated, upstream request headers are not supported", d.args[0])
+			}
+		}
+	case "return":
+		result.warn(d.line, "return %s not translated, add the redirect or response to the upstream", strings.Join(d.args, " "))
+	case "rewrite":
+		if server {
+			result.warn(d.line, "server level rewrite %s not translated, move it into a location", firstArg(d))
+		}
+	case "root", "alias", "try_files", "index", "autoindex", "expires":
+		result.warn(d.line, "%s not translated, serve static files from an upstream", d.name)
+	case "auth_basic", "auth_basic_user_file", "auth_request":
+		result.warn(d.line, "%s not translated, configure the auth middleware", d.name)
+	case "limit_req", "limit_conn":
+		result.warn(d.line, "%s not translated, configure the rate_limit middleware", d.name)
+	case "gzip":
+		if firstArg(d) == "on" {
+			result.warn(d.line, "gzip: add the compression middleware to routes")
+		}
+	case "grpc_pass", "fastcgi_pass", "uwsgi_pass", "scgi_pass":
+		result.warn(d.line, "%s is not supported", d.name)
+	default:
+		if !nginxIgnored[d.name] && !strings.HasPrefix(d.name, "gzip_") && !strings.HasPrefix(d.name, "ssl_") &&
+			!strings.HasPrefix(d.name, "proxy_") {
+			result.warn(d.line, "%s is not translated", d.name)
+		}
+	}
+}
+
+// nginxProxyTarget resolves a proxy_pass to an upstream name and the URI
+// part that replaces the location prefix
+func nginxProxyTarget(d *directive, upstreams map[string]*nginxUpstream, result *Result) (string, string, error) {
+	address := firstArg(d)
+	if strings.Contains(address, "$") {
+		return "", "", fmt.Errorf("proxy_pass with variables is not supported")
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid proxy_pass %s", address)
+	}
+
+	if upstream, exists := upstreams[u.Host]; exists {
+		if len(upstream.servers) == 0 {
+			return "", "", fmt.Errorf("upstream %s has no usable servers", u.Host)
+		}
+		targets := make([]Target, 0, len(upstream.servers))
+		for _, server := range upstream.servers {
+			target, err := targetURL(server.URL, u.Scheme)
+			if err != nil {
+				return "", "", err
+			}
+			targets = append(targets, Target{URL: target, Weight: server.Weight})
+		}
+		upstream.used = true
+		return result.addUpstream(u.Host, upstream.loadBalancer, targets, nil), u.Path, nil
+	}
+
+	target, err := targetURL(u.Scheme+"://"+u.Host, u.Scheme)
+	if err != nil {
+		return "", "", err
+	}
+	return result.addUpstream(u.Hostname(), "round_robin", []Target{{URL: target}}, nil), u.Path, nil
+}
+
+var nginxCapture = regexp.MustCompile(`\$(\d)`)
+
+// nginxReplacement converts $1 references to ${1}, which Go requires when
+// a reference is followed by a letter or digit
+func nginxReplacement(replacement string) string {
+	return nginxCapture.ReplaceAllString(replacement, "$${$1}")
+}
+
+func firstArg(d *directive) string {
+	if len(d.args) == 0 {
+		return ""
+	}
+	return d.args[0]
+}
+
+func hasDirective(directives []*directive, name string) bool {
+	for _, d := range directives {
+		if d.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNginx parses nginx configuration syntax into directives
+func parseNginx(input string) ([]*directive, error) {
+	p := &nginxParser{input: input, line: 1}
+	directives, err := p.block(false)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", p.line, err)
+	}
+	return directives, nil
+}
+
+type nginxParser struct {
+	input string
+	pos   int
+	line  int
+}
+
+// block parses directives until the end of input or a closing brace
+func (p *nginxParser) block(nested bool) ([]*directive, error) {
+	var directives []*directive
+	var current *directive
+	for {
+		token, line, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case "":
+			if nested {
+				return nil, fmt.Errorf("unexpected end of file, missing }")
+			}
+			if current != nil {
+				return nil, fmt.Errorf("unexpected end of file, missing ;")
+			}
+			return directives, nil
+		case ";":
+			if current == nil {
+				continue
+			}
+			directives = append(directives, current)
+			current = nil
+		case "{":
+			if current == nil {
+				return nil, fmt.Errorf("unexpected {")
+			}
+			block, err := p.block(true)
+			if err != nil {
+				return nil, err
+			}
+			current.block = block
+			directives = append(directives, current)
+			current = nil
+		case "}":
+			if !nested {
+				return nil, fmt.Errorf("unexpected }")
+			}
+			if current != nil {
+				return nil, fmt.Errorf("missing ; after %s", current.name)
+			}
+			return directives, nil
+		default:
+			if current == nil {
+				current = &directive{name: token, line: line}
+			} else {
+				current.args = append(current.args, token)
+			}
+		}
+	}
+}
+
+// token returns the next token and its line, or "" at the end of input.
+// Quotes are removed from quoted strings.
+func (p *nginxParser) token() (string, int, error) {
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.input) && p.input[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ';' || c == '{' || c == '}':
+			p.pos++
+			return string(c), p.line, nil
+		case c == '"' || c == '\'':
+			line := p.line
+			var b strings.Builder
+			p.pos++
+			for p.pos < len(p.input) && p.input[p.pos] != c {
+				if p.input[p.pos] == '\\' && p.pos+1 < len(p.input) {
+					p.pos++
+				}
+				if p.input[p.pos] == '\n' {
+					p.line++
+				}
+				b.WriteByte(p.input[p.pos])
+				p.pos++
+			}
+			if p.pos >= len(p.input) {
+				return "", line, fmt.Errorf("unterminated quoted string")
+			}
+			p.pos++
+			return b.String(), line, nil
+		default:
+			start := p.pos
+			for p.pos < len(p.input) {
+				c := p.input[p.pos]
+				if c == '$' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '{' {
+					// ${variable} is part of the token
+					end := strings.IndexByte(p.input[p.pos:], '}')
+					if end < 0 {
+						return "", p.line, fmt.Errorf("unterminated variable")
+					}
+					p.pos += end + 1
+					continue
+				}
+				if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';' || c == '{' || c == '}' {
+					break
+				}
+				p.pos++
+			}
+			return p.input[start:p.pos], p.line, nil
+		}
+	}
+	return "", p.line, nil
+}
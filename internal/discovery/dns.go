@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsProvider periodically resolves the A and AAAA records of a
+// dns://host:port target, such as a name with several round-robin addresses
+// or a Kubernetes headless service
+type dnsProvider struct {
+	target   *config.DNSTarget
+	settings config.DNSDiscoveryConfig
+	client   *dnsClient
+	logger   *zap.Logger
+	targets  chan []Endpoint
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Owned by the run goroutine
+	endpoints []Endpoint
+	published bool
+}
+
+// newDNSProvider creates the provider of a DNS target
+func newDNSProvider(targetURL string, settings config.DiscoveryConfig, logger *zap.Logger) (Provider, error) {
+	target, err := config.ParseDNSTarget(targetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnsProvider{
+		target:   target,
+		settings: settings.DNS,
+		client:   newDNSClient(settings.DNS.Resolver),
+		logger:   logger,
+		targets:  make(chan []Endpoint),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins resolving the records
+func (p *dnsProvider) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return nil
+}
+
+// Stop stops resolving and closes the Targets channel
+func (p *dnsProvider) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Targets delivers the addresses of the host whenever they change
+func (p *dnsProvider) Targets() <-chan []Endpoint {
+	return p.targets
+}
+
+// run resolves the records whenever their TTL expires, retrying sooner
+// after failures. The last resolved endpoints are kept while lookups fail.
+func (p *dnsProvider) run(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.targets)
+
+	for {
+		ttl, err := p.resolve(ctx)
+		wait := refreshInterval(ttl, p.settings.MinInterval, p.settings.Interval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("Failed to resolve DNS records", zap.Error(err))
+			wait = refreshInterval(retryInterval, 0, p.settings.Interval)
+		}
+		if !sleepContext(ctx, wait) {
+			return
+		}
+	}
+}
+
+// resolve looks up the A and AAAA records and records their endpoints. It
+// returns how long the records may be cached.
+func (p *dnsProvider) resolve(ctx context.Context) (time.Duration, error) {
+	var addrs []netip.Addr
+	var ttl time.Duration
+	found := false
+	var errs []error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, answersTTL, err := p.client.lookup(ctx, p.target.Host, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, answer := range answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, netip.AddrFrom4(body.A))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+			}
+		}
+		if len(answers) > 0 && (!found || answersTTL < ttl) {
+			ttl = answersTTL
+			found = true
+		}
+	}
+	// Hosts often only have one kind of address, so a failed lookup only
+	// matters when the other found nothing. Names such as localhost may
+	// only be known to the system resolver, which reports no TTL.
+	if len(addrs) == 0 {
+		system, err := net.DefaultResolver.LookupNetIP(ctx, "ip", p.target.Host)
+		if err != nil || len(system) == 0 {
+			if len(errs) > 0 {
+				return 0, errors.Join(errs...)
+			}
+			return 0, fmt.Errorf("no A or AAAA records for %s", p.target.Host)
+		}
+		for _, addr := range system {
+			addrs = append(addrs, addr.Unmap())
+		}
+		ttl = p.settings.Interval
+	}
+
+	endpoints := make([]Endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, Endpoint{URL: p.target.Scheme + "://" + net.JoinHostPort(addr.String(), p.target.Port)})
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].URL < endpoints[j].URL })
+	endpoints = slices.Compact(endpoints)
+
+	if p.published && slices.Equal(endpoints, p.endpoints) {
+		return ttl, nil
+	}
+	p.logger.Info("DNS endpoints changed", zap.Strings("endpoints", endpointURLs(endpoints)))
+	p.endpoints = endpoints
+	p.published = publish(ctx, p.targets, endpoints)
+	return ttl, nil
+}
@@ -0,0 +1,278 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTimeout bounds a single lookup
+const dnsTimeout = 5 * time.Second
+
+// resolvConf lists the DNS servers used when no resolver is configured
+const resolvConf = "/etc/resolv.conf"
+
+// udpPayloadSize is the largest UDP response advertised with EDNS(0)
+const udpPayloadSize = 1232
+
+// errNoSuchHost is returned for names that do not exist
+var errNoSuchHost = errors.New("no such host")
+
+// dnsClient queries DNS servers directly, unlike net.Resolver, so lookups
+// report how long their records may be cached
+type dnsClient struct {
+	servers []string // host:port, tried in order
+	search  []string // domains tried for names with fewer than ndots dots
+	ndots   int
+}
+
+// newDNSClient creates a client for a DNS server, or for the servers in
+// /etc/resolv.conf when server is empty. Names are completed with the
+// search domains of /etc/resolv.conf either way.
+func newDNSClient(server string) *dnsClient {
+	client := readResolvConf()
+	if server != "" {
+		client.servers = []string{server}
+	}
+	return client
+}
+
+// readResolvConf reads the nameservers, search domains and ndots option in
+// /etc/resolv.conf, falling back to a local server like the Go resolver does
+func readResolvConf() *dnsClient {
+	client := &dnsClient{ndots: 1}
+	if file, err := os.Open(resolvConf); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 {
+				continue
+			}
+			switch fields[0] {
+			case "nameserver":
+				if net.ParseIP(fields[1]) != nil {
+					client.servers = append(client.servers, net.JoinHostPort(fields[1], "53"))
+				}
+			case "domain", "search":
+				// The last of them wins
+				client.search = nil
+				for _, domain := range fields[1:] {
+					client.search = append(client.search, strings.TrimSuffix(domain, ".")+".")
+				}
+			case "options":
+				for _, option := range fields[1:] {
+					if value, ok := strings.CutPrefix(option, "ndots:"); ok {
+						if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+							client.ndots = min(n, 15)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(client.servers) == 0 {
+		client.servers = []string{"127.0.0.1:53", "[::1]:53"}
+	}
+	return client
+}
+
+// names returns the fully qualified names to try for a name, in order:
+// names with fewer than ndots dots are tried in the search domains first,
+// and names ending in a dot only as they are
+func (c *dnsClient) names(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+	names := make([]string, 0, len(c.search)+1)
+	for _, domain := range c.search {
+		names = append(names, name+"."+domain)
+	}
+	if strings.Count(name, ".") >= c.ndots {
+		return append([]string{name + "."}, names...)
+	}
+	return append(names, name+".")
+}
+
+// lookup resolves the records of a type for a name, trying it in the search
+// domains like the system resolver. It returns the answers of that type of
+// the first name having any, following CNAMEs, and the shortest TTL among
+// the answers.
+func (c *dnsClient) lookup(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, time.Duration, error) {
+	var lastErr error
+	found := false // a name exists without records of the type
+	for _, fqdn := range c.names(name) {
+		answers, ttl, err := c.lookupName(ctx, fqdn, qtype)
+		switch {
+		case err == nil && len(answers) > 0:
+			return answers, ttl, nil
+		case err == nil:
+			found = true
+		case ctx.Err() != nil:
+			return nil, 0, err
+		case lastErr == nil || !errors.Is(err, errNoSuchHost):
+			lastErr = err
+		}
+	}
+	if found {
+		return nil, 0, nil
+	}
+	return nil, 0, lastErr
+}
+
+// lookupName resolves the records of a type for a fully qualified name
+func (c *dnsClient) lookupName(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	question := dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}
+
+	var lastErr error
+	for _, server := range c.servers {
+		msg, err := c.exchange(ctx, server, question)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, err
+			}
+			lastErr = err
+			continue
+		}
+
+		switch msg.RCode {
+		case dnsmessage.RCodeSuccess:
+		case dnsmessage.RCodeNameError:
+			return nil, 0, fmt.Errorf("lookup %s: %w", name, errNoSuchHost)
+		default:
+			lastErr = fmt.Errorf("lookup %s on %s: server returned %s", name, server, msg.RCode)
+			continue
+		}
+
+		var answers []dnsmessage.Resource
+		var ttl time.Duration
+		for i, answer := range msg.Answers {
+			if answer.Header.Type == qtype {
+				answers = append(answers, answer)
+			}
+			answerTTL := time.Duration(answer.Header.TTL) * time.Second
+			if i == 0 || answerTTL < ttl {
+				ttl = answerTTL
+			}
+		}
+		return answers, ttl, nil
+	}
+	return nil, 0, lastErr
+}
+
+// exchange sends a question to a server over UDP, retrying over TCP when the
+// response is truncated
+func (c *dnsClient) exchange(ctx context.Context, server string, question dnsmessage.Question) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	msg, err := c.exchangeOver(ctx, "udp", server, question)
+	if err == nil && msg.Truncated {
+		msg, err = c.exchangeOver(ctx, "tcp", server, question)
+	}
+	return msg, err
+}
+
+// exchangeOver sends a question to a server over a network and reads the
+// response
+func (c *dnsClient) exchangeOver(ctx context.Context, network, server string, question dnsmessage.Question) (*dnsmessage.Message, error) {
+	id := uint16(rand.UintN(1 << 16))
+	query, err := buildQuery(id, question)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var response []byte
+	if network == "tcp" {
+		// Messages over TCP are prefixed with their length
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(framed, query...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		response = make([]byte, udpPayloadSize)
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		response = response[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %w", server, err)
+	}
+	if msg.ID != id || !msg.Response || len(msg.Questions) != 1 || msg.Questions[0].Type != question.Type ||
+		!strings.EqualFold(msg.Questions[0].Name.String(), question.Name.String()) {
+		return nil, fmt.Errorf("mismatched response from %s", server)
+	}
+	return &msg, nil
+}
+
+// buildQuery encodes a recursive query advertising EDNS(0)
+func buildQuery(id uint16, question dnsmessage.Question) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(udpPayloadSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// refreshInterval returns how long to wait before resolving records with a
+// TTL again, within the configured bounds
+func refreshInterval(ttl, minInterval, maxInterval time.Duration) time.Duration {
+	if maxInterval <= 0 {
+		maxInterval = 30 * time.Second
+	}
+	return min(max(ttl, minInterval), maxInterval)
+}
@@ -0,0 +1,235 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// targetsFileDebounce is the quiet period before a changed targets file is
+// read. It is short because target files may be rewritten frequently.
+const targetsFileDebounce = 100 * time.Millisecond
+
+// fileProvider reads the targets of a file://path target from a file and
+// rereads it whenever it changes, independently of configuration reloads.
+// The directory is watched so files replaced by renaming, as well as
+// Kubernetes ConfigMap volumes, are picked up.
+type fileProvider struct {
+	path    string
+	logger  *zap.Logger
+	targets chan []Endpoint
+
+	watcher *fsnotify.Watcher
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	// Owned by the run goroutine
+	endpoints []Endpoint
+	published bool
+}
+
+// newFileProvider creates the provider of a targets file
+func newFileProvider(targetURL string, _ config.DiscoveryConfig, logger *zap.Logger) (Provider, error) {
+	path, err := config.ParseFileTarget(targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, fmt.Errorf("failed to resolve targets file path: %w", err)
+	}
+
+	return &fileProvider{
+		path:    path,
+		logger:  logger,
+		targets: make(chan []Endpoint),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start begins watching the targets file
+func (p *fileProvider) Start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(p.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch targets file directory: %w", err)
+	}
+	p.watcher = watcher
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return nil
+}
+
+// Stop stops watching and closes the Targets channel
+func (p *fileProvider) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Targets delivers the targets listed in the file whenever they change
+func (p *fileProvider) Targets() <-chan []Endpoint {
+	return p.targets
+}
+
+// run reads the file initially and after every change
+func (p *fileProvider) run(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.targets)
+	defer p.watcher.Close()
+
+	p.load(ctx)
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			base := filepath.Base(event.Name)
+			if event.Name == p.path || strings.HasPrefix(base, "..") {
+				reload = time.After(targetsFileDebounce)
+			}
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			p.logger.Error("Targets file watcher error", zap.Error(err))
+		case <-reload:
+			reload = nil
+			p.load(ctx)
+		}
+	}
+}
+
+// load reads the file and publishes its targets if they changed. A file
+// that is missing or invalid keeps the previous targets.
+func (p *fileProvider) load(ctx context.Context) {
+	endpoints, err := readTargetsFile(p.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			p.logger.Warn("Targets file not found", zap.String("file", p.path))
+		} else {
+			p.logger.Error("Failed to read targets file, keeping previous targets", zap.String("file", p.path), zap.Error(err))
+		}
+		if p.published {
+			return
+		}
+		endpoints = nil
+	}
+
+	if p.published && slices.Equal(endpoints, p.endpoints) {
+		return
+	}
+	p.logger.Info("Targets file changed", zap.String("file", p.path), zap.Strings("targets", endpointURLs(endpoints)))
+	p.endpoints = endpoints
+	p.published = publish(ctx, p.targets, endpoints)
+}
+
+// readTargetsFile parses a targets file. The file is either a YAML list of
+// targets with url and weight, or one target per line as "<url> [weight]",
+// with blank lines and # comments ignored.
+func readTargetsFile(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	if strings.HasPrefix(strings.TrimSpace(stripComments(data)), "-") {
+		var targets []config.Target
+		if err := yaml.Unmarshal(data, &targets); err != nil {
+			return nil, fmt.Errorf("failed to parse targets: %w", err)
+		}
+		for _, target := range targets {
+			endpoints = append(endpoints, Endpoint{URL: target.URL, Weight: target.Weight})
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			fields := strings.Fields(stripComment(scanner.Text()))
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) > 2 {
+				return nil, fmt.Errorf("line %d: expected \"<url> [weight]\"", line)
+			}
+			endpoint := Endpoint{URL: fields[0]}
+			if len(fields) == 2 {
+				weight, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid weight %q", line, fields[1])
+				}
+				endpoint.Weight = weight
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		if err := validateEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+	}
+	return endpoints, nil
+}
+
+// validateEndpoint checks a target listed in a targets file
+func validateEndpoint(endpoint Endpoint) error {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return fmt.Errorf("invalid target URL %s: %w", endpoint.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("target URL %s: scheme must be http or https", endpoint.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("target URL %s must have a host", endpoint.URL)
+	}
+	if endpoint.Weight < 0 {
+		return fmt.Errorf("target %s: weight cannot be negative", endpoint.URL)
+	}
+	return nil
+}
+
+// stripComments removes # comments from every line of data
+func stripComments(data []byte) string {
+	var b strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString(stripComment(line))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// stripComment removes a # comment from a line
+func stripComment(line string) string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
@@ -0,0 +1,275 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/kubernetes"
+	"go.uber.org/zap"
+)
+
+// serviceNameLabel links EndpointSlices to their Service
+const serviceNameLabel = "kubernetes.io/service-name"
+
+// service holds the Service fields used to map ports
+type service struct {
+	Spec struct {
+		Ports []servicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+// servicePort is a port exposed by a Service
+type servicePort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// endpointSlice holds the EndpointSlice fields used to resolve endpoints
+type endpointSlice struct {
+	Metadata  kubernetes.Metadata `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"ports"`
+}
+
+// kubeClients holds the API clients shared by providers, by settings
+var (
+	kubeClientsMu sync.Mutex
+	kubeClients   = make(map[config.KubernetesDiscoveryConfig]*kubernetes.Client)
+)
+
+// kubernetesProvider resolves a k8s://namespace/service:port target to the
+// ready endpoints of a Kubernetes service port by watching the service's
+// EndpointSlices
+type kubernetesProvider struct {
+	client  *kubernetes.Client
+	target  *config.KubernetesTarget
+	logger  *zap.Logger
+	targets chan []Endpoint
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Owned by the run goroutine
+	slices    map[string]*endpointSlice
+	portName  string
+	endpoints []string
+	published bool
+}
+
+// newKubernetesProvider creates the provider of a Kubernetes target
+func newKubernetesProvider(targetURL string, settings config.DiscoveryConfig, logger *zap.Logger) (Provider, error) {
+	target, err := config.ParseKubernetesTarget(targetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClientsMu.Lock()
+	defer kubeClientsMu.Unlock()
+	client, ok := kubeClients[settings.Kubernetes]
+	if !ok {
+		client, err = kubernetes.NewClient(kubernetes.Options{
+			Server:    settings.Kubernetes.APIServer,
+			TokenFile: settings.Kubernetes.TokenFile,
+			CAFile:    settings.Kubernetes.CAFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		kubeClients[settings.Kubernetes] = client
+	}
+
+	return &kubernetesProvider{
+		client:  client,
+		target:  target,
+		logger:  logger,
+		targets: make(chan []Endpoint),
+		done:    make(chan struct{}),
+		slices:  make(map[string]*endpointSlice),
+	}, nil
+}
+
+// Start begins watching the service's endpoints
+func (p *kubernetesProvider) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return nil
+}
+
+// Stop stops watching and closes the Targets channel
+func (p *kubernetesProvider) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Targets delivers the ready endpoints whenever they change
+func (p *kubernetesProvider) Targets() <-chan []Endpoint {
+	return p.targets
+}
+
+// run lists and watches the service's EndpointSlices, relisting whenever the
+// watch cannot be resumed
+func (p *kubernetesProvider) run(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.targets)
+
+	path := kubernetes.CollectionPath("discovery.k8s.io/v1", "endpointslices", p.target.Namespace)
+	query := url.Values{"labelSelector": {serviceNameLabel + "=" + p.target.Service}}
+
+	resourceVersion := ""
+	for {
+		if resourceVersion == "" {
+			rv, err := p.list(ctx, path, query)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				p.logger.Error("Failed to resolve Kubernetes service endpoints", zap.Error(err))
+				if !sleepContext(ctx, retryInterval) {
+					return
+				}
+				continue
+			}
+			resourceVersion = rv
+		}
+
+		rv, err := p.client.Watch(ctx, path, query, resourceVersion, func(event kubernetes.Event) {
+			p.apply(ctx, event)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		resourceVersion = rv
+		switch {
+		case err == kubernetes.ErrResourceExpired:
+			resourceVersion = ""
+		case err != nil:
+			p.logger.Error("Kubernetes endpoint watch failed", zap.Error(err))
+			resourceVersion = ""
+			if !sleepContext(ctx, retryInterval) {
+				return
+			}
+		}
+	}
+}
+
+// list resolves the service port and replaces the known EndpointSlices
+func (p *kubernetesProvider) list(ctx context.Context, path string, query url.Values) (string, error) {
+	portName, err := p.resolvePort(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var items []*endpointSlice
+	rv, err := p.client.List(ctx, path, query, &items)
+	if err != nil {
+		return "", err
+	}
+
+	p.portName = portName
+	p.slices = make(map[string]*endpointSlice, len(items))
+	for _, slice := range items {
+		p.slices[slice.Metadata.Name] = slice
+	}
+	p.update(ctx)
+
+	return rv, nil
+}
+
+// resolvePort returns the name of the service port the target refers to.
+// EndpointSlice ports carry the service port's name, not its number.
+func (p *kubernetesProvider) resolvePort(ctx context.Context) (string, error) {
+	number, err := strconv.Atoi(p.target.Port)
+	if err != nil {
+		return p.target.Port, nil
+	}
+
+	var svc service
+	if err := p.client.Get(ctx, kubernetes.ObjectPath("v1", "services", p.target.Namespace, p.target.Service), &svc); err != nil {
+		return "", err
+	}
+	for _, port := range svc.Spec.Ports {
+		if port.Port == number {
+			return port.Name, nil
+		}
+	}
+	return "", fmt.Errorf("service %s/%s has no port %d", p.target.Namespace, p.target.Service, number)
+}
+
+// apply records a changed EndpointSlice
+func (p *kubernetesProvider) apply(ctx context.Context, event kubernetes.Event) {
+	var slice endpointSlice
+	if err := json.Unmarshal(event.Object, &slice); err != nil {
+		p.logger.Error("Failed to decode EndpointSlice", zap.Error(err))
+		return
+	}
+
+	if event.Type == "DELETED" {
+		delete(p.slices, slice.Metadata.Name)
+	} else {
+		p.slices[slice.Metadata.Name] = &slice
+	}
+	p.update(ctx)
+}
+
+// update recomputes the endpoint URLs from the known EndpointSlices and
+// publishes them if they changed
+func (p *kubernetesProvider) update(ctx context.Context) {
+	seen := make(map[string]bool)
+	var endpoints []string
+	for _, slice := range p.slices {
+		port := 0
+		for _, slicePort := range slice.Ports {
+			if slicePort.Name == p.portName {
+				port = slicePort.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			// A missing condition means ready
+			if ready := endpoint.Conditions.Ready; ready != nil && !*ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				u := p.target.Scheme + "://" + net.JoinHostPort(address, strconv.Itoa(port))
+				if !seen[u] {
+					seen[u] = true
+					endpoints = append(endpoints, u)
+				}
+			}
+		}
+	}
+	sort.Strings(endpoints)
+
+	if p.published && slices.Equal(endpoints, p.endpoints) {
+		return
+	}
+	p.logger.Info("Kubernetes service endpoints changed", zap.Strings("endpoints", endpoints))
+	p.endpoints = endpoints
+
+	published := make([]Endpoint, len(endpoints))
+	for i, u := range endpoints {
+		published[i] = Endpoint{URL: u}
+	}
+	p.published = publish(ctx, p.targets, published)
+}
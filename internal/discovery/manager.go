@@ -0,0 +1,230 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// retryInterval is how long providers wait before retrying after an error
+const retryInterval = 5 * time.Second
+
+// initialSyncTimeout bounds how long Sync waits for new providers to resolve
+// their first set of endpoints
+const initialSyncTimeout = 5 * time.Second
+
+// Manager runs a provider for every dynamic upstream target and keeps the
+// latest endpoints each resolved to
+type Manager struct {
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	settings config.DiscoveryConfig
+	watches  map[string]*watch // by target URL
+	onChange func()
+}
+
+// watch tracks the endpoints delivered by the provider of a target
+type watch struct {
+	provider Provider
+	synced   chan struct{} // closed once the first endpoints arrived
+	done     chan struct{} // closed once the provider's channel is closed
+	notify   func()        // called after the endpoints changed
+
+	mu        sync.RWMutex
+	endpoints []Endpoint
+}
+
+// NewManager creates a discovery manager
+func NewManager(logger *zap.Logger) *Manager {
+	return &Manager{
+		logger:  logger,
+		watches: make(map[string]*watch),
+	}
+}
+
+// Sync starts providers for the dynamic targets of a configuration and stops
+// those no longer referenced by it. Changed discovery settings restart every
+// provider.
+func (m *Manager) Sync(cfg *config.Config) error {
+	wanted := make(map[string]bool)
+	for _, service := range cfg.Upstreams.Services {
+		for _, target := range service.AllTargets() {
+			if IsDynamic(target.URL) {
+				wanted[target.URL] = true
+			}
+		}
+	}
+
+	m.mu.Lock()
+	var stale, started []*watch
+
+	restart := !reflect.DeepEqual(m.settings, cfg.Upstreams.Discovery)
+	m.settings = cfg.Upstreams.Discovery
+	for url, w := range m.watches {
+		if restart || !wanted[url] {
+			stale = append(stale, w)
+			delete(m.watches, url)
+		}
+	}
+
+	for url := range wanted {
+		if _, ok := m.watches[url]; ok {
+			continue
+		}
+		w, err := m.start(url)
+		if err != nil {
+			m.mu.Unlock()
+			stopAll(stale)
+			stopAll(started)
+			return err
+		}
+		m.watches[url] = w
+		started = append(started, w)
+	}
+	m.mu.Unlock()
+
+	stopAll(stale)
+
+	// Wait briefly so new targets have endpoints before they take traffic
+	deadline := time.NewTimer(initialSyncTimeout)
+	defer deadline.Stop()
+	for _, w := range started {
+		select {
+		case <-w.synced:
+		case <-deadline.C:
+			m.logger.Warn("Timed out resolving dynamic targets")
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// start creates and starts the provider of a target. The caller must hold
+// the lock.
+func (m *Manager) start(targetURL string) (*watch, error) {
+	factory, ok := providerFor(targetURL)
+	if !ok {
+		return nil, fmt.Errorf("no discovery provider for %s", targetURL)
+	}
+	provider, err := factory(targetURL, m.settings, m.logger.With(zap.String("target", targetURL)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery provider for %s: %w", targetURL, err)
+	}
+	if err := provider.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start discovery provider for %s: %w", targetURL, err)
+	}
+
+	w := &watch{
+		provider: provider,
+		synced:   make(chan struct{}),
+		done:     make(chan struct{}),
+		notify:   m.notify,
+	}
+	go w.receive()
+	return w, nil
+}
+
+// receive records the endpoints delivered by the provider until it stops
+func (w *watch) receive() {
+	defer close(w.done)
+
+	first := true
+	for endpoints := range w.provider.Targets() {
+		w.mu.Lock()
+		w.endpoints = endpoints
+		w.mu.Unlock()
+		w.notify()
+
+		if first {
+			close(w.synced)
+			first = false
+		}
+	}
+}
+
+// OnChange registers a function called whenever a dynamic target resolves
+// to new endpoints
+func (m *Manager) OnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// notify reports changed endpoints. Callers must not hold mu.
+func (m *Manager) notify() {
+	m.mu.RLock()
+	fn := m.onChange
+	m.mu.RUnlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// Targets returns the endpoints a dynamic target currently resolves to, and
+// false if the target is not dynamic
+func (m *Manager) Targets(targetURL string) ([]Endpoint, bool) {
+	m.mu.RLock()
+	w, ok := m.watches[targetURL]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, IsDynamic(targetURL)
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.endpoints, true
+}
+
+// Stop stops all providers
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	watches := make([]*watch, 0, len(m.watches))
+	for url, w := range m.watches {
+		watches = append(watches, w)
+		delete(m.watches, url)
+	}
+	m.mu.Unlock()
+
+	stopAll(watches)
+}
+
+// stopAll stops the providers of watches and waits for their channels to
+// close
+func stopAll(watches []*watch) {
+	for _, w := range watches {
+		w.provider.Stop()
+		<-w.done
+	}
+}
+
+// endpointURLs returns the URLs of endpoints
+func endpointURLs(endpoints []Endpoint) []string {
+	urls := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		urls[i] = endpoint.URL
+	}
+	return urls
+}
+
+// sleepContext waits for d or until the context is cancelled, reporting
+// whether the full duration elapsed
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// Endpoint is an address a dynamic target resolves to
+type Endpoint struct {
+	URL    string
+	Weight int // 0 inherits the weight of the target
+}
+
+// Provider resolves a single dynamic target, such as a service in a
+// registry, to the endpoints currently backing it
+type Provider interface {
+	// Start begins resolving the target in the background
+	Start() error
+	// Stop stops resolving and closes the Targets channel
+	Stop()
+	// Targets delivers the complete set of endpoints whenever it changes
+	Targets() <-chan []Endpoint
+}
+
+// Factory creates a provider for a target URL. The discovery settings carry
+// the options of registered providers under Providers, keyed by scheme.
+type Factory func(targetURL string, settings config.DiscoveryConfig, logger *zap.Logger) (Provider, error)
+
+// Registration describes a provider for targets with a URL scheme
+type Registration struct {
+	// Factory creates the provider of a target
+	Factory Factory
+	// Validate checks a target URL during configuration validation and may
+	// be nil
+	Validate func(targetURL string) error
+}
+
+// providers holds the registered providers, by URL scheme
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Factory{
+		config.KubernetesScheme: newKubernetesProvider,
+		config.SRVScheme:        newSRVProvider,
+		config.DNSScheme:        newDNSProvider,
+		config.FileScheme:       newFileProvider,
+	}
+)
+
+// Register makes a provider available for targets with the given URL scheme,
+// e.g. "eureka" for eureka://my-service targets. It is meant to be called
+// from an init function of the package implementing the provider.
+func Register(scheme string, registration Registration) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, exists := providers[scheme]; exists {
+		panic(fmt.Sprintf("discovery provider for %s:// registered twice", scheme))
+	}
+	providers[scheme] = registration.Factory
+	config.RegisterDynamicTarget(scheme, registration.Validate)
+}
+
+// providerFor returns the factory for a target URL's scheme
+func providerFor(targetURL string) (Factory, bool) {
+	scheme, _, found := strings.Cut(targetURL, "://")
+	if !found {
+		return nil, false
+	}
+
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	factory, ok := providers[scheme]
+	return factory, ok
+}
+
+// IsDynamic reports whether a target URL is resolved by a provider
+func IsDynamic(targetURL string) bool {
+	_, ok := providerFor(targetURL)
+	return ok
+}
+
+// publish delivers endpoints on a provider's channel unless the context is
+// cancelled first
+func publish(ctx context.Context, ch chan<- []Endpoint, endpoints []Endpoint) bool {
+	select {
+	case ch <- endpoints:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// srvProvider periodically resolves the SRV records of a
+// srv://_service._proto.name target. Only the records with the lowest
+// priority value are used, as RFC 2782 reserves the others for when those
+// are gone.
+type srvProvider struct {
+	target   *config.SRVTarget
+	settings config.DNSDiscoveryConfig
+	client   *dnsClient
+	logger   *zap.Logger
+	targets  chan []Endpoint
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Owned by the run goroutine
+	endpoints []Endpoint
+	published bool
+}
+
+// newSRVProvider creates the provider of an SRV target
+func newSRVProvider(targetURL string, settings config.DiscoveryConfig, logger *zap.Logger) (Provider, error) {
+	target, err := config.ParseSRVTarget(targetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &srvProvider{
+		target:   target,
+		settings: settings.DNS,
+		client:   newDNSClient(settings.DNS.Resolver),
+		logger:   logger,
+		targets:  make(chan []Endpoint),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins resolving the records
+func (p *srvProvider) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx)
+	return nil
+}
+
+// Stop stops resolving and closes the Targets channel
+func (p *srvProvider) Stop() {
+	p.cancel()
+	<-p.done
+}
+
+// Targets delivers the hosts of the preferred records whenever they change
+func (p *srvProvider) Targets() <-chan []Endpoint {
+	return p.targets
+}
+
+// run resolves the records whenever their TTL expires, retrying sooner
+// after failures. The last resolved endpoints are kept while lookups fail.
+func (p *srvProvider) run(ctx context.Context) {
+	defer close(p.done)
+	defer close(p.targets)
+
+	for {
+		ttl, err := p.resolve(ctx)
+		wait := refreshInterval(ttl, p.settings.MinInterval, p.settings.Interval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("Failed to resolve SRV records", zap.Error(err))
+			wait = refreshInterval(retryInterval, 0, p.settings.Interval)
+		}
+		if !sleepContext(ctx, wait) {
+			return
+		}
+	}
+}
+
+// resolve looks up the SRV records and records their endpoints. It returns
+// how long the records may be cached.
+func (p *srvProvider) resolve(ctx context.Context) (time.Duration, error) {
+	answers, ttl, err := p.client.lookup(ctx, p.target.Name, dnsmessage.TypeSRV)
+	if err != nil {
+		return 0, err
+	}
+	if len(answers) == 0 {
+		return 0, fmt.Errorf("no SRV records for %s", p.target.Name)
+	}
+
+	var endpoints []Endpoint
+	priority := -1
+	for _, answer := range answers {
+		record := answer.Body.(*dnsmessage.SRVResource)
+		if priority == -1 || int(record.Priority) < priority {
+			priority = int(record.Priority)
+			endpoints = endpoints[:0]
+		}
+		if int(record.Priority) != priority {
+			continue
+		}
+		host := strings.TrimSuffix(record.Target.String(), ".")
+		endpoints = append(endpoints, Endpoint{
+			URL:    p.target.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].URL < endpoints[j].URL })
+
+	if p.published && slices.Equal(endpoints, p.endpoints) {
+		return ttl, nil
+	}
+	p.logger.Info("SRV endpoints changed", zap.Strings("endpoints", endpointURLs(endpoints)), zap.Int("priority", priority))
+	p.endpoints = endpoints
+	p.published = publish(ctx, p.targets, endpoints)
+	return ttl, nil
+}
@@ -0,0 +1,160 @@
+// Package docker is a minimal Docker Engine API client for listing
+// containers and following their events
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultSocket is the Docker daemon's default Unix socket
+const DefaultSocket = "/var/run/docker.sock"
+
+// Client talks to a Docker daemon over a Unix socket or TCP
+type Client struct {
+	endpoint string // for logging
+	base     string // URL prefix of requests
+	client   *http.Client
+}
+
+// NewClient creates a client for a daemon address: a Unix socket path, or a
+// host:port reached over plain HTTP. An empty address uses DefaultSocket.
+func NewClient(address string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &Client{client: &http.Client{Transport: transport}}
+
+	if address == "" || strings.HasPrefix(address, "/") {
+		socket := address
+		if socket == "" {
+			socket = DefaultSocket
+		}
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		c.endpoint = "unix://" + socket
+		c.base = "http://docker"
+		return c
+	}
+
+	c.endpoint = "tcp://" + address
+	c.base = "http://" + address
+	return c
+}
+
+// Endpoint returns the daemon address
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// Container is a container as listed by the daemon
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`  // e.g. running
+	Status string            `json:"Status"` // e.g. Up 5 minutes (healthy)
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// Name returns the container's name without the leading slash
+func (c *Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Event is a change of a container
+type Event struct {
+	Action string `json:"Action"` // e.g. start, die or health_status: healthy
+	Actor  struct {
+		ID string `json:"ID"`
+	} `json:"Actor"`
+}
+
+// ListContainers returns the running containers that have a label
+func (c *Client) ListContainers(ctx context.Context, label string) ([]Container, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}, "status": {"running"}})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.get(ctx, "/containers/json", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []Container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode containers: %w", err)
+	}
+	return containers, nil
+}
+
+// Events streams the events of containers that have a label, calling onEvent
+// for every event with one of the given actions, until the stream ends or
+// the context is cancelled
+func (c *Client) Events(ctx context.Context, label string, actions []string, onEvent func(Event)) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container"}, "label": {label}, "event": actions})
+	if err != nil {
+		return err
+	}
+	resp, err := c.get(ctx, "/events", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("event stream closed: %w", err)
+		}
+		onEvent(event)
+	}
+}
+
+// get performs a GET request and checks the status
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	reqURL := c.base + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Docker API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("Docker API returned status %d for %s: %s", resp.StatusCode, path, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
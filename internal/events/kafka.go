@@ -0,0 +1,114 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// kafkaContentType is the embedded format of the Kafka REST proxy v2 API
+// for JSON records
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaSink produces events to Kafka through a Kafka REST proxy, one request
+// per batch
+type KafkaSink struct {
+	config config.KafkaConfig
+	client *http.Client
+}
+
+// kafkaRecords is the body of a produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// kafkaRecord is a record of a produce request
+type kafkaRecord struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaResponse is the response of a produce request. Records can fail
+// individually while the request succeeds.
+type kafkaResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// NewKafkaSink creates a sink producing through the REST proxy of cfg
+func NewKafkaSink(cfg config.KafkaConfig) *KafkaSink {
+	return &KafkaSink{
+		config: cfg,
+		client: &http.Client{},
+	}
+}
+
+// Publish produces the events as JSON records to the topic
+func (s *KafkaSink) Publish(ctx context.Context, topic string, messages [][]byte) error {
+	records := kafkaRecords{Records: make([]kafkaRecord, len(messages))}
+	for i, message := range messages {
+		records.Records[i].Value = message
+	}
+	body, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+
+	endpoint := strings.TrimSuffix(s.config.RESTProxy, "/") + "/topics/" + url.PathEscape(topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read REST proxy response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("REST proxy returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var result kafkaResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("invalid REST proxy response: %w", err)
+	}
+	failed := 0
+	var firstErr string
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			if failed == 0 {
+				firstErr = offset.Error
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed: %s", failed, len(messages), firstErr)
+	}
+	return nil
+}
+
+// Close releases idle connections to the REST proxy
+func (s *KafkaSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
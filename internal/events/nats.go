@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/nats-io/nats.go"
+)
+
+// natsCloseTimeout bounds flushing pending messages on close
+const natsCloseTimeout = 5 * time.Second
+
+// NATSSink publishes events as NATS messages
+type NATSSink struct {
+	conn *nats.Conn
+}
+
+// NewNATSSink connects to NATS. An unreachable server does not fail the
+// connection: it is retried in the background, with events buffered by the
+// client in the meantime.
+func NewNATSSink(cfg config.NATSConfig) (*NATSSink, error) {
+	options := []nats.Option{
+		nats.Name("sentinel"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	}
+	if cfg.Username != "" {
+		options = append(options, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	if cfg.Token != "" {
+		options = append(options, nats.Token(cfg.Token))
+	}
+
+	conn, err := nats.Connect(cfg.URL, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return &NATSSink{conn: conn}, nil
+}
+
+// Publish publishes each event as a message on the topic subject
+func (s *NATSSink) Publish(ctx context.Context, topic string, messages [][]byte) error {
+	for _, message := range messages {
+		if err := s.conn.Publish(topic, message); err != nil {
+			return err
+		}
+	}
+	if !s.conn.IsConnected() {
+		// Held in the reconnect buffer until the connection is back
+		return nil
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+// Close flushes pending messages and closes the connection
+func (s *NATSSink) Close() error {
+	defer s.conn.Close()
+	if !s.conn.IsConnected() {
+		return nil
+	}
+	return s.conn.FlushTimeout(natsCloseTimeout)
+}
@@ -0,0 +1,163 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// dropReportInterval is how often dropped events are reported
+const dropReportInterval = 10 * time.Second
+
+// Event describes a proxied request and its response
+type Event struct {
+	Time            time.Time           `json:"time"`
+	RequestID       string              `json:"request_id,omitempty"`
+	Method          string              `json:"method"`
+	Host            string              `json:"host"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query,omitempty"`
+	Proto           string              `json:"proto"`
+	ClientIP        string              `json:"client_ip"`
+	UserAgent       string              `json:"user_agent,omitempty"`
+	Status          int                 `json:"status"`
+	DurationMS      float64             `json:"duration_ms"`
+	RequestSize     int64               `json:"request_size"`
+	ResponseSize    int64               `json:"response_size"`
+	RequestHeaders  map[string][]string `json:"request_headers,omitempty"`
+	ResponseHeaders map[string][]string `json:"response_headers,omitempty"`
+
+	// Bodies of sampled requests, cut to max_body_size
+	RequestBody           []byte `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool   `json:"request_body_truncated,omitempty"`
+	ResponseBody          []byte `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool   `json:"response_body_truncated,omitempty"`
+}
+
+// Sink delivers encoded events to a message queue
+type Sink interface {
+	// Publish delivers a batch of events to a topic
+	Publish(ctx context.Context, topic string, messages [][]byte) error
+	// Close releases the connection of the sink
+	Close() error
+}
+
+// Publisher buffers events and publishes them in batches in the background.
+// Publish never blocks: events that do not fit in the buffer are dropped.
+type Publisher struct {
+	sink    Sink
+	config  config.EventsMiddlewareConfig
+	logger  *zap.Logger
+	events  chan *Event
+	dropped atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewPublisher creates a publisher and starts publishing in the background
+func NewPublisher(sink Sink, cfg config.EventsMiddlewareConfig, logger *zap.Logger) *Publisher {
+	p := &Publisher{
+		sink:   sink,
+		config: cfg,
+		logger: logger,
+		events: make(chan *Event, cfg.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish queues an event, reporting false if the buffer is full
+func (p *Publisher) Publish(event *Event) bool {
+	select {
+	case p.events <- event:
+		return true
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Close publishes the buffered events and closes the sink. Events published
+// after Close panic, so it is only called on shutdown.
+func (p *Publisher) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() { close(p.events) })
+
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish buffered events: %w", ctx.Err())
+	}
+	return p.sink.Close()
+}
+
+// run publishes events once a batch is full or the flush interval passed
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+	report := time.NewTicker(dropReportInterval)
+	defer report.Stop()
+
+	batch := make([][]byte, 0, p.config.BatchSize)
+	for {
+		select {
+		case event, ok := <-p.events:
+			if !ok {
+				p.flush(batch)
+				p.reportDropped()
+				return
+			}
+			message, err := json.Marshal(event)
+			if err != nil {
+				p.logger.Error("Failed to encode request event", zap.Error(err))
+				continue
+			}
+			batch = append(batch, message)
+			if len(batch) >= p.config.BatchSize {
+				batch = p.flush(batch)
+			}
+		case <-ticker.C:
+			batch = p.flush(batch)
+		case <-report.C:
+			p.reportDropped()
+		}
+	}
+}
+
+// flush publishes a batch and returns it emptied. Failed batches are dropped
+// so a sink outage cannot hold up newer events.
+func (p *Publisher) flush(batch [][]byte) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.PublishTimeout)
+	defer cancel()
+	if err := p.sink.Publish(ctx, p.config.Topic, batch); err != nil {
+		p.logger.Error("Failed to publish request events",
+			zap.String("sink", p.config.Sink),
+			zap.String("topic", p.config.Topic),
+			zap.Int("events", len(batch)),
+			zap.Error(err))
+	}
+	return batch[:0]
+}
+
+// reportDropped logs how many events were dropped since the last report
+func (p *Publisher) reportDropped() {
+	if dropped := p.dropped.Swap(0); dropped > 0 {
+		p.logger.Warn("Dropped request events, buffer full",
+			zap.String("topic", p.config.Topic),
+			zap.Int64("dropped", dropped),
+			zap.Int("buffer_size", p.config.BufferSize))
+	}
+}
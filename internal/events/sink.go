@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	sharedMu         sync.Mutex
+	sharedPublishers = make(map[string]*Publisher)
+)
+
+// Shared returns the publisher for the events configuration, creating it on
+// first use. Publishers are shared by every events middleware with the same
+// settings, so configuration reloads keep their connection and buffered
+// events.
+func Shared(cfg config.EventsMiddlewareConfig, logger *zap.Logger) (*Publisher, error) {
+	settings := fmt.Sprintf("%s %v %v %s %d %d %v %v", cfg.Sink, cfg.NATS, cfg.Kafka, cfg.Topic,
+		cfg.BufferSize, cfg.BatchSize, cfg.FlushInterval, cfg.PublishTimeout)
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	if publisher, ok := sharedPublishers[settings]; ok {
+		return publisher, nil
+	}
+	sink, err := NewSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+	publisher := NewPublisher(sink, cfg, logger)
+	sharedPublishers[settings] = publisher
+	return publisher, nil
+}
+
+// NewSink creates the sink selected by the events configuration
+func NewSink(cfg config.EventsMiddlewareConfig) (Sink, error) {
+	switch cfg.Sink {
+	case "nats":
+		return NewNATSSink(cfg.NATS)
+	case "kafka":
+		return NewKafkaSink(cfg.Kafka), nil
+	default:
+		return nil, fmt.Errorf("unknown events sink: %s", cfg.Sink)
+	}
+}
+
+// Close publishes the events buffered by every publisher and closes their
+// sinks. It is called on shutdown.
+func Close(ctx context.Context) error {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	var errs []error
+	for settings, publisher := range sharedPublishers {
+		if err := publisher.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		delete(sharedPublishers, settings)
+	}
+	return errors.Join(errs...)
+}
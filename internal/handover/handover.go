@@ -0,0 +1,280 @@
+package handover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables through which a process passes its listening
+// sockets to its successor, and learns when the successor is ready. They stay
+// clear of the SENTINEL_ prefix of configuration overrides.
+const (
+	listenersEnv = "HANDOVER_LISTENERS" // JSON object of listener keys to file descriptors
+	readyEnv     = "HANDOVER_READY_FD"  // file descriptor to report readiness on
+)
+
+var (
+	mu        sync.Mutex
+	loadOnce  sync.Once
+	inherited map[string]*os.File // sockets passed by the previous process, by key
+	listeners = make(map[string]*listener)
+	upgrading bool
+)
+
+// listener is a socket passed on to the next process until it is closed
+type listener struct {
+	net.Listener
+	key  string
+	once sync.Once
+}
+
+// Close stops passing the socket on and closes it
+func (l *listener) Close() error {
+	l.once.Do(func() {
+		mu.Lock()
+		if listeners[l.key] == l {
+			delete(listeners, l.key)
+		}
+		mu.Unlock()
+	})
+	return l.Listener.Close()
+}
+
+// key identifies a socket across processes
+func key(network, address string) string {
+	return network + " " + address
+}
+
+// load reads the sockets passed by the previous process, once
+func load() {
+	loadOnce.Do(func() {
+		inherited = make(map[string]*os.File)
+		value := os.Getenv(listenersEnv)
+		if value == "" {
+			return
+		}
+		os.Unsetenv(listenersEnv)
+
+		var fds map[string]int
+		if err := json.Unmarshal([]byte(value), &fds); err != nil {
+			return
+		}
+		for key, fd := range fds {
+			inherited[key] = os.NewFile(uintptr(fd), key)
+		}
+	})
+}
+
+// Inherit returns the socket the previous process passed for network and
+// address, if any
+func Inherit(network, address string) (net.Listener, bool, error) {
+	load()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	k := key(network, address)
+	file, ok := inherited[k]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(inherited, k)
+	defer file.Close()
+
+	ln, err := net.FileListener(file)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to inherit %s socket %s: %w", network, address, err)
+	}
+	l := &listener{Listener: ln, key: k}
+	listeners[k] = l
+	return l, true, nil
+}
+
+// Listen returns the socket the previous process passed for network and
+// address, or binds a new one. The socket is passed on to the next process
+// on upgrade until it is closed.
+func Listen(network, address string) (net.Listener, error) {
+	if ln, ok, err := Inherit(network, address); ok {
+		return ln, err
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	k := key(network, address)
+	l := &listener{Listener: ln, key: k}
+
+	mu.Lock()
+	listeners[k] = l
+	mu.Unlock()
+	return l, nil
+}
+
+// Ready reports to the previous process that this one serves, so it can
+// shut down, and closes the sockets it passed that are no longer used
+func Ready() error {
+	load()
+
+	mu.Lock()
+	for k, file := range inherited {
+		file.Close()
+		delete(inherited, k)
+	}
+	mu.Unlock()
+
+	value := os.Getenv(readyEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(readyEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", readyEnv, err)
+	}
+	pipe := os.NewFile(uintptr(fd), "ready")
+	defer pipe.Close()
+	if _, err := pipe.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to report readiness: %w", err)
+	}
+	return nil
+}
+
+// Upgrade starts a new process from the current executable and arguments,
+// passing it the open sockets, and waits until it reports being ready. The
+// caller then shuts down gracefully, leaving the sockets to the new process;
+// until then both accept connections. A new process that exits or is not
+// ready within timeout is killed, and the caller keeps serving.
+func Upgrade(timeout time.Duration) (*os.Process, error) {
+	mu.Lock()
+	if upgrading {
+		mu.Unlock()
+		return nil, errors.New("an upgrade is already in progress")
+	}
+	upgrading = true
+	keys := make([]string, 0, len(listeners))
+	for k := range listeners {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	passed := make([]*listener, 0, len(keys))
+	for _, k := range keys {
+		passed = append(passed, listeners[k])
+	}
+	mu.Unlock()
+
+	defer func() {
+		mu.Lock()
+		upgrading = false
+		mu.Unlock()
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	// Duplicate the sockets for the new process, which finds them from file
+	// descriptor 3 on, followed by the readiness pipe
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	fds := make(map[string]int, len(passed))
+	for _, l := range passed {
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("socket %s cannot be passed on", l.key)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return nil, fmt.Errorf("failed to pass socket %s: %w", l.key, err)
+		}
+		fds[l.key] = 3 + len(files)
+		files = append(files, file)
+	}
+	encoded, err := json.Marshal(fds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sockets: %w", err)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer ready.Close()
+	readyFD := 3 + len(files)
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environ(),
+		listenersEnv+"="+string(encoded),
+		readyEnv+"="+strconv.Itoa(readyFD))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	// Only the new process holds the write end now, so the read fails if it
+	// exits without reporting readiness
+	readyWriter.Close()
+	files = files[:len(files)-1]
+
+	result := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := ready.Read(buf); err != nil {
+			result <- fmt.Errorf("new process exited before it was ready: %w", err)
+			return
+		}
+		result <- nil
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-result:
+	case <-timer.C:
+		err = fmt.Errorf("new process was not ready within %v", timeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+		return nil, err
+	}
+	go cmd.Wait()
+
+	// Unix sockets must outlive this process's listeners
+	for _, l := range passed {
+		if unix, ok := l.Listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	return cmd.Process, nil
+}
+
+// environ returns the environment without the variables of a previous
+// handover
+func environ() []string {
+	var env []string
+	for _, entry := range os.Environ() {
+		if strings.HasPrefix(entry, listenersEnv+"=") || strings.HasPrefix(entry, readyEnv+"=") {
+			continue
+		}
+		env = append(env, entry)
+	}
+	return env
+}
@@ -2,12 +2,12 @@ package health
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/metrics"
 	"go.uber.org/zap"
 )
 
@@ -18,18 +18,28 @@ type checker struct {
 	client *http.Client
 	
 	// State management
-	targets map[string]*TargetHealth
-	mu      sync.RWMutex
+	targets  map[string]*TargetHealth
+	checks   map[string]config.HealthCheckConfig // health check of each target
+	checking map[string]bool                     // targets with a check in flight
+	wanted   map[string]config.HealthCheckConfig // targets last set, monitored while enabled
+	onChange func(url string)
+	mu       sync.RWMutex
 	
-	// Control channels
-	stopCh chan struct{}
-	done   chan struct{}
+	// Control channels of the checking loop
+	runMu   sync.Mutex
+	running bool
+	stopCh  chan struct{}
+	done    chan struct{}
 }
 
+// schedulingInterval is how often targets are checked for being due, which
+// bounds how precisely their intervals are honored
+const schedulingInterval = time.Second
+
 // NewChecker creates a new health checker instance
 func NewChecker(cfg config.HealthConfig, logger *zap.Logger) Checker {
+	// Checks are bounded by the timeout of their target
 	client := &http.Client{
-		Timeout: cfg.Timeout,
 		Transport: &http.Transport{
 			DisableKeepAlives:   true,
 			MaxIdleConns:        1,
@@ -42,85 +52,169 @@ func NewChecker(cfg config.HealthConfig, logger *zap.Logger) Checker {
 		cfg:     cfg,
 		logger:  logger,
 		client:  client,
-		targets: make(map[string]*TargetHealth),
-		stopCh:  make(chan struct{}),
-		done:    make(chan struct{}),
+		targets:  make(map[string]*TargetHealth),
+		checks:   make(map[string]config.HealthCheckConfig),
+		checking: make(map[string]bool),
 	}
 }
 
 // Start starts the health checker
 func (c *checker) Start() {
-	if !c.cfg.Enabled {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	cfg := c.config()
+	if !cfg.Enabled {
 		c.logger.Info("Health checker disabled")
-		close(c.done)
 		return
 	}
 
 	c.logger.Info("Starting health checker", 
-		zap.Duration("interval", c.cfg.Interval),
-		zap.Duration("timeout", c.cfg.Timeout))
+		zap.Duration("interval", cfg.Interval),
+		zap.Duration("timeout", cfg.Timeout))
 
-	go c.run()
+	c.startLoop()
 }
 
 // Stop stops the health checker
 func (c *checker) Stop() {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
 	c.logger.Info("Stopping health checker")
+	c.stopLoop()
+}
+
+// UpdateConfig applies new health checker settings. Disabling the checker
+// stops monitoring, so every target takes traffic; enabling it monitors the
+// targets last set.
+func (c *checker) UpdateConfig(cfg config.HealthConfig) {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	c.mu.Lock()
+	previous := c.cfg
+	c.cfg = cfg
+	wanted := c.wanted
+	c.mu.Unlock()
+
+	if cfg == previous {
+		return
+	}
+
+	if !cfg.Enabled {
+		if previous.Enabled {
+			c.logger.Info("Health checker disabled")
+			c.stopLoop()
+			c.setTargets(nil)
+		}
+		return
+	}
+
+	// Re-register targets, whose checks may fall back to the new interval
+	// and timeout
+	c.logger.Info("Health checker settings changed",
+		zap.Duration("interval", cfg.Interval),
+		zap.Duration("timeout", cfg.Timeout))
+	c.setTargets(wanted)
+	if !c.running {
+		c.startLoop()
+	}
+}
+
+// config returns the current health checker settings
+func (c *checker) config() config.HealthConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg
+}
+
+// startLoop starts the checking loop. Callers hold runMu.
+func (c *checker) startLoop() {
+	c.stopCh = make(chan struct{})
+	c.done = make(chan struct{})
+	c.running = true
+	go c.run(c.stopCh, c.done)
+}
+
+// stopLoop stops the checking loop and waits for checks in flight. Callers
+// hold runMu.
+func (c *checker) stopLoop() {
+	if !c.running {
+		return
+	}
 	close(c.stopCh)
 	<-c.done
+	c.running = false
 }
 
 // run is the main health checking loop
-func (c *checker) run() {
-	defer close(c.done)
-	
-	ticker := time.NewTicker(c.cfg.Interval)
+func (c *checker) run(stopCh <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	// Cancel checks in flight on stop, and wait for them
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	ticker := time.NewTicker(schedulingInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-c.stopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
-			c.performHealthChecks()
+			c.performHealthChecks(ctx, &wg)
 		}
 	}
 }
 
-// performHealthChecks performs health checks on all registered targets
-func (c *checker) performHealthChecks() {
-	c.mu.RLock()
-	targets := make(map[string]*TargetHealth, len(c.targets))
+// performHealthChecks checks the registered targets whose interval has
+// passed since their last check. A slow target never delays the others.
+func (c *checker) performHealthChecks(ctx context.Context, wg *sync.WaitGroup) {
+	now := time.Now()
+	due := make(map[string]config.HealthCheckConfig)
+
+	c.mu.Lock()
 	for url, health := range c.targets {
-		targets[url] = health
+		check := c.checks[url]
+		if c.checking[url] || now.Sub(health.LastCheck) < check.Interval {
+			continue
+		}
+		c.checking[url] = true
+		due[url] = check
 	}
-	c.mu.RUnlock()
+	c.mu.Unlock()
 
-	var wg sync.WaitGroup
-	for url := range targets {
+	for url, check := range due {
 		wg.Add(1)
-		go func(targetURL string) {
+		go func(targetURL string, check config.HealthCheckConfig) {
 			defer wg.Done()
-			
-			// Create a default health check config if not available
-			healthConfig := config.HealthCheckConfig{
-				Enabled:          true,
-				Path:             "/health",
-				Interval:         c.cfg.Interval,
-				Timeout:          c.cfg.Timeout,
-				FailureThreshold: 3,
-				SuccessThreshold: 2,
-			}
-			
-			health := c.CheckTarget(context.Background(), targetURL, healthConfig)
-			
+
+			checkCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+			defer cancel()
+			health := c.CheckTarget(checkCtx, targetURL, check)
+
 			c.mu.Lock()
+			delete(c.checking, targetURL)
+			// A target unregistered during its check stays unregistered
+			existing, ok := c.targets[targetURL]
+			if !ok {
+				c.mu.Unlock()
+				metrics.ForgetTarget(targetURL)
+				return
+			}
 			c.targets[targetURL] = health
+			changed := (existing.Status == StatusUnhealthy) != (health.Status == StatusUnhealthy)
 			c.mu.Unlock()
-		}(url)
+
+			if changed {
+				c.notify(targetURL)
+			}
+		}(url, check)
 	}
-	
-	wg.Wait()
 }
 
 // CheckTarget performs a health check on a target
@@ -148,35 +242,9 @@ func (c *checker) CheckTarget(ctx context.Context, url string, config config.Hea
 		}
 	}
 
-	// Construct health check URL
-	healthURL := url
-	if config.Path != "" {
-		healthURL = fmt.Sprintf("%s%s", url, config.Path)
-	}
-
-	// Create request with timeout
-	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
-	if err != nil {
-		return c.updateTargetHealth(existing, false, time.Since(start), fmt.Errorf("failed to create request: %w", err), config)
-	}
-
 	// Perform health check
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return c.updateTargetHealth(existing, false, time.Since(start), fmt.Errorf("health check failed: %w", err), config)
-	}
-	defer resp.Body.Close()
-
-	responseTime := time.Since(start)
-	
-	// Check response status
-	isHealthy := resp.StatusCode >= 200 && resp.StatusCode < 300
-	var healthErr error
-	if !isHealthy {
-		healthErr = fmt.Errorf("unhealthy status code: %d", resp.StatusCode)
-	}
-
-	return c.updateTargetHealth(existing, isHealthy, responseTime, healthErr, config)
+	err := Probe(ctx, c.client, url, config)
+	return c.updateTargetHealth(existing, err == nil, time.Since(start), err, config)
 }
 
 // updateTargetHealth updates the health state of a target
@@ -210,6 +278,9 @@ func (c *checker) updateTargetHealth(existing *TargetHealth, isHealthy bool, res
 		}
 	}
 
+	metrics.ObserveHealthCheck(health.URL, isHealthy, responseTime)
+	metrics.SetTargetHealth(health.URL, health.Status.metricValue())
+
 	// Log status changes
 	if health.Status != existing.Status {
 		if health.Status == StatusHealthy {
@@ -234,10 +305,11 @@ func (c *checker) IsHealthy(url string) bool {
 	
 	health, exists := c.targets[url]
 	if !exists {
-		return true // Default to healthy for unknown targets
+		return true // Default to healthy for unmonitored targets
 	}
 	
-	return health.Status == StatusHealthy
+	// Targets take traffic until checks show them unhealthy
+	return health.Status != StatusUnhealthy
 }
 
 // GetHealth returns the health status of a target
@@ -286,16 +358,59 @@ func (c *checker) GetAllHealth() map[string]*TargetHealth {
 	return result
 }
 
-// registerTarget registers a target for health monitoring
-func (c *checker) registerTarget(url string) {
+// SetTargets monitors the given targets, each with the health check of its
+// upstream service, and stops monitoring the others. Targets that remain
+// keep their health.
+func (c *checker) SetTargets(targets map[string]config.HealthCheckConfig) {
+	c.mu.Lock()
+	c.wanted = targets
+	enabled := c.cfg.Enabled
+	c.mu.Unlock()
+
+	if enabled {
+		c.setTargets(targets)
+	}
+}
+
+// setTargets registers the given targets and unregisters the others
+func (c *checker) setTargets(targets map[string]config.HealthCheckConfig) {
+	c.mu.RLock()
+	var stale []string
+	for url := range c.targets {
+		if _, ok := targets[url]; !ok {
+			stale = append(stale, url)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, url := range stale {
+		c.unregisterTarget(url)
+	}
+	for url, check := range targets {
+		c.registerTarget(url, check)
+	}
+}
+
+// registerTarget registers a target for health monitoring, or updates the
+// health check of a registered one. The global interval and timeout apply
+// when the check sets none.
+func (c *checker) registerTarget(url string, check config.HealthCheckConfig) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
+	if check.Interval <= 0 {
+		check.Interval = c.cfg.Interval
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = c.cfg.Timeout
+	}
+	c.checks[url] = check
 	if _, exists := c.targets[url]; !exists {
 		c.targets[url] = &TargetHealth{
 			URL:    url,
 			Status: StatusUnknown,
 		}
+		metrics.SetTargetHealth(url, StatusUnknown.metricValue())
 		c.logger.Debug("Registered target for health monitoring", zap.String("url", url))
 	}
 }
@@ -303,8 +418,35 @@ func (c *checker) registerTarget(url string) {
 // unregisterTarget unregisters a target from health monitoring
 func (c *checker) unregisterTarget(url string) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	
+	health := c.targets[url]
 	delete(c.targets, url)
+	delete(c.checks, url)
+	c.mu.Unlock()
+
+	metrics.ForgetTarget(url)
 	c.logger.Debug("Unregistered target from health monitoring", zap.String("url", url))
-}
\ No newline at end of file
+
+	// Unmonitored targets are healthy
+	if health != nil && health.Status == StatusUnhealthy {
+		c.notify(url)
+	}
+}
+
+// OnChange registers a function called with the URL of a target whose
+// health changed
+func (c *checker) OnChange(fn func(url string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = fn
+}
+
+// notify reports a health change. Callers must not hold mu.
+func (c *checker) notify(url string) {
+	c.mu.RLock()
+	fn := c.onChange
+	c.mu.RUnlock()
+
+	if fn != nil {
+		fn(url)
+	}
+}
@@ -27,6 +27,18 @@ func (s Status) String() string {
 	}
 }
 
+// metricValue is the value of the target health gauge for a status
+func (s Status) metricValue() float64 {
+	switch s {
+	case StatusHealthy:
+		return 1
+	case StatusUnhealthy:
+		return 0
+	default:
+		return -1
+	}
+}
+
 // TargetHealth represents the health state of a target
 type TargetHealth struct {
 	URL                  string
@@ -52,4 +64,12 @@ type Checker interface {
 	GetHealth(url string) *TargetHealth
 	// GetAllHealth returns the health status of all targets
 	GetAllHealth() map[string]*TargetHealth
+	// SetTargets replaces the monitored targets, each checked with its own
+	// health check settings
+	SetTargets(targets map[string]config.HealthCheckConfig)
+	// UpdateConfig applies new health checker settings
+	UpdateConfig(cfg config.HealthConfig)
+	// OnChange registers a function called with the URL of a target whenever
+	// IsHealthy changes for it
+	OnChange(fn func(url string))
 }
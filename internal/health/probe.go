@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// maxBodySize bounds the response body searched for the expected body
+const maxBodySize = 64 << 10
+
+// Probe checks a target once with a health check, returning why the target
+// failed it. The context bounds the check.
+func Probe(ctx context.Context, client *http.Client, targetURL string, check config.HealthCheckConfig) error {
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("invalid target URL: %w", err)
+	}
+
+	if check.Type == config.HealthCheckTCP {
+		return probeTCP(ctx, target)
+	}
+	if check.Type == config.HealthCheckHTTPS {
+		target.Scheme = "https"
+	}
+	return probeHTTP(ctx, client, strings.TrimRight(target.String(), "/")+check.Path, check)
+}
+
+// probeTCP checks that a target accepts connections
+func probeTCP(ctx context.Context, target *url.URL) error {
+	address := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(target.Hostname(), port)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return conn.Close()
+}
+
+// probeHTTP checks that a health endpoint answers with an expected status,
+// and with the expected body if any
+func probeHTTP(ctx context.Context, client *http.Client, healthURL string, check config.HealthCheckConfig) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range check.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if len(check.ExpectedStatuses) > 0 {
+		if !slices.Contains(check.ExpectedStatuses, resp.StatusCode) {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unhealthy status code: %d", resp.StatusCode)
+	}
+
+	if check.ExpectedBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+		if !strings.Contains(string(body), check.ExpectedBody) {
+			return fmt.Errorf("response body does not contain %q", check.ExpectedBody)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// In-cluster service account files
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// ErrResourceExpired is returned by watches whose resource version is too old
+// to resume from; the collection must be listed again
+var ErrResourceExpired = errors.New("resource version expired")
+
+// Options configures the API server connection. Without a server the
+// in-cluster service account is used.
+type Options struct {
+	Server    string // API server URL, e.g. http://127.0.0.1:8001 for kubectl proxy
+	Token     string // bearer token
+	TokenFile string // file holding the bearer token, re-read on every request
+	CAFile    string // CA bundle for the API server certificate
+}
+
+// Client is a minimal Kubernetes API client for listing and watching
+// resources
+type Client struct {
+	endpoint  string
+	token     string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewClient creates an API client
+func NewClient(opts Options) (*Client, error) {
+	c := &Client{endpoint: strings.TrimRight(opts.Server, "/"), token: opts.Token, tokenFile: opts.TokenFile}
+
+	caFile := opts.CAFile
+	if c.endpoint == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("no Kubernetes API server given and not running in a cluster")
+		}
+		c.endpoint = "https://" + net.JoinHostPort(host, port)
+		if c.token == "" && c.tokenFile == "" {
+			c.tokenFile = serviceAccountTokenFile
+		}
+		if caFile == "" {
+			caFile = serviceAccountCAFile
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kubernetes CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	c.client = &http.Client{Transport: transport}
+
+	return c, nil
+}
+
+// Endpoint returns the API server URL
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// Metadata holds the object metadata used by Sentinel
+type Metadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// list is the envelope of a list response
+type list struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items json.RawMessage `json:"items"`
+}
+
+// Event is a single change of a watched collection
+type Event struct {
+	Type   string          `json:"type"` // ADDED, MODIFIED or DELETED
+	Object json.RawMessage `json:"object"`
+}
+
+// watchStatus holds the fields of watch events that carry errors or
+// bookmarks
+type watchStatus struct {
+	Code     int      `json:"code"`
+	Message  string   `json:"message"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// List decodes the items of a collection into items and returns the
+// collection's resource version. The query may select items, e.g. by label.
+func (c *Client) List(ctx context.Context, path string, query url.Values, items any) (string, error) {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var l list
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if err := json.Unmarshal(l.Items, items); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return l.Metadata.ResourceVersion, nil
+}
+
+// Get decodes a single resource
+func (c *Client) Get(ctx context.Context, path string, v any) error {
+	resp, err := c.get(ctx, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// Watch streams changes to a collection starting after resourceVersion,
+// calling onEvent for every change, until the stream ends or the context is
+// cancelled. It returns the last resource version seen.
+func (c *Client) Watch(ctx context.Context, path string, query url.Values, resourceVersion string, onEvent func(Event)) (string, error) {
+	params := url.Values{}
+	for key, values := range query {
+		params[key] = values
+	}
+	params.Set("watch", "true")
+	params.Set("allowWatchBookmarks", "true")
+	params.Set("resourceVersion", resourceVersion)
+
+	resp, err := c.get(ctx, path, params)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return resourceVersion, nil
+			}
+			return resourceVersion, fmt.Errorf("watch of %s closed: %w", path, err)
+		}
+
+		var status watchStatus
+		if err := json.Unmarshal(event.Object, &status); err != nil {
+			return resourceVersion, fmt.Errorf("failed to decode watch event of %s: %w", path, err)
+		}
+		switch event.Type {
+		case "ERROR":
+			if status.Code == http.StatusGone {
+				return resourceVersion, ErrResourceExpired
+			}
+			return resourceVersion, fmt.Errorf("watch of %s failed: %s", path, status.Message)
+		case "BOOKMARK":
+			resourceVersion = status.Metadata.ResourceVersion
+		default:
+			resourceVersion = status.Metadata.ResourceVersion
+			onEvent(event)
+		}
+	}
+}
+
+// get performs an authenticated GET request and checks the status
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	reqURL := c.endpoint + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := c.token
+	if c.tokenFile != "" {
+		data, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Kubernetes API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			return nil, ErrResourceExpired
+		}
+		return nil, fmt.Errorf("Kubernetes API returned status %d for %s: %s", resp.StatusCode, path, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// CollectionPath returns the API path of a collection, optionally restricted
+// to a namespace
+func CollectionPath(groupVersion, resource, namespace string) string {
+	prefix := "/apis/" + groupVersion
+	if groupVersion == "v1" {
+		prefix = "/api/v1"
+	}
+	if namespace != "" {
+		return fmt.Sprintf("%s/namespaces/%s/%s", prefix, url.PathEscape(namespace), resource)
+	}
+	return prefix + "/" + resource
+}
+
+// ObjectPath returns the API path of a namespaced object
+func ObjectPath(groupVersion, resource, namespace, name string) string {
+	return CollectionPath(groupVersion, resource, namespace) + "/" + url.PathEscape(name)
+}
@@ -3,14 +3,57 @@ package loadbalancer
 import (
 	"net/http"
 	"net/url"
+	"sync/atomic"
+	"time"
 )
 
-// Target represents an upstream target
+// Target represents an upstream target. Targets are long-lived: the same
+// Target is passed to the load balancer for every request while it stays in
+// its upstream, so its connection count adds up across requests, and health
+// checks update it in place. A zero Target is healthy.
 type Target struct {
-	URL         *url.URL
-	Weight      int
-	IsHealthy   bool
-	Connections int
+	URL      *url.URL
+	Weight   int
+	Protocol string
+
+	unhealthy    atomic.Bool
+	connections  atomic.Int64
+	warmingSince atomic.Int64 // unix nanoseconds, zero unless warming up
+}
+
+// IsHealthy returns whether the target may receive requests
+func (t *Target) IsHealthy() bool {
+	return !t.unhealthy.Load()
+}
+
+// SetHealthy records the health of the target
+func (t *Target) SetHealthy(healthy bool) {
+	t.unhealthy.Store(!healthy)
+}
+
+// StartWarmup records that the target starts warming up
+func (t *Target) StartWarmup(now time.Time) {
+	t.warmingSince.Store(now.UnixNano())
+}
+
+// WarmingSince returns when the target started warming up, or the zero time
+// if it never did
+func (t *Target) WarmingSince() time.Time {
+	since := t.warmingSince.Load()
+	if since == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, since)
+}
+
+// Connections returns the number of requests in flight to the target
+func (t *Target) Connections() int {
+	return int(t.connections.Load())
+}
+
+// addConnections adjusts the number of requests in flight to the target
+func (t *Target) addConnections(delta int) {
+	t.connections.Add(int64(delta))
 }
 
 // LoadBalancer defines the interface for load balancing strategies
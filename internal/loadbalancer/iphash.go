@@ -3,9 +3,9 @@ package loadbalancer
 import (
 	"errors"
 	"hash/fnv"
-	"net"
 	"net/http"
-	"strings"
+
+	"github.com/bpradana/sentinel/internal/clientip"
 )
 
 // IPHash implements IP hash load balancing
@@ -25,7 +25,7 @@ func (ih *IPHash) SelectTarget(targets []*Target, req *http.Request) (*Target, e
 	// Filter healthy targets
 	healthyTargets := make([]*Target, 0, len(targets))
 	for _, target := range targets {
-		if target.IsHealthy {
+		if target.IsHealthy() {
 			healthyTargets = append(healthyTargets, target)
 		}
 	}
@@ -35,7 +35,7 @@ func (ih *IPHash) SelectTarget(targets []*Target, req *http.Request) (*Target, e
 	}
 
 	// Get client IP
-	clientIP := ih.getClientIP(req)
+	clientIP := clientip.FromRequest(req)
 
 	// Hash the IP
 	hash := ih.hashIP(clientIP)
@@ -55,30 +55,6 @@ func (ih *IPHash) Name() string {
 	return "ip_hash"
 }
 
-// getClientIP extracts the client IP from the request
-func (ih *IPHash) getClientIP(req *http.Request) string {
-	// Check X-Real-IP header first
-	if ip := req.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-
-	// Check X-Forwarded-For header
-	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
-		// Take the first IP from the list
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// Fall back to RemoteAddr
-	host, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		return req.RemoteAddr
-	}
-	return host
-}
-
 // hashIP creates a hash of the IP address
 func (ih *IPHash) hashIP(ip string) uint32 {
 	h := fnv.New32a()
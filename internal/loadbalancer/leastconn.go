@@ -3,13 +3,12 @@ package loadbalancer
 import (
 	"errors"
 	"net/http"
-	"sync"
 )
 
-// LeastConnections implements least connections load balancing
-type LeastConnections struct {
-	mu sync.Mutex
-}
+// LeastConnections implements least connections load balancing. The
+// connection counts live on the targets, so they are shared by the load
+// balancers of every configuration loaded.
+type LeastConnections struct{}
 
 // NewLeastConnections creates a new least connections load balancer
 func NewLeastConnections() *LeastConnections {
@@ -18,9 +17,6 @@ func NewLeastConnections() *LeastConnections {
 
 // SelectTarget selects the target with the least connections
 func (lc *LeastConnections) SelectTarget(targets []*Target, req *http.Request) (*Target, error) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-
 	if len(targets) == 0 {
 		return nil, errors.New("no targets available")
 	}
@@ -28,7 +24,7 @@ func (lc *LeastConnections) SelectTarget(targets []*Target, req *http.Request) (
 	// Filter healthy targets
 	healthyTargets := make([]*Target, 0, len(targets))
 	for _, target := range targets {
-		if target.IsHealthy {
+		if target.IsHealthy() {
 			healthyTargets = append(healthyTargets, target)
 		}
 	}
@@ -42,8 +38,8 @@ func (lc *LeastConnections) SelectTarget(targets []*Target, req *http.Request) (
 	minConnections := -1
 
 	for _, target := range healthyTargets {
-		if minConnections == -1 || target.Connections < minConnections {
-			minConnections = target.Connections
+		if connections := target.Connections(); minConnections == -1 || connections < minConnections {
+			minConnections = connections
 			selected = target
 		}
 	}
@@ -53,13 +49,7 @@ func (lc *LeastConnections) SelectTarget(targets []*Target, req *http.Request) (
 
 // UpdateTarget updates the connection count for a target
 func (lc *LeastConnections) UpdateTarget(target *Target, delta int) {
-	lc.mu.Lock()
-	defer lc.mu.Unlock()
-
-	target.Connections += delta
-	if target.Connections < 0 {
-		target.Connections = 0
-	}
+	target.addConnections(delta)
 }
 
 // Name returns the name of the strategy
@@ -6,7 +6,7 @@ import (
 	"sync"
 )
 
-// RoundRobin implements round-robin load balancing
+// RoundRobin implements weighted round-robin load balancing
 type RoundRobin struct {
 	mu      sync.Mutex
 	current int
@@ -29,7 +29,7 @@ func (rr *RoundRobin) SelectTarget(targets []*Target, req *http.Request) (*Targe
 	// Filter healthy targets
 	healthyTargets := make([]*Target, 0, len(targets))
 	for _, target := range targets {
-		if target.IsHealthy {
+		if target.IsHealthy() {
 			healthyTargets = append(healthyTargets, target)
 		}
 	}
@@ -38,11 +38,30 @@ func (rr *RoundRobin) SelectTarget(targets []*Target, req *http.Request) (*Targe
 		return nil, errors.New("no healthy targets available")
 	}
 
-	// Select target using round-robin
-	target := healthyTargets[rr.current%len(healthyTargets)]
+	// Select target using weighted round-robin; targets without a weight
+	// count once
+	total := 0
+	for _, target := range healthyTargets {
+		total += targetWeight(target)
+	}
+	n := rr.current % total
 	rr.current++
 
-	return target, nil
+	for _, target := range healthyTargets {
+		if n < targetWeight(target) {
+			return target, nil
+		}
+		n -= targetWeight(target)
+	}
+	return healthyTargets[len(healthyTargets)-1], nil
+}
+
+// targetWeight returns the share of requests a target receives
+func targetWeight(target *Target) int {
+	if target.Weight <= 0 {
+		return 1
+	}
+	return target.Weight
 }
 
 // UpdateTarget updates target state (no-op for round-robin)
@@ -0,0 +1,277 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/tls"
+	"github.com/bpradana/sentinel/internal/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// registry holds the metrics of the running proxy
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_requests_total",
+		Help: "Requests handled, by route, upstream, method and status code",
+	}, []string{"route", "upstream", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sentinel_request_duration_seconds",
+		Help:    "Time from receiving a request to finishing its response",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "upstream"})
+
+	requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sentinel_request_size_bytes",
+		Help:    "Size of request bodies",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}, []string{"route", "upstream"})
+
+	responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sentinel_response_size_bytes",
+		Help:    "Size of response bodies",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}, []string{"route", "upstream"})
+
+	activeConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_active_connections",
+		Help: "Open client connections, by listener",
+	}, []string{"listener"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_upstream_retries_total",
+		Help: "Retries of failed upstream requests; outcome is retried, or budget_exhausted when the retry budget denied one",
+	}, []string{"upstream", "outcome"})
+
+	mirroredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_mirrored_requests_total",
+		Help: "Requests copied to shadow upstreams; outcome is sent, failed, dropped when too many copies were in flight, or skipped for large bodies",
+	}, []string{"upstream", "outcome"})
+
+	outlierEjectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_outlier_ejections_total",
+		Help: "Targets ejected by outlier detection, by upstream, target and reason (5xx, connect_failure)",
+	}, []string{"upstream", "target", "reason"})
+
+	healthChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_health_checks_total",
+		Help: "Active health checks, by target and result (success, failure)",
+	}, []string{"target", "result"})
+
+	healthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sentinel_health_check_duration_seconds",
+		Help:    "Duration of active health checks",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"target"})
+
+	targetHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_target_healthy",
+		Help: "Whether a target is healthy (1), unhealthy (0) or not yet known (-1)",
+	}, []string{"target"})
+
+	shedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sentinel_requests_shed_total",
+		Help: "Requests rejected by overload protection",
+	})
+
+	overloadShedRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_overload_shed_ratio",
+		Help: "Share of requests overload protection is rejecting",
+	})
+
+	overloadLatency = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_overload_p99_latency_seconds",
+		Help: "p99 latency of the requests served in the overload protection window",
+	})
+
+	overloadCPU = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_overload_cpu_utilization",
+		Help: "CPU utilization of the process as measured by overload protection, from 0 to 1",
+	})
+
+	configReloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sentinel_config_reloads_total",
+		Help: "Configuration reloads, by result (success, failure, unchanged)",
+	}, []string{"result"})
+
+	configLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sentinel_config_last_reload_success_timestamp_seconds",
+		Help: "When a configuration was last applied, as a Unix timestamp",
+	})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sentinel_build_info",
+		Help: "Build information of the running binary",
+	}, []string{"version", "commit", "build_date", "goversion"})
+)
+
+func init() {
+	build := version.Get()
+	buildInfo.WithLabelValues(build.Version, build.Commit, build.BuildDate, build.GoVersion).Set(1)
+
+	registry.MustRegister(
+		requestsTotal, requestDuration, requestSize, responseSize,
+		activeConnections, retriesTotal, mirroredTotal, outlierEjectionsTotal,
+		healthChecksTotal, healthCheckDuration, targetHealthy,
+		shedTotal, overloadShedRatio, overloadLatency, overloadCPU,
+		configReloadsTotal, configLastReloadSuccess, buildInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// knownMethods are the methods counted under their own name; any other is
+// counted as OTHER, so clients cannot create label values at will
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodConnect: true,
+	http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// ObserveRequest records a handled request. route and upstream are empty
+// for requests that matched no route; requestBytes is -1 when unknown.
+func ObserveRequest(route, upstream, method string, status int, requestBytes, responseBytes int64, duration time.Duration) {
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+	requestsTotal.WithLabelValues(route, upstream, method, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(route, upstream).Observe(duration.Seconds())
+	if requestBytes >= 0 {
+		requestSize.WithLabelValues(route, upstream).Observe(float64(requestBytes))
+	}
+	responseSize.WithLabelValues(route, upstream).Observe(float64(responseBytes))
+}
+
+// TrackConnections returns an http.Server ConnState hook counting the open
+// connections of a listener
+func TrackConnections(listener string) func(net.Conn, http.ConnState) {
+	gauge := activeConnections.WithLabelValues(listener)
+	return func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			gauge.Inc()
+		case http.StateHijacked, http.StateClosed:
+			gauge.Dec()
+		}
+	}
+}
+
+// ObserveRetry records a retry of an upstream request, or one the retry
+// budget denied
+func ObserveRetry(upstream string, allowed bool) {
+	outcome := "retried"
+	if !allowed {
+		outcome = "budget_exhausted"
+	}
+	retriesTotal.WithLabelValues(upstream, outcome).Inc()
+}
+
+// ObserveOutlierEjection records a target ejected by outlier detection
+func ObserveOutlierEjection(upstream, target, reason string) {
+	outlierEjectionsTotal.WithLabelValues(upstream, target, reason).Inc()
+}
+
+// ObserveConfigReload records the result of a configuration reload:
+// success, failure, or unchanged when it was skipped
+func ObserveConfigReload(result string) {
+	configReloadsTotal.WithLabelValues(result).Inc()
+	if result == "success" {
+		configLastReloadSuccess.SetToCurrentTime()
+	}
+}
+
+// ObserveMirror records the outcome of a request copied to a shadow upstream
+func ObserveMirror(upstream, outcome string) {
+	mirroredTotal.WithLabelValues(upstream, outcome).Inc()
+}
+
+// ObserveShed records a request rejected by overload protection
+func ObserveShed() {
+	shedTotal.Inc()
+}
+
+// SetOverload records the measurements of overload protection and the
+// share of requests it rejects
+func SetOverload(shedRatio float64, p99Latency time.Duration, cpu float64) {
+	overloadShedRatio.Set(shedRatio)
+	overloadLatency.Set(p99Latency.Seconds())
+	overloadCPU.Set(cpu)
+}
+
+// ObserveHealthCheck records the result of an active health check
+func ObserveHealthCheck(target string, success bool, duration time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	healthChecksTotal.WithLabelValues(target, result).Inc()
+	healthCheckDuration.WithLabelValues(target).Observe(duration.Seconds())
+}
+
+// SetTargetHealth records the health of a target: 1 healthy, 0 unhealthy,
+// -1 unknown
+func SetTargetHealth(target string, value float64) {
+	targetHealthy.WithLabelValues(target).Set(value)
+}
+
+// ForgetTarget removes the health metrics of a target no longer checked
+func ForgetTarget(target string) {
+	targetHealthy.DeleteLabelValues(target)
+	healthCheckDuration.DeleteLabelValues(target)
+	healthChecksTotal.DeleteLabelValues(target, "success")
+	healthChecksTotal.DeleteLabelValues(target, "failure")
+}
+
+// certificateCollector reports the expiry of the loaded TLS certificates,
+// read at scrape time so reloaded certificates show up
+type certificateCollector struct {
+	certificates func() []tls.CertificateInfo
+	expiry       *prometheus.Desc
+}
+
+// Describe sends the descriptor of the certificate expiry gauge
+func (c *certificateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expiry
+}
+
+// Collect sends the expiry of every host's certificate
+func (c *certificateCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, cert := range c.certificates() {
+		for _, host := range cert.Hosts {
+			ch <- prometheus.MustNewConstMetric(c.expiry, prometheus.GaugeValue,
+				float64(cert.NotAfter.Unix()), host, cert.Subject)
+		}
+	}
+}
+
+// textGatherer parses the metrics Collectors write in the text format, so
+// they are served alongside the registry
+type textGatherer []Collector
+
+// Gather parses the output of every collector
+func (g textGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var b strings.Builder
+	for _, collector := range g {
+		collector.WriteMetrics(&b)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(b.String()))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		list = append(list, family)
+	}
+	return list, nil
+}
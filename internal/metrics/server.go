@@ -2,18 +2,34 @@ package metrics
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/handover"
+	"github.com/bpradana/sentinel/internal/tls"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+// Collector writes metrics of another component in the Prometheus text
+// format
+type Collector interface {
+	WriteMetrics(w io.Writer)
+}
+
 // Server handles metrics collection and serving
 type Server struct {
-	cfg    *config.MetricsConfig
-	logger *zap.Logger
-	server *http.Server
+	cfg        *config.MetricsConfig
+	logger     *zap.Logger
+	server     *http.Server
+	collectors []Collector
+	handler    atomic.Pointer[http.ServeMux] // serves the configured path
+	mu         sync.Mutex
 }
 
 // NewServer creates a new metrics server
@@ -24,33 +40,128 @@ func NewServer(cfg *config.MetricsConfig, logger *zap.Logger) *Server {
 	}
 }
 
-// Start starts the metrics server
+// Register adds the metrics of a collector to the served metrics. Collectors
+// must be registered before Start.
+func (s *Server) Register(collector Collector) {
+	s.collectors = append(s.collectors, collector)
+}
+
+// RegisterCertificates reports the expiry of the TLS certificates returned
+// by certificates. It must be called before Start.
+func (s *Server) RegisterCertificates(certificates func() []tls.CertificateInfo) {
+	registry.MustRegister(&certificateCollector{
+		certificates: certificates,
+		expiry: prometheus.NewDesc("sentinel_tls_certificate_expiry_timestamp_seconds",
+			"Time a loaded TLS certificate expires, as a Unix timestamp",
+			[]string{"host", "subject"}, nil),
+	})
+}
+
+// Start binds the metrics port, or takes over the socket of the process
+// this one upgrades, and serves metrics in the background
 func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if !s.cfg.Enabled {
 		s.logger.Info("Metrics server disabled")
 		return nil
 	}
 
+	s.handler.Store(s.newMux(s.cfg.Path))
+	server, err := s.listen(s.cfg)
+	if err != nil {
+		return err
+	}
+	s.server = server
+	return nil
+}
+
+// Update applies new metrics settings. A new port is bound before the old
+// one is released, so a port that cannot be bound leaves the server as it
+// was.
+func (s *Server) Update(cfg *config.MetricsConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.cfg
+	if *cfg == *previous {
+		s.cfg = cfg
+		return nil
+	}
+
+	if !cfg.Enabled {
+		s.cfg = cfg
+		if s.server != nil {
+			s.logger.Info("Stopping metrics server")
+			s.server.Close()
+			s.server = nil
+		}
+		return nil
+	}
+
+	mux := s.newMux(cfg.Path)
+	if s.server == nil || cfg.Port != previous.Port {
+		server, err := s.listen(cfg)
+		if err != nil {
+			return err
+		}
+		if s.server != nil {
+			s.server.Close()
+		}
+		s.server = server
+	}
+	s.handler.Store(mux)
+	s.cfg = cfg
+	return nil
+}
+
+// newMux serves the metrics at path
+func (s *Server) newMux(path string) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc(s.cfg.Path, s.metricsHandler)
+	gatherers := prometheus.Gatherers{registry, textGatherer(s.collectors)}
+	mux.Handle(path, promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{
+		ErrorLog:      zap.NewStdLog(s.logger),
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+	return mux
+}
 
-	s.server = &http.Server{
-		Addr:         fmt.Sprintf(":%d", s.cfg.Port),
-		Handler:      mux,
+// listen binds the port of cfg and serves the current handler on it in the
+// background
+func (s *Server) listen(cfg *config.MetricsConfig) (*http.Server, error) {
+	server := &http.Server{
+		Addr: fmt.Sprintf(":%d", cfg.Port),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.handler.Load().ServeHTTP(w, r)
+		}),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  30 * time.Second,
 	}
 
-	s.logger.Info("Starting metrics server",
-		zap.Int("port", s.cfg.Port),
-		zap.String("path", s.cfg.Path))
+	ln, err := handover.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind metrics port %d: %w", cfg.Port, err)
+	}
 
-	return s.server.ListenAndServe()
+	s.logger.Info("Starting metrics server",
+		zap.Int("port", cfg.Port),
+		zap.String("path", cfg.Path))
+
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Metrics server error", zap.Error(err))
+		}
+	}()
+	return server, nil
 }
 
 // Stop stops the metrics server
 func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.server == nil {
 		return nil
 	}
@@ -58,28 +169,3 @@ func (s *Server) Stop() error {
 	s.logger.Info("Stopping metrics server")
 	return s.server.Close()
 }
-
-// metricsHandler handles metrics requests
-func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-
-	// Basic metrics for now - this can be expanded with actual metrics collection
-	metrics := `# HELP sentinel_requests_total Total number of requests
-# TYPE sentinel_requests_total counter
-sentinel_requests_total 0
-
-# HELP sentinel_requests_duration_seconds Request duration in seconds
-# TYPE sentinel_requests_duration_seconds histogram
-sentinel_requests_duration_seconds 0
-
-# HELP sentinel_upstream_health_up Upstream health status
-# TYPE sentinel_upstream_health_up gauge
-sentinel_upstream_health_up 1
-
-# HELP sentinel_tls_certificates_total Total number of TLS certificates
-# TYPE sentinel_tls_certificates_total gauge
-sentinel_tls_certificates_total 0
-`
-
-	w.Write([]byte(metrics))
-}
@@ -1,33 +1,37 @@
 package middleware
 
 import (
+	"context"
+	"crypto"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/bpradana/sentinel/internal/config"
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
 // AuthMiddleware provides JWT-based authentication
 type AuthMiddleware struct {
-	logger *zap.Logger
-	config AuthConfig
+	logger     *zap.Logger
+	config     AuthConfig
+	publicKey  crypto.PublicKey
+	jwks       *jwksCache
+	algorithms []string
+	issuers    []string
 }
 
+// Signing algorithms accepted by default, by kind of key
+var (
+	hmacAlgorithms       = []string{"HS256", "HS384", "HS512"}
+	asymmetricAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
 // AuthConfig holds authentication configuration
-type AuthConfig struct {
-	JWTSecret     string   `json:"jwt_secret"`
-	JWTIssuer     string   `json:"jwt_issuer"`
-	SkipPaths     []string `json:"skip_paths"`
-	TokenLocation string   `json:"token_location"` // "header", "cookie", "query"
-	TokenName     string   `json:"token_name"`
-	AuthType      string   `json:"auth_type"`
-	SecretKey     string   `json:"secret_key"`
-	TokenHeader   string   `json:"token_header"`
-	PublicPaths   []string `json:"public_paths"`
-}
+type AuthConfig = config.AuthMiddlewareConfig
 
 // Claims represents JWT claims
 type Claims struct {
@@ -38,78 +42,41 @@ type Claims struct {
 }
 
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(logger *zap.Logger, config map[string]any) (*AuthMiddleware, error) {
-	authConfig := AuthConfig{
-		TokenLocation: "header", // Default: Authorization header
-		TokenName:     "Authorization",
-		AuthType:      "jwt", // Default auth type
+func NewAuthMiddleware(logger *zap.Logger, cfg AuthConfig) (*AuthMiddleware, error) {
+	// Validate required fields
+	if cfg.JWTSecret == "" && cfg.PublicKey == "" && cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("jwt_secret, secret_key, public_key or jwks_url is required for auth middleware")
 	}
 
-	// Support both jwt_secret and secret_key parameter names
-	if secret, ok := config["jwt_secret"].(string); ok {
-		authConfig.JWTSecret = secret
+	am := &AuthMiddleware{
+		logger:     logger,
+		config:     cfg,
+		algorithms: cfg.Algorithms,
 	}
-	if secretKey, ok := config["secret_key"].(string); ok {
-		authConfig.SecretKey = secretKey
-		// Use secret_key as jwt_secret if jwt_secret is not set
-		if authConfig.JWTSecret == "" {
-			authConfig.JWTSecret = secretKey
+	if cfg.PublicKey != "" {
+		key, err := config.ParsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth public_key: %w", err)
 		}
+		am.publicKey = key
 	}
-
-	if issuer, ok := config["jwt_issuer"].(string); ok {
-		authConfig.JWTIssuer = issuer
+	if cfg.JWKSURL != "" {
+		am.jwks = sharedJWKSCache(cfg.JWKSURL, cfg.JWKSRefreshInterval)
 	}
-
-	// Support both skip_paths and public_paths parameter names
-	if skipPaths, ok := config["skip_paths"].([]any); ok {
-		for _, path := range skipPaths {
-			if pathStr, ok := path.(string); ok {
-				authConfig.SkipPaths = append(authConfig.SkipPaths, pathStr)
-			}
+	if len(am.algorithms) == 0 {
+		if cfg.JWTSecret != "" {
+			am.algorithms = append(am.algorithms, hmacAlgorithms...)
 		}
-	}
-	if publicPaths, ok := config["public_paths"].([]any); ok {
-		for _, path := range publicPaths {
-			if pathStr, ok := path.(string); ok {
-				authConfig.PublicPaths = append(authConfig.PublicPaths, pathStr)
-			}
+		if am.publicKey != nil || am.jwks != nil {
+			am.algorithms = append(am.algorithms, asymmetricAlgorithms...)
 		}
-		// Use public_paths as skip_paths if skip_paths is not set
-		if len(authConfig.SkipPaths) == 0 {
-			authConfig.SkipPaths = authConfig.PublicPaths
-		}
-	}
-
-	if tokenLocation, ok := config["token_location"].(string); ok {
-		authConfig.TokenLocation = tokenLocation
-	}
-
-	if tokenName, ok := config["token_name"].(string); ok {
-		authConfig.TokenName = tokenName
-	}
-
-	if tokenHeader, ok := config["token_header"].(string); ok {
-		authConfig.TokenHeader = tokenHeader
-		// Use token_header as token_name if token_name is not set
-		if authConfig.TokenName == "Authorization" {
-			authConfig.TokenName = tokenHeader
-		}
-	}
-
-	if authType, ok := config["auth_type"].(string); ok {
-		authConfig.AuthType = authType
 	}
-
-	// Validate required fields
-	if authConfig.JWTSecret == "" {
-		return nil, fmt.Errorf("jwt_secret or secret_key is required for auth middleware")
+	if cfg.JWTIssuer != "" {
+		am.issuers = append(am.issuers, cfg.JWTIssuer)
 	}
+	am.issuers = append(am.issuers, cfg.JWTIssuers...)
 
-	return &AuthMiddleware{
-		logger: logger,
-		config: authConfig,
-	}, nil
+	return am, nil
 }
 
 // Handle implements the middleware interface
@@ -132,7 +99,7 @@ func (am *AuthMiddleware) Handle(next http.Handler) http.Handler {
 		}
 
 		// Validate token
-		claims, err := am.validateToken(token)
+		claims, err := am.validateToken(r.Context(), token)
 		if err != nil {
 			am.logger.Warn("Invalid token", zap.Error(err))
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -193,14 +160,10 @@ func (am *AuthMiddleware) extractToken(r *http.Request) (string, error) {
 }
 
 // validateToken validates the JWT token and returns claims
-func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
+func (am *AuthMiddleware) validateToken(ctx context.Context, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		// Ensure the token is signed with the expected method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(am.config.JWTSecret), nil
-	})
+		return am.verificationKey(ctx, token)
+	}, jwt.WithValidMethods(am.algorithms))
 
 	if err != nil {
 		return nil, err
@@ -216,10 +179,17 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
 	}
 
 	// Validate issuer if configured
-	if am.config.JWTIssuer != "" && claims.Issuer != am.config.JWTIssuer {
+	if len(am.issuers) > 0 && !slices.Contains(am.issuers, claims.Issuer) {
 		return nil, fmt.Errorf("invalid token issuer")
 	}
 
+	// Validate audience if configured
+	if len(am.config.JWTAudiences) > 0 && !slices.ContainsFunc(claims.Audience, func(audience string) bool {
+		return slices.Contains(am.config.JWTAudiences, audience)
+	}) {
+		return nil, fmt.Errorf("invalid token audience")
+	}
+
 	// Check token expiration
 	if claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(time.Now()) {
 		return nil, fmt.Errorf("token expired")
@@ -228,6 +198,31 @@ func (am *AuthMiddleware) validateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// verificationKey returns the key verifying a token: the shared secret for
+// HMAC tokens, and otherwise the JWKS key named by the token's kid or the
+// configured public key
+func (am *AuthMiddleware) verificationKey(ctx context.Context, token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		// Never verify HMAC tokens with public keys, which are not secret
+		if am.config.JWTSecret == "" {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(am.config.JWTSecret), nil
+	}
+
+	if am.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		key, err := am.jwks.key(ctx, kid, am.logger)
+		if err == nil || am.publicKey == nil {
+			return key, err
+		}
+	}
+	if am.publicKey != nil {
+		return am.publicKey, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
 // GenerateToken generates a JWT token for the given user
 func (am *AuthMiddleware) GenerateToken(userID, email string, roles []string, duration time.Duration) (string, error) {
 	claims := &Claims{
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxBasicAuthCacheSize limits the remembered successful logins
+const maxBasicAuthCacheSize = 1024
+
+// BasicAuthMiddleware protects routes with HTTP basic authentication
+type BasicAuthMiddleware struct {
+	logger    *zap.Logger
+	config    BasicAuthConfig
+	users     map[string]string // hashes by user
+	allowed   []*net.IPNet
+	challenge string
+
+	// Checking a bcrypt hash takes tens of milliseconds, so successful
+	// logins are remembered by a digest of the user, password and hash
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]struct{}
+}
+
+// BasicAuthConfig holds basic authentication configuration
+type BasicAuthConfig = config.BasicAuthMiddlewareConfig
+
+// NewBasicAuthMiddleware creates a basic authentication middleware, reading
+// the htpasswd file
+func NewBasicAuthMiddleware(logger *zap.Logger, cfg BasicAuthConfig) (*BasicAuthMiddleware, error) {
+	users, err := config.ParseHtpasswd(strings.Join(cfg.Users, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid basic_auth users: %w", err)
+	}
+	if cfg.HtpasswdFile != "" {
+		data, err := os.ReadFile(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read htpasswd file: %w", err)
+		}
+		fileUsers, err := config.ParseHtpasswd(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid htpasswd file %s: %w", cfg.HtpasswdFile, err)
+		}
+		// Inline users take precedence
+		for user, hash := range fileUsers {
+			if _, exists := users[user]; !exists {
+				users[user] = hash
+			}
+		}
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("basic_auth middleware has no users")
+	}
+
+	m := &BasicAuthMiddleware{
+		logger:    logger,
+		config:    cfg,
+		users:     users,
+		challenge: fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, cfg.Realm),
+		verified:  make(map[[sha256.Size]byte]struct{}),
+	}
+	for _, entry := range cfg.AllowIPs {
+		network, err := config.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid basic_auth allow_ips entry %s: %w", entry, err)
+		}
+		m.allowed = append(m.allowed, network)
+	}
+	return m, nil
+}
+
+// Handle implements the middleware interface
+func (m *BasicAuthMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clients cannot name the user themselves
+		if m.config.UserHeader != "" {
+			r.Header.Del(m.config.UserHeader)
+		}
+
+		for _, skipPath := range m.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if m.isAllowed(clientip.FromRequest(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, password, ok := r.BasicAuth()
+		if !ok || !m.verify(user, password) {
+			if ok {
+				m.logger.Warn("Basic authentication failed",
+					zap.String("user", user),
+					zap.String("client_ip", clientip.FromRequest(r)))
+			}
+			w.Header().Set("WWW-Authenticate", m.challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if m.config.UserHeader != "" {
+			r.Header.Set(m.config.UserHeader, user)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Name returns the middleware name
+func (m *BasicAuthMiddleware) Name() string {
+	return "basic_auth"
+}
+
+// isAllowed reports whether a client IP may pass without credentials
+func (m *BasicAuthMiddleware) isAllowed(clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range m.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks a user's password against their hash
+func (m *BasicAuthMiddleware) verify(user, password string) bool {
+	hash, exists := m.users[user]
+	if !exists {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hash))
+	m.mu.Lock()
+	_, verified := m.verified[digest]
+	m.mu.Unlock()
+	if verified {
+		return true
+	}
+
+	if strings.HasPrefix(hash, "$apr1$") {
+		verified = verifyAPR1(password, hash)
+	} else {
+		verified = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	if verified {
+		m.mu.Lock()
+		if len(m.verified) >= maxBasicAuthCacheSize {
+			clear(m.verified)
+		}
+		m.verified[digest] = struct{}{}
+		m.mu.Unlock()
+	}
+	return verified
+}
+
+// apr1Alphabet is the base64 alphabet of crypt hashes
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// verifyAPR1 checks a password against an Apache MD5 hash,
+// $apr1$salt$digest
+func verifyAPR1(password, hash string) bool {
+	salt, _, found := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+	if !found {
+		return false
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	computed := apr1(password, salt)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// apr1 computes the Apache MD5 hash of a password, the MD5-based crypt
+// algorithm with the $apr1$ magic
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	pw := []byte(password)
+
+	alternate := md5.Sum([]byte(password + salt + password))
+	digest := md5.New()
+	digest.Write(pw)
+	digest.Write([]byte(magic + salt))
+	for i := len(pw); i > 0; i -= md5.Size {
+		digest.Write(alternate[:min(i, md5.Size)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write(pw[:1])
+		}
+	}
+	final := digest.Sum(nil)
+
+	// Stretching rounds
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(magic + salt + "$")
+	encode := func(value uint32, chars int) {
+		for ; chars > 0; chars-- {
+			out.WriteByte(apr1Alphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(final[group[0]])<<16|uint32(final[group[1]])<<8|uint32(final[group[2]]), 4)
+	}
+	encode(uint32(final[11]), 2)
+	return out.String()
+}
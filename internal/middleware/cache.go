@@ -0,0 +1,660 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/cache"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig holds response cache configuration
+type CacheConfig = config.CacheMiddlewareConfig
+
+// cachedEncodings are the content codings cached as separate variants
+var cachedEncodings = []string{"br", "gzip"}
+
+// Statuses cached without explicit freshness information and the only ones
+// cached at all (RFC 9111 section 4.2.2)
+var cacheableStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// backgroundRefreshTimeout bounds upstream requests refreshing stale entries
+const backgroundRefreshTimeout = 30 * time.Second
+
+// CacheMiddleware caches GET and HEAD responses in memory or a shared store,
+// honoring Cache-Control, Expires and Vary
+type CacheMiddleware struct {
+	logger *zap.Logger
+	config CacheConfig
+	store  cache.Store
+	// release releases the store once the middleware is closed
+	release func() error
+
+	// refreshing holds the keys of entries being refreshed in the background
+	refreshing sync.Map
+	// flights coalesces concurrent misses of the same resource
+	flights singleflight.Group
+}
+
+// NewCacheMiddleware creates a new response cache middleware
+func NewCacheMiddleware(logger *zap.Logger, cfg CacheConfig) (*CacheMiddleware, error) {
+	store, release, err := cache.NewStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheMiddleware{
+		logger:  logger,
+		config:  cfg,
+		store:   store,
+		release: release,
+	}, nil
+}
+
+// Close releases the store of the cache
+func (c *CacheMiddleware) Close() error {
+	return c.release()
+}
+
+// Handle serves cached responses and caches fresh upstream responses
+func (c *CacheMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, skipPath := range c.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		key := cacheKey(r)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// Successful unsafe requests invalidate the cached resource
+			recorder := &cacheRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if !isSafeMethod(r.Method) && recorder.statusCode() < 400 {
+				c.write(func(ctx context.Context) error { return c.store.Delete(ctx, key) })
+			}
+			return
+		}
+
+		// Authorized responses are personal and partial responses incomplete
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		directives := parseCacheControl(r.Header.Values("Cache-Control"))
+		if directives.has("no-store") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// no-cache requests skip the lookup but refresh the cache
+		var stale *cache.Entry
+		if !directives.has("no-cache") && directives["max-age"] != "0" && r.Header.Get("Pragma") != "no-cache" {
+			if entry := c.lookup(r.Context(), key, r); entry != nil {
+				switch now := time.Now(); {
+				case now.Before(entry.Expires):
+					c.serve(w, r, entry, "HIT")
+					return
+				case now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)):
+					c.serve(w, r, entry, "STALE")
+					c.refresh(key, r, next)
+					return
+				case now.Before(entry.Expires.Add(entry.StaleIfError)):
+					stale = entry
+				}
+			}
+		}
+
+		if !c.config.Coalesce || r.Method != http.MethodGet {
+			c.fetch(w, r, key, next, stale)
+			return
+		}
+
+		// Concurrent misses wait for the first one's upstream response
+		leader := false
+		result, _, _ := c.flights.Do(key+"\n"+encodingVariant(r), func() (any, error) {
+			leader = true
+			return c.fetch(w, r, key, next, stale), nil
+		})
+		if leader {
+			return
+		}
+		if shared := result.(*sharedResponse); shared.matches(key, r) {
+			c.serve(w, r, shared.entry, "HIT")
+			return
+		}
+		// The response was personal, an error or selected by other headers
+		c.fetch(w, r, key, next, stale)
+	})
+}
+
+// fetch forwards a cache miss upstream and caches the response. It returns
+// the response if concurrent requests for the same resource may share it.
+func (c *CacheMiddleware) fetch(w http.ResponseWriter, r *http.Request, key string, next http.Handler, stale *cache.Entry) *sharedResponse {
+	r = withCachedEncodings(r)
+
+	// With a stale entry to fall back on, upstream errors are held back
+	// until it is known whether the stale entry is served instead
+	var guard *staleGuard
+	if stale != nil {
+		guard = &staleGuard{ResponseWriter: w, header: make(http.Header)}
+		w = guard
+	}
+
+	recorder := &cacheRecorder{ResponseWriter: w, miss: true, record: r.Method == http.MethodGet, limit: c.config.MaxObjectSize}
+	next.ServeHTTP(recorder, r)
+	if guard != nil && guard.failed {
+		c.logger.Debug("Serving stale response after upstream error",
+			zap.String("key", key),
+			zap.Int("status", guard.status))
+		c.serve(guard.ResponseWriter, r, stale, "STALE")
+		return nil
+	}
+	if !recorder.record || recorder.tooLarge || recorder.header == nil || r.Context().Err() != nil {
+		return nil
+	}
+
+	entry := c.save(key, r, recorder)
+	if entry == nil {
+		if !c.config.CoalesceUncacheable || !shareable(recorder.header) {
+			return nil
+		}
+		header := recorder.header.Clone()
+		header.Del("X-Cache")
+		entry = &cache.Entry{Status: recorder.statusCode(), Header: header, Body: recorder.body.Bytes(), Stored: time.Now()}
+	}
+	vary := varyHeaders(entry.Header)
+	return &sharedResponse{entry: entry, vary: vary, variant: variantKey(key, vary, r)}
+}
+
+// Name returns the middleware name
+func (c *CacheMiddleware) Name() string {
+	return "cache"
+}
+
+// lookup returns the cached response for a request, fresh or stale, if any.
+// Store errors are treated as misses.
+func (c *CacheMiddleware) lookup(ctx context.Context, key string, r *http.Request) *cache.Entry {
+	if c.store.Shared() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.StoreTimeout)
+		defer cancel()
+	}
+
+	entry, ok, err := c.store.Get(ctx, key)
+	if err == nil && ok && entry.Vary != nil {
+		// The entry lists the headers selecting the variant
+		entry, ok, err = c.store.Get(ctx, variantKey(key, entry.Vary, r))
+	}
+	if err != nil {
+		c.logger.Warn("Failed to read from cache store", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	return entry
+}
+
+// serve writes a cached response, with status as its X-Cache header
+func (c *CacheMiddleware) serve(w http.ResponseWriter, r *http.Request, entry *cache.Entry, status string) {
+	header := w.Header()
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(entry.Age(time.Now()).Seconds())))
+	header.Set("X-Cache", status)
+
+	if etag := entry.Header.Get("ETag"); etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// save stores a recorded response if it is cacheable and returns the stored
+// entry
+func (c *CacheMiddleware) save(key string, r *http.Request, recorder *cacheRecorder) *cache.Entry {
+	status := recorder.statusCode()
+	if !cacheableStatuses[status] || recorder.header == nil {
+		return nil
+	}
+
+	now := time.Now()
+	lifetime, age, ok := c.freshness(recorder.header, now)
+	if !ok {
+		return nil
+	}
+
+	header := recorder.header
+	header.Del("X-Cache")
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		// Encoded responses are cached per Accept-Encoding variant, and only
+		// in codings the variant's requests accept
+		if !slices.Contains(acceptedEncodings(r.Header.Get("Accept-Encoding"), cachedEncodings), encoding) {
+			return nil
+		}
+		addVary(header, "Accept-Encoding")
+	}
+	entry := &cache.Entry{
+		Status:     status,
+		Header:     header,
+		Body:       recorder.body.Bytes(),
+		Stored:     now,
+		InitialAge: age,
+		Expires:    now.Add(lifetime - age),
+	}
+	c.staleWindows(entry)
+
+	// Stores keep entries as long as they may be served stale
+	ttl := lifetime - age + max(entry.StaleWhileRevalidate, entry.StaleIfError)
+	vary := varyHeaders(header)
+	variant := variantKey(key, vary, r)
+	c.write(func(ctx context.Context) error {
+		if len(vary) == 0 {
+			return c.store.Set(ctx, key, entry, ttl)
+		}
+		if err := c.store.Set(ctx, key, &cache.Entry{Vary: vary, Stored: now, Expires: entry.Expires}, ttl); err != nil {
+			return err
+		}
+		return c.store.Set(ctx, variant, entry, ttl)
+	})
+
+	c.logger.Debug("Cached response",
+		zap.String("key", key),
+		zap.Int("status", status),
+		zap.Int("size", len(entry.Body)),
+		zap.Duration("ttl", ttl))
+	return entry
+}
+
+// shareable reports whether a response may be given to other clients than
+// the one it was requested for
+func shareable(header http.Header) bool {
+	directives := parseCacheControl(header.Values("Cache-Control"))
+	return !directives.has("no-store") && !directives.has("private") &&
+		header.Get("Set-Cookie") == "" && header.Get("Vary") != "*"
+}
+
+// sharedResponse is an upstream response handed to concurrent requests for
+// the same resource
+type sharedResponse struct {
+	entry   *cache.Entry
+	vary    []string
+	variant string // variant key of the request that fetched it
+}
+
+// matches reports whether a request would have received the shared response
+func (s *sharedResponse) matches(key string, r *http.Request) bool {
+	return s != nil && variantKey(key, s.vary, r) == s.variant
+}
+
+// staleWindows sets how long an entry may be served stale, from the RFC 5861
+// directives of the response or the configured defaults. Responses that
+// must be revalidated are never served stale.
+func (c *CacheMiddleware) staleWindows(entry *cache.Entry) {
+	directives := parseCacheControl(entry.Header.Values("Cache-Control"))
+	if directives.has("must-revalidate") || directives.has("proxy-revalidate") {
+		return
+	}
+
+	entry.StaleWhileRevalidate = c.config.StaleWhileRevalidate
+	if directives.has("stale-while-revalidate") {
+		entry.StaleWhileRevalidate = directives.seconds("stale-while-revalidate")
+	}
+	entry.StaleIfError = c.config.StaleIfError
+	if directives.has("stale-if-error") {
+		entry.StaleIfError = directives.seconds("stale-if-error")
+	}
+}
+
+// refresh fetches a fresh copy of a stale entry in the background, once per
+// key at a time
+func (c *CacheMiddleware) refresh(key string, r *http.Request, next http.Handler) {
+	if _, running := c.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	// The refresh outlives the client request
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), backgroundRefreshTimeout)
+	refresh := withCachedEncodings(r.Clone(ctx))
+	refresh.Method = http.MethodGet
+
+	go func() {
+		defer cancel()
+		defer c.refreshing.Delete(key)
+
+		recorder := &cacheRecorder{ResponseWriter: &discardResponseWriter{header: make(http.Header)}, record: true, limit: c.config.MaxObjectSize}
+		next.ServeHTTP(recorder, refresh)
+		if !recorder.tooLarge {
+			c.save(key, refresh, recorder)
+		}
+		c.logger.Debug("Refreshed stale cache entry",
+			zap.String("key", key),
+			zap.Int("status", recorder.statusCode()))
+	}()
+}
+
+// write runs a store update. Shared stores are updated in the background so
+// their latency is not added to responses; errors are only logged.
+func (c *CacheMiddleware) write(update func(ctx context.Context) error) {
+	if !c.store.Shared() {
+		update(context.Background())
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.StoreTimeout)
+		defer cancel()
+		if err := update(ctx); err != nil {
+			c.logger.Warn("Failed to write to cache store", zap.Error(err))
+		}
+	}()
+}
+
+// freshness returns how long a response stays fresh and its age when
+// received; ok is false if the response must not be stored
+func (c *CacheMiddleware) freshness(header http.Header, now time.Time) (lifetime, age time.Duration, ok bool) {
+	directives := parseCacheControl(header.Values("Cache-Control"))
+	if !shareable(header) || directives.has("no-cache") {
+		return 0, 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header.Get("Age")); err == nil && seconds > 0 {
+		age = time.Duration(seconds) * time.Second
+	}
+
+	switch {
+	case directives.has("s-maxage"):
+		lifetime = directives.seconds("s-maxage")
+	case directives.has("max-age"):
+		lifetime = directives.seconds("max-age")
+	case header.Get("Expires") != "":
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			return 0, 0, false
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		lifetime = expires.Sub(date)
+	default:
+		lifetime = c.config.TTL
+	}
+
+	return lifetime, age, lifetime > age
+}
+
+// cacheRecorder passes a response through while keeping a copy of its
+// headers and, up to limit bytes, its body
+type cacheRecorder struct {
+	http.ResponseWriter
+	miss     bool // mark the response as a cache miss
+	record   bool // keep a copy for the cache
+	limit    int64
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+// WriteHeader marks the response as a cache miss and snapshots its headers
+func (cr *cacheRecorder) WriteHeader(statusCode int) {
+	if cr.status != 0 {
+		return
+	}
+	cr.status = statusCode
+	if cr.miss {
+		cr.Header().Set("X-Cache", "MISS")
+	}
+	if cr.record {
+		cr.header = cr.Header().Clone()
+	}
+	cr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write passes data through and records it
+func (cr *cacheRecorder) Write(data []byte) (int, error) {
+	if cr.status == 0 {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if cr.record && !cr.tooLarge {
+		if int64(cr.body.Len()+len(data)) > cr.limit {
+			cr.tooLarge = true
+			cr.body = bytes.Buffer{}
+		} else {
+			cr.body.Write(data)
+		}
+	}
+	return cr.ResponseWriter.Write(data)
+}
+
+// Flush flushes the response
+func (cr *cacheRecorder) Flush() {
+	if flusher, ok := cr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// statusCode returns the written status, 200 if the handler wrote nothing
+func (cr *cacheRecorder) statusCode() int {
+	if cr.status == 0 {
+		return http.StatusOK
+	}
+	return cr.status
+}
+
+// staleGuard holds back 500, 502, 503 and 504 responses so a stale entry can
+// be served instead (RFC 5861); other responses pass through
+type staleGuard struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	failed      bool
+	wroteHeader bool
+}
+
+// Header returns the headers of the response being held back
+func (g *staleGuard) Header() http.Header {
+	return g.header
+}
+
+// WriteHeader discards error responses and passes others through
+func (g *staleGuard) WriteHeader(statusCode int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.status = statusCode
+
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		g.failed = true
+		return
+	}
+	header := g.ResponseWriter.Header()
+	for name, values := range g.header {
+		header[name] = values
+	}
+	g.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write discards the body of error responses
+func (g *staleGuard) Write(data []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.failed {
+		return len(data), nil
+	}
+	return g.ResponseWriter.Write(data)
+}
+
+// Flush flushes responses that are passed through
+func (g *staleGuard) Flush() {
+	if g.failed {
+		return
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// discardResponseWriter is the response writer of background refreshes
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header            { return d.header }
+func (d *discardResponseWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (d *discardResponseWriter) WriteHeader(int)                {}
+
+// cacheDirectives are parsed Cache-Control directives
+type cacheDirectives map[string]string
+
+// parseCacheControl parses Cache-Control header values
+func parseCacheControl(values []string) cacheDirectives {
+	directives := make(cacheDirectives)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func (d cacheDirectives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns a delta-seconds directive, 0 if invalid
+func (d cacheDirectives) seconds(name string) time.Duration {
+	seconds, err := strconv.Atoi(d[name])
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cacheKey identifies the cached resource of a request
+func cacheKey(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + strings.ToLower(r.Host) + r.URL.RequestURI()
+}
+
+// variantKey identifies the variant of a resource selected by the request
+// headers named in Vary
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		if name == "Accept-Encoding" {
+			b.WriteString(encodingVariant(r))
+			continue
+		}
+		b.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+// encodingVariant returns the cached content codings a request accepts, which
+// select its variant of resources that vary by Accept-Encoding
+func encodingVariant(r *http.Request) string {
+	accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"), cachedEncodings)
+	if len(accepted) == 0 {
+		return "identity"
+	}
+	sort.Strings(accepted)
+	return strings.Join(accepted, ", ")
+}
+
+// withCachedEncodings returns the request with Accept-Encoding reduced to
+// the cached content codings it accepts, so that requests selecting the same
+// variant are forwarded alike
+func withCachedEncodings(r *http.Request) *http.Request {
+	if r.Header.Get("Accept-Encoding") == "" {
+		return r
+	}
+	normalized := r.WithContext(r.Context())
+	normalized.Header = r.Header.Clone()
+	if variant := encodingVariant(r); variant != "identity" {
+		normalized.Header.Set("Accept-Encoding", variant)
+	} else {
+		normalized.Header.Del("Accept-Encoding")
+	}
+	return normalized
+}
+
+// varyHeaders returns the canonical header names listed in Vary
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// etagMatches reports whether an If-None-Match header matches an ETag,
+// using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeMethod reports whether a method does not modify resources
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
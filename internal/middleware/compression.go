@@ -3,9 +3,14 @@ package middleware
 import (
 	"compress/gzip"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/andybalholm/brotli"
+	"github.com/bpradana/sentinel/internal/config"
 	"go.uber.org/zap"
 )
 
@@ -13,97 +18,31 @@ import (
 type CompressionMiddleware struct {
 	logger          *zap.Logger
 	level           int
+	brotliLevel     int
+	encodings       []string
 	minLength       int
 	compressedTypes []string
 	skipPaths       []string
+	decompress      bool
 }
 
 // NewCompressionMiddleware creates a new compression middleware
-func NewCompressionMiddleware(logger *zap.Logger, config map[string]any) (*CompressionMiddleware, error) {
-	comp := &CompressionMiddleware{
-		logger:    logger,
-		level:     gzip.DefaultCompression,
-		minLength: 1024, // 1KB minimum
-		compressedTypes: []string{
-			"text/html",
-			"text/plain",
-			"text/css",
-			"text/javascript",
-			"application/javascript",
-			"application/json",
-			"application/xml",
-			"text/xml",
-		},
-	}
-
-	// Parse configuration
-	if level, ok := config["level"].(int); ok {
-		if level >= gzip.NoCompression && level <= gzip.BestCompression {
-			comp.level = level
-		}
-	}
-	if levelFloat, ok := config["level"].(float64); ok {
-		level := int(levelFloat)
-		if level >= gzip.NoCompression && level <= gzip.BestCompression {
-			comp.level = level
-		}
+func NewCompressionMiddleware(logger *zap.Logger, cfg config.CompressionMiddlewareConfig) (*CompressionMiddleware, error) {
+	level := cfg.Level
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
 	}
 
-	// Support both min_length and min_size parameter names
-	if minLength, ok := config["min_length"].(int); ok {
-		comp.minLength = minLength
-	}
-	if minLengthFloat, ok := config["min_length"].(float64); ok {
-		comp.minLength = int(minLengthFloat)
-	}
-	if minSize, ok := config["min_size"].(int); ok {
-		comp.minLength = minSize
-	}
-	if minSizeFloat, ok := config["min_size"].(float64); ok {
-		comp.minLength = int(minSizeFloat)
-	}
-
-	// Parse compressed types - support both types and content_types parameter names
-	if typesInterface, ok := config["types"]; ok {
-		if typesSlice, ok := typesInterface.([]any); ok {
-			comp.compressedTypes = make([]string, len(typesSlice))
-			for i, t := range typesSlice {
-				if typeStr, ok := t.(string); ok {
-					comp.compressedTypes[i] = typeStr
-				}
-			}
-		} else if typesSlice, ok := typesInterface.([]string); ok {
-			comp.compressedTypes = typesSlice
-		}
-	}
-	if contentTypesInterface, ok := config["content_types"]; ok {
-		if contentTypesSlice, ok := contentTypesInterface.([]any); ok {
-			comp.compressedTypes = make([]string, len(contentTypesSlice))
-			for i, t := range contentTypesSlice {
-				if typeStr, ok := t.(string); ok {
-					comp.compressedTypes[i] = typeStr
-				}
-			}
-		} else if contentTypesSlice, ok := contentTypesInterface.([]string); ok {
-			comp.compressedTypes = contentTypesSlice
-		}
-	}
-
-	// Parse skip paths
-	if skipPathsInterface, ok := config["skip_paths"]; ok {
-		if skipPathsSlice, ok := skipPathsInterface.([]any); ok {
-			comp.skipPaths = make([]string, len(skipPathsSlice))
-			for i, path := range skipPathsSlice {
-				if pathStr, ok := path.(string); ok {
-					comp.skipPaths[i] = pathStr
-				}
-			}
-		} else if skipPathsSlice, ok := skipPathsInterface.([]string); ok {
-			comp.skipPaths = skipPathsSlice
-		}
-	}
-
-	return comp, nil
+	return &CompressionMiddleware{
+		logger:          logger,
+		level:           level,
+		brotliLevel:     cfg.BrotliLevel,
+		encodings:       cfg.Encodings,
+		minLength:       cfg.MinLength,
+		compressedTypes: cfg.Types,
+		skipPaths:       cfg.SkipPaths,
+		decompress:      cfg.Decompress,
+	}, nil
 }
 
 // Handle processes the request with compression
@@ -117,12 +56,6 @@ func (c *CompressionMiddleware) Handle(next http.Handler) http.Handler {
 			}
 		}
 
-		// Check if client accepts gzip
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
-		}
-
 		// Create compressed response writer
 		cw := &compressedResponseWriter{
 			ResponseWriter: w,
@@ -130,12 +63,27 @@ func (c *CompressionMiddleware) Handle(next http.Handler) http.Handler {
 			request:        r,
 		}
 
+		// Pick the preferred encoding the client accepts
+		if encodings := acceptedEncodings(r.Header.Get("Accept-Encoding"), c.encodings); len(encodings) > 0 {
+			cw.encoding = encodings[0]
+		}
+
 		// Serve the request
 		next.ServeHTTP(cw, r)
 
-		// Close the gzip writer if it was created
-		if cw.gzipWriter != nil {
-			cw.gzipWriter.Close()
+		// Finish decoding before closing the encoder it may write to
+		if cw.decoder != nil {
+			if err := cw.decoder.close(); err != nil {
+				c.logger.Error("Failed to decode response",
+					zap.String("path", r.URL.Path),
+					zap.String("encoding", cw.decoding),
+					zap.Error(err))
+			}
+		}
+
+		// Close the encoder if it was created
+		if cw.encoder != nil {
+			cw.encoder.Close()
 		}
 	})
 }
@@ -162,12 +110,29 @@ func (c *CompressionMiddleware) shouldCompress(contentType string, contentLength
 	return false
 }
 
+// newEncoder creates a writer compressing into w with the given encoding
+func (c *CompressionMiddleware) newEncoder(w io.Writer, encoding string) (encoder, error) {
+	if encoding == "br" {
+		return brotli.NewWriterLevel(w, c.brotliLevel), nil
+	}
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+// encoder is a compressing writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
 // compressedResponseWriter wraps http.ResponseWriter to provide compression
 type compressedResponseWriter struct {
 	http.ResponseWriter
 	middleware  *CompressionMiddleware
 	request     *http.Request
-	gzipWriter  *gzip.Writer
+	encoding    string // empty if the client accepts none of the encodings
+	encoder     encoder
+	decoding    string // coding of an upstream response being decoded
+	decoder     *responseDecoder
 	wroteHeader bool
 }
 
@@ -178,8 +143,15 @@ func (cw *compressedResponseWriter) WriteHeader(statusCode int) {
 	}
 	cw.wroteHeader = true
 
-	// Don't compress error responses
-	if statusCode >= 400 {
+	// Responses in a coding the client does not accept are decoded when
+	// enabled, and may then be compressed with one it does
+	if cw.middleware.decompress {
+		cw.decodeUnaccepted()
+	}
+
+	// Don't compress error responses or responses that are already encoded,
+	// such as pre-compressed upstream artifacts
+	if statusCode >= 400 || cw.Header().Get("Content-Encoding") != "" {
 		cw.ResponseWriter.WriteHeader(statusCode)
 		return
 	}
@@ -192,22 +164,29 @@ func (cw *compressedResponseWriter) WriteHeader(statusCode int) {
 	}
 
 	if cw.middleware.shouldCompress(contentType, contentLength) {
-		// Set compression headers
-		cw.Header().Set("Content-Encoding", "gzip")
-		cw.Header().Set("Vary", "Accept-Encoding")
-		cw.Header().Del("Content-Length") // Remove content-length as it will change
+		// Responses that are compressed for some clients vary by encoding,
+		// including the uncompressed ones served to the others
+		addVary(cw.Header(), "Accept-Encoding")
+		if cw.encoding == "" {
+			cw.ResponseWriter.WriteHeader(statusCode)
+			return
+		}
 
-		// Create gzip writer
+		// Create encoder
 		var err error
-		cw.gzipWriter, err = gzip.NewWriterLevel(cw.ResponseWriter, cw.middleware.level)
+		cw.encoder, err = cw.middleware.newEncoder(cw.ResponseWriter, cw.encoding)
 		if err != nil {
-			cw.middleware.logger.Error("Failed to create gzip writer", zap.Error(err))
+			cw.middleware.logger.Error("Failed to create encoder", zap.String("encoding", cw.encoding), zap.Error(err))
 			cw.ResponseWriter.WriteHeader(statusCode)
 			return
 		}
 
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length") // Remove content-length as it will change
+
 		cw.middleware.logger.Debug("Compressing response",
 			zap.String("path", cw.request.URL.Path),
+			zap.String("encoding", cw.encoding),
 			zap.String("content-type", contentType),
 			zap.Int("content-length", contentLength),
 		)
@@ -222,19 +201,151 @@ func (cw *compressedResponseWriter) Write(data []byte) (int, error) {
 		cw.WriteHeader(http.StatusOK)
 	}
 
-	if cw.gzipWriter != nil {
-		return cw.gzipWriter.Write(data)
+	if cw.decoding != "" {
+		if len(data) == 0 {
+			return 0, nil
+		}
+		if cw.decoder == nil {
+			cw.decoder = newResponseDecoder(cw, cw.decoding)
+		}
+		return cw.decoder.write(data)
 	}
 
+	return cw.writeBody(data)
+}
+
+// writeBody writes decoded data to the response, compressing it if enabled
+func (cw *compressedResponseWriter) writeBody(data []byte) (int, error) {
+	if cw.encoder != nil {
+		return cw.encoder.Write(data)
+	}
 	return cw.ResponseWriter.Write(data)
 }
 
 // Flush flushes the response
 func (cw *compressedResponseWriter) Flush() {
-	if cw.gzipWriter != nil {
-		cw.gzipWriter.Flush()
+	if cw.decoder != nil {
+		cw.decoder.flush()
+		return
+	}
+	cw.flushBody()
+}
+
+// flushBody flushes the encoder and the response
+func (cw *compressedResponseWriter) flushBody() {
+	if cw.encoder != nil {
+		cw.encoder.Flush()
 	}
 	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
 	}
 }
+
+// decodeUnaccepted prepares to decode a gzip or br response whose coding
+// the client does not accept, as clients sending no Accept-Encoding do not
+func (cw *compressedResponseWriter) decodeUnaccepted() {
+	coding := strings.ToLower(strings.TrimSpace(cw.Header().Get("Content-Encoding")))
+	if coding == "x-gzip" {
+		coding = "gzip"
+	}
+	if coding != "gzip" && coding != "br" {
+		return
+	}
+	addVary(cw.Header(), "Accept-Encoding")
+	if slices.Contains(acceptedEncodings(cw.request.Header.Get("Accept-Encoding"), []string{coding}), coding) {
+		return
+	}
+
+	cw.decoding = coding
+	cw.Header().Del("Content-Encoding")
+	cw.Header().Del("Content-Length")
+	// The decoded body is not the representation a strong ETag names
+	if etag := cw.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		cw.Header().Set("ETag", "W/"+etag)
+	}
+
+	cw.middleware.logger.Debug("Decoding response",
+		zap.String("path", cw.request.URL.Path),
+		zap.String("encoding", coding))
+}
+
+// responseDecoder decodes a response body as it is written. The decoder
+// reads the written bytes through a pipe in a goroutine, which writes the
+// decoded bytes on to the response.
+type responseDecoder struct {
+	pipe *io.PipeWriter
+	done chan error
+
+	mu        sync.Mutex // serializes writes to the response with flushes
+	out       *compressedResponseWriter
+	streaming bool // whether the handler flushes, so decoded bytes are flushed too
+}
+
+// newResponseDecoder starts decoding a body in the given coding
+func newResponseDecoder(out *compressedResponseWriter, coding string) *responseDecoder {
+	reader, pipe := io.Pipe()
+	d := &responseDecoder{pipe: pipe, done: make(chan error, 1), out: out}
+	go func() {
+		var decoded io.Reader
+		var err error
+		if coding == "br" {
+			decoded = brotli.NewReader(reader)
+		} else {
+			decoded, err = gzip.NewReader(reader)
+		}
+		if err == nil {
+			_, err = io.Copy(decodedWriter{d}, decoded)
+		}
+		// Unblocks the handler's writes when decoding stops early
+		reader.CloseWithError(err)
+		d.done <- err
+	}()
+	return d
+}
+
+// write passes encoded bytes to the decoder
+func (d *responseDecoder) write(data []byte) (int, error) {
+	return d.pipe.Write(data)
+}
+
+// flush flushes what was decoded so far, and from then on every decoded
+// chunk
+func (d *responseDecoder) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.streaming = true
+	d.out.flushBody()
+}
+
+// close waits for the decoder to finish the body
+func (d *responseDecoder) close() error {
+	d.pipe.Close()
+	return <-d.done
+}
+
+// decodedWriter writes decoded bytes to the response
+type decodedWriter struct {
+	d *responseDecoder
+}
+
+func (w decodedWriter) Write(data []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	n, err := w.d.out.writeBody(data)
+	if err == nil && w.d.streaming {
+		w.d.out.flushBody()
+	}
+	return n, err
+}
+
+// addVary adds a header name to the Vary header unless it is already listed
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			if listed = strings.TrimSpace(listed); listed == "*" || strings.EqualFold(listed, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
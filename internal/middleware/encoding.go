@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptedEncodings returns the content codings of supported that an
+// Accept-Encoding header allows, most preferred first. Codings with equal
+// weights keep the order of supported.
+func acceptedEncodings(acceptEncoding string, supported []string) []string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+
+		q := 1.0
+		if param, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(param) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	var accepted []string
+	weight := func(encoding string) float64 {
+		if q, ok := weights[encoding]; ok {
+			return q
+		}
+		return wildcard
+	}
+	for _, encoding := range supported {
+		if weight(encoding) > 0 {
+			accepted = append(accepted, encoding)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return weight(accepted[i]) > weight(accepted[j])
+	})
+	return accepted
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/events"
+	"go.uber.org/zap"
+)
+
+// redactedValue replaces the values of redacted headers
+const redactedValue = "[REDACTED]"
+
+// EventsMiddleware publishes an event describing every request to a message
+// queue for analytics. Events are published in the background and dropped
+// when the queue falls behind, so requests are never delayed.
+type EventsMiddleware struct {
+	logger    *zap.Logger
+	config    EventsConfig
+	publisher *events.Publisher
+	redact    map[string]bool
+}
+
+// EventsConfig holds request event configuration
+type EventsConfig = config.EventsMiddlewareConfig
+
+// NewEventsMiddleware creates a new request event middleware
+func NewEventsMiddleware(logger *zap.Logger, cfg EventsConfig) (*EventsMiddleware, error) {
+	publisher, err := events.Shared(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	redact := make(map[string]bool, len(cfg.RedactHeaders))
+	for _, name := range cfg.RedactHeaders {
+		redact[http.CanonicalHeaderKey(name)] = true
+	}
+
+	return &EventsMiddleware{
+		logger:    logger,
+		config:    cfg,
+		publisher: publisher,
+		redact:    redact,
+	}, nil
+}
+
+// Handle implements the middleware interface
+func (em *EventsMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, skipPath := range em.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// Routes can turn events off, or capture the bodies and headers of
+		// all their requests
+		level := eventsLevel(r)
+		if level == LevelOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		verbose := level == LevelVerbose
+
+		start := time.Now()
+		sampled := verbose || (em.config.BodySampleRate > 0 && rand.Float64() < em.config.BodySampleRate)
+
+		var body *capturingBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &capturingBody{ReadCloser: r.Body, capture: sampled, limit: em.config.MaxBodySize}
+			r.Body = body
+		}
+		recorder := &eventRecorder{
+			ResponseWriter: w,
+			capture:        sampled,
+			limit:          em.config.MaxBodySize,
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		event := &events.Event{
+			Time:         start.UTC(),
+			RequestID:    r.Header.Get("X-Request-ID"),
+			Method:       r.Method,
+			Host:         r.Host,
+			Path:         r.URL.Path,
+			Query:        r.URL.RawQuery,
+			Proto:        r.Proto,
+			ClientIP:     clientip.FromRequest(r),
+			UserAgent:    r.UserAgent(),
+			Status:       recorder.statusCode(),
+			DurationMS:   float64(time.Since(start).Microseconds()) / 1000,
+			ResponseSize: recorder.size,
+		}
+		if body != nil {
+			event.RequestSize = body.size
+			event.RequestBody, event.RequestBodyTruncated = body.captured, body.truncated
+		}
+		if sampled {
+			event.ResponseBody, event.ResponseBodyTruncated = recorder.captured, recorder.truncated
+		}
+		if em.config.IncludeHeaders || verbose {
+			event.RequestHeaders = em.headers(r.Header)
+			event.ResponseHeaders = em.headers(recorder.Header())
+		}
+
+		em.publisher.Publish(event)
+	})
+}
+
+// Name returns the middleware name
+func (em *EventsMiddleware) Name() string {
+	return "events"
+}
+
+// headers copies headers for an event, redacting sensitive values
+func (em *EventsMiddleware) headers(header http.Header) map[string][]string {
+	copied := make(map[string][]string, len(header))
+	for name, values := range header {
+		if em.redact[name] {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = redactedValue
+			}
+			copied[name] = redacted
+			continue
+		}
+		copied[name] = append([]string(nil), values...)
+	}
+	return copied
+}
+
+// capturingBody counts the bytes of a request body as it is read and keeps
+// the first limit bytes of sampled bodies
+type capturingBody struct {
+	io.ReadCloser
+	capture   bool
+	limit     int64
+	size      int64
+	captured  []byte
+	truncated bool
+}
+
+// Read reads from the body, capturing what was read
+func (cb *capturingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	cb.size += int64(n)
+	if cb.capture {
+		cb.captured, cb.truncated = appendLimited(cb.captured, p[:n], cb.limit, cb.truncated)
+	}
+	return n, err
+}
+
+// eventRecorder records the status and size of a response and keeps the
+// first limit bytes of sampled bodies
+type eventRecorder struct {
+	http.ResponseWriter
+	status    int
+	size      int64
+	capture   bool
+	limit     int64
+	captured  []byte
+	truncated bool
+}
+
+// WriteHeader records the status code
+func (er *eventRecorder) WriteHeader(statusCode int) {
+	if er.status == 0 {
+		er.status = statusCode
+	}
+	er.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the written data
+func (er *eventRecorder) Write(data []byte) (int, error) {
+	if er.status == 0 {
+		er.status = http.StatusOK
+	}
+	n, err := er.ResponseWriter.Write(data)
+	er.size += int64(n)
+	if er.capture {
+		er.captured, er.truncated = appendLimited(er.captured, data[:n], er.limit, er.truncated)
+	}
+	return n, err
+}
+
+// Flush flushes the response
+func (er *eventRecorder) Flush() {
+	if flusher, ok := er.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// statusCode returns the written status, 200 if the handler wrote nothing
+func (er *eventRecorder) statusCode() int {
+	if er.status == 0 {
+		return http.StatusOK
+	}
+	return er.status
+}
+
+// appendLimited appends data to captured up to limit bytes, reporting whether
+// anything was cut off
+func appendLimited(captured, data []byte, limit int64, truncated bool) ([]byte, bool) {
+	room := limit - int64(len(captured))
+	if int64(len(data)) > room {
+		return append(captured, data[:max(room, 0)]...), true
+	}
+	return append(captured, data...), truncated
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// maxAuthzResponseSize limits the responses read from authorization services
+const maxAuthzResponseSize = 64 * 1024
+
+// ExternalAuthMiddleware checks every request with an external authorization
+// service before passing it on. Allowed requests get the headers the service
+// adds, and denied ones are answered with the service's response.
+type ExternalAuthMiddleware struct {
+	logger *zap.Logger
+	config ExternalAuthConfig
+	check  func(ctx context.Context, r *http.Request) (*authzDecision, error)
+
+	client *http.Client
+	grpc   *authzGRPCClient
+}
+
+// ExternalAuthConfig holds external authorization configuration
+type ExternalAuthConfig = config.ExternalAuthMiddlewareConfig
+
+// authzDecision is the answer of an authorization service
+type authzDecision struct {
+	allowed bool
+
+	// Changes to allowed requests, and headers added to their responses
+	setHeaders      http.Header
+	addHeaders      http.Header
+	removeHeaders   []string
+	responseHeaders http.Header
+
+	// Response to denied requests
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// NewExternalAuthMiddleware creates an external authorization middleware
+func NewExternalAuthMiddleware(logger *zap.Logger, cfg ExternalAuthConfig) (*ExternalAuthMiddleware, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("external_auth middleware requires a url")
+	}
+
+	m := &ExternalAuthMiddleware{logger: logger, config: cfg}
+	switch cfg.Protocol {
+	case "http":
+		m.client = &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			// Redirects, e.g. to a login page, are returned to the client
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		m.check = m.checkHTTP
+	case "grpc":
+		client, err := newAuthzGRPCClient(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		m.grpc = client
+		m.check = m.checkGRPC
+	default:
+		return nil, fmt.Errorf("unsupported external_auth protocol: %s", cfg.Protocol)
+	}
+	return m, nil
+}
+
+// Handle implements the middleware interface
+func (m *ExternalAuthMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, skipPath := range m.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), m.config.Timeout)
+		decision, err := m.check(ctx, r)
+		cancel()
+		if err != nil {
+			m.logger.Error("External authorization failed",
+				zap.String("url", m.config.URL),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			if m.config.FailureMode == "open" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(m.config.StatusOnError), m.config.StatusOnError)
+			return
+		}
+
+		if !decision.allowed {
+			m.logger.Debug("Request denied by external authorization",
+				zap.String("path", r.URL.Path),
+				zap.Int("status", decision.status))
+			for name, values := range decision.headers {
+				w.Header()[name] = values
+			}
+			if len(decision.body) > 0 && w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			}
+			w.WriteHeader(decision.status)
+			w.Write(decision.body)
+			return
+		}
+
+		for _, name := range decision.removeHeaders {
+			r.Header.Del(name)
+		}
+		for name, values := range decision.setHeaders {
+			r.Header[name] = values
+		}
+		for name, values := range decision.addHeaders {
+			for _, value := range values {
+				r.Header.Add(name, value)
+			}
+		}
+		for name, values := range decision.responseHeaders {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Name returns the middleware name
+func (m *ExternalAuthMiddleware) Name() string {
+	return "external_auth"
+}
+
+// checkHTTP asks an HTTP authorization service, which sees the forwarded
+// headers and the original request in X-Forwarded-* headers. A 2xx response
+// allows the request, 5xx responses are failures and any other denies it.
+func (m *ExternalAuthMiddleware) checkHTTP(ctx context.Context, r *http.Request) (*authzDecision, error) {
+	req, err := http.NewRequestWithContext(ctx, r.Method, m.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	m.forwardHeaders(r, func(name, value string) { req.Header.Add(name, value) })
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", scheme)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-For", clientip.FromRequest(r))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach authorization service: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthzResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization response: %w", err)
+	}
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("authorization service returned status %d", resp.StatusCode)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		decision := &authzDecision{status: resp.StatusCode, headers: http.Header{}, body: body}
+		for _, name := range m.config.ClientHeaders {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				decision.headers[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		if len(body) > 0 {
+			if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+				decision.headers.Set("Content-Type", contentType)
+			}
+		}
+		return decision, nil
+	}
+
+	// Clients cannot supply the headers the service vouches for
+	decision := &authzDecision{allowed: true, setHeaders: http.Header{}, removeHeaders: m.config.UpstreamHeaders}
+	for _, name := range m.config.UpstreamHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			decision.setHeaders[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return decision, nil
+}
+
+// forwardHeaders passes the values of the forwarded request headers
+func (m *ExternalAuthMiddleware) forwardHeaders(r *http.Request, add func(name, value string)) {
+	for _, name := range m.config.ForwardHeaders {
+		for _, value := range r.Header.Values(name) {
+			add(name, value)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	gotls "crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// authzCheckMethod is the gRPC method of Envoy's ext_authz API
+const authzCheckMethod = "/envoy.service.auth.v3.Authorization/Check"
+
+// authzGRPCClient calls the Check method of an authorization service over
+// HTTP/2, cleartext for http:// URLs. Messages are encoded by hand, as only a
+// few fields of the envoy.service.auth.v3 messages are used.
+type authzGRPCClient struct {
+	url       string
+	transport *http2.Transport
+}
+
+// newAuthzGRPCClient creates a client of the service at a URL
+func newAuthzGRPCClient(rawURL string) (*authzGRPCClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid external_auth url %q", rawURL)
+	}
+
+	transport := &http2.Transport{ReadIdleTimeout: 30 * time.Second}
+	switch u.Scheme {
+	case "http":
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *gotls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	case "https":
+	default:
+		return nil, fmt.Errorf("external_auth url must be http:// or https://, got %q", rawURL)
+	}
+
+	return &authzGRPCClient{
+		url:       u.Scheme + "://" + u.Host + authzCheckMethod,
+		transport: transport,
+	}, nil
+}
+
+// checkGRPC asks a gRPC authorization service. An OK status allows the
+// request; any other denies it with the service's denied response.
+func (m *ExternalAuthMiddleware) checkGRPC(ctx context.Context, r *http.Request) (*authzDecision, error) {
+	message, err := m.grpc.call(ctx, m.checkRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	return decodeCheckResponse(message)
+}
+
+// call sends a request message and returns the response message
+func (c *authzGRPCClient) call(ctx context.Context, message []byte) ([]byte, error) {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach authorization service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authorization service returned HTTP status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthzResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization response: %w", err)
+	}
+
+	// Trailers-only responses carry the status in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		message := resp.Trailer.Get("Grpc-Message")
+		if message == "" {
+			message = resp.Header.Get("Grpc-Message")
+		}
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		return nil, fmt.Errorf("authorization call failed with gRPC status %s: %s", status, message)
+	}
+
+	if len(body) < 5 {
+		return nil, fmt.Errorf("authorization service returned no message")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("authorization service returned a compressed message")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < size {
+		return nil, fmt.Errorf("authorization response is truncated")
+	}
+	return body[5 : 5+size], nil
+}
+
+// checkRequest encodes the CheckRequest of a request, carrying its
+// addresses and the forwarded headers in lowercase, as Envoy does
+func (m *ExternalAuthMiddleware) checkRequest(r *http.Request) []byte {
+	headers := map[string][]string{}
+	var names []string
+	m.forwardHeaders(r, func(name, value string) {
+		name = strings.ToLower(name)
+		if _, exists := headers[name]; !exists {
+			names = append(names, name)
+		}
+		headers[name] = append(headers[name], value)
+	})
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	var httpRequest []byte
+	httpRequest = appendString(httpRequest, 1, r.Header.Get("X-Request-ID"))
+	httpRequest = appendString(httpRequest, 2, r.Method)
+	for _, name := range names {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendString(entry, 2, strings.Join(headers[name], ","))
+		httpRequest = appendMessage(httpRequest, 3, entry)
+	}
+	httpRequest = appendString(httpRequest, 4, r.URL.RequestURI())
+	httpRequest = appendString(httpRequest, 5, r.Host)
+	httpRequest = appendString(httpRequest, 6, scheme)
+	httpRequest = appendString(httpRequest, 7, r.URL.RawQuery)
+	if r.ContentLength > 0 {
+		httpRequest = protowire.AppendTag(httpRequest, 9, protowire.VarintType)
+		httpRequest = protowire.AppendVarint(httpRequest, uint64(r.ContentLength))
+	}
+	httpRequest = appendString(httpRequest, 10, r.Proto)
+
+	now := time.Now()
+	var timestamp []byte
+	timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, uint64(now.Unix()))
+	timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, uint64(now.Nanosecond()))
+
+	var request []byte
+	request = appendMessage(request, 1, timestamp)
+	request = appendMessage(request, 2, httpRequest)
+
+	var attributes []byte
+	// The source is the client resolved with the client_ip settings, whose
+	// port is only known when it is the peer
+	source := clientip.FromRequest(r)
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && host == source {
+		source = r.RemoteAddr
+	}
+	attributes = appendMessage(attributes, 1, peerMessage(source))
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		attributes = appendMessage(attributes, 2, peerMessage(addr.String()))
+	}
+	attributes = appendMessage(attributes, 4, request)
+
+	return appendMessage(nil, 1, attributes)
+}
+
+// peerMessage encodes the Peer of a host:port address, or of a host without
+// a port
+func peerMessage(hostport string) []byte {
+	host, portText, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, portText = hostport, ""
+	}
+	var socketAddress []byte
+	socketAddress = appendString(socketAddress, 2, host)
+	if port, err := strconv.ParseUint(portText, 10, 32); err == nil {
+		socketAddress = protowire.AppendTag(socketAddress, 3, protowire.VarintType)
+		socketAddress = protowire.AppendVarint(socketAddress, port)
+	}
+	return appendMessage(nil, 1, appendMessage(nil, 1, socketAddress))
+}
+
+// decodeCheckResponse decodes a CheckResponse into a decision
+func decodeCheckResponse(message []byte) (*authzDecision, error) {
+	decision := &authzDecision{status: http.StatusForbidden, headers: http.Header{}}
+	var code uint64
+	err := decodeFields(message, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1: // status
+			return decodeFields(value, func(num protowire.Number, _ []byte, varint uint64) error {
+				if num == 1 {
+					code = varint
+				}
+				return nil
+			})
+		case 2: // denied_response
+			return decodeFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				switch num {
+				case 1:
+					return decodeFields(value, func(num protowire.Number, _ []byte, varint uint64) error {
+						if num == 1 && varint >= 100 && varint <= 599 {
+							decision.status = int(varint)
+						}
+						return nil
+					})
+				case 2:
+					return decodeHeaderOption(value, decision.headers, decision.headers)
+				case 3:
+					decision.body = append([]byte(nil), value...)
+				}
+				return nil
+			})
+		case 3: // ok_response
+			decision.setHeaders = http.Header{}
+			decision.addHeaders = http.Header{}
+			decision.responseHeaders = http.Header{}
+			return decodeFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				switch num {
+				case 2:
+					return decodeHeaderOption(value, decision.setHeaders, decision.addHeaders)
+				case 5:
+					decision.removeHeaders = append(decision.removeHeaders, string(value))
+				case 6:
+					return decodeHeaderOption(value, decision.responseHeaders, decision.responseHeaders)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization response: %w", err)
+	}
+
+	decision.allowed = code == 0
+	return decision, nil
+}
+
+// decodeHeaderOption decodes a HeaderValueOption into the headers it
+// replaces or appends to
+func decodeHeaderOption(message []byte, set, add http.Header) error {
+	var key, value string
+	appendValue, appendSet := false, false
+	var action uint64
+	err := decodeFields(message, func(num protowire.Number, field []byte, varint uint64) error {
+		switch num {
+		case 1: // header
+			return decodeFields(field, func(num protowire.Number, field []byte, _ uint64) error {
+				switch num {
+				case 1:
+					key = string(field)
+				case 2, 3: // value, raw_value
+					value = string(field)
+				}
+				return nil
+			})
+		case 2: // append
+			appendSet = true
+			return decodeFields(field, func(num protowire.Number, _ []byte, varint uint64) error {
+				if num == 1 {
+					appendValue = varint != 0
+				}
+				return nil
+			})
+		case 3: // append_action
+			action = varint
+		}
+		return nil
+	})
+	if err != nil || key == "" {
+		return err
+	}
+
+	if !appendSet {
+		switch action {
+		case 0: // APPEND_IF_EXISTS_OR_ADD
+			appendValue = true
+		case 1: // ADD_IF_ABSENT
+			if set.Get(key) != "" || add.Get(key) != "" {
+				return nil
+			}
+		}
+	}
+	if appendValue {
+		add.Add(key, value)
+	} else {
+		set.Set(key, value)
+	}
+	return nil
+}
+
+// decodeFields calls fn with the fields of a message: the contents of
+// length-delimited fields, or the value of varint fields
+func decodeFields(message []byte, fn func(num protowire.Number, value []byte, varint uint64) error) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(message)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(message)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, message)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if err := fn(num, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendString appends a string field, unless it is empty
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendMessage appends an embedded message field
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// FairnessMiddleware limits the requests served at once and, when saturated,
+// queues the rest with weighted fair queueing: each client's requests are
+// tagged with a virtual finish time that advances by 1/weight per request,
+// and the earliest tag is served first. A client sending many requests only
+// lengthens its own queue, while others keep their share of the capacity.
+type FairnessMiddleware struct {
+	logger  *zap.Logger
+	config  FairnessConfig
+	weights map[string]int
+
+	mu       sync.Mutex
+	inFlight int
+	queue    fairQueue
+	flows    map[string]*fairFlow
+	virtual  float64 // finish tag of the last dispatched request
+	sequence uint64  // orders requests with equal tags by arrival
+}
+
+// FairnessConfig holds fair queueing configuration
+type FairnessConfig = config.FairnessMiddlewareConfig
+
+// fairFlow is the queueing state of a client
+type fairFlow struct {
+	finish float64 // finish tag of the client's last queued request
+	queued int
+}
+
+// fairWaiter is a queued request
+type fairWaiter struct {
+	key      string
+	finish   float64
+	sequence uint64
+	ready    chan struct{} // closed when the request may proceed
+	index    int           // position in the heap, -1 once dispatched
+}
+
+var (
+	errQueueFull    = errors.New("queue full")
+	errQueueTimeout = errors.New("queue timeout")
+)
+
+// NewFairnessMiddleware creates a new fair queueing middleware
+func NewFairnessMiddleware(logger *zap.Logger, cfg FairnessConfig) (*FairnessMiddleware, error) {
+	weights := make(map[string]int, len(cfg.Clients))
+	for _, client := range cfg.Clients {
+		weights[client.Key] = client.Weight
+	}
+
+	return &FairnessMiddleware{
+		logger:  logger,
+		config:  cfg,
+		weights: weights,
+		flows:   make(map[string]*fairFlow),
+	}, nil
+}
+
+// Handle implements the middleware interface
+func (fm *FairnessMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := fm.getKey(r)
+		if err := fm.acquire(r.Context(), key); err != nil {
+			if r.Context().Err() != nil {
+				// The client went away while queued
+				return
+			}
+			fm.logger.Warn("Request rejected by fair queue",
+				zap.String("key", key),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		defer fm.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Name returns the middleware name
+func (fm *FairnessMiddleware) Name() string {
+	return "fairness"
+}
+
+// getKey identifies the client of a request
+func (fm *FairnessMiddleware) getKey(r *http.Request) string {
+	switch fm.config.KeyFunc {
+	case "header":
+		if key := r.Header.Get(fm.config.KeyHeader); key != "" {
+			return key
+		}
+	case "user":
+		if userID := r.Header.Get("X-User-ID"); userID != "" {
+			return userID
+		}
+	}
+
+	return clientip.FromRequest(r)
+}
+
+// weight returns the share of a client
+func (fm *FairnessMiddleware) weight(key string) int {
+	if weight, ok := fm.weights[key]; ok {
+		return weight
+	}
+	return fm.config.DefaultWeight
+}
+
+// acquire waits until a request of the client may be served
+func (fm *FairnessMiddleware) acquire(ctx context.Context, key string) error {
+	fm.mu.Lock()
+	if fm.inFlight < fm.config.MaxConcurrent && fm.queue.Len() == 0 {
+		fm.inFlight++
+		fm.mu.Unlock()
+		return nil
+	}
+
+	flow := fm.flows[key]
+	if fm.queue.Len() >= fm.config.MaxQueue || (fm.config.MaxClientQueue > 0 && flow != nil && flow.queued >= fm.config.MaxClientQueue) {
+		fm.mu.Unlock()
+		return errQueueFull
+	}
+	if flow == nil {
+		flow = &fairFlow{}
+		fm.flows[key] = flow
+	}
+
+	flow.finish = max(fm.virtual, flow.finish) + 1/float64(fm.weight(key))
+	flow.queued++
+	fm.sequence++
+	waiter := &fairWaiter{
+		key:      key,
+		finish:   flow.finish,
+		sequence: fm.sequence,
+		ready:    make(chan struct{}),
+	}
+	heap.Push(&fm.queue, waiter)
+	fm.mu.Unlock()
+
+	timer := time.NewTimer(fm.config.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if waiter.index < 0 {
+		// Dispatched while giving up; the slot is taken, so use it
+		return nil
+	}
+	heap.Remove(&fm.queue, waiter.index)
+	fm.dequeued(waiter)
+	return err
+}
+
+// release frees the slot of a finished request and dispatches queued
+// requests in order of their finish tags
+func (fm *FairnessMiddleware) release() {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	fm.inFlight--
+	for fm.inFlight < fm.config.MaxConcurrent && fm.queue.Len() > 0 {
+		waiter := heap.Pop(&fm.queue).(*fairWaiter)
+		fm.virtual = max(fm.virtual, waiter.finish)
+		fm.dequeued(waiter)
+		fm.inFlight++
+		close(waiter.ready)
+	}
+}
+
+// dequeued updates the flow of a request leaving the queue, forgetting
+// clients with nothing queued. The caller must hold the lock.
+func (fm *FairnessMiddleware) dequeued(waiter *fairWaiter) {
+	flow := fm.flows[waiter.key]
+	flow.queued--
+	if flow.queued == 0 {
+		delete(fm.flows, waiter.key)
+	}
+}
+
+// fairQueue is a min-heap of queued requests by finish tag
+type fairQueue []*fairWaiter
+
+func (q fairQueue) Len() int { return len(q) }
+
+func (q fairQueue) Less(i, j int) bool {
+	if q[i].finish != q[j].finish {
+		return q[i].finish < q[j].finish
+	}
+	return q[i].sequence < q[j].sequence
+}
+
+func (q fairQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *fairQueue) Push(x any) {
+	waiter := x.(*fairWaiter)
+	waiter.index = len(*q)
+	*q = append(*q, waiter)
+}
+
+func (q *fairQueue) Pop() any {
+	old := *q
+	waiter := old[len(old)-1]
+	old[len(old)-1] = nil
+	waiter.index = -1
+	*q = old[:len(old)-1]
+	return waiter
+}
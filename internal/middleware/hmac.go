@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// HMACMiddleware validates requests signed with a shared key. The signature
+// covers the configured components of the request, including a timestamp
+// that must be within the skew window, and every signature is only accepted
+// once.
+type HMACMiddleware struct {
+	logger  *zap.Logger
+	config  HMACConfig
+	newHash func() hash.Hash
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // signatures by when they leave the skew window
+	nextSweep time.Time
+}
+
+// HMACConfig holds request signature configuration
+type HMACConfig = config.HMACMiddlewareConfig
+
+// errHMACBodyTooLarge rejects signed bodies over max_body_size
+var errHMACBodyTooLarge = errors.New("request body exceeds max_body_size")
+
+// NewHMACMiddleware creates a request signature middleware
+func NewHMACMiddleware(logger *zap.Logger, cfg HMACConfig) (*HMACMiddleware, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, fmt.Errorf("hmac middleware requires at least one key")
+	}
+
+	m := &HMACMiddleware{logger: logger, config: cfg, seen: make(map[string]time.Time)}
+	switch cfg.Algorithm {
+	case "sha256":
+		m.newHash = sha256.New
+	case "sha512":
+		m.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported hmac algorithm: %s", cfg.Algorithm)
+	}
+	return m, nil
+}
+
+// Handle implements the middleware interface
+func (m *HMACMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, skipPath := range m.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if err := m.verify(r); err != nil {
+			m.logger.Warn("Rejected request signature",
+				zap.String("path", r.URL.Path),
+				zap.String("client_ip", clientip.FromRequest(r)),
+				zap.Error(err))
+			if errors.Is(err, errHMACBodyTooLarge) {
+				http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Name returns the middleware name
+func (m *HMACMiddleware) Name() string {
+	return "hmac"
+}
+
+// verify checks the signature, timestamp and freshness of a request
+func (m *HMACMiddleware) verify(r *http.Request) error {
+	signature, err := m.decodeSignature(r.Header.Get(m.config.SignatureHeader))
+	if err != nil {
+		return err
+	}
+
+	timestamp := r.Header.Get(m.config.TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header", m.config.TimestampHeader)
+	}
+	signedAt := time.Unix(seconds, 0)
+	now := time.Now()
+	if skew := now.Sub(signedAt); skew > m.config.MaxSkew || skew < -m.config.MaxSkew {
+		return fmt.Errorf("timestamp is outside the %s skew window", m.config.MaxSkew)
+	}
+
+	keys := m.config.Keys
+	if m.config.KeyIDHeader != "" {
+		id := r.Header.Get(m.config.KeyIDHeader)
+		keys = nil
+		for _, key := range m.config.Keys {
+			if key.ID == id {
+				keys = []config.HMACKey{key}
+				break
+			}
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("unknown key id %q", id)
+		}
+	}
+
+	payload, err := m.canonical(r, timestamp)
+	if err != nil {
+		return err
+	}
+	valid := false
+	for _, key := range keys {
+		mac := hmac.New(m.newHash, []byte(key.Secret))
+		mac.Write(payload)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("signature does not match")
+	}
+
+	// Checked last, so only valid signatures are remembered
+	if !m.remember(string(signature), signedAt.Add(m.config.MaxSkew), now) {
+		return fmt.Errorf("signature was already used")
+	}
+	return nil
+}
+
+// decodeSignature decodes a signature header, which may name the algorithm
+// as in sha256=<signature>
+func (m *HMACMiddleware) decodeSignature(value string) ([]byte, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), m.config.Algorithm+"=")
+	if value == "" {
+		return nil, fmt.Errorf("missing %s header", m.config.SignatureHeader)
+	}
+
+	var signature []byte
+	var err error
+	if m.config.Encoding == "base64" {
+		signature, err = base64.StdEncoding.DecodeString(value)
+	} else {
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", m.config.SignatureHeader, err)
+	}
+	return signature, nil
+}
+
+// canonical builds the signed payload: the components, one per line. The
+// body is signed as the hex SHA-256 digest of its bytes.
+func (m *HMACMiddleware) canonical(r *http.Request, timestamp string) ([]byte, error) {
+	var payload bytes.Buffer
+	for i, component := range m.config.Components {
+		if i > 0 {
+			payload.WriteByte('\n')
+		}
+		switch component {
+		case "method":
+			payload.WriteString(r.Method)
+		case "path":
+			payload.WriteString(r.URL.EscapedPath())
+		case "query":
+			payload.WriteString(r.URL.RawQuery)
+		case "host":
+			payload.WriteString(r.Host)
+		case "timestamp":
+			payload.WriteString(timestamp)
+		case "nonce":
+			payload.WriteString(r.Header.Get(m.config.NonceHeader))
+		case "body":
+			digest, err := m.bodyDigest(r)
+			if err != nil {
+				return nil, err
+			}
+			payload.WriteString(digest)
+		default:
+			name := strings.TrimPrefix(component, "header:")
+			payload.WriteString(strings.Join(r.Header.Values(name), ","))
+		}
+	}
+	return payload.Bytes(), nil
+}
+
+// bodyDigest reads the request body, leaving it in place for the upstream,
+// and returns its hex SHA-256 digest
+func (m *HMACMiddleware) bodyDigest(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	if r.ContentLength > m.config.MaxBodySize {
+		return "", errHMACBodyTooLarge
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(body)) > m.config.MaxBodySize {
+		return "", errHMACBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// remember records a signature until it expires, reporting false if it was
+// seen before. Expired signatures are swept once per skew window.
+func (m *HMACMiddleware) remember(signature string, expires, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.After(m.nextSweep) {
+		for seen, expiry := range m.seen {
+			if now.After(expiry) {
+				delete(m.seen, seen)
+			}
+		}
+		m.nextSweep = now.Add(m.config.MaxSkew)
+	}
+
+	if expiry, exists := m.seen[signature]; exists && !now.After(expiry) {
+		return false
+	}
+	m.seen[signature] = expires
+	return true
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
 	"sort"
@@ -47,6 +49,18 @@ func (c *Chain) Then(handler http.Handler) http.Handler {
 	return handler
 }
 
+// Close closes the middleware of the chain holding resources, such as the
+// connections of shared stores
+func (c *Chain) Close() error {
+	var errs []error
+	for _, middleware := range c.middlewares {
+		if closer, ok := middleware.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Factory creates middleware instances
 type Factory struct {
 	logger *zap.Logger
@@ -86,16 +100,41 @@ func (f *Factory) CreateChain(middlewareConfig *config.MiddlewareConfig) (*Chain
 }
 
 // Create creates a middleware instance based on type and configuration
-func (f *Factory) Create(middlewareType string, config map[string]any) (Middleware, error) {
-	switch middlewareType {
-	case "logging":
-		return NewLoggingMiddleware(f.logger, config)
-	case "rate_limit":
-		return NewRateLimitMiddleware(f.logger, config)
-	case "auth":
-		return NewAuthMiddleware(f.logger, config)
-	case "compression":
-		return NewCompressionMiddleware(f.logger, config)
+func (f *Factory) Create(middlewareType string, raw map[string]any) (Middleware, error) {
+	if instance, ok, err := createPlugin(middlewareType, raw, f.logger); ok {
+		return instance, err
+	}
+
+	typed, err := config.DecodeMiddlewareConfig(middlewareType, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s middleware config: %w", middlewareType, err)
+	}
+
+	switch cfg := typed.(type) {
+	case *config.LoggingMiddlewareConfig:
+		return NewLoggingMiddleware(f.logger, *cfg)
+	case *config.RateLimitMiddlewareConfig:
+		return NewRateLimitMiddleware(f.logger, *cfg)
+	case *config.AuthMiddlewareConfig:
+		return NewAuthMiddleware(f.logger, *cfg)
+	case *config.CompressionMiddlewareConfig:
+		return NewCompressionMiddleware(f.logger, *cfg)
+	case *config.CacheMiddlewareConfig:
+		return NewCacheMiddleware(f.logger, *cfg)
+	case *config.FairnessMiddlewareConfig:
+		return NewFairnessMiddleware(f.logger, *cfg)
+	case *config.QuotaMiddlewareConfig:
+		return NewQuotaMiddleware(f.logger, *cfg)
+	case *config.EventsMiddlewareConfig:
+		return NewEventsMiddleware(f.logger, *cfg)
+	case *config.WasmMiddlewareConfig:
+		return NewWasmMiddleware(f.logger, *cfg)
+	case *config.ExternalAuthMiddlewareConfig:
+		return NewExternalAuthMiddleware(f.logger, *cfg)
+	case *config.BasicAuthMiddlewareConfig:
+		return NewBasicAuthMiddleware(f.logger, *cfg)
+	case *config.HMACMiddlewareConfig:
+		return NewHMACMiddleware(f.logger, *cfg)
 	default:
 		return nil, fmt.Errorf("unknown middleware type: %s", middlewareType)
 	}
@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// JWKS fetching limits
+const (
+	jwksFetchTimeout   = 10 * time.Second
+	jwksMaxSize        = 1 << 20 // 1MB
+	jwksMinRefetchWait = 30 * time.Second
+)
+
+// jwksCache holds the keys published at a JWKS URL. Keys are fetched when
+// first needed, again once the refresh interval passes, and early when a
+// token names an unknown key, which is how rotated keys are picked up.
+// Requests needing keys at once share one fetch, which outlives them.
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+	flight  singleflight.Group
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey // by kid
+	fetched     time.Time
+	lastAttempt time.Time
+}
+
+// jwksCaches are shared by the auth middleware of every configuration
+// loaded, so reloads reuse fetched keys
+var (
+	jwksCachesMu sync.Mutex
+	jwksCaches   = map[string]*jwksCache{}
+)
+
+// jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// sharedJWKSCache returns the cache of a JWKS URL
+func sharedJWKSCache(url string, refresh time.Duration) *jwksCache {
+	jwksCachesMu.Lock()
+	defer jwksCachesMu.Unlock()
+
+	key := url + " " + refresh.String()
+	cache, exists := jwksCaches[key]
+	if !exists {
+		cache = &jwksCache{url: url, refresh: refresh, client: &http.Client{Timeout: jwksFetchTimeout}}
+		jwksCaches[key] = cache
+	}
+	return cache
+}
+
+// key returns the key with an ID. Tokens without a kid are verified with
+// the only key of sets holding a single one.
+func (c *jwksCache) key(ctx context.Context, kid string, logger *zap.Logger) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	key, known := c.lookup(kid)
+	due := c.due(known)
+	c.mu.Unlock()
+
+	if due {
+		select {
+		case <-c.flight.DoChan("", func() (any, error) { return nil, c.refetch(logger) }):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+		key, known = c.lookup(kid)
+		c.mu.Unlock()
+	}
+	if !known {
+		return nil, fmt.Errorf("no key with kid %q in JWKS", kid)
+	}
+	return key, nil
+}
+
+// due reports whether the keys are to be fetched, once expired or missing
+// the key looked for, but no sooner than the minimum wait after the last
+// attempt
+func (c *jwksCache) due(known bool) bool {
+	now := time.Now()
+	expired := now.Sub(c.fetched) > c.refresh
+	return (expired || !known) && now.Sub(c.lastAttempt) >= jwksMinRefetchWait
+}
+
+// refetch fetches the keys, unless another fetch just did
+func (c *jwksCache) refetch(logger *zap.Logger) error {
+	c.mu.Lock()
+	if time.Since(c.lastAttempt) < jwksMinRefetchWait {
+		c.mu.Unlock()
+		return nil
+	}
+	c.lastAttempt = time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch(context.Background())
+	if err != nil {
+		// Keys fetched before stay in use while the endpoint fails
+		logger.Error("Failed to fetch JWKS", zap.String("url", c.url), zap.Error(err))
+		return err
+	}
+	c.mu.Lock()
+	c.keys = keys
+	c.fetched = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// lookup finds a key among the fetched ones
+func (c *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, exists := c.keys[kid]
+	return key, exists
+}
+
+// fetch downloads and parses the key set. Keys of unsupported types or for
+// encryption are skipped.
+func (c *jwksCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS holds no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes an RSA, EC or OKP (Ed25519) key
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// decodeJWKInt decodes a base64url encoded big-endian integer
+func decodeJWKInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
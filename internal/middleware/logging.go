@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
 	"go.uber.org/zap"
 )
 
@@ -14,47 +16,28 @@ type LoggingMiddleware struct {
 }
 
 // LoggingConfig holds logging middleware configuration
-type LoggingConfig struct {
-	LogHeaders   bool `json:"log_headers"`
-	LogBody      bool `json:"log_body"`
-	LogRequests  bool `json:"log_requests"`
-	LogResponses bool `json:"log_responses"`
-}
+type LoggingConfig = config.LoggingMiddlewareConfig
 
 // NewLoggingMiddleware creates a new logging middleware
-func NewLoggingMiddleware(logger *zap.Logger, config map[string]any) (*LoggingMiddleware, error) {
-	loggingConfig := LoggingConfig{
-		LogRequests:  true,  // Default to true
-		LogResponses: true,  // Default to true
-		LogHeaders:   false, // Default to false
-		LogBody:      false, // Default to false
-	}
-
-	if logHeaders, ok := config["log_headers"].(bool); ok {
-		loggingConfig.LogHeaders = logHeaders
-	}
-
-	if logBody, ok := config["log_body"].(bool); ok {
-		loggingConfig.LogBody = logBody
-	}
-
-	if logRequests, ok := config["log_requests"].(bool); ok {
-		loggingConfig.LogRequests = logRequests
-	}
-
-	if logResponses, ok := config["log_responses"].(bool); ok {
-		loggingConfig.LogResponses = logResponses
-	}
-
+func NewLoggingMiddleware(logger *zap.Logger, cfg LoggingConfig) (*LoggingMiddleware, error) {
 	return &LoggingMiddleware{
 		logger: logger,
-		config: loggingConfig,
+		config: cfg,
 	}, nil
 }
 
-// Handle implements the middleware interface
+// Handle implements the middleware interface. Routes can turn logging off,
+// limit it to failed requests, or log every request and response with
+// headers.
 func (lm *LoggingMiddleware) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level := accessLogLevel(r)
+		if level == LevelOff {
+			next.ServeHTTP(w, r)
+			return
+		}
+		verbose := level == LevelVerbose
+
 		start := time.Now()
 
 		// Create a response writer that captures status code and size
@@ -65,18 +48,19 @@ func (lm *LoggingMiddleware) Handle(next http.Handler) http.Handler {
 		}
 
 		// Log request if enabled
-		if lm.config.LogRequests {
+		if (lm.config.LogRequests && level != LevelErrors) || verbose {
 			fields := []zap.Field{
 				zap.String("method", r.Method),
 				zap.String("path", r.URL.Path),
 				zap.String("query", r.URL.RawQuery),
 				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client_ip", clientip.FromRequest(r)),
 				zap.String("user_agent", r.UserAgent()),
 				zap.String("proto", r.Proto),
 				zap.String("host", r.Host),
 			}
 
-			if lm.config.LogHeaders {
+			if lm.config.LogHeaders || verbose {
 				for name, values := range r.Header {
 					for _, value := range values {
 						fields = append(fields, zap.String("header_"+name, value))
@@ -91,7 +75,7 @@ func (lm *LoggingMiddleware) Handle(next http.Handler) http.Handler {
 		next.ServeHTTP(rw, r)
 
 		// Log response if enabled
-		if lm.config.LogResponses {
+		if (lm.config.LogResponses || verbose) && (level != LevelErrors || rw.statusCode >= 400) {
 			duration := time.Since(start)
 			responseFields := []zap.Field{
 				zap.String("method", r.Method),
@@ -100,6 +84,15 @@ func (lm *LoggingMiddleware) Handle(next http.Handler) http.Handler {
 				zap.Int64("size", rw.size),
 				zap.Duration("duration", duration),
 				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client_ip", clientip.FromRequest(r)),
+			}
+
+			if verbose {
+				for name, values := range rw.Header() {
+					for _, value := range values {
+						responseFields = append(responseFields, zap.String("response_header_"+name, value))
+					}
+				}
 			}
 
 			if rw.statusCode >= 400 {
@@ -135,3 +128,10 @@ func (rw *responseWriter) Write(data []byte) (int, error) {
 	rw.size += int64(size)
 	return size, err
 }
+
+// Flush flushes the response, so streamed responses are not held back
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// Observability levels of a route
+const (
+	LevelOff     = "off"
+	LevelErrors  = "errors"
+	LevelDefault = "default"
+	LevelVerbose = "verbose"
+)
+
+// observabilityKey is the request context key of the observability
+// overrides of the route a request is for
+type observabilityKey struct{}
+
+// WithObservability attaches the observability overrides of the route a
+// request is for, which the logging and events middleware apply
+func WithObservability(r *http.Request, overrides *config.ObservabilityConfig) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), observabilityKey{}, overrides))
+}
+
+// observability returns the overrides attached to a request, if any
+func observability(r *http.Request) *config.ObservabilityConfig {
+	overrides, _ := r.Context().Value(observabilityKey{}).(*config.ObservabilityConfig)
+	return overrides
+}
+
+// accessLogLevel returns the access log level of a request
+func accessLogLevel(r *http.Request) string {
+	if o := observability(r); o != nil && o.AccessLog != "" {
+		return o.AccessLog
+	}
+	return LevelDefault
+}
+
+// eventsLevel returns the request event level of a request
+func eventsLevel(r *http.Request) string {
+	if o := observability(r); o != nil && o.Events != "" {
+		return o.Events
+	}
+	return LevelDefault
+}
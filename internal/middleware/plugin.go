@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// Plugin defines a middleware type implemented outside this package, either
+// compiled into the binary or loaded from a Go plugin listed under
+// global.plugins
+type Plugin struct {
+	// New creates a middleware from the options of a middleware definition,
+	// merged with the overrides of a route
+	New func(logger *zap.Logger, options map[string]any) (Middleware, error)
+	// Validate checks the options during configuration validation and may be
+	// nil
+	Validate func(options map[string]any) error
+	// Init runs once before the first middleware of the type is created and
+	// may be nil. A failed Init is retried on the next configuration load.
+	Init func(logger *zap.Logger) error
+	// Shutdown runs when the proxy stops, if Init ran, and may be nil
+	Shutdown func(ctx context.Context) error
+}
+
+// registeredPlugin tracks whether a plugin was initialized
+type registeredPlugin struct {
+	Plugin
+	initialized bool
+}
+
+// plugins holds the registered middleware types, by name
+var (
+	pluginsMu sync.Mutex
+	plugins   = map[string]*registeredPlugin{}
+)
+
+// Register makes a middleware type available to middleware definitions,
+// e.g. "geoip" for middleware with type: geoip. It is meant to be called from
+// an init function of the package implementing the middleware.
+func Register(name string, plugin Plugin) {
+	if plugin.New == nil {
+		panic(fmt.Sprintf("middleware plugin %s has no New function", name))
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, exists := plugins[name]; exists {
+		panic(fmt.Sprintf("middleware plugin %s registered twice", name))
+	}
+	config.RegisterMiddlewareType(name, plugin.Validate)
+	plugins[name] = &registeredPlugin{Plugin: plugin}
+}
+
+// createPlugin creates a middleware of a registered type, initializing the
+// plugin first. It reports false for types no plugin registered.
+func createPlugin(name string, options map[string]any, logger *zap.Logger) (Middleware, bool, error) {
+	pluginsMu.Lock()
+	plugin, exists := plugins[name]
+	if !exists {
+		pluginsMu.Unlock()
+		return nil, false, nil
+	}
+	if !plugin.initialized {
+		if plugin.Init != nil {
+			if err := plugin.Init(logger); err != nil {
+				pluginsMu.Unlock()
+				return nil, true, fmt.Errorf("failed to initialize %s middleware plugin: %w", name, err)
+			}
+		}
+		plugin.initialized = true
+	}
+	pluginsMu.Unlock()
+
+	if options == nil {
+		options = map[string]any{}
+	}
+	instance, err := plugin.New(logger, options)
+	return instance, true, err
+}
+
+// ShutdownPlugins runs the Shutdown hooks of the initialized plugins
+func ShutdownPlugins(ctx context.Context) error {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		plugin := plugins[name]
+		if !plugin.initialized {
+			continue
+		}
+		plugin.initialized = false
+		if plugin.Shutdown == nil {
+			continue
+		}
+		if err := plugin.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s middleware plugin: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/quota"
+	"go.uber.org/zap"
+)
+
+// QuotaMiddleware enforces daily and monthly request quotas of API keys
+type QuotaMiddleware struct {
+	logger  *zap.Logger
+	config  QuotaConfig
+	tracker *quota.Tracker
+	timeout time.Duration
+}
+
+// QuotaConfig holds API key quota configuration
+type QuotaConfig = config.QuotaMiddlewareConfig
+
+// NewQuotaMiddleware creates a new quota middleware
+func NewQuotaMiddleware(logger *zap.Logger, cfg QuotaConfig) (*QuotaMiddleware, error) {
+	tracker, err := quota.NewTracker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.StoreTimeout
+	if timeout <= 0 {
+		timeout = 200 * time.Millisecond
+	}
+	return &QuotaMiddleware{
+		logger:  logger,
+		config:  cfg,
+		tracker: tracker,
+		timeout: timeout,
+	}, nil
+}
+
+// Close releases the store of the quotas
+func (qm *QuotaMiddleware) Close() error {
+	return qm.tracker.Close()
+}
+
+// Handle implements the middleware interface
+func (qm *QuotaMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, skipPath := range qm.config.SkipPaths {
+			if strings.HasPrefix(r.URL.Path, skipPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		key := qm.extractKey(r)
+		if key == "" {
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+		plan, ok := qm.tracker.Plan(key)
+		if !ok {
+			qm.logger.Warn("Unknown API key",
+				zap.String("key", quota.MaskKey(key)),
+				zap.String("client_ip", clientip.FromRequest(r)))
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), qm.timeout)
+		defer cancel()
+
+		if qm.config.UsagePath != "" && r.URL.Path == qm.config.UsagePath {
+			qm.serveUsage(ctx, w, key, plan)
+			return
+		}
+
+		usage, allowed, err := qm.tracker.Consume(ctx, key, plan, time.Now())
+		if err != nil {
+			// Fail open so a store outage does not take the API down
+			qm.logger.Error("Failed to count request against quota", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !allowed {
+			exceeded := usage.Exceeded()
+			qm.logger.Warn("Quota exceeded",
+				zap.String("key", usage.Key),
+				zap.String("plan", plan.Name),
+				zap.String("path", r.URL.Path))
+
+			setQuotaHeaders(w.Header(), exceeded)
+			retryAfter := int64(time.Until(exceeded.Reset).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		if period := usage.Tightest(); period != nil {
+			setQuotaHeaders(w.Header(), period)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Name returns the middleware name
+func (qm *QuotaMiddleware) Name() string {
+	return "quota"
+}
+
+// extractKey returns the API key of a request, empty if there is none
+func (qm *QuotaMiddleware) extractKey(r *http.Request) string {
+	if qm.config.Header != "" {
+		if key := r.Header.Get(qm.config.Header); key != "" {
+			return key
+		}
+	}
+	if qm.config.QueryParam != "" {
+		return r.URL.Query().Get(qm.config.QueryParam)
+	}
+	return ""
+}
+
+// serveUsage reports the usage of the caller's API key
+func (qm *QuotaMiddleware) serveUsage(ctx context.Context, w http.ResponseWriter, key string, plan config.QuotaPlan) {
+	usage, err := qm.tracker.Usage(ctx, key, plan, time.Now())
+	if err != nil {
+		qm.logger.Error("Failed to read quota usage", zap.Error(err))
+		http.Error(w, "Usage unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		qm.logger.Error("Failed to write quota usage", zap.Error(err))
+	}
+}
+
+// setQuotaHeaders describes the usage of a quota period
+func setQuotaHeaders(header http.Header, period *quota.PeriodUsage) {
+	header.Set("X-Quota-Limit", strconv.FormatInt(period.Limit, 10))
+	header.Set("X-Quota-Remaining", strconv.FormatInt(*period.Remaining, 10))
+	header.Set("X-Quota-Reset", strconv.FormatInt(period.Reset.Unix(), 10))
+}
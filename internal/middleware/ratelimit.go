@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"container/list"
 	"fmt"
 	"net/http"
+	"runtime"
 	"sync"
+	"time"
 
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
@@ -13,42 +18,68 @@ import (
 type RateLimitMiddleware struct {
 	logger   *zap.Logger
 	config   RateLimitConfig
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
+	limiters *limiterSet
 }
 
 // RateLimitConfig holds rate limiting configuration
-type RateLimitConfig struct {
-	RequestsPerSecond int    `json:"requests_per_second"`
-	Burst             int    `json:"burst"`
-	KeyFunc           string `json:"key_func"` // "ip", "user", "global"
+type RateLimitConfig = config.RateLimitMiddlewareConfig
+
+// limiterSet holds the limiters of clients, most recently used first. It is
+// bounded by max_keys, and a janitor removes limiters idle for the TTL.
+type limiterSet struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	limit   rate.Limit
+	burst   int
+	order   *list.List // of *limiterEntry, most recently used first
+	items   map[string]*list.Element
+	stop    chan struct{}
 }
 
-// NewRateLimitMiddleware creates a new rate limiting middleware
-func NewRateLimitMiddleware(logger *zap.Logger, config map[string]any) (*RateLimitMiddleware, error) {
-	rateLimitConfig := RateLimitConfig{
-		RequestsPerSecond: 10.0, // Default: 10 requests per second
-		Burst:             20,   // Default: burst of 20
-		KeyFunc:           "ip", // Default: rate limit by IP
-	}
+type limiterEntry struct {
+	key        string
+	limiter    *rate.Limiter
+	lastAccess time.Time
+}
 
-	if rps, ok := config["requests_per_second"].(int); ok {
-		rateLimitConfig.RequestsPerSecond = rps
+// NewRateLimitMiddleware creates a new rate limiting middleware
+func NewRateLimitMiddleware(logger *zap.Logger, cfg RateLimitConfig) (*RateLimitMiddleware, error) {
+	if cfg.CleanupInterval <= 0 {
+		return nil, fmt.Errorf("rate_limit cleanup_interval must be positive")
 	}
 
-	if burst, ok := config["burst"].(int); ok {
-		rateLimitConfig.Burst = burst
+	// A limiter removed before its bucket refilled would hand its client a
+	// fresh burst, so limiters are kept at least until they are full again
+	ttl := cfg.TTL
+	if cfg.RequestsPerSecond > 0 {
+		if refill := time.Duration(float64(cfg.Burst) / float64(cfg.RequestsPerSecond) * float64(time.Second)); ttl < refill {
+			ttl = refill
+		}
 	}
 
-	if keyFunc, ok := config["key_func"].(string); ok {
-		rateLimitConfig.KeyFunc = keyFunc
+	limiters := &limiterSet{
+		ttl:     ttl,
+		maxKeys: cfg.MaxKeys,
+		limit:   rate.Limit(cfg.RequestsPerSecond),
+		burst:   cfg.Burst,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+		stop:    make(chan struct{}),
 	}
+	go limiters.janitor(cfg.CleanupInterval)
 
-	return &RateLimitMiddleware{
+	rlm := &RateLimitMiddleware{
 		logger:   logger,
-		config:   rateLimitConfig,
-		limiters: make(map[string]*rate.Limiter),
-	}, nil
+		config:   cfg,
+		limiters: limiters,
+	}
+	// Middleware is replaced, not closed, on reloads; the janitor stops once
+	// the middleware is no longer referenced
+	runtime.SetFinalizer(rlm, func(rlm *RateLimitMiddleware) {
+		close(rlm.limiters.stop)
+	})
+	return rlm, nil
 }
 
 // Handle implements the middleware interface
@@ -60,7 +91,7 @@ func (rlm *RateLimitMiddleware) Handle(next http.Handler) http.Handler {
 		if !limiter.Allow() {
 			rlm.logger.Warn("Rate limit exceeded",
 				zap.String("key", key),
-				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("client_ip", clientip.FromRequest(r)),
 				zap.String("path", r.URL.Path))
 
 			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", rlm.config.RequestsPerSecond))
@@ -84,61 +115,83 @@ func (rlm *RateLimitMiddleware) Name() string {
 func (rlm *RateLimitMiddleware) getKey(r *http.Request) string {
 	switch rlm.config.KeyFunc {
 	case "ip":
-		return getClientIP(r)
+		return clientip.FromRequest(r)
 	case "user":
 		// Extract user ID from JWT token or session
 		if userID := r.Header.Get("X-User-ID"); userID != "" {
 			return userID
 		}
-		return getClientIP(r) // Fallback to IP
+		return clientip.FromRequest(r) // Fallback to IP
 	case "global":
 		return "global"
 	default:
-		return getClientIP(r)
+		return clientip.FromRequest(r)
 	}
 }
 
 // getLimiter gets or creates a rate limiter for the given key
 func (rlm *RateLimitMiddleware) getLimiter(key string) *rate.Limiter {
-	rlm.mu.RLock()
-	limiter, exists := rlm.limiters[key]
-	rlm.mu.RUnlock()
-
-	if !exists {
-		rlm.mu.Lock()
-		// Double-check after acquiring write lock
-		if limiter, exists = rlm.limiters[key]; !exists {
-			limiter = rate.NewLimiter(rate.Limit(rlm.config.RequestsPerSecond), rlm.config.Burst)
-			rlm.limiters[key] = limiter
-		}
-		rlm.mu.Unlock()
+	return rlm.limiters.get(key, time.Now())
+}
+
+// Cleanup removes the limiters idle for longer than the TTL. It runs every
+// cleanup interval.
+func (rlm *RateLimitMiddleware) Cleanup() {
+	rlm.limiters.cleanup(time.Now())
+}
+
+// get returns the limiter of a key, creating it, and marks it as recently
+// used. The least recently used limiters are removed to stay within max_keys.
+func (s *limiterSet) get(key string, now time.Time) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, exists := s.items[key]; exists {
+		entry := element.Value.(*limiterEntry)
+		entry.lastAccess = now
+		s.order.MoveToFront(element)
+		return entry.limiter
 	}
 
-	return limiter
+	entry := &limiterEntry{key: key, limiter: rate.NewLimiter(s.limit, s.burst), lastAccess: now}
+	s.items[key] = s.order.PushFront(entry)
+	for s.maxKeys > 0 && s.order.Len() > s.maxKeys {
+		s.remove(s.order.Back())
+	}
+	return entry.limiter
 }
 
-// Cleanup removes old limiters (should be called periodically)
-func (rlm *RateLimitMiddleware) Cleanup() {
-	rlm.mu.Lock()
-	defer rlm.mu.Unlock()
-
-	// Remove limiters that haven't been used recently
-	// This is a simple implementation - in production, you might want
-	// to use a more sophisticated approach with TTL or LRU cache
-	for key, limiter := range rlm.limiters {
-		if limiter.Tokens() == float64(rlm.config.Burst) {
-			delete(rlm.limiters, key)
+// cleanup removes the limiters idle for longer than the TTL, which are at
+// the back of the list
+func (s *limiterSet) cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for element := s.order.Back(); element != nil; element = s.order.Back() {
+		if now.Sub(element.Value.(*limiterEntry).lastAccess) <= s.ttl {
+			return
 		}
+		s.remove(element)
 	}
 }
 
-// getClientIP extracts client IP from request
-func getClientIP(r *http.Request) string {
-	if ip := r.Header.Get("X-Real-IP"); ip != "" {
-		return ip
-	}
-	if ip := r.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip
+// remove removes a limiter
+func (s *limiterSet) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.items, element.Value.(*limiterEntry).key)
+}
+
+// janitor removes idle limiters every interval until the set is stopped
+func (s *limiterSet) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.cleanup(now)
+		}
 	}
-	return r.RemoteAddr
 }
@@ -0,0 +1,737 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+)
+
+// Exports of filter modules. Only sentinel_alloc is required.
+const (
+	wasmAllocExport      = "sentinel_alloc"      // (size u32) -> ptr u32
+	wasmConfigureExport  = "sentinel_configure"  // (ptr u32, len u32) -> status u32, 0 on success
+	wasmOnRequestExport  = "sentinel_on_request" // (ptr u32, len u32) -> result u64, ptr<<32 | len
+	wasmOnResponseExport = "sentinel_on_response"
+)
+
+// WasmMiddleware filters requests and responses with a WebAssembly module.
+// Requests and responses are passed to the module's exports as JSON, and
+// the changes it returns are applied. The module file is checked for changes
+// every reload interval, so filters can be replaced without a reload.
+// Close releases the module once the requests using it are done.
+type WasmMiddleware struct {
+	logger  *zap.Logger
+	config  WasmConfig
+	options []byte // JSON of the options passed to sentinel_configure
+
+	mu      sync.Mutex
+	filter  *wasmFilter
+	checked time.Time
+}
+
+// WasmConfig holds WebAssembly filter configuration
+type WasmConfig = config.WasmMiddlewareConfig
+
+// wasmFilter is a compiled module and a pool of its idle instances, which
+// can only run one call at a time. The filter is closed, releasing its
+// module, once it is neither current nor used by a request.
+type wasmFilter struct {
+	module     *wasmModule
+	onRequest  bool
+	onResponse bool
+
+	mu        sync.Mutex
+	instances []*wasmInstance // idle, at most maxIdle
+	maxIdle   int
+	users     int // the middleware while the filter is current, and requests
+}
+
+// wasmModule is a compiled module file, closed once no filter uses it
+type wasmModule struct {
+	compiled wazero.CompiledModule
+	path     string
+	modTime  time.Time
+	size     int64
+	users    int // filters using the module, guarded by wasmModulesMu
+}
+
+// wasmInstance is an instantiated module
+type wasmInstance struct {
+	module api.Module
+	alloc  api.Function
+}
+
+// wasmRequest is the request passed to sentinel_on_request
+type wasmRequest struct {
+	Method     string      `json:"method"`
+	Host       string      `json:"host"`
+	Path       string      `json:"path"`
+	Query      string      `json:"query"`
+	RemoteAddr string      `json:"remote_addr"` // client IP
+	Headers    http.Header `json:"headers"`
+	Body       []byte      `json:"body,omitempty"` // base64, when request_body is set
+}
+
+// wasmRequestResult holds the changes sentinel_on_request makes to a
+// request, or the response to send instead of proxying it
+type wasmRequestResult struct {
+	SetHeaders    map[string]string   `json:"set_headers"`
+	RemoveHeaders []string            `json:"remove_headers"`
+	Path          *string             `json:"path"`
+	Query         *string             `json:"query"`
+	Body          *[]byte             `json:"body"`
+	Respond       *wasmDirectResponse `json:"respond"`
+}
+
+// wasmDirectResponse is a response sent by a filter
+type wasmDirectResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    []byte            `json:"body"`
+}
+
+// wasmResponse is the response passed to sentinel_on_response
+type wasmResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body,omitempty"` // base64, when response_body is set
+}
+
+// wasmResponseResult holds the changes sentinel_on_response makes to a
+// response
+type wasmResponseResult struct {
+	Status        int               `json:"status"`
+	SetHeaders    map[string]string `json:"set_headers"`
+	RemoveHeaders []string          `json:"remove_headers"`
+	Body          *[]byte           `json:"body"`
+}
+
+// wasmRuntime is shared by all filters, and the latest compiled module of a
+// file by the filters of every configuration loaded
+var (
+	wasmRuntimeOnce sync.Once
+	wasmRuntime     wazero.Runtime
+	wasmRuntimeErr  error
+
+	wasmModulesMu sync.Mutex
+	wasmModules   = map[string]*wasmModule{}
+)
+
+// wasmLoggerKey carries the logger of a call to the log host function
+type wasmLoggerKey struct{}
+
+// NewWasmMiddleware creates a WebAssembly filter middleware, compiling the
+// module
+func NewWasmMiddleware(logger *zap.Logger, cfg WasmConfig) (*WasmMiddleware, error) {
+	options, err := json.Marshal(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wasm options: %w", err)
+	}
+
+	m := &WasmMiddleware{logger: logger, config: cfg, options: options}
+	filter, err := m.current(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	filter.release()
+	return m, nil
+}
+
+// Close releases the filter, whose module is closed once the requests using
+// it are done
+func (m *WasmMiddleware) Close() error {
+	m.mu.Lock()
+	filter := m.filter
+	m.filter = nil
+	m.mu.Unlock()
+
+	if filter != nil {
+		filter.release()
+	}
+	return nil
+}
+
+// Name returns the middleware name
+func (m *WasmMiddleware) Name() string {
+	return "wasm"
+}
+
+// Handle runs the module's request filter before the next handler and its
+// response filter on the response
+func (m *WasmMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := m.current(r.Context())
+		if err != nil {
+			m.fail(w, r, next, err)
+			return
+		}
+		defer filter.release()
+
+		if filter.onRequest {
+			respond, err := m.filterRequest(r, filter)
+			if err != nil {
+				m.fail(w, r, next, err)
+				return
+			}
+			if respond != nil {
+				for name, value := range respond.Headers {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(respond.Body)))
+				w.WriteHeader(respond.Status)
+				w.Write(respond.Body)
+				return
+			}
+		}
+
+		if !filter.onResponse {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if m.config.ResponseBody {
+			// The filter sees bodies as the upstream sends them
+			r.Header.Del("Accept-Encoding")
+		}
+		rw := &wasmResponseWriter{ResponseWriter: w, middleware: m, filter: filter, request: r, buffering: m.config.ResponseBody}
+		next.ServeHTTP(rw, r)
+		rw.finish()
+	})
+}
+
+// fail handles a filter error: the request continues unfiltered with
+// fail_open, and is rejected otherwise
+func (m *WasmMiddleware) fail(w http.ResponseWriter, r *http.Request, next http.Handler, err error) {
+	m.logger.Error("WebAssembly filter failed", zap.String("module", m.config.Module), zap.String("path", r.URL.Path), zap.Error(err))
+	if m.config.FailOpen {
+		next.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// filterRequest passes a request to sentinel_on_request and applies its
+// changes. It returns the response to send instead, if the filter made one.
+func (m *WasmMiddleware) filterRequest(r *http.Request, filter *wasmFilter) (*wasmDirectResponse, error) {
+	req := wasmRequest{
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		RemoteAddr: clientip.FromRequest(r),
+		Headers:    r.Header,
+	}
+	if m.config.RequestBody && r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		// Larger bodies are passed on without being filtered
+		if int64(len(body)) <= m.config.MaxBodySize {
+			req.Body = body
+		}
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	}
+
+	var result wasmRequestResult
+	if err := m.call(r.Context(), filter, wasmOnRequestExport, req, &result); err != nil {
+		return nil, err
+	}
+	if result.Respond != nil {
+		if result.Respond.Status == 0 {
+			result.Respond.Status = http.StatusOK
+		}
+		return result.Respond, nil
+	}
+
+	for _, name := range result.RemoveHeaders {
+		r.Header.Del(name)
+	}
+	for name, value := range result.SetHeaders {
+		r.Header.Set(name, value)
+	}
+	if result.Path != nil {
+		r.URL.Path = *result.Path
+		r.URL.RawPath = ""
+	}
+	if result.Query != nil {
+		r.URL.RawQuery = *result.Query
+	}
+	if result.Body != nil && req.Body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(*result.Body))
+		r.ContentLength = int64(len(*result.Body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(*result.Body)))
+	}
+	return nil, nil
+}
+
+// readCloser reads from one reader and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// current returns the filter of the module file, compiling it again when
+// the file changed. A module that fails to compile keeps the previous one.
+// The caller must release the filter once done with it.
+func (m *WasmMiddleware) current(ctx context.Context) (*wasmFilter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter, err := m.refresh(ctx)
+	if err != nil {
+		if m.filter == nil {
+			return nil, err
+		}
+		m.logger.Error("Failed to reload WebAssembly module, keeping the previous one", zap.String("module", m.config.Module), zap.Error(err))
+	}
+	if filter != nil {
+		if m.filter != nil {
+			m.logger.Info("Reloaded WebAssembly module", zap.String("module", m.config.Module))
+			// Requests in flight close it once done
+			m.filter.release()
+		}
+		m.filter = filter
+	}
+	m.filter.acquire()
+	return m.filter, nil
+}
+
+// refresh returns a filter of the module file if it changed since the
+// current filter was created, nil if it did not or was checked recently
+func (m *WasmMiddleware) refresh(ctx context.Context) (*wasmFilter, error) {
+	if m.filter != nil && time.Since(m.checked) < m.config.ReloadInterval {
+		return nil, nil
+	}
+	m.checked = time.Now()
+
+	module, err := loadWasmModule(ctx, m.config.Module)
+	if err != nil {
+		return nil, err
+	}
+	if m.filter != nil && m.filter.module == module {
+		module.release()
+		return nil, nil
+	}
+
+	exports := module.compiled.ExportedFunctions()
+	if _, ok := exports[wasmAllocExport]; !ok {
+		module.release()
+		return nil, fmt.Errorf("wasm module %s does not export %s", m.config.Module, wasmAllocExport)
+	}
+	_, onRequest := exports[wasmOnRequestExport]
+	_, onResponse := exports[wasmOnResponseExport]
+	filter := &wasmFilter{module: module, onRequest: onRequest, onResponse: onResponse, maxIdle: runtime.GOMAXPROCS(0), users: 1}
+
+	// Instantiating once checks that the module accepts its options
+	instance, err := m.instantiate(ctx, filter)
+	if err != nil {
+		module.release()
+		return nil, err
+	}
+	filter.put(instance)
+	return filter, nil
+}
+
+// get takes an idle instance, nil if there is none
+func (f *wasmFilter) get() *wasmInstance {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.instances)
+	if n == 0 {
+		return nil
+	}
+	instance := f.instances[n-1]
+	f.instances = f.instances[:n-1]
+	return instance
+}
+
+// put returns an instance to the pool, closing it when the pool is full
+func (f *wasmFilter) put(instance *wasmInstance) {
+	f.mu.Lock()
+	if len(f.instances) < f.maxIdle {
+		f.instances = append(f.instances, instance)
+		instance = nil
+	}
+	f.mu.Unlock()
+	if instance != nil {
+		instance.module.Close(context.Background())
+	}
+}
+
+// acquire adds a user of the filter
+func (f *wasmFilter) acquire() {
+	f.mu.Lock()
+	f.users++
+	f.mu.Unlock()
+}
+
+// release drops a user of the filter. The last one closes the idle
+// instances and releases the module.
+func (f *wasmFilter) release() {
+	f.mu.Lock()
+	f.users--
+	if f.users > 0 {
+		f.mu.Unlock()
+		return
+	}
+	instances := f.instances
+	f.instances = nil
+	f.mu.Unlock()
+
+	for _, instance := range instances {
+		instance.module.Close(context.Background())
+	}
+	f.module.release()
+}
+
+// release drops a filter using the module. The last one closes it and, if
+// it is still the latest module of its file, forgets it.
+func (m *wasmModule) release() {
+	wasmModulesMu.Lock()
+	m.users--
+	if m.users > 0 {
+		wasmModulesMu.Unlock()
+		return
+	}
+	if wasmModules[m.path] == m {
+		delete(wasmModules, m.path)
+	}
+	wasmModulesMu.Unlock()
+
+	m.compiled.Close(context.Background())
+}
+
+// loadWasmModule returns the compiled module of a file, compiling it when
+// the file is new or changed. The caller must release the module.
+func loadWasmModule(ctx context.Context, path string) (*wasmModule, error) {
+	runtime, err := sharedWasmRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm module: %w", err)
+	}
+
+	wasmModulesMu.Lock()
+	defer wasmModulesMu.Unlock()
+	if module, ok := wasmModules[path]; ok && module.modTime.Equal(info.ModTime()) && module.size == info.Size() {
+		module.users++
+		return module, nil
+	}
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm module: %w", err)
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile wasm module %s: %w", path, err)
+	}
+	// Filters still using the previous module close it once done
+	module := &wasmModule{compiled: compiled, path: path, modTime: info.ModTime(), size: info.Size(), users: 1}
+	wasmModules[path] = module
+	return module, nil
+}
+
+// sharedWasmRuntime creates the runtime with the WASI and sentinel host
+// modules on first use
+func sharedWasmRuntime() (wazero.Runtime, error) {
+	wasmRuntimeOnce.Do(func() {
+		ctx := context.Background()
+		// Calls that time out close their instance
+		runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+		if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+			wasmRuntimeErr = fmt.Errorf("failed to instantiate WASI: %w", err)
+			return
+		}
+		_, err := runtime.NewHostModuleBuilder("sentinel").
+			NewFunctionBuilder().WithFunc(wasmLog).Export("log").
+			Instantiate(ctx)
+		if err != nil {
+			wasmRuntimeErr = fmt.Errorf("failed to instantiate host functions: %w", err)
+			return
+		}
+		wasmRuntime = runtime
+	})
+	return wasmRuntime, wasmRuntimeErr
+}
+
+// wasmLog is the sentinel.log host function, (level u32, ptr u32, len u32),
+// logging a message at debug (0), info (1), warn (2) or error (3) level
+func wasmLog(ctx context.Context, module api.Module, level, ptr, length uint32) {
+	logger, ok := ctx.Value(wasmLoggerKey{}).(*zap.Logger)
+	if !ok {
+		return
+	}
+	message, ok := module.Memory().Read(ptr, length)
+	if !ok {
+		return
+	}
+	switch level {
+	case 0:
+		logger.Debug(string(message))
+	case 1:
+		logger.Info(string(message))
+	case 2:
+		logger.Warn(string(message))
+	default:
+		logger.Error(string(message))
+	}
+}
+
+// instantiate creates an instance of a filter's module and passes it the
+// options
+func (m *WasmMiddleware) instantiate(ctx context.Context, filter *wasmFilter) (*wasmInstance, error) {
+	runtime, err := sharedWasmRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, wasmLoggerKey{}, m.logger.With(zap.String("module", m.config.Module)))
+	// Anonymous instances let a module be instantiated many times;
+	// reactor modules initialize themselves in _initialize
+	module, err := runtime.InstantiateModule(ctx, filter.module.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate wasm module: %w", err)
+	}
+	instance := &wasmInstance{module: module, alloc: module.ExportedFunction(wasmAllocExport)}
+
+	if configure := module.ExportedFunction(wasmConfigureExport); configure != nil {
+		ptr, err := instance.write(ctx, m.options)
+		if err != nil {
+			module.Close(ctx)
+			return nil, err
+		}
+		results, err := configure.Call(ctx, uint64(ptr), uint64(len(m.options)))
+		if err != nil {
+			module.Close(ctx)
+			return nil, fmt.Errorf("%s failed: %w", wasmConfigureExport, err)
+		}
+		if len(results) > 0 && uint32(results[0]) != 0 {
+			module.Close(ctx)
+			return nil, fmt.Errorf("wasm module rejected its options with status %d", uint32(results[0]))
+		}
+	}
+	return instance, nil
+}
+
+// call passes a JSON document to an export of the module and decodes the
+// JSON document it returns into result. An export returning 0 makes no
+// changes.
+func (m *WasmMiddleware) call(ctx context.Context, filter *wasmFilter, export string, input, result any) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	instance := filter.get()
+	if instance == nil {
+		if instance, err = m.instantiate(ctx, filter); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, wasmLoggerKey{}, m.logger.With(zap.String("module", m.config.Module)))
+
+	output, err := instance.call(ctx, export, payload)
+	if err != nil {
+		// The instance may be in any state after a trap or timeout
+		instance.module.Close(context.Background())
+		return err
+	}
+	filter.put(instance)
+
+	if output == nil {
+		return nil
+	}
+	if err := json.Unmarshal(output, result); err != nil {
+		return fmt.Errorf("invalid result of %s: %w", export, err)
+	}
+	return nil
+}
+
+// call runs an export with a payload and returns a copy of its result, or
+// nil for no result
+func (i *wasmInstance) call(ctx context.Context, export string, payload []byte) ([]byte, error) {
+	function := i.module.ExportedFunction(export)
+	if function == nil {
+		return nil, nil
+	}
+	ptr, err := i.write(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	results, err := function.Call(ctx, uint64(ptr), uint64(len(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", export, err)
+	}
+	if len(results) == 0 || results[0] == 0 {
+		return nil, nil
+	}
+
+	resultPtr, resultLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := i.module.Memory().Read(resultPtr, resultLen)
+	if !ok {
+		return nil, fmt.Errorf("%s returned a result outside of memory", export)
+	}
+	return bytes.Clone(output), nil
+}
+
+// write copies data into a buffer allocated by the module. The module owns
+// the buffer from then on.
+func (i *wasmInstance) write(ctx context.Context, data []byte) (uint32, error) {
+	results, err := i.alloc.Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("%s failed: %w", wasmAllocExport, err)
+	}
+	ptr := uint32(results[0])
+	if !i.module.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("%s returned a buffer outside of memory", wasmAllocExport)
+	}
+	return ptr, nil
+}
+
+// wasmResponseWriter passes a response to sentinel_on_response before it is
+// sent. With response_body, the body is buffered up to max_body_size; larger
+// responses are filtered without their body.
+type wasmResponseWriter struct {
+	http.ResponseWriter
+	middleware *WasmMiddleware
+	filter     *wasmFilter
+	request    *http.Request
+	buffering  bool
+
+	status    int
+	committed bool // the status and headers were sent
+	failed    bool // the filter failed and an error was sent instead
+	body      bytes.Buffer
+}
+
+// WriteHeader records the status, filtering the response at once unless
+// its body is buffered
+func (w *wasmResponseWriter) WriteHeader(statusCode int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = statusCode
+	if !w.buffering {
+		w.commit(nil)
+	}
+}
+
+// Write buffers or sends the body
+func (w *wasmResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return len(data), nil
+	}
+	if w.committed {
+		return w.ResponseWriter.Write(data)
+	}
+
+	if int64(w.body.Len()+len(data)) <= w.middleware.config.MaxBodySize {
+		return w.body.Write(data)
+	}
+	// Too large to filter: send what was buffered and stream the rest
+	w.buffering = false
+	w.commit(nil)
+	if w.failed {
+		return len(data), nil
+	}
+	if w.body.Len() > 0 {
+		if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+			return 0, err
+		}
+		w.body.Reset()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends what was written once the response is no longer buffered
+func (w *wasmResponseWriter) Flush() {
+	if !w.committed {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish filters and sends a buffered response once the handler returns
+func (w *wasmResponseWriter) finish() {
+	if w.committed || w.failed {
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	body := w.body.Bytes()
+	if body == nil {
+		body = []byte{}
+	}
+	body = w.commit(body)
+	if !w.failed {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// commit passes the status, headers and, if given, body to the filter and
+// sends the status and headers it returns. It returns the body to send.
+func (w *wasmResponseWriter) commit(body []byte) []byte {
+	header := w.ResponseWriter.Header()
+	resp := wasmResponse{Status: w.status, Headers: header, Body: body}
+
+	var result wasmResponseResult
+	if err := w.middleware.call(w.request.Context(), w.filter, wasmOnResponseExport, resp, &result); err != nil {
+		w.middleware.logger.Error("WebAssembly response filter failed", zap.String("module", w.middleware.config.Module), zap.String("path", w.request.URL.Path), zap.Error(err))
+		if !w.middleware.config.FailOpen {
+			w.failed = true
+			header.Del("Content-Length")
+			header.Del("Content-Encoding")
+			http.Error(w.ResponseWriter, "Internal Server Error", http.StatusInternalServerError)
+			return nil
+		}
+		result = wasmResponseResult{}
+	}
+
+	for _, name := range result.RemoveHeaders {
+		header.Del(name)
+	}
+	for name, value := range result.SetHeaders {
+		header.Set(name, value)
+	}
+	if result.Status != 0 {
+		w.status = result.Status
+	}
+	if result.Body != nil && body != nil {
+		body = *result.Body
+	}
+	if body != nil {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	w.committed = true
+	w.ResponseWriter.WriteHeader(w.status)
+	return body
+}
@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// Reload event names
+const (
+	ReloadSucceeded = "reload.succeeded"
+	ReloadFailed    = "reload.failed"
+)
+
+// retryBackoff is the wait before the first retry of a failed delivery,
+// doubled for every further retry
+const retryBackoff = time.Second
+
+// ReloadEvent is the payload of a reload webhook
+type ReloadEvent struct {
+	Event        string    `json:"event"`
+	Time         time.Time `json:"time"`
+	Instance     string    `json:"instance"`
+	Source       string    `json:"source"`
+	Reason       string    `json:"reason"`
+	ConfigHash   string    `json:"config_hash,omitempty"`   // configuration that was applied or rejected
+	ActiveHash   string    `json:"active_hash,omitempty"`   // configuration in effect afterwards
+	Version      int       `json:"version,omitempty"`       // history version of an applied configuration
+	Error        string    `json:"error,omitempty"`         // summary of a failure
+	Errors       []string  `json:"errors,omitempty"`        // individual validation problems
+	ChangesCount int       `json:"changes_count,omitempty"` // changes made by an applied configuration
+}
+
+// Notifier delivers events to webhooks in the background, so slow
+// receivers never hold up the proxy
+type Notifier struct {
+	instance string
+	source   string
+	client   *http.Client
+	logger   *zap.Logger
+}
+
+// NewNotifier creates a notifier for the instance loading configuration from
+// source
+func NewNotifier(source string, logger *zap.Logger) *Notifier {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	return &Notifier{
+		instance: instance,
+		source:   source,
+		client:   &http.Client{},
+		logger:   logger,
+	}
+}
+
+// Succeeded reports an applied configuration to the webhooks subscribed to
+// successes
+func (n *Notifier) Succeeded(webhooks []config.WebhookConfig, reason string, snapshot *config.Snapshot, changes int) {
+	event := ReloadEvent{
+		Event:        ReloadSucceeded,
+		Reason:       reason,
+		ConfigHash:   snapshot.Hash,
+		ActiveHash:   snapshot.Hash,
+		Version:      snapshot.Version,
+		ChangesCount: changes,
+	}
+	n.stamp(&event)
+	n.send(webhooks, "success", event.Event, event)
+}
+
+// Failed reports a configuration that was not applied to the webhooks
+// subscribed to failures. configHash is empty if the configuration could not
+// be loaded at all.
+func (n *Notifier) Failed(webhooks []config.WebhookConfig, reason, configHash, activeHash string, err error) {
+	event := ReloadEvent{
+		Event:      ReloadFailed,
+		Reason:     reason,
+		ConfigHash: configHash,
+		ActiveHash: activeHash,
+		Error:      err.Error(),
+	}
+	var validation config.ValidationErrors
+	if errors.As(err, &validation) {
+		for _, problem := range validation {
+			event.Errors = append(event.Errors, problem.Error())
+		}
+		event.Error = fmt.Sprintf("configuration validation failed with %d error(s)", len(validation))
+	}
+	n.stamp(&event)
+	n.send(webhooks, "failure", event.Event, event)
+}
+
+// stamp fills in when and where a reload event happened
+func (n *Notifier) stamp(event *ReloadEvent) {
+	event.Time = time.Now().UTC()
+	event.Instance = n.instance
+	event.Source = n.source
+}
+
+// send delivers a payload to every webhook subscribed to the outcome
+func (n *Notifier) send(webhooks []config.WebhookConfig, outcome, event string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.logger.Error("Failed to encode webhook payload", zap.String("event", event), zap.Error(err))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !slices.Contains(webhook.Events, outcome) {
+			continue
+		}
+		go n.deliver(webhook, event, body)
+	}
+}
+
+// deliver posts a payload to a webhook, retrying with backoff on errors and
+// 5xx responses
+func (n *Notifier) deliver(webhook config.WebhookConfig, event string, body []byte) {
+	backoff := retryBackoff
+	var err error
+	for attempt := 1; attempt <= webhook.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var retry bool
+		if retry, err = n.post(webhook, event, body); err == nil {
+			n.logger.Debug("Delivered webhook", zap.String("url", webhook.URL), zap.String("event", event))
+			return
+		}
+		if !retry {
+			break
+		}
+	}
+	n.logger.Warn("Failed to deliver webhook",
+		zap.String("url", webhook.URL),
+		zap.String("event", event),
+		zap.Error(err))
+}
+
+// post sends a payload once, reporting whether a failure is worth retrying
+func (n *Notifier) post(webhook config.WebhookConfig, event string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sentinel-webhook")
+	req.Header.Set("X-Sentinel-Event", event)
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+	if webhook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(webhook.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Sentinel-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return false, nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/slo"
+)
+
+// SLO event names
+const (
+	SLOBurnFiring   = "slo.burn.firing"
+	SLOBurnResolved = "slo.burn.resolved"
+)
+
+// SLOEvent is the payload of an SLO webhook
+type SLOEvent struct {
+	Event                string    `json:"event"`
+	Time                 time.Time `json:"time"`
+	Instance             string    `json:"instance"`
+	SLO                  string    `json:"slo"`
+	Objective            string    `json:"objective"` // availability or latency
+	Target               float64   `json:"target"`
+	Alert                string    `json:"alert"`
+	BurnRate             float64   `json:"burn_rate"` // burn rate the alert fires at
+	LongWindow           string    `json:"long_window"`
+	ShortWindow          string    `json:"short_window"`
+	LongBurnRate         float64   `json:"long_burn_rate"`
+	ShortBurnRate        float64   `json:"short_burn_rate"`
+	ErrorBudgetRemaining float64   `json:"error_budget_remaining"`
+	Since                time.Time `json:"since"` // when the alert started firing
+}
+
+// SLOAlert reports a burn rate alert that started or stopped firing to the
+// webhooks subscribed to it
+func (n *Notifier) SLOAlert(webhooks []config.WebhookConfig, alert slo.Alert) {
+	event := SLOEvent{
+		Event:                SLOBurnResolved,
+		Time:                 time.Now().UTC(),
+		Instance:             n.instance,
+		SLO:                  alert.SLO,
+		Objective:            alert.Objective,
+		Target:               alert.Target,
+		Alert:                alert.Alert,
+		BurnRate:             alert.BurnRate,
+		LongWindow:           alert.LongWindow.String(),
+		ShortWindow:          alert.ShortWindow.String(),
+		LongBurnRate:         alert.LongBurnRate,
+		ShortBurnRate:        alert.ShortBurnRate,
+		ErrorBudgetRemaining: alert.ErrorBudgetRemaining,
+		Since:                alert.Since.UTC(),
+	}
+	outcome := "resolved"
+	if alert.Firing {
+		event.Event = SLOBurnFiring
+		outcome = "firing"
+	}
+	n.send(webhooks, outcome, event.Event, event)
+}
@@ -0,0 +1,401 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/router"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a decoded OpenAPI document
+type Document = map[string]any
+
+// Source is the OpenAPI document of an upstream and the routes to it
+type Source struct {
+	Upstream string
+	Document Document
+	Routes   []config.RouteRule // routes to the upstream, in evaluation order
+}
+
+// renamedComponents are the component sections whose entries are prefixed
+// with their upstream's name, so equally named components of different
+// upstreams do not collide. Security schemes keep their names because
+// security requirements refer to them by name rather than by $ref.
+var renamedComponents = map[string]bool{
+	"schemas":       true,
+	"responses":     true,
+	"parameters":    true,
+	"examples":      true,
+	"requestBodies": true,
+	"headers":       true,
+	"links":         true,
+	"callbacks":     true,
+	"pathItems":     true,
+}
+
+// operationMethods are the keys of a path item holding operations
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Parse decodes an OpenAPI 3 document in JSON or YAML
+func Parse(data []byte) (Document, error) {
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		if err := yaml.Unmarshal(data, &decoded); err != nil {
+			return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+		}
+		decoded = normalize(decoded)
+	}
+
+	doc, ok := decoded.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid OpenAPI document: not an object")
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q, only OpenAPI 3 documents can be merged", version)
+	}
+	return doc, nil
+}
+
+// Merge combines the documents of upstreams into one document whose paths
+// are those the proxy routes to them. Paths that no route leads to are left
+// out. Merge reports what it could not merge as warnings.
+func Merge(title string, sources []Source) (Document, []string) {
+	paths := make(map[string]any)
+	components := make(map[string]any)
+	var tags []any
+	seenTags := make(map[string]bool)
+	var warnings []string
+	version := "3.0.3"
+
+	for _, source := range sources {
+		doc := clone(source.Document).(map[string]any)
+		prefix := componentPrefix(source.Upstream)
+		renameRefs(doc, prefix)
+
+		if v, _ := doc["openapi"].(string); strings.HasPrefix(v, "3.1") {
+			version = "3.1.0"
+		}
+
+		sections, _ := doc["components"].(map[string]any)
+		for _, section := range sortedKeys(sections) {
+			entries, ok := sections[section].(map[string]any)
+			if !ok {
+				continue
+			}
+			merged, _ := components[section].(map[string]any)
+			if merged == nil {
+				merged = make(map[string]any)
+				components[section] = merged
+			}
+			for _, name := range sortedKeys(entries) {
+				key := name
+				if renamedComponents[section] {
+					key = prefix + name
+				}
+				if _, exists := merged[key]; exists {
+					warnings = append(warnings, fmt.Sprintf("%s: components.%s.%s already defined by another upstream", source.Upstream, section, name))
+					continue
+				}
+				merged[key] = entries[name]
+			}
+		}
+
+		docTags, _ := doc["tags"].([]any)
+		for _, tag := range docTags {
+			tagObject, _ := tag.(map[string]any)
+			name, _ := tagObject["name"].(string)
+			if name == "" || seenTags[name] {
+				continue
+			}
+			seenTags[name] = true
+			tags = append(tags, tag)
+		}
+
+		base := serverBasePath(doc)
+		security, hasSecurity := doc["security"]
+		docPaths, _ := doc["paths"].(map[string]any)
+		routed := 0
+		for _, specPath := range sortedKeys(docPaths) {
+			item, ok := docPaths[specPath].(map[string]any)
+			if !ok {
+				continue
+			}
+			proxyPath, rule, ok := proxyPathFor(source.Routes, base+specPath)
+			if !ok {
+				continue
+			}
+
+			item = routedOperations(item, rule.Methods)
+			if item == nil {
+				continue
+			}
+			for _, method := range operationMethods {
+				operation, ok := item[method].(map[string]any)
+				if !ok {
+					continue
+				}
+				operation["x-sentinel-upstream"] = source.Upstream
+				if _, ok := operation["security"]; !ok && hasSecurity {
+					operation["security"] = security
+				}
+			}
+			// Wildcard and regex hosts name no single server
+			if rule.Host != "" && !strings.HasPrefix(rule.Host, "*.") && !strings.HasPrefix(rule.Host, "~") {
+				item["servers"] = []any{map[string]any{"url": "//" + rule.Host}}
+			}
+
+			existing, _ := paths[proxyPath].(map[string]any)
+			if existing == nil {
+				paths[proxyPath] = item
+				routed++
+				continue
+			}
+			for _, method := range operationMethods {
+				if _, ok := item[method]; !ok {
+					continue
+				}
+				if _, ok := existing[method]; ok {
+					warnings = append(warnings, fmt.Sprintf("%s: %s %s already provided by another upstream", source.Upstream, strings.ToUpper(method), proxyPath))
+					continue
+				}
+				existing[method] = item[method]
+				routed++
+			}
+		}
+		if routed == 0 && len(docPaths) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no path of the document is routed to the upstream", source.Upstream))
+		}
+	}
+
+	upstreams := make([]string, len(sources))
+	for i, source := range sources {
+		upstreams[i] = source.Upstream
+	}
+	merged := Document{
+		"openapi": version,
+		"info": map[string]any{
+			"title":       title,
+			"version":     "1.0.0",
+			"description": "Merged from the OpenAPI documents of: " + strings.Join(upstreams, ", "),
+		},
+		"servers": []any{map[string]any{"url": "/"}},
+		"paths":   paths,
+	}
+	if len(components) > 0 {
+		merged["components"] = components
+	}
+	if len(tags) > 0 {
+		merged["tags"] = tags
+	}
+	return merged, warnings
+}
+
+// proxyPathFor returns the path the proxy routes to an upstream path, by
+// reversing the rewrite of the first route leading to it. Routes rewriting
+// with a regular expression cannot be reversed and are passed over.
+func proxyPathFor(routes []config.RouteRule, upstreamPath string) (string, *config.RouteRule, bool) {
+	for i := range routes {
+		rule := &routes[i]
+		rewrite := rule.Rewrite
+		if rewrite.Regex != "" && rewrite.Replacement != "" {
+			continue
+		}
+
+		path := upstreamPath
+		if rewrite.AddPrefix != "" {
+			if !strings.HasPrefix(path, rewrite.AddPrefix+"/") {
+				continue
+			}
+			path = strings.TrimPrefix(path, rewrite.AddPrefix)
+		}
+		if rewrite.StripPrefix != "" {
+			path = rewrite.StripPrefix + path
+		}
+
+		if routeMatches(rule.Path, path) {
+			return path, rule, true
+		}
+	}
+	return "", nil, false
+}
+
+// routeMatches reports whether a route path matches a document path.
+// Templated segments such as {id} match route parameters.
+func routeMatches(routePath, path string) bool {
+	if routePath == "" {
+		return true
+	}
+	return router.MatchPath(routePath, path)
+}
+
+// routedOperations returns the path item with only the operations a route
+// restricted to methods accepts, or nil if none remains
+func routedOperations(item map[string]any, methods []string) map[string]any {
+	if len(methods) == 0 {
+		return item
+	}
+
+	filtered := make(map[string]any, len(item))
+	found := false
+	for key, value := range item {
+		isOperation := false
+		for _, method := range operationMethods {
+			if key == method {
+				isOperation = true
+				break
+			}
+		}
+		if !isOperation {
+			filtered[key] = value
+			continue
+		}
+		for _, method := range methods {
+			if strings.EqualFold(method, key) {
+				filtered[key] = value
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return filtered
+}
+
+// serverBasePath returns the path of the first server URL, which the paths
+// of the document are relative to
+func serverBasePath(doc Document) string {
+	servers, _ := doc["servers"].([]any)
+	if len(servers) == 0 {
+		return ""
+	}
+	server, _ := servers[0].(map[string]any)
+	raw, _ := server["url"].(string)
+	if strings.Contains(raw, "{") {
+		// Templated URLs would need their variables resolved
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// componentPrefix returns the prefix of an upstream's component names,
+// limited to the characters OpenAPI allows in them
+func componentPrefix(upstream string) string {
+	var b strings.Builder
+	for _, c := range upstream {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String() + "."
+}
+
+// renameRefs points local component references, including discriminator
+// mappings, to the prefixed component names
+func renameRefs(value any, prefix string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			switch key {
+			case "$ref":
+				if ref, ok := child.(string); ok {
+					v[key] = renameRef(ref, prefix)
+				}
+			case "mapping":
+				if mapping, ok := child.(map[string]any); ok {
+					for name, target := range mapping {
+						if ref, ok := target.(string); ok {
+							mapping[name] = renameRef(ref, prefix)
+						}
+					}
+				}
+			default:
+				renameRefs(child, prefix)
+			}
+		}
+	case []any:
+		for _, child := range v {
+			renameRefs(child, prefix)
+		}
+	}
+}
+
+// renameRef prefixes the component name of a local reference
+func renameRef(ref, prefix string) string {
+	rest, ok := strings.CutPrefix(ref, "#/components/")
+	if !ok {
+		return ref
+	}
+	section, name, ok := strings.Cut(rest, "/")
+	if !ok || !renamedComponents[section] {
+		return ref
+	}
+	return "#/components/" + section + "/" + prefix + name
+}
+
+// clone deep-copies a decoded document
+func clone(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, child := range v {
+			copied[key] = clone(child)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, child := range v {
+			copied[i] = clone(child)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// normalize converts mappings decoded from YAML with non-string keys, such
+// as response codes, to JSON objects
+func normalize(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = normalize(child)
+		}
+		return v
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, child := range v {
+			converted[fmt.Sprint(key)] = normalize(child)
+		}
+		return converted
+	case []any:
+		for i, child := range v {
+			v[i] = normalize(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
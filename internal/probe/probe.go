@@ -0,0 +1,273 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/health"
+	"go.uber.org/zap"
+)
+
+// DefaultTimeout bounds each individual probe
+const DefaultTimeout = 5 * time.Second
+
+// Kinds of checks performed by a probe
+const (
+	CheckDNS         = "dns"
+	CheckConnect     = "connect"
+	CheckHealth      = "health"
+	CheckCertificate = "certificate"
+)
+
+// Result is the outcome of a single check
+type Result struct {
+	Check    string
+	Subject  string
+	Detail   string
+	Err      error
+	Duration time.Duration
+}
+
+// OK reports whether the check passed
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+// Prober checks that the environment referenced by a configuration is
+// reachable: target hostnames resolve, targets accept connections, health
+// endpoints respond and certificate files load
+type Prober struct {
+	timeout  time.Duration
+	logger   *zap.Logger
+	resolver *net.Resolver
+	client   *http.Client
+}
+
+// NewProber creates a new prober
+func NewProber(timeout time.Duration, logger *zap.Logger) *Prober {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Prober{
+		timeout:  timeout,
+		logger:   logger,
+		resolver: net.DefaultResolver,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+			},
+		},
+	}
+}
+
+// Run probes every upstream target and certificate in the configuration
+func (p *Prober) Run(ctx context.Context, cfg *config.Config) []Result {
+	var (
+		results []Result
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	add := func(batch []Result) {
+		mu.Lock()
+		results = append(results, batch...)
+		mu.Unlock()
+	}
+
+	for name, service := range cfg.Upstreams.Services {
+		for _, target := range service.AllTargets() {
+			// Discovered targets only resolve to endpoints inside the proxy
+			if config.IsDynamicTarget(target.URL) {
+				continue
+			}
+			wg.Add(1)
+			go func(name string, service config.UpstreamService, targetURL string) {
+				defer wg.Done()
+				add(p.probeTarget(ctx, name, &service, targetURL))
+			}(name, service, target.URL)
+		}
+	}
+
+	if cfg.TLS.Enabled {
+		for _, cert := range cfg.TLS.Certificates {
+			add([]Result{p.probeCertificate(cert)})
+		}
+	}
+
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Subject != results[j].Subject {
+			return results[i].Subject < results[j].Subject
+		}
+		return checkOrder(results[i].Check) < checkOrder(results[j].Check)
+	})
+
+	return results
+}
+
+// probeTarget resolves, connects to and health checks a single target
+func (p *Prober) probeTarget(ctx context.Context, upstream string, service *config.UpstreamService, targetURL string) []Result {
+	subject := fmt.Sprintf("%s %s", upstream, targetURL)
+
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return []Result{{Check: CheckDNS, Subject: subject, Err: fmt.Errorf("invalid target URL: %w", err)}}
+	}
+
+	var results []Result
+
+	// Resolve hostname
+	start := time.Now()
+	lookupCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	addrs, err := p.resolver.LookupHost(lookupCtx, parsed.Hostname())
+	cancel()
+	result := Result{Check: CheckDNS, Subject: subject, Duration: time.Since(start)}
+	if err != nil {
+		result.Err = fmt.Errorf("failed to resolve %s: %w", parsed.Hostname(), err)
+		p.logger.Debug("Probe failed", zap.String("check", CheckDNS), zap.String("target", targetURL), zap.Error(err))
+		return append(results, result)
+	}
+	result.Detail = strings.Join(addrs, ", ")
+	results = append(results, result)
+
+	// Connect, performing a TLS handshake for https targets
+	results = append(results, p.probeConnect(ctx, subject, parsed))
+	if !results[len(results)-1].OK() {
+		return results
+	}
+
+	// Query the health endpoint
+	if service.HealthCheck.Enabled {
+		results = append(results, p.probeHealth(ctx, subject, targetURL, &service.HealthCheck))
+	}
+
+	return results
+}
+
+// probeConnect opens a TCP connection, or a TLS session for https targets
+func (p *Prober) probeConnect(ctx context.Context, subject string, target *url.URL) Result {
+	address := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(target.Hostname(), port)
+	}
+
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: p.timeout}
+	result := Result{Check: CheckConnect, Subject: subject, Detail: address}
+
+	if target.Scheme == "https" {
+		conn, err := (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: target.Hostname()}}).DialContext(ctx, "tcp", address)
+		result.Duration = time.Since(start)
+		if err != nil {
+			result.Err = fmt.Errorf("TLS handshake with %s failed: %w", address, err)
+			return result
+		}
+		state := conn.(*tls.Conn).ConnectionState()
+		if len(state.PeerCertificates) > 0 {
+			result.Detail = fmt.Sprintf("%s (certificate expires %s)", address, state.PeerCertificates[0].NotAfter.Format(time.DateOnly))
+		}
+		conn.Close()
+		return result
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to connect to %s: %w", address, err)
+		return result
+	}
+	conn.Close()
+	return result
+}
+
+// probeHealth requests the target's health endpoint and expects a 2xx response
+func (p *Prober) probeHealth(ctx context.Context, subject, targetURL string, hc *config.HealthCheckConfig) Result {
+	detail := strings.TrimRight(targetURL, "/") + hc.Path
+	if hc.Type != "" && hc.Type != config.HealthCheckHTTP {
+		detail = hc.Type + " " + detail
+	}
+	result := Result{Check: CheckHealth, Subject: subject, Detail: detail}
+
+	timeout := p.timeout
+	if hc.Timeout > 0 && hc.Timeout < timeout {
+		timeout = hc.Timeout
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result.Err = health.Probe(reqCtx, p.client, targetURL, *hc)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// probeCertificate checks that a certificate and key load and match
+func (p *Prober) probeCertificate(cert config.CertificateConfig) Result {
+	result := Result{Check: CheckCertificate, Subject: cert.CertFile}
+
+	if cert.AutoGenerate {
+		if _, err := os.Stat(cert.CertFile); os.IsNotExist(err) {
+			result.Detail = "will be generated on startup"
+			return result
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to load certificate %s with key %s: %w", cert.CertFile, cert.KeyFile, err)
+		return result
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		result.Err = fmt.Errorf("failed to parse certificate: %w", err)
+		return result
+	}
+
+	if time.Now().After(leaf.NotAfter) {
+		result.Err = fmt.Errorf("certificate expired on %s", leaf.NotAfter.Format(time.DateOnly))
+		return result
+	}
+
+	for _, host := range cert.Hosts {
+		if err := leaf.VerifyHostname(host); err != nil {
+			result.Err = fmt.Errorf("certificate does not cover host %s", host)
+			return result
+		}
+	}
+
+	result.Detail = fmt.Sprintf("expires %s", leaf.NotAfter.Format(time.DateOnly))
+	return result
+}
+
+// checkOrder orders the checks of a subject in the sequence they run
+func checkOrder(check string) int {
+	switch check {
+	case CheckDNS:
+		return 0
+	case CheckConnect:
+		return 1
+	case CheckHealth:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// SwitchStatus describes the blue/green state of an upstream service
+type SwitchStatus struct {
+	Upstream   string     `json:"upstream"`
+	Active     string     `json:"active"`
+	Previous   string     `json:"previous,omitempty"`
+	SwitchedAt *time.Time `json:"switched_at,omitempty"`
+	Watching   bool       `json:"watching"`
+	Requests   int64      `json:"requests,omitempty"`
+	Errors     int64      `json:"errors,omitempty"`
+	RolledBack bool       `json:"rolled_back,omitempty"`
+}
+
+// deployment records a runtime switch of an upstream's active target set
+type deployment struct {
+	configured string // active set in the configuration at switch time
+	active     string
+	previous   string
+	switchedAt time.Time
+	rolledBack bool
+	watch      *switchWatch
+}
+
+// switchWatch counts responses after a switch to detect error spikes
+type switchWatch struct {
+	rollback config.RollbackConfig
+	requests atomic.Int64
+	errors   atomic.Int64
+	timer    *time.Timer
+}
+
+// activeColor returns the active target set of a blue/green upstream. A
+// runtime switch applies until the configured active set is changed.
+func (s *server) activeColor(upstream string, bg *config.BlueGreenConfig) string {
+	if bg == nil {
+		return ""
+	}
+
+	s.deployMu.RLock()
+	defer s.deployMu.RUnlock()
+
+	if d, exists := s.deployments[upstream]; exists && d.configured == bg.Active {
+		return d.active
+	}
+	return bg.Active
+}
+
+// SwitchUpstream makes a blue/green target set active, or flips to the
+// inactive set when color is empty. With rollback configured, the switch is
+// reverted if the error rate exceeds the threshold within the window.
+func (s *server) SwitchUpstream(upstream, color string) (*SwitchStatus, error) {
+	rt := s.runtime.Load()
+	if rt == nil {
+		return nil, fmt.Errorf("proxy server is not running")
+	}
+
+	service, exists := rt.cfg.Upstreams.Services[upstream]
+	if !exists {
+		return nil, fmt.Errorf("upstream %s not found", upstream)
+	}
+	bg := service.BlueGreen
+	if bg == nil {
+		return nil, fmt.Errorf("upstream %s has no blue/green target sets", upstream)
+	}
+
+	current := s.activeColor(upstream, bg)
+	if color == "" {
+		color = config.ColorGreen
+		if current == config.ColorGreen {
+			color = config.ColorBlue
+		}
+	}
+	if color != config.ColorBlue && color != config.ColorGreen {
+		return nil, fmt.Errorf("invalid target set: %s, must be one of: %s, %s", color, config.ColorBlue, config.ColorGreen)
+	}
+	if color == current {
+		return nil, fmt.Errorf("%s is already active for upstream %s", color, upstream)
+	}
+
+	d := &deployment{
+		configured: bg.Active,
+		active:     color,
+		previous:   current,
+		switchedAt: time.Now(),
+	}
+	if bg.Rollback.ErrorRate > 0 {
+		watch := &switchWatch{rollback: bg.Rollback}
+		watch.timer = time.AfterFunc(bg.Rollback.Window, func() { s.endWatch(upstream, watch) })
+		d.watch = watch
+	}
+
+	s.deployMu.Lock()
+	if previous, exists := s.deployments[upstream]; exists && previous.watch != nil {
+		previous.watch.timer.Stop()
+	}
+	s.deployments[upstream] = d
+	s.deployMu.Unlock()
+	s.refreshTargets()
+
+	s.logger.Info("Switched blue/green target set",
+		zap.String("upstream", upstream),
+		zap.String("from", current),
+		zap.String("to", color),
+		zap.Bool("auto_rollback", d.watch != nil))
+
+	return s.BlueGreenStatus(upstream), nil
+}
+
+// BlueGreenStatus returns the blue/green state of an upstream, or nil if it
+// has no blue/green target sets
+func (s *server) BlueGreenStatus(upstream string) *SwitchStatus {
+	rt := s.runtime.Load()
+	if rt == nil {
+		return nil
+	}
+	service, exists := rt.cfg.Upstreams.Services[upstream]
+	if !exists || service.BlueGreen == nil {
+		return nil
+	}
+
+	status := &SwitchStatus{
+		Upstream: upstream,
+		Active:   s.activeColor(upstream, service.BlueGreen),
+	}
+
+	s.deployMu.RLock()
+	defer s.deployMu.RUnlock()
+
+	if d, exists := s.deployments[upstream]; exists && d.configured == service.BlueGreen.Active {
+		switchedAt := d.switchedAt
+		status.Previous = d.previous
+		status.SwitchedAt = &switchedAt
+		status.RolledBack = d.rolledBack
+		if d.watch != nil {
+			status.Watching = true
+			status.Requests = d.watch.requests.Load()
+			status.Errors = d.watch.errors.Load()
+		}
+	}
+	return status
+}
+
+// watching returns the watch of a recent switch of an upstream, if any
+func (s *server) watching(upstream string) *switchWatch {
+	s.deployMu.RLock()
+	defer s.deployMu.RUnlock()
+
+	if d, exists := s.deployments[upstream]; exists {
+		return d.watch
+	}
+	return nil
+}
+
+// recordResponse counts a response after a switch and rolls the switch back
+// when the error rate exceeds the threshold
+func (s *server) recordResponse(upstream string, watch *switchWatch, status int) {
+	requests := watch.requests.Add(1)
+	errors := watch.errors.Load()
+	if status >= http.StatusInternalServerError {
+		errors = watch.errors.Add(1)
+	}
+
+	if requests < int64(watch.rollback.MinRequests) {
+		return
+	}
+	rate := float64(errors) / float64(requests)
+	if rate <= watch.rollback.ErrorRate {
+		return
+	}
+
+	s.deployMu.Lock()
+	d, exists := s.deployments[upstream]
+	if !exists || d.watch != watch {
+		// Already rolled back or superseded
+		s.deployMu.Unlock()
+		return
+	}
+	watch.timer.Stop()
+	d.active, d.previous = d.previous, d.active
+	d.rolledBack = true
+	d.watch = nil
+	s.deployMu.Unlock()
+	s.refreshTargets()
+
+	s.logger.Warn("Rolled back blue/green switch after error spike",
+		zap.String("upstream", upstream),
+		zap.String("active", d.active),
+		zap.Float64("error_rate", rate),
+		zap.Float64("threshold", watch.rollback.ErrorRate),
+		zap.Int64("requests", requests))
+}
+
+// endWatch stops watching a switch once its rollback window passes
+func (s *server) endWatch(upstream string, watch *switchWatch) {
+	s.deployMu.Lock()
+	defer s.deployMu.Unlock()
+
+	if d, exists := s.deployments[upstream]; exists && d.watch == watch {
+		d.watch = nil
+		s.logger.Info("Blue/green switch completed without rollback",
+			zap.String("upstream", upstream),
+			zap.String("active", d.active),
+			zap.Int64("requests", watch.requests.Load()),
+			zap.Int64("errors", watch.errors.Load()))
+	}
+}
+
+// statusRecorder captures the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records an implicit 200 status
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// Flush flushes the response, so streamed responses are not held back
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/openapi"
+	"go.uber.org/zap"
+)
+
+// maxDocumentSize bounds the OpenAPI documents fetched from upstreams
+const maxDocumentSize = 10 << 20
+
+// catalogPage is the Swagger UI page of the API catalog
+const catalogPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>%s</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: %q, dom_id: "#swagger-ui", deepLinking: true});
+  </script>
+</body>
+</html>
+`
+
+// apiCatalog serves the OpenAPI documents of upstreams merged into one,
+// with the paths rewritten to those the routes of the runtime lead to them.
+// Documents are fetched on demand and reused for the refresh interval.
+type apiCatalog struct {
+	server *server
+	rt     *runtime
+	config config.APICatalogConfig
+
+	mu        sync.Mutex
+	documents map[string]openapi.Document // last good document by upstream
+	merged    []byte
+	mergedAt  time.Time
+}
+
+// newAPICatalog creates the API catalog of a runtime, nil when disabled
+func (s *server) newAPICatalog(rt *runtime) *apiCatalog {
+	if !rt.cfg.Global.APICatalog.Enabled {
+		return nil
+	}
+	return &apiCatalog{
+		server:    s,
+		rt:        rt,
+		config:    rt.cfg.Global.APICatalog,
+		documents: make(map[string]openapi.Document),
+	}
+}
+
+// matches reports whether a request is for the catalog
+func (c *apiCatalog) matches(r *http.Request) bool {
+	if c.config.Host != "" {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if !strings.EqualFold(host, c.config.Host) {
+			return false
+		}
+	}
+	path := r.URL.Path
+	return path == c.config.Path || path == c.config.Path+"/" || path == c.config.Path+"/openapi.json"
+}
+
+// ServeHTTP serves the merged document, or the Swagger UI showing it
+func (c *apiCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !strings.HasSuffix(r.URL.Path, "/openapi.json") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, catalogPage, html.EscapeString(c.config.Title), c.config.Path+"/openapi.json")
+		return
+	}
+
+	document, err := c.document(r.Context())
+	if err != nil {
+		c.server.logger.Error("Failed to build API catalog", zap.Error(err))
+		http.Error(w, "Failed to build API catalog", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(document)
+}
+
+// document returns the merged document, fetching the upstream documents
+// again once the refresh interval has passed
+func (c *apiCatalog) document(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.merged != nil && time.Since(c.mergedAt) < c.config.Refresh {
+		return c.merged, nil
+	}
+
+	// Routes are grouped by upstream in evaluation order
+	rules := append([]config.RouteRule(nil), c.rt.cfg.Routes.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+	routes := make(map[string][]config.RouteRule)
+	for _, rule := range rules {
+		routes[rule.Upstream] = append(routes[rule.Upstream], rule)
+	}
+
+	var names []string
+	for name, service := range c.rt.cfg.Upstreams.Services {
+		if service.OpenAPI != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	failures := c.fetchAll(ctx, names)
+
+	var sources []openapi.Source
+	for _, name := range names {
+		if document, ok := c.documents[name]; ok {
+			sources = append(sources, openapi.Source{Upstream: name, Document: document, Routes: routes[name]})
+		}
+	}
+
+	merged, warnings := openapi.Merge(c.config.Title, sources)
+	for _, warning := range warnings {
+		c.server.logger.Warn("API catalog merge conflict", zap.String("warning", warning))
+	}
+	if len(failures) > 0 {
+		merged["x-sentinel-unavailable"] = failures
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged document: %w", err)
+	}
+	c.merged, c.mergedAt = data, time.Now()
+	return data, nil
+}
+
+// fetchAll fetches the documents of upstreams in parallel, keeping the last
+// good document of those that fail. It returns the failures by upstream.
+func (c *apiCatalog) fetchAll(ctx context.Context, names []string) map[string]string {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failures := make(map[string]string)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			document, err := c.fetch(ctx, name)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				c.server.logger.Warn("Failed to fetch OpenAPI document",
+					zap.String("upstream", name),
+					zap.Error(err))
+				failures[name] = err.Error()
+				return
+			}
+			c.documents[name] = document
+		}(name)
+	}
+	wg.Wait()
+	return failures
+}
+
+// fetch retrieves the OpenAPI document of an upstream from its first
+// healthy target
+func (c *apiCatalog) fetch(ctx context.Context, name string) (openapi.Document, error) {
+	service := c.rt.cfg.Upstreams.Services[name]
+
+	var targetURL string
+	for _, target := range c.server.upstreamTargets(c.rt.cfg, name) {
+		if target.IsHealthy() {
+			targetURL = strings.TrimSuffix(target.URL.String(), "/")
+			break
+		}
+	}
+	if targetURL == "" {
+		return nil, fmt.Errorf("no healthy targets")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL+service.OpenAPI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/yaml;q=0.9, */*;q=0.8")
+
+	client := &http.Client{Transport: c.rt.pools[name].transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if len(data) > maxDocumentSize {
+		return nil, fmt.Errorf("document exceeds %d bytes", maxDocumentSize)
+	}
+	return openapi.Parse(data)
+}
@@ -0,0 +1,20 @@
+package proxy
+
+import (
+	"github.com/bpradana/sentinel/internal/tls"
+)
+
+// ReloadCertificates reloads the manual TLS certificates from their files.
+// Running HTTPS servers pick them up on their next handshake.
+func (s *server) ReloadCertificates() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tlsManager.ReloadCertificates()
+}
+
+// Certificates describes the loaded manual TLS certificates
+func (s *server) Certificates() []tls.CertificateInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tlsManager.Certificates()
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+// Client certificate headers, describing the certificate a client verified
+// with on the HTTPS listener
+const (
+	clientCertSubjectHeader = "X-Client-Cert-Subject"
+	clientCertSANHeader     = "X-Client-Cert-SAN"
+)
+
+// verifiedClientCert returns the verified certificate a client presented,
+// nil if it presented none or the listener did not verify it
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// setClientCertHeaders tells the upstream about the verified client
+// certificate when forward is set. Client-supplied values are never passed
+// on.
+func setClientCertHeaders(r *http.Request, forward bool) {
+	r.Header.Del(clientCertSubjectHeader)
+	r.Header.Del(clientCertSANHeader)
+	if !forward {
+		return
+	}
+
+	cert := verifiedClientCert(r)
+	if cert == nil {
+		return
+	}
+	r.Header.Set(clientCertSubjectHeader, cert.Subject.String())
+	if sans := subjectAltNames(cert); len(sans) > 0 {
+		r.Header.Set(clientCertSANHeader, strings.Join(sans, ","))
+	}
+}
+
+// subjectAltNames lists the SANs of a certificate, prefixed by their type
+// as in DNS:api.example.com
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	for _, name := range cert.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, email := range cert.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	return sans
+}
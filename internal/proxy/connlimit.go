@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// connSweepInterval is how often clients without connections and with a full
+// rate bucket are forgotten
+const connSweepInterval = time.Minute
+
+// connLimiter caps the concurrent connections and the connection rate of
+// each client IP before any HTTP parsing happens. It is shared by the HTTP
+// and HTTPS listeners, and keeps its counts when its settings change.
+type connLimiter struct {
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	cfg       config.ConnectionLimitConfig
+	exempt    []*net.IPNet
+	clients   map[string]*connClient // by IP
+	lastSweep time.Time
+}
+
+// connClient tracks the connections of one client IP
+type connClient struct {
+	active  int
+	tokens  float64 // connections the client may open right now
+	updated time.Time
+	limited bool // whether the last connection was rejected
+}
+
+// newConnLimiter creates a limiter that admits every connection until
+// configured
+func newConnLimiter(logger *zap.Logger) *connLimiter {
+	return &connLimiter{
+		logger:  logger,
+		clients: make(map[string]*connClient),
+	}
+}
+
+// limiterSettings are parsed connection limit settings, ready to apply
+type limiterSettings struct {
+	cfg    config.ConnectionLimitConfig
+	exempt []*net.IPNet
+}
+
+// parseConnLimits parses the connection limits of the server settings.
+// Trusted proxies are exempt, since their connections carry many clients.
+func parseConnLimits(serverCfg config.ServerConfig) (*limiterSettings, error) {
+	settings := &limiterSettings{cfg: serverCfg.ConnectionLimits}
+	entries := append(append([]string(nil), serverCfg.ConnectionLimits.Exempt...), serverCfg.ClientIP.TrustedProxies...)
+	for _, entry := range entries {
+		network, err := config.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection limit exemption %s: %w", entry, err)
+		}
+		settings.exempt = append(settings.exempt, network)
+	}
+	return settings, nil
+}
+
+// update applies new settings
+func (l *connLimiter) update(settings *limiterSettings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = settings.cfg
+	l.exempt = settings.exempt
+}
+
+// admit decides whether to accept a connection. Admitted connections are
+// wrapped to release their slot when closed.
+func (l *connLimiter) admit(conn net.Conn) (net.Conn, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxPerIP <= 0 && l.cfg.RatePerIP <= 0 {
+		return conn, true
+	}
+	ip := connIP(conn)
+	if ip == nil || l.isExempt(ip) {
+		return conn, true
+	}
+
+	now := time.Now()
+	l.sweep(now)
+
+	key := ip.String()
+	client, exists := l.clients[key]
+	if !exists {
+		client = &connClient{tokens: float64(l.cfg.Burst), updated: now}
+		l.clients[key] = client
+	}
+
+	reason := ""
+	if l.cfg.RatePerIP > 0 {
+		client.refill(now, l.cfg.RatePerIP, l.cfg.Burst)
+		if client.tokens < 1 {
+			reason = "rate"
+		}
+	}
+	if l.cfg.MaxPerIP > 0 && client.active >= l.cfg.MaxPerIP {
+		reason = "concurrency"
+	}
+	if reason != "" {
+		if !client.limited {
+			client.limited = true
+			l.logger.Warn("Rejecting connections of client over its connection limit",
+				zap.String("client_ip", key),
+				zap.String("limit", reason),
+				zap.Int("active", client.active),
+				zap.Int("max_per_ip", l.cfg.MaxPerIP),
+				zap.Float64("rate_per_ip", l.cfg.RatePerIP))
+		}
+		return nil, false
+	}
+
+	client.limited = false
+	if l.cfg.RatePerIP > 0 {
+		client.tokens--
+	}
+	client.active++
+	return &limitedConn{Conn: conn, release: func() { l.release(key) }}, true
+}
+
+// release frees the slot of a closed connection
+func (l *connLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if client, exists := l.clients[key]; exists && client.active > 0 {
+		client.active--
+	}
+}
+
+// isExempt reports whether ip is never limited. Callers hold mu.
+func (l *connLimiter) isExempt(ip net.IP) bool {
+	for _, network := range l.exempt {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep forgets idle clients once per sweep interval, so the table does not
+// grow with every address ever seen. Callers hold mu.
+func (l *connLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < connSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, client := range l.clients {
+		if client.active > 0 {
+			continue
+		}
+		if l.cfg.RatePerIP > 0 {
+			client.refill(now, l.cfg.RatePerIP, l.cfg.Burst)
+			if client.tokens < float64(l.cfg.Burst) {
+				continue
+			}
+		}
+		delete(l.clients, key)
+	}
+}
+
+// refill adds the tokens earned since the last update, up to burst
+func (c *connClient) refill(now time.Time, rate float64, burst int) {
+	c.tokens = min(float64(burst), c.tokens+now.Sub(c.updated).Seconds()*rate)
+	c.updated = now
+}
+
+// connIP returns the IP address of the remote end of a connection
+func connIP(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// limitedConn releases its client's slot when closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// Close closes the connection and releases its slot once
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
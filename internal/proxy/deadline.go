@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// Deadline headers. X-Request-Timeout carries the remaining time in
+// milliseconds; grpc-timeout uses the gRPC wire format.
+const (
+	requestTimeoutHeader = "X-Request-Timeout"
+	grpcTimeoutHeader    = "Grpc-Timeout"
+)
+
+// trustedNetworks parses the callers whose deadline headers are honored
+func trustedNetworks(callers []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(callers))
+	for _, caller := range callers {
+		network, err := config.ParseCIDR(caller)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted caller %s: %w", caller, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// applyDeadline bounds a request by its route timeout and, for trusted
+// callers, by the deadline the caller sent. Deadline headers of other
+// callers are removed so they never reach upstreams.
+func (rt *runtime) applyDeadline(r *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	if rt.trustsCaller(r) {
+		if inbound, ok := inboundTimeout(r.Header); ok {
+			if max := rt.cfg.Global.Server.Deadlines.MaxTimeout; max > 0 && inbound > max {
+				inbound = max
+			}
+			if timeout <= 0 || inbound < timeout {
+				timeout = inbound
+			}
+		}
+	} else {
+		r.Header.Del(requestTimeoutHeader)
+		r.Header.Del(grpcTimeoutHeader)
+	}
+
+	if timeout <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel
+}
+
+// trustsCaller reports whether the directly connected peer may set the
+// deadline of its requests
+func (rt *runtime) trustsCaller(r *http.Request) bool {
+	if len(rt.trustedCallers) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range rt.trustedCallers {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setDeadlineHeaders tells the upstream how much time is left for an
+// outgoing request. grpc-timeout is only set on gRPC requests.
+func setDeadlineHeaders(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := max(time.Until(deadline), time.Millisecond)
+
+	req.Header.Set(requestTimeoutHeader, strconv.FormatInt(remaining.Milliseconds(), 10))
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		req.Header.Set(grpcTimeoutHeader, formatGRPCTimeout(remaining))
+	}
+}
+
+// inboundTimeout reads the timeout a caller sent, preferring grpc-timeout
+func inboundTimeout(header http.Header) (time.Duration, bool) {
+	if value := header.Get(grpcTimeoutHeader); value != "" {
+		if timeout, ok := parseGRPCTimeout(value); ok {
+			return timeout, true
+		}
+	}
+	if value := header.Get(requestTimeoutHeader); value != "" {
+		// Milliseconds, or a duration such as "1.5s"
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			return timeout, true
+		}
+	}
+	return 0, false
+}
+
+// grpcTimeoutUnits maps grpc-timeout units to durations
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: at most 8 digits and a unit
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	amount, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return time.Duration(amount) * unit, true
+}
+
+// formatGRPCTimeout formats a timeout in the finest unit that fits the 8
+// digits grpc-timeout allows
+func formatGRPCTimeout(timeout time.Duration) string {
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"n", time.Nanosecond},
+		{"u", time.Microsecond},
+		{"m", time.Millisecond},
+		{"S", time.Second},
+		{"M", time.Minute},
+	} {
+		if amount := int64(timeout / unit.size); amount < 100_000_000 {
+			return strconv.FormatInt(amount, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(timeout/time.Hour), 10) + "H"
+}
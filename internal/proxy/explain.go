@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// RouteMatch explains how the proxy would handle a request
+type RouteMatch struct {
+	Matched       bool              `json:"matched"`
+	Route         int               `json:"route"`
+	Host          string            `json:"host,omitempty"`
+	Path          string            `json:"path,omitempty"`
+	Methods       []string          `json:"methods,omitempty"`
+	Upstream      string            `json:"upstream,omitempty"`
+	OriginalPath  string            `json:"original_path"`
+	RewrittenPath string            `json:"rewritten_path,omitempty"`
+	Rewrites      []string          `json:"rewrites,omitempty"`
+	Middleware    []MiddlewareMatch `json:"middleware"`
+	Targets       []string          `json:"targets,omitempty"`
+	Timeout       string            `json:"timeout,omitempty"`
+	RetryAttempts int               `json:"retry_attempts,omitempty"`
+	MaxResponse   int64             `json:"max_response_size,omitempty"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// MiddlewareMatch is a middleware a request would pass through, in order
+type MiddlewareMatch struct {
+	Name       string `json:"name"`
+	Type       string `json:"type,omitempty"`
+	Scope      string `json:"scope"` // "global" or "route"
+	Overridden bool   `json:"overridden,omitempty"`
+}
+
+// Explain reports which route a request would match and how it would be
+// handled, without proxying it
+func (s *server) Explain(r *http.Request) *RouteMatch {
+	rt := s.runtime.Load()
+	if rt == nil {
+		return &RouteMatch{Route: -1, OriginalPath: r.URL.Path, Error: "proxy server is not running"}
+	}
+	cfg := rt.cfg
+
+	match := &RouteMatch{Route: -1, OriginalPath: r.URL.Path, Middleware: []MiddlewareMatch{}}
+
+	// Global middleware runs for every request, matched or not
+	global := make([]MiddlewareMatch, 0, len(cfg.Middleware.Chain))
+	definitions := make(map[string]string)
+	chain := append(cfg.Middleware.Chain[:0:0], cfg.Middleware.Chain...)
+	sort.SliceStable(chain, func(i, j int) bool { return chain[i].Order < chain[j].Order })
+	for _, mw := range chain {
+		if !mw.Enabled {
+			continue
+		}
+		definitions[mw.Name] = mw.Type
+		global = append(global, MiddlewareMatch{Name: mw.Name, Type: mw.Type, Scope: "global"})
+	}
+	match.Middleware = append(match.Middleware, global...)
+
+	matched := rt.findMatchingRoute(r)
+	if matched == nil {
+		match.Error = "no matching route"
+		return match
+	}
+
+	rule := &matched.rule
+	for i, candidate := range rt.routes {
+		if candidate == matched {
+			match.Route = i
+			break
+		}
+	}
+	match.Matched = true
+	match.Host = rule.Host
+	match.Path = rule.Path
+	match.Methods = rule.Methods
+	match.Upstream = rule.Upstream
+	match.RetryAttempts = rule.RetryPolicy.Attempts
+	match.MaxResponse = rule.MaxResponseSize
+	if rule.Timeout > 0 {
+		match.Timeout = rule.Timeout.String()
+	}
+
+	// Route middleware runs after the global chain
+	for _, ref := range rule.Middleware {
+		mwType, enabled := definitions[ref.Name]
+		if !enabled {
+			continue
+		}
+		match.Middleware = append(match.Middleware, MiddlewareMatch{
+			Name:       ref.Name,
+			Type:       mwType,
+			Scope:      "route",
+			Overridden: len(ref.Config) > 0,
+		})
+	}
+	if len(rule.Headers) > 0 {
+		match.Middleware = append(match.Middleware, MiddlewareMatch{Name: "headers", Scope: "route"})
+	}
+
+	// Rewrite a copy of the request the same way the handler would
+	rewritten := r.Clone(r.Context())
+	if err := s.applyRewrite(rewritten, &rule.Rewrite); err != nil {
+		match.Error = err.Error()
+	}
+	match.RewrittenPath = rewritten.URL.Path
+	match.Rewrites = describeRewrites(r.URL.Path, &rule.Rewrite)
+
+	// Targets the load balancer would choose from
+	if _, exists := cfg.Upstreams.Services[rule.Upstream]; exists {
+		for _, target := range s.upstreamTargets(cfg, rule.Upstream) {
+			if target.IsHealthy() {
+				match.Targets = append(match.Targets, target.URL.String())
+			}
+		}
+		if len(match.Targets) == 0 {
+			match.Error = "no healthy targets available"
+		}
+	} else {
+		match.Error = "upstream not found"
+	}
+
+	return match
+}
+
+// describeRewrites lists the rewrite steps that apply to a path, in the order
+// applyRewrite performs them
+func describeRewrites(path string, rewrite *config.RewriteConfig) []string {
+	var steps []string
+	if rewrite.StripPrefix != "" && strings.HasPrefix(path, rewrite.StripPrefix) {
+		steps = append(steps, "strip_prefix "+rewrite.StripPrefix)
+		path = strings.TrimPrefix(path, rewrite.StripPrefix)
+	}
+	if rewrite.AddPrefix != "" {
+		steps = append(steps, "add_prefix "+rewrite.AddPrefix)
+		path = rewrite.AddPrefix + path
+	}
+	if rewrite.Regex != "" && rewrite.Replacement != "" {
+		if re, err := regexp.Compile(rewrite.Regex); err == nil && re.MatchString(path) {
+			steps = append(steps, "regex "+rewrite.Regex+" -> "+rewrite.Replacement)
+		}
+	}
+	return steps
+}
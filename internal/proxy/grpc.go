@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	gotls "crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+)
+
+// gRPC status codes the proxy answers failed calls with
+const (
+	grpcUnavailable       = "14"
+	grpcResourceExhausted = "8"
+)
+
+// grpcTransport speaks HTTP/2 to gRPC targets: cleartext HTTP/2 (h2c) to
+// http:// targets and HTTP/2 over TLS to https:// ones. Calls are
+// multiplexed on one connection per target, while every call is balanced
+// on its own.
+type grpcTransport struct {
+	h2c *http2.Transport
+	h2  *http2.Transport
+}
+
+// newGRPCTransport creates the transport of an upstream's gRPC targets
+func newGRPCTransport(settings config.TransportConfig, tlsConfig *gotls.Config) *grpcTransport {
+	dialer := &net.Dialer{Timeout: settings.DialTimeout, KeepAlive: settings.KeepAlive}
+	return &grpcTransport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *gotls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: settings.KeepAlive,
+		},
+		h2: &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *gotls.Config) (net.Conn, error) {
+				tlsDialer := &gotls.Dialer{NetDialer: dialer, Config: cfg}
+				return tlsDialer.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: settings.KeepAlive,
+		},
+	}
+}
+
+// RoundTrip sends a call over HTTP/2, in cleartext for http:// targets
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.h2.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both transports
+func (t *grpcTransport) CloseIdleConnections() {
+	t.h2c.CloseIdleConnections()
+	t.h2.CloseIdleConnections()
+}
+
+// hasGRPCTargets reports whether any target of an upstream speaks gRPC
+func hasGRPCTargets(service config.UpstreamService) bool {
+	for _, target := range service.AllTargets() {
+		if target.Protocol == config.ProtocolGRPC {
+			return true
+		}
+	}
+	return false
+}
+
+// isGRPC reports whether a request is a gRPC call
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// grpcError answers a call the proxy failed to forward the way gRPC clients
+// expect: a trailers-only response whose grpc-status carries the error,
+// rather than an HTTP error status
+func (s *server) grpcError(w http.ResponseWriter, r *http.Request, upstream string, err error) {
+	status, message := grpcUnavailable, "upstream unavailable"
+	if errors.Is(err, errResponseTooLarge) {
+		status, message = grpcResourceExhausted, "upstream response exceeds max_response_size"
+	}
+	s.logger.Error("gRPC proxy error",
+		zap.String("upstream", upstream),
+		zap.String("method", r.URL.Path),
+		zap.Error(err))
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", status)
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
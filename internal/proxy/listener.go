@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/handover"
+	"go.uber.org/zap"
+)
+
+// boundListener owns a bound socket and hands accepted connections to the
+// server currently attached to it. Servers can be replaced without closing
+// the socket, so reconfiguring a listener never refuses connections.
+type boundListener struct {
+	ln      net.Listener
+	port    int
+	path    string // unix sockets only
+	limiter *connLimiter
+	mu      sync.Mutex
+	current *serverListener
+	closed  bool
+}
+
+// bind binds a TCP port and starts accepting the connections the limiter
+// admits
+func bind(port int, limiter *connLimiter) (*boundListener, error) {
+	ln, err := handover.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind port %d: %w", port, err)
+	}
+
+	b := &boundListener{ln: ln, port: port, limiter: limiter}
+	go b.acceptLoop()
+	return b, nil
+}
+
+// bindUnix binds a unix socket, restricts its permissions to mode and starts
+// accepting connections. A socket passed by the process this one upgrades is
+// taken over. A stale socket file left behind by a process that is gone is
+// replaced; one still in use is not.
+func bindUnix(path string, mode os.FileMode, limiter *connLimiter) (*boundListener, error) {
+	ln, inherited, err := handover.Inherit("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if inherited {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set permissions of unix socket %s: %w", path, err)
+		}
+		b := &boundListener{ln: ln, path: path, limiter: limiter}
+		go b.acceptLoop()
+		return b, nil
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("failed to bind unix socket %s: file exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind unix socket %s: already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+		}
+	}
+
+	ln, err = handover.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind unix socket %s: %w", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions of unix socket %s: %w", path, err)
+	}
+
+	b := &boundListener{ln: ln, path: path, limiter: limiter}
+	go b.acceptLoop()
+	return b, nil
+}
+
+// logField describes the socket in logs
+func (b *boundListener) logField() zap.Field {
+	if b.path != "" {
+		return zap.String("socket", b.path)
+	}
+	return zap.Int("port", b.port)
+}
+
+// attach returns a listener for a new server. Connections accepted from now on
+// go to the new server; the previously attached server stops accepting.
+func (b *boundListener) attach() net.Listener {
+	l := &serverListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		addr:  b.ln.Addr(),
+	}
+
+	b.mu.Lock()
+	previous := b.current
+	b.current = l
+	b.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return l
+}
+
+// Close closes the socket and the attached server's listener
+func (b *boundListener) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	current := b.current
+	b.mu.Unlock()
+
+	if current != nil {
+		current.Close()
+	}
+	return b.ln.Close()
+}
+
+// acceptLoop accepts connections and delivers them to the attached server
+func (b *boundListener) acceptLoop() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		admitted, ok := b.limiter.admit(conn)
+		if !ok {
+			conn.Close()
+			continue
+		}
+		b.deliver(admitted)
+	}
+}
+
+// deliver hands a connection to the attached server, following a concurrent
+// attach if the server it first picked stops accepting
+func (b *boundListener) deliver(conn net.Conn) {
+	for {
+		b.mu.Lock()
+		current, closed := b.current, b.closed
+		b.mu.Unlock()
+
+		if closed || current == nil {
+			conn.Close()
+			return
+		}
+
+		select {
+		case current.conns <- conn:
+			return
+		case <-current.done:
+			b.mu.Lock()
+			replaced := b.current != current
+			b.mu.Unlock()
+			if !replaced {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// serverListener is the net.Listener a single http.Server accepts from
+type serverListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	addr  net.Addr
+}
+
+// Accept waits for the next connection
+func (l *serverListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting without closing the underlying socket
+func (l *serverListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the socket address
+func (l *serverListener) Addr() net.Addr {
+	return l.addr
+}
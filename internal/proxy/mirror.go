@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// maxMirrorsInFlight bounds the copies of a route's requests in flight;
+// further copies are dropped rather than piling up behind a slow shadow
+// upstream
+const maxMirrorsInFlight = 100
+
+// hopHeaders are the hop-by-hop headers not copied to mirrored requests
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// mirror copies a sample of a route's requests to a shadow upstream
+type mirror struct {
+	cfg      config.MirrorConfig
+	inflight chan struct{}
+}
+
+// newMirror creates the mirror of a route
+func newMirror(cfg config.MirrorConfig) *mirror {
+	return &mirror{cfg: cfg, inflight: make(chan struct{}, maxMirrorsInFlight)}
+}
+
+// sample reports whether to mirror a request
+func (m *mirror) sample() bool {
+	return m.cfg.Percent >= 100 || rand.Float64()*100 < m.cfg.Percent
+}
+
+// mirrorRequest sends a copy of a request to the route's shadow upstream in
+// the background. The copy sends the body buffered by the route, or else
+// buffers it in memory, so that both the upstream and the copy read it;
+// requests with bodies over max_body_size and protocol upgrades are not
+// mirrored.
+func (s *server) mirrorRequest(rt *runtime, m *mirror, r *http.Request, body *requestBody) {
+	if !m.sample() || r.Header.Get("Upgrade") != "" {
+		return
+	}
+	upstream := m.cfg.Upstream
+
+	if body == nil {
+		buffered, ok := s.bufferRequestBody(r, m.cfg.MaxBodySize, m.cfg.MaxBodySize, "")
+		if !ok {
+			metrics.ObserveMirror(upstream, "skipped")
+			return
+		}
+		body = buffered
+	} else {
+		if body.size > m.cfg.MaxBodySize {
+			metrics.ObserveMirror(upstream, "skipped")
+			return
+		}
+		body.retain()
+	}
+
+	select {
+	case m.inflight <- struct{}{}:
+	default:
+		body.release()
+		metrics.ObserveMirror(upstream, "dropped")
+		return
+	}
+
+	// The copy outlives the client request
+	copied := r.Clone(context.Background())
+	go func() {
+		defer func() { <-m.inflight }()
+		defer body.release()
+		if err := s.sendMirror(rt, m, copied, body); err != nil {
+			metrics.ObserveMirror(upstream, "failed")
+			s.logger.Debug("Mirrored request failed",
+				zap.String("upstream", upstream),
+				zap.String("path", copied.URL.Path),
+				zap.Error(err))
+			return
+		}
+		metrics.ObserveMirror(upstream, "sent")
+	}()
+}
+
+// sendMirror sends a copied request to a target of the shadow upstream and
+// discards the response
+func (s *server) sendMirror(rt *runtime, m *mirror, req *http.Request, body *requestBody) error {
+	upstream := m.cfg.Upstream
+	lb := rt.loadBalancers[upstream]
+	target, err := lb.SelectTarget(s.upstreamTargets(rt.cfg, upstream), req)
+	if err != nil {
+		return err
+	}
+	lb.UpdateTarget(target, 1)
+	defer lb.UpdateTarget(target, -1)
+
+	ctx, cancel := context.WithTimeout(req.Context(), m.cfg.Timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	// Address the request the way the target's reverse proxy would
+	proxy := rt.pools[upstream].proxy(s, target)
+	proxy.Director(req)
+	req.RequestURI = ""
+	for _, header := range hopHeaders {
+		req.Header.Del(header)
+	}
+	req.Header.Set("X-Sentinel-Mirror", "true")
+	req.Body = body.reader()
+	req.GetBody = nil
+	req.ContentLength = body.size
+	req.TransferEncoding = nil
+
+	resp, err := proxy.Transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"github.com/bpradana/sentinel/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// outlierDetector ejects the targets of an upstream that keep failing the
+// requests proxied to them
+type outlierDetector struct {
+	upstream string
+	cfg      config.OutlierDetectionConfig
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	targets map[string]*outlierState // by target URL
+}
+
+// outlierState tracks the recent outcomes of a target
+type outlierState struct {
+	consecutive5xx  int
+	connectFailures int
+	ejections       int       // ejections since the target last recovered
+	ejectedUntil    time.Time // zero once the target recovered
+}
+
+// newOutlierDetector creates an outlier detector with no ejected targets
+func newOutlierDetector(upstream string, cfg config.OutlierDetectionConfig, logger *zap.Logger) *outlierDetector {
+	return &outlierDetector{
+		upstream: upstream,
+		cfg:      cfg,
+		logger:   logger,
+		targets:  make(map[string]*outlierState),
+	}
+}
+
+// outlierDetector returns the outlier detector of an upstream, keeping the
+// one of the previous runtime, and its ejections, when its settings are
+// unchanged
+func (rt *runtime) outlierDetector(upstream string, cfg config.OutlierDetectionConfig, logger *zap.Logger) *outlierDetector {
+	if rt != nil {
+		if detector := rt.outliers[upstream]; detector != nil && detector.cfg == cfg {
+			return detector
+		}
+	}
+	return newOutlierDetector(upstream, cfg, logger)
+}
+
+// state returns the state of a target. Callers hold mu.
+func (d *outlierDetector) state(target string) *outlierState {
+	state := d.targets[target]
+	if state == nil {
+		state = &outlierState{}
+		d.targets[target] = state
+	}
+	return state
+}
+
+// recordResponse counts a response of a target
+func (d *outlierDetector) recordResponse(target string, status int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.state(target)
+	now := time.Now()
+	if status < 500 {
+		state.consecutive5xx, state.connectFailures = 0, 0
+		// A target still answering after its recovery window has recovered
+		if !state.ejectedUntil.IsZero() && now.After(state.ejectedUntil.Add(d.cfg.RecoveryWindow)) {
+			state.ejections = 0
+			state.ejectedUntil = time.Time{}
+		}
+		return
+	}
+
+	state.consecutive5xx++
+	if state.consecutive5xx >= d.cfg.Consecutive5xx || d.recovering(state, now) {
+		d.eject(target, state, now, "5xx")
+	}
+}
+
+// recordError counts a failure to proxy a request to a target. Requests
+// the client gave up on, and responses rejected by the proxy itself, say
+// nothing about the target.
+func (d *outlierDetector) recordError(target string, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errResponseTooLarge) {
+		return
+	}
+	if !isConnectFailure(err) {
+		d.recordResponse(target, http.StatusBadGateway)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.state(target)
+	now := time.Now()
+	state.connectFailures++
+	if state.connectFailures >= d.cfg.ConsecutiveConnectFailures || d.recovering(state, now) {
+		d.eject(target, state, now, "connect_failure")
+	}
+}
+
+// recovering reports whether a target is being readmitted after an
+// ejection, when a single failure ejects it again. Callers hold mu.
+func (d *outlierDetector) recovering(state *outlierState, now time.Time) bool {
+	return !state.ejectedUntil.IsZero() && !now.Before(state.ejectedUntil) &&
+		now.Before(state.ejectedUntil.Add(d.cfg.RecoveryWindow))
+}
+
+// eject takes a target out of rotation, for longer each time it is ejected
+// again before recovering. Callers hold mu.
+func (d *outlierDetector) eject(target string, state *outlierState, now time.Time, reason string) {
+	// Failures of requests in flight when the target was ejected
+	if now.Before(state.ejectedUntil) {
+		return
+	}
+
+	state.ejections++
+	duration := min(d.cfg.BaseEjectionTime*time.Duration(state.ejections), d.cfg.MaxEjectionTime)
+	state.ejectedUntil = now.Add(duration)
+	state.consecutive5xx, state.connectFailures = 0, 0
+
+	metrics.ObserveOutlierEjection(d.upstream, target, reason)
+	d.logger.Warn("Ejected outlier target",
+		zap.String("upstream", d.upstream),
+		zap.String("target", target),
+		zap.String("reason", reason),
+		zap.Int("ejections", state.ejections),
+		zap.Duration("duration", duration))
+}
+
+// apply returns the targets without the ejected ones, never leaving out
+// more than max_ejection_percent of them. Readmitted targets take a share of
+// requests that grows over the recovery window. The targets are shared by
+// all requests, so they are filtered rather than marked.
+func (d *outlierDetector) apply(targets []*loadbalancer.Target) []*loadbalancer.Target {
+	allowed := len(targets) * d.cfg.MaxEjectionPercent / 100
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var kept []*loadbalancer.Target // nil until a target is left out
+	for i, target := range targets {
+		excluded := false
+		if state := d.targets[target.URL.String()]; allowed > 0 && target.IsHealthy() && state != nil && !state.ejectedUntil.IsZero() {
+			excluded = now.Before(state.ejectedUntil)
+			if elapsed := now.Sub(state.ejectedUntil); !excluded && elapsed < d.cfg.RecoveryWindow {
+				excluded = rand.Float64() >= float64(elapsed)/float64(d.cfg.RecoveryWindow)
+			}
+		}
+
+		switch {
+		case excluded:
+			if kept == nil {
+				kept = append(make([]*loadbalancer.Target, 0, len(targets)), targets[:i]...)
+			}
+			allowed--
+		case kept != nil:
+			kept = append(kept, target)
+		}
+	}
+	if kept == nil {
+		return targets
+	}
+	return kept
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	goruntime "runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// Overload controller settings
+const (
+	overloadInterval   = time.Second // how often the shed ratio is adjusted
+	overloadSlots      = 10          // latency histograms per window, rotated as it slides
+	overloadMinSamples = 20          // requests in the window before latency counts
+	overloadDecrease   = 0.05        // ratio shed less per interval below the targets
+)
+
+// overloadBuckets are the upper bounds of the latency histograms, growing by
+// a quarter from 1ms to about a minute
+var overloadBuckets = func() []time.Duration {
+	var buckets []time.Duration
+	for bound := float64(time.Millisecond); bound < float64(time.Minute); bound *= 1.25 {
+		buckets = append(buckets, time.Duration(bound))
+	}
+	return buckets
+}()
+
+// loadShedder rejects a fraction of requests while the proxy is overloaded.
+// Every interval it compares the p99 latency of the requests it let through
+// and the CPU usage of the process with their targets, and raises the
+// fraction in proportion to how far above a target they are, or lowers it
+// once both are below. It keeps its measurements across reloads that leave
+// its settings unchanged.
+type loadShedder struct {
+	cfg    config.OverloadConfig
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	histograms [overloadSlots][]uint64 // latency counts by bucket, the last one for slower requests
+	slot       int
+	slotStart  time.Time
+	ratio      float64
+	adjusted   time.Time
+	cpuTime    time.Duration // CPU time of the process at the last adjustment
+}
+
+// newLoadShedder creates a shedder that sheds nothing until it measures an
+// overload
+func newLoadShedder(cfg config.OverloadConfig, logger *zap.Logger) *loadShedder {
+	s := &loadShedder{cfg: cfg, logger: logger, slotStart: time.Now(), adjusted: time.Now(), cpuTime: processCPUTime()}
+	for i := range s.histograms {
+		s.histograms[i] = make([]uint64, len(overloadBuckets)+1)
+	}
+	return s
+}
+
+// loadShedder returns the shedder for the overload settings, keeping the one
+// of the previous runtime when they are unchanged. It is nil when overload
+// protection is disabled.
+func (rt *runtime) loadShedder(cfg config.OverloadConfig, logger *zap.Logger) *loadShedder {
+	if !cfg.Enabled {
+		return nil
+	}
+	if rt != nil && rt.shedder != nil && reflect.DeepEqual(rt.shedder.cfg, cfg) {
+		return rt.shedder
+	}
+	return newLoadShedder(cfg, logger)
+}
+
+// admit reports whether a request is served. Requests to priority paths
+// always are.
+func (s *loadShedder) admit(r *http.Request) bool {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.adjusted) >= overloadInterval {
+		s.adjust(now)
+	}
+	ratio := s.ratio
+	s.mu.Unlock()
+
+	if ratio == 0 || rand.Float64() >= ratio {
+		return true
+	}
+	for _, prefix := range s.cfg.PriorityPaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe records the latency of a served request
+func (s *loadShedder) observe(latency time.Duration) {
+	bucket := len(overloadBuckets)
+	for i, bound := range overloadBuckets {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.rotate(time.Now())
+	s.histograms[s.slot][bucket]++
+	s.mu.Unlock()
+}
+
+// rotate moves to the histogram of the current slot, clearing the ones of
+// slots that left the window. Callers hold mu.
+func (s *loadShedder) rotate(now time.Time) {
+	slotLength := s.cfg.Window / overloadSlots
+	for i := 0; i < overloadSlots && now.Sub(s.slotStart) >= slotLength; i++ {
+		s.slot = (s.slot + 1) % overloadSlots
+		clear(s.histograms[s.slot])
+		s.slotStart = s.slotStart.Add(slotLength)
+	}
+	if now.Sub(s.slotStart) >= slotLength {
+		// Idle for longer than the window
+		s.slotStart = now
+	}
+}
+
+// adjust updates the shed ratio from the latency and CPU usage measured
+// since the last adjustment. Callers hold mu.
+func (s *loadShedder) adjust(now time.Time) {
+	s.rotate(now)
+	pressure := 0.0
+	latency := s.percentile(0.99)
+	if s.cfg.LatencyTarget > 0 && latency > 0 {
+		pressure = float64(latency) / float64(s.cfg.LatencyTarget)
+	}
+
+	elapsed := now.Sub(s.adjusted)
+	cpuTime := processCPUTime()
+	usage := float64(cpuTime-s.cpuTime) / (float64(elapsed) * float64(goruntime.GOMAXPROCS(0)))
+	s.cpuTime = cpuTime
+	if s.cfg.CPUTarget > 0 {
+		pressure = math.Max(pressure, usage/s.cfg.CPUTarget)
+	}
+	s.adjusted = now
+
+	previous := s.ratio
+	if pressure > 1 {
+		// Shedding 1 - 1/pressure of the load would bring it back to the
+		// target; half of that is added per interval to avoid overshooting
+		s.ratio = math.Min(s.cfg.MaxShedRatio, s.ratio+math.Max(overloadDecrease, (1-1/pressure)/2))
+	} else {
+		// Adjusted on requests, so after a quiet spell by the steps missed
+		steps := float64(elapsed) / float64(overloadInterval)
+		s.ratio = math.Max(0, s.ratio-overloadDecrease*steps)
+	}
+	metrics.SetOverload(s.ratio, latency, usage)
+
+	switch {
+	case previous == 0 && s.ratio > 0:
+		s.logger.Warn("Overloaded, shedding requests",
+			zap.Duration("p99_latency", latency),
+			zap.Float64("cpu_usage", usage),
+			zap.Float64("shed_ratio", s.ratio))
+	case previous > 0 && s.ratio == 0:
+		s.logger.Info("No longer overloaded, stopped shedding requests",
+			zap.Duration("p99_latency", latency),
+			zap.Float64("cpu_usage", usage))
+	}
+}
+
+// percentile returns the latency below which a fraction of the requests in
+// the window completed, or 0 with too few requests to tell. Callers hold mu.
+func (s *loadShedder) percentile(fraction float64) time.Duration {
+	counts := make([]uint64, len(overloadBuckets)+1)
+	var total uint64
+	for _, histogram := range s.histograms {
+		for i, count := range histogram {
+			counts[i] += count
+			total += count
+		}
+	}
+	if total < overloadMinSamples {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(fraction * float64(total)))
+	var seen uint64
+	for i, count := range counts {
+		seen += count
+		if seen >= rank {
+			if i == len(overloadBuckets) {
+				return time.Minute
+			}
+			return overloadBuckets[i]
+		}
+	}
+	return time.Minute
+}
+
+// reject answers a shed request: 503 with Retry-After, or UNAVAILABLE for
+// gRPC calls, which clients may retry
+func (s *loadShedder) reject(w http.ResponseWriter, r *http.Request) {
+	metrics.ObserveShed()
+	if isGRPC(r) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", grpcUnavailable)
+		w.Header().Set("Grpc-Message", "overloaded")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if s.cfg.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(s.cfg.RetryAfter.Seconds()))))
+	}
+	http.Error(w, "Service overloaded", http.StatusServiceUnavailable)
+}
+
+// processCPUTime returns the user and system CPU time used by the process
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
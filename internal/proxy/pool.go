@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"context"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"go.uber.org/zap"
+)
+
+// upstreamPool holds the connections to the targets of an upstream and the
+// reverse proxy of every target, shared by all requests. A pool whose
+// settings are unchanged is carried over on reload, so its connections
+// keep serving the new configuration.
+type upstreamPool struct {
+	name      string
+	settings  config.TransportConfig
+	tls       config.UpstreamTLSConfig
+	transport *http.Transport
+	grpc      *grpcTransport // nil unless the upstream has gRPC targets
+	proxies   sync.Map       // by proxyKey
+}
+
+// proxyKey identifies the reverse proxy of a target
+type proxyKey struct {
+	url  string
+	grpc bool
+}
+
+// proxyOptions carry the settings of the route serving a request to the
+// shared reverse proxies
+type proxyOptions struct {
+	maxResponseSize   int64            // 0 for no limit
+	timing            *serverTiming    // nil unless the route reports Server-Timing
+	outliers          *outlierDetector // nil unless the upstream detects outliers
+	propagateDeadline bool
+}
+
+// proxyOptionsKey is the request context key of the proxy options
+type proxyOptionsKey struct{}
+
+// withProxyOptions attaches the proxy options of a request
+func withProxyOptions(r *http.Request, options *proxyOptions) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), proxyOptionsKey{}, options))
+}
+
+// proxyOptionsFrom returns the proxy options of a request
+func proxyOptionsFrom(r *http.Request) *proxyOptions {
+	if options, ok := r.Context().Value(proxyOptionsKey{}).(*proxyOptions); ok {
+		return options
+	}
+	return &proxyOptions{}
+}
+
+// poolSettings returns the connection pool settings of an upstream, which
+// keep enough idle connections per target to hold prewarmed ones
+func poolSettings(service config.UpstreamService) config.TransportConfig {
+	settings := service.TransportSettings()
+	if service.Prewarm != nil {
+		settings.MaxIdleConnsPerHost = max(settings.MaxIdleConnsPerHost, service.Prewarm.Connections)
+	}
+	return settings
+}
+
+// newTransport creates the transport shared by the requests to an upstream.
+// tlsConfig may be nil for the defaults.
+func newTransport(settings config.TransportConfig, tlsConfig *gotls.Config) *http.Transport {
+	dialer := &net.Dialer{Timeout: settings.DialTimeout, KeepAlive: settings.KeepAlive}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		DisableKeepAlives:     settings.DisableKeepAlives,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		ExpectContinueTimeout: settings.ExpectContinueTimeout,
+	}
+}
+
+// upstreamTLSConfig loads the TLS settings of connections to the targets of
+// an upstream, nil for the defaults
+func upstreamTLSConfig(settings *config.UpstreamTLSConfig) (*gotls.Config, error) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	tlsConfig := &gotls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", settings.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if settings.CertFile != "" {
+		cert, err := gotls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []gotls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// pool returns the connection pool of an upstream, reusing the one of this
+// runtime when its settings are unchanged. rt may be nil.
+func (rt *runtime) pool(name string, service config.UpstreamService) (*upstreamPool, error) {
+	settings := poolSettings(service)
+	var tlsSettings config.UpstreamTLSConfig
+	if service.TLS != nil {
+		tlsSettings = *service.TLS
+	}
+	grpc := hasGRPCTargets(service)
+	if rt != nil {
+		if pool := rt.pools[name]; pool != nil && pool.settings == settings && pool.tls == tlsSettings && (pool.grpc != nil) == grpc {
+			return pool, nil
+		}
+	}
+
+	tlsConfig, err := upstreamTLSConfig(service.TLS)
+	if err != nil {
+		return nil, err
+	}
+	pool := &upstreamPool{
+		name:      name,
+		settings:  settings,
+		tls:       tlsSettings,
+		transport: newTransport(settings, tlsConfig),
+	}
+	if grpc {
+		pool.grpc = newGRPCTransport(settings, tlsConfig)
+	}
+	return pool, nil
+}
+
+// proxy returns the reverse proxy of a target, creating it on first use.
+// Targets found through discovery or target files get theirs when first
+// selected.
+func (p *upstreamPool) proxy(s *server, target *loadbalancer.Target) *httputil.ReverseProxy {
+	key := proxyKey{url: target.URL.String(), grpc: target.Protocol == config.ProtocolGRPC}
+	if proxy, ok := p.proxies.Load(key); ok {
+		return proxy.(*httputil.ReverseProxy)
+	}
+	proxy, _ := p.proxies.LoadOrStore(key, s.newTargetProxy(p, target))
+	return proxy.(*httputil.ReverseProxy)
+}
+
+// prebuild creates the reverse proxies of the configured http:// and
+// https:// targets up front
+func (p *upstreamPool) prebuild(s *server, service config.UpstreamService) {
+	for _, target := range service.AllTargets() {
+		targetURL, err := url.Parse(target.URL)
+		if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") {
+			continue
+		}
+		p.proxy(s, &loadbalancer.Target{URL: targetURL, Protocol: target.Protocol})
+	}
+}
+
+// prune drops the reverse proxies of targets whose URL is not in keep.
+// Requests still holding one finish with it.
+func (p *upstreamPool) prune(keep map[string]bool) {
+	p.proxies.Range(func(key, _ any) bool {
+		if !keep[key.(proxyKey).url] {
+			p.proxies.Delete(key)
+		}
+		return true
+	})
+}
+
+// newTargetProxy creates the reverse proxy of a target. gRPC targets are
+// reached over HTTP/2, and failed calls are answered with a gRPC status.
+func (s *server) newTargetProxy(pool *upstreamPool, target *loadbalancer.Target) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(target.URL)
+	grpc := target.Protocol == config.ProtocolGRPC
+
+	var transport http.RoundTripper = pool.transport
+	if grpc {
+		transport = pool.grpc
+	}
+	proxy.Transport = &proxyTransport{RoundTripper: transport}
+
+	// Propagate the remaining time of every attempt to the upstream
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		if proxyOptionsFrom(req).propagateDeadline {
+			setDeadlineHeaders(req)
+		}
+	}
+
+	// Count the responses of the target and abort runaway ones
+	key := target.URL.String()
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if outliers := proxyOptionsFrom(resp.Request).outliers; outliers != nil {
+			outliers.recordResponse(key, resp.StatusCode)
+		}
+		if limit := proxyOptionsFrom(resp.Request).maxResponseSize; limit > 0 {
+			return s.limitResponseSize(resp, limit, pool.name)
+		}
+		return nil
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		recordProxyError(r, err)
+		if outliers := proxyOptionsFrom(r).outliers; outliers != nil {
+			outliers.recordError(key, err)
+		}
+		if grpc && isGRPC(r) {
+			s.grpcError(w, r, pool.name, err)
+			return
+		}
+		if errors.Is(err, errResponseTooLarge) {
+			s.logger.Warn("Rejected upstream response exceeding max_response_size",
+				zap.String("upstream", pool.name),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+		} else {
+			s.logger.Error("Proxy error", zap.String("upstream", pool.name), zap.Error(err))
+		}
+		if isTimeout(err) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return proxy
+}
+
+// proxyTransport traces upstream attempts for routes reporting
+// Server-Timing
+type proxyTransport struct {
+	http.RoundTripper
+}
+
+// RoundTrip sends the request, with the route's client trace if any
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if timing := proxyOptionsFrom(req).timing; timing != nil {
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// closeIdleConnections closes the idle connections of the pool
+func (p *upstreamPool) closeIdleConnections() {
+	p.transport.CloseIdleConnections()
+	if p.grpc != nil {
+		p.grpc.CloseIdleConnections()
+	}
+}
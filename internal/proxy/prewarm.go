@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// prewarm opens connections to the targets of the upstreams that ask for it,
+// so the first requests served by a runtime skip TCP and TLS setup. It waits
+// for every upstream to finish or time out.
+func (s *server) prewarm(rt *runtime) {
+	var wg sync.WaitGroup
+	for name, service := range rt.cfg.Upstreams.Services {
+		if service.Prewarm == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, service config.UpstreamService) {
+			defer wg.Done()
+			s.prewarmUpstream(rt.pools[name].transport, rt.cfg, name, service)
+		}(name, service)
+	}
+	wg.Wait()
+}
+
+// prewarmUpstream warms every target of an upstream in parallel
+func (s *server) prewarmUpstream(transport *http.Transport, cfg *config.Config, name string, service config.UpstreamService) {
+	settings := service.Prewarm
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	targets := s.upstreamTargets(cfg, name)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	warmed := 0
+	for _, target := range targets {
+		wg.Add(1)
+		go func(targetURL string) {
+			defer wg.Done()
+			succeeded, err := warmTarget(ctx, transport, targetURL, settings)
+			if err != nil {
+				s.logger.Warn("Failed to prewarm target",
+					zap.String("upstream", name),
+					zap.String("target", targetURL),
+					zap.Int("requests", succeeded),
+					zap.Error(err))
+			}
+			mu.Lock()
+			warmed += succeeded
+			mu.Unlock()
+		}(target.URL.String())
+	}
+	wg.Wait()
+
+	s.logger.Info("Prewarmed upstream",
+		zap.String("upstream", name),
+		zap.Int("targets", len(targets)),
+		zap.Int("requests", warmed),
+		zap.Duration("duration", time.Since(start)))
+}
+
+// warmTarget sends the warm-up requests to a target, as many at once as
+// connections should be opened, so each worker holds its own connection.
+// The connections stay in the transport's idle pool afterwards. It returns
+// the number of requests that succeeded and the first error.
+func warmTarget(ctx context.Context, transport *http.Transport, targetURL string, settings *config.PrewarmConfig) (int, error) {
+	total := max(settings.Requests, settings.Connections)
+	requests := make(chan struct{}, total)
+	for range total {
+		requests <- struct{}{}
+	}
+	close(requests)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	var firstErr error
+	for range settings.Connections {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range requests {
+				err := warmRequest(ctx, transport, targetURL+settings.Path, settings.Method)
+				mu.Lock()
+				if err == nil {
+					succeeded++
+				} else if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return succeeded, firstErr
+}
+
+// warmRequest sends a single warm-up request. Any response counts, since
+// the connection is open either way; the body is drained so the connection
+// can be reused.
+func warmRequest(ctx context.Context, transport *http.Transport, url, method string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "sentinel-prewarm")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// closeIdleConnections releases the idle connections of a runtime that no
+// longer serves requests, except those of pools carried over to next.
+// Connections still in use are closed once their requests finish and they
+// exceed the idle timeout.
+func (rt *runtime) closeIdleConnections(next *runtime) {
+	for name, pool := range rt.pools {
+		if next.pools[name] != pool {
+			pool.closeIdleConnections()
+		}
+	}
+}
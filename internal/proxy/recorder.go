@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/accesslog"
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/metrics"
+)
+
+// requestRecorder captures the status and size of a response for the
+// request metrics and the access log
+type requestRecorder struct {
+	http.ResponseWriter
+	start    time.Time
+	uri      string // as sent by the client, before rewrites
+	route    string
+	upstream string
+	status   int
+	bytes    int64
+	body     *countingBody // nil when the request size is known up front
+}
+
+// newRequestRecorder starts recording a request that matched route, which
+// is nil when no route matched
+func newRequestRecorder(w http.ResponseWriter, r *http.Request, matched *route) *requestRecorder {
+	recorder := &requestRecorder{ResponseWriter: w, start: time.Now(), uri: r.RequestURI}
+	if matched != nil {
+		recorder.route = matched.rule.Host + matched.rule.Path
+		recorder.upstream = matched.rule.Upstream
+	}
+	// Bodies of unknown length are counted as they are read
+	if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+		recorder.body = &countingBody{ReadCloser: r.Body}
+		r.Body = recorder.body
+	}
+	return recorder
+}
+
+// WriteHeader records the status code
+func (rr *requestRecorder) WriteHeader(statusCode int) {
+	if rr.status == 0 {
+		rr.status = statusCode
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records an implicit 200 status and counts the bytes written
+func (rr *requestRecorder) Write(data []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(data)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the response, so streamed responses are not held back
+func (rr *requestRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish records the finished request in the metrics and the access log
+// of the runtime that served it
+func (rr *requestRecorder) finish(rt *runtime, r *http.Request) {
+	duration := time.Since(rr.start)
+	status := rr.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	requestBytes := r.ContentLength
+	if rr.body != nil {
+		requestBytes = rr.body.n
+	}
+
+	if rt.cfg.Metrics.Enabled {
+		metrics.ObserveRequest(rr.route, rr.upstream, r.Method, status, requestBytes, rr.bytes, duration)
+	}
+	if rt.accessLog != nil {
+		listener, _ := r.Context().Value(listenerContextKey{}).(string)
+		rt.accessLog.Log(&accesslog.Entry{
+			Time:        rr.start,
+			Listener:    listener,
+			RemoteAddr:  r.RemoteAddr,
+			ClientIP:    clientip.FromRequest(r),
+			Method:      r.Method,
+			Host:        r.Host,
+			URI:         rr.uri,
+			Proto:       r.Proto,
+			Status:      status,
+			Size:        rr.bytes,
+			RequestSize: requestBytes,
+			Duration:    duration,
+			Referer:     r.Referer(),
+			UserAgent:   r.UserAgent(),
+			Route:       rr.route,
+			Upstream:    rr.upstream,
+			Header:      r.Header,
+		})
+	}
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read reads from the body and counts the bytes read
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
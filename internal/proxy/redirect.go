@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acmeChallengePrefix is where ACME http-01 challenges are served, which
+// must stay reachable over HTTP
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// redirectsToHTTPS reports whether a request is redirected to HTTPS: it
+// arrived on the HTTP port, and its route, or else the global setting, asks
+// for it. matched may be nil.
+func (rt *runtime) redirectsToHTTPS(r *http.Request, matched *route) bool {
+	if listener, _ := r.Context().Value(listenerContextKey{}).(string); listener != listenerKey("HTTP") {
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+		return false
+	}
+	if matched != nil && matched.rule.RedirectHTTPToHTTPS != nil {
+		return *matched.rule.RedirectHTTPToHTTPS
+	}
+	return rt.cfg.Global.Server.RedirectHTTPToHTTPS.Enabled
+}
+
+// redirectToHTTPS redirects a request to the same URL over HTTPS
+func (rt *runtime) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	redirect := rt.cfg.Global.Server.RedirectHTTPToHTTPS
+
+	host := redirect.Host
+	if host == "" {
+		host = r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.Trim(host, "[]")
+
+		port := redirect.Port
+		if port == 0 {
+			port = rt.cfg.Global.Server.HTTPSPort
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+
+	target := "https://" + host + r.URL.RequestURI()
+	http.Redirect(w, r, target, redirect.StatusCode)
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// requestBody is a request body read in full, so it can be sent again: the
+// bytes up to the memory limit are held in memory, and the rest in a
+// temporary file. Every holder, the request and each mirrored copy in
+// flight, releases it; the last one closes the file.
+type requestBody struct {
+	memory []byte
+	file   *os.File // nil unless the body spilled over
+	size   int64
+	refs   atomic.Int32
+}
+
+// newRequestBody creates a body held by its creator
+func newRequestBody(memory []byte, file *os.File, size int64) *requestBody {
+	body := &requestBody{memory: memory, file: file, size: size}
+	body.refs.Store(1)
+	return body
+}
+
+// reader returns a reader of the whole body. Readers are independent, so
+// retries and mirrored copies may read the body at the same time.
+func (b *requestBody) reader() io.ReadCloser {
+	if b.size == 0 {
+		return http.NoBody
+	}
+	if b.file == nil {
+		return io.NopCloser(bytes.NewReader(b.memory))
+	}
+	spilled := io.NewSectionReader(b.file, 0, b.size-int64(len(b.memory)))
+	return io.NopCloser(io.MultiReader(bytes.NewReader(b.memory), spilled))
+}
+
+// retain adds a holder of the body
+func (b *requestBody) retain() {
+	b.refs.Add(1)
+}
+
+// release drops a holder of the body, closing its file after the last
+func (b *requestBody) release() {
+	if b.refs.Add(-1) == 0 && b.file != nil {
+		b.file.Close()
+	}
+}
+
+// withRequestBody wraps the handler proxying a route's requests, reading
+// their body in full first, so retries and mirrored copies send it again,
+// and copying a sample of them to the shadow upstream. gRPC calls stream
+// their messages.
+func (s *server) withRequestBody(rt *runtime, matched *route, next http.Handler) http.Handler {
+	buffering := matched.rule.RequestBuffering
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body *requestBody
+		if buffering != nil && !isGRPC(r) {
+			if buffered, ok := s.bufferRequestBody(r, buffering.MemoryLimit, buffering.MaxSize, buffering.TempDir); ok {
+				body = buffered
+				defer body.release()
+			}
+		}
+
+		if matched.mirror != nil {
+			s.mirrorRequest(rt, matched.mirror, r, body)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bufferRequestBody reads the body of a request, up to maxSize bytes of
+// which the first memoryLimit are held in memory and the rest in a
+// temporary file in dir, and replaces it with a reader of the same content
+// that GetBody returns anew. It reports false, with the body left readable
+// in full, when the body is larger, fails to read, or cannot spill over.
+// The caller releases the body.
+func (s *server) bufferRequestBody(r *http.Request, memoryLimit, maxSize int64, dir string) (*requestBody, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return newRequestBody(nil, nil, 0), true
+	}
+	if r.ContentLength > maxSize {
+		return nil, false
+	}
+
+	original := r.Body
+	memory, err := io.ReadAll(io.LimitReader(original, memoryLimit))
+	if err != nil {
+		r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(memory), original), Closer: original}
+		return nil, false
+	}
+
+	// Bodies filling the memory limit may go on
+	var file *os.File
+	size := int64(len(memory))
+	if size == memoryLimit {
+		var next [1]byte
+		n, err := original.Read(next[:])
+		for n == 0 && err == nil {
+			n, err = original.Read(next[:])
+		}
+		switch {
+		case n == 0 && err != io.EOF:
+			r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(memory), original), Closer: original}
+			return nil, false
+		case n > 0 && maxSize == memoryLimit:
+			r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(memory), bytes.NewReader(next[:]), original), Closer: original}
+			return nil, false
+		case n > 0:
+			file, err = os.CreateTemp(dir, "sentinel-body-*")
+			if err != nil {
+				s.logger.Error("Failed to create request body spill file", zap.String("dir", dir), zap.Error(err))
+				r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(memory), bytes.NewReader(next[:]), original), Closer: original}
+				return nil, false
+			}
+			// Unlinked at once, so the file is gone even if the proxy dies
+			os.Remove(file.Name())
+
+			spilled, err := io.Copy(file, io.MultiReader(bytes.NewReader(next[:]), io.LimitReader(original, maxSize-memoryLimit)))
+			size += spilled
+			if err != nil || size > maxSize {
+				// Bytes may be lost when the copy fails, so the body fails too
+				var rest io.Reader = original
+				if err != nil {
+					rest = failingReader{err}
+				}
+				partial := newRequestBody(memory, file, size)
+				r.Body = &replayBody{
+					Reader: io.MultiReader(partial.reader(), rest),
+					Closer: closeFunc(func() error {
+						partial.release()
+						return original.Close()
+					}),
+				}
+				return nil, false
+			}
+		}
+	}
+
+	original.Close()
+	body := newRequestBody(memory, file, size)
+	r.Body = body.reader()
+	r.GetBody = func() (io.ReadCloser, error) { return body.reader(), nil }
+	r.ContentLength = size
+	r.TransferEncoding = nil
+	// The client was told to continue when the body was read
+	r.Header.Del("Expect")
+	return body, true
+}
+
+// replayBody serves request body bytes read ahead and closes the original
+// body
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// failingReader fails every read
+type failingReader struct {
+	err error
+}
+
+// Read returns the error
+func (f failingReader) Read([]byte) (int, error) {
+	return 0, f.err
+}
+
+// closeFunc closes with a function
+type closeFunc func() error
+
+// Close calls the function
+func (f closeFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// errResponseTooLarge reports an upstream response over the route's limit
+var errResponseTooLarge = errors.New("upstream response exceeds max_response_size")
+
+// limitResponseSize aborts an upstream response larger than limit bytes.
+// Responses that declare a larger Content-Length are replaced by a 502
+// before anything is sent; others are cut off, and the client connection
+// aborted, once the limit is crossed.
+func (s *server) limitResponseSize(resp *http.Response, limit int64, upstream string) error {
+	if resp.ContentLength > limit {
+		return fmt.Errorf("%w: Content-Length %d, limit %d", errResponseTooLarge, resp.ContentLength, limit)
+	}
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		remaining:  limit,
+		exceeded: func() {
+			s.logger.Warn("Aborted upstream response exceeding max_response_size",
+				zap.String("upstream", upstream),
+				zap.String("path", resp.Request.URL.Path),
+				zap.Int64("limit", limit))
+		},
+	}
+	return nil
+}
+
+// limitedBody fails reads once more than the allowed bytes were read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		b.exceeded()
+		return 0, errResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"github.com/bpradana/sentinel/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// retryConditions decide which failed attempts are retried
+type retryConditions struct {
+	connectFailure bool
+	serverError    bool // any 5xx status
+	gatewayError   bool // 502, 503 or 504
+	timeout        bool
+	statuses       map[int]bool
+}
+
+// newRetryConditions parses the retry_on conditions of a retry policy,
+// which default to 5xx
+func newRetryConditions(retryOn []string) retryConditions {
+	if len(retryOn) == 0 {
+		retryOn = []string{config.RetryOn5xx}
+	}
+
+	var conditions retryConditions
+	for _, condition := range retryOn {
+		switch condition {
+		case config.RetryOnConnectFailure:
+			conditions.connectFailure = true
+		case config.RetryOn5xx:
+			conditions.serverError = true
+		case config.RetryOnGatewayError:
+			conditions.gatewayError = true
+		case config.RetryOnTimeout:
+			conditions.timeout = true
+		default:
+			// Validation only lets status codes through
+			if status, err := strconv.Atoi(condition); err == nil {
+				if conditions.statuses == nil {
+					conditions.statuses = make(map[int]bool)
+				}
+				conditions.statuses[status] = true
+			}
+		}
+	}
+	return conditions
+}
+
+// matches reports whether an attempt answered with status is retried. err
+// is the error the attempt failed to reach the upstream with, if any.
+func (c retryConditions) matches(status int, err error) bool {
+	switch {
+	case c.statuses[status]:
+		return true
+	case c.serverError && status >= 500:
+		return true
+	case c.gatewayError && (status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout):
+		return true
+	case c.connectFailure && isConnectFailure(err):
+		return true
+	case c.timeout && isTimeout(err):
+		return true
+	}
+	return false
+}
+
+// isConnectFailure reports whether err is a failure to connect to a target
+func isConnectFailure(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTimeout reports whether err is an attempt running out of time
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// proxyAttempt records which target an attempt through the reverse proxy
+// went to and why it failed
+type proxyAttempt struct {
+	err    error
+	target string
+	failed map[string]bool // targets of the earlier attempts, by URL
+}
+
+// proxyAttemptKey is the request context key of the current attempt
+type proxyAttemptKey struct{}
+
+// recordProxyError records the error an attempt failed with, for the retry
+// handler to classify
+func recordProxyError(r *http.Request, err error) {
+	if attempt, ok := r.Context().Value(proxyAttemptKey{}).(*proxyAttempt); ok {
+		attempt.err = err
+	}
+}
+
+// targetHandler sends the attempts of a request to the upstream: the first
+// to the selected target, and retries to one of the targets in rotation
+// that no earlier attempt failed on, while any is left
+type targetHandler struct {
+	server   *server
+	pool     *upstreamPool
+	lb       loadbalancer.LoadBalancer
+	upstream string
+	targets  []*loadbalancer.Target
+	target   *loadbalancer.Target
+}
+
+func (h *targetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := h.target
+	if attempt, ok := r.Context().Value(proxyAttemptKey{}).(*proxyAttempt); ok {
+		if attempt.failed[target.URL.String()] {
+			target = h.reselect(r, attempt.failed)
+		}
+		attempt.target = target.URL.String()
+	}
+
+	// Count the attempt against its target, whose drain may cancel it
+	r, done := h.server.beginRequest(r, h.upstream, target.URL.String())
+	defer done()
+
+	// Update target connection count
+	h.lb.UpdateTarget(target, 1)
+	defer h.lb.UpdateTarget(target, -1)
+
+	h.pool.proxy(h.server, target).ServeHTTP(w, r)
+}
+
+// reselect selects the target of a retry among those that did not fail,
+// falling back to the first attempt's target when all did
+func (h *targetHandler) reselect(r *http.Request, failed map[string]bool) *loadbalancer.Target {
+	remaining := make([]*loadbalancer.Target, 0, len(h.targets))
+	for _, target := range h.targets {
+		if !failed[target.URL.String()] {
+			remaining = append(remaining, target)
+		}
+	}
+	if len(remaining) == 0 {
+		return h.target
+	}
+	target, err := h.lb.SelectTarget(remaining, r)
+	if err != nil {
+		return h.target
+	}
+	return target
+}
+
+// createRetryMiddleware creates a middleware that implements retry logic.
+// The budget, when not nil, bounds the retries sent to the upstream.
+func (s *server) createRetryMiddleware(handler http.Handler, retryPolicy *config.RetryPolicy, conditions retryConditions, upstream string, budget *retryBudget) http.Handler {
+	return &retryHandler{
+		handler:     handler,
+		retryPolicy: retryPolicy,
+		conditions:  conditions,
+		upstream:    upstream,
+		budget:      budget,
+		logger:      s.logger,
+	}
+}
+
+// retryHandler implements retry logic for failed requests. Responses of
+// attempts that are retried never reach the client.
+type retryHandler struct {
+	handler     http.Handler
+	retryPolicy *config.RetryPolicy
+	conditions  retryConditions
+	upstream    string
+	budget      *retryBudget
+	logger      *zap.Logger
+}
+
+func (rh *retryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var failed map[string]bool
+	for attempt := 0; ; attempt++ {
+		result := &proxyAttempt{failed: failed}
+		ctx := context.WithValue(r.Context(), proxyAttemptKey{}, result)
+		cancel := context.CancelFunc(func() {})
+		if rh.retryPolicy.PerTryTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, rh.retryPolicy.PerTryTimeout)
+		}
+
+		retried := false
+		aw := newAttemptWriter(w, func(status int) bool {
+			retried = rh.shouldRetry(r, attempt, status, result.err)
+			return retried
+		})
+		attemptRequest := r.WithContext(ctx)
+		if attempt > 0 && r.GetBody != nil {
+			// The previous attempt consumed the body
+			if body, err := r.GetBody(); err == nil {
+				attemptRequest.Body = body
+			}
+		}
+		rh.handler.ServeHTTP(aw, attemptRequest)
+		cancel()
+
+		if !retried {
+			if attempt > 0 {
+				rh.logger.Info("Request succeeded after retries",
+					zap.Int("attempts", attempt+1),
+					zap.Int("status", aw.status))
+			}
+			return
+		}
+
+		// The next attempt goes to another target when one is left
+		if failed == nil {
+			failed = make(map[string]bool)
+		}
+		failed[result.target] = true
+
+		metrics.ObserveRetry(rh.upstream, true)
+		rh.logger.Warn("Request failed, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Int("max_attempts", rh.retryPolicy.Attempts+1),
+			zap.Int("status", aw.status),
+			zap.Error(result.err),
+			zap.Duration("backoff", rh.retryPolicy.Backoff))
+
+		// Wait before retrying, unless the request is gone by then
+		timer := time.NewTimer(rh.retryPolicy.Backoff)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+		}
+	}
+}
+
+// shouldRetry decides whether an attempt answered with status is retried:
+// attempts are left, the request still has time, its body can be sent
+// again, the retry conditions match, and the upstream's retry budget
+// allows it
+func (rh *retryHandler) shouldRetry(r *http.Request, attempt, status int, err error) bool {
+	if attempt >= rh.retryPolicy.Attempts || r.Context().Err() != nil || !replayable(r) || !rh.conditions.matches(status, err) {
+		return false
+	}
+	if rh.budget != nil && !rh.budget.tryRetry() {
+		metrics.ObserveRetry(rh.upstream, false)
+		rh.logger.Warn("Retry budget exhausted, not retrying",
+			zap.String("upstream", rh.upstream),
+			zap.Int("attempt", attempt+1),
+			zap.Int("status", status))
+		return false
+	}
+	return true
+}
+
+// replayable reports whether the body of a request can be sent again: it
+// has none, or it was buffered
+func replayable(r *http.Request) bool {
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// attemptWriter holds back the headers of an attempt until its status shows
+// whether it is retried. Responses of retried attempts are discarded;
+// others are passed on as they are written.
+type attemptWriter struct {
+	w       http.ResponseWriter
+	header  http.Header
+	retry   func(status int) bool
+	status  int
+	passed  bool // the response goes to the client
+	discard bool // the attempt is retried
+}
+
+// newAttemptWriter creates the writer of an attempt. retry is asked once,
+// with the status of the response.
+func newAttemptWriter(w http.ResponseWriter, retry func(status int) bool) *attemptWriter {
+	return &attemptWriter{w: w, header: w.Header().Clone(), retry: retry}
+}
+
+// Header returns the headers of the attempt, which are the client's once
+// the response is passed on, so trailers reach it
+func (a *attemptWriter) Header() http.Header {
+	if a.passed {
+		return a.w.Header()
+	}
+	return a.header
+}
+
+func (a *attemptWriter) WriteHeader(statusCode int) {
+	if a.status != 0 {
+		return
+	}
+	// Informational responses precede the final one
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		a.copyHeader()
+		a.w.WriteHeader(statusCode)
+		return
+	}
+
+	a.status = statusCode
+	if a.retry(statusCode) {
+		a.discard = true
+		return
+	}
+	a.copyHeader()
+	a.passed = true
+	a.w.WriteHeader(statusCode)
+}
+
+// copyHeader replaces the client's headers by those of the attempt
+func (a *attemptWriter) copyHeader() {
+	header := a.w.Header()
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range a.header {
+		header[name] = values
+	}
+}
+
+func (a *attemptWriter) Write(data []byte) (int, error) {
+	if a.status == 0 {
+		a.WriteHeader(http.StatusOK)
+	}
+	if a.discard {
+		return len(data), nil
+	}
+	return a.w.Write(data)
+}
+
+// Flush flushes the response, so streamed responses are not held back
+func (a *attemptWriter) Flush() {
+	if a.status == 0 {
+		a.WriteHeader(http.StatusOK)
+	}
+	if a.discard {
+		return
+	}
+	if flusher, ok := a.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the client's writer, for upgraded connections
+func (a *attemptWriter) Unwrap() http.ResponseWriter {
+	return a.w
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// retryBudget caps the retries sent to an upstream to a share of its
+// requests over a sliding window of one-second buckets
+type retryBudget struct {
+	cfg config.RetryBudgetConfig
+
+	mu      sync.Mutex
+	buckets []budgetBucket
+}
+
+// budgetBucket counts the requests and retries of one second
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// newRetryBudget creates an empty retry budget
+func newRetryBudget(cfg config.RetryBudgetConfig) *retryBudget {
+	size := int((cfg.Window + time.Second - 1) / time.Second)
+	return &retryBudget{cfg: cfg, buckets: make([]budgetBucket, max(size, 1))}
+}
+
+// retryBudget returns the retry budget of an upstream, keeping the budget of
+// the previous runtime, and the traffic it saw, when its settings are
+// unchanged
+func (rt *runtime) retryBudget(upstream string, cfg config.RetryBudgetConfig) *retryBudget {
+	if rt != nil {
+		if budget := rt.retryBudgets[upstream]; budget != nil && budget.cfg == cfg {
+			return budget
+		}
+	}
+	return newRetryBudget(cfg)
+}
+
+// bucket returns the bucket of the current second. Callers hold mu.
+func (b *retryBudget) bucket(now int64) *budgetBucket {
+	bucket := &b.buckets[now%int64(len(b.buckets))]
+	if bucket.second != now {
+		*bucket = budgetBucket{second: now}
+	}
+	return bucket
+}
+
+// recordRequest counts a request sent to the upstream
+func (b *retryBudget) recordRequest() {
+	now := time.Now().Unix()
+	b.mu.Lock()
+	b.bucket(now).requests++
+	b.mu.Unlock()
+}
+
+// tryRetry reports whether a retry fits in the budget, counting it if so.
+// The retries allowed are the larger of min_retries and percent of the
+// requests in the window.
+func (b *retryBudget) tryRetry() bool {
+	now := time.Now().Unix()
+	oldest := now - int64(len(b.buckets))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var requests, retries int
+	for _, bucket := range b.buckets {
+		if bucket.second > oldest && bucket.second <= now {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	allowed := max(float64(b.cfg.MinRetries), float64(requests)*b.cfg.Percent/100)
+	if float64(retries) >= allowed {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
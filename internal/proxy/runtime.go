@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/bpradana/sentinel/internal/accesslog"
+	"github.com/bpradana/sentinel/internal/clientip"
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"github.com/bpradana/sentinel/internal/middleware"
+	"github.com/bpradana/sentinel/internal/router"
+	"github.com/bpradana/sentinel/internal/slo"
+	"github.com/bpradana/sentinel/internal/sticky"
+	"go.uber.org/zap"
+)
+
+// runtime holds the complete request-serving state built from a single
+// configuration. A runtime is immutable once built and is swapped as a whole
+// on reload, so requests never observe a partially applied configuration.
+// A replaced runtime is retired: its middleware and sessions are closed once
+// the requests it serves are done.
+type runtime struct {
+	cfg           *config.Config
+	loadBalancers map[string]loadbalancer.LoadBalancer
+	pools         map[string]*upstreamPool    // by upstream
+	sessions      map[string]*sticky.Sessions // by upstream with sticky sessions
+	retryBudgets  map[string]*retryBudget     // by upstream with a retry budget
+	outliers      map[string]*outlierDetector // by upstream with outlier detection
+	routes        []*route
+	router        *router.Router
+	handler       http.Handler
+	catalog       *apiCatalog       // nil unless the API catalog is enabled
+	observability bool              // whether any route overrides observability
+	serverTiming  bool              // whether any route reports Server-Timing
+	httpsRedirect bool              // whether any request may be redirected to HTTPS
+	accessLog     *accesslog.Logger // nil unless access logs are enabled
+	shedder       *loadShedder      // nil unless overload protection is enabled
+
+	trustedCallers []*net.IPNet // callers whose deadline headers are honored
+	clientIP       *clientip.Resolver
+
+	closers []io.Closer // middleware and sessions closed with the runtime
+	logger  *zap.Logger
+
+	drainMu  sync.Mutex
+	requests int  // requests being served
+	retired  bool // whether requests are served by another runtime
+}
+
+// route pairs a routing rule with its prebuilt middleware chain
+type route struct {
+	rule   config.RouteRule
+	chain  *middleware.Chain
+	slo    *slo.Tracker // nil unless the route has objectives
+	mirror *mirror      // nil unless the route mirrors traffic
+
+	retryOn retryConditions
+}
+
+// buildRuntime builds a new runtime from the given configuration without
+// touching the currently active one
+func (s *server) buildRuntime(cfg *config.Config) (rt *runtime, err error) {
+	var built *runtime
+	defer func() {
+		if r := recover(); r != nil {
+			rt = nil
+			err = fmt.Errorf("panic while building runtime: %v", r)
+		}
+		// Release what a failed build has created
+		if err != nil && built != nil {
+			built.close()
+		}
+	}()
+
+	rt = &runtime{
+		cfg:           cfg,
+		loadBalancers: make(map[string]loadbalancer.LoadBalancer),
+		pools:         make(map[string]*upstreamPool),
+		sessions:      make(map[string]*sticky.Sessions),
+		retryBudgets:  make(map[string]*retryBudget),
+		outliers:      make(map[string]*outlierDetector),
+		httpsRedirect: cfg.Global.Server.RedirectHTTPToHTTPS.Enabled,
+		logger:        s.logger,
+	}
+	built = rt
+	previous := s.runtime.Load()
+
+	rt.trustedCallers, err = trustedNetworks(cfg.Global.Server.Deadlines.TrustedCallers)
+	if err != nil {
+		return nil, err
+	}
+
+	rt.clientIP, err = clientip.NewResolver(cfg.Global.Server.ClientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Global.AccessLog.Enabled {
+		if rt.accessLog, err = accesslog.New(cfg.Global.AccessLog, s.accessLogs); err != nil {
+			return nil, fmt.Errorf("failed to create access log: %w", err)
+		}
+	}
+
+	rt.shedder = previous.loadShedder(cfg.Global.Server.Overload, s.logger)
+
+	// Initialize load balancers
+	factory := &loadbalancer.DefaultFactory{}
+	for name, service := range cfg.Upstreams.Services {
+		lb, err := factory.Create(service.LoadBalancer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create load balancer for %s: %w", name, err)
+		}
+		rt.loadBalancers[name] = lb
+		if rt.pools[name], err = previous.pool(name, service); err != nil {
+			return nil, fmt.Errorf("failed to create connection pool for %s: %w", name, err)
+		}
+		rt.pools[name].prebuild(s, service)
+		if service.Sticky != nil {
+			rt.sessions[name], err = sticky.New(name, *service.Sticky, s.logger)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create sticky sessions for %s: %w", name, err)
+			}
+			rt.own(rt.sessions[name])
+		}
+		if service.RetryBudget != nil {
+			rt.retryBudgets[name] = previous.retryBudget(name, *service.RetryBudget)
+		}
+		if service.OutlierDetection != nil {
+			rt.outliers[name] = previous.outlierDetector(name, *service.OutlierDetection, s.logger)
+		}
+		s.logger.Debug("Initialized load balancer",
+			zap.String("upstream", name),
+			zap.String("strategy", service.LoadBalancer))
+	}
+
+	// Create named middleware instances shared by all routes referencing them
+	named := make(map[string]middleware.Middleware)
+	definitions := make(map[string]config.MiddlewareChain)
+	for _, mw := range cfg.Middleware.Chain {
+		if !mw.Enabled {
+			continue
+		}
+		instance, err := s.middlewareFactory.Create(mw.Type, mw.Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create middleware %s: %w", mw.Name, err)
+		}
+		rt.own(instance)
+		named[mw.Name] = instance
+		definitions[mw.Name] = mw
+	}
+
+	// Build route middleware chains
+	for i, rule := range cfg.Routes.Rules {
+		chain := middleware.NewChain(s.logger)
+		for _, ref := range rule.Middleware {
+			instance, exists := named[ref.Name]
+			if !exists {
+				continue
+			}
+			// Routes overriding options get their own instance
+			if len(ref.Config) > 0 {
+				definition := definitions[ref.Name]
+				instance, err = s.middlewareFactory.Create(definition.Type, config.MergeMiddlewareConfig(definition.Config, ref.Config))
+				if err != nil {
+					return nil, fmt.Errorf("failed to create middleware %s for route %d: %w", ref.Name, i, err)
+				}
+				rt.own(instance)
+			}
+			chain.Use(instance)
+		}
+		if len(rule.Headers) > 0 {
+			chain.Use(s.createHeadersMiddleware(rule.Headers))
+		}
+		rt.observability = rt.observability || rule.Observability != nil
+		rt.serverTiming = rt.serverTiming || rule.ServerTiming
+		rt.httpsRedirect = rt.httpsRedirect || rule.RedirectHTTPToHTTPS != nil
+		r := &route{rule: rule, chain: chain, retryOn: newRetryConditions(rule.RetryPolicy.RetryOn)}
+		if rule.SLO != nil {
+			r.slo = slo.For(*rule.SLO, cfg.Global.SLO)
+		}
+		if rule.Mirror != nil {
+			r.mirror = newMirror(*rule.Mirror)
+		}
+		rt.routes = append(rt.routes, r)
+	}
+
+	// Compile the routes into a router
+	rules := make([]router.Rule, len(rt.routes))
+	for i, r := range rt.routes {
+		rules[i] = router.Rule{
+			Host:     r.rule.Host,
+			Path:     r.rule.Path,
+			Methods:  r.rule.Methods,
+			Headers:  config.RouterConditions(r.rule.HeadersMatch),
+			Query:    config.RouterConditions(r.rule.QueryMatch),
+			Priority: r.rule.Priority,
+		}
+	}
+	if rt.router, err = router.New(rules); err != nil {
+		return nil, fmt.Errorf("failed to compile routes: %w", err)
+	}
+
+	// Apply global middleware
+	globalChain, err := s.middlewareFactory.CreateChain(&cfg.Middleware)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create global middleware chain: %w", err)
+	}
+	rt.own(globalChain)
+	rt.catalog = s.newAPICatalog(rt)
+	rt.handler = globalChain.Then(s.createMainHandler(rt))
+
+	return rt, nil
+}
+
+// own closes v with the runtime if it holds resources
+func (rt *runtime) own(v any) {
+	if closer, ok := v.(io.Closer); ok {
+		rt.closers = append(rt.closers, closer)
+	}
+}
+
+// enterRuntime returns the active runtime, counting a request it serves
+func (s *server) enterRuntime() *runtime {
+	for {
+		// A runtime retired since it was loaded serves no new requests
+		if rt := s.runtime.Load(); rt.enter() {
+			return rt
+		}
+	}
+}
+
+// enter counts a request served by the runtime, unless it is retired
+func (rt *runtime) enter() bool {
+	rt.drainMu.Lock()
+	defer rt.drainMu.Unlock()
+
+	if rt.retired {
+		return false
+	}
+	rt.requests++
+	return true
+}
+
+// leave ends a request counted by enter
+func (rt *runtime) leave() {
+	rt.drainMu.Lock()
+	rt.requests--
+	drained := rt.retired && rt.requests == 0
+	rt.drainMu.Unlock()
+
+	if drained {
+		rt.close()
+	}
+}
+
+// retire stops the runtime from taking requests, and closes it once the
+// requests it serves are done
+func (rt *runtime) retire() {
+	rt.drainMu.Lock()
+	if rt.retired {
+		rt.drainMu.Unlock()
+		return
+	}
+	rt.retired = true
+	drained := rt.requests == 0
+	rt.drainMu.Unlock()
+
+	if drained {
+		rt.close()
+	}
+}
+
+// close closes the middleware and sessions of the runtime
+func (rt *runtime) close() {
+	for _, closer := range rt.closers {
+		if err := closer.Close(); err != nil {
+			rt.logger.Warn("Failed to close runtime resources", zap.Error(err))
+		}
+	}
+}
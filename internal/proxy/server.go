@@ -2,31 +2,62 @@ package proxy
 
 import (
 	"context"
+	gotls "crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"os"
+	"reflect"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"regexp"
-
+	"github.com/bpradana/sentinel/internal/accesslog"
+	"github.com/bpradana/sentinel/internal/clientip"
 	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/discovery"
 	"github.com/bpradana/sentinel/internal/health"
 	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"github.com/bpradana/sentinel/internal/metrics"
 	"github.com/bpradana/sentinel/internal/middleware"
 	"github.com/bpradana/sentinel/internal/tls"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+// drainTimeout bounds how long a replaced server may finish in-flight requests
+const drainTimeout = 30 * time.Second
+
 type Server interface {
 	// Start starts the proxy server
 	Start() error
+	// Check builds the routes, load balancers, middleware and TLS
+	// configuration without serving, to verify a configuration
+	Check() error
 	// Shutdown shuts down the proxy server
 	Shutdown(ctx context.Context) error
 	// UpdateConfig updates the proxy server configuration
 	UpdateConfig(config *config.Config) error
+	// SetTargetState takes a target out of rotation or puts it back
+	SetTargetState(upstream, targetURL string, state TargetState, reason string)
+	// GetTargetState returns the state assigned to a target
+	GetTargetState(upstream, targetURL string) TargetState
+	// TargetOverrides returns the targets taken out of rotation
+	TargetOverrides() []TargetOverride
+	// SwitchUpstream makes a blue/green target set of an upstream active
+	SwitchUpstream(upstream, color string) (*SwitchStatus, error)
+	// BlueGreenStatus returns the blue/green state of an upstream
+	BlueGreenStatus(upstream string) *SwitchStatus
+	// Explain reports how a request would be routed without proxying it
+	Explain(r *http.Request) *RouteMatch
+	// ReloadCertificates reloads the manual TLS certificates from disk
+	ReloadCertificates() error
+	// Certificates describes the loaded manual TLS certificates
+	Certificates() []tls.CertificateInfo
 }
 
 type server struct {
@@ -36,17 +67,47 @@ type server struct {
 	logger        *zap.Logger
 
 	// HTTP server
-	httpServer *http.Server
+	httpServer   *http.Server
+	httpListener *boundListener
 
 	// HTTPS server
-	httpsServer *http.Server
+	httpsServer   *http.Server
+	httpsListener *boundListener
 
-	// Load balancers for each upstream
-	loadBalancers map[string]loadbalancer.LoadBalancer
+	// Plain HTTP server on a unix socket
+	unixServer   *http.Server
+	unixListener *boundListener
+
+	// Active runtime state, swapped atomically on reload
+	runtime atomic.Pointer[runtime]
 
 	// Middleware factory
 	middlewareFactory *middleware.Factory
 
+	// Resolves dynamic targets such as Kubernetes services
+	discovery *discovery.Manager
+
+	// Long-lived upstream targets and those in rotation
+	targets *targetRegistry
+
+	// Targets taken out of rotation by operators
+	targetMu        sync.RWMutex
+	targetOverrides map[targetKey]*TargetOverride
+
+	// Requests in flight, by target, for draining
+	requestsMu sync.Mutex
+	requests   map[targetKey]*targetRequests
+
+	// Runtime blue/green switches, by upstream
+	deployMu    sync.RWMutex
+	deployments map[string]*deployment
+
+	// Per-IP connection limits of the listeners
+	connLimiter *connLimiter
+
+	// Access log files, kept open across reloads
+	accessLogs *accesslog.Files
+
 	// Server state
 	mu       sync.RWMutex
 	running  bool
@@ -54,15 +115,26 @@ type server struct {
 }
 
 func NewServer(cfg *config.Config, tlsManager *tls.Manager, healthChecker health.Checker, logger *zap.Logger) Server {
-	return &server{
+	s := &server{
 		cfg:               cfg,
 		tlsManager:        tlsManager,
 		healthChecker:     healthChecker,
 		logger:            logger,
-		loadBalancers:     make(map[string]loadbalancer.LoadBalancer),
 		middlewareFactory: middleware.NewFactory(logger),
+		discovery:         discovery.NewManager(logger),
+		targets:           newTargetRegistry(),
+		targetOverrides:   make(map[targetKey]*TargetOverride),
+		requests:          make(map[targetKey]*targetRequests),
+		deployments:       make(map[string]*deployment),
+		connLimiter:       newConnLimiter(logger),
+		accessLogs:        accesslog.NewFiles(logger),
 		shutdown:          make(chan struct{}),
 	}
+
+	// Targets follow health checks and discovery as they change
+	healthChecker.OnChange(s.targetHealthChanged)
+	s.discovery.OnChange(s.refreshTargets)
+	return s
 }
 
 func (s *server) Start() error {
@@ -75,82 +147,45 @@ func (s *server) Start() error {
 
 	s.logger.Info("Starting proxy server")
 
-	// Initialize load balancers
-	if err := s.initializeLoadBalancers(); err != nil {
-		return fmt.Errorf("failed to initialize load balancers: %w", err)
+	// Build the initial runtime
+	rt, err := s.buildRuntime(s.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to build runtime: %w", err)
 	}
+	s.runtime.Store(rt)
+	s.accessLogs.Retain(rt.accessLog)
 
-	// Create main handler
-	mainHandler := s.createMainHandler()
-
-	// Apply global middleware
-	globalChain, err := s.middlewareFactory.CreateChain(&s.cfg.Middleware)
-	if err != nil {
-		return fmt.Errorf("failed to create global middleware chain: %w", err)
+	if err := s.discovery.Sync(s.cfg); err != nil {
+		return fmt.Errorf("failed to start target discovery: %w", err)
 	}
+	s.refreshTargets()
+	s.prewarm(rt)
+	s.healthChecker.SetTargets(healthTargets(s.cfg))
 
-	handler := globalChain.Then(mainHandler)
+	if err := s.applyListeners(s.cfg, s.tlsManager); err != nil {
+		s.discovery.Stop()
+		return err
+	}
+	s.tlsManager.Start()
 
-	// Start HTTP server if port is configured
-	if s.cfg.Global.Server.HTTPPort > 0 {
-		s.httpServer = &http.Server{
-			Addr:           fmt.Sprintf(":%d", s.cfg.Global.Server.HTTPPort),
-			Handler:        handler,
-			ReadTimeout:    s.cfg.Global.Server.ReadTimeout,
-			WriteTimeout:   s.cfg.Global.Server.WriteTimeout,
-			IdleTimeout:    s.cfg.Global.Server.IdleTimeout,
-			MaxHeaderBytes: s.cfg.Global.Server.MaxHeaderSize,
-		}
+	s.running = true
+	s.logger.Info("Proxy server started successfully")
 
-		// Enable HTTP2 if configured
-		if s.cfg.Global.Server.HTTP2Enabled {
-			// HTTP2 is enabled by default in Go 1.6+ for HTTPS
-			// For HTTP, we need to explicitly enable it
-			s.logger.Info("HTTP2 enabled for HTTP server")
-		}
+	return nil
+}
 
-		go func() {
-			s.logger.Info("Starting HTTP server", zap.Int("port", s.cfg.Global.Server.HTTPPort))
-			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				s.logger.Error("HTTP server error", zap.Error(err))
-			}
-		}()
+func (s *server) Check() error {
+	rt, err := s.buildRuntime(s.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to build runtime: %w", err)
 	}
+	rt.retire()
 
-	// Start HTTPS server if port is configured and TLS is enabled
 	if s.cfg.Global.Server.HTTPSPort > 0 && s.cfg.TLS.Enabled {
-		tlsConfig, err := s.tlsManager.GetTLSConfig("")
-		if err != nil {
+		if _, err := s.tlsManager.GetTLSConfig(""); err != nil {
 			return fmt.Errorf("failed to get TLS config: %w", err)
 		}
-
-		// Enable HTTP2 for HTTPS server
-		if s.cfg.Global.Server.HTTP2Enabled {
-			tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2")
-			s.logger.Info("HTTP2 enabled for HTTPS server")
-		}
-
-		s.httpsServer = &http.Server{
-			Addr:           fmt.Sprintf(":%d", s.cfg.Global.Server.HTTPSPort),
-			Handler:        handler,
-			ReadTimeout:    s.cfg.Global.Server.ReadTimeout,
-			WriteTimeout:   s.cfg.Global.Server.WriteTimeout,
-			IdleTimeout:    s.cfg.Global.Server.IdleTimeout,
-			MaxHeaderBytes: s.cfg.Global.Server.MaxHeaderSize,
-			TLSConfig:      tlsConfig,
-		}
-
-		go func() {
-			s.logger.Info("Starting HTTPS server", zap.Int("port", s.cfg.Global.Server.HTTPSPort))
-			if err := s.httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-				s.logger.Error("HTTPS server error", zap.Error(err))
-			}
-		}()
 	}
-
-	s.running = true
-	s.logger.Info("Proxy server started successfully")
-
 	return nil
 }
 
@@ -167,31 +202,40 @@ func (s *server) Shutdown(ctx context.Context) error {
 	close(s.shutdown)
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	var errors []error
 
-	// Shutdown HTTP server
-	if s.httpServer != nil {
+	// Shutdown HTTP and HTTPS servers
+	for name, srv := range map[string]*http.Server{"HTTP": s.httpServer, "HTTPS": s.httpsServer, "unix socket": s.unixServer} {
+		if srv == nil {
+			continue
+		}
 		wg.Add(1)
-		go func() {
+		go func(name string, srv *http.Server) {
 			defer wg.Done()
-			if err := s.httpServer.Shutdown(ctx); err != nil {
-				errors = append(errors, fmt.Errorf("HTTP server shutdown error: %w", err))
+			if err := srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errors = append(errors, fmt.Errorf("%s server shutdown error: %w", name, err))
+				mu.Unlock()
 			}
-		}()
+		}(name, srv)
 	}
 
-	// Shutdown HTTPS server
-	if s.httpsServer != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := s.httpsServer.Shutdown(ctx); err != nil {
-				errors = append(errors, fmt.Errorf("HTTPS server shutdown error: %w", err))
-			}
-		}()
+	wg.Wait()
+	s.runtime.Load().retire()
+	s.discovery.Stop()
+	s.accessLogs.Close()
+	s.tlsManager.Shutdown()
+	if err := middleware.ShutdownPlugins(ctx); err != nil {
+		errors = append(errors, fmt.Errorf("middleware plugin shutdown error: %w", err))
 	}
 
-	wg.Wait()
+	// Release the sockets
+	for _, ln := range []*boundListener{s.httpListener, s.httpsListener, s.unixListener} {
+		if ln != nil {
+			ln.Close()
+		}
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("shutdown errors: %v", errors)
@@ -207,47 +251,417 @@ func (s *server) UpdateConfig(cfg *config.Config) error {
 
 	s.logger.Info("Updating proxy server configuration")
 
-	// Update configuration
-	s.cfg = cfg
+	// Build the new state off to the side; the active runtime keeps serving
+	// until the new one is complete
+	rt, err := s.buildRuntime(cfg)
+	if err != nil {
+		s.logger.Error("Failed to apply new configuration, rolling back to previous configuration", zap.Error(err))
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+
+	active := s.runtime.Load()
 
-	// Reinitialize load balancers
-	if err := s.initializeLoadBalancers(); err != nil {
-		return fmt.Errorf("failed to reinitialize load balancers: %w", err)
+	// Resolve new dynamic targets and warm their connections before they
+	// take traffic
+	if s.running {
+		if err := s.discovery.Sync(cfg); err != nil {
+			rt.retire()
+			s.logger.Error("Failed to apply target discovery, rolling back to previous configuration", zap.Error(err))
+			return fmt.Errorf("failed to apply target discovery: %w", err)
+		}
+		s.prewarm(rt)
 	}
 
-	s.logger.Info("Configuration updated successfully")
+	// Reconfigure listeners if ports, timeouts or TLS settings changed
+	if s.running && listenersChanged(s.cfg, cfg) {
+		tlsManager := s.tlsManager
+		if !reflect.DeepEqual(s.cfg.TLS, cfg.TLS) {
+			tlsManager, err = tls.NewManager(&cfg.TLS, s.logger)
+			if err != nil {
+				rt.retire()
+				s.logger.Error("Failed to apply new TLS configuration, rolling back to previous configuration", zap.Error(err))
+				return fmt.Errorf("failed to apply TLS configuration: %w", err)
+			}
+		}
+
+		// The new runtime must be active before new servers accept requests
+		previous := s.runtime.Swap(rt)
+		s.refreshTargets()
+		if err := s.applyListeners(cfg, tlsManager); err != nil {
+			if tlsManager != s.tlsManager {
+				tlsManager.Shutdown()
+			}
+			s.runtime.Store(previous)
+			s.refreshTargets()
+			rt.closeIdleConnections(previous)
+			rt.retire()
+			if err := s.discovery.Sync(s.cfg); err != nil {
+				s.logger.Error("Failed to restore target discovery", zap.Error(err))
+			}
+			s.logger.Error("Failed to apply listener configuration, rolling back to previous configuration", zap.Error(err))
+			return fmt.Errorf("failed to apply listener configuration: %w", err)
+		}
+
+		if tlsManager != s.tlsManager {
+			tlsManager.Start()
+			s.tlsManager.Shutdown()
+			s.tlsManager = tlsManager
+		}
+	}
+
+	// Log what changed
+	changes := config.Diff(s.cfg, cfg)
+	for _, change := range changes {
+		s.logger.Info("Configuration change", zap.String("change", change))
+	}
+
+	// Swap in the new runtime
+	s.cfg = cfg
+	if s.running {
+		s.healthChecker.SetTargets(healthTargets(cfg))
+		s.runtime.Store(rt)
+		s.refreshTargets()
+		if active != nil {
+			active.closeIdleConnections(rt)
+			active.retire()
+		}
+		s.accessLogs.Retain(rt.accessLog)
+	} else {
+		rt.retire()
+	}
+
+	s.logger.Info("Configuration updated successfully", zap.Int("changes", len(changes)))
 	return nil
 }
 
-func (s *server) initializeLoadBalancers() error {
-	s.loadBalancers = make(map[string]loadbalancer.LoadBalancer)
-	factory := &loadbalancer.DefaultFactory{}
+// listenersChanged reports whether a configuration change affects the HTTP or
+// HTTPS servers rather than only request handling
+func listenersChanged(oldCfg, newCfg *config.Config) bool {
+	return !reflect.DeepEqual(oldCfg.Global.Server, newCfg.Global.Server) ||
+		!reflect.DeepEqual(oldCfg.TLS, newCfg.TLS)
+}
 
-	for name, service := range s.cfg.Upstreams.Services {
-		lb, err := factory.Create(service.LoadBalancer)
+// applyListeners starts HTTP and HTTPS servers for cfg, replacing any running
+// ones. Sockets of ports still in use, even when the HTTP and HTTPS ports are
+// swapped, are handed to the new servers without being closed; new ports are
+// bound and the new servers configured before anything is replaced, so a
+// failure leaves the running servers untouched. Replaced servers finish their
+// in-flight requests in the background.
+func (s *server) applyListeners(cfg *config.Config, tlsManager *tls.Manager) error {
+	serverCfg := cfg.Global.Server
+
+	httpsPort := 0
+	var tlsConfig *gotls.Config
+	if serverCfg.HTTPSPort > 0 && cfg.TLS.Enabled {
+		httpsPort = serverCfg.HTTPSPort
+
+		var err error
+		tlsConfig, err = tlsManager.GetTLSConfig("")
 		if err != nil {
-			return fmt.Errorf("failed to create load balancer for %s: %w", name, err)
+			return fmt.Errorf("failed to get TLS config: %w", err)
 		}
-		s.loadBalancers[name] = lb
-		s.logger.Debug("Initialized load balancer",
-			zap.String("upstream", name),
-			zap.String("strategy", service.LoadBalancer))
+
+		// Enable HTTP2 for HTTPS server
+		if serverCfg.HTTP2Enabled {
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2")
+			s.logger.Info("HTTP2 enabled for HTTPS server")
+		}
+	}
+
+	limits, err := parseConnLimits(serverCfg)
+	if err != nil {
+		return err
+	}
+
+	// Bind new sockets first
+	closeBound := func(listeners ...*boundListener) {
+		for _, ln := range listeners {
+			if ln != nil && ln != s.httpListener && ln != s.httpsListener && ln != s.unixListener {
+				ln.Close()
+			}
+		}
+	}
+	httpListener, err := s.rebind(serverCfg.HTTPPort)
+	if err != nil {
+		return err
+	}
+	httpsListener, err := s.rebind(httpsPort)
+	if err != nil {
+		closeBound(httpListener)
+		return err
+	}
+	unixListener, err := s.rebindUnix(s.unixListener, serverCfg.UnixSocket)
+	if err != nil {
+		closeBound(httpListener, httpsListener)
+		return err
 	}
 
+	// Configure the new servers before replacing anything, so a failure
+	// leaves the running ones untouched
+	var httpServer, httpsServer, unixServer *http.Server
+	if httpListener != nil {
+		httpServer = s.newHTTPServer(&serverCfg, nil)
+		if cfg.TLS.Enabled && cfg.TLS.AutoCert.Enabled {
+			// Answer http-01 challenges, whose tokens any replica can read
+			// from a shared certificate cache
+			if autocertMgr := tlsManager.GetAutoCertManager(); autocertMgr != nil {
+				httpServer.Handler = autocertMgr.HTTPHandler(httpServer.Handler)
+			}
+		}
+		if serverCfg.HTTP2Enabled {
+			if err := enableH2C(httpServer); err != nil {
+				closeBound(httpListener, httpsListener, unixListener)
+				return err
+			}
+		}
+	}
+	if httpsListener != nil {
+		httpsServer = s.newHTTPServer(&serverCfg, tlsConfig)
+	}
+	if unixListener != nil {
+		// Serve plain HTTP on the unix socket, for a local process in front
+		unixServer = s.newHTTPServer(&serverCfg, nil)
+		unixServer.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+			return clientip.MarkUnixSocket(ctx)
+		}
+		if serverCfg.HTTP2Enabled {
+			if err := enableH2C(unixServer); err != nil {
+				closeBound(httpListener, httpsListener, unixListener)
+				return err
+			}
+		}
+	}
+
+	s.connLimiter.update(limits)
+	oldHTTPServer, oldHTTPSServer, oldUnixServer := s.httpServer, s.httpsServer, s.unixServer
+	s.httpServer, s.httpsServer, s.unixServer = httpServer, httpsServer, unixServer
+	if httpServer != nil {
+		if serverCfg.HTTP2Enabled {
+			s.logger.Info("HTTP2 enabled for HTTP server")
+		}
+		s.serve(httpServer, httpListener, "HTTP")
+	}
+	if httpsServer != nil {
+		s.serve(httpsServer, httpsListener, "HTTPS")
+	}
+	if unixServer != nil {
+		s.serve(unixServer, unixListener, "unix socket")
+	}
+
+	// Release sockets that are no longer used
+	for _, ln := range []*boundListener{s.httpListener, s.httpsListener, s.unixListener} {
+		if ln != nil && ln != httpListener && ln != httpsListener && ln != unixListener {
+			ln.Close()
+		}
+	}
+	s.httpListener, s.httpsListener, s.unixListener = httpListener, httpsListener, unixListener
+
+	// Drain replaced servers
+	s.drain(oldHTTPServer, "HTTP")
+	s.drain(oldHTTPSServer, "HTTPS")
+	s.drain(oldUnixServer, "unix socket")
+
 	return nil
 }
 
-func (s *server) createMainHandler() http.Handler {
+// rebind returns the listener for port, reusing the HTTP or HTTPS one if it
+// is already bound to that port. A zero port disables the listener.
+func (s *server) rebind(port int) (*boundListener, error) {
+	if port <= 0 {
+		return nil, nil
+	}
+	for _, current := range []*boundListener{s.httpListener, s.httpsListener} {
+		if current != nil && current.port == port {
+			return current, nil
+		}
+	}
+	return bind(port, s.connLimiter)
+}
+
+// rebindUnix returns the unix socket listener, reusing the current one if it
+// is already bound to the path. An empty path disables the listener.
+func (s *server) rebindUnix(current *boundListener, cfg config.UnixSocketConfig) (*boundListener, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	mode, err := config.ParseFileMode(cfg.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unix socket mode: %w", err)
+	}
+	if current != nil && current.path == cfg.Path {
+		if err := os.Chmod(cfg.Path, mode); err != nil {
+			return nil, fmt.Errorf("failed to set permissions of unix socket %s: %w", cfg.Path, err)
+		}
+		return current, nil
+	}
+	return bindUnix(cfg.Path, mode, s.connLimiter)
+}
+
+// newHTTPServer creates an HTTP server dispatching to the active runtime
+func (s *server) newHTTPServer(serverCfg *config.ServerConfig, tlsConfig *gotls.Config) *http.Server {
+	return &http.Server{
+		// Servers always dispatch to the currently active runtime
+		Handler:        http.HandlerFunc(s.serveHTTP),
+		ReadTimeout:    serverCfg.ReadTimeout,
+		WriteTimeout:   serverCfg.WriteTimeout,
+		IdleTimeout:    serverCfg.IdleTimeout,
+		MaxHeaderBytes: serverCfg.MaxHeaderSize,
+		TLSConfig:      tlsConfig,
+	}
+}
+
+// enableH2C makes a plaintext server speak cleartext HTTP/2 (h2c) next to
+// HTTP/1.1, to clients with prior knowledge and to those sending an h2c
+// Upgrade. Its HTTP/2 connections are sent GOAWAY when the server shuts down.
+func enableH2C(srv *http.Server) error {
+	h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return fmt.Errorf("failed to configure HTTP/2: %w", err)
+	}
+	// ConfigureServer prepares TLS for ALPN, which plaintext servers skip
+	srv.TLSConfig = nil
+	srv.TLSNextProto = nil
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	return nil
+}
+
+// serve runs a server on a bound listener in the background
+func (s *server) serve(srv *http.Server, ln *boundListener, name string) {
+	key := listenerKey(name)
+	srv.ConnState = metrics.TrackConnections(key)
+	srv.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), listenerContextKey{}, key)
+	}
+	listener := ln.attach()
+	go func() {
+		s.logger.Info("Starting "+name+" server", ln.logField())
+
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		// A replaced server's listener is closed when its successor attaches
+		if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			s.logger.Error(name+" server error", zap.Error(err))
+		}
+	}()
+}
+
+// listenerContextKey holds the key of the listener a request arrived on
+type listenerContextKey struct{}
+
+// listenerKey identifies a listener in metrics and access logs: http, https
+// or unix_socket
+func listenerKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "_")
+}
+
+// drain gracefully shuts down a replaced server in the background
+func (s *server) drain(srv *http.Server, name string) {
+	if srv == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			s.logger.Warn("Replaced "+name+" server did not drain in time", zap.Error(err))
+			srv.Close()
+			return
+		}
+		s.logger.Info("Replaced " + name + " server drained")
+	}()
+}
+
+// serveHTTP dispatches the request to the currently active runtime, which
+// first resolves the client IP used by middleware and load balancers. The
+// observability overrides of the route are attached up front, since the
+// global logging and events middleware run before routing. Requests are
+// timed from here when routes report Server-Timing, and counted in the
+// request metrics and access log, including those global middleware rejects
+// and those redirected to HTTPS.
+func (s *server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rt := s.enterRuntime()
+	defer rt.leave()
+	if rt.serverTiming {
+		r = withServerTiming(r)
+	}
+	r = rt.clientIP.Attach(r)
+
+	recording := rt.cfg.Metrics.Enabled || rt.accessLog != nil
+	var matched *route
+	if rt.observability || recording || rt.httpsRedirect {
+		matched = rt.findMatchingRoute(r)
+	}
+	if rt.observability && matched != nil && matched.rule.Observability != nil {
+		r = middleware.WithObservability(r, matched.rule.Observability)
+	}
+	if recording {
+		recorder := newRequestRecorder(w, r, matched)
+		defer recorder.finish(rt, r)
+		w = recorder
+	}
+	if rt.shedder != nil {
+		if !rt.shedder.admit(r) {
+			rt.shedder.reject(w, r)
+			return
+		}
+		defer func(start time.Time) { rt.shedder.observe(time.Since(start)) }(time.Now())
+	}
+	if rt.httpsRedirect && rt.redirectsToHTTPS(r, matched) {
+		rt.redirectToHTTPS(w, r)
+		return
+	}
+	rt.handler.ServeHTTP(w, r)
+}
+
+func (s *server) createMainHandler(rt *runtime) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The API catalog takes precedence over routes
+		if rt.catalog != nil && rt.catalog.matches(r) {
+			rt.catalog.ServeHTTP(w, r)
+			return
+		}
+
 		// Find matching route
-		route := s.findMatchingRoute(r)
-		if route == nil {
+		matchStart := time.Now()
+		matched := rt.findMatchingRoute(r)
+		if matched == nil {
 			s.logger.Warn("No matching route found",
 				zap.String("host", r.Host),
 				zap.String("path", r.URL.Path))
 			http.NotFound(w, r)
 			return
 		}
+		route := &matched.rule
+
+		// Report where the time went to routes that ask for it
+		var timing *serverTiming
+		if route.ServerTiming {
+			if timing = serverTimingFrom(r); timing != nil {
+				timing.matched(time.Since(matchStart))
+				w = &timingWriter{ResponseWriter: w, timing: timing}
+			}
+		}
+
+		// Count every response of the route, including the proxy's own
+		// errors, against its objectives
+		if matched.slo != nil {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			defer func() { matched.slo.Record(recorder.status, time.Since(start)) }()
+			w = recorder
+		}
+
+		// Routes requiring mTLS only serve clients with a verified certificate
+		if route.RequireClientCert && verifiedClientCert(r) == nil {
+			http.Error(w, "Client certificate required", http.StatusForbidden)
+			return
+		}
 
 		// Apply URL rewriting if configured
 		if err := s.applyRewrite(r, &route.Rewrite); err != nil {
@@ -257,7 +671,7 @@ func (s *server) createMainHandler() http.Handler {
 		}
 
 		// Get upstream service
-		upstream, exists := s.cfg.Upstreams.Services[route.Upstream]
+		service, exists := rt.cfg.Upstreams.Services[route.Upstream]
 		if !exists {
 			s.logger.Error("Upstream not found", zap.String("upstream", route.Upstream))
 			http.Error(w, "Upstream not found", http.StatusServiceUnavailable)
@@ -265,23 +679,35 @@ func (s *server) createMainHandler() http.Handler {
 		}
 
 		// Get load balancer
-		lb, exists := s.loadBalancers[route.Upstream]
+		lb, exists := rt.loadBalancers[route.Upstream]
 		if !exists {
 			s.logger.Error("Load balancer not found", zap.String("upstream", route.Upstream))
 			http.Error(w, "Load balancer not found", http.StatusServiceUnavailable)
 			return
 		}
 
-		// Create targets from upstream configuration
-		targets := s.createTargets(upstream)
+		// Targets in rotation, shared by all requests
+		targets := s.upstreamTargets(rt.cfg, route.Upstream)
 		if len(targets) == 0 {
 			s.logger.Error("No healthy targets available", zap.String("upstream", route.Upstream))
 			http.Error(w, "No healthy targets available", http.StatusServiceUnavailable)
 			return
 		}
+		if outliers := rt.outliers[route.Upstream]; outliers != nil {
+			targets = outliers.apply(targets)
+		}
+		if service.SlowStart != nil {
+			targets = slowStart(service.SlowStart, targets)
+		}
 
-		// Select target
-		target, err := lb.SelectTarget(targets, r)
+		// Select target, keeping sticky sessions on their target
+		var target *loadbalancer.Target
+		var err error
+		if sessions := rt.sessions[route.Upstream]; sessions != nil {
+			target, err = sessions.SelectTarget(w, r, targets, lb)
+		} else {
+			target, err = lb.SelectTarget(targets, r)
+		}
 		if err != nil {
 			s.logger.Error("Failed to select target",
 				zap.String("upstream", route.Upstream),
@@ -290,115 +716,92 @@ func (s *server) createMainHandler() http.Handler {
 			return
 		}
 
-		// Create reverse proxy
-		proxy := httputil.NewSingleHostReverseProxy(target.URL)
+		r = withProxyOptions(r, &proxyOptions{
+			maxResponseSize:   route.MaxResponseSize,
+			timing:            timing,
+			outliers:          rt.outliers[route.Upstream],
+			propagateDeadline: rt.cfg.Global.Server.Deadlines.Propagate,
+		})
+
+		// Tell the upstream who the client is; a client-supplied value is
+		// never passed on
+		r.Header.Set("X-Real-IP", clientip.FromRequest(r))
+		setClientCertHeaders(r, rt.cfg.TLS.ClientAuth.ForwardHeaders)
+
+		// Apply the route timeout, or the shorter deadline of a trusted caller
+		r, cancel := rt.applyDeadline(r, route.Timeout)
+		defer cancel()
+		if deadline, ok := r.Context().Deadline(); ok {
+			s.logger.Debug("Applied request deadline",
+				zap.Duration("timeout", time.Until(deadline)),
+				zap.String("route", route.Host+route.Path))
+		}
 
-		// Configure proxy
-		proxy.Transport = &http.Transport{
-			MaxIdleConns:        100,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
+		// Reuse the targets' reverse proxies and the upstream's connections,
+		// including prewarmed ones. Apply retry logic if configured, within
+		// the upstream's retry budget.
+		var routeHandler http.Handler = &targetHandler{
+			server:   s,
+			pool:     rt.pools[route.Upstream],
+			lb:       lb,
+			upstream: route.Upstream,
+			targets:  targets,
+			target:   target,
+		}
+		budget := rt.retryBudgets[route.Upstream]
+		if budget != nil {
+			budget.recordRequest()
+		}
+		if route.RetryPolicy.Attempts > 0 {
+			routeHandler = s.createRetryMiddleware(routeHandler, &route.RetryPolicy, matched.retryOn, route.Upstream, budget)
 		}
 
-		// Apply route timeout if configured
-		if route.Timeout > 0 {
-			ctx, cancel := context.WithTimeout(r.Context(), route.Timeout)
-			defer cancel()
-			r = r.WithContext(ctx)
-			s.logger.Debug("Applied route timeout",
-				zap.Duration("timeout", route.Timeout),
-				zap.String("route", route.Host+route.Path))
+		// Read the body and copy the request to the shadow upstream once
+		// the route's middleware has accepted it
+		if route.RequestBuffering != nil || matched.mirror != nil {
+			routeHandler = s.withRequestBody(rt, matched, routeHandler)
 		}
 
-		// Apply route-specific middleware
-		routeHandler := s.applyRouteMiddleware(proxy, route)
+		// Apply route-specific middleware, which runs once however many
+		// attempts are made
+		routeHandler = matched.chain.Then(routeHandler)
 
-		// Apply retry logic if configured
-		if route.RetryPolicy.Attempts > 0 {
-			routeHandler = s.createRetryMiddleware(routeHandler, &route.RetryPolicy)
+		// Watch responses after a blue/green switch for automatic rollback
+		if watch := s.watching(route.Upstream); watch != nil {
+			recorder := &statusRecorder{ResponseWriter: w}
+			defer func() { s.recordResponse(route.Upstream, watch, recorder.status) }()
+			w = recorder
 		}
 
-		// Update target connection count
-		lb.UpdateTarget(target, 1)
-		defer lb.UpdateTarget(target, -1)
-
 		// Serve the request
 		routeHandler.ServeHTTP(w, r)
 	})
 }
 
-func (s *server) findMatchingRoute(r *http.Request) *config.RouteRule {
-	for _, rule := range s.cfg.Routes.Rules {
-		// Check host match - strip port from request host for comparison
-		if rule.Host != "" {
-			requestHost := r.Host
-			if colonIndex := strings.Index(requestHost, ":"); colonIndex != -1 {
-				requestHost = requestHost[:colonIndex]
-			}
-			if rule.Host != requestHost {
-				continue
-			}
-		}
-
-		// Check path match - support both exact and prefix matching
-		if rule.Path != "" {
-			// If path ends with /*, use prefix matching
-			if strings.HasSuffix(rule.Path, "/*") {
-				prefix := strings.TrimSuffix(rule.Path, "/*")
-				if !strings.HasPrefix(r.URL.Path, prefix) {
-					continue
-				}
-			} else {
-				// Exact path matching
-				if r.URL.Path != rule.Path {
-					continue
-				}
-			}
-		}
-
-		// Check method match
-		if len(rule.Methods) > 0 {
-			methodMatch := false
-			for _, method := range rule.Methods {
-				if method == r.Method {
-					methodMatch = true
-					break
-				}
-			}
-			if !methodMatch {
-				continue
-			}
-		}
-
-		return &rule
+// findMatchingRoute returns the route serving a request, nil if none does
+func (rt *runtime) findMatchingRoute(r *http.Request) *route {
+	i, ok := rt.router.Match(r)
+	if !ok {
+		return nil
 	}
-	return nil
+	return rt.routes[i]
 }
 
-func (s *server) createTargets(upstream config.UpstreamService) []*loadbalancer.Target {
-	var targets []*loadbalancer.Target
-
-	for _, targetConfig := range upstream.Targets {
-		url, err := url.Parse(targetConfig.URL)
-		if err != nil {
-			s.logger.Error("Invalid target URL",
-				zap.String("url", targetConfig.URL),
-				zap.Error(err))
+// healthTargets returns the targets monitored by active health checks, with
+// the health check of their service. Dynamic targets are left out, as they
+// resolve to endpoints of their own.
+func healthTargets(cfg *config.Config) map[string]config.HealthCheckConfig {
+	targets := make(map[string]config.HealthCheckConfig)
+	for _, service := range cfg.Upstreams.Services {
+		if !service.HealthCheck.Enabled {
 			continue
 		}
-
-		// Check health status
-		isHealthy := s.healthChecker.IsHealthy(targetConfig.URL)
-
-		target := &loadbalancer.Target{
-			URL:       url,
-			Weight:    targetConfig.Weight,
-			IsHealthy: isHealthy,
+		for _, target := range service.AllTargets() {
+			if !discovery.IsDynamic(target.URL) {
+				targets[target.URL] = service.HealthCheck
+			}
 		}
-
-		targets = append(targets, target)
 	}
-
 	return targets
 }
 
@@ -450,41 +853,6 @@ func (s *server) applyRewrite(r *http.Request, rewrite *config.RewriteConfig) er
 	return nil
 }
 
-func (s *server) applyRouteMiddleware(handler http.Handler, route *config.RouteRule) http.Handler {
-	// Create middleware chain for this route
-	chain := middleware.NewChain(s.logger)
-
-	// Add route-specific middleware
-	for _, middlewareName := range route.Middleware {
-		// Find middleware configuration
-		var mwConfig config.MiddlewareChain
-		for _, mw := range s.cfg.Middleware.Chain {
-			if mw.Name == middlewareName && mw.Enabled {
-				mwConfig = mw
-				break
-			}
-		}
-
-		if mwConfig.Name != "" {
-			middleware, err := s.middlewareFactory.Create(mwConfig.Type, mwConfig.Config)
-			if err != nil {
-				s.logger.Error("Failed to create middleware",
-					zap.String("name", middlewareName),
-					zap.Error(err))
-				continue
-			}
-			chain.Use(middleware)
-		}
-	}
-
-	// Apply route headers if configured
-	if len(route.Headers) > 0 {
-		chain.Use(s.createHeadersMiddleware(route.Headers))
-	}
-
-	return chain.Then(handler)
-}
-
 // createHeadersMiddleware creates a middleware that applies route-specific headers
 func (s *server) createHeadersMiddleware(headers map[string]string) middleware.Middleware {
 	return &headersMiddleware{
@@ -523,6 +891,13 @@ type headerResponseWriter struct {
 	logger  *zap.Logger
 }
 
+// Flush flushes the response, so streamed responses are not held back
+func (hw *headerResponseWriter) Flush() {
+	if flusher, ok := hw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func (hw *headerResponseWriter) WriteHeader(statusCode int) {
 	// Apply route headers before writing the status code
 	for name, value := range hw.headers {
@@ -533,86 +908,3 @@ func (hw *headerResponseWriter) WriteHeader(statusCode int) {
 	}
 	hw.ResponseWriter.WriteHeader(statusCode)
 }
-
-// createRetryMiddleware creates a middleware that implements retry logic
-func (s *server) createRetryMiddleware(handler http.Handler, retryPolicy *config.RetryPolicy) http.Handler {
-	return &retryHandler{
-		handler:     handler,
-		retryPolicy: retryPolicy,
-		logger:      s.logger,
-	}
-}
-
-// retryHandler implements retry logic for failed requests
-type retryHandler struct {
-	handler     http.Handler
-	retryPolicy *config.RetryPolicy
-	logger      *zap.Logger
-}
-
-func (rh *retryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Create a response writer that captures status codes
-	rw := &retryResponseWriter{
-		ResponseWriter: w,
-	}
-
-	var lastErr error
-	for attempt := 0; attempt <= rh.retryPolicy.Attempts; attempt++ {
-		// Reset response writer for each attempt
-		rw.statusCode = 0
-		rw.written = false
-
-		// Serve the request
-		rh.handler.ServeHTTP(rw, r)
-
-		// Check if the request was successful
-		if rw.statusCode < 500 || attempt == rh.retryPolicy.Attempts {
-			// Success or max attempts reached
-			if attempt > 0 {
-				rh.logger.Info("Request succeeded after retries",
-					zap.Int("attempts", attempt+1),
-					zap.Int("status", rw.statusCode))
-			}
-			return
-		}
-
-		// Log retry attempt
-		rh.logger.Warn("Request failed, retrying",
-			zap.Int("attempt", attempt+1),
-			zap.Int("max_attempts", rh.retryPolicy.Attempts+1),
-			zap.Int("status", rw.statusCode),
-			zap.Duration("backoff", rh.retryPolicy.Backoff))
-
-		// Wait before retrying (except on the last attempt)
-		if attempt < rh.retryPolicy.Attempts {
-			time.Sleep(rh.retryPolicy.Backoff)
-		}
-	}
-
-	// All attempts failed
-	if lastErr != nil {
-		rh.logger.Error("Request failed after all retry attempts", zap.Error(lastErr))
-	}
-}
-
-// retryResponseWriter wraps http.ResponseWriter to capture status codes for retry logic
-type retryResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	written    bool
-}
-
-func (rw *retryResponseWriter) WriteHeader(statusCode int) {
-	if !rw.written {
-		rw.statusCode = statusCode
-		rw.written = true
-		rw.ResponseWriter.WriteHeader(statusCode)
-	}
-}
-
-func (rw *retryResponseWriter) Write(data []byte) (int, error) {
-	if !rw.written {
-		rw.WriteHeader(http.StatusOK)
-	}
-	return rw.ResponseWriter.Write(data)
-}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverTiming measures the phases of a request reported in the
+// Server-Timing header of routes that opt in
+type serverTiming struct {
+	start time.Time // when the proxy received the request
+
+	mu       sync.Mutex
+	match    time.Duration
+	upstream time.Time // when the last upstream attempt started
+	getConn  time.Time // when the last attempt asked for a connection
+	gotConn  time.Time // when it got one
+	ttfb     time.Duration
+}
+
+// timingKey is the request context key of the server timing of a request
+type timingKey struct{}
+
+// withServerTiming starts measuring a request
+func withServerTiming(r *http.Request) *http.Request {
+	timing := &serverTiming{start: time.Now()}
+	return r.WithContext(context.WithValue(r.Context(), timingKey{}, timing))
+}
+
+// serverTimingFrom returns the server timing of a request, if measured
+func serverTimingFrom(r *http.Request) *serverTiming {
+	timing, _ := r.Context().Value(timingKey{}).(*serverTiming)
+	return timing
+}
+
+// matched records how long route matching took
+func (t *serverTiming) matched(d time.Duration) {
+	t.mu.Lock()
+	t.match = d
+	t.mu.Unlock()
+}
+
+// trace returns a client trace measuring an upstream attempt. Retried
+// requests report their last attempt.
+func (t *serverTiming) trace() *httptrace.ClientTrace {
+	t.mu.Lock()
+	t.upstream = time.Now()
+	t.getConn, t.gotConn, t.ttfb = time.Time{}, time.Time{}, 0
+	t.mu.Unlock()
+
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.getConn = time.Now()
+			t.mu.Unlock()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			if !t.gotConn.IsZero() {
+				t.ttfb = time.Since(t.gotConn)
+			}
+			t.mu.Unlock()
+		},
+	}
+}
+
+// header renders the phases measured so far. Time to first byte is measured
+// from the moment the upstream connection was ready; the total ends when
+// the response headers are sent.
+func (t *serverTiming) header() string {
+	total := time.Since(t.start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	metrics := []string{timingMetric("match", t.match)}
+	if !t.upstream.IsZero() {
+		metrics = append(metrics, timingMetric("queue", t.upstream.Sub(t.start)-t.match))
+		if !t.getConn.IsZero() && !t.gotConn.IsZero() {
+			metrics = append(metrics, timingMetric("connect", t.gotConn.Sub(t.getConn)))
+		}
+		if t.ttfb > 0 {
+			metrics = append(metrics, timingMetric("ttfb", t.ttfb))
+		}
+	}
+	metrics = append(metrics, timingMetric("total", total))
+	return strings.Join(metrics, ", ")
+}
+
+// timingMetric formats a Server-Timing metric with its duration in
+// milliseconds
+func timingMetric(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d.Microseconds())/1000)
+}
+
+// timingWriter adds the Server-Timing header to a response. Upstream
+// metrics are kept, so the header shows both sides.
+type timingWriter struct {
+	http.ResponseWriter
+	timing  *serverTiming
+	stamped bool
+}
+
+// WriteHeader adds the header to the final response
+func (w *timingWriter) WriteHeader(statusCode int) {
+	if statusCode >= http.StatusOK {
+		w.stamp()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write adds the header to a response sent with an implicit 200 status
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.stamp()
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush flushes the response, so streamed responses are not held back
+func (w *timingWriter) Flush() {
+	w.stamp()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *timingWriter) stamp() {
+	if !w.stamped {
+		w.stamped = true
+		w.Header().Add("Server-Timing", w.timing.header())
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+)
+
+// slowStart returns the targets without those left out to ramp up their
+// share of requests: a warming target starts with min_percent of its full
+// share, which grows with the time it has been warming until the window
+// ends. Targets are never all left out. The targets are shared by all
+// requests, so they are filtered rather than marked.
+func slowStart(cfg *config.SlowStartConfig, targets []*loadbalancer.Target) []*loadbalancer.Target {
+	now := time.Now()
+	minShare := float64(cfg.MinPercent) / 100
+
+	var kept []*loadbalancer.Target // nil until a target is left out
+	healthy := false
+	for i, target := range targets {
+		excluded := false
+		if since := target.WarmingSince(); !since.IsZero() && target.IsHealthy() {
+			if elapsed := now.Sub(since); elapsed < cfg.Window {
+				share := max(minShare, float64(elapsed)/float64(cfg.Window))
+				excluded = rand.Float64() >= share
+			}
+		}
+
+		switch {
+		case excluded:
+			if kept == nil {
+				kept = append(make([]*loadbalancer.Target, 0, len(targets)), targets[:i]...)
+			}
+		case kept != nil:
+			kept = append(kept, target)
+		}
+		if !excluded && target.IsHealthy() {
+			healthy = true
+		}
+	}
+	if kept == nil || !healthy {
+		return targets
+	}
+	return kept
+}
@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultDrainTimeout bounds how long requests in flight to a draining target
+// may run when its upstream sets no drain_timeout
+const defaultDrainTimeout = 30 * time.Second
+
+// drainPollInterval is how often a draining target is checked for requests
+// still in flight
+const drainPollInterval = 100 * time.Millisecond
+
+// TargetState is the state an operator assigned to an upstream target
+type TargetState string
+
+const (
+	// TargetActive targets are in rotation when healthy
+	TargetActive TargetState = "active"
+	// TargetDraining targets receive no new requests while in-flight
+	// requests complete, e.g. during a deploy
+	TargetDraining TargetState = "draining"
+	// TargetDisabled targets receive no requests until re-enabled
+	TargetDisabled TargetState = "disabled"
+)
+
+// TargetOverride records a target taken out of rotation. Overrides are
+// independent of health checks, so a passing probe never puts a drained
+// target back, and they are kept across configuration reloads.
+type TargetOverride struct {
+	Upstream string      `json:"upstream"`
+	URL      string      `json:"url"`
+	State    TargetState `json:"state"`
+	Reason   string      `json:"reason,omitempty"`
+	Since    time.Time   `json:"since"`
+
+	// Draining targets only
+	InFlight int        `json:"in_flight"`          // requests still running
+	Drained  bool       `json:"drained,omitempty"`  // no request is left running
+	Deadline *time.Time `json:"deadline,omitempty"` // when requests still running are cancelled
+}
+
+// targetRequests tracks the requests in flight to a target. Their contexts
+// are cancelled when a drain of the target times out.
+type targetRequests struct {
+	count  int
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// targetKey identifies a target within an upstream service
+type targetKey struct {
+	upstream string
+	url      string
+}
+
+// SetTargetState assigns a state to a target of an upstream service.
+// Setting TargetActive removes any override.
+func (s *server) SetTargetState(upstream, targetURL string, state TargetState, reason string) {
+	// Runs once the lock is released
+	defer s.refreshTargets()
+
+	s.targetMu.Lock()
+	defer s.targetMu.Unlock()
+
+	key := targetKey{upstream: upstream, url: targetURL}
+	if state == TargetActive {
+		delete(s.targetOverrides, key)
+	} else {
+		override := &TargetOverride{
+			Upstream: upstream,
+			URL:      targetURL,
+			State:    state,
+			Reason:   reason,
+			Since:    time.Now(),
+		}
+		if state == TargetDraining {
+			timeout := s.drainTimeout(upstream)
+			deadline := override.Since.Add(timeout)
+			override.Deadline = &deadline
+			go s.awaitDrain(key, override, timeout)
+		}
+		s.targetOverrides[key] = override
+	}
+
+	s.logger.Info("Target state changed",
+		zap.String("upstream", upstream),
+		zap.String("target", targetURL),
+		zap.String("state", string(state)),
+		zap.String("reason", reason))
+}
+
+// GetTargetState returns the state assigned to a target
+func (s *server) GetTargetState(upstream, targetURL string) TargetState {
+	s.targetMu.RLock()
+	defer s.targetMu.RUnlock()
+
+	if override, exists := s.targetOverrides[targetKey{upstream: upstream, url: targetURL}]; exists {
+		return override.State
+	}
+	return TargetActive
+}
+
+// TargetOverrides returns the targets taken out of rotation
+func (s *server) TargetOverrides() []TargetOverride {
+	s.targetMu.RLock()
+	defer s.targetMu.RUnlock()
+
+	overrides := make([]TargetOverride, 0, len(s.targetOverrides))
+	for _, override := range s.targetOverrides {
+		copied := *override
+		if copied.State == TargetDraining {
+			copied.InFlight = s.inFlight(copied.Upstream, copied.URL)
+		}
+		overrides = append(overrides, copied)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Upstream != overrides[j].Upstream {
+			return overrides[i].Upstream < overrides[j].Upstream
+		}
+		return overrides[i].URL < overrides[j].URL
+	})
+	return overrides
+}
+
+// drainTimeout returns the drain timeout of an upstream
+func (s *server) drainTimeout(upstream string) time.Duration {
+	if rt := s.runtime.Load(); rt != nil {
+		if timeout := rt.cfg.Upstreams.Services[upstream].DrainTimeout; timeout > 0 {
+			return timeout
+		}
+	}
+	return defaultDrainTimeout
+}
+
+// awaitDrain waits for the requests in flight to a draining target to
+// complete, cancelling those still running after the timeout. It gives up
+// when the target's state changes.
+func (s *server) awaitDrain(key targetKey, override *TargetOverride, timeout time.Duration) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdown:
+			return
+		case <-deadline.C:
+			if !s.markDrained(key, override) {
+				return
+			}
+			cancelled := s.cancelRequests(key.upstream, key.url)
+			s.logger.Warn("Target did not drain in time, cancelled requests in flight",
+				zap.String("upstream", key.upstream),
+				zap.String("target", key.url),
+				zap.Int("requests", cancelled))
+			return
+		case <-ticker.C:
+			if s.inFlight(key.upstream, key.url) > 0 {
+				continue
+			}
+			if s.markDrained(key, override) {
+				s.logger.Info("Target drained",
+					zap.String("upstream", key.upstream),
+					zap.String("target", key.url),
+					zap.Duration("duration", time.Since(override.Since)))
+			}
+			return
+		}
+	}
+}
+
+// markDrained records that a drain finished, unless the target's state
+// changed in the meantime
+func (s *server) markDrained(key targetKey, override *TargetOverride) bool {
+	s.targetMu.Lock()
+	defer s.targetMu.Unlock()
+
+	if s.targetOverrides[key] != override {
+		return false
+	}
+	override.Drained = true
+	return true
+}
+
+// endpointKeys returns the keys requests to a target are tracked under: its
+// own, or those of the endpoints a dynamic target resolves to
+func (s *server) endpointKeys(upstream, targetURL string) []targetKey {
+	endpoints, dynamic := s.discovery.Targets(targetURL)
+	if !dynamic {
+		return []targetKey{{upstream: upstream, url: targetURL}}
+	}
+	keys := make([]targetKey, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		keys = append(keys, targetKey{upstream: upstream, url: endpoint.URL})
+	}
+	return keys
+}
+
+// beginRequest counts a request in flight to a target. The returned request
+// is cancelled when a drain of the target times out; done must be called
+// once the request completes.
+func (s *server) beginRequest(r *http.Request, upstream, targetURL string) (*http.Request, func()) {
+	key := targetKey{upstream: upstream, url: targetURL}
+
+	s.requestsMu.Lock()
+	requests := s.requests[key]
+	if requests == nil {
+		requests = &targetRequests{}
+		requests.ctx, requests.cancel = context.WithCancel(context.Background())
+		s.requests[key] = requests
+	}
+	requests.count++
+	s.requestsMu.Unlock()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	stop := context.AfterFunc(requests.ctx, cancel)
+
+	return r.WithContext(ctx), func() {
+		stop()
+		cancel()
+
+		s.requestsMu.Lock()
+		defer s.requestsMu.Unlock()
+		requests.count--
+		if requests.count == 0 && s.requests[key] == requests {
+			requests.cancel()
+			delete(s.requests, key)
+		}
+	}
+}
+
+// inFlight returns the number of requests in flight to a target
+func (s *server) inFlight(upstream, targetURL string) int {
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+
+	count := 0
+	for _, key := range s.endpointKeys(upstream, targetURL) {
+		if requests := s.requests[key]; requests != nil {
+			count += requests.count
+		}
+	}
+	return count
+}
+
+// cancelRequests cancels the requests in flight to a target, returning how
+// many there were
+func (s *server) cancelRequests(upstream, targetURL string) int {
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+
+	count := 0
+	for _, key := range s.endpointKeys(upstream, targetURL) {
+		if requests := s.requests[key]; requests != nil {
+			count += requests.count
+			requests.cancel()
+			delete(s.requests, key)
+		}
+	}
+	return count
+}
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/discovery"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"go.uber.org/zap"
+)
+
+// targetRegistry owns the targets of the upstream services. A target lives
+// as long as it stays in rotation, so the load balancer state it carries,
+// such as its connection count, adds up across requests and reloads. Health
+// checks update targets in place; the targets in rotation are kept in a
+// snapshot that requests read without locking, rebuilt when a reload,
+// discovery, an operator or a blue/green switch changes them.
+type targetRegistry struct {
+	mu       sync.Mutex
+	targets  map[targetKey]*loadbalancer.Target
+	rotation atomic.Pointer[targetRotation]
+}
+
+// targetRotation holds the targets in rotation of the upstreams of a
+// configuration
+type targetRotation struct {
+	cfg       *config.Config
+	upstreams map[string][]*loadbalancer.Target
+}
+
+// newTargetRegistry creates an empty registry
+func newTargetRegistry() *targetRegistry {
+	return &targetRegistry{targets: make(map[targetKey]*loadbalancer.Target)}
+}
+
+// upstreamTargets returns the targets in rotation of an upstream. Requests
+// of the active configuration read them from the snapshot; for any other
+// configuration, such as one about to be applied, they are resolved.
+func (s *server) upstreamTargets(cfg *config.Config, name string) []*loadbalancer.Target {
+	if rotation := s.targets.rotation.Load(); rotation != nil && rotation.cfg == cfg {
+		return rotation.upstreams[name]
+	}
+
+	service, exists := cfg.Upstreams.Services[name]
+	if !exists {
+		return nil
+	}
+	s.targets.mu.Lock()
+	defer s.targets.mu.Unlock()
+	return s.resolveTargets(name, service, nil)
+}
+
+// refreshTargets rebuilds the snapshot of targets in rotation from the
+// active configuration, and drops the targets taken out of rotation and the
+// reverse proxies of targets no longer in their upstream
+func (s *server) refreshTargets() {
+	rt := s.runtime.Load()
+	if rt == nil {
+		return
+	}
+
+	s.targets.mu.Lock()
+	defer s.targets.mu.Unlock()
+
+	previous := s.targets.rotation.Load()
+	rotation := &targetRotation{cfg: rt.cfg, upstreams: make(map[string][]*loadbalancer.Target)}
+	inRotation := make(map[targetKey]bool)
+	now := time.Now()
+	for name, service := range rt.cfg.Upstreams.Services {
+		targets := s.resolveTargets(name, service, inRotation)
+		rotation.upstreams[name] = targets
+
+		// Targets joining an upstream that was already serving warm up;
+		// those of a new upstream or a starting proxy have no one to share
+		// the load with
+		if previous == nil || len(previous.upstreams[name]) == 0 {
+			continue
+		}
+		known := make(map[string]bool, len(previous.upstreams[name]))
+		for _, target := range previous.upstreams[name] {
+			known[target.URL.String()] = true
+		}
+		for _, target := range targets {
+			if !known[target.URL.String()] {
+				target.StartWarmup(now)
+			}
+		}
+	}
+	for key := range s.targets.targets {
+		if !inRotation[key] {
+			delete(s.targets.targets, key)
+		}
+	}
+	s.targets.rotation.Store(rotation)
+
+	// Drop the reverse proxies of targets that left the upstream, keeping
+	// those of configured targets out of rotation for when they return
+	for name, service := range rt.cfg.Upstreams.Services {
+		pool := rt.pools[name]
+		if pool == nil {
+			continue
+		}
+		keep := make(map[string]bool)
+		for _, target := range service.AllTargets() {
+			keep[target.URL] = true
+		}
+		for _, target := range rotation.upstreams[name] {
+			keep[target.URL.String()] = true
+		}
+		pool.prune(keep)
+	}
+}
+
+// resolveTargets returns the targets in rotation of an upstream: those of
+// its active blue/green set that no operator took out, with dynamic targets
+// expanded to the endpoints they resolve to. Known targets are reused. When
+// seen is given, the targets are those of the active configuration: new ones
+// are registered, and all are recorded in seen. Callers hold the registry's
+// mu.
+func (s *server) resolveTargets(name string, service config.UpstreamService, seen map[targetKey]bool) []*loadbalancer.Target {
+	var targets []*loadbalancer.Target
+
+	for _, targetConfig := range service.ActiveTargets(s.activeColor(name, service.BlueGreen)) {
+		// Drained and disabled targets receive no new requests
+		if s.GetTargetState(name, targetConfig.URL) != TargetActive {
+			continue
+		}
+
+		// Dynamic targets expand to the endpoints they currently resolve to,
+		// which inherit the target's weight unless they carry their own
+		endpoints, dynamic := s.discovery.Targets(targetConfig.URL)
+		if !dynamic {
+			endpoints = []discovery.Endpoint{{URL: targetConfig.URL}}
+		}
+
+		for _, endpoint := range endpoints {
+			weight := endpoint.Weight
+			if weight == 0 {
+				weight = targetConfig.Weight
+			}
+
+			key := targetKey{upstream: name, url: endpoint.URL}
+			target := s.targets.targets[key]
+			if target == nil || target.Weight != weight || target.Protocol != targetConfig.Protocol {
+				targetURL, err := url.Parse(endpoint.URL)
+				if err != nil {
+					s.logger.Error("Invalid target URL",
+						zap.String("url", endpoint.URL),
+						zap.Error(err))
+					continue
+				}
+				replaced := target
+				target = &loadbalancer.Target{URL: targetURL, Weight: weight, Protocol: targetConfig.Protocol}
+				if replaced != nil && !replaced.WarmingSince().IsZero() {
+					target.StartWarmup(replaced.WarmingSince())
+				}
+				if seen != nil {
+					s.targets.targets[key] = target
+				}
+			}
+			target.SetHealthy(s.healthChecker.IsHealthy(endpoint.URL))
+
+			if seen != nil {
+				seen[key] = true
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+// targetHealthChanged applies a health check result to the targets with a
+// URL. Recovered targets warm up.
+func (s *server) targetHealthChanged(targetURL string) {
+	s.targets.mu.Lock()
+	defer s.targets.mu.Unlock()
+
+	healthy := s.healthChecker.IsHealthy(targetURL)
+	for key, target := range s.targets.targets {
+		if key.url == targetURL {
+			if healthy && !target.IsHealthy() {
+				target.StartWarmup(time.Now())
+			}
+			target.SetHealthy(healthy)
+		}
+	}
+}
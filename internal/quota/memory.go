@@ -0,0 +1,213 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// counter is a usage counter and when it expires
+type counter struct {
+	Value   int64     `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// sweepInterval is how often the memory store drops expired counters
+const sweepInterval = time.Minute
+
+// MemoryStore keeps counters in memory; usage is lost on restart. Expired
+// counters are dropped every sweep interval until the store is closed.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	dirty    bool // changed since the last save, for FileStore
+
+	stopSweep chan struct{}
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{counters: make(map[string]*counter), stopSweep: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-s.stopSweep:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// sweep drops expired counters
+func (s *MemoryStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for name, c := range s.counters {
+		if now.After(c.Expires) {
+			delete(s.counters, name)
+		}
+	}
+}
+
+// Add adds n to a counter
+func (s *MemoryStore) Add(_ context.Context, name string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[name]
+	if !ok || now.After(c.Expires) {
+		c = &counter{Expires: now.Add(ttl)}
+		s.counters[name] = c
+	}
+	c.Value += n
+	s.dirty = true
+	return c.Value, nil
+}
+
+// Get returns the value of a counter
+func (s *MemoryStore) Get(_ context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[name]
+	if !ok || time.Now().After(c.Expires) {
+		return 0, nil
+	}
+	return c.Value, nil
+}
+
+// Close stops dropping expired counters
+func (s *MemoryStore) Close() error {
+	close(s.stopSweep)
+	return nil
+}
+
+// snapshot removes expired counters and returns a copy of the rest if they
+// changed since the last snapshot
+func (s *MemoryStore) snapshot() (map[string]counter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil, false
+	}
+	s.dirty = false
+
+	now := time.Now()
+	counters := make(map[string]counter, len(s.counters))
+	for name, c := range s.counters {
+		if now.After(c.Expires) {
+			delete(s.counters, name)
+			continue
+		}
+		counters[name] = *c
+	}
+	return counters, true
+}
+
+// FileStore keeps counters in memory and saves them to a file periodically,
+// so usage survives restarts
+type FileStore struct {
+	*MemoryStore
+	path string
+	stop chan struct{}
+
+	saveMu sync.Mutex
+}
+
+// NewFileStore creates a file store, loading the usage saved in path
+func NewFileStore(path string, flushInterval time.Duration) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path, stop: make(chan struct{})}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		s.MemoryStore.Close()
+		return nil, fmt.Errorf("failed to read quota usage file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.counters); err != nil {
+			s.MemoryStore.Close()
+			return nil, fmt.Errorf("failed to parse quota usage file %s: %w", path, err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// Errors are retried on the next tick and reported by Flush
+				// on shutdown
+				_ = s.Flush()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the periodic saves and sweeps, and saves the counters one last
+// time
+func (s *FileStore) Close() error {
+	close(s.stop)
+	s.MemoryStore.Close()
+	return s.Flush()
+}
+
+// Flush saves the counters if they changed. The file is replaced atomically
+// so a crash never leaves it truncated.
+func (s *FileStore) Flush() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	counters, changed := s.snapshot()
+	if !changed {
+		return nil
+	}
+
+	err := s.save(counters)
+	if err != nil {
+		// Save again on the next flush
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// save writes counters to the file
+func (s *FileStore) save(counters map[string]counter) error {
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return fmt.Errorf("failed to encode quota usage: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create quota usage directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write quota usage file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace quota usage file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps counters in Redis, shared by every replica using it
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis store. Connections are opened on first use.
+func NewRedisStore(cfg config.RedisConfig, prefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: shared.NewRedisClient(cfg, timeout), prefix: prefix}
+}
+
+// addScript increments a counter and sets the expiry of counters that have
+// none, such as a counter it creates, in one step, so no counter is left
+// without an expiry
+var addScript = redis.NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// Add increments a counter, setting its expiry when it is created
+func (s *RedisStore) Add(ctx context.Context, name string, n int64, ttl time.Duration) (int64, error) {
+	return addScript.Run(ctx, s.client, []string{s.prefix + name}, n, ttl.Milliseconds()).Int64()
+}
+
+// Get returns the value of a counter
+func (s *RedisStore) Get(ctx context.Context, name string) (int64, error) {
+	value, err := s.client.Get(ctx, s.prefix+name).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return value, err
+}
+
+// Close closes the connections of the store
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,61 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+)
+
+// Store holds usage counters
+type Store interface {
+	// Add adds n to a counter and returns its new value. A counter that does
+	// not exist is created with value n and removed after ttl.
+	Add(ctx context.Context, counter string, n int64, ttl time.Duration) (int64, error)
+	// Get returns the value of a counter, 0 if it does not exist
+	Get(ctx context.Context, counter string) (int64, error)
+	// Close saves what is not saved yet and releases the connections of the
+	// store
+	Close() error
+}
+
+// NewStore creates the store selected by the quota configuration and the
+// function releasing it. Stores are shared by every quota middleware with the
+// same settings, so usage is kept across configuration reloads.
+func NewStore(cfg config.QuotaMiddlewareConfig) (Store, func() error, error) {
+	switch cfg.Store {
+	case "memory":
+		return sharedStores.Get("memory", func() (Store, error) {
+			return NewMemoryStore(), nil
+		})
+	case "", "file":
+		return sharedStores.Get(fmt.Sprintf("file %s %v", cfg.File, cfg.FlushInterval), func() (Store, error) {
+			return NewFileStore(cfg.File, cfg.FlushInterval)
+		})
+	case "redis":
+		return sharedStores.Get(fmt.Sprintf("redis %v %s %v", cfg.Redis, cfg.KeyPrefix, cfg.StoreTimeout), func() (Store, error) {
+			return NewRedisStore(cfg.Redis, cfg.KeyPrefix, cfg.StoreTimeout), nil
+		})
+	default:
+		return nil, nil, fmt.Errorf("unknown quota store: %s", cfg.Store)
+	}
+}
+
+// sharedStores are the stores created, by settings
+var sharedStores shared.Stores[Store]
+
+// Flush saves the usage held by file stores. It is called on shutdown so no
+// usage recorded since the last periodic save is lost.
+func Flush() error {
+	var firstErr error
+	sharedStores.Each(func(store Store) {
+		if fileStore, ok := store.(*FileStore); ok {
+			if err := fileStore.Flush(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
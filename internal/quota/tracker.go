@@ -0,0 +1,213 @@
+package quota
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// counterRetention is how long counters are kept after their period ends,
+// covering clock skew between replicas
+const counterRetention = 24 * time.Hour
+
+// PeriodUsage is the usage of an API key in a quota period
+type PeriodUsage struct {
+	Limit     int64     `json:"limit"` // 0 is unlimited
+	Used      int64     `json:"used"`
+	Remaining *int64    `json:"remaining,omitempty"` // unset when unlimited
+	Reset     time.Time `json:"reset"`
+}
+
+// Usage is the usage of an API key in the current day and month
+type Usage struct {
+	Key     string      `json:"key"` // masked
+	Plan    string      `json:"plan,omitempty"`
+	Daily   PeriodUsage `json:"daily"`
+	Monthly PeriodUsage `json:"monthly"`
+}
+
+// Exceeded returns the period whose quota is used up, nil if none is
+func (u *Usage) Exceeded() *PeriodUsage {
+	for _, period := range []*PeriodUsage{&u.Daily, &u.Monthly} {
+		if period.Remaining != nil && *period.Remaining <= 0 {
+			return period
+		}
+	}
+	return nil
+}
+
+// Tightest returns the limited period with the fewest remaining requests, nil
+// if neither is limited
+func (u *Usage) Tightest() *PeriodUsage {
+	var tightest *PeriodUsage
+	for _, period := range []*PeriodUsage{&u.Daily, &u.Monthly} {
+		if period.Remaining != nil && (tightest == nil || *period.Remaining < *tightest.Remaining) {
+			tightest = period
+		}
+	}
+	return tightest
+}
+
+// Tracker counts the requests of API keys against their plans
+type Tracker struct {
+	store       Store
+	release     func() error
+	plans       map[string]config.QuotaPlan
+	defaultPlan *config.QuotaPlan
+}
+
+// NewTracker creates a tracker for the plans of a quota configuration
+func NewTracker(cfg config.QuotaMiddlewareConfig) (*Tracker, error) {
+	store, release, err := NewStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	plans := make(map[string]config.QuotaPlan, len(cfg.Keys))
+	for _, plan := range cfg.Keys {
+		plans[plan.Key] = plan
+	}
+	return &Tracker{store: store, release: release, plans: plans, defaultPlan: cfg.Default}, nil
+}
+
+// Close releases the store of the tracker
+func (t *Tracker) Close() error {
+	return t.release()
+}
+
+// Plan returns the plan of an API key, false if the key is unknown
+func (t *Tracker) Plan(key string) (config.QuotaPlan, bool) {
+	if plan, ok := t.plans[key]; ok {
+		return plan, true
+	}
+	if t.defaultPlan != nil {
+		return *t.defaultPlan, true
+	}
+	return config.QuotaPlan{}, false
+}
+
+// Consume counts a request of an API key. It returns false, without counting
+// the request, if a quota of the key's plan is used up.
+func (t *Tracker) Consume(ctx context.Context, key string, plan config.QuotaPlan, now time.Time) (*Usage, bool, error) {
+	usage := newUsage(key, plan, now)
+	periods := t.periods(key, usage, now)
+
+	for i, period := range periods {
+		used, err := t.store.Add(ctx, period.counter, 1, period.ttl)
+		if err != nil {
+			t.rollback(ctx, periods[:i])
+			return nil, false, err
+		}
+		period.usage.set(used)
+
+		if period.usage.Limit > 0 && used > period.usage.Limit {
+			// Rejected requests do not count against the quota
+			t.rollback(ctx, periods[:i+1])
+			for _, p := range periods[i+1:] {
+				if err := t.read(ctx, p); err != nil {
+					return nil, false, err
+				}
+			}
+			return usage, false, nil
+		}
+	}
+	return usage, true, nil
+}
+
+// Usage returns the usage of an API key
+func (t *Tracker) Usage(ctx context.Context, key string, plan config.QuotaPlan, now time.Time) (*Usage, error) {
+	usage := newUsage(key, plan, now)
+	for _, period := range t.periods(key, usage, now) {
+		if err := t.read(ctx, period); err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
+
+// Plans returns the plans of the configured API keys
+func (t *Tracker) Plans() []config.QuotaPlan {
+	plans := make([]config.QuotaPlan, 0, len(t.plans))
+	for _, plan := range t.plans {
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// period is the counter of a quota period
+type period struct {
+	counter string
+	ttl     time.Duration
+	usage   *PeriodUsage
+}
+
+// periods returns the counters of the current day and month of a key
+func (t *Tracker) periods(key string, usage *Usage, now time.Time) []period {
+	id := keyID(key)
+	return []period{
+		{counter: id + ":day:" + now.UTC().Format("2006-01-02"), ttl: usage.Daily.Reset.Sub(now) + counterRetention, usage: &usage.Daily},
+		{counter: id + ":month:" + now.UTC().Format("2006-01"), ttl: usage.Monthly.Reset.Sub(now) + counterRetention, usage: &usage.Monthly},
+	}
+}
+
+// read loads the value of a period's counter
+func (t *Tracker) read(ctx context.Context, p period) error {
+	used, err := t.store.Get(ctx, p.counter)
+	if err != nil {
+		return err
+	}
+	p.usage.set(used)
+	return nil
+}
+
+// rollback uncounts a request from periods. It is best effort: a failure
+// only overcounts the request.
+func (t *Tracker) rollback(ctx context.Context, periods []period) {
+	for _, p := range periods {
+		_, _ = t.store.Add(ctx, p.counter, -1, p.ttl)
+		p.usage.set(p.usage.Used - 1)
+	}
+}
+
+// set records the used requests of a period
+func (p *PeriodUsage) set(used int64) {
+	p.Used = used
+	if p.Limit > 0 {
+		remaining := max(p.Limit-used, 0)
+		p.Remaining = &remaining
+	}
+}
+
+// newUsage creates the empty usage of a key in the periods containing now
+func newUsage(key string, plan config.QuotaPlan, now time.Time) *Usage {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	usage := &Usage{
+		Key:     MaskKey(key),
+		Plan:    plan.Name,
+		Daily:   PeriodUsage{Limit: plan.Daily, Reset: day.AddDate(0, 0, 1)},
+		Monthly: PeriodUsage{Limit: plan.Monthly, Reset: month.AddDate(0, 1, 0)},
+	}
+	usage.Daily.set(0)
+	usage.Monthly.set(0)
+	return usage
+}
+
+// keyID identifies a key in counter names without storing the key itself
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:12])
+}
+
+// MaskKey hides all but the first characters of an API key
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return fmt.Sprintf("%s****", key[:4])
+}
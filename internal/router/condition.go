@@ -0,0 +1,117 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+)
+
+// Condition matches a request header or query parameter. Exactly one of
+// Exact, Regex and Present is set.
+type Condition struct {
+	Name    string
+	Exact   string // a value equal to this
+	Regex   string // a value matching this regular expression
+	Present *bool  // whether the header or parameter is sent at all
+}
+
+// condition is a compiled Condition
+type condition struct {
+	name    string
+	exact   string
+	regex   *regexp.Regexp
+	present *bool
+}
+
+// ValidateCondition checks a condition
+func ValidateCondition(c Condition) error {
+	_, err := compileCondition(c)
+	return err
+}
+
+// compileCondition compiles a condition
+func compileCondition(c Condition) (condition, error) {
+	if c.Name == "" {
+		return condition{}, fmt.Errorf("condition name cannot be empty")
+	}
+	set := 0
+	for _, isSet := range []bool{c.Exact != "", c.Regex != "", c.Present != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return condition{}, fmt.Errorf("condition on %s must set exactly one of exact, regex and present", c.Name)
+	}
+
+	compiled := condition{name: c.Name, exact: c.Exact, present: c.Present}
+	if c.Regex != "" {
+		regex, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return condition{}, fmt.Errorf("invalid regex for %s: %w", c.Name, err)
+		}
+		compiled.regex = regex
+	}
+	return compiled, nil
+}
+
+// matches reports whether the values sent under the condition's name, nil
+// if none were, satisfy it. One matching value is enough.
+func (c *condition) matches(values []string) bool {
+	if c.present != nil {
+		return (len(values) > 0) == *c.present
+	}
+	for _, value := range values {
+		if c.regex != nil {
+			if c.regex.MatchString(value) {
+				return true
+			}
+		} else if value == c.exact {
+			return true
+		}
+	}
+	return false
+}
+
+// conditions are the compiled header and query conditions of a rule
+type conditions struct {
+	headers []condition
+	query   []condition
+}
+
+// compileConditions compiles the conditions of a rule
+func compileConditions(rule Rule) (conditions, error) {
+	var compiled conditions
+	for _, c := range rule.Headers {
+		header, err := compileCondition(c)
+		if err != nil {
+			return conditions{}, fmt.Errorf("headers_match: %w", err)
+		}
+		compiled.headers = append(compiled.headers, header)
+	}
+	for _, c := range rule.Query {
+		query, err := compileCondition(c)
+		if err != nil {
+			return conditions{}, fmt.Errorf("query_match: %w", err)
+		}
+		compiled.query = append(compiled.query, query)
+	}
+	return compiled, nil
+}
+
+// matches reports whether a request satisfies every condition. query parses
+// the request's query string once for all rules.
+func (cs *conditions) matches(r *http.Request, query func() url.Values) bool {
+	for i := range cs.headers {
+		if !cs.headers[i].matches(r.Header.Values(cs.headers[i].name)) {
+			return false
+		}
+	}
+	for i := range cs.query {
+		if !cs.query[i].matches(query()[cs.query[i].name]) {
+			return false
+		}
+	}
+	return true
+}
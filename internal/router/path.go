@@ -0,0 +1,105 @@
+package router
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a parsed route path. Paths take one of these forms:
+//
+//	/users          the exact path
+//	/api/*          any path starting with /api
+//	/users/:id      :name matches one non-empty path segment
+//	/users/:id/*    parameters and a prefix combined
+//	~^/v[0-9]+/     a regular expression matched against the path
+type Pattern struct {
+	segments []segment
+	prefix   bool           // whether the pattern ends in /*
+	regex    *regexp.Regexp // set for regular expressions only
+}
+
+// segment is either static text or a parameter
+type segment struct {
+	static string
+	param  string
+}
+
+// ParsePath parses a route path
+func ParsePath(path string) (*Pattern, error) {
+	if expr, ok := strings.CutPrefix(path, "~"); ok {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %q: %w", expr, err)
+		}
+		return &Pattern{regex: regex}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("route path must start with '/' or '~'")
+	}
+
+	pattern := &Pattern{}
+	if base, ok := strings.CutSuffix(path, "/*"); ok {
+		pattern.prefix = true
+		path = base
+	}
+	if strings.Contains(path, "*") {
+		return nil, fmt.Errorf("invalid path %q: * is only allowed as a trailing /*", path)
+	}
+
+	// Static text runs until a segment starting with :, which is a parameter
+	var static strings.Builder
+	for i, part := range strings.Split(path, "/") {
+		if i > 0 {
+			static.WriteByte('/')
+		}
+		name, ok := strings.CutPrefix(part, ":")
+		if !ok {
+			static.WriteString(part)
+			continue
+		}
+		if !validParamName(name) {
+			return nil, fmt.Errorf("invalid path %q: invalid parameter name %q", path, name)
+		}
+		pattern.segments = append(pattern.segments, segment{static: static.String()}, segment{param: name})
+		static.Reset()
+	}
+	if static.Len() > 0 || len(pattern.segments) == 0 {
+		pattern.segments = append(pattern.segments, segment{static: static.String()})
+	}
+	return pattern, nil
+}
+
+// validParamName reports whether name is a letter or underscore followed by
+// letters, digits and underscores
+func validParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Static reports whether a route path is an exact path or a /* prefix,
+// without parameters or a regular expression
+func Static(path string) bool {
+	return !strings.HasPrefix(path, "~") && !strings.Contains(path, "/:")
+}
+
+// MatchPath reports whether a route path matches a request path
+func MatchPath(routePath, path string) bool {
+	pattern, err := ParsePath(routePath)
+	if err != nil {
+		return false
+	}
+	t := newTable()
+	t.add(0, pattern)
+	matched := false
+	t.lookup(path, func(rules ...int) { matched = matched || len(rules) > 0 })
+	return matched
+}
@@ -0,0 +1,253 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rule is what the router needs to know of a route
+type Rule struct {
+	Host     string      // exact host, *.example.com, ~regex, or empty for any host
+	Path     string      // path pattern, see ParsePath
+	Methods  []string    // empty for any method
+	Headers  []Condition // header conditions, all of which must hold
+	Query    []Condition // query parameter conditions, all of which must hold
+	Priority int         // rules with a higher priority are preferred
+}
+
+// Router finds the rule matching a request. Rules are compiled into a radix
+// tree per host, so lookups do not scan every rule. When several rules
+// match, the one with the highest priority wins, then the first one.
+type Router struct {
+	rules      []Rule
+	conditions []conditions      // by rule
+	hosts      map[string]*table // by exact host
+	wildcards  []*wildcardTable  // *.example.com hosts
+	patterns   []*patternTable   // ~regex hosts
+	anyHost    *table            // rules without a host
+}
+
+// table holds the path patterns of the rules of one host
+type table struct {
+	tree    *node
+	regexes []regexRule
+}
+
+// wildcardTable holds the rules of a wildcard host
+type wildcardTable struct {
+	suffix string // .example.com for *.example.com
+	*table
+}
+
+// patternTable holds the rules of a regex host
+type patternTable struct {
+	source  string
+	pattern *regexp.Regexp
+	*table
+}
+
+// regexRule is a rule whose path is a regular expression
+type regexRule struct {
+	rule    int
+	pattern *regexp.Regexp
+}
+
+// New compiles rules into a router. Match returns indexes into rules.
+func New(rules []Rule) (*Router, error) {
+	rt := &Router{
+		rules:      rules,
+		conditions: make([]conditions, len(rules)),
+		hosts:      make(map[string]*table),
+	}
+	for i, rule := range rules {
+		var err error
+		if rt.conditions[i], err = compileConditions(rule); err != nil {
+			return nil, fmt.Errorf("route rule %d: %w", i, err)
+		}
+		pattern, err := ParsePath(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("route rule %d: %w", i, err)
+		}
+		if err := ValidateHost(rule.Host); err != nil {
+			return nil, fmt.Errorf("route rule %d: %w", i, err)
+		}
+		rt.table(rule.Host).add(i, pattern)
+	}
+	return rt, nil
+}
+
+// table returns the table of a host, creating it if needed. The host is
+// valid.
+func (rt *Router) table(host string) *table {
+	if source, ok := strings.CutPrefix(host, "~"); ok {
+		for _, pattern := range rt.patterns {
+			if pattern.source == source {
+				return pattern.table
+			}
+		}
+		pattern := &patternTable{source: source, pattern: regexp.MustCompile(source), table: newTable()}
+		rt.patterns = append(rt.patterns, pattern)
+		return pattern.table
+	}
+
+	host = strings.ToLower(host)
+	switch {
+	case host == "":
+		if rt.anyHost == nil {
+			rt.anyHost = newTable()
+		}
+		return rt.anyHost
+	case strings.HasPrefix(host, "*."):
+		suffix := host[1:]
+		for _, wildcard := range rt.wildcards {
+			if wildcard.suffix == suffix {
+				return wildcard.table
+			}
+		}
+		wildcard := &wildcardTable{suffix: suffix, table: newTable()}
+		rt.wildcards = append(rt.wildcards, wildcard)
+		return wildcard.table
+	default:
+		if rt.hosts[host] == nil {
+			rt.hosts[host] = newTable()
+		}
+		return rt.hosts[host]
+	}
+}
+
+// newTable creates an empty table
+func newTable() *table {
+	return &table{tree: &node{}}
+}
+
+// add adds the path pattern of a rule
+func (t *table) add(rule int, pattern *Pattern) {
+	if pattern.regex != nil {
+		t.regexes = append(t.regexes, regexRule{rule: rule, pattern: pattern.regex})
+		return
+	}
+	n := t.tree
+	for _, segment := range pattern.segments {
+		if segment.param != "" {
+			n = n.paramChild()
+		} else {
+			n = n.staticChild(segment.static)
+		}
+	}
+	if pattern.prefix {
+		n.prefixed = append(n.prefixed, rule)
+	} else {
+		n.exact = append(n.exact, rule)
+	}
+}
+
+// lookup calls found with the rules whose path pattern matches path
+func (t *table) lookup(path string, found func(rules ...int)) {
+	t.tree.lookup(path, found)
+	for _, regex := range t.regexes {
+		if regex.pattern.MatchString(path) {
+			found(regex.rule)
+		}
+	}
+}
+
+// Match returns the index of the rule matching a request
+func (rt *Router) Match(r *http.Request) (int, bool) {
+	var query url.Values
+	parseQuery := func() url.Values {
+		if query == nil {
+			query = r.URL.Query()
+		}
+		return query
+	}
+
+	best := -1
+	found := func(rules ...int) {
+		for _, i := range rules {
+			if rt.better(i, best) && rt.allows(i, r.Method) && rt.conditions[i].matches(r, parseQuery) {
+				best = i
+			}
+		}
+	}
+
+	host := strings.ToLower(hostname(r.Host))
+	path := r.URL.Path
+	if t := rt.hosts[host]; t != nil {
+		t.lookup(path, found)
+	}
+	for _, wildcard := range rt.wildcards {
+		if len(host) > len(wildcard.suffix) && strings.HasSuffix(host, wildcard.suffix) {
+			wildcard.lookup(path, found)
+		}
+	}
+	for _, pattern := range rt.patterns {
+		if pattern.pattern.MatchString(host) {
+			pattern.lookup(path, found)
+		}
+	}
+	if rt.anyHost != nil {
+		rt.anyHost.lookup(path, found)
+	}
+	return best, best >= 0
+}
+
+// better reports whether rule i takes precedence over rule j, -1 for none
+func (rt *Router) better(i, j int) bool {
+	if j < 0 {
+		return true
+	}
+	if rt.rules[i].Priority != rt.rules[j].Priority {
+		return rt.rules[i].Priority > rt.rules[j].Priority
+	}
+	return i < j
+}
+
+// allows reports whether rule i accepts a method
+func (rt *Router) allows(i int, method string) bool {
+	methods := rt.rules[i].Methods
+	if len(methods) == 0 {
+		return true
+	}
+	for _, allowed := range methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// hostname strips the port from a Host header
+func hostname(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		return name
+	}
+	return host
+}
+
+// ValidateHost checks a route host: empty, a host name, a wildcard
+// *.example.com matching its subdomains, or a regular expression after a ~,
+// matched against the lowercased host name
+func ValidateHost(host string) error {
+	if expr, ok := strings.CutPrefix(host, "~"); ok {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid host regex %q: %w", expr, err)
+		}
+		return nil
+	}
+
+	name := host
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		name = rest
+	}
+	if name == "" && host != "" {
+		return fmt.Errorf("invalid host %q: wildcard needs a domain", host)
+	}
+	if strings.ContainsAny(name, "*/ ") {
+		return fmt.Errorf("invalid host %q: only a leading *. wildcard is supported", host)
+	}
+	return nil
+}
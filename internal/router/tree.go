@@ -0,0 +1,89 @@
+package router
+
+import "strings"
+
+// node is a node of a radix tree of path patterns. Static text is stored on
+// the edges, compressed so that siblings never share a first byte.
+type node struct {
+	label    string  // static text leading to this node
+	children []*node // static children, with distinct first bytes
+	param    *node   // child matching one path segment, if any
+	exact    []int   // rules matching paths that end here
+	prefixed []int   // rules matching every path that continues from here
+}
+
+// staticChild returns the node reached from n by the static text s,
+// splitting edges as needed
+func (n *node) staticChild(s string) *node {
+	for s != "" {
+		child := n.child(s[0])
+		if child == nil {
+			child = &node{label: s}
+			n.children = append(n.children, child)
+			return child
+		}
+
+		common := commonPrefix(s, child.label)
+		if common < len(child.label) {
+			rest := *child
+			rest.label = child.label[common:]
+			*child = node{label: child.label[:common], children: []*node{&rest}}
+		}
+		n = child
+		s = s[common:]
+	}
+	return n
+}
+
+// paramChild returns the parameter child of n, creating it if needed
+func (n *node) paramChild() *node {
+	if n.param == nil {
+		n.param = &node{}
+	}
+	return n.param
+}
+
+// child returns the static child whose label starts with c
+func (n *node) child(c byte) *node {
+	for _, child := range n.children {
+		if child.label[0] == c {
+			return child
+		}
+	}
+	return nil
+}
+
+// lookup calls found with the rules matching path, the part of the request
+// path left after reaching n. Both static and parameter branches are
+// followed, as either may hold the preferred rule.
+func (n *node) lookup(path string, found func(rules ...int)) {
+	if len(n.prefixed) > 0 {
+		found(n.prefixed...)
+	}
+	if path == "" {
+		if len(n.exact) > 0 {
+			found(n.exact...)
+		}
+		return
+	}
+
+	if child := n.child(path[0]); child != nil && strings.HasPrefix(path, child.label) {
+		child.lookup(path[len(child.label):], found)
+	}
+	if n.param != nil && path[0] != '/' {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		n.param.lookup(path[end:], found)
+	}
+}
+
+// commonPrefix returns the length of the common prefix of a and b
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,179 @@
+package scaffold
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+//go:embed templates/*.yaml.tmpl
+var templateFS embed.FS
+
+// Sections are the generated configuration files, in the order they are
+// written
+var Sections = []string{"global", "upstreams", "routes", "middleware", "tls", "health", "metrics"}
+
+// TLS modes
+const (
+	TLSOff        = "off"
+	TLSSelfSigned = "self-signed"
+	TLSAutoCert   = "autocert"
+)
+
+// Options describes the starter configuration
+type Options struct {
+	Host        string   // host name routed to the upstream
+	Upstream    string   // upstream service name
+	Targets     []string // upstream target URLs
+	HTTPPort    int
+	HTTPSPort   int
+	TLS         string // off, self-signed or autocert
+	Email       string // Let's Encrypt account email
+	Admin       bool   // enable the admin API
+	AdminPort   int
+	AdminToken  string // generated when empty
+	HealthPort  int
+	MetricsPort int
+}
+
+// DefaultOptions returns the options used for values that are not given
+func DefaultOptions() Options {
+	return Options{
+		Host:        "localhost",
+		Upstream:    "app",
+		Targets:     []string{"http://127.0.0.1:3000"},
+		HTTPPort:    8080,
+		HTTPSPort:   8443,
+		TLS:         TLSOff,
+		Admin:       true,
+		AdminPort:   8083,
+		HealthPort:  8081,
+		MetricsPort: 8082,
+	}
+}
+
+// File is a generated configuration file
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Validate checks options that the templates cannot express safely
+func (o *Options) Validate() error {
+	if o.Host == "" || strings.ContainsAny(o.Host, " /:\"") {
+		return fmt.Errorf("invalid host: %q", o.Host)
+	}
+	if o.Upstream == "" || strings.ContainsAny(o.Upstream, " :\"#") {
+		return fmt.Errorf("invalid upstream name: %q", o.Upstream)
+	}
+	if len(o.Targets) == 0 {
+		return fmt.Errorf("at least one upstream target is required")
+	}
+	for _, target := range o.Targets {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid upstream target: %q, must be an http or https URL", target)
+		}
+	}
+	switch o.TLS {
+	case TLSOff, TLSSelfSigned:
+	case TLSAutoCert:
+		if o.Email == "" {
+			return fmt.Errorf("autocert requires an email address")
+		}
+	default:
+		return fmt.Errorf("invalid TLS mode: %s, must be one of: %s, %s, %s", o.TLS, TLSOff, TLSSelfSigned, TLSAutoCert)
+	}
+	return nil
+}
+
+// Render generates the configuration files and checks that they load and
+// validate
+func Render(opts Options) ([]File, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.AdminToken == "" {
+		token, err := randomToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate admin token: %w", err)
+		}
+		opts.AdminToken = token
+	}
+
+	templates, err := template.New("").Funcs(template.FuncMap{
+		"quote": strconv.Quote,
+	}).ParseFS(templateFS, "templates/*.yaml.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	files := make([]File, 0, len(Sections))
+	data := make(map[string][]byte, len(Sections))
+	for _, section := range Sections {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, section+".yaml.tmpl", opts); err != nil {
+			return nil, fmt.Errorf("failed to render %s.yaml: %w", section, err)
+		}
+		files = append(files, File{Name: section + ".yaml", Content: buf.Bytes()})
+		data[section] = buf.Bytes()
+	}
+
+	cfg, err := config.LoadConfigFromData(data, config.LoadOptions{Strict: true})
+	if err != nil {
+		return nil, fmt.Errorf("generated configuration does not load: %w", err)
+	}
+	if err := config.ValidateConfig(cfg, zap.NewNop()); err != nil {
+		return nil, fmt.Errorf("generated configuration is invalid: %w", err)
+	}
+
+	return files, nil
+}
+
+// Write writes the files to dir. Existing files are only replaced when
+// force is set; nothing is written if any of them exists.
+func Write(dir string, files []File, force bool) error {
+	if !force {
+		for _, file := range files {
+			path := filepath.Join(dir, file.Name)
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists", path)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	for _, file := range files {
+		mode := os.FileMode(0644)
+		if file.Name == "global.yaml" {
+			// Holds the admin token
+			mode = 0600
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.Name), file.Content, mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// randomToken returns a random hex-encoded admin token
+func randomToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,104 @@
+// Package shared holds what is kept across configuration reloads by the
+// packages storing state outside the proxy: stores shared by the users of
+// their settings, and the Redis clients they connect with.
+package shared
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stores holds the values created for settings, so configurations with the
+// same settings share one. Values count their users and are closed once the
+// last one releases them. The zero value is ready to use.
+type Stores[T io.Closer] struct {
+	mu     sync.Mutex
+	values map[[sha256.Size]byte]*sharedValue[T]
+}
+
+// sharedValue is a value of Stores and the number of its users
+type sharedValue[T io.Closer] struct {
+	value T
+	users int
+}
+
+// Get returns the value created for settings, creating it on first use, and
+// a function releasing it for the caller. Settings are kept as a digest, as
+// they may carry passwords.
+func (s *Stores[T]) Get(settings string, create func() (T, error)) (T, func() error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sha256.Sum256([]byte(settings))
+	shared, ok := s.values[key]
+	if !ok {
+		value, err := create()
+		if err != nil {
+			return value, nil, err
+		}
+		if s.values == nil {
+			s.values = make(map[[sha256.Size]byte]*sharedValue[T])
+		}
+		shared = &sharedValue[T]{value: value}
+		s.values[key] = shared
+	}
+	shared.users++
+
+	var once sync.Once
+	release := func() error {
+		var err error
+		once.Do(func() { err = s.release(key, shared) })
+		return err
+	}
+	return shared.value, release, nil
+}
+
+// release drops a user of a value, closing it when it was the last one
+func (s *Stores[T]) release(key [sha256.Size]byte, shared *sharedValue[T]) error {
+	s.mu.Lock()
+	shared.users--
+	last := shared.users == 0
+	if last {
+		delete(s.values, key)
+	}
+	s.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+	return shared.value.Close()
+}
+
+// Each calls f with every value in use
+func (s *Stores[T]) Each(f func(T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, shared := range s.values {
+		f(shared.value)
+	}
+}
+
+// NewRedisClient creates a client of a Redis server whose connections and
+// commands time out after timeout. Connections are opened on first use.
+func NewRedisClient(cfg config.RedisConfig, timeout time.Duration) *redis.Client {
+	options := &redis.Options{
+		Addr:         cfg.Address,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+	if cfg.TLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(options)
+}
@@ -0,0 +1,317 @@
+package slo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+)
+
+// Alert is a burn rate alert of an objective that started or stopped firing
+type Alert struct {
+	SLO                  string
+	Objective            string
+	Alert                string
+	Firing               bool
+	Target               float64
+	BurnRate             float64 // burn rate the alert fires at
+	LongWindow           time.Duration
+	ShortWindow          time.Duration
+	LongBurnRate         float64
+	ShortBurnRate        float64
+	ErrorBudgetRemaining float64
+	Since                time.Time // when the alert started firing
+}
+
+// Report describes the compliance of an SLO over its window
+type Report struct {
+	Name       string            `json:"name"`
+	Window     string            `json:"window"`
+	Requests   uint64            `json:"requests"`
+	Objectives []ObjectiveReport `json:"objectives"`
+}
+
+// ObjectiveReport describes the compliance of an objective
+type ObjectiveReport struct {
+	Objective            string             `json:"objective"`
+	Target               float64            `json:"target"`
+	Threshold            string             `json:"threshold,omitempty"` // latency objectives only
+	Good                 uint64             `json:"good"`
+	Bad                  uint64             `json:"bad"`
+	Compliance           float64            `json:"compliance"`             // share of good responses, 1 without requests
+	ErrorBudgetRemaining float64            `json:"error_budget_remaining"` // share of the budget left, negative when overspent
+	BurnRates            map[string]float64 `json:"burn_rates"`             // by alert window
+	FiringAlerts         []string           `json:"firing_alerts,omitempty"`
+}
+
+// Monitor evaluates the burn rate alerts of every SLO periodically and
+// reports alerts that start or stop firing
+type Monitor struct {
+	logger *zap.Logger
+	notify func(Alert)
+
+	mu       sync.Mutex
+	settings config.SLOSettings
+	firing   map[string]time.Time // by alertKey
+	reset    chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewMonitor creates a monitor passing alert changes to notify
+func NewMonitor(notify func(Alert), logger *zap.Logger) *Monitor {
+	return &Monitor{
+		logger: logger,
+		notify: notify,
+		firing: make(map[string]time.Time),
+		reset:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Update applies the SLO settings and routes of a configuration. Alerts of
+// objectives that no longer exist are forgotten.
+func (m *Monitor) Update(cfg *config.Config) {
+	Retain(cfg)
+
+	m.mu.Lock()
+	m.settings = cfg.Global.SLO
+	valid := make(map[string]bool)
+	for _, t := range trackers() {
+		_, targets := t.targets()
+		for _, o := range targets {
+			for _, alert := range m.settings.BurnAlerts {
+				valid[alertKey(t.name, o.kind, alert.Name)] = true
+			}
+		}
+	}
+	for key := range m.firing {
+		if !valid[key] {
+			delete(m.firing, key)
+		}
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Start evaluates the alerts every evaluation interval until Stop
+func (m *Monitor) Start() {
+	go func() {
+		defer close(m.done)
+		for {
+			m.mu.Lock()
+			interval := m.settings.EvaluationInterval
+			m.mu.Unlock()
+			if interval <= 0 {
+				interval = time.Minute
+			}
+
+			timer := time.NewTimer(interval)
+			select {
+			case <-timer.C:
+				m.evaluate()
+			case <-m.reset:
+				timer.Stop()
+			case <-m.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops evaluating alerts
+func (m *Monitor) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+// evaluate checks every alert of every objective, reporting the ones that
+// changed state
+func (m *Monitor) evaluate() {
+	now := time.Now()
+	var changed []Alert
+
+	m.mu.Lock()
+	for _, t := range trackers() {
+		objective, targets := t.targets()
+		window := t.counts(now, objective.Window)
+		for _, o := range targets {
+			for _, burn := range m.settings.BurnAlerts {
+				long := t.counts(now, burn.LongWindow)
+				short := t.counts(now, burn.ShortWindow)
+				alert := Alert{
+					SLO:                  t.name,
+					Objective:            o.kind,
+					Alert:                burn.Name,
+					Target:               o.value,
+					BurnRate:             burn.BurnRate,
+					LongWindow:           burn.LongWindow,
+					ShortWindow:          burn.ShortWindow,
+					LongBurnRate:         o.burnRate(long),
+					ShortBurnRate:        o.burnRate(short),
+					ErrorBudgetRemaining: 1 - o.burnRate(window),
+				}
+				alert.Firing = alert.LongBurnRate >= burn.BurnRate &&
+					alert.ShortBurnRate >= burn.BurnRate &&
+					long.total >= uint64(m.settings.MinRequests)
+
+				key := alertKey(t.name, o.kind, burn.Name)
+				since, wasFiring := m.firing[key]
+				switch {
+				case alert.Firing && !wasFiring:
+					m.firing[key] = now
+					alert.Since = now
+					changed = append(changed, alert)
+				case !alert.Firing && wasFiring:
+					delete(m.firing, key)
+					alert.Since = since
+					changed = append(changed, alert)
+				}
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, alert := range changed {
+		fields := []zap.Field{
+			zap.String("slo", alert.SLO),
+			zap.String("objective", alert.Objective),
+			zap.String("alert", alert.Alert),
+			zap.Float64("long_burn_rate", alert.LongBurnRate),
+			zap.Float64("short_burn_rate", alert.ShortBurnRate),
+			zap.Float64("error_budget_remaining", alert.ErrorBudgetRemaining),
+		}
+		if alert.Firing {
+			m.logger.Warn("SLO error budget burning too fast", fields...)
+		} else {
+			m.logger.Info("SLO error budget burn resolved", fields...)
+		}
+		m.notify(alert)
+	}
+}
+
+// Reports describes the compliance of every SLO
+func (m *Monitor) Reports() []Report {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []Report
+	for _, t := range trackers() {
+		objective, targets := t.targets()
+		window := t.counts(now, objective.Window)
+		report := Report{
+			Name:     t.name,
+			Window:   objective.Window.String(),
+			Requests: window.total,
+		}
+		for _, o := range targets {
+			bad := window.bad(o.kind)
+			compliance := 1.0
+			if window.total > 0 {
+				compliance = 1 - float64(bad)/float64(window.total)
+			}
+			or := ObjectiveReport{
+				Objective:            o.kind,
+				Target:               o.value,
+				Good:                 window.total - bad,
+				Bad:                  bad,
+				Compliance:           compliance,
+				ErrorBudgetRemaining: 1 - o.burnRate(window),
+				BurnRates:            make(map[string]float64),
+			}
+			if o.threshold > 0 {
+				or.Threshold = o.threshold.String()
+			}
+			for _, burn := range m.settings.BurnAlerts {
+				for _, w := range []time.Duration{burn.LongWindow, burn.ShortWindow} {
+					or.BurnRates[w.String()] = o.burnRate(t.counts(now, w))
+				}
+				if _, firing := m.firing[alertKey(t.name, o.kind, burn.Name)]; firing {
+					or.FiringAlerts = append(or.FiringAlerts, burn.Name)
+				}
+			}
+			report.Objectives = append(report.Objectives, or)
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// WriteMetrics writes the compliance, error budget and burn rates of every
+// objective in the Prometheus text format
+func (m *Monitor) WriteMetrics(w io.Writer) {
+	reports := m.Reports()
+	if len(reports) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	alerts := make([]string, len(m.settings.BurnAlerts))
+	for i, burn := range m.settings.BurnAlerts {
+		alerts[i] = burn.Name
+	}
+	m.mu.Unlock()
+
+	var b strings.Builder
+	gauge := func(name, help string, value func(r Report, o ObjectiveReport, emit func(labels string, v float64))) {
+		fmt.Fprintf(&b, "\n# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, r := range reports {
+			for _, o := range r.Objectives {
+				value(r, o, func(labels string, v float64) {
+					fmt.Fprintf(&b, "%s{slo=%q,objective=%q%s} %g\n", name, r.Name, o.Objective, labels, v)
+				})
+			}
+		}
+	}
+
+	gauge("sentinel_slo_target", "Target share of good responses of an objective",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) { emit("", o.Target) })
+	gauge("sentinel_slo_requests", "Responses in the compliance window of an objective",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) { emit("", float64(r.Requests)) })
+	gauge("sentinel_slo_compliance", "Share of good responses in the compliance window of an objective",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) { emit("", o.Compliance) })
+	gauge("sentinel_slo_error_budget_remaining", "Share of the error budget of an objective left in its compliance window",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) { emit("", o.ErrorBudgetRemaining) })
+	gauge("sentinel_slo_burn_rate", "Error budget burn rate of an objective over an alert window",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) {
+			windows := make([]string, 0, len(o.BurnRates))
+			for window := range o.BurnRates {
+				windows = append(windows, window)
+			}
+			sort.Strings(windows)
+			for _, window := range windows {
+				emit(fmt.Sprintf(",window=%q", window), o.BurnRates[window])
+			}
+		})
+	gauge("sentinel_slo_alert_firing", "Whether a burn rate alert of an objective is firing",
+		func(r Report, o ObjectiveReport, emit func(string, float64)) {
+			for _, alert := range alerts {
+				firing := 0.0
+				for _, name := range o.FiringAlerts {
+					if name == alert {
+						firing = 1
+					}
+				}
+				emit(fmt.Sprintf(",alert=%q", alert), firing)
+			}
+		})
+
+	io.WriteString(w, b.String())
+}
+
+// alertKey identifies an alert of an objective of an SLO
+func alertKey(slo, objective, alert string) string {
+	return slo + "\x00" + objective + "\x00" + alert
+}
@@ -0,0 +1,197 @@
+package slo
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+)
+
+// Objective kinds
+const (
+	Availability = "availability"
+	Latency      = "latency"
+)
+
+// counts are the responses recorded in a period
+type counts struct {
+	total  uint64
+	errors uint64 // 5xx responses
+	slow   uint64 // responses slower than the latency threshold
+}
+
+// add adds the counts of another period
+func (c *counts) add(other counts) {
+	c.total += other.total
+	c.errors += other.errors
+	c.slow += other.slow
+}
+
+// bad returns the responses counting against an objective
+func (c counts) bad(objective string) uint64 {
+	if objective == Latency {
+		return c.slow
+	}
+	return c.errors
+}
+
+// bucket holds the counts of one minute
+type bucket struct {
+	minute int64 // Unix minute the counts belong to
+	counts
+}
+
+// Tracker records the responses of a route in one-minute buckets covering
+// its compliance window and the longest alert window
+type Tracker struct {
+	name string
+
+	mu        sync.Mutex
+	objective config.SLOConfig
+	buckets   []bucket
+}
+
+// registry holds the trackers by SLO name, so their history survives
+// configuration reloads
+var registry = struct {
+	sync.Mutex
+	trackers map[string]*Tracker
+}{trackers: make(map[string]*Tracker)}
+
+// For returns the tracker of an SLO, creating it on first use. A tracker
+// whose retention changes keeps the history that still fits.
+func For(objective config.SLOConfig, settings config.SLOSettings) *Tracker {
+	retention := objective.Window
+	for _, alert := range settings.BurnAlerts {
+		retention = max(retention, alert.LongWindow)
+	}
+	size := int((retention + time.Minute - 1) / time.Minute)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	t, exists := registry.trackers[objective.Name]
+	if !exists {
+		t = &Tracker{name: objective.Name}
+		registry.trackers[objective.Name] = t
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.objective = objective
+	if len(t.buckets) != size {
+		buckets := make([]bucket, size)
+		oldest := time.Now().Unix()/60 - int64(size)
+		for _, b := range t.buckets {
+			if b.minute > oldest {
+				buckets[b.minute%int64(size)] = b
+			}
+		}
+		t.buckets = buckets
+	}
+	return t
+}
+
+// Retain drops the trackers of SLOs no route of cfg defines any more
+func Retain(cfg *config.Config) {
+	names := make(map[string]bool)
+	for _, rule := range cfg.Routes.Rules {
+		if rule.SLO != nil {
+			names[rule.SLO.Name] = true
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	for name := range registry.trackers {
+		if !names[name] {
+			delete(registry.trackers, name)
+		}
+	}
+}
+
+// trackers returns every tracker ordered by name
+func trackers() []*Tracker {
+	registry.Lock()
+	defer registry.Unlock()
+
+	list := make([]*Tracker, 0, len(registry.trackers))
+	for _, t := range registry.trackers {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// Record counts a response. A status of 0 means the handler wrote nothing,
+// which the server answers with 200.
+func (t *Tracker) Record(status int, duration time.Duration) {
+	minute := time.Now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.total++
+	if status >= http.StatusInternalServerError {
+		b.errors++
+	}
+	if t.objective.Latency > 0 && duration > t.objective.Latency {
+		b.slow++
+	}
+}
+
+// counts returns the responses recorded in the window ending now, including
+// the current minute
+func (t *Tracker) counts(now time.Time, window time.Duration) counts {
+	current := now.Unix() / 60
+	oldest := current - int64((window+time.Minute-1)/time.Minute)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sum counts
+	for _, b := range t.buckets {
+		if b.minute > oldest && b.minute <= current {
+			sum.add(b.counts)
+		}
+	}
+	return sum
+}
+
+// targets returns the objectives of the SLO with their targets
+func (t *Tracker) targets() (config.SLOConfig, []target) {
+	t.mu.Lock()
+	objective := t.objective
+	t.mu.Unlock()
+
+	var list []target
+	if objective.Availability > 0 {
+		list = append(list, target{kind: Availability, value: objective.Availability})
+	}
+	if objective.Latency > 0 {
+		list = append(list, target{kind: Latency, value: objective.LatencyTarget, threshold: objective.Latency})
+	}
+	return objective, list
+}
+
+// target is an objective of an SLO
+type target struct {
+	kind      string
+	value     float64       // share of responses that must be good
+	threshold time.Duration // latency objectives only
+}
+
+// burnRate returns how many times faster than sustainable the responses in
+// c consume the error budget of the objective
+func (o target) burnRate(c counts) float64 {
+	if c.total == 0 {
+		return 0
+	}
+	return float64(c.bad(o.kind)) / float64(c.total) / (1 - o.value)
+}
@@ -0,0 +1,113 @@
+package sticky
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/loadbalancer"
+	"go.uber.org/zap"
+)
+
+// Sessions pins clients of an upstream to targets. The session cookie only
+// carries a random identifier; the session table decides the target, so
+// every replica sharing the table routes a session the same way, and a
+// session whose target is gone is moved to another one for all of them.
+type Sessions struct {
+	cookie  string
+	ttl     time.Duration
+	timeout time.Duration
+	store   Store
+	release func() error
+	logger  *zap.Logger
+}
+
+// New creates the sticky sessions of an upstream
+func New(upstream string, cfg config.StickyConfig, logger *zap.Logger) (*Sessions, error) {
+	store, release, err := NewStore(upstream, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.StoreTimeout
+	if timeout <= 0 {
+		timeout = 200 * time.Millisecond
+	}
+	return &Sessions{
+		cookie:  cfg.Cookie,
+		ttl:     cfg.TTL,
+		timeout: timeout,
+		store:   store,
+		release: release,
+		logger:  logger.With(zap.String("upstream", upstream)),
+	}, nil
+}
+
+// Close releases the session store
+func (s *Sessions) Close() error {
+	return s.release()
+}
+
+// SelectTarget returns the target a request's session is pinned to. New
+// sessions, and sessions whose target is no longer available, are pinned to
+// the target chosen by the load balancer.
+func (s *Sessions) SelectTarget(w http.ResponseWriter, r *http.Request, targets []*loadbalancer.Target, lb loadbalancer.LoadBalancer) (*loadbalancer.Target, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	session := s.session(w, r)
+	pinned, found, err := s.store.Get(ctx, session)
+	if err != nil {
+		// Without the table, fall back to plain load balancing
+		s.logger.Warn("Failed to read sticky session", zap.Error(err))
+		return lb.SelectTarget(targets, r)
+	}
+
+	if found {
+		for _, target := range targets {
+			if target.IsHealthy() && target.URL.String() == pinned {
+				if err := s.store.Touch(ctx, session, s.ttl); err != nil {
+					s.logger.Warn("Failed to refresh sticky session", zap.Error(err))
+				}
+				return target, nil
+			}
+		}
+	}
+
+	target, err := lb.SelectTarget(targets, r)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		s.logger.Info("Sticky session target unavailable, moving session",
+			zap.String("from", pinned),
+			zap.String("to", target.URL.String()))
+	}
+	if err := s.store.Set(ctx, session, target.URL.String(), s.ttl); err != nil {
+		s.logger.Warn("Failed to store sticky session", zap.Error(err))
+	}
+	return target, nil
+}
+
+// session returns the session of a request, starting one if it has none
+func (s *Sessions) session(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(s.cookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	session := hex.EncodeToString(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session
+}
@@ -0,0 +1,156 @@
+package sticky
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store maps sessions to the target they are pinned to
+type Store interface {
+	// Get returns the target of a session; found is false if there is none
+	Get(ctx context.Context, session string) (target string, found bool, err error)
+	// Set pins a session to a target for ttl
+	Set(ctx context.Context, session, target string, ttl time.Duration) error
+	// Touch keeps an active session pinned for another ttl without changing
+	// its target, which another replica may have just moved
+	Touch(ctx context.Context, session string, ttl time.Duration) error
+	// Close releases the connections of the store
+	Close() error
+}
+
+// NewStore creates the store of an upstream's sticky sessions and the function
+// releasing it. Stores are
+// reused across configuration reloads, so an upstream keeps its sessions and
+// its Redis client. Redis keys carry the upstream name, so upstreams sharing
+// a server and key prefix keep separate sessions.
+func NewStore(upstream string, cfg config.StickyConfig) (Store, func() error, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return sharedStores.Get("memory "+upstream, func() (Store, error) {
+			return NewMemoryStore(), nil
+		})
+	case "redis":
+		return sharedStores.Get(fmt.Sprintf("redis %s %v %s %v", upstream, cfg.Redis, cfg.KeyPrefix, cfg.StoreTimeout), func() (Store, error) {
+			return NewRedisStore(cfg.Redis, cfg.KeyPrefix+upstream+":", cfg.StoreTimeout), nil
+		})
+	default:
+		return nil, nil, fmt.Errorf("unknown sticky session store: %s", cfg.Store)
+	}
+}
+
+// sharedStores are the stores created, by settings
+var sharedStores shared.Stores[Store]
+
+// sweepInterval is how often the memory store drops expired sessions
+const sweepInterval = time.Minute
+
+// MemoryStore keeps sessions in memory, local to one instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+// memorySession is a pinned session and when it expires
+type memorySession struct {
+	target  string
+	expires time.Time
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memorySession), lastSweep: time.Now()}
+}
+
+// Get returns the target of a session
+func (s *MemoryStore) Get(_ context.Context, session string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.sessions[session]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false, nil
+	}
+	return entry.target, true, nil
+}
+
+// Set pins a session to a target
+func (s *MemoryStore) Set(_ context.Context, session, target string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sessions[session] = memorySession{target: target, expires: now.Add(ttl)}
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for id, entry := range s.sessions {
+			if now.After(entry.expires) {
+				delete(s.sessions, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+// Touch extends the expiry of a session
+func (s *MemoryStore) Touch(_ context.Context, session string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.sessions[session]; ok {
+		entry.expires = time.Now().Add(ttl)
+		s.sessions[session] = entry
+	}
+	return nil
+}
+
+// Close does nothing, as sessions are garbage collected with the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// RedisStore keeps sessions in Redis, shared by every replica using it
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis store. Connections are opened on first use.
+func NewRedisStore(cfg config.RedisConfig, prefix string, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: shared.NewRedisClient(cfg, timeout), prefix: prefix}
+}
+
+// Get returns the target of a session
+func (s *RedisStore) Get(ctx context.Context, session string) (string, bool, error) {
+	target, err := s.client.Get(ctx, s.prefix+session).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return target, true, nil
+}
+
+// Set pins a session to a target that Redis forgets after ttl
+func (s *RedisStore) Set(ctx context.Context, session, target string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+session, target, ttl).Err()
+}
+
+// Touch extends the expiry of a session
+func (s *RedisStore) Touch(ctx context.Context, session string, ttl time.Duration) error {
+	return s.client.Expire(ctx, s.prefix+session, ttl).Err()
+}
+
+// Close closes the connections of the store
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,287 @@
+package tls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Files of the development CA directory
+const (
+	devCACertFile   = "rootCA.pem"
+	devCAKeyFile    = "rootCA-key.pem"
+	devLeafCertFile = "sentinel-dev.pem"
+	devLeafKeyFile  = "sentinel-dev-key.pem"
+)
+
+// Validity of development certificates. Leaf certificates stay below the
+// 825 days macOS accepts for certificates from locally trusted CAs.
+const (
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devLeafValidity = 825 * 24 * time.Hour
+	devLeafRenewal  = 30 * 24 * time.Hour
+)
+
+// DevCA is a local certificate authority issuing certificates for
+// development. Once its root certificate is trusted by the system and
+// browsers, the certificates it issues are accepted without warnings.
+type DevCA struct {
+	dir    string
+	cert   *x509.Certificate
+	key    crypto.Signer
+	logger *zap.Logger
+}
+
+// DefaultDevCADir returns the default directory of the development CA,
+// sentinel/dev-ca in the user configuration directory
+func DefaultDevCADir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user configuration directory: %w", err)
+	}
+	return filepath.Join(base, "sentinel", "dev-ca"), nil
+}
+
+// LoadOrCreateDevCA loads the development CA in dir, creating it first if
+// it does not exist
+func LoadOrCreateDevCA(dir string, logger *zap.Logger) (*DevCA, error) {
+	ca := &DevCA{dir: dir, logger: logger}
+
+	certPEM, certErr := os.ReadFile(ca.CertFile())
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, devCAKeyFile))
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		if err := ca.create(); err != nil {
+			return nil, err
+		}
+		return ca, nil
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid development CA in %s: %w", dir, err)
+	}
+	ca.cert, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %w", err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !ca.cert.IsCA {
+		return nil, fmt.Errorf("invalid development CA in %s: not a CA certificate and key", dir)
+	}
+	ca.key = signer
+	if time.Now().After(ca.cert.NotAfter) {
+		return nil, fmt.Errorf("development CA in %s expired at %v, remove it to create a new one", dir, ca.cert.NotAfter)
+	}
+	return ca, nil
+}
+
+// create generates the CA key and self-signed root certificate
+func (ca *DevCA) create() error {
+	if err := os.MkdirAll(ca.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	owner := "sentinel"
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		owner += "@" + host
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         "Sentinel Development CA " + owner,
+			Organization:       []string{"Sentinel development CA"},
+			OrganizationalUnit: []string{owner},
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	if err := writePEM(filepath.Join(ca.dir, devCAKeyFile), "PRIVATE KEY", mustMarshalKey(key), 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := writePEM(ca.CertFile(), "CERTIFICATE", der, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	ca.cert, _ = x509.ParseCertificate(der)
+	ca.key = key
+	ca.logger.Info("Created development CA", zap.String("dir", ca.dir), zap.String("subject", ca.cert.Subject.CommonName))
+	return nil
+}
+
+// CertFile returns the path of the CA's root certificate
+func (ca *DevCA) CertFile() string {
+	return filepath.Join(ca.dir, devCACertFile)
+}
+
+// Name returns the name the root certificate is installed under
+func (ca *DevCA) Name() string {
+	sum := sha256.Sum256(ca.cert.Raw)
+	return "sentinel-dev-ca-" + hex.EncodeToString(sum[:4])
+}
+
+// Trusted reports whether the system trust store accepts the root
+// certificate
+func (ca *DevCA) Trusted() bool {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return false
+	}
+	_, err = ca.cert.Verify(x509.VerifyOptions{Roots: roots})
+	return err == nil
+}
+
+// Issue returns the files of a certificate for hosts, reusing the one
+// issued before if it covers the same hosts and is not close to expiring
+func (ca *DevCA) Issue(hosts []string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(ca.dir, devLeafCertFile)
+	keyFile = filepath.Join(ca.dir, devLeafKeyFile)
+	if ca.covers(certFile, keyFile, hosts) {
+		return certFile, keyFile, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return "", "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         hosts[0],
+			Organization:       []string{"Sentinel development certificate"},
+			OrganizationalUnit: ca.cert.Subject.OrganizationalUnit,
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(devLeafValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate: %w", err)
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", mustMarshalKey(key), 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	ca.logger.Info("Issued development certificate",
+		zap.Strings("hosts", hosts),
+		zap.String("cert_file", certFile))
+	return certFile, keyFile, nil
+}
+
+// covers reports whether the certificate in certFile was issued by the CA
+// for exactly hosts and remains valid for a while
+func (ca *DevCA) covers(certFile, keyFile string, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || cert.CheckSignatureFrom(ca.cert) != nil {
+		return false
+	}
+	if time.Now().Add(devLeafRenewal).After(cert.NotAfter) {
+		return false
+	}
+
+	var names []string
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	wanted := make([]string, len(hosts))
+	for i, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		wanted[i] = host
+	}
+	slices.Sort(names)
+	slices.Sort(wanted)
+	return slices.Equal(names, wanted)
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// mustMarshalKey encodes an ECDSA key as PKCS #8, which cannot fail for keys
+// on the standard curves
+func mustMarshalKey(key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return der
+}
+
+// writePEM writes a PEM block to a file with the given permissions
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
@@ -11,6 +11,7 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 
 	"go.uber.org/zap"
@@ -100,6 +101,12 @@ func (g *CertificateGenerator) GenerateSelfSignedCertificate(config *SelfSignedC
 		return fmt.Errorf("failed to create certificate: %w", err)
 	}
 
+	for _, dir := range []string{filepath.Dir(config.CertFile), filepath.Dir(config.KeyFile)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create certificate directory: %w", err)
+		}
+	}
+
 	// Write certificate file
 	if err := g.writeCertificateFile(config.CertFile, certDER); err != nil {
 		return fmt.Errorf("failed to write certificate file: %w", err)
@@ -3,8 +3,10 @@ package tls
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -20,9 +22,17 @@ type Manager struct {
 	cfg          *config.TLSConfig
 	logger       *zap.Logger
 	autocertMgr  *autocert.Manager
+	redisCache   *redisCache // shared certificate cache, if configured
 	certificates map[string]*tls.Certificate
+	clientCAs    *x509.CertPool // verifies client certificates, if configured
 	mu           sync.RWMutex
 	generator    *CertificateGenerator
+
+	// Background certificate watching and OCSP stapling, between Start and
+	// Shutdown
+	reloaded chan struct{} // signals reloaded certificates to the stapler
+	stop     chan struct{}
+	wg       sync.WaitGroup
 }
 
 // NewManager creates a new TLS manager
@@ -41,6 +51,7 @@ func NewManager(cfg *config.TLSConfig, logger *zap.Logger) (*Manager, error) {
 		logger:       logger,
 		certificates: make(map[string]*tls.Certificate),
 		generator:    NewCertificateGenerator(logger),
+		reloaded:     make(chan struct{}, 1),
 	}
 
 	// Initialize auto-cert manager if enabled
@@ -55,20 +66,43 @@ func NewManager(cfg *config.TLSConfig, logger *zap.Logger) (*Manager, error) {
 		return nil, fmt.Errorf("failed to load manual certificates: %w", err)
 	}
 
+	// Load the CAs verifying client certificates
+	if cfg.ClientAuth.CAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientAuth.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		manager.clientCAs = x509.NewCertPool()
+		if !manager.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.ClientAuth.CAFile)
+		}
+	}
+
 	return manager, nil
 }
 
 // initAutoCert initializes the Let's Encrypt auto-cert manager
 func (m *Manager) initAutoCert() error {
-	// Create cache directory if it doesn't exist
-	if err := os.MkdirAll(m.cfg.AutoCert.CacheDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+	var cache autocert.Cache
+	if m.cfg.AutoCert.Cache == "redis" {
+		redisCache, err := newRedisCache(m.cfg.AutoCert, m.logger)
+		if err != nil {
+			return err
+		}
+		m.redisCache = redisCache
+		cache = redisCache
+	} else {
+		// Create cache directory if it doesn't exist
+		if err := os.MkdirAll(m.cfg.AutoCert.CacheDir, 0755); err != nil {
+			return fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		cache = autocert.DirCache(m.cfg.AutoCert.CacheDir)
 	}
 
 	// Configure auto-cert manager
 	m.autocertMgr = &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		Cache:      autocert.DirCache(m.cfg.AutoCert.CacheDir),
+		Cache:      cache,
 		HostPolicy: autocert.HostWhitelist(m.cfg.AutoCert.Hosts...),
 	}
 
@@ -77,6 +111,18 @@ func (m *Manager) initAutoCert() error {
 		m.autocertMgr.Email = m.cfg.AutoCert.Email
 	}
 
+	// Configure external account binding if required by the CA
+	if m.cfg.AutoCert.EABKeyID != "" {
+		hmacKey, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(m.cfg.AutoCert.EABHMACKey, "="))
+		if err != nil {
+			return fmt.Errorf("invalid EAB HMAC key: %w", err)
+		}
+		m.autocertMgr.ExternalAccountBinding = &acme.ExternalAccountBinding{
+			KID: m.cfg.AutoCert.EABKeyID,
+			Key: hmacKey,
+		}
+	}
+
 	// Configure staging environment if enabled
 	if m.cfg.AutoCert.Staging {
 		// Create ACME client with staging directory
@@ -88,24 +134,38 @@ func (m *Manager) initAutoCert() error {
 
 	m.logger.Info("Auto-cert manager initialized",
 		zap.Strings("hosts", m.cfg.AutoCert.Hosts),
+		zap.String("cache", m.cfg.AutoCert.Cache),
 		zap.String("cache_dir", m.cfg.AutoCert.CacheDir),
 		zap.Bool("staging", m.cfg.AutoCert.Staging))
 
 	return nil
 }
 
-// loadManualCertificates loads manually configured certificates
+// loadManualCertificates loads manually configured certificates. They
+// replace the current ones only once all of them loaded, so a failed load
+// keeps serving the previous certificates.
 func (m *Manager) loadManualCertificates() error {
+	certificates := make(map[string]*tls.Certificate)
 	for i, certConfig := range m.cfg.Certificates {
-		if err := m.loadCertificate(&certConfig); err != nil {
+		if err := m.loadCertificate(&certConfig, certificates); err != nil {
 			return fmt.Errorf("failed to load certificate %d: %w", i, err)
 		}
 	}
+
+	m.mu.Lock()
+	m.certificates = certificates
+	m.mu.Unlock()
+
+	// New certificates need their own OCSP responses
+	select {
+	case m.reloaded <- struct{}{}:
+	default:
+	}
 	return nil
 }
 
-// loadCertificate loads a single certificate
-func (m *Manager) loadCertificate(certConfig *config.CertificateConfig) error {
+// loadCertificate loads a single certificate into certificates
+func (m *Manager) loadCertificate(certConfig *config.CertificateConfig, certificates map[string]*tls.Certificate) error {
 	// If auto-generate is enabled, check if we need to generate certificates
 	if certConfig.AutoGenerate {
 		if err := m.ensureCertificateExists(certConfig); err != nil {
@@ -137,11 +197,8 @@ func (m *Manager) loadCertificate(certConfig *config.CertificateConfig) error {
 	}
 
 	// Store certificate for each host
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	for _, host := range certConfig.Hosts {
-		m.certificates[host] = &cert
+		certificates[host] = &cert
 		m.logger.Info("Loaded certificate",
 			zap.String("host", host),
 			zap.String("cert_file", certConfig.CertFile),
@@ -231,7 +288,6 @@ func (m *Manager) GetTLSConfig(host string) (*tls.Config, error) {
 
 	// Create a TLS config with a certificate callback
 	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
 		GetCertificate: func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 			// Strip port from hostname if present
 			requestedHost := clientHello.ServerName
@@ -265,25 +321,158 @@ func (m *Manager) GetTLSConfig(host string) (*tls.Config, error) {
 		},
 	}
 
+	if err := m.configureProtocol(tlsConfig); err != nil {
+		return nil, err
+	}
+	if err := m.configureClientAuth(tlsConfig); err != nil {
+		return nil, err
+	}
+
 	return tlsConfig, nil
 }
 
+// configureProtocol applies the configured protocol versions, cipher suites
+// and curves to tlsConfig. The minimum version defaults to TLS 1.2.
+func (m *Manager) configureProtocol(tlsConfig *tls.Config) error {
+	var err error
+	if tlsConfig.MinVersion, err = config.ParseTLSVersion(m.cfg.MinVersion); err != nil {
+		return err
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	if tlsConfig.MaxVersion, err = config.ParseTLSVersion(m.cfg.MaxVersion); err != nil {
+		return err
+	}
+	if tlsConfig.CipherSuites, err = config.ParseCipherSuites(m.cfg.CipherSuites); err != nil {
+		return err
+	}
+	if tlsConfig.CurvePreferences, err = config.ParseCurves(m.cfg.CurvePreferences); err != nil {
+		return err
+	}
+	return nil
+}
+
+// clientAuthType converts a client_auth mode
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify_if_given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require_and_verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid client_auth mode: %s", mode)
+	}
+}
+
+// configureClientAuth makes tlsConfig ask clients for certificates. Hosts
+// whose certificate overrides the mode get their own configuration when the
+// client names them in SNI.
+func (m *Manager) configureClientAuth(tlsConfig *tls.Config) error {
+	var err error
+	if tlsConfig.ClientAuth, err = clientAuthType(m.cfg.ClientAuth.Mode); err != nil {
+		return err
+	}
+	tlsConfig.ClientCAs = m.clientCAs
+
+	byHost := make(map[string]tls.ClientAuthType)
+	for _, certConfig := range m.cfg.Certificates {
+		if certConfig.ClientAuth == "" {
+			continue
+		}
+		clientAuth, err := clientAuthType(certConfig.ClientAuth)
+		if err != nil {
+			return fmt.Errorf("certificate for %s: %w", strings.Join(certConfig.Hosts, ", "), err)
+		}
+		for _, host := range certConfig.Hosts {
+			byHost[host] = clientAuth
+		}
+	}
+	if len(byHost) == 0 {
+		return nil
+	}
+
+	tlsConfig.GetConfigForClient = func(clientHello *tls.ClientHelloInfo) (*tls.Config, error) {
+		clientAuth, exists := byHost[clientHello.ServerName]
+		if !exists || clientAuth == tlsConfig.ClientAuth {
+			return nil, nil
+		}
+		hostConfig := tlsConfig.Clone()
+		hostConfig.GetConfigForClient = nil
+		hostConfig.ClientAuth = clientAuth
+		return hostConfig, nil
+	}
+	return nil
+}
+
 // GetAutoCertManager returns the auto-cert manager if available
 func (m *Manager) GetAutoCertManager() *autocert.Manager {
 	return m.autocertMgr
 }
 
-// ReloadCertificates reloads all manual certificates
+// ReloadCertificates reloads all manual certificates from their files,
+// e.g. after they were renewed. New handshakes use the reloaded
+// certificates; if any fails to load, the current ones stay in use.
 func (m *Manager) ReloadCertificates() error {
+	if !m.cfg.Enabled {
+		return fmt.Errorf("TLS is disabled")
+	}
 	m.logger.Info("Reloading manual certificates")
+	return m.loadManualCertificates()
+}
 
-	// Clear existing certificates
-	m.mu.Lock()
-	m.certificates = make(map[string]*tls.Certificate)
-	m.mu.Unlock()
+// CertificateInfo describes a loaded certificate
+type CertificateInfo struct {
+	Hosts     []string  `json:"hosts"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
 
-	// Reload certificates
-	return m.loadManualCertificates()
+// Certificates describes the loaded manual certificates, ordered by their
+// first host
+func (m *Manager) Certificates() []CertificateInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byCert := make(map[*tls.Certificate]*CertificateInfo)
+	var infos []*CertificateInfo
+	for host, cert := range m.certificates {
+		if info, exists := byCert[cert]; exists {
+			info.Hosts = append(info.Hosts, host)
+			continue
+		}
+		info := &CertificateInfo{Hosts: []string{host}}
+		leaf := cert.Leaf
+		if leaf == nil && len(cert.Certificate) > 0 {
+			leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+		}
+		if leaf != nil {
+			info.Subject = leaf.Subject.String()
+			info.Issuer = leaf.Issuer.String()
+			info.DNSNames = leaf.DNSNames
+			info.NotBefore = leaf.NotBefore
+			info.NotAfter = leaf.NotAfter
+		}
+		byCert[cert] = info
+		infos = append(infos, info)
+	}
+
+	list := make([]CertificateInfo, 0, len(infos))
+	for _, info := range infos {
+		sort.Strings(info.Hosts)
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hosts[0] < list[j].Hosts[0] })
+	return list
 }
 
 // GetCertificateInfo returns information about certificates
@@ -359,9 +548,40 @@ func (m *Manager) RegenerateCertificates() error {
 	return m.ReloadCertificates()
 }
 
+// Start watches the manual certificate files and staples OCSP responses in
+// the background, as configured
+func (m *Manager) Start() {
+	if !m.cfg.Enabled || len(m.cfg.Certificates) == 0 || m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+
+	if m.cfg.Watch {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.watchCertificates(m.stop)
+		}()
+	}
+	if m.cfg.OCSP.Enabled {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.staple(m.stop)
+		}()
+	}
+}
+
 // Shutdown performs cleanup operations
 func (m *Manager) Shutdown() error {
 	m.logger.Info("Shutting down TLS manager")
-	// No specific cleanup needed for TLS manager
+	if m.stop != nil {
+		close(m.stop)
+		m.wg.Wait()
+		m.stop = nil
+	}
+	if m.redisCache != nil {
+		return m.redisCache.Close()
+	}
 	return nil
 }
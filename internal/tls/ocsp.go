@@ -0,0 +1,177 @@
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspRetry is how soon a failed OCSP fetch is retried
+const ocspRetry = 5 * time.Minute
+
+// maxOCSPResponseSize bounds the OCSP responses read from responders
+const maxOCSPResponseSize = 1 << 20
+
+// staple fetches an OCSP response for each manual certificate until stop
+// is closed. Fetches are repeated within the configured refresh and before
+// the responses expire, and right away when certificates are reloaded.
+func (m *Manager) staple(stop <-chan struct{}) {
+	for {
+		wait := m.refreshOCSP(stop)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-m.reloaded:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// refreshOCSP staples fresh OCSP responses to the loaded certificates and
+// returns how long until the next refresh is due
+func (m *Manager) refreshOCSP(stop <-chan struct{}) time.Duration {
+	m.mu.RLock()
+	var certs []*tls.Certificate
+	seen := make(map[*tls.Certificate]bool)
+	for _, cert := range m.certificates {
+		if !seen[cert] {
+			seen[cert] = true
+			certs = append(certs, cert)
+		}
+	}
+	m.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wait := m.cfg.OCSP.Refresh
+	for _, cert := range certs {
+		leaf, issuer, err := certificatePair(cert)
+		if err != nil {
+			m.logger.Debug("Not stapling OCSP response", zap.Error(err))
+			continue
+		}
+
+		response, raw, err := m.fetchOCSP(ctx, leaf, issuer)
+		if err != nil {
+			m.logger.Warn("Failed to fetch OCSP response",
+				zap.String("subject", leaf.Subject.String()),
+				zap.Error(err))
+			wait = min(wait, ocspRetry)
+			continue
+		}
+		if response.Status != ocsp.Good {
+			// Stapling a revoked status would only make clients fail faster
+			m.logger.Error("OCSP responder does not report certificate as good",
+				zap.String("subject", leaf.Subject.String()),
+				zap.Int("status", response.Status))
+			wait = min(wait, ocspRetry)
+			continue
+		}
+
+		m.replaceCertificate(cert, raw)
+		m.logger.Debug("Stapled OCSP response",
+			zap.String("subject", leaf.Subject.String()),
+			zap.Time("next_update", response.NextUpdate))
+
+		// Refresh halfway to the response's expiry
+		if !response.NextUpdate.IsZero() {
+			if half := time.Until(response.NextUpdate) / 2; half < wait {
+				wait = max(half, time.Minute)
+			}
+		}
+	}
+	return wait
+}
+
+// certificatePair returns the leaf of a certificate and its issuer, which
+// must follow it in the chain
+func certificatePair(cert *tls.Certificate) (*x509.Certificate, *x509.Certificate, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, nil, fmt.Errorf("certificate chain has no issuer")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("certificate %s names no OCSP responder", leaf.Subject)
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse issuer certificate: %w", err)
+	}
+	return leaf, issuer, nil
+}
+
+// fetchOCSP asks the responder of leaf for its status, returning the parsed
+// and the raw response
+func (m *Manager) fetchOCSP(ctx context.Context, leaf, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.OCSP.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(request))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OCSP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OCSP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder returned status %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read OCSP response: %w", err)
+	}
+	response, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid OCSP response: %w", err)
+	}
+	return response, raw, nil
+}
+
+// replaceCertificate serves a copy of cert with a new OCSP staple to its
+// hosts. Certificates in use are never modified; a certificate replaced by a
+// reload in the meantime is left alone.
+func (m *Manager) replaceCertificate(cert *tls.Certificate, staple []byte) {
+	stapled := *cert
+	stapled.OCSPStaple = staple
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for host, current := range m.certificates {
+		if current == cert {
+			m.certificates[host] = &stapled
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package tls
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/bpradana/sentinel/internal/shared"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// redisCacheTimeout bounds a single Redis command of the certificate cache
+	redisCacheTimeout = 5 * time.Second
+	// lockPollInterval is how often an instance waiting for another one's
+	// issuance checks the cache
+	lockPollInterval = time.Second
+	// renewalWindow is how long before expiry autocert renews a certificate:
+	// its default RenewBefore of 30 days plus up to an hour of jitter
+	renewalWindow = 720*time.Hour + time.Hour
+)
+
+// redisCache is an autocert cache in Redis shared by the replicas of a
+// cluster. Certificates of the configured hosts are guarded by a lock taken
+// when one is missing or due for renewal: the instance holding it issues the
+// certificate, while the others wait until it is stored and use it instead
+// of issuing their own.
+type redisCache struct {
+	client  *redis.Client
+	prefix  string
+	lockTTL time.Duration
+	hosts   []string
+	token   string // identifies the locks taken by this instance
+	logger  *zap.Logger
+}
+
+// newRedisCache creates a Redis certificate cache. Connections are opened on
+// first use.
+func newRedisCache(cfg config.AutoCertConfig, logger *zap.Logger) (*redisCache, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+
+	return &redisCache{
+		client:  shared.NewRedisClient(cfg.Redis, redisCacheTimeout),
+		prefix:  cfg.KeyPrefix,
+		lockTTL: cfg.LockTTL,
+		hosts:   cfg.Hosts,
+		token:   hex.EncodeToString(token),
+		logger:  logger,
+	}, nil
+}
+
+// Get returns a cached entry. If the entry is the certificate of a
+// configured host and has to be issued or renewed, Get returns once this
+// instance holds the issuance lock, or when another instance has stored a
+// fresh certificate.
+func (c *redisCache) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := c.get(ctx, name)
+	if err != nil && !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, err
+	}
+	if !c.guarded(name) || !needsIssuance(data) {
+		return data, err
+	}
+
+	for waiting := false; ; waiting = true {
+		acquired, lockErr := c.lock(ctx, name)
+		if lockErr != nil {
+			// Issuing without the lock beats not serving the host at all
+			c.logger.Warn("Failed to take certificate issuance lock, issuing locally",
+				zap.String("name", name), zap.Error(lockErr))
+			return data, err
+		}
+		if acquired {
+			c.logger.Info("Took certificate issuance lock", zap.String("name", name))
+			return data, err
+		}
+		if !waiting {
+			c.logger.Info("Waiting for another instance to issue certificate", zap.String("name", name))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+
+		fresh, freshErr := c.get(ctx, name)
+		if freshErr == nil && !needsIssuance(fresh) {
+			c.logger.Info("Using certificate issued by another instance", zap.String("name", name))
+			return fresh, nil
+		}
+	}
+}
+
+// Put stores an entry, releasing the issuance lock of a certificate
+func (c *redisCache) Put(ctx context.Context, name string, data []byte) error {
+	if err := c.client.Set(ctx, c.prefix+name, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	if c.guarded(name) {
+		c.unlock(ctx, name)
+	}
+	return nil
+}
+
+// Delete removes an entry
+func (c *redisCache) Delete(ctx context.Context, name string) error {
+	if err := c.client.Del(ctx, c.prefix+name).Err(); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close closes the Redis client
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
+
+// get reads an entry
+func (c *redisCache) get(ctx context.Context, name string) ([]byte, error) {
+	data, err := c.client.Get(ctx, c.prefix+name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// lock takes the issuance lock of a certificate, reporting whether this
+// instance holds it. The lock expires after lockTTL in case the holder fails
+// to store the certificate.
+func (c *redisCache) lock(ctx context.Context, name string) (bool, error) {
+	key := c.prefix + "lock:" + name
+	acquired, err := c.client.SetNX(ctx, key, c.token, c.lockTTL).Result()
+	if err != nil || acquired {
+		return acquired, err
+	}
+
+	// Renewal looks the certificate up again after it was handed out
+	holder, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return holder == c.token, err
+}
+
+// unlock releases the issuance lock of a certificate if this instance holds it
+func (c *redisCache) unlock(ctx context.Context, name string) {
+	key := c.prefix + "lock:" + name
+	holder, err := c.client.Get(ctx, key).Result()
+	if err != nil || holder != c.token {
+		return
+	}
+	if err := c.client.Del(ctx, key).Err(); err != nil {
+		c.logger.Warn("Failed to release certificate issuance lock", zap.String("name", name), zap.Error(err))
+	}
+}
+
+// guarded reports whether an entry is the certificate of a configured host.
+// Other entries, such as the account key and challenge tokens, and names
+// outside the host policy are not locked.
+func (c *redisCache) guarded(name string) bool {
+	return slices.Contains(c.hosts, strings.TrimSuffix(name, "+rsa"))
+}
+
+// needsIssuance reports whether a cached certificate is missing, unreadable
+// or due for renewal
+func needsIssuance(data []byte) bool {
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return true
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return true
+		}
+		return time.Until(leaf.NotAfter) < renewalWindow
+	}
+	return true
+}
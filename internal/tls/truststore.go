@@ -0,0 +1,196 @@
+package tls
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// linuxTrustStores are the anchor directories of the Linux distribution
+// families and the commands rebuilding their trust stores from them
+var linuxTrustStores = []struct {
+	dir     string
+	command []string
+}{
+	{"/etc/pki/ca-trust/source/anchors", []string{"update-ca-trust", "extract"}},       // Fedora, RHEL
+	{"/usr/local/share/ca-certificates", []string{"update-ca-certificates"}},           // Debian, Ubuntu, Alpine
+	{"/etc/ca-certificates/trust-source/anchors", []string{"trust", "extract-compat"}}, // Arch
+	{"/usr/share/pki/trust/anchors", []string{"update-ca-certificates"}},               // openSUSE
+}
+
+// Install adds the root certificate to the system trust store and to the
+// NSS databases of Firefox and Chromium found for the current user. Changing
+// the system trust store usually requires administrator privileges, which
+// are requested through sudo.
+func (ca *DevCA) Install() error {
+	if err := ca.installSystem(); err != nil {
+		return err
+	}
+	ca.updateNSS(true)
+	return nil
+}
+
+// Uninstall removes the root certificate from the trust stores Install adds
+// it to
+func (ca *DevCA) Uninstall() error {
+	if err := ca.uninstallSystem(); err != nil {
+		return err
+	}
+	ca.updateNSS(false)
+	return nil
+}
+
+// installSystem adds the root certificate to the operating system's store
+func (ca *DevCA) installSystem() error {
+	switch runtime.GOOS {
+	case "darwin":
+		return run(true, nil, "security", "add-trusted-cert", "-d", "-k", "/Library/Keychains/System.keychain", ca.CertFile())
+	case "windows":
+		// The user's root store needs no elevation; Windows asks for
+		// confirmation itself
+		return run(false, nil, "certutil", "-addstore", "-user", "-f", "Root", ca.CertFile())
+	case "linux":
+		dir, command, err := linuxTrustStore()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(ca.CertFile())
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		path := filepath.Join(dir, ca.Name()+".crt")
+		if err := run(true, data, "tee", path); err != nil {
+			return fmt.Errorf("failed to copy CA certificate to %s: %w", path, err)
+		}
+		return run(true, nil, command[0], command[1:]...)
+	default:
+		return fmt.Errorf("installing into the trust store is not supported on %s, trust %s manually", runtime.GOOS, ca.CertFile())
+	}
+}
+
+// uninstallSystem removes the root certificate from the operating system's
+// store
+func (ca *DevCA) uninstallSystem() error {
+	switch runtime.GOOS {
+	case "darwin":
+		return run(true, nil, "security", "remove-trusted-cert", "-d", ca.CertFile())
+	case "windows":
+		return run(false, nil, "certutil", "-delstore", "-user", "Root", ca.cert.SerialNumber.Text(16))
+	case "linux":
+		dir, command, err := linuxTrustStore()
+		if err != nil {
+			return err
+		}
+		if err := run(true, nil, "rm", "-f", filepath.Join(dir, ca.Name()+".crt")); err != nil {
+			return err
+		}
+		return run(true, nil, command[0], command[1:]...)
+	default:
+		return fmt.Errorf("removing from the trust store is not supported on %s", runtime.GOOS)
+	}
+}
+
+// linuxTrustStore returns the anchor directory and update command of the
+// distribution
+func linuxTrustStore() (string, []string, error) {
+	for _, store := range linuxTrustStores {
+		if info, err := os.Stat(store.dir); err == nil && info.IsDir() {
+			if _, err := exec.LookPath(store.command[0]); err == nil {
+				return store.dir, store.command, nil
+			}
+		}
+	}
+	return "", nil, errors.New("no supported system trust store found, install the ca-certificates package")
+}
+
+// updateNSS adds the root certificate to, or removes it from, the NSS
+// databases browsers keep their own trust in. NSS is best effort: failures
+// are logged rather than returned.
+func (ca *DevCA) updateNSS(install bool) {
+	databases := nssDatabases()
+	if len(databases) == 0 {
+		return
+	}
+	if _, err := exec.LookPath("certutil"); err != nil || runtime.GOOS == "windows" {
+		ca.logger.Warn("Browser certificate databases found but NSS certutil is not installed, browsers may not trust the development CA",
+			zap.Strings("databases", databases))
+		return
+	}
+
+	for _, database := range databases {
+		args := []string{"-D", "-d", database, "-n", ca.Name()}
+		if install {
+			args = []string{"-A", "-d", database, "-t", "C,,", "-n", ca.Name(), "-i", ca.CertFile()}
+		}
+		if err := run(false, nil, "certutil", args...); err != nil {
+			ca.logger.Warn("Failed to update browser certificate database",
+				zap.String("database", database),
+				zap.Error(err))
+		}
+	}
+}
+
+// nssDatabases returns the NSS databases of the current user's Firefox
+// profiles and of Chromium on Linux, in certutil's -d notation
+func nssDatabases() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	candidates := []string{
+		filepath.Join(home, ".pki", "nssdb"),
+		filepath.Join(home, "snap", "chromium", "current", ".pki", "nssdb"),
+	}
+	for _, pattern := range []string{
+		filepath.Join(home, ".mozilla", "firefox", "*"),
+		filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox", "*"),
+		filepath.Join(home, "Library", "Application Support", "Firefox", "Profiles", "*"),
+	} {
+		profiles, _ := filepath.Glob(pattern)
+		candidates = append(candidates, profiles...)
+	}
+
+	var databases []string
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "cert9.db")); err == nil {
+			databases = append(databases, "sql:"+dir)
+		} else if _, err := os.Stat(filepath.Join(dir, "cert8.db")); err == nil {
+			databases = append(databases, "dbm:"+dir)
+		}
+	}
+	return databases
+}
+
+// run runs a command, through sudo when it needs privileges the process
+// does not have
+func run(privileged bool, stdin []byte, name string, args ...string) error {
+	if privileged && runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err != nil {
+			return fmt.Errorf("%s requires root privileges and sudo is not available", name)
+		}
+		args = append([]string{"--prompt=Sudo password to update the trust store: ", "--", name}, args...)
+		name = "sudo"
+	}
+
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package tls
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchCertificates reloads the manual certificates once changes to their
+// files settle, until stop is closed. Directories are watched rather than
+// files, so renewals that replace a file, and Kubernetes secret volumes
+// that swap a "..data" symlink, are seen too.
+func (m *Manager) watchCertificates(stop <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		m.logger.Error("Failed to create certificate watcher", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, certConfig := range m.cfg.Certificates {
+		for _, file := range []string{certConfig.CertFile, certConfig.KeyFile} {
+			file = filepath.Clean(file)
+			files[file] = true
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			m.logger.Error("Failed to watch certificate directory", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		m.logger.Info("Watching certificate directory", zap.String("dir", dir))
+	}
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	reload := func() {
+		if err := m.ReloadCertificates(); err != nil {
+			m.logger.Error("Failed to reload changed certificates", zap.Error(err))
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			name := filepath.Clean(event.Name)
+			if !files[name] && !strings.HasPrefix(filepath.Base(name), "..") {
+				continue
+			}
+			m.logger.Debug("Certificate file event",
+				zap.String("file", name),
+				zap.String("op", event.Op.String()))
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(config.DefaultDebounce, reload)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			m.logger.Error("Certificate watcher error", zap.Error(err))
+		}
+	}
+}
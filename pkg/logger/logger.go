@@ -8,35 +8,43 @@ import (
 // NewLogger creates a new structured logger
 func NewLogger(level string) (*zap.Logger, error) {
 	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(parseLevel(level))
+	config.EncoderConfig = encoderConfig()
 
-	// Set log level
+	return config.Build()
+}
+
+// NewDevelopmentLogger creates a logger suitable for development
+func NewDevelopmentLogger() (*zap.Logger, error) {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	return config.Build()
+}
+
+// parseLevel converts a configured level name, defaulting to info
+func parseLevel(level string) zapcore.Level {
 	switch level {
 	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+		return zapcore.DebugLevel
 	case "info":
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+		return zapcore.InfoLevel
 	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
+		return zapcore.WarnLevel
 	case "error":
-		config.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
+		return zapcore.ErrorLevel
 	default:
-		config.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+		return zapcore.InfoLevel
 	}
-
-	// Configure encoding
-	config.EncoderConfig.TimeKey = "timestamp"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.MessageKey = "message"
-	config.EncoderConfig.LevelKey = "level"
-	config.EncoderConfig.CallerKey = "caller"
-	config.EncoderConfig.StacktraceKey = "stacktrace"
-
-	return config.Build()
 }
 
-// NewDevelopmentLogger creates a logger suitable for development
-func NewDevelopmentLogger() (*zap.Logger, error) {
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	return config.Build()
+// encoderConfig returns the encoder configuration shared by all loggers
+func encoderConfig() zapcore.EncoderConfig {
+	encoding := zap.NewProductionEncoderConfig()
+	encoding.TimeKey = "timestamp"
+	encoding.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoding.MessageKey = "message"
+	encoding.LevelKey = "level"
+	encoding.CallerKey = "caller"
+	encoding.StacktraceKey = "stacktrace"
+	return encoding
 }
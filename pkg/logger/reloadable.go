@@ -0,0 +1,196 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bpradana/sentinel/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Reloadable builds a logger from a LogConfig and rebuilds it when the
+// configuration changes. Loggers derived from it, including those created
+// with With or Named before a reload, follow every rebuild.
+type Reloadable struct {
+	logger *zap.Logger
+	state  atomic.Pointer[loggerState]
+	mu     sync.Mutex // serializes reloads
+}
+
+// loggerState is one generation of the logger configuration
+type loggerState struct {
+	generation  uint64
+	core        zapcore.Core
+	errorOutput zapcore.WriteSyncer
+	stacktrace  bool
+	close       func()
+}
+
+// NewReloadable creates a logger from a LogConfig
+func NewReloadable(cfg config.LogConfig) (*Reloadable, error) {
+	r := &Reloadable{}
+	if err := r.Reload(cfg); err != nil {
+		return nil, err
+	}
+
+	r.logger = zap.New(&swapCore{root: r},
+		// Callers are always captured and omitted by the encoder when
+		// disabled; stack traces are only captured when enabled
+		zap.AddCaller(),
+		zap.AddStacktrace(zap.LevelEnablerFunc(func(level zapcore.Level) bool {
+			return level >= zapcore.ErrorLevel && r.state.Load().stacktrace
+		})),
+		zap.ErrorOutput(&swapSyncer{root: r}),
+	)
+	return r, nil
+}
+
+// Logger returns the logger
+func (r *Reloadable) Logger() *zap.Logger {
+	return r.logger
+}
+
+// Reload rebuilds the logger from cfg. On error the current configuration
+// stays in effect.
+func (r *Reloadable) Reload(cfg config.LogConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	encoding := encoderConfig()
+	if cfg.DisableCaller {
+		encoding.CallerKey = zapcore.OmitKey
+	}
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case "", "json":
+		encoder = zapcore.NewJSONEncoder(encoding)
+	case "text":
+		encoder = zapcore.NewConsoleEncoder(encoding)
+	default:
+		return fmt.Errorf("invalid log format: %s", cfg.Format)
+	}
+
+	outputPaths := cfg.OutputPaths
+	if len(outputPaths) == 0 {
+		outputPaths = []string{"stderr"}
+	}
+	output, closeOutput, err := zap.Open(outputPaths...)
+	if err != nil {
+		return fmt.Errorf("failed to open log output: %w", err)
+	}
+
+	errorOutputPaths := cfg.ErrorOutputPaths
+	if len(errorOutputPaths) == 0 {
+		errorOutputPaths = []string{"stderr"}
+	}
+	errorOutput, closeErrorOutput, err := zap.Open(errorOutputPaths...)
+	if err != nil {
+		closeOutput()
+		return fmt.Errorf("failed to open log error output: %w", err)
+	}
+
+	core := zapcore.NewCore(encoder, output, zap.NewAtomicLevelAt(parseLevel(cfg.Level)))
+	// Sample like the production configuration
+	core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+
+	next := &loggerState{
+		core:        core,
+		errorOutput: errorOutput,
+		stacktrace:  !cfg.DisableStacktrace,
+		close: func() {
+			closeOutput()
+			closeErrorOutput()
+		},
+	}
+
+	previous := r.state.Load()
+	if previous != nil {
+		next.generation = previous.generation + 1
+	}
+	r.state.Store(next)
+
+	if previous != nil {
+		previous.core.Sync()
+		previous.close()
+	}
+	return nil
+}
+
+// Sync flushes buffered log entries
+func (r *Reloadable) Sync() error {
+	return r.state.Load().core.Sync()
+}
+
+// swapCore delegates to the core of the current logger state
+type swapCore struct {
+	root   *Reloadable
+	fields []zapcore.Field
+	cached atomic.Pointer[cachedCore]
+}
+
+// cachedCore is the current core with a swapCore's fields applied
+type cachedCore struct {
+	generation uint64
+	core       zapcore.Core
+}
+
+// current returns the current core with the accumulated fields
+func (c *swapCore) current() zapcore.Core {
+	state := c.root.state.Load()
+	if len(c.fields) == 0 {
+		return state.core
+	}
+
+	if cached := c.cached.Load(); cached != nil && cached.generation == state.generation {
+		return cached.core
+	}
+	core := state.core.With(c.fields)
+	c.cached.Store(&cachedCore{generation: state.generation, core: core})
+	return core
+}
+
+// Enabled reports whether the current configuration logs at level
+func (c *swapCore) Enabled(level zapcore.Level) bool {
+	return c.root.state.Load().core.Enabled(level)
+}
+
+// With returns a core that adds fields to every entry
+func (c *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	combined = append(combined, c.fields...)
+	combined = append(combined, fields...)
+	return &swapCore{root: c.root, fields: combined}
+}
+
+// Check delegates to the current core, so its sampling applies
+func (c *swapCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(entry, checked)
+}
+
+// Write writes an entry to the current core
+func (c *swapCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.current().Write(entry, fields)
+}
+
+// Sync flushes the current core
+func (c *swapCore) Sync() error {
+	return c.root.state.Load().core.Sync()
+}
+
+// swapSyncer writes the logger's own errors to the current error output
+type swapSyncer struct {
+	root *Reloadable
+}
+
+// Write writes to the current error output
+func (s *swapSyncer) Write(p []byte) (int, error) {
+	return s.root.state.Load().errorOutput.Write(p)
+}
+
+// Sync flushes the current error output
+func (s *swapSyncer) Sync() error {
+	return s.root.state.Load().errorOutput.Sync()
+}
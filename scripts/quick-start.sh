@@ -63,9 +63,9 @@ build_project() {
     mkdir -p bin
     
     # Build all binaries
-    go build -o bin/sentinel cmd/proxy/main.go
-    go build -o bin/validator cmd/validator/main.go
-    go build -o bin/certgen cmd/certgen/main.go
+    go build -o bin/sentinel ./cmd/sentinel
+    go build -o bin/validator ./cmd/validator
+    go build -o bin/certgen ./cmd/certgen
     
     print_success "Build complete!"
 }